@@ -44,6 +44,7 @@ type Model struct {
 	// New UI components
 	Dashboard    *views.DashboardView
 	LessonView   *views.LessonView
+	Console      *views.ConsoleView
 	SignInView   *views.SignInView
 	CurrentModule *modules.Module
 	
@@ -71,6 +72,7 @@ const (
 	StateDashboard = 100
 	StateLesson = 101
 	StateSignIn = 102
+	StateConsole = 103
 )
 
 const (
@@ -5,7 +5,9 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/couragetogroww/powerhell/pkg/auth"
+	"github.com/couragetogroww/powerhell/pkg/menus/studio"
 	"github.com/couragetogroww/powerhell/pkg/menus/types"
+	"github.com/couragetogroww/powerhell/pkg/modules"
 	"github.com/couragetogroww/powerhell/pkg/views"
 )
 
@@ -27,9 +29,35 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			m.Dashboard = views.NewDashboardViewWithUser(m.TerminalWidth, m.TerminalHeight, userName)
 		}
-		if m.LessonView != nil && m.CurrentModule != nil {
-			m.LessonView = views.NewLessonView(m.CurrentModule, m.TerminalWidth, m.TerminalHeight)
+		if m.LessonView != nil {
+			m.LessonView.SetSize(m.TerminalWidth, m.TerminalHeight)
 		}
+		if m.Console != nil {
+			m.Console.SetSize(m.TerminalWidth, m.TerminalHeight)
+		}
+
+	case views.DraftTimerMsg:
+		if m.LessonView != nil {
+			m.LessonView.OnDraftTimer(msg)
+		}
+		return m, nil
+
+	case views.RunDoneMsg:
+		if m.LessonView != nil {
+			m.LessonView.OnRunDone(msg)
+		}
+		return m, nil
+
+	case views.ConsoleOutputMsg:
+		if m.Console != nil {
+			m.Console.OnOutput(msg)
+		}
+		return m, nil
+
+	case views.ConsoleExitMsg:
+		// The session is kept, so the console picks up where it was left
+		m.AppState = m.PreviousState
+		return m, nil
 
 	case tickMsg: // Handle animation tick
 		if m.AppState == StateIntro {
@@ -186,6 +214,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						m.SignInView = views.NewSignInView(m.TerminalWidth, m.TerminalHeight)
 						return m, nil
 					}
+				case types.ActionExecute:
+					if result.Data == studio.InteractiveConsole {
+						m.openConsole()
+						return m, nil
+					}
 				case types.ActionExit:
 					m.Quit = true
 					return m, tea.Quit
@@ -206,12 +239,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.ModuleExplorerSidebarCursor++
 				}
 			case "enter":
+				if state := m.MenuManager.GetCurrentState(); state == StateLearnMenu || state == StateStudio {
+					m.chooseMenuOption()
+					return m, nil
+				}
 				selectedModule := m.ModuleExplorerSidebarOptions[m.ModuleExplorerSidebarCursor]
 				switch selectedModule {
 				case "Learn":
-					m.ModuleExplorerSidebarOptions = []string{"On-Premise Learning", "MSGraph Module", "Exchange Module", "HTTP Client (Invoke-WebRequest, Graph API)", "Custom & Popular Modules (EntraExporter)", "PowerShell SDK Learning", "Exit"}
+					// The sidebar shows the learn menu, whose entries say where they lead
+					m.MenuManager.SetCurrentMenu(StateLearnMenu)
+					m.ModuleExplorerSidebarOptions = m.MenuManager.GetMenuOptionsAsStrings()
 					m.ModuleExplorerSidebarCursor = 0
 					m.ModuleExplorerContent = "Select a learning module."
+				case "Studio":
+					m.MenuManager.SetCurrentMenu(StateStudio)
+					m.ModuleExplorerSidebarOptions = m.MenuManager.GetMenuOptionsAsStrings()
+					m.ModuleExplorerSidebarCursor = 0
+					m.ModuleExplorerContent = "Select a practice tool."
 				case "Exit":
 					m.Quit = true
 					return m, tea.Quit
@@ -237,9 +281,13 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "enter":
 				if selectedModule := m.Dashboard.GetSelectedModule(); selectedModule != nil {
 					m.CurrentModule = selectedModule
-					m.LessonView = views.NewLessonView(selectedModule, m.TerminalWidth, m.TerminalHeight)
+					m.LessonView = m.newLessonView(selectedModule)
 					m.AppState = StateLesson
 				}
+			case "c":
+				m.openConsole()
+			case "m":
+				m.openExplorer()
 			default:
 				if !m.ShowHelp {
 					m.Dashboard.Update(msg.String())
@@ -250,21 +298,38 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.LessonView == nil {
 				return m, nil
 			}
+			if m.LessonView.Editing() && msg.String() != "ctrl+c" {
+				// While the learner types, keys go to the editor rather than the shortcuts
+				return m, m.LessonView.Update(msg)
+			}
 			switch msg.String() {
 			case "ctrl+c":
+				m.LessonView.SaveDraft()
 				m.Quit = true
 				return m, tea.Quit
 			case "h":
 				m.ShowHelp = !m.ShowHelp
 			case "q":
 				// Go back to dashboard
+				m.LessonView.SaveDraft()
 				m.AppState = StateDashboard
 			default:
 				if !m.ShowHelp {
-					m.LessonView.Update(msg.String())
+					cmd = m.LessonView.Update(msg)
 				}
 			}
 			
+		case StateConsole:
+			if m.Console == nil {
+				return m, nil
+			}
+			if msg.String() == "ctrl+c" {
+				m.Quit = true
+				return m, tea.Quit
+			}
+			// Every other key is typed into the console
+			return m, m.Console.Update(msg)
+
 		case StateSignIn:
 			if m.SignInView == nil {
 				m.SignInView = views.NewSignInView(m.TerminalWidth, m.TerminalHeight)
@@ -326,4 +391,124 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	return m, cmd
-}
\ No newline at end of file
+}
+
+// openConsole shows the interactive console, starting its session the
+// first time; the signed-in account's commands are kept as its history and
+// leaving it returns to the current view
+func (m *Model) openConsole() {
+	if m.Console == nil {
+		m.Console = views.NewConsoleView(m.TerminalWidth, m.TerminalHeight)
+		if store, account := m.AccountStore, m.CurrentAccount; store != nil && account != nil {
+			m.Console.LoadHistory = func() []string {
+				history, err := store.GetHistory(account.ID, views.ConsoleHistorySize)
+				if err != nil {
+					return nil
+				}
+				return history
+			}
+			m.Console.OnCommand = func(command string) error {
+				return store.AddHistory(account.ID, command, views.ConsoleHistorySize)
+			}
+		}
+	}
+	m.PreviousState = m.AppState
+	m.AppState = StateConsole
+}
+
+// openExplorer shows the module explorer with its top-level entries
+func (m *Model) openExplorer() {
+	m.MenuManager.SetCurrentMenu(StateMainMenu)
+	m.ModuleExplorerSidebarOptions = []string{"Learn", "Studio", "Settings", "Exit"}
+	m.ModuleExplorerSidebarCursor = 0
+	m.ModuleExplorerContent = "Welcome to PowerHell! Select a module from the sidebar."
+	m.AppState = StateModuleExplorer
+}
+
+// chooseMenuOption acts on the entry of the menu the explorer's sidebar shows
+func (m *Model) chooseMenuOption() {
+	label := m.ModuleExplorerSidebarOptions[m.ModuleExplorerSidebarCursor]
+	result := m.MenuManager.HandleSelection(m.ModuleExplorerSidebarCursor)
+	switch result.Action {
+	case types.ActionNavigate:
+		if id, ok := result.Data.(string); ok && m.openModule(id) {
+			return
+		}
+		m.ModuleExplorerContent = fmt.Sprintf("%s has no lessons yet.", label)
+	case types.ActionBack:
+		m.openExplorer()
+	case types.ActionExecute:
+		if result.Data == studio.InteractiveConsole {
+			m.openConsole()
+			return
+		}
+		m.ModuleExplorerContent = result.Message
+	default:
+		m.ModuleExplorerContent = result.Message
+	}
+}
+
+// openModule opens the lessons of the module with the given id, reporting
+// whether there is one
+func (m *Model) openModule(id string) bool {
+	for _, module := range modules.GetAvailableModules() {
+		if module.ID == id {
+			m.CurrentModule = &module
+			m.LessonView = m.newLessonView(m.CurrentModule)
+			m.AppState = StateLesson
+			return true
+		}
+	}
+	return false
+}
+
+// newLessonView opens a module's lessons, saving each lesson the signed-in
+// account passes as completed along with its attempts, hints and drafts
+func (m Model) newLessonView(module *modules.Module) *views.LessonView {
+	lessonView := views.NewLessonView(module, m.TerminalWidth, m.TerminalHeight)
+	if store, account := m.AccountStore, m.CurrentAccount; store != nil && account != nil {
+		lessonView.OnPass = func(moduleID, lessonID string) error {
+			return store.SaveProgress(account.ID, moduleID, lessonID)
+		}
+		lessonView.LoadAttempts = func(moduleID, lessonID string) modules.Attempts {
+			saved, err := store.GetAttempts(account.ID, moduleID, lessonID)
+			if err != nil {
+				return modules.Attempts{}
+			}
+			return modules.Attempts{
+				Submitted:     saved.Attempts,
+				Failed:        saved.FailedAttempts,
+				HintsUsed:     saved.HintsUsed,
+				SolutionShown: saved.SolutionViewed,
+				Passed:        saved.Passed,
+			}
+		}
+		lessonView.LoadDraft = func(moduleID, lessonID string) (string, bool) {
+			draft, err := store.GetDraft(account.ID, moduleID, lessonID)
+			if err != nil || draft == nil {
+				return "", false
+			}
+			return draft.Code, true
+		}
+		lessonView.OnDraft = func(moduleID, lessonID, code string) error {
+			return store.SaveDraft(account.ID, auth.CodeDraft{
+				ModuleID: moduleID,
+				LessonID: lessonID,
+				Code:     code,
+			})
+		}
+		lessonView.OnAttempt = func(moduleID, lessonID string, a modules.Attempts) error {
+			return store.SaveAttempts(account.ID, auth.LessonAttempts{
+				ModuleID:       moduleID,
+				LessonID:       lessonID,
+				Attempts:       a.Submitted,
+				FailedAttempts: a.Failed,
+				HintsUsed:      a.HintsUsed,
+				SolutionViewed: a.SolutionShown,
+				Passed:         a.Passed,
+				Score:          a.Score(),
+			})
+		}
+	}
+	return lessonView
+}
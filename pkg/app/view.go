@@ -85,6 +85,12 @@ func (m Model) View() string {
 		} else {
 			mainView = "Loading lesson..."
 		}
+	case StateConsole:
+		if m.Console != nil {
+			mainView = m.Console.Render()
+		} else {
+			mainView = "Loading console..."
+		}
 	case StateMainMenu, StateLearnMenu, StateStudio, StateSettings:
 		mainView = m.renderModuleExplorer()
 	default:
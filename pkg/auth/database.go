@@ -76,6 +76,43 @@ func (d *Database) createTables() error {
 		UNIQUE(account_id, module_id, lesson_id)
 	);
 
+	CREATE TABLE IF NOT EXISTS account_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL,
+		module_id TEXT NOT NULL,
+		lesson_id TEXT NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		failed_attempts INTEGER DEFAULT 0,
+		hints_used INTEGER DEFAULT 0,
+		solution_viewed BOOLEAN DEFAULT 0,
+		passed BOOLEAN DEFAULT 0,
+		score INTEGER DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (account_id) REFERENCES accounts(id),
+		UNIQUE(account_id, module_id, lesson_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS account_drafts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL,
+		module_id TEXT NOT NULL,
+		lesson_id TEXT NOT NULL,
+		code TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (account_id) REFERENCES accounts(id),
+		UNIQUE(account_id, module_id, lesson_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS account_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id INTEGER NOT NULL,
+		command TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (account_id) REFERENCES accounts(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_history_account ON account_history(account_id);
+
 	CREATE TABLE IF NOT EXISTS account_sessions (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		account_id INTEGER NOT NULL,
@@ -252,6 +289,135 @@ func (d *Database) GetProgress(accountID int) ([]Progress, error) {
 	return progress, nil
 }
 
+// SaveAttempts records an account's attempts, hints and score on a lesson's exercise
+func (d *Database) SaveAttempts(accountID int, a LessonAttempts) error {
+	query := `
+		INSERT OR REPLACE INTO account_attempts
+			(account_id, module_id, lesson_id, attempts, failed_attempts, hints_used, solution_viewed, passed, score, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	_, err := d.db.Exec(query, accountID, a.ModuleID, a.LessonID, a.Attempts, a.FailedAttempts, a.HintsUsed, a.SolutionViewed, a.Passed, a.Score)
+	return err
+}
+
+// GetAttempts retrieves an account's record on a lesson's exercise; it is
+// empty when the account hasn't tried the exercise
+func (d *Database) GetAttempts(accountID int, moduleID, lessonID string) (*LessonAttempts, error) {
+	query := `
+		SELECT attempts, failed_attempts, hints_used, solution_viewed, passed, score, updated_at
+		FROM account_attempts
+		WHERE account_id = ? AND module_id = ? AND lesson_id = ?
+	`
+
+	a := &LessonAttempts{ModuleID: moduleID, LessonID: lessonID}
+	var updatedAt time.Time
+	err := d.db.QueryRow(query, accountID, moduleID, lessonID).Scan(
+		&a.Attempts,
+		&a.FailedAttempts,
+		&a.HintsUsed,
+		&a.SolutionViewed,
+		&a.Passed,
+		&a.Score,
+		&updatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return a, nil
+}
+
+// SaveDraft stores the code an account is writing for a lesson's exercise,
+// replacing the earlier draft
+func (d *Database) SaveDraft(accountID int, draft CodeDraft) error {
+	query := `
+		INSERT OR REPLACE INTO account_drafts (account_id, module_id, lesson_id, code, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+
+	_, err := d.db.Exec(query, accountID, draft.ModuleID, draft.LessonID, draft.Code)
+	return err
+}
+
+// GetDraft retrieves an account's draft for a lesson's exercise; it is nil
+// when the account hasn't written any code for it
+func (d *Database) GetDraft(accountID int, moduleID, lessonID string) (*CodeDraft, error) {
+	query := `
+		SELECT code, updated_at
+		FROM account_drafts
+		WHERE account_id = ? AND module_id = ? AND lesson_id = ?
+	`
+
+	draft := &CodeDraft{ModuleID: moduleID, LessonID: lessonID}
+	var updatedAt time.Time
+	err := d.db.QueryRow(query, accountID, moduleID, lessonID).Scan(&draft.Code, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	draft.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return draft, nil
+}
+
+// AddHistory records a command an account ran in the console, keeping
+// only the account's newest commands, as many as keep
+func (d *Database) AddHistory(accountID int, command string, keep int) error {
+	query := `INSERT INTO account_history (account_id, command) VALUES (?, ?)`
+
+	if _, err := d.db.Exec(query, accountID, command); err != nil {
+		return err
+	}
+
+	prune := `
+		DELETE FROM account_history
+		WHERE account_id = ? AND id <= (
+			SELECT id FROM account_history
+			WHERE account_id = ?
+			ORDER BY id DESC
+			LIMIT 1 OFFSET ?
+		)
+	`
+	_, err := d.db.Exec(prune, accountID, accountID, keep)
+	return err
+}
+
+// GetHistory retrieves the last commands an account ran in the console,
+// oldest first
+func (d *Database) GetHistory(accountID int, limit int) ([]string, error) {
+	query := `
+		SELECT command FROM (
+			SELECT id, command FROM account_history
+			WHERE account_id = ?
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id
+	`
+
+	rows, err := d.db.Query(query, accountID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []string
+	for rows.Next() {
+		var command string
+		if err := rows.Scan(&command); err != nil {
+			return nil, err
+		}
+		history = append(history, command)
+	}
+	return history, rows.Err()
+}
+
 // StartSession starts a new learning session
 func (d *Database) StartSession(accountID int) (int64, error) {
 	query := `INSERT INTO account_sessions (account_id) VALUES (?)`
@@ -295,6 +461,13 @@ func (d *Database) GetStats(accountID int) (*AccountStats, error) {
 		return nil, err
 	}
 
+	// Get total score
+	query = `SELECT COALESCE(SUM(score), 0) FROM account_attempts WHERE account_id = ?`
+	err = d.db.QueryRow(query, accountID).Scan(&stats.TotalScore)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get achievement count
 	query = `SELECT COUNT(*) FROM account_achievements WHERE account_id = ?`
 	err = d.db.QueryRow(query, accountID).Scan(&stats.AchievementCount)
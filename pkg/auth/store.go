@@ -128,6 +128,55 @@ func (s *Store) GetProgress(accountID int) ([]Progress, error) {
 	return s.db.GetProgress(accountID)
 }
 
+// SaveAttempts records attempts, hints and score on a lesson's exercise
+func (s *Store) SaveAttempts(accountID int, attempts LessonAttempts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.SaveAttempts(accountID, attempts)
+}
+
+// GetAttempts retrieves the record on a lesson's exercise
+func (s *Store) GetAttempts(accountID int, moduleID, lessonID string) (*LessonAttempts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.GetAttempts(accountID, moduleID, lessonID)
+}
+
+// SaveDraft stores the code being written for a lesson's exercise
+func (s *Store) SaveDraft(accountID int, draft CodeDraft) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.SaveDraft(accountID, draft)
+}
+
+// GetDraft retrieves the code last written for a lesson's exercise
+func (s *Store) GetDraft(accountID int, moduleID, lessonID string) (*CodeDraft, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.GetDraft(accountID, moduleID, lessonID)
+}
+
+// AddHistory records a command run in the console, keeping the newest
+// commands, as many as keep
+func (s *Store) AddHistory(accountID int, command string, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.AddHistory(accountID, command, keep)
+}
+
+// GetHistory retrieves the last commands run in the console, oldest first
+func (s *Store) GetHistory(accountID int, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.GetHistory(accountID, limit)
+}
+
 // StartSession starts a new learning session
 func (s *Store) StartSession(accountID int) (int64, error) {
 	s.mu.Lock()
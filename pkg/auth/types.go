@@ -35,6 +35,28 @@ type AccountStats struct {
 	TotalTimeSeconds      int `json:"total_time_seconds"`
 	AchievementCount      int `json:"achievement_count"`
 	CurrentStreak         int `json:"current_streak"`
+	TotalScore            int `json:"total_score"`
+}
+
+// LessonAttempts records how an account worked through a lesson's exercise
+type LessonAttempts struct {
+	ModuleID       string `json:"module_id"`
+	LessonID       string `json:"lesson_id"`
+	Attempts       int    `json:"attempts"`
+	FailedAttempts int    `json:"failed_attempts"`
+	HintsUsed      int    `json:"hints_used"`
+	SolutionViewed bool   `json:"solution_viewed"`
+	Passed         bool   `json:"passed"`
+	Score          int    `json:"score"`
+	UpdatedAt      string `json:"updated_at,omitempty"`
+}
+
+// CodeDraft is the code an account was writing for a lesson's exercise
+type CodeDraft struct {
+	ModuleID  string `json:"module_id"`
+	LessonID  string `json:"lesson_id"`
+	Code      string `json:"code"`
+	UpdatedAt string `json:"updated_at,omitempty"`
 }
 
 // Session represents a learning session
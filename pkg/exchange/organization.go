@@ -0,0 +1,506 @@
+// Package exchange simulates an Exchange Online organization: mailboxes,
+// distribution groups, mailbox and recipient permissions, and transport
+// rules. Recipients filter with the same OPATH syntax the onprem package
+// parses for the AD cmdlets.
+package exchange
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/onprem"
+)
+
+// Recipient type details
+const (
+	UserMailbox      = "UserMailbox"
+	SharedMailbox    = "SharedMailbox"
+	RoomMailbox      = "RoomMailbox"
+	EquipmentMailbox = "EquipmentMailbox"
+	DistributionList = "MailUniversalDistributionGroup"
+	MailSecurity     = "MailUniversalSecurityGroup"
+)
+
+// fixtureTime is when seeded objects were created, so listings are reproducible
+var fixtureTime = time.Date(2023, time.September, 12, 8, 0, 0, 0, time.UTC)
+
+// serverName is the domain controller named in "couldn't be found" errors
+const serverName = "NAMPR01A001DC01.NAMPR01A001.PROD.OUTLOOK.COM"
+
+// Organization is one Exchange Online tenant
+type Organization struct {
+	Domain string // default accepted domain, e.g. contoso.onmicrosoft.com
+
+	recipients []*Recipient
+	mailboxACL []*Permission
+	sendAs     []*Permission
+	rules      []*TransportRule
+	guidSeq    int
+	clock      func() time.Time
+}
+
+// Recipient is a mailbox or a distribution group
+type Recipient struct {
+	Guid string
+
+	attrs   map[string]interface{} // keyed by canonical property name
+	members []string               // member guids, for groups
+}
+
+// NewOrganization creates an organization with no recipients
+func NewOrganization(domain string) *Organization {
+	return &Organization{Domain: strings.ToLower(domain), clock: time.Now}
+}
+
+// hash seeds deterministic values from the domain and a sequence number
+func (org *Organization) hash(seq int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d", org.Domain, seq)
+	return int64(h.Sum64())
+}
+
+func (org *Organization) newGUID() string {
+	org.guidSeq++
+	b := make([]byte, 16)
+	rand.New(rand.NewSource(org.hash(org.guidSeq))).Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// SetClock overrides the time source used for WhenCreated and WhenChanged
+func (org *Organization) SetClock(clock func() time.Time) {
+	org.clock = clock
+}
+
+// Clone returns an independent copy, so each session can change its own organization
+func (org *Organization) Clone() *Organization {
+	c := *org
+	c.recipients = make([]*Recipient, len(org.recipients))
+	for i, r := range org.recipients {
+		cp := &Recipient{Guid: r.Guid, attrs: make(map[string]interface{}, len(r.attrs)), members: append([]string(nil), r.members...)}
+		for k, v := range r.attrs {
+			if list, ok := v.([]string); ok {
+				v = append([]string(nil), list...)
+			}
+			cp.attrs[k] = v
+		}
+		c.recipients[i] = cp
+	}
+	c.mailboxACL = clonePermissions(org.mailboxACL)
+	c.sendAs = clonePermissions(org.sendAs)
+	c.rules = make([]*TransportRule, len(org.rules))
+	for i, r := range org.rules {
+		c.rules[i] = r.clone()
+	}
+	return &c
+}
+
+// NotFoundError is returned when an identity matches no object
+type NotFoundError struct {
+	Identity string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("The operation couldn't be performed because object '%s' couldn't be found on '%s'.", e.Identity, serverName)
+}
+
+// Get returns a property by name, matched case-insensitively
+func (r *Recipient) Get(name string) (interface{}, bool) {
+	if strings.EqualFold(name, "Guid") {
+		return r.Guid, true
+	}
+	for k, v := range r.attrs {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// String returns the recipient's name, which is also its Identity
+func (r *Recipient) String() string {
+	return r.Name()
+}
+
+// Name returns the recipient's Name
+func (r *Recipient) Name() string {
+	s, _ := r.attrs["Name"].(string)
+	return s
+}
+
+// Type returns the recipient's RecipientTypeDetails
+func (r *Recipient) Type() string {
+	s, _ := r.attrs["RecipientTypeDetails"].(string)
+	return s
+}
+
+// IsGroup reports whether the recipient is a distribution or mail-enabled security group
+func (r *Recipient) IsGroup() bool {
+	t := r.Type()
+	return t == DistributionList || t == MailSecurity
+}
+
+// PrimarySmtpAddress returns the recipient's primary email address
+func (r *Recipient) PrimarySmtpAddress() string {
+	s, _ := r.attrs["PrimarySmtpAddress"].(string)
+	return s
+}
+
+// Recipients returns every recipient in creation order
+func (org *Organization) Recipients() []*Recipient {
+	return append([]*Recipient(nil), org.recipients...)
+}
+
+// Resolve finds a recipient by Name, Alias, DisplayName, any email
+// address, UserPrincipalName or Guid
+func (org *Organization) Resolve(identity string) (*Recipient, error) {
+	id := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(identity)), "smtp:")
+	for _, r := range org.recipients {
+		if strings.EqualFold(r.Guid, id) {
+			return r, nil
+		}
+		for _, key := range []string{"Name", "Alias", "DisplayName", "UserPrincipalName"} {
+			if s, _ := r.attrs[key].(string); s != "" && strings.EqualFold(s, id) {
+				return r, nil
+			}
+		}
+		addrs, _ := r.attrs["EmailAddresses"].([]string)
+		for _, a := range addrs {
+			if strings.EqualFold(a[strings.Index(a, ":")+1:], id) {
+				return r, nil
+			}
+		}
+	}
+	return nil, &NotFoundError{Identity: identity}
+}
+
+// Query returns recipients of the given types that match filter; an empty
+// types list or nil filter matches everything
+func (org *Organization) Query(types []string, filter *onprem.Filter) []*Recipient {
+	var out []*Recipient
+	for _, r := range org.recipients {
+		if len(types) > 0 && !containsFold(types, r.Type()) {
+			continue
+		}
+		if filter != nil && !filter.Match(r) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// ParseFilter parses an OPATH -Filter over recipient properties
+func ParseFilter(text string, resolve onprem.Resolver) (*onprem.Filter, error) {
+	return onprem.ParseFilterFor(text, resolve, filterableProperty)
+}
+
+// filterableProperty canonicalizes a property name an OPATH filter may use
+func filterableProperty(name string) (string, bool) {
+	for _, list := range [][]string{MailboxProperties, GroupProperties} {
+		for _, p := range list {
+			if strings.EqualFold(p, name) {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// MailboxProperties are the properties of a mailbox, in display order
+var MailboxProperties = []string{
+	"Name", "Alias", "DisplayName", "PrimarySmtpAddress", "UserPrincipalName",
+	"RecipientType", "RecipientTypeDetails", "EmailAddresses", "Office",
+	"Database", "HiddenFromAddressListsEnabled", "ForwardingSmtpAddress",
+	"DeliverToMailboxAndForward", "GrantSendOnBehalfTo", "IssueWarningQuota",
+	"ProhibitSendQuota", "ProhibitSendReceiveQuota", "MaxSendSize", "MaxReceiveSize",
+	"LitigationHoldEnabled", "AuditEnabled", "ArchiveStatus",
+	"ExternalDirectoryObjectId", "Identity", "Guid", "WhenCreated", "WhenChanged",
+}
+
+// GroupProperties are the properties of a distribution group, in display order
+var GroupProperties = []string{
+	"Name", "Alias", "DisplayName", "PrimarySmtpAddress", "RecipientType",
+	"RecipientTypeDetails", "EmailAddresses", "GroupType", "ManagedBy",
+	"MemberJoinRestriction", "MemberDepartRestriction",
+	"RequireSenderAuthenticationEnabled", "HiddenFromAddressListsEnabled",
+	"Identity", "Guid", "WhenCreated", "WhenChanged",
+}
+
+// Properties returns the property names of a recipient in display order
+func (r *Recipient) Properties() []string {
+	if r.IsGroup() {
+		return GroupProperties
+	}
+	return MailboxProperties
+}
+
+// Set changes a property and stamps WhenChanged
+func (org *Organization) Set(r *Recipient, name string, value interface{}) error {
+	canonical := ""
+	for _, p := range r.Properties() {
+		if strings.EqualFold(p, name) {
+			canonical = p
+		}
+	}
+	switch canonical {
+	case "", "Identity", "Guid", "RecipientType", "WhenCreated", "WhenChanged", "ExternalDirectoryObjectId", "Database":
+		return fmt.Errorf("A parameter cannot be found that matches parameter name '%s'.", name)
+	case "Name":
+		if other, err := org.Resolve(toString(value)); err == nil && other != r {
+			return fmt.Errorf("The name \"%s\" is being used by another recipient object. Please specify a unique name.", value)
+		}
+		r.attrs["Identity"] = value
+	case "Alias":
+		if other, err := org.Resolve(toString(value)); err == nil && other != r {
+			return fmt.Errorf("The alias \"%s\" is being used by another recipient object. Please specify a unique alias.", value)
+		}
+	case "PrimarySmtpAddress":
+		addr := toString(value)
+		if other, err := org.Resolve(addr); err == nil && other != r {
+			return fmt.Errorf("The proxy address \"SMTP:%s\" is already being used by the proxy addresses or LegacyExchangeDN of \"%s\". Please choose another proxy address.", addr, other.Name())
+		}
+		var addrs []string
+		for _, a := range r.attrs["EmailAddresses"].([]string) {
+			if strings.HasPrefix(a, "SMTP:") {
+				a = "smtp:" + a[5:]
+			}
+			if !strings.EqualFold(a[5:], addr) {
+				addrs = append(addrs, a)
+			}
+		}
+		r.attrs["EmailAddresses"] = append([]string{"SMTP:" + addr}, addrs...)
+	case "EmailAddresses":
+		primary := ""
+		for _, a := range value.([]string) {
+			addr := a[strings.Index(a, ":")+1:]
+			if other, err := org.Resolve(addr); err == nil && other != r {
+				return fmt.Errorf("The proxy address \"%s\" is already being used by the proxy addresses or LegacyExchangeDN of \"%s\". Please choose another proxy address.", a, other.Name())
+			}
+			if strings.HasPrefix(a, "SMTP:") {
+				primary = addr
+			}
+		}
+		if primary == "" {
+			return fmt.Errorf("The primary SMTP address must be specified when you're modifying the proxy addresses.")
+		}
+		r.attrs["PrimarySmtpAddress"] = primary
+	case "RecipientTypeDetails":
+		t := toString(value)
+		if r.IsGroup() || t != UserMailbox && t != SharedMailbox && t != RoomMailbox && t != EquipmentMailbox {
+			return fmt.Errorf("Cannot convert value \"%s\" to type \"Microsoft.Exchange.Data.Directory.Recipient.ConvertibleMailboxSubType\".", value)
+		}
+		quota := mailboxQuotas[t]
+		r.attrs["IssueWarningQuota"], r.attrs["ProhibitSendQuota"], r.attrs["ProhibitSendReceiveQuota"] = quota[0], quota[1], quota[2]
+	}
+	r.attrs[canonical] = value
+	r.attrs["WhenChanged"] = org.clock()
+	return nil
+}
+
+// mailboxQuotas are the default warning, send and send/receive quotas per mailbox type
+var mailboxQuotas = map[string][3]string{
+	UserMailbox:      {"98 GB (105,226,698,752 bytes)", "99 GB (106,300,440,576 bytes)", "100 GB (107,374,182,400 bytes)"},
+	SharedMailbox:    {"49 GB (52,613,349,376 bytes)", "49.5 GB (53,150,220,288 bytes)", "50 GB (53,687,091,200 bytes)"},
+	RoomMailbox:      {"49 GB (52,613,349,376 bytes)", "49.5 GB (53,150,220,288 bytes)", "50 GB (53,687,091,200 bytes)"},
+	EquipmentMailbox: {"49 GB (52,613,349,376 bytes)", "49.5 GB (53,150,220,288 bytes)", "50 GB (53,687,091,200 bytes)"},
+}
+
+// NewMailbox creates a mailbox of the given type; alias and address
+// default from the name
+func (org *Organization) NewMailbox(kind, name, alias, address, upn string) (*Recipient, error) {
+	if alias == "" {
+		alias = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\'' {
+				return -1
+			}
+			return r
+		}, name)
+	}
+	if address == "" {
+		address = alias + "@" + org.Domain
+	}
+	if upn == "" && kind != UserMailbox {
+		upn = address
+	}
+	if err := org.checkUnique(name, alias, address); err != nil {
+		return nil, err
+	}
+	quota := mailboxQuotas[kind]
+	now := org.clock()
+	r := &Recipient{Guid: org.newGUID(), attrs: map[string]interface{}{
+		"Name":                          name,
+		"Alias":                         alias,
+		"DisplayName":                   name,
+		"PrimarySmtpAddress":            address,
+		"UserPrincipalName":             upn,
+		"RecipientType":                 UserMailbox,
+		"RecipientTypeDetails":          kind,
+		"EmailAddresses":                []string{"SMTP:" + address},
+		"Office":                        "",
+		"Database":                      fmt.Sprintf("NAMPR01DG%03d-db%03d", org.guidSeq%200, org.guidSeq%90+10),
+		"HiddenFromAddressListsEnabled": false,
+		"ForwardingSmtpAddress":         nil,
+		"DeliverToMailboxAndForward":    false,
+		"GrantSendOnBehalfTo":           []string{},
+		"IssueWarningQuota":             quota[0],
+		"ProhibitSendQuota":             quota[1],
+		"ProhibitSendReceiveQuota":      quota[2],
+		"MaxSendSize":                   "35 MB (36,700,160 bytes)",
+		"MaxReceiveSize":                "36 MB (37,748,736 bytes)",
+		"LitigationHoldEnabled":         false,
+		"AuditEnabled":                  true,
+		"ArchiveStatus":                 "None",
+		"Identity":                      name,
+		"WhenCreated":                   now,
+		"WhenChanged":                   now,
+	}}
+	r.attrs["ExternalDirectoryObjectId"] = org.newGUID()
+	org.recipients = append(org.recipients, r)
+	org.mailboxACL = append(org.mailboxACL, &Permission{Mailbox: r.Guid, User: SelfPrincipal, AccessRights: []string{"FullAccess", "ReadPermission"}, InheritanceType: "All"})
+	org.sendAs = append(org.sendAs, &Permission{Mailbox: r.Guid, User: SelfPrincipal, AccessRights: []string{"SendAs"}, InheritanceType: "None"})
+	return r, nil
+}
+
+// NewGroup creates a distribution group, or a mail-enabled security group when security is set
+func (org *Organization) NewGroup(name, alias, address string, security bool, managedBy []string) (*Recipient, error) {
+	if alias == "" {
+		alias = strings.ReplaceAll(name, " ", "")
+	}
+	if address == "" {
+		address = alias + "@" + org.Domain
+	}
+	if err := org.checkUnique(name, alias, address); err != nil {
+		return nil, err
+	}
+	kind, groupType := DistributionList, "Universal"
+	if security {
+		kind, groupType = MailSecurity, "Universal, SecurityEnabled"
+	}
+	now := org.clock()
+	r := &Recipient{Guid: org.newGUID(), attrs: map[string]interface{}{
+		"Name":                               name,
+		"Alias":                              alias,
+		"DisplayName":                        name,
+		"PrimarySmtpAddress":                 address,
+		"RecipientType":                      kind,
+		"RecipientTypeDetails":               kind,
+		"EmailAddresses":                     []string{"SMTP:" + address},
+		"GroupType":                          groupType,
+		"ManagedBy":                          append([]string{}, managedBy...),
+		"MemberJoinRestriction":              "Closed",
+		"MemberDepartRestriction":            "Closed",
+		"RequireSenderAuthenticationEnabled": true,
+		"HiddenFromAddressListsEnabled":      false,
+		"Identity":                           name,
+		"WhenCreated":                        now,
+		"WhenChanged":                        now,
+	}}
+	org.recipients = append(org.recipients, r)
+	return r, nil
+}
+
+func (org *Organization) checkUnique(name, alias, address string) error {
+	if _, err := org.Resolve(name); err == nil {
+		return fmt.Errorf("The name \"%s\" is being used by another recipient object. Please specify a unique name.", name)
+	}
+	if r, err := org.Resolve(alias); err == nil && strings.EqualFold(toString(r.attrs["Alias"]), alias) {
+		return fmt.Errorf("The alias \"%s\" is being used by another recipient object. Please specify a unique alias.", alias)
+	}
+	if r, err := org.Resolve(address); err == nil {
+		return fmt.Errorf("The proxy address \"SMTP:%s\" is already being used by the proxy addresses or LegacyExchangeDN of \"%s\". Please choose another proxy address.", address, r.Name())
+	}
+	return nil
+}
+
+// Remove deletes a recipient along with its permissions and memberships
+func (org *Organization) Remove(r *Recipient) {
+	for i, x := range org.recipients {
+		if x == r {
+			org.recipients = append(org.recipients[:i:i], org.recipients[i+1:]...)
+			break
+		}
+	}
+	for _, g := range org.recipients {
+		for i, m := range g.members {
+			if m == r.Guid {
+				g.members = append(g.members[:i:i], g.members[i+1:]...)
+				break
+			}
+		}
+	}
+	keep := func(perms []*Permission) []*Permission {
+		var out []*Permission
+		for _, p := range perms {
+			if p.Mailbox != r.Guid && !strings.EqualFold(p.User, r.PrincipalName()) {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	org.mailboxACL = keep(org.mailboxACL)
+	org.sendAs = keep(org.sendAs)
+}
+
+// Members returns the direct members of a group
+func (org *Organization) Members(g *Recipient) []*Recipient {
+	var out []*Recipient
+	for _, guid := range g.members {
+		for _, r := range org.recipients {
+			if r.Guid == guid {
+				out = append(out, r)
+			}
+		}
+	}
+	return out
+}
+
+// AddMember adds a recipient to a group
+func (org *Organization) AddMember(g, member *Recipient) error {
+	if !g.IsGroup() {
+		return &NotFoundError{Identity: g.Name()}
+	}
+	for _, guid := range g.members {
+		if guid == member.Guid {
+			return fmt.Errorf("The recipient \"%s\" is already a member of the group \"%s\".", member.Name(), g.Name())
+		}
+	}
+	if member == g {
+		return fmt.Errorf("The group \"%s\" can't be a member of itself.", g.Name())
+	}
+	g.members = append(g.members, member.Guid)
+	g.attrs["WhenChanged"] = org.clock()
+	return nil
+}
+
+// RemoveMember removes a recipient from a group
+func (org *Organization) RemoveMember(g, member *Recipient) error {
+	for i, guid := range g.members {
+		if guid == member.Guid {
+			g.members = append(g.members[:i:i], g.members[i+1:]...)
+			g.attrs["WhenChanged"] = org.clock()
+			return nil
+		}
+	}
+	return fmt.Errorf("The recipient \"%s\" isn't a member of the group \"%s\".", member.Name(), g.Name())
+}
+
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
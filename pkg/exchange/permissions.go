@@ -0,0 +1,195 @@
+package exchange
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SelfPrincipal is the trustee every mailbox grants access to itself
+const SelfPrincipal = `NT AUTHORITY\SELF`
+
+// MailboxRights are the access rights Add-MailboxPermission accepts
+var MailboxRights = []string{"ChangeOwner", "ChangePermission", "DeleteItem", "ExternalAccount", "FullAccess", "ReadPermission"}
+
+// Permission is an access control entry on a mailbox: a mailbox
+// permission such as FullAccess, or a SendAs recipient permission
+type Permission struct {
+	Mailbox         string // guid of the mailbox the entry is on
+	User            string // trustee: a principal name or SelfPrincipal
+	AccessRights    []string
+	IsInherited     bool
+	Deny            bool
+	InheritanceType string
+}
+
+func clonePermissions(perms []*Permission) []*Permission {
+	out := make([]*Permission, len(perms))
+	for i, p := range perms {
+		cp := *p
+		cp.AccessRights = append([]string(nil), p.AccessRights...)
+		out[i] = &cp
+	}
+	return out
+}
+
+// PrincipalName is how a recipient appears as a trustee: its user
+// principal name, or its name for groups
+func (r *Recipient) PrincipalName() string {
+	if upn, _ := r.attrs["UserPrincipalName"].(string); upn != "" {
+		return upn
+	}
+	return r.Name()
+}
+
+// RecipientByGuid returns the recipient with the given guid, or nil
+func (org *Organization) RecipientByGuid(guid string) *Recipient {
+	for _, r := range org.recipients {
+		if r.Guid == guid {
+			return r
+		}
+	}
+	return nil
+}
+
+// MailboxPermissions returns the mailbox permission entries on a mailbox
+func (org *Organization) MailboxPermissions(mbx *Recipient) []*Permission {
+	return permissionsOn(org.mailboxACL, mbx)
+}
+
+// RecipientPermissions returns the SendAs entries on a mailbox
+func (org *Organization) RecipientPermissions(mbx *Recipient) []*Permission {
+	return permissionsOn(org.sendAs, mbx)
+}
+
+func permissionsOn(perms []*Permission, mbx *Recipient) []*Permission {
+	var out []*Permission
+	for _, p := range perms {
+		if p.Mailbox == mbx.Guid {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// trustee checks that a recipient can be granted permissions: a mailbox
+// user or a mail-enabled security group
+func trustee(user *Recipient) (string, error) {
+	if user.Type() == DistributionList {
+		return "", fmt.Errorf("The user \"%s\" is either not a valid security principal or doesn't have a valid mailbox.", user.Name())
+	}
+	return user.PrincipalName(), nil
+}
+
+// AddMailboxPermission grants access rights on a mailbox. existed reports
+// that the user already held every right requested, which the cmdlet
+// surfaces as a warning.
+func (org *Organization) AddMailboxPermission(mbx, user *Recipient, rights []string) (p *Permission, existed bool, err error) {
+	if mbx.IsGroup() {
+		return nil, false, &NotFoundError{Identity: mbx.Name()}
+	}
+	name, err := trustee(user)
+	if err != nil {
+		return nil, false, err
+	}
+	canonical, err := canonicalRights(rights, MailboxRights, "Microsoft.Exchange.Management.RecipientTasks.MailboxRights")
+	if err != nil {
+		return nil, false, err
+	}
+	for _, existing := range org.mailboxACL {
+		if existing.Mailbox == mbx.Guid && strings.EqualFold(existing.User, name) && !existing.Deny {
+			existed = true
+			for _, r := range canonical {
+				if !containsFold(existing.AccessRights, r) {
+					existing.AccessRights = append(existing.AccessRights, r)
+					existed = false
+				}
+			}
+			return existing, existed, nil
+		}
+	}
+	p = &Permission{Mailbox: mbx.Guid, User: name, AccessRights: canonical, InheritanceType: "All"}
+	org.mailboxACL = append(org.mailboxACL, p)
+	return p, false, nil
+}
+
+// RemoveMailboxPermission revokes access rights; the entry goes once it has none left
+func (org *Organization) RemoveMailboxPermission(mbx, user *Recipient, rights []string) error {
+	canonical, err := canonicalRights(rights, MailboxRights, "Microsoft.Exchange.Management.RecipientTasks.MailboxRights")
+	if err != nil {
+		return err
+	}
+	name := user.PrincipalName()
+	for i, p := range org.mailboxACL {
+		if p.Mailbox != mbx.Guid || !strings.EqualFold(p.User, name) {
+			continue
+		}
+		var left []string
+		for _, r := range p.AccessRights {
+			if !containsFold(canonical, r) {
+				left = append(left, r)
+			}
+		}
+		if len(left) == len(p.AccessRights) {
+			break
+		}
+		if len(left) == 0 {
+			org.mailboxACL = append(org.mailboxACL[:i:i], org.mailboxACL[i+1:]...)
+		} else {
+			p.AccessRights = left
+		}
+		return nil
+	}
+	return fmt.Errorf("Can't remove the access control entry on the object \"%s\" for the user \"%s\" because the ACE doesn't exist on the object.", mbx.Name(), name)
+}
+
+// AddRecipientPermission grants SendAs on a mailbox
+func (org *Organization) AddRecipientPermission(mbx, user *Recipient) (*Permission, error) {
+	if mbx.IsGroup() {
+		return nil, &NotFoundError{Identity: mbx.Name()}
+	}
+	name, err := trustee(user)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range org.sendAs {
+		if p.Mailbox == mbx.Guid && strings.EqualFold(p.User, name) {
+			return nil, fmt.Errorf("The ACE for trustee \"%s\" with SendAs rights already exists on \"%s\".", name, mbx.Name())
+		}
+	}
+	p := &Permission{Mailbox: mbx.Guid, User: name, AccessRights: []string{"SendAs"}, InheritanceType: "None"}
+	org.sendAs = append(org.sendAs, p)
+	return p, nil
+}
+
+// RemoveRecipientPermission revokes SendAs on a mailbox
+func (org *Organization) RemoveRecipientPermission(mbx, user *Recipient) error {
+	name := user.PrincipalName()
+	for i, p := range org.sendAs {
+		if p.Mailbox == mbx.Guid && strings.EqualFold(p.User, name) {
+			org.sendAs = append(org.sendAs[:i:i], org.sendAs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("Can't remove the access control entry on the object \"%s\" for the user \"%s\" because the ACE doesn't exist on the object.", mbx.Name(), name)
+}
+
+// canonicalRights validates rights against an enumeration and returns
+// them with the enumeration's spelling
+func canonicalRights(rights, valid []string, enum string) ([]string, error) {
+	var out []string
+	for _, r := range rights {
+		found := ""
+		for _, v := range valid {
+			if strings.EqualFold(v, strings.TrimSpace(r)) {
+				found = v
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("Cannot convert value \"%s\" to type \"%s\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again:\n%s\"", r, enum, r, strings.Join(valid, ", "))
+		}
+		if !containsFold(out, found) {
+			out = append(out, found)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,389 @@
+package exchange
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Predicate is one condition, exception or action of a transport rule,
+// named after the New-TransportRule parameter that sets it
+type Predicate struct {
+	Name  string
+	Value interface{} // string, []string, bool or int
+}
+
+// TransportRule is a mail flow rule
+type TransportRule struct {
+	Name        string
+	Guid        string
+	Priority    int
+	State       string // Enabled or Disabled
+	Mode        string // Enforce, Audit or AuditAndNotify
+	Comments    string
+	Conditions  []Predicate
+	Exceptions  []Predicate
+	Actions     []Predicate
+	WhenChanged time.Time
+}
+
+func (r *TransportRule) clone() *TransportRule {
+	cp := *r
+	cp.Conditions = append([]Predicate(nil), r.Conditions...)
+	cp.Exceptions = append([]Predicate(nil), r.Exceptions...)
+	cp.Actions = append([]Predicate(nil), r.Actions...)
+	return &cp
+}
+
+// predicateText describes each supported predicate the way Get-TransportRule's
+// Description does; %s is the value
+var predicateText = map[string]string{
+	// conditions, also usable as exceptions with an ExceptIf prefix
+	"From":                            "Is received from '%s'",
+	"FromScope":                       "Is sent from '%s'",
+	"FromMemberOf":                    "Is received from a member of group '%s'",
+	"SentTo":                          "Is sent to '%s'",
+	"SentToScope":                     "Is sent to '%s'",
+	"SentToMemberOf":                  "Is sent to a member of group '%s'",
+	"SubjectContainsWords":            "Includes these words in the message subject: '%s'",
+	"SubjectOrBodyContainsWords":      "Includes these words in the message subject or body: '%s'",
+	"SenderDomainIs":                  "Sender's address domain portion belongs to any of these domains: '%s'",
+	"RecipientDomainIs":               "Recipient's address domain portion belongs to any of these domains: '%s'",
+	"HasAttachment":                   "Has an attachment",
+	"AttachmentExtensionMatchesWords": "Has an attachment with file extension matching: '%s'",
+	"AttachmentSizeOver":              "Includes an attachment with size greater than '%s'",
+	"MessageSizeOver":                 "Size is greater than or equal to '%s'",
+	"HeaderContainsMessageHeader":     "'%s' header contains the words in HeaderContainsWords",
+	"HeaderContainsWords":             "The message header includes these words: '%s'",
+
+	// actions
+	"PrependSubject":           "Prepend the subject with '%s'",
+	"ApplyHtmlDisclaimerText":  "Apply the disclaimer '%s'",
+	"RejectMessageReasonText":  "Reject the message and include the explanation '%s'",
+	"DeleteMessage":            "Delete the message without notifying the recipient or sender",
+	"BlindCopyTo":              "Blind carbon copy (Bcc) the message to '%s'",
+	"AddToRecipients":          "Add recipients to the To box: '%s'",
+	"CopyTo":                   "Add recipients to the Cc box: '%s'",
+	"RedirectMessageTo":        "Redirect the message to '%s'",
+	"ModerateMessageByUser":    "Forward the message for approval to '%s'",
+	"ModerateMessageByManager": "Forward the message for approval to the sender's manager",
+	"SetSCL":                   "Set the spam confidence level (SCL) to '%s'",
+	"SetHeaderName":            "Set the message header '%s'",
+	"SetHeaderValue":           "Set the message header value to '%s'",
+	"StopRuleProcessing":       "Stop processing more rules",
+	"Quarantine":               "Deliver the message to the hosted quarantine",
+}
+
+// ConditionNames and ActionNames are the predicates New-TransportRule
+// accepts; every condition is also an exception with an ExceptIf prefix
+var (
+	ConditionNames = []string{
+		"From", "FromScope", "FromMemberOf", "SentTo", "SentToScope", "SentToMemberOf",
+		"SubjectContainsWords", "SubjectOrBodyContainsWords", "SenderDomainIs",
+		"RecipientDomainIs", "HasAttachment", "AttachmentExtensionMatchesWords",
+		"AttachmentSizeOver", "MessageSizeOver", "HeaderContainsMessageHeader", "HeaderContainsWords",
+	}
+	ActionNames = []string{
+		"PrependSubject", "ApplyHtmlDisclaimerText", "RejectMessageReasonText", "DeleteMessage",
+		"BlindCopyTo", "AddToRecipients", "CopyTo", "RedirectMessageTo", "ModerateMessageByUser",
+		"ModerateMessageByManager", "SetSCL", "SetHeaderName", "SetHeaderValue",
+		"StopRuleProcessing", "Quarantine",
+	}
+)
+
+// flagPredicates take $true rather than a value
+var flagPredicates = map[string]bool{
+	"HasAttachment": true, "DeleteMessage": true, "ModerateMessageByManager": true,
+	"StopRuleProcessing": true, "Quarantine": true,
+}
+
+// singlePredicates take one value; the rest take a list
+var singlePredicates = map[string]bool{
+	"FromScope": true, "SentToScope": true, "AttachmentSizeOver": true, "MessageSizeOver": true,
+	"HeaderContainsMessageHeader": true, "PrependSubject": true, "ApplyHtmlDisclaimerText": true,
+	"RejectMessageReasonText": true, "SetSCL": true, "SetHeaderName": true, "SetHeaderValue": true,
+}
+
+// recipientPredicates name recipients, which are resolved and stored as
+// their primary SMTP addresses; the MemberOf ones must name groups
+var recipientPredicates = map[string]bool{
+	"From": true, "SentTo": true, "FromMemberOf": true, "SentToMemberOf": true,
+	"BlindCopyTo": true, "AddToRecipients": true, "CopyTo": true, "RedirectMessageTo": true,
+	"ModerateMessageByUser": true,
+}
+
+// IsFlagPredicate reports whether a predicate is set with $true
+func IsFlagPredicate(name string) bool {
+	_, canonical := predicateKind(name)
+	return flagPredicates[strings.TrimPrefix(canonical, "ExceptIf")]
+}
+
+// IsListPredicate reports whether a predicate takes a list of values
+func IsListPredicate(name string) bool {
+	_, canonical := predicateKind(name)
+	base := strings.TrimPrefix(canonical, "ExceptIf")
+	return canonical != "" && !flagPredicates[base] && !singlePredicates[base]
+}
+
+// scopeText spells out FromScope and SentToScope values
+var scopeText = map[string]string{
+	"InOrganization":     "Inside the organization",
+	"NotInOrganization":  "Outside the organization",
+	"ExternalPartner":    "External partner",
+	"ExternalNonPartner": "External non-partner",
+}
+
+func describePredicate(p Predicate) string {
+	format := predicateText[strings.TrimPrefix(p.Name, "ExceptIf")]
+	var value string
+	switch v := p.Value.(type) {
+	case []string:
+		value = strings.Join(v, "' or '")
+	case bool:
+		if !v {
+			return ""
+		}
+	default:
+		value = fmt.Sprint(v)
+	}
+	if text, ok := scopeText[value]; ok {
+		value = text
+	}
+	if strings.Contains(format, "%s") {
+		return fmt.Sprintf(format, value)
+	}
+	return format
+}
+
+// Description is the rule summary Get-TransportRule shows
+func (r *TransportRule) Description() string {
+	var sb strings.Builder
+	section := func(title string, preds []Predicate) {
+		if len(preds) == 0 {
+			return
+		}
+		sb.WriteString(title + "\n")
+		for _, p := range preds {
+			if text := describePredicate(p); text != "" {
+				sb.WriteString("\t" + text + "\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	section("If the message:", r.Conditions)
+	section("Take the following actions:", r.Actions)
+	section("Except if the message:", r.Exceptions)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Get returns a predicate's value, or nil when the rule doesn't set it
+func (r *TransportRule) Get(name string) interface{} {
+	for _, list := range [][]Predicate{r.Conditions, r.Exceptions, r.Actions} {
+		for _, p := range list {
+			if strings.EqualFold(p.Name, name) {
+				return p.Value
+			}
+		}
+	}
+	return nil
+}
+
+// Set adds, replaces or, with a nil value, clears a predicate
+func (r *TransportRule) Set(name string, value interface{}) error {
+	kind, canonical := predicateKind(name)
+	if kind == "" {
+		return fmt.Errorf("A parameter cannot be found that matches parameter name '%s'.", name)
+	}
+	list := &r.Conditions
+	switch kind {
+	case "exception":
+		list = &r.Exceptions
+	case "action":
+		list = &r.Actions
+	}
+	for i, p := range *list {
+		if p.Name == canonical {
+			if value == nil {
+				*list = append((*list)[:i:i], (*list)[i+1:]...)
+			} else {
+				(*list)[i].Value = value
+			}
+			return nil
+		}
+	}
+	if value != nil {
+		*list = append(*list, Predicate{Name: canonical, Value: value})
+	}
+	return nil
+}
+
+// predicateKind classifies a predicate name as condition, exception or
+// action and returns its canonical spelling
+func predicateKind(name string) (kind, canonical string) {
+	for _, n := range ConditionNames {
+		if strings.EqualFold(n, name) {
+			return "condition", n
+		}
+		if strings.EqualFold("ExceptIf"+n, name) {
+			return "exception", "ExceptIf" + n
+		}
+	}
+	for _, n := range ActionNames {
+		if strings.EqualFold(n, name) {
+			return "action", n
+		}
+	}
+	return "", ""
+}
+
+// IsPredicate reports whether name is a transport rule condition, exception or action
+func IsPredicate(name string) bool {
+	kind, _ := predicateKind(name)
+	return kind != ""
+}
+
+// TransportRules returns the rules in priority order
+func (org *Organization) TransportRules() []*TransportRule {
+	out := append([]*TransportRule(nil), org.rules...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Priority < out[j].Priority })
+	return out
+}
+
+// TransportRule finds a rule by name or guid
+func (org *Organization) TransportRule(identity string) (*TransportRule, error) {
+	for _, r := range org.rules {
+		if strings.EqualFold(r.Name, identity) || strings.EqualFold(r.Guid, identity) {
+			return r, nil
+		}
+	}
+	return nil, &NotFoundError{Identity: identity}
+}
+
+// NewTransportRule validates and adds a rule. A priority of -1 puts it
+// last; otherwise the rules at and below that priority move down one.
+func (org *Organization) NewTransportRule(r *TransportRule, priority int) error {
+	if _, err := org.TransportRule(r.Name); err == nil {
+		return fmt.Errorf("A transport rule with the name \"%s\" already exists. Please specify a different name.", r.Name)
+	}
+	if err := org.validateRule(r); err != nil {
+		return err
+	}
+	if priority < -1 || priority > len(org.rules) {
+		return fmt.Errorf("The value of parameter Priority is out of range. Its value must be from 0 to %d.", len(org.rules))
+	}
+	if priority == -1 {
+		priority = len(org.rules)
+	}
+	for _, other := range org.rules {
+		if other.Priority >= priority {
+			other.Priority++
+		}
+	}
+	r.Guid = org.newGUID()
+	r.Priority = priority
+	r.WhenChanged = org.clock()
+	if r.State == "" {
+		r.State = "Enabled"
+	}
+	if r.Mode == "" {
+		r.Mode = "Enforce"
+	}
+	org.rules = append(org.rules, r)
+	return nil
+}
+
+// SetTransportRule changes or, with nil values, clears predicates of a
+// rule. The rule is left untouched when the result would be invalid.
+func (org *Organization) SetTransportRule(r *TransportRule, changes map[string]interface{}) error {
+	cp := r.clone()
+	for name, v := range changes {
+		if err := cp.Set(name, v); err != nil {
+			return err
+		}
+	}
+	if err := org.validateRule(cp); err != nil {
+		return err
+	}
+	cp.WhenChanged = org.clock()
+	*r = *cp
+	return nil
+}
+
+// validateRule checks a rule's predicates, resolving recipients to their
+// primary SMTP addresses
+func (org *Organization) validateRule(r *TransportRule) error {
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("The rule \"%s\" doesn't contain any actions. Specify at least one action.", r.Name)
+	}
+	if (r.Get("SetHeaderName") == nil) != (r.Get("SetHeaderValue") == nil) {
+		return fmt.Errorf("The SetHeaderName and SetHeaderValue parameters must be used together.")
+	}
+	for _, list := range [][]Predicate{r.Conditions, r.Exceptions, r.Actions} {
+		for i, p := range list {
+			base := strings.TrimPrefix(p.Name, "ExceptIf")
+			if base == "FromScope" || base == "SentToScope" {
+				v := toString(p.Value)
+				enum := map[string]string{"FromScope": "FromUserScope", "SentToScope": "ToUserScope"}[base]
+				if _, valid := scopeText[v]; !valid || base == "FromScope" && v != "InOrganization" && v != "NotInOrganization" {
+					return fmt.Errorf("Cannot bind parameter '%s'. Cannot convert value \"%s\" to type \"Microsoft.Exchange.MessagingPolicies.Rules.Tasks.%s\".", p.Name, v, enum)
+				}
+			}
+			if !recipientPredicates[base] {
+				continue
+			}
+			var addrs []string
+			for _, id := range p.Value.([]string) {
+				rcpt, err := org.Resolve(id)
+				if err == nil && strings.HasSuffix(base, "MemberOf") && !rcpt.IsGroup() {
+					err = fmt.Errorf("not a group")
+				}
+				if err != nil {
+					return fmt.Errorf("Couldn't find object \"%s\". Please make sure that it was spelled correctly or specify a different object.", id)
+				}
+				addrs = append(addrs, rcpt.PrimarySmtpAddress())
+			}
+			list[i].Value = addrs
+		}
+	}
+	return nil
+}
+
+// SetPriority moves a rule, shifting the rules between its old and new places
+func (org *Organization) SetPriority(r *TransportRule, priority int) error {
+	if priority < 0 || priority >= len(org.rules) {
+		return fmt.Errorf("The value of parameter Priority is out of range. Its value must be from 0 to %d.", len(org.rules)-1)
+	}
+	for _, other := range org.rules {
+		switch {
+		case other == r:
+		case r.Priority < priority && other.Priority > r.Priority && other.Priority <= priority:
+			other.Priority--
+		case r.Priority > priority && other.Priority >= priority && other.Priority < r.Priority:
+			other.Priority++
+		}
+	}
+	r.Priority = priority
+	r.WhenChanged = org.clock()
+	return nil
+}
+
+// Touch stamps a rule as changed
+func (org *Organization) Touch(r *TransportRule) {
+	r.WhenChanged = org.clock()
+}
+
+// RemoveTransportRule deletes a rule and closes the gap in priorities
+func (org *Organization) RemoveTransportRule(r *TransportRule) {
+	for i, x := range org.rules {
+		if x == r {
+			org.rules = append(org.rules[:i:i], org.rules[i+1:]...)
+			break
+		}
+	}
+	for _, other := range org.rules {
+		if other.Priority > r.Priority {
+			other.Priority--
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package exchange
+
+import "time"
+
+// sampleMailbox is one seeded user mailbox: alias, display name and office
+type sampleMailbox struct {
+	alias, display, office string
+}
+
+// sampleMailboxes mirror the users of the graph package's sample tenant
+var sampleMailboxes = []sampleMailbox{
+	{"admin", "MOD Administrator", ""},
+	{"AdeleV", "Adele Vance", "18/2111"},
+	{"AlexW", "Alex Wilber", "131/1104"},
+	{"DiegoS", "Diego Siciliani", "14/1108"},
+	{"GradyA", "Grady Archie", "19/2109"},
+	{"HenriettaM", "Henrietta Mueller", "18/1106"},
+	{"IsaiahL", "Isaiah Langer", "20/1101"},
+	{"JohannaL", "Johanna Lorenz", "23/2102"},
+	{"JoniS", "Joni Sherman", "20/1109"},
+	{"LeeG", "Lee Gu", "23/3101"},
+	{"LidiaH", "Lidia Holloway", "20/2107"},
+	{"LynneR", "Lynne Robbins", "20/1104"},
+	{"MeganB", "Megan Bowen", "12/1110"},
+	{"MiriamG", "Miriam Graham", "131/2103"},
+	{"NestorW", "Nestor Wilke", "36/1121"},
+	{"PattiF", "Patti Fernandez", "15/1102"},
+	{"PradeepG", "Pradeep Gupta", "98/2202"},
+}
+
+// sampleResource is one seeded shared, room or equipment mailbox
+type sampleResource struct {
+	kind, name, alias string
+}
+
+var sampleResources = []sampleResource{
+	{SharedMailbox, "Info", "info"},
+	{SharedMailbox, "Support", "support"},
+	{RoomMailbox, "Conf Room Adams", "Adams"},
+	{RoomMailbox, "Conf Room Baker", "Baker"},
+	{EquipmentMailbox, "Projector 01", "Projector01"},
+}
+
+// sampleGroup is one seeded group, its owner and the aliases of its members
+type sampleGroup struct {
+	name, alias string
+	security    bool
+	owner       string
+	members     []string
+}
+
+var sampleGroups = []sampleGroup{
+	{"Sales Team", "SalesTeam", false, "MiriamG", []string{"IsaiahL", "MiriamG", "AlexW"}},
+	{"Marketing", "Marketing", false, "MeganB", []string{"MeganB", "AlexW"}},
+	{"Leadership", "Leadership", false, "PattiF", []string{"PattiF", "LeeG", "MiriamG", "NestorW"}},
+	{"IT Alerts", "ITAlerts", true, "admin", []string{"admin", "DiegoS", "NestorW"}},
+}
+
+// SampleOrganization builds the contoso.onmicrosoft.com organization used by
+// the Exchange lessons
+func SampleOrganization() *Organization {
+	org := NewOrganization("contoso.onmicrosoft.com")
+	org.clock = func() time.Time { return fixtureTime }
+	for _, s := range sampleMailboxes {
+		address := s.alias + "@" + org.Domain
+		r, err := org.NewMailbox(UserMailbox, s.alias, s.alias, address, address)
+		if err != nil {
+			panic(err)
+		}
+		r.attrs["DisplayName"] = s.display
+		r.attrs["Office"] = s.office
+	}
+	for _, s := range sampleResources {
+		if _, err := org.NewMailbox(s.kind, s.name, s.alias, "", ""); err != nil {
+			panic(err)
+		}
+	}
+	for _, s := range sampleGroups {
+		g, err := org.NewGroup(s.name, s.alias, "", s.security, []string{s.owner})
+		if err != nil {
+			panic(err)
+		}
+		for _, alias := range s.members {
+			m, _ := org.Resolve(alias)
+			g.members = append(g.members, m.Guid)
+		}
+	}
+	grant := func(mailbox, user string) {
+		mbx, _ := org.Resolve(mailbox)
+		u, _ := org.Resolve(user)
+		org.AddMailboxPermission(mbx, u, []string{"FullAccess"})
+	}
+	grant("Support", "DiegoS")
+	grant("Support", "NestorW")
+	grant("Info", "MeganB")
+	info, _ := org.Resolve("Info")
+	megan, _ := org.Resolve("MeganB")
+	org.AddRecipientPermission(info, megan)
+
+	rule := &TransportRule{
+		Name:     "External sender warning",
+		Comments: "Flag mail that comes from outside the organization",
+		Conditions: []Predicate{
+			{Name: "FromScope", Value: "NotInOrganization"},
+		},
+		Actions: []Predicate{
+			{Name: "PrependSubject", Value: "[EXTERNAL] "},
+		},
+	}
+	if err := org.NewTransportRule(rule, -1); err != nil {
+		panic(err)
+	}
+	org.clock = time.Now
+	return org
+}
@@ -0,0 +1,76 @@
+package exchange
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the binary units ByteQuantifiedSize values are written in
+var sizeUnits = []struct {
+	name  string
+	bytes int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// FormatSize writes a byte count the way Exchange shows quotas and
+// mailbox sizes, e.g. "49.5 GB (53,150,220,288 bytes)"
+func FormatSize(bytes int64) string {
+	for _, u := range sizeUnits {
+		if bytes >= u.bytes || u.bytes == 1 {
+			n := strconv.FormatFloat(float64(bytes)/float64(u.bytes), 'f', 3, 64)
+			n = strings.TrimRight(strings.TrimRight(n, "0"), ".")
+			return fmt.Sprintf("%s %s (%s bytes)", n, u.name, groupDigits(bytes))
+		}
+	}
+	return ""
+}
+
+// ParseSize reads a quota such as "50GB", "49.5 GB", "1048576" or
+// "Unlimited" and returns it in FormatSize's form
+func ParseSize(s string) (string, error) {
+	text := strings.TrimSpace(s)
+	if strings.EqualFold(text, "Unlimited") {
+		return "Unlimited", nil
+	}
+	if i := strings.Index(text, "("); i > 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	upper := strings.ToUpper(strings.ReplaceAll(text, " ", ""))
+	for _, u := range sizeUnits {
+		if !strings.HasSuffix(upper, u.name) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(upper, u.name), 64)
+		if err != nil || n < 0 {
+			break
+		}
+		return FormatSize(int64(n * float64(u.bytes))), nil
+	}
+	if n, err := strconv.ParseInt(upper, 10, 64); err == nil && n >= 0 {
+		return FormatSize(n), nil
+	}
+	return "", fmt.Errorf("Cannot convert value \"%s\" to type \"Microsoft.Exchange.Data.Unlimited`1[Microsoft.Exchange.Data.ByteQuantifiedSize]\". Error: \"The format of the value you specified in the input parameter isn't valid.\"", s)
+}
+
+// SizeBytes returns the byte count of a FormatSize value, or -1 for Unlimited
+func SizeBytes(size string) int64 {
+	i, j := strings.Index(size, "("), strings.Index(size, " bytes)")
+	if i < 0 || j < i {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(size[i+1:j], ",", ""), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func groupDigits(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,419 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter is a parsed OData $filter expression
+type Filter struct {
+	root filterNode
+}
+
+// Match reports whether an object satisfies the filter
+func (f *Filter) Match(o *Object) bool {
+	return f.root.eval(o)
+}
+
+type filterNode interface {
+	eval(o *Object) bool
+}
+
+type logicalNode struct {
+	and         bool
+	left, right filterNode
+}
+
+func (n *logicalNode) eval(o *Object) bool {
+	if n.and {
+		return n.left.eval(o) && n.right.eval(o)
+	}
+	return n.left.eval(o) || n.right.eval(o)
+}
+
+type notNode struct{ inner filterNode }
+
+func (n *notNode) eval(o *Object) bool { return !n.inner.eval(o) }
+
+// compareNode is "property op literal", startswith/endswith, or "property in (...)"
+type compareNode struct {
+	prop   string
+	op     string // eq ne gt ge lt le startswith endswith in
+	values []interface{}
+}
+
+func (n *compareNode) eval(o *Object) bool {
+	v := o.props[n.prop]
+	switch n.op {
+	case "in":
+		for _, want := range n.values {
+			if compareValues(v, want) == 0 {
+				return true
+			}
+		}
+		return false
+	case "startswith", "endswith":
+		s, ok := v.(string)
+		want, _ := n.values[0].(string)
+		if !ok {
+			return false
+		}
+		s, want = strings.ToLower(s), strings.ToLower(want)
+		if n.op == "startswith" {
+			return strings.HasPrefix(s, want)
+		}
+		return strings.HasSuffix(s, want)
+	}
+	cmp := compareValues(v, n.values[0])
+	switch n.op {
+	case "eq":
+		return cmp == 0
+	case "ne":
+		return cmp != 0
+	}
+	if v == nil || n.values[0] == nil || cmp == incomparable {
+		return false
+	}
+	switch n.op {
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// anyNode is a lambda over a collection, e.g. groupTypes/any(c:c eq 'Unified')
+type anyNode struct {
+	prop string
+	want string
+}
+
+func (n *anyNode) eval(o *Object) bool {
+	list, _ := o.props[n.prop].([]string)
+	for _, s := range list {
+		if strings.EqualFold(s, n.want) {
+			return true
+		}
+	}
+	return false
+}
+
+const incomparable = 2
+
+// compareValues orders two property values; strings compare case-insensitively
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0
+		}
+		return incomparable
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return incomparable
+		}
+		return strings.Compare(strings.ToLower(x), strings.ToLower(y))
+	case bool:
+		y, ok := b.(bool)
+		if !ok || x != y {
+			return incomparable
+		}
+		return 0
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return incomparable
+		}
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+		return 0
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return incomparable
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return incomparable
+}
+
+// ParseFilter parses a $filter expression against the properties of kind
+func ParseFilter(text, kind string) (*Filter, error) {
+	p := &filterParser{kind: kind}
+	if err := p.lex(text); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, invalidFilter("syntax error at position %d in '%s'.", p.toks[p.pos].at, text)
+	}
+	return &Filter{root: root}, nil
+}
+
+func invalidFilter(format string, args ...interface{}) *Error {
+	return &Error{400, "BadRequest", "Invalid filter clause: " + fmt.Sprintf(format, args...)}
+}
+
+type filterToken struct {
+	kind string // ident, string, number, punct
+	text string
+	at   int
+}
+
+type filterParser struct {
+	kind string
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) lex(text string) error {
+	for i := 0; i < len(text); {
+		ch := rune(text[i])
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case strings.ContainsRune("(),:", ch):
+			p.toks = append(p.toks, filterToken{"punct", string(ch), i})
+			i++
+		case ch == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; ; j++ {
+				if j >= len(text) {
+					return invalidFilter("unterminated string literal at position %d in '%s'.", i, text)
+				}
+				if text[j] == '\'' {
+					if j+1 < len(text) && text[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(text[j])
+			}
+			p.toks = append(p.toks, filterToken{"string", sb.String(), i})
+			i = j + 1
+		default:
+			kind, stops := "ident", "(),:'"
+			if ch == '-' || unicode.IsDigit(ch) {
+				// datetime literals such as 2024-01-01T00:00:00Z carry colons
+				kind, stops = "number", "(),'"
+			}
+			j := i
+			for j < len(text) && !unicode.IsSpace(rune(text[j])) && !strings.ContainsRune(stops, rune(text[j])) {
+				j++
+			}
+			word := text[i:j]
+			p.toks = append(p.toks, filterToken{kind, word, i})
+			i = j
+		}
+	}
+	return nil
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return filterToken{kind: "eof", at: -1}
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == "ident" && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(punct string) error {
+	t := p.next()
+	if t.kind != "punct" || t.text != punct {
+		return invalidFilter("expected '%s' at position %d.", punct, t.at)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.keyword("or") {
+		var right filterNode
+		right, err = p.parseAnd()
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	for err == nil && p.keyword("and") {
+		var right filterNode
+		right, err = p.parseNot()
+		left = &logicalNode{and: true, left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.keyword("not") {
+		inner, err := p.parseNot()
+		return &notNode{inner}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) property(name string) (string, error) {
+	prop, ok := propertyName(p.kind, name)
+	if !ok {
+		return "", &Error{400, "BadRequest", fmt.Sprintf("Could not find a property named '%s' on type 'microsoft.graph.%s'.", name, p.kind)}
+	}
+	return prop, nil
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	t := p.next()
+	if t.kind == "punct" && t.text == "(" {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	if t.kind != "ident" {
+		return nil, invalidFilter("syntax error at position %d.", t.at)
+	}
+	fn := strings.ToLower(t.text)
+	if (fn == "startswith" || fn == "endswith") && p.peek().text == "(" {
+		p.pos++
+		name := p.next()
+		prop, err := p.property(name.text)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		lit := p.next()
+		if lit.kind != "string" {
+			return nil, invalidFilter("%s expects a string literal at position %d.", fn, lit.at)
+		}
+		return &compareNode{prop: prop, op: fn, values: []interface{}{lit.text}}, p.expect(")")
+	}
+	if i := strings.Index(t.text, "/"); i > 0 && strings.EqualFold(t.text[i+1:], "any") {
+		return p.parseAny(t.text[:i])
+	}
+	prop, err := p.property(t.text)
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	opName := strings.ToLower(op.text)
+	switch opName {
+	case "eq", "ne", "gt", "ge", "lt", "le":
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{prop: prop, op: opName, values: []interface{}{v}}, nil
+	case "in":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		n := &compareNode{prop: prop, op: "in"}
+		for {
+			v, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+			if p.peek().text != "," {
+				break
+			}
+			p.pos++
+		}
+		return n, p.expect(")")
+	}
+	return nil, invalidFilter("unsupported operator '%s' at position %d.", op.text, op.at)
+}
+
+// parseAny handles prop/any(x:x eq 'literal'); the opening "(" is next
+func (p *filterParser) parseAny(name string) (filterNode, error) {
+	prop, err := p.property(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	v := p.next()
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if ref := p.next(); !strings.EqualFold(ref.text, v.text) {
+		return nil, invalidFilter("lambda variable '%s' expected at position %d.", v.text, ref.at)
+	}
+	if !p.keyword("eq") {
+		return nil, invalidFilter("only 'eq' is supported inside any() at position %d.", p.peek().at)
+	}
+	lit := p.next()
+	if lit.kind != "string" {
+		return nil, invalidFilter("any() expects a string literal at position %d.", lit.at)
+	}
+	return &anyNode{prop: prop, want: lit.text}, p.expect(")")
+}
+
+func (p *filterParser) literal() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case "string":
+		return t.text, nil
+	case "number":
+		if ts, err := time.Parse(time.RFC3339, t.text); err == nil {
+			return ts.UTC(), nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, invalidFilter("invalid literal '%s' at position %d.", t.text, t.at)
+		}
+		return f, nil
+	case "ident":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, invalidFilter("literal expected at position %d.", t.at)
+}
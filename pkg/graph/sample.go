@@ -0,0 +1,117 @@
+package graph
+
+import "strings"
+
+// sampleUser is one seeded user: display name, job title, department, office
+// and whether the account is enabled
+type sampleUser struct {
+	given, surname, title, department, office string
+	enabled                                   bool
+}
+
+var sampleUsers = []sampleUser{
+	{"MOD", "Administrator", "", "", "", true},
+	{"Adele", "Vance", "Retail Manager", "Retail", "18/2111", true},
+	{"Alex", "Wilber", "Marketing Assistant", "Marketing", "131/1104", true},
+	{"Diego", "Siciliani", "HR Manager", "HR", "14/1108", true},
+	{"Grady", "Archie", "Designer", "R&D", "19/2109", true},
+	{"Henrietta", "Mueller", "Developer", "R&D", "18/1106", true},
+	{"Isaiah", "Langer", "Sales Rep", "Sales", "20/1101", true},
+	{"Johanna", "Lorenz", "Senior Engineer", "Engineering", "23/2102", true},
+	{"Joni", "Sherman", "Paralegal", "Legal", "20/1109", false},
+	{"Lee", "Gu", "Director", "Manufacturing", "23/3101", true},
+	{"Lidia", "Holloway", "Product Manager", "Engineering", "20/2107", true},
+	{"Lynne", "Robbins", "Planner", "Retail", "20/1104", true},
+	{"Megan", "Bowen", "Marketing Manager", "Marketing", "12/1110", true},
+	{"Miriam", "Graham", "Director", "Sales & Marketing", "131/2103", true},
+	{"Nestor", "Wilke", "Director", "Operations", "36/1121", true},
+	{"Patti", "Fernandez", "President", "Executive Management", "15/1102", true},
+	{"Pradeep", "Gupta", "Accountant", "Finance", "98/2202", false},
+}
+
+// sampleGroup is one seeded group and the given names of its members
+type sampleGroup struct {
+	name, description string
+	unified, security bool
+	members           []string
+}
+
+var sampleGroups = []sampleGroup{
+	{"All Company", "This is the default group for everyone in the network", true, false,
+		[]string{"Adele", "Alex", "Diego", "Grady", "Henrietta", "Isaiah", "Johanna", "Joni", "Lee", "Lidia", "Lynne", "Megan", "Miriam", "Nestor", "Patti", "Pradeep"}},
+	{"Sales and Marketing", "Marketing campaigns and sales pipeline", true, false,
+		[]string{"Alex", "Isaiah", "Megan", "Miriam"}},
+	{"Retail", "Retail stores and merchandising", true, false,
+		[]string{"Adele", "Lynne"}},
+	{"Engineering", "Product engineering and design", true, false,
+		[]string{"Grady", "Henrietta", "Johanna", "Lidia"}},
+	{"Helpdesk Admins", "Can reset passwords for standard users", false, true,
+		[]string{"Diego", "Nestor"}},
+	{"License - E5", "Members are assigned Microsoft 365 E5 licenses", false, true,
+		[]string{"Adele", "Alex", "Megan", "Patti"}},
+}
+
+// SampleTenant builds the contoso.onmicrosoft.com tenant used by the cloud
+// lessons, signed in as the MOD Administrator
+func SampleTenant() *Tenant {
+	t := NewTenant("contoso.onmicrosoft.com")
+	byGiven := map[string]string{}
+	for _, s := range sampleUsers {
+		nick := s.given + string(s.surname[0])
+		display := s.given + " " + s.surname
+		if s.given == "MOD" {
+			nick, display = "admin", "MOD Administrator"
+		}
+		upn := nick + "@" + t.Domain
+		u := &Object{Kind: KindUser, props: map[string]interface{}{
+			"id":                t.newID(),
+			"businessPhones":    []string{},
+			"displayName":       display,
+			"givenName":         s.given,
+			"surname":           s.surname,
+			"userPrincipalName": upn,
+			"mail":              upn,
+			"mailNickname":      nick,
+			"preferredLanguage": "en-US",
+			"accountEnabled":    s.enabled,
+			"usageLocation":     "US",
+			"userType":          "Member",
+			"createdDateTime":   t.created,
+		}}
+		if s.title != "" {
+			u.props["jobTitle"] = s.title
+			u.props["department"] = s.department
+			u.props["officeLocation"] = s.office
+			u.props["businessPhones"] = []string{"+1 425 555 0" + strings.ReplaceAll(s.office[len(s.office)-3:], "/", "")}
+			u.props["city"] = "Redmond"
+			u.props["country"] = "United States"
+			u.props["companyName"] = "Contoso"
+		}
+		t.users = append(t.users, u)
+		byGiven[s.given] = u.ID()
+	}
+	t.me = byGiven["MOD"]
+	for _, s := range sampleGroups {
+		nick := strings.ReplaceAll(strings.ReplaceAll(s.name, " ", ""), "-", "")
+		g := &Object{Kind: KindGroup, props: map[string]interface{}{
+			"id":              t.newID(),
+			"createdDateTime": t.created,
+			"description":     s.description,
+			"displayName":     s.name,
+			"groupTypes":      []string{},
+			"mailEnabled":     s.unified,
+			"mailNickname":    nick,
+			"securityEnabled": s.security,
+		}}
+		if s.unified {
+			g.props["groupTypes"] = []string{"Unified"}
+			g.props["mail"] = nick + "@" + t.Domain
+			g.props["visibility"] = "Public"
+		}
+		for _, m := range s.members {
+			g.members = append(g.members, byGiven[m])
+		}
+		t.groups = append(t.groups, g)
+	}
+	return t
+}
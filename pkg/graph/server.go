@@ -0,0 +1,421 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PublicURL is the host clients address; responses use it in @odata links
+// so scripts see the same URLs they would against the real service
+const PublicURL = "https://graph.microsoft.com"
+
+// Page sizes, as enforced by the users and groups endpoints
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 999
+)
+
+// Server serves a tenant over HTTP on a loopback address
+type Server struct {
+	tenant   *Tenant
+	listener net.Listener
+	http     *http.Server
+}
+
+// NewServer creates a server for a tenant; call Start to begin listening
+func NewServer(t *Tenant) *Server {
+	return &Server{tenant: t}
+}
+
+// Start listens on an ephemeral 127.0.0.1 port. The listener is never bound
+// to another interface, so the service is unreachable from the network.
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	s.http = &http.Server{Handler: s, ReadHeaderTimeout: 5 * time.Second}
+	go s.http.Serve(l)
+	return nil
+}
+
+// URL returns the base URL the server listens on, e.g. http://127.0.0.1:49152
+func (s *Server) URL() string {
+	if s.listener == nil {
+		return ""
+	}
+	return "http://" + s.listener.Addr().String()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	if s.http == nil {
+		return nil
+	}
+	return s.http.Close()
+}
+
+// ServeHTTP routes a v1.0 request to the tenant
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.tenant.mu.Lock()
+	defer s.tenant.mu.Unlock()
+
+	status, body := s.route(r)
+	if err, ok := body.(*Error); ok {
+		status, body = err.Status, errorBody(err, s.tenant.clock())
+	}
+	w.Header().Set("Content-Type", "application/json;odata.metadata=minimal;odata.streaming=true;IEEE754Compatible=false;charset=utf-8")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func errorBody(err *Error, now time.Time) ordered {
+	return ordered{{"error", ordered{
+		{"code", err.Code},
+		{"message", err.Message},
+		{"innerError", ordered{
+			{"date", now.UTC().Format("2006-01-02T15:04:05")},
+			{"request-id", "00000000-0000-0000-0000-000000000000"},
+		}},
+	}}}
+}
+
+// route dispatches on method and path segments, returning a status and a
+// JSON body or an *Error
+func (s *Server) route(r *http.Request) (int, interface{}) {
+	path := strings.Trim(r.URL.Path, "/")
+	if !strings.HasPrefix(path, "v1.0/") && path != "v1.0" {
+		return 0, &Error{400, "BadRequest", "Invalid version."}
+	}
+	segs := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "v1.0"), "/"), "/")
+	for i, seg := range segs {
+		segs[i], _ = url.PathUnescape(seg)
+	}
+	t := s.tenant
+	q := r.URL.Query()
+
+	// /me is an alias for the signed-in user
+	if strings.EqualFold(segs[0], "me") {
+		segs = append([]string{"users", t.me}, segs[1:]...)
+	}
+	kind := ""
+	switch strings.ToLower(segs[0]) {
+	case "users":
+		kind = KindUser
+	case "groups":
+		kind = KindGroup
+	default:
+		return 0, &Error{400, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", segs[0])}
+	}
+	set := segs[0]
+
+	if len(segs) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			objs := t.Users()
+			if kind == KindGroup {
+				objs = t.Groups()
+			}
+			return s.collection(r, set, kind, objs)
+		case http.MethodPost:
+			body, bad := readBody(r)
+			if bad != nil {
+				return 0, bad
+			}
+			o, err := t.Create(kind, body)
+			if err != nil {
+				return 0, err
+			}
+			return http.StatusCreated, s.entity(o, set, nil, false)
+		}
+		return 0, methodNotAllowed(r)
+	}
+
+	var o *Object
+	if kind == KindUser {
+		o = t.User(segs[1])
+	} else {
+		o = t.Group(segs[1])
+	}
+	if o == nil {
+		return 0, notFound(segs[1])
+	}
+
+	if len(segs) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			sel, bad := parseSelect(q.Get("$select"), kind)
+			if bad != nil {
+				return 0, bad
+			}
+			return http.StatusOK, s.entity(o, set, sel, false)
+		case http.MethodPatch:
+			body, bad := readBody(r)
+			if bad != nil {
+				return 0, bad
+			}
+			if err := t.Update(o, body); err != nil {
+				return 0, err
+			}
+			return http.StatusNoContent, nil
+		case http.MethodDelete:
+			t.Delete(o)
+			return http.StatusNoContent, nil
+		}
+		return 0, methodNotAllowed(r)
+	}
+
+	nav := strings.ToLower(segs[2])
+	switch {
+	case nav == "memberof" && len(segs) == 3 && r.Method == http.MethodGet:
+		return s.collection(r, "directoryObjects", "", t.MemberOf(o))
+	case nav == "members" && kind == KindGroup && len(segs) == 3 && r.Method == http.MethodGet:
+		return s.collection(r, "directoryObjects", "", t.Members(o))
+	case nav == "members" && kind == KindGroup && len(segs) == 4 && segs[3] == "$ref" && r.Method == http.MethodPost:
+		body, bad := readBody(r)
+		if bad != nil {
+			return 0, bad
+		}
+		ref, _ := lookupFold(body, "@odata.id")
+		refURL, _ := ref.(string)
+		if refURL == "" {
+			return 0, badRequest("Invalid object identifier '%s'.", refURL)
+		}
+		if err := t.AddMember(o, refURL[strings.LastIndex(refURL, "/")+1:]); err != nil {
+			return 0, err
+		}
+		return http.StatusNoContent, nil
+	case nav == "members" && kind == KindGroup && len(segs) == 5 && segs[4] == "$ref" && r.Method == http.MethodDelete:
+		if err := t.RemoveMember(o, segs[3]); err != nil {
+			return 0, err
+		}
+		return http.StatusNoContent, nil
+	}
+	return 0, &Error{400, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", segs[2])}
+}
+
+func methodNotAllowed(r *http.Request) *Error {
+	return &Error{405, "Request_BadRequest", fmt.Sprintf("Specified HTTP method is not supported for the request uri. Method: '%s'.", r.Method)}
+}
+
+func readBody(r *http.Request) (map[string]interface{}, *Error) {
+	var body map[string]interface{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&body); err != nil {
+		return nil, &Error{400, "BadRequest", "Unable to read JSON request payload. Please ensure Content-Type header is set and payload is of valid JSON format."}
+	}
+	return body, nil
+}
+
+// collection applies $filter, $orderby, $select, $top and $skiptoken to a
+// set of objects and returns one page
+func (s *Server) collection(r *http.Request, set, kind string, objs []*Object) (int, interface{}) {
+	q := r.URL.Query()
+	if text := q.Get("$filter"); text != "" {
+		if kind == "" {
+			return 0, &Error{400, "Request_UnsupportedQuery", "The specified filter to the reference property query is currently not supported."}
+		}
+		f, err := ParseFilter(text, kind)
+		if err != nil {
+			return 0, err
+		}
+		var kept []*Object
+		for _, o := range objs {
+			if f.Match(o) {
+				kept = append(kept, o)
+			}
+		}
+		objs = kept
+	}
+	if order := q.Get("$orderby"); order != "" {
+		if bad := orderBy(objs, order, kind); bad != nil {
+			return 0, bad
+		}
+	}
+	sel, bad := parseSelect(q.Get("$select"), kind)
+	if bad != nil {
+		return 0, bad
+	}
+	size := DefaultPageSize
+	if top := q.Get("$top"); top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return 0, &Error{400, "Request_BadRequest", fmt.Sprintf("Invalid page size specified: '%s'. Must be between 1 and %d inclusive.", top, MaxPageSize)}
+		}
+		size = n
+	}
+	offset := 0
+	if token := q.Get("$skiptoken"); token != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		if err == nil {
+			offset, err = strconv.Atoi(strings.TrimPrefix(string(raw), "offset:"))
+		}
+		if err != nil || offset < 0 {
+			return 0, &Error{400, "Request_BadRequest", "Invalid paging token specified."}
+		}
+	}
+
+	context := PublicURL + "/v1.0/$metadata#" + set
+	if len(sel) > 0 {
+		context += "(" + strings.Join(sel, ",") + ")"
+	}
+	page := ordered{{"@odata.context", context}}
+	if strings.EqualFold(q.Get("$count"), "true") {
+		page = append(page, field{"@odata.count", len(objs)})
+	}
+	end := offset + size
+	if end < len(objs) {
+		next := url.Values{}
+		for k, v := range q {
+			if k != "$skiptoken" {
+				next[k] = v
+			}
+		}
+		next.Set("$skiptoken", base64.RawURLEncoding.EncodeToString([]byte("offset:"+strconv.Itoa(end))))
+		page = append(page, field{"@odata.nextLink", PublicURL + r.URL.Path + "?" + encodeQuery(next)})
+	} else {
+		end = len(objs)
+	}
+	values := []interface{}{}
+	if offset < len(objs) {
+		for _, o := range objs[offset:end] {
+			values = append(values, s.entity(o, "", sel, kind == ""))
+		}
+	}
+	return http.StatusOK, append(page, field{"value", values})
+}
+
+// encodeQuery is url.Values.Encode without escaping the $ of system query
+// options or the commas of a $select list
+func encodeQuery(v url.Values) string {
+	return strings.NewReplacer("%24", "$", "%2C", ",").Replace(v.Encode())
+}
+
+// entity renders an object's properties in schema order. With no $select
+// only the default properties are included; typed adds @odata.type, which
+// Graph emits for entities reached through a directoryObject collection.
+func (s *Server) entity(o *Object, set string, sel []string, typed bool) ordered {
+	var out ordered
+	if set != "" {
+		out = append(out, field{"@odata.context", PublicURL + "/v1.0/$metadata#" + set + "/$entity"})
+	}
+	if typed {
+		out = append(out, field{"@odata.type", "#microsoft.graph." + o.Kind})
+	}
+	for _, p := range schemaFor(o.Kind) {
+		if len(sel) == 0 && !p.def || len(sel) > 0 && !containsString(sel, p.name) {
+			continue
+		}
+		out = append(out, field{p.name, jsonValue(o.props[p.name])})
+	}
+	return out
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case time.Time:
+		return x.UTC().Format("2006-01-02T15:04:05Z")
+	case []string:
+		if x == nil {
+			return []string{}
+		}
+	}
+	return v
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSelect validates a $select list and returns canonical property names
+func parseSelect(text, kind string) ([]string, *Error) {
+	if text == "" {
+		return nil, nil
+	}
+	var sel []string
+	for _, name := range strings.Split(text, ",") {
+		name = strings.TrimSpace(name)
+		if kind == "" {
+			if p, ok := propertyName(KindUser, name); ok {
+				sel = append(sel, p)
+			} else if p, ok := propertyName(KindGroup, name); ok {
+				sel = append(sel, p)
+			}
+			continue
+		}
+		p, ok := propertyName(kind, name)
+		if !ok {
+			return nil, &Error{400, "Request_BadRequest", fmt.Sprintf("Could not find a property named '%s' on type 'microsoft.graph.%s'.", name, kind)}
+		}
+		sel = append(sel, p)
+	}
+	if !containsString(sel, "id") {
+		sel = append(sel, "id")
+	}
+	return sel, nil
+}
+
+// orderBy sorts objects by a single "property [asc|desc]" clause
+func orderBy(objs []*Object, clause, kind string) *Error {
+	fields := strings.Fields(clause)
+	name, ok := propertyName(kind, fields[0])
+	if !ok || len(fields) > 2 {
+		return &Error{400, "Request_UnsupportedQuery", fmt.Sprintf("Sorting not supported for '%s'.", clause)}
+	}
+	desc := len(fields) == 2 && strings.EqualFold(fields[1], "desc")
+	sort.SliceStable(objs, func(i, j int) bool {
+		cmp := compareValues(objs[i].props[name], objs[j].props[name])
+		if desc {
+			return cmp == 1
+		}
+		return cmp == -1
+	})
+	return nil
+}
+
+// field is one member of an ordered JSON object
+type field struct {
+	name  string
+	value interface{}
+}
+
+// ordered is a JSON object that keeps its members in insertion order, as
+// Graph responses do
+type ordered []field
+
+func (o ordered) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,388 @@
+// Package graph is a local stand-in for Microsoft Graph. It holds a seeded
+// Entra ID tenant and serves the users, groups and me endpoints of the v1.0
+// API, with $filter, $select, $top and @odata.nextLink paging, over a
+// loopback-only HTTP listener.
+package graph
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Object kinds
+const (
+	KindUser  = "user"
+	KindGroup = "group"
+)
+
+// schemaProp is one property of a resource type; def marks the properties
+// returned when a request has no $select
+type schemaProp struct {
+	name string
+	def  bool
+}
+
+var userSchema = []schemaProp{
+	{"businessPhones", true}, {"displayName", true}, {"givenName", true}, {"jobTitle", true},
+	{"mail", true}, {"mobilePhone", true}, {"officeLocation", true}, {"preferredLanguage", true},
+	{"surname", true}, {"userPrincipalName", true}, {"id", true},
+	{"accountEnabled", false}, {"city", false}, {"companyName", false}, {"country", false},
+	{"createdDateTime", false}, {"department", false}, {"employeeId", false},
+	{"mailNickname", false}, {"usageLocation", false}, {"userType", false},
+}
+
+var groupSchema = []schemaProp{
+	{"id", true}, {"createdDateTime", true}, {"description", true}, {"displayName", true},
+	{"groupTypes", true}, {"mail", true}, {"mailEnabled", true}, {"mailNickname", true},
+	{"securityEnabled", true}, {"visibility", true},
+}
+
+func schemaFor(kind string) []schemaProp {
+	if kind == KindGroup {
+		return groupSchema
+	}
+	return userSchema
+}
+
+// Properties returns every property of a resource type in schema order
+func Properties(kind string) []string {
+	var out []string
+	for _, p := range schemaFor(kind) {
+		out = append(out, p.name)
+	}
+	return out
+}
+
+// propertyName returns the schema spelling of a property, matched case-insensitively
+func propertyName(kind, name string) (string, bool) {
+	for _, p := range schemaFor(kind) {
+		if strings.EqualFold(p.name, name) {
+			return p.name, true
+		}
+	}
+	return "", false
+}
+
+// Object is a user or group
+type Object struct {
+	Kind    string
+	props   map[string]interface{}
+	members []string // member ids, for groups
+}
+
+// ID returns the object's id
+func (o *Object) ID() string {
+	id, _ := o.props["id"].(string)
+	return id
+}
+
+// Get returns a property by name, matched case-insensitively
+func (o *Object) Get(name string) (interface{}, bool) {
+	canonical, ok := propertyName(o.Kind, name)
+	if !ok {
+		return nil, false
+	}
+	return o.props[canonical], true
+}
+
+// Error is a Graph error response
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func notFound(id string) *Error {
+	return &Error{404, "Request_ResourceNotFound", fmt.Sprintf("Resource '%s' does not exist or one of its queried reference-property objects are not present.", id)}
+}
+
+func badRequest(format string, args ...interface{}) *Error {
+	return &Error{400, "Request_BadRequest", fmt.Sprintf(format, args...)}
+}
+
+// Tenant is an Entra ID directory: its users, groups and the signed-in user
+type Tenant struct {
+	ID     string
+	Domain string // initial domain, e.g. contoso.onmicrosoft.com
+
+	mu      sync.Mutex
+	users   []*Object
+	groups  []*Object
+	me      string
+	idSeq   int
+	clock   func() time.Time
+	created time.Time
+}
+
+// NewTenant creates an empty tenant for the given initial domain
+func NewTenant(domain string) *Tenant {
+	t := &Tenant{Domain: strings.ToLower(domain), clock: time.Now, created: fixtureTime}
+	t.ID = t.newID()
+	return t
+}
+
+// fixtureTime is when seeded objects were created, so responses are reproducible
+var fixtureTime = time.Date(2023, time.September, 12, 8, 0, 0, 0, time.UTC)
+
+// newID derives the next object id from the domain and a counter, so the
+// same seed data always gets the same ids
+func (t *Tenant) newID() string {
+	t.idSeq++
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d", t.Domain, t.idSeq)
+	b := make([]byte, 16)
+	rand.New(rand.NewSource(int64(h.Sum64()))).Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// SetClock overrides the time source used for createdDateTime
+func (t *Tenant) SetClock(clock func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clock = clock
+}
+
+// Clone returns an independent copy, so each session can change its own tenant
+func (t *Tenant) Clone() *Tenant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := &Tenant{ID: t.ID, Domain: t.Domain, me: t.me, idSeq: t.idSeq, clock: t.clock, created: t.created}
+	c.users = cloneObjects(t.users)
+	c.groups = cloneObjects(t.groups)
+	return c
+}
+
+func cloneObjects(objs []*Object) []*Object {
+	out := make([]*Object, len(objs))
+	for i, o := range objs {
+		cp := &Object{Kind: o.Kind, props: map[string]interface{}{}, members: append([]string(nil), o.members...)}
+		for k, v := range o.props {
+			if list, ok := v.([]string); ok {
+				v = append([]string(nil), list...)
+			}
+			cp.props[k] = v
+		}
+		out[i] = cp
+	}
+	return out
+}
+
+// Me returns the signed-in user
+func (t *Tenant) Me() *Object {
+	return t.find(t.users, t.me)
+}
+
+// SetMe changes the signed-in user, by id or userPrincipalName
+func (t *Tenant) SetMe(id string) error {
+	u := t.find(t.users, id)
+	if u == nil {
+		return notFound(id)
+	}
+	t.me = u.ID()
+	return nil
+}
+
+// User returns a user by id or userPrincipalName
+func (t *Tenant) User(id string) *Object {
+	return t.find(t.users, id)
+}
+
+// Group returns a group by id
+func (t *Tenant) Group(id string) *Object {
+	return t.find(t.groups, id)
+}
+
+// Users returns every user in creation order
+func (t *Tenant) Users() []*Object {
+	return append([]*Object(nil), t.users...)
+}
+
+// Groups returns every group in creation order
+func (t *Tenant) Groups() []*Object {
+	return append([]*Object(nil), t.groups...)
+}
+
+func (t *Tenant) find(objs []*Object, id string) *Object {
+	for _, o := range objs {
+		if strings.EqualFold(o.ID(), id) {
+			return o
+		}
+		if upn, ok := o.props["userPrincipalName"].(string); ok && strings.EqualFold(upn, id) {
+			return o
+		}
+	}
+	return nil
+}
+
+// object returns a user or group by id
+func (t *Tenant) object(id string) *Object {
+	if u := t.User(id); u != nil {
+		return u
+	}
+	return t.Group(id)
+}
+
+// Members returns the direct members of a group
+func (t *Tenant) Members(g *Object) []*Object {
+	var out []*Object
+	for _, id := range g.members {
+		if m := t.object(id); m != nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// MemberOf returns the groups an object is a direct member of
+func (t *Tenant) MemberOf(o *Object) []*Object {
+	var out []*Object
+	for _, g := range t.groups {
+		for _, id := range g.members {
+			if id == o.ID() {
+				out = append(out, g)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// AddMember adds a user or group to a group
+func (t *Tenant) AddMember(g *Object, memberID string) error {
+	m := t.object(memberID)
+	if m == nil {
+		return notFound(memberID)
+	}
+	for _, id := range g.members {
+		if id == m.ID() {
+			return badRequest("One or more added object references already exist for the following modified properties: 'members'.")
+		}
+	}
+	g.members = append(g.members, m.ID())
+	return nil
+}
+
+// RemoveMember removes a member from a group
+func (t *Tenant) RemoveMember(g *Object, memberID string) error {
+	for i, id := range g.members {
+		if strings.EqualFold(id, memberID) {
+			g.members = append(g.members[:i:i], g.members[i+1:]...)
+			return nil
+		}
+	}
+	return notFound(memberID)
+}
+
+// requiredProps are the properties a create request must supply
+var requiredProps = map[string][]string{
+	KindUser:  {"accountEnabled", "displayName", "mailNickname", "passwordProfile", "userPrincipalName"},
+	KindGroup: {"displayName", "mailEnabled", "mailNickname", "securityEnabled"},
+}
+
+// Create adds a user or group from a request body
+func (t *Tenant) Create(kind string, body map[string]interface{}) (*Object, error) {
+	resource := "User"
+	if kind == KindGroup {
+		resource = "Group"
+	}
+	for _, p := range requiredProps[kind] {
+		if v, ok := lookupFold(body, p); !ok || v == nil || v == "" {
+			return nil, badRequest("Invalid value specified for property '%s' of resource '%s'.", p, resource)
+		}
+	}
+	o := &Object{Kind: kind, props: map[string]interface{}{}}
+	if err := t.apply(o, body); err != nil {
+		return nil, err
+	}
+	if kind == KindUser {
+		upn := o.props["userPrincipalName"].(string)
+		at := strings.LastIndex(upn, "@")
+		if at < 0 || !strings.EqualFold(upn[at+1:], t.Domain) {
+			return nil, badRequest("The domain portion of the userPrincipalName property is invalid. You must use one of the verified domain names in your organization.")
+		}
+		if t.User(upn) != nil {
+			return nil, badRequest("Another object with the same value for property userPrincipalName already exists.")
+		}
+		if _, ok := o.props["userType"]; !ok {
+			o.props["userType"] = "Member"
+		}
+	}
+	o.props["id"] = t.newID()
+	o.props["createdDateTime"] = t.clock().UTC()
+	if kind == KindGroup {
+		if _, ok := o.props["groupTypes"]; !ok {
+			o.props["groupTypes"] = []string{}
+		}
+		t.groups = append(t.groups, o)
+	} else {
+		t.users = append(t.users, o)
+	}
+	return o, nil
+}
+
+// Update applies a PATCH body to an object
+func (t *Tenant) Update(o *Object, body map[string]interface{}) error {
+	return t.apply(o, body)
+}
+
+// apply copies writable properties from a request body onto an object
+func (t *Tenant) apply(o *Object, body map[string]interface{}) error {
+	for k, v := range body {
+		if strings.EqualFold(k, "passwordProfile") {
+			continue
+		}
+		name, ok := propertyName(o.Kind, k)
+		if !ok || name == "id" || name == "createdDateTime" {
+			kind := "user"
+			if o.Kind == KindGroup {
+				kind = "group"
+			}
+			return badRequest("Property '%s' does not exist as a declared property or extension property of 'microsoft.graph.%s'.", k, kind)
+		}
+		if list, ok := v.([]interface{}); ok {
+			strs := make([]string, len(list))
+			for i, item := range list {
+				strs[i] = fmt.Sprint(item)
+			}
+			v = strs
+		}
+		o.props[name] = v
+	}
+	return nil
+}
+
+// Delete removes a user or group
+func (t *Tenant) Delete(o *Object) {
+	remove := func(objs []*Object) []*Object {
+		for i, x := range objs {
+			if x == o {
+				return append(objs[:i:i], objs[i+1:]...)
+			}
+		}
+		return objs
+	}
+	t.users = remove(t.users)
+	t.groups = remove(t.groups)
+	for _, g := range t.groups {
+		t.RemoveMember(g, o.ID())
+	}
+}
+
+func lookupFold(m map[string]interface{}, key string) (interface{}, bool) {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
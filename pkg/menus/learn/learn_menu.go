@@ -71,12 +71,13 @@ func (m *LearnMenu) setupOptions() {
 	m.AddBackOption("Back to Main Menu", StateMainMenu)
 }
 
-// Module handler functions - these will launch specific learning modules
+// Module handler functions - these will launch specific learning modules.
+// The Data of an entry with lessons is the id of the module holding them.
 func (m *LearnMenu) handleOnPremiseModule() types.MenuResult {
 	return types.MenuResult{
 		Action:    types.ActionNavigate,
 		NextState: StateModuleExplorer,
-		Data:      "onprem",
+		Data:      "active-directory",
 		Message:   "Loading On-Premise Learning Module...",
 	}
 }
@@ -85,7 +86,7 @@ func (m *LearnMenu) handleMSGraphModule() types.MenuResult {
 	return types.MenuResult{
 		Action:    types.ActionNavigate,
 		NextState: StateModuleExplorer,
-		Data:      "mggraph",
+		Data:      "msgraph",
 		Message:   "Loading MSGraph Learning Module...",
 	}
 }
@@ -71,12 +71,15 @@ func (m *StudioMenu) setupOptions() {
 	m.AddBackOption("Back to Main Menu", StateMainMenu)
 }
 
+// InteractiveConsole is the Data of the result that opens the console
+const InteractiveConsole = "interactive_console"
+
 // Studio handler functions
 func (m *StudioMenu) handleInteractiveConsole() types.MenuResult {
 	return types.MenuResult{
 		Action:  types.ActionExecute,
 		Message: "Launching interactive PowerShell console...",
-		Data:    "interactive_console",
+		Data:    InteractiveConsole,
 	}
 }
 
@@ -0,0 +1,82 @@
+package modules
+
+// SolutionUnlockAttempts is how many failed submissions unlock an
+// exercise's solution
+const SolutionUnlockAttempts = 3
+
+// A passed exercise is worth maxScore points, less a penalty for each
+// failed submission and each hint revealed on the way. Passing after
+// viewing the solution is worth no more than solutionScore.
+const (
+	maxScore             = 100
+	minScore             = 10
+	failedAttemptPenalty = 10
+	maxAttemptPenalty    = 30
+	hintPenalty          = 15
+	solutionScore        = 20
+)
+
+// Attempts is a learner's record on one exercise. Once the exercise is
+// passed the record is final, so going back over a solved lesson doesn't
+// change the score it earned.
+type Attempts struct {
+	Submitted     int  // submissions, passed or not
+	Failed        int  // submissions that didn't pass
+	HintsUsed     int  // hints revealed, in order
+	SolutionShown bool // the learner viewed the solution
+	Passed        bool
+}
+
+// SolutionUnlocked reports whether the learner has failed enough times to see the solution
+func (a Attempts) SolutionUnlocked() bool {
+	return a.Failed >= SolutionUnlockAttempts
+}
+
+// AttemptsUntilSolution is how many more failed submissions unlock the solution
+func (a Attempts) AttemptsUntilSolution() int {
+	return max(SolutionUnlockAttempts-a.Failed, 0)
+}
+
+// Record counts a submission. Submissions after the exercise is passed
+// don't change the record, so practising a solved exercise costs nothing.
+func (a *Attempts) Record(passed bool) {
+	if a.Passed {
+		return
+	}
+	a.Submitted++
+	if passed {
+		a.Passed = true
+	} else {
+		a.Failed++
+	}
+}
+
+// UseHint counts the hints revealed so far, reporting whether the record changed
+func (a *Attempts) UseHint(revealed int) bool {
+	if a.Passed || revealed <= a.HintsUsed {
+		return false
+	}
+	a.HintsUsed = revealed
+	return true
+}
+
+// ShowSolution counts a view of the solution, reporting whether the record changed
+func (a *Attempts) ShowSolution() bool {
+	if a.Passed || a.SolutionShown {
+		return false
+	}
+	a.SolutionShown = true
+	return true
+}
+
+// Score is what the exercise earned, 0 until it is passed
+func (a Attempts) Score() int {
+	if !a.Passed {
+		return 0
+	}
+	score := maxScore - min(a.Failed*failedAttemptPenalty, maxAttemptPenalty) - a.HintsUsed*hintPenalty
+	if a.SolutionShown {
+		score = min(score, solutionScore)
+	}
+	return max(score, minScore)
+}
@@ -0,0 +1,194 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couragetogroww/powerhell/pkg/psim"
+)
+
+// Check is a condition the simulated environment must meet once the
+// learner's code has run. Task-style exercises, such as disabling a set of
+// accounts, are judged by the state they leave behind rather than by what
+// they output. A check runs its query in the learner's session and tests
+// the objects the query writes. The query sees the learner's state and
+// variables but only the built-in commands, so a function the learner
+// defines can't stand in for the real one.
+type Check struct {
+	Description string      // the outcome being checked, shown when it isn't met
+	Query       string      // PowerShell that reads the state, run after the learner's code
+	Property    string      // property of each object to test; empty tests the objects themselves
+	Value       interface{} // the value to look for; a string with wildcards matches like -like
+	Match       CheckMatch
+}
+
+// CheckMatch says which of the objects a check's query writes must hold its value
+type CheckMatch int
+
+const (
+	MatchAll   CheckMatch = iota // the query writes at least one object and all of them hold the value
+	MatchAny                     // at least one object holds the value
+	MatchNone                    // no object holds the value
+	MatchCount                   // the query writes exactly Value objects
+)
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Description string
+	Passed      bool
+	Message     string // why the check failed
+}
+
+// run evaluates the check against the session the learner's code ran in
+func (c Check) run(rs *psim.Runspace) CheckResult {
+	result := CheckResult{Description: c.Description}
+	res := rs.Inspect(c.Query)
+	if errs := res.Errors(); len(errs) > 0 && c.Match != MatchCount && c.Match != MatchNone {
+		result.Message = firstLine(errs[0].Error())
+		return result
+	}
+	objects := res.Output
+
+	if c.Match == MatchCount {
+		want, _ := c.Value.(int)
+		result.Passed = len(objects) == want
+		if !result.Passed {
+			result.Message = fmt.Sprintf("expected %d, found %d", want, len(objects))
+		}
+		return result
+	}
+
+	var matching, other []interface{}
+	for _, o := range objects {
+		if c.holds(o) {
+			matching = append(matching, o)
+		} else {
+			other = append(other, o)
+		}
+	}
+	switch c.Match {
+	case MatchAll:
+		result.Passed = len(objects) > 0 && len(other) == 0
+		if len(objects) == 0 {
+			result.Message = "no matching objects were found"
+		} else if !result.Passed {
+			result.Message = c.mismatch(other)
+		}
+	case MatchAny:
+		result.Passed = len(matching) > 0
+		if !result.Passed {
+			result.Message = fmt.Sprintf("no %s of %s", c.subject(), psim.Literal(c.Value))
+			if len(objects) > 0 {
+				result.Message += "; found " + listValues(c.values(objects))
+			}
+		}
+	case MatchNone:
+		result.Passed = len(matching) == 0
+		if !result.Passed {
+			result.Message = fmt.Sprintf("%s is %s for %s", c.subject(), psim.Literal(c.Value), listValues(labels(matching)))
+		}
+	}
+	return result
+}
+
+// holds reports whether an object has the check's value. A property holding
+// a collection has the value when any of its items does, as -contains
+// and -like on arrays would find it.
+func (c Check) holds(o interface{}) bool {
+	v := o
+	if c.Property != "" {
+		v, _ = propertyValue(o, c.Property)
+	}
+	if items, ok := v.([]interface{}); ok {
+		for _, item := range items {
+			if c.matches(item) {
+				return true
+			}
+		}
+		return false
+	}
+	return c.matches(v)
+}
+
+func (c Check) matches(v interface{}) bool {
+	if pattern, ok := c.Value.(string); ok && psim.HasWildcard(pattern) {
+		s, ok := v.(string)
+		return ok && psim.MatchWildcard(pattern, s, false)
+	}
+	return psim.ValuesMatch(c.Value, v)
+}
+
+// mismatch describes the objects that don't hold the value
+func (c Check) mismatch(objects []interface{}) string {
+	if c.Property == "" {
+		return fmt.Sprintf("expected %s, found %s", psim.Literal(c.Value), listValues(c.values(objects)))
+	}
+	var parts []string
+	verb := "be"
+	for _, o := range objects {
+		v, _ := propertyValue(o, c.Property)
+		if _, ok := v.([]interface{}); ok {
+			verb = "include"
+		}
+		parts = append(parts, fmt.Sprintf("%s for %s", psim.Literal(v), label(o)))
+	}
+	return fmt.Sprintf("expected %s to %s %s, but it is %s", c.Property, verb, psim.Literal(c.Value), listValues(parts))
+}
+
+// subject is what a failure message calls the tested values
+func (c Check) subject() string {
+	if c.Property == "" {
+		return "value"
+	}
+	return c.Property
+}
+
+// values are the tested values of objects, as failure messages show them
+func (c Check) values(objects []interface{}) []string {
+	var values []string
+	for _, o := range objects {
+		v := o
+		if c.Property != "" {
+			v, _ = propertyValue(o, c.Property)
+		}
+		values = append(values, psim.Literal(v))
+	}
+	return values
+}
+
+func propertyValue(o interface{}, name string) (interface{}, bool) {
+	switch x := o.(type) {
+	case *psim.PSObject:
+		return x.Get(name)
+	case *psim.Hashtable:
+		return x.Get(name)
+	}
+	return nil, false
+}
+
+// label names an object in a failure message by its Name, or else its value
+func label(o interface{}) string {
+	for _, name := range []string{"SamAccountName", "Name"} {
+		if v, ok := propertyValue(o, name); ok && v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return psim.Literal(o)
+}
+
+func labels(objects []interface{}) []string {
+	var names []string
+	for _, o := range objects {
+		names = append(names, label(o))
+	}
+	return names
+}
+
+// listValues joins values for a message, cutting long lists short
+func listValues(values []string) string {
+	const shown = 5
+	if len(values) > shown {
+		return strings.Join(values[:shown], ", ") + fmt.Sprintf(" and %d more", len(values)-shown)
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,39 @@
+package modules
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Lesson authors ship sample files alongside a lesson under
+// <module>/fixtures/<lesson>/ in the content tree. The first directory
+// below the lesson is the drive, so active-directory/fixtures/ad-2/C/users.csv
+// becomes C:\users.csv in the exercise's file system. An empty .keep file
+// makes an empty directory.
+
+// lessonFixtures returns the files under a lesson's fixtures directory
+// keyed by their full simulated path, or nil when it has none
+func lessonFixtures(fsys fs.FS, root string) map[string]string {
+	var files map[string]string
+	fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil
+		}
+		drive, rest, _ := strings.Cut(strings.TrimPrefix(p, root+"/"), "/")
+		if files == nil {
+			files = map[string]string{}
+		}
+		if path.Base(rest) == ".keep" {
+			files[drive+`:\`+strings.ReplaceAll(path.Dir(rest), "/", `\`)+`\`] = ""
+			return nil
+		}
+		files[drive+`:\`+strings.ReplaceAll(rest, "/", `\`)] = string(data)
+		return nil
+	})
+	return files
+}
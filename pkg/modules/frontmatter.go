@@ -0,0 +1,67 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Module and lesson metadata is written in a small subset of YAML: one
+// "key: value" pair per line, with optional quotes around the value and
+// whole-line # comments. That is all module.yaml and lesson front matter
+// need, and it keeps the content format easy to write by hand.
+
+// parseFields reads "key: value" lines into a map keyed by lower-case key
+func parseFields(text string) (map[string]string, error) {
+	fields := map[string]string{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+		value, err := unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		fields[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return fields, nil
+}
+
+// unquote strips the quotes from a YAML scalar. Double-quoted values take
+// backslash escapes; single-quoted ones double the quote to escape it.
+func unquote(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return strconv.Unquote(s)
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// splitFrontMatter separates the front matter between the leading ---
+// lines of a Markdown file from the body that follows
+func splitFrontMatter(text string) (fields map[string]string, body string, err error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return nil, "", fmt.Errorf("missing front matter")
+	}
+	header, body, ok := strings.Cut(rest, "\n---\n")
+	if !ok {
+		header, ok = strings.CutSuffix(rest, "\n---")
+		if !ok {
+			return nil, "", fmt.Errorf("front matter isn't closed with ---")
+		}
+	}
+	fields, err = parseFields(header)
+	if err != nil {
+		return nil, "", fmt.Errorf("front matter %v", err)
+	}
+	return fields, body, nil
+}
@@ -0,0 +1,209 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/couragetogroww/powerhell/pkg/psim"
+)
+
+// CaseResult is the outcome of one test case
+type CaseResult struct {
+	Input    string // the test case's input; empty when the code's own output is graded
+	Passed   bool
+	Expected string   // the text the case expects
+	Actual   string   // the text the learner's code produced
+	Diff     []string // how the output differs from what was expected, one line each
+	Checks   []CheckResult
+	Err      error // set when the exercise's session couldn't be set up to run the case
+
+	// Equivalent is set when the code is the solution written differently,
+	// which passes without its output being compared
+	Equivalent bool
+}
+
+// GradeResult is the outcome of grading an exercise
+type GradeResult struct {
+	Cases      []CaseResult
+	Preferred  string // the exercise's solution, when code that passed was written another way
+	Ungradable bool   // the exercise has nothing to hold code to, so no code passes it
+}
+
+// Passed reports whether every case passed
+func (g GradeResult) Passed() bool {
+	if g.Ungradable {
+		return false
+	}
+	for _, c := range g.Cases {
+		if !c.Passed {
+			return false
+		}
+	}
+	return len(g.Cases) > 0
+}
+
+// Summary describes the grade in one line
+func (g GradeResult) Summary() string {
+	if g.Ungradable {
+		return "This exercise has nothing to grade your code against"
+	}
+	if g.Passed() {
+		return fmt.Sprintf("All %d test cases passed", len(g.Cases))
+	}
+	return fmt.Sprintf("%d of %d test cases passed", g.PassedCount(), len(g.Cases))
+}
+
+// PassedCount returns how many cases passed
+func (g GradeResult) PassedCount() int {
+	n := 0
+	for _, c := range g.Cases {
+		if c.Passed {
+			n++
+		}
+	}
+	return n
+}
+
+// Grade runs the learner's code against each test case, every run in a
+// fresh session. A case passes when its output shows the text the case
+// expects, holds the same objects the exercise's solution writes for it,
+// and leaves the environment meeting the exercise's checks. An exercise
+// without test cases is graded on what the code itself does, against the
+// solution, unless the code is the solution written differently: with
+// aliases, abbreviated or reordered parameters, or other casing and
+// spacing. An exercise that isn't Gradable passes no code.
+func (e Exercise) Grade(code string) GradeResult {
+	if !e.Gradable() {
+		return GradeResult{Ungradable: true}
+	}
+	cases := e.TestCases
+	if len(cases) == 0 {
+		cases = []TestCase{{}}
+	}
+	var grade GradeResult
+	for _, tc := range cases {
+		grade.Cases = append(grade.Cases, e.gradeCase(code, tc))
+	}
+	// Only code that passed sees the solution, which it would otherwise give away
+	if grade.Passed() && e.Solution != "" && !psim.Identical(code, e.Solution) {
+		grade.Preferred = strings.TrimRight(e.Solution, "\n")
+	}
+	return grade
+}
+
+// Gradable reports whether the exercise has something to hold code to:
+// test cases, checks, or a solution that writes output to compare against.
+// Without any of them every piece of code, even none, would pass.
+func (e Exercise) Gradable() bool {
+	if len(e.TestCases) > 0 || len(e.Checks) > 0 {
+		return true
+	}
+	if e.Solution == "" {
+		return false
+	}
+	want, err := e.RunTestCase(e.Solution, TestCase{})
+	if err != nil {
+		// Grading reports the session that couldn't be set up
+		return true
+	}
+	return outputText(want) != ""
+}
+
+func (e Exercise) gradeCase(code string, tc TestCase) CaseResult {
+	got, checks, err := e.runCase(code, tc, true)
+	if err != nil {
+		return CaseResult{Input: tc.Input, Expected: tc.Expected, Err: err}
+	}
+	result := CaseResult{Input: tc.Input, Actual: outputText(got), Expected: tc.Expected, Checks: checks}
+	if tc.Expected != "" {
+		result.Diff = diffLines(normalizeText(tc.Expected), result.Actual)
+	}
+	if len(e.TestCases) == 0 && e.Solution != "" && psim.Equivalent(e.Solution, code) {
+		result.Equivalent = true
+	} else if e.Solution != "" {
+		want, err := e.RunTestCase(e.Solution, tc)
+		if err != nil {
+			return CaseResult{Input: tc.Input, Expected: tc.Expected, Err: err}
+		}
+		if tc.Expected == "" {
+			result.Expected = outputText(want)
+		}
+		for _, d := range psim.CompareOutput(want.Output, got.Output) {
+			result.Diff = append(result.Diff, d.String())
+		}
+		// Errors the solution doesn't make fail the case, even when the output matches
+		if !want.HasErrors() {
+			for _, err := range got.Errors() {
+				result.Diff = append(result.Diff, "error: "+firstLine(err.Error()))
+			}
+		}
+	}
+	result.Passed = len(result.Diff) == 0
+	for _, c := range checks {
+		result.Passed = result.Passed && c.Passed
+	}
+	return result
+}
+
+// outputText is the console text of a run, without trailing blanks
+func outputText(r *psim.Result) string {
+	var parts []string
+	for _, seg := range r.Segments() {
+		parts = append(parts, seg.Text)
+	}
+	return normalizeText(strings.Join(parts, "\n"))
+}
+
+// normalizeText drops trailing spaces and blank lines at either end, which
+// table layout adds but nobody reads
+func normalizeText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// diffLines compares two texts line by line, returning "-" lines for what
+// want has and got lacks and "+" lines for the reverse; nil when they match
+func diffLines(want, got string) []string {
+	if want == got {
+		return nil
+	}
+	a, b := strings.Split(want, "\n"), strings.Split(got, "\n")
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	return diff
+}
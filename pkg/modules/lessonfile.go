@@ -0,0 +1,439 @@
+package modules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/psim"
+)
+
+// A lesson file is Markdown with front matter. The body up to a
+// "## Exercise" heading is the lesson's content; the rest describes its
+// exercise. The exercise section opens with the instructions, followed by
+// any of these sub-sections:
+//
+//	### Starter code   a powershell code block the editor starts with
+//	### Solution       a powershell code block
+//	### Hints          a list, revealed in order
+//	### Test cases     pairs of a powershell block and an output block
+//	### Processes      a table of Name, Id, CPU and other process columns
+//	### Services       a table of Name, DisplayName, Status and StartType
+//	### Checks         a table of Description, Query, Property, Value and Match
+//
+// A code block keeps its text exactly, so a blank line before the closing
+// fence ends the code with a newline.
+
+// exerciseHeading starts a lesson's exercise section
+const exerciseHeading = "## Exercise"
+
+// parseLesson reads a lesson file. Metadata the front matter leaves out
+// comes from the module.
+func parseLesson(text string, module Module) (Lesson, error) {
+	fields, body, err := splitFrontMatter(text)
+	if err != nil {
+		return Lesson{}, err
+	}
+	lesson := Lesson{
+		ID:          fields["id"],
+		Title:       fields["title"],
+		Description: fields["description"],
+		Difficulty:  fields["difficulty"],
+	}
+	if lesson.ID == "" {
+		return Lesson{}, fmt.Errorf("front matter has no id")
+	}
+	if lesson.Difficulty == "" {
+		lesson.Difficulty = module.Difficulty
+	}
+	if d := fields["duration"]; d != "" {
+		if lesson.Duration, err = time.ParseDuration(d); err != nil {
+			return Lesson{}, fmt.Errorf("duration: %v", err)
+		}
+	}
+
+	lines := strings.Split(body, "\n")
+	start := len(lines)
+	for i, fenced := range fencedLines(lines) {
+		if !fenced && strings.TrimSpace(lines[i]) == exerciseHeading {
+			start = i
+			break
+		}
+	}
+	lesson.Content = strings.TrimSpace(strings.Join(lines[:start], "\n"))
+	if start < len(lines) {
+		exercise, err := parseExercise(lines[start+1:])
+		if err != nil {
+			return Lesson{}, fmt.Errorf("exercise: %v", err)
+		}
+		exercise.ID = "ex-" + lesson.ID
+		lesson.Exercise = exercise
+	}
+	return lesson, nil
+}
+
+// parseExercise reads the lines of an exercise section after its heading
+func parseExercise(lines []string) (Exercise, error) {
+	var exercise Exercise
+	sections := splitSections(lines)
+	exercise.Instructions = paragraphs(sections[0].lines)
+	for _, s := range sections[1:] {
+		switch strings.ToLower(s.title) {
+		case "starter code":
+			blocks := codeBlocks(s.lines)
+			if len(blocks) != 1 {
+				return exercise, fmt.Errorf("%s: expected one code block, found %d", s.title, len(blocks))
+			}
+			exercise.StarterCode = blocks[0]
+		case "solution":
+			blocks := codeBlocks(s.lines)
+			if len(blocks) != 1 {
+				return exercise, fmt.Errorf("%s: expected one code block, found %d", s.title, len(blocks))
+			}
+			exercise.Solution = blocks[0]
+		case "hints":
+			exercise.Hints = listItems(s.lines)
+		case "test cases":
+			blocks := codeBlocks(s.lines)
+			if len(blocks)%2 != 0 {
+				return exercise, fmt.Errorf("%s: each input block needs an output block after it", s.title)
+			}
+			for i := 0; i < len(blocks); i += 2 {
+				exercise.TestCases = append(exercise.TestCases, TestCase{Input: blocks[i], Expected: blocks[i+1]})
+			}
+		case "processes":
+			rows, err := tableRows(s.lines)
+			if err != nil {
+				return exercise, fmt.Errorf("%s: %v", s.title, err)
+			}
+			for _, row := range rows {
+				p, err := parseProcess(row)
+				if err != nil {
+					return exercise, fmt.Errorf("%s: %v", s.title, err)
+				}
+				exercise.Processes = append(exercise.Processes, p)
+			}
+		case "services":
+			rows, err := tableRows(s.lines)
+			if err != nil {
+				return exercise, fmt.Errorf("%s: %v", s.title, err)
+			}
+			for _, row := range rows {
+				svc, err := parseService(row)
+				if err != nil {
+					return exercise, fmt.Errorf("%s: %v", s.title, err)
+				}
+				exercise.Services = append(exercise.Services, svc)
+			}
+		case "checks":
+			rows, err := tableRows(s.lines)
+			if err != nil {
+				return exercise, fmt.Errorf("%s: %v", s.title, err)
+			}
+			for _, row := range rows {
+				c, err := parseCheck(row)
+				if err != nil {
+					return exercise, fmt.Errorf("%s: %v", s.title, err)
+				}
+				exercise.Checks = append(exercise.Checks, c)
+			}
+		default:
+			return exercise, fmt.Errorf("unknown section %q", s.title)
+		}
+	}
+	return exercise, nil
+}
+
+// section is a run of lines under a ### heading; the first has no title
+type section struct {
+	title string
+	lines []string
+}
+
+func splitSections(lines []string) []section {
+	sections := []section{{}}
+	for i, fenced := range fencedLines(lines) {
+		if title, ok := strings.CutPrefix(lines[i], "### "); ok && !fenced {
+			sections = append(sections, section{title: strings.TrimSpace(title)})
+			continue
+		}
+		s := &sections[len(sections)-1]
+		s.lines = append(s.lines, lines[i])
+	}
+	return sections
+}
+
+// fencedLines reports for each line whether it belongs to a fenced code
+// block, fences included
+func fencedLines(lines []string) []bool {
+	fenced := make([]bool, len(lines))
+	fence := ""
+	for i, line := range lines {
+		switch {
+		case fence != "":
+			fenced[i] = true
+			if closesFence(line, fence) {
+				fence = ""
+			}
+		default:
+			fence, _, fenced[i] = openingFence(line)
+		}
+	}
+	return fenced
+}
+
+// openingFence returns the fence a line opens a code block with and the
+// info string, such as the language, after it
+func openingFence(line string) (fence, info string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	for _, c := range []string{"`", "~"} {
+		if n := len(trimmed) - len(strings.TrimLeft(trimmed, c)); n >= 3 {
+			return trimmed[:n], strings.TrimSpace(trimmed[n:]), true
+		}
+	}
+	return "", "", false
+}
+
+// closesFence reports whether a line closes a block opened with fence
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// codeBlocks returns the text of each fenced code block
+func codeBlocks(lines []string) []string {
+	var blocks []string
+	var body []string
+	fence := ""
+	for _, line := range lines {
+		switch {
+		case fence == "":
+			var ok bool
+			if fence, _, ok = openingFence(line); ok {
+				body = nil
+			}
+		case closesFence(line, fence):
+			blocks = append(blocks, strings.Join(body, "\n"))
+			fence = ""
+		default:
+			body = append(body, line)
+		}
+	}
+	return blocks
+}
+
+// paragraphs joins the soft-wrapped lines of each paragraph, keeping the
+// blank lines between paragraphs
+func paragraphs(lines []string) string {
+	var paras []string
+	var current []string
+	for _, line := range append(lines, "") {
+		if line = strings.TrimSpace(line); line != "" {
+			current = append(current, line)
+			continue
+		}
+		if len(current) > 0 {
+			paras = append(paras, strings.Join(current, " "))
+			current = nil
+		}
+	}
+	return strings.Join(paras, "\n\n")
+}
+
+// listItems returns the items of a bulleted or numbered list, joining
+// lines that continue an item
+func listItems(lines []string) []string {
+	var items []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if item, ok := listItem(line); ok {
+			items = append(items, item)
+		} else if len(items) > 0 {
+			items[len(items)-1] += " " + line
+		}
+	}
+	return items
+}
+
+func listItem(line string) (string, bool) {
+	for _, bullet := range []string{"- ", "* ", "+ "} {
+		if item, ok := strings.CutPrefix(line, bullet); ok {
+			return strings.TrimSpace(item), true
+		}
+	}
+	if n, item, ok := strings.Cut(line, ". "); ok {
+		if _, err := strconv.Atoi(n); err == nil {
+			return strings.TrimSpace(item), true
+		}
+	}
+	return "", false
+}
+
+// tableRows reads a Markdown table into one map per row keyed by the
+// lower-case column header. \| writes a pipe inside a cell.
+func tableRows(lines []string) ([]map[string]string, error) {
+	var header []string
+	var rows []map[string]string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		cells := tableCells(line)
+		switch {
+		case header == nil:
+			for _, c := range cells {
+				header = append(header, strings.ToLower(c))
+			}
+		case strings.Trim(line, "|-: ") == "":
+			// the delimiter row under the header
+		default:
+			if len(cells) > len(header) {
+				return nil, fmt.Errorf("row %q has more cells than the header", line)
+			}
+			row := map[string]string{}
+			for i, c := range cells {
+				row[header[i]] = c
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func tableCells(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseProcess reads a row of a Processes table
+func parseProcess(row map[string]string) (psim.Process, error) {
+	var p psim.Process
+	for column, value := range row {
+		if value == "" {
+			continue
+		}
+		var err error
+		switch column {
+		case "name":
+			p.Name = value
+		case "id":
+			p.Id, err = strconv.Atoi(value)
+		case "cpu":
+			p.CPU, err = strconv.ParseFloat(value, 64)
+		case "workingset":
+			p.WorkingSet, err = strconv.Atoi(value)
+		case "privatememory":
+			p.PrivateMemory, err = strconv.Atoi(value)
+		case "handles":
+			p.Handles, err = strconv.Atoi(value)
+		case "sessionid":
+			p.SessionId, err = strconv.Atoi(value)
+		case "path":
+			p.Path = value
+		case "company":
+			p.Company = value
+		case "description":
+			p.Description = value
+		default:
+			return p, fmt.Errorf("unknown process column %q", column)
+		}
+		if err != nil {
+			return p, fmt.Errorf("%s %q: %v", column, value, err)
+		}
+	}
+	return p, nil
+}
+
+// parseService reads a row of a Services table
+func parseService(row map[string]string) (psim.Service, error) {
+	var s psim.Service
+	for column, value := range row {
+		if value == "" {
+			continue
+		}
+		switch column {
+		case "name":
+			s.Name = value
+		case "displayname":
+			s.DisplayName = value
+		case "status":
+			if !strings.EqualFold(value, "Running") && !strings.EqualFold(value, "Stopped") {
+				return s, fmt.Errorf("status %q: expected Running or Stopped", value)
+			}
+			s.Status = strings.ToUpper(value[:1]) + strings.ToLower(value[1:])
+		case "starttype":
+			switch strings.ToLower(value) {
+			case "automatic":
+				s.StartType = "Automatic"
+			case "manual":
+				s.StartType = "Manual"
+			case "disabled":
+				s.StartType = "Disabled"
+			default:
+				return s, fmt.Errorf("starttype %q: expected Automatic, Manual or Disabled", value)
+			}
+		default:
+			return s, fmt.Errorf("unknown service column %q", column)
+		}
+	}
+	if s.Name == "" {
+		return s, fmt.Errorf("service has no name")
+	}
+	return s, nil
+}
+
+// parseCheck reads a row of a Checks table. $true and $false are booleans
+// and whole numbers are integers; any other value is a string.
+func parseCheck(row map[string]string) (Check, error) {
+	c := Check{
+		Description: row["description"],
+		Query:       row["query"],
+		Property:    row["property"],
+	}
+	if c.Query == "" {
+		return c, fmt.Errorf("check %q has no query", c.Description)
+	}
+	value := row["value"]
+	switch n, err := strconv.Atoi(value); {
+	case strings.EqualFold(value, "$true"):
+		c.Value = true
+	case strings.EqualFold(value, "$false"):
+		c.Value = false
+	case err == nil:
+		c.Value = n
+	default:
+		c.Value = value
+	}
+	switch strings.ToLower(row["match"]) {
+	case "", "all":
+		c.Match = MatchAll
+	case "any":
+		c.Match = MatchAny
+	case "none":
+		c.Match = MatchNone
+	case "count":
+		c.Match = MatchCount
+	default:
+		return c, fmt.Errorf("check %q: unknown match %q", c.Description, row["match"])
+	}
+	return c, nil
+}
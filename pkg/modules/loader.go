@@ -0,0 +1,226 @@
+package modules
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/psim"
+)
+
+// Lessons are written in Markdown rather than Go so that anyone who knows
+// the subject can write them. A content tree has a directory per module
+// holding:
+//
+//	module.yaml        the module's id, title, description, category,
+//	                   difficulty, duration, icon and order
+//	lesson-<n>.md      the lessons in order of n, each a lesson file as
+//	                   parseLesson describes
+//	fixtures/<lesson>/ sample files seeded into the lesson's exercise
+//
+// The tree under content/ is built into the binary. UseContentDir swaps in
+// a tree on disk, so authors can see their changes without a rebuild.
+//
+//go:embed all:content
+var embeddedContent embed.FS
+
+var (
+	libraryMu sync.RWMutex
+	library   []Module
+)
+
+// Load reads the modules of a content tree, ordered by their order field
+func Load(fsys fs.FS) ([]Module, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var modules []Module
+	order := map[string]int{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		module, n, err := loadModule(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		order[module.ID] = n
+		modules = append(modules, module)
+	}
+	sort.SliceStable(modules, func(i, j int) bool {
+		return order[modules[i].ID] < order[modules[j].ID]
+	})
+	return modules, nil
+}
+
+// loadModule reads one module directory and returns the module with its order
+func loadModule(fsys fs.FS, dir string) (Module, int, error) {
+	data, err := fs.ReadFile(fsys, path.Join(dir, "module.yaml"))
+	if err != nil {
+		return Module{}, 0, err
+	}
+	fields, err := parseFields(string(data))
+	if err != nil {
+		return Module{}, 0, fmt.Errorf("module.yaml: %w", err)
+	}
+	module := Module{
+		ID:          fields["id"],
+		Title:       fields["title"],
+		Description: fields["description"],
+		Category:    fields["category"],
+		Difficulty:  fields["difficulty"],
+		Icon:        fields["icon"],
+	}
+	if module.ID == "" {
+		module.ID = dir
+	}
+	if d := fields["duration"]; d != "" {
+		if module.Duration, err = time.ParseDuration(d); err != nil {
+			return Module{}, 0, fmt.Errorf("module.yaml: duration: %w", err)
+		}
+	}
+	order := 0
+	if o := fields["order"]; o != "" {
+		if order, err = strconv.Atoi(o); err != nil {
+			return Module{}, 0, fmt.Errorf("module.yaml: order: %w", err)
+		}
+	}
+
+	files, err := fs.Glob(fsys, path.Join(dir, "lesson-*.md"))
+	if err != nil {
+		return Module{}, 0, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return lessonNumber(files[i]) < lessonNumber(files[j])
+	})
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return Module{}, 0, err
+		}
+		lesson, err := parseLesson(string(data), module)
+		if err != nil {
+			return Module{}, 0, fmt.Errorf("%s: %w", path.Base(file), err)
+		}
+		if lesson.Exercise.ID != "" {
+			// Fixture files come first so an exercise's own Files can override them
+			if fixtures := lessonFixtures(fsys, path.Join(dir, "fixtures", lesson.ID)); fixtures != nil {
+				for p, text := range lesson.Exercise.Files {
+					fixtures[p] = text
+				}
+				lesson.Exercise.Files = fixtures
+			}
+			// A fixture that can't be laid out would leave the exercise unsolvable
+			if err := psim.NewFileSystem().Seed(lesson.Exercise.Files); err != nil {
+				return Module{}, 0, fmt.Errorf("%s: fixtures: %w", path.Base(file), err)
+			}
+			if !lesson.Exercise.Gradable() {
+				return Module{}, 0, fmt.Errorf("%s: exercise: no test cases, checks or solution output to grade code against", path.Base(file))
+			}
+		}
+		module.Lessons = append(module.Lessons, lesson)
+	}
+	if len(module.Lessons) == 0 {
+		return Module{}, 0, fmt.Errorf("no lesson-*.md files")
+	}
+	return module, order, nil
+}
+
+// lessonNumber is the n of a lesson-<n>.md file, so lesson-10 follows lesson-9
+func lessonNumber(file string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path.Base(file), "lesson-"), ".md"))
+	return n
+}
+
+// UseContentDir loads the modules from a content tree on disk in place of
+// the built-in one
+func UseContentDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	modules, err := Load(os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+	libraryMu.Lock()
+	library = modules
+	libraryMu.Unlock()
+	return nil
+}
+
+// loadedModules returns the modules in use, loading the built-in ones
+// the first time
+func loadedModules() []Module {
+	libraryMu.RLock()
+	modules := library
+	libraryMu.RUnlock()
+	if modules != nil {
+		return modules
+	}
+
+	libraryMu.Lock()
+	defer libraryMu.Unlock()
+	if library == nil {
+		content, err := fs.Sub(embeddedContent, "content")
+		if err == nil {
+			library, err = Load(content)
+		}
+		if err != nil {
+			panic("modules: built-in content: " + err.Error())
+		}
+	}
+	return library
+}
+
+// GetAvailableModules returns all available learning modules
+func GetAvailableModules() []Module {
+	modules := append([]Module(nil), loadedModules()...)
+	for i := range modules {
+		modules[i].Lessons = append([]Lesson(nil), modules[i].Lessons...)
+	}
+	return modules
+}
+
+// findLesson returns a lesson of the loaded modules
+func findLesson(moduleID, lessonID string) (Lesson, bool) {
+	for _, m := range loadedModules() {
+		if m.ID != moduleID {
+			continue
+		}
+		for _, l := range m.Lessons {
+			if l.ID == lessonID {
+				return l, true
+			}
+		}
+	}
+	return Lesson{}, false
+}
+
+// GetLessonContent returns detailed content for a specific lesson
+func GetLessonContent(moduleID, lessonID string) string {
+	if lesson, ok := findLesson(moduleID, lessonID); ok && lesson.Content != "" {
+		return lesson.Content
+	}
+	return "Lesson content not available yet."
+}
+
+// GetExerciseForLesson returns an exercise for a specific lesson
+func GetExerciseForLesson(moduleID, lessonID string) Exercise {
+	if lesson, ok := findLesson(moduleID, lessonID); ok && lesson.Exercise.ID != "" {
+		return lesson.Exercise
+	}
+	return Exercise{
+		ID:           "default",
+		Instructions: "Practice what you've learned by experimenting with the commands shown in this lesson.",
+		StarterCode:  "# Type your PowerShell commands here\n",
+		Hints:        []string{"Review the lesson content", "Try the example commands"},
+	}
+}
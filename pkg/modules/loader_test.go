@@ -0,0 +1,73 @@
+package modules
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// TestBuiltinContent loads the lessons built into the binary, which
+// loadedModules would otherwise only find broken the first time they are
+// used, and holds every exercise to its own solution and starter code
+func TestBuiltinContent(t *testing.T) {
+	content, err := fs.Sub(embeddedContent, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules, err := Load(content)
+	if err != nil {
+		t.Fatalf("built-in content: %v", err)
+	}
+	if len(modules) == 0 {
+		t.Fatal("built-in content has no modules")
+	}
+	for _, m := range modules {
+		for _, l := range m.Lessons {
+			e := l.Exercise
+			if e.ID == "" {
+				continue
+			}
+			t.Run(m.ID+"/"+l.ID, func(t *testing.T) {
+				if e.Solution != "" {
+					if grade := e.Grade(e.Solution); !grade.Passed() {
+						t.Errorf("solution doesn't pass: %s%s", grade.Summary(), failures(grade))
+					}
+				}
+				if grade := e.Grade(e.StarterCode); grade.Passed() {
+					t.Errorf("starter code passes: %s", grade.Summary())
+				}
+			})
+		}
+	}
+}
+
+// failures lists why the cases of a grade failed
+func failures(grade GradeResult) string {
+	var s string
+	for _, c := range grade.Cases {
+		if c.Passed {
+			continue
+		}
+		if c.Err != nil {
+			s += "\n  " + c.Err.Error()
+		}
+		for _, line := range c.Diff {
+			s += "\n  " + line
+		}
+		for _, check := range c.Checks {
+			if !check.Passed {
+				s += "\n  check: " + check.Description + ": " + check.Message
+			}
+		}
+	}
+	return s
+}
+
+func TestLoadModuleWithoutLessons(t *testing.T) {
+	fsys := fstest.MapFS{
+		"empty/module.yaml": {Data: []byte("id: empty\ntitle: Empty\n")},
+	}
+	if _, err := Load(fsys); err == nil {
+		t.Fatal("a module without lessons loaded")
+	}
+}
@@ -0,0 +1,61 @@
+package modules
+
+import (
+	"fmt"
+
+	"github.com/couragetogroww/powerhell/pkg/psim"
+)
+
+// NewRunspace creates a fresh simulated PowerShell session holding the
+// exercise's fixtures. Every call builds its own file system, process and
+// service tables, so one learner's changes never leak into another run. It fails
+// when the fixture files can't be laid out, as the exercise couldn't be
+// solved without them.
+func (e Exercise) NewRunspace() (*psim.Runspace, error) {
+	rs := psim.NewRunspace()
+	if e.Processes != nil {
+		rs.SetProcesses(psim.NewProcessTable(e.Processes...))
+	}
+	if e.Services != nil {
+		rs.SetServices(psim.NewServiceTable(e.Services...))
+	}
+	if e.Files != nil {
+		fs := psim.NewFileSystem()
+		if err := fs.Seed(e.Files); err != nil {
+			rs.Close()
+			return nil, fmt.Errorf("exercise %s: fixture files: %w", e.ID, err)
+		}
+		rs.SetFileSystem(fs)
+	}
+	return rs, nil
+}
+
+// RunTestCase runs the learner's code in a fresh session and then the test
+// case's input in the same session, so the input can call the functions
+// the code defines. The result holds what the input wrote, or what the
+// code wrote when the case has no input.
+func (e Exercise) RunTestCase(code string, tc TestCase) (*psim.Result, error) {
+	result, _, err := e.runCase(code, tc, false)
+	return result, err
+}
+
+// runCase runs a test case like RunTestCase and, when asked, the
+// exercise's checks against the state the run left behind
+func (e Exercise) runCase(code string, tc TestCase, check bool) (*psim.Result, []CheckResult, error) {
+	rs, err := e.NewRunspace()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rs.Close()
+	result := rs.Run(code)
+	if tc.Input != "" {
+		result = rs.Run(tc.Input)
+	}
+	var checks []CheckResult
+	if check {
+		for _, c := range e.Checks {
+			checks = append(checks, c.run(rs))
+		}
+	}
+	return result, checks, nil
+}
@@ -2,6 +2,8 @@ package modules
 
 import (
 	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/psim"
 )
 
 // Module represents a learning module
@@ -28,6 +30,7 @@ type Lesson struct {
 	Exercise    Exercise
 	IsCompleted bool
 	Duration    time.Duration
+	Difficulty  string
 }
 
 // GetContent returns the full content for this lesson
@@ -54,6 +57,10 @@ type Exercise struct {
 	Solution     string
 	Hints        []string
 	TestCases    []TestCase
+	Processes    []psim.Process    // processes running when the code executes; nil uses the sample table
+	Services     []psim.Service    // services installed when the code executes; nil uses the sample table
+	Files        map[string]string // files seeded into C:\ keyed by full path; a trailing backslash makes an empty directory
+	Checks       []Check           // conditions the environment must meet after the code runs
 }
 
 // TestCase represents a test case for an exercise
@@ -94,139 +101,6 @@ type ModuleCategory struct {
 	Modules     []Module
 }
 
-// GetAvailableModules returns all available learning modules
-func GetAvailableModules() []Module {
-	return []Module{
-		{
-			ID:          "basics",
-			Title:       "PowerShell Basics",
-			Description: "Learn the fundamentals of PowerShell scripting",
-			Category:    "Foundation",
-			Duration:    2 * time.Hour,
-			Difficulty:  "Beginner",
-			Icon:        "📚",
-			Lessons: []Lesson{
-				{
-					ID:          "basics-1",
-					Title:       "Introduction to PowerShell",
-					Description: "Understanding what PowerShell is and why it's powerful",
-					Duration:    15 * time.Minute,
-				},
-				{
-					ID:          "basics-2",
-					Title:       "Variables and Data Types",
-					Description: "Working with variables, strings, numbers, and arrays",
-					Duration:    20 * time.Minute,
-				},
-				{
-					ID:          "basics-3",
-					Title:       "Basic Cmdlets",
-					Description: "Essential PowerShell commands you need to know",
-					Duration:    25 * time.Minute,
-				},
-			},
-		},
-		{
-			ID:          "active-directory",
-			Title:       "Active Directory Management",
-			Description: "Master AD administration with PowerShell",
-			Category:    "On-Premise",
-			Duration:    3 * time.Hour,
-			Difficulty:  "Intermediate",
-			Icon:        "🏢",
-			Lessons: []Lesson{
-				{
-					ID:          "ad-1",
-					Title:       "AD Module Overview",
-					Description: "Introduction to the Active Directory PowerShell module",
-					Duration:    20 * time.Minute,
-				},
-				{
-					ID:          "ad-2",
-					Title:       "User Management",
-					Description: "Creating, modifying, and managing AD users",
-					Duration:    30 * time.Minute,
-				},
-				{
-					ID:          "ad-3",
-					Title:       "Group Management",
-					Description: "Working with AD groups and memberships",
-					Duration:    25 * time.Minute,
-				},
-			},
-		},
-		{
-			ID:          "msgraph",
-			Title:       "Microsoft Graph PowerShell",
-			Description: "Modern cloud management with MS Graph",
-			Category:    "Cloud",
-			Duration:    4 * time.Hour,
-			Difficulty:  "Advanced",
-			Icon:        "☁️",
-			Lessons: []Lesson{
-				{
-					ID:          "graph-1",
-					Title:       "Graph API Fundamentals",
-					Description: "Understanding Microsoft Graph and authentication",
-					Duration:    30 * time.Minute,
-				},
-				{
-					ID:          "graph-2",
-					Title:       "User and Group Management",
-					Description: "Managing Azure AD/Entra ID resources",
-					Duration:    35 * time.Minute,
-				},
-			},
-		},
-		{
-			ID:          "scripting",
-			Title:       "Advanced Scripting",
-			Description: "Build robust PowerShell scripts and tools",
-			Category:    "Advanced",
-			Duration:    5 * time.Hour,
-			Difficulty:  "Advanced",
-			Icon:        "🚀",
-			Lessons: []Lesson{
-				{
-					ID:          "script-1",
-					Title:       "Functions and Modules",
-					Description: "Creating reusable PowerShell code",
-					Duration:    40 * time.Minute,
-				},
-				{
-					ID:          "script-2",
-					Title:       "Error Handling",
-					Description: "Implementing robust error handling",
-					Duration:    30 * time.Minute,
-				},
-			},
-		},
-		{
-			ID:          "automation",
-			Title:       "Automation & DevOps",
-			Description: "Automate everything with PowerShell",
-			Category:    "DevOps",
-			Duration:    4 * time.Hour,
-			Difficulty:  "Intermediate",
-			Icon:        "⚙️",
-			Lessons: []Lesson{
-				{
-					ID:          "auto-1",
-					Title:       "Scheduled Tasks",
-					Description: "Automating scripts with Task Scheduler",
-					Duration:    25 * time.Minute,
-				},
-				{
-					ID:          "auto-2",
-					Title:       "CI/CD Pipelines",
-					Description: "PowerShell in modern DevOps workflows",
-					Duration:    35 * time.Minute,
-				},
-			},
-		},
-	}
-}
-
 // GetCategories returns all module categories
 func GetCategories() []ModuleCategory {
 	modules := GetAvailableModules()
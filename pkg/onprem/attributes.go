@@ -0,0 +1,83 @@
+package onprem
+
+import "strings"
+
+// ldapNames maps LDAP display names to the property names the AD cmdlets use
+var ldapNames = map[string]string{
+	"cn":                         "Name",
+	"ou":                         "Name",
+	"sn":                         "Surname",
+	"mail":                       "EmailAddress",
+	"l":                          "City",
+	"st":                         "State",
+	"c":                          "Country",
+	"physicaldeliveryofficename": "Office",
+	"telephonenumber":            "OfficePhone",
+	"mobile":                     "MobilePhone",
+	"objectsid":                  "SID",
+	"member":                     "Members",
+	"whencreated":                "Created",
+	"whenchanged":                "Modified",
+	"pwdlastset":                 "PasswordLastSet",
+	"lockouttime":                "LockedOut",
+	"employeeid":                 "EmployeeID",
+	"streetaddress":              "StreetAddress",
+	"postalcode":                 "PostalCode",
+	"useraccountcontrol":         "userAccountControl",
+}
+
+// knownProperties lists the canonical spelling of every property the simulator models
+var knownProperties = []string{
+	"CanonicalName", "ChangePasswordAtLogon", "City", "Company", "Country", "Created",
+	"Department", "Description", "DisplayName", "DistinguishedName", "EmailAddress",
+	"EmployeeID", "Enabled", "GivenName", "GroupCategory", "GroupScope", "LockedOut",
+	"ManagedBy", "Manager", "MemberOf", "Members", "MobilePhone", "Modified", "Name",
+	"ObjectClass", "ObjectGUID", "Office", "OfficePhone", "PasswordLastSet",
+	"PasswordNeverExpires", "PostalCode", "ProtectedFromAccidentalDeletion",
+	"SamAccountName", "SID", "State", "StreetAddress", "Surname", "Title",
+	"UserPrincipalName", "userAccountControl",
+}
+
+// CanonicalName returns the property name the simulator stores for an AD
+// cmdlet property or LDAP attribute, matched case-insensitively
+func CanonicalName(name string) string {
+	lower := strings.ToLower(name)
+	if canonical, ok := ldapNames[lower]; ok {
+		return canonical
+	}
+	for _, p := range knownProperties {
+		if strings.ToLower(p) == lower {
+			return p
+		}
+	}
+	return name
+}
+
+// DefaultProperties returns the properties the Get-AD* cmdlets return for a
+// class when -Properties is not given
+func DefaultProperties(class string) []string {
+	switch class {
+	case ClassUser:
+		return []string{"DistinguishedName", "Enabled", "GivenName", "Name", "ObjectClass", "ObjectGUID", "SamAccountName", "SID", "Surname", "UserPrincipalName"}
+	case ClassGroup:
+		return []string{"DistinguishedName", "GroupCategory", "GroupScope", "Name", "ObjectClass", "ObjectGUID", "SamAccountName", "SID"}
+	case ClassOU:
+		return []string{"City", "Country", "DistinguishedName", "ManagedBy", "Name", "ObjectClass", "ObjectGUID", "PostalCode", "State", "StreetAddress"}
+	}
+	return []string{"DistinguishedName", "Name", "ObjectClass", "ObjectGUID"}
+}
+
+// ExtendedProperties returns everything -Properties * shows for a class
+func ExtendedProperties(class string) []string {
+	common := []string{"CanonicalName", "Created", "Description", "DisplayName", "Modified", "ProtectedFromAccidentalDeletion"}
+	switch class {
+	case ClassUser:
+		return append(common, "ChangePasswordAtLogon", "City", "Company", "Country", "Department",
+			"EmailAddress", "EmployeeID", "LockedOut", "Manager", "MemberOf", "MobilePhone",
+			"Office", "OfficePhone", "PasswordLastSet", "PasswordNeverExpires", "PostalCode",
+			"State", "StreetAddress", "Title", "userAccountControl")
+	case ClassGroup:
+		return append(common, "ManagedBy", "MemberOf", "Members")
+	}
+	return common
+}
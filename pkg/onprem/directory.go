@@ -0,0 +1,700 @@
+package onprem
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Object classes of directory entries
+const (
+	ClassDomain    = "domainDNS"
+	ClassContainer = "container"
+	ClassOU        = "organizationalUnit"
+	ClassUser      = "user"
+	ClassGroup     = "group"
+)
+
+// Well-known relative identifiers
+const (
+	ridAdministrator = 500
+	ridGuest         = 501
+	ridDomainAdmins  = 512
+	ridDomainUsers   = 513
+	firstUserRID     = 1103
+)
+
+// fixtureTime is when seeded objects were created, so listings are reproducible
+var fixtureTime = time.Date(2023, time.September, 12, 8, 0, 0, 0, time.UTC)
+
+// Directory is an in-memory Active Directory domain
+type Directory struct {
+	Domain  string // DNS name, e.g. contoso.com
+	NetBIOS string // pre-Windows 2000 name, e.g. CONTOSO
+
+	objects   []*Object // in creation order, the order searches return them
+	domainSID string
+	nextRID   int
+	guidSeq   int
+	clock     func() time.Time
+}
+
+// Object is one directory entry: the domain, a container, an OU, a user or a group
+type Object struct {
+	DistinguishedName string
+	ObjectClass       string
+	ObjectGUID        string
+	SID               string // empty for objects that are not security principals
+
+	attrs    map[string]interface{} // keyed by canonical property name
+	password string
+	dir      *Directory
+}
+
+// NewDirectory creates a domain holding the default containers, the
+// Administrator and Guest accounts and the Domain Admins and Domain Users groups
+func NewDirectory(domain string) *Directory {
+	d := &Directory{
+		Domain:  strings.ToLower(domain),
+		NetBIOS: strings.ToUpper(strings.SplitN(domain, ".", 2)[0]),
+		nextRID: firstUserRID,
+		clock:   time.Now,
+	}
+	rng := rand.New(rand.NewSource(d.hash(0)))
+	d.domainSID = fmt.Sprintf("S-1-5-21-%d-%d-%d", 1000000000+rng.Intn(999999999), 1000000000+rng.Intn(999999999), 1000000000+rng.Intn(999999999))
+
+	root := d.newObject(ClassDomain, domainDN(d.Domain), fixtureTime)
+	root.attrs["Name"] = d.NetBIOS
+	d.objects = append(d.objects, root)
+	for _, cn := range []string{"Builtin", "Computers", "Users"} {
+		c := d.newObject(ClassContainer, "CN="+cn+","+root.DistinguishedName, fixtureTime)
+		c.attrs["Name"] = cn
+		d.objects = append(d.objects, c)
+	}
+	dc := d.newObject(ClassOU, "OU=Domain Controllers,"+root.DistinguishedName, fixtureTime)
+	dc.attrs["Name"] = "Domain Controllers"
+	dc.attrs["ProtectedFromAccidentalDeletion"] = true
+	d.objects = append(d.objects, dc)
+
+	users := d.UsersContainer()
+	d.addWellKnown(ClassUser, "Administrator", users, ridAdministrator, map[string]interface{}{
+		"Description": "Built-in account for administering the computer/domain",
+		"Enabled":     true,
+	})
+	d.addWellKnown(ClassUser, "Guest", users, ridGuest, map[string]interface{}{
+		"Description": "Built-in account for guest access to the computer/domain",
+		"Enabled":     false,
+	})
+	d.addWellKnown(ClassGroup, "Domain Admins", users, ridDomainAdmins, map[string]interface{}{
+		"Description":   "Designated administrators of the domain",
+		"GroupCategory": "Security",
+		"GroupScope":    "Global",
+		"Members":       []string{"CN=Administrator," + users},
+	})
+	d.addWellKnown(ClassGroup, "Domain Users", users, ridDomainUsers, map[string]interface{}{
+		"Description":   "All domain users",
+		"GroupCategory": "Security",
+		"GroupScope":    "Global",
+	})
+	return d
+}
+
+func (d *Directory) addWellKnown(class, name, parent string, rid int, attrs map[string]interface{}) {
+	o := d.newObject(class, "CN="+escapeRDN(name)+","+parent, fixtureTime)
+	o.SID = fmt.Sprintf("%s-%d", d.domainSID, rid)
+	o.attrs["Name"] = name
+	o.attrs["SamAccountName"] = name
+	for k, v := range attrs {
+		o.attrs[k] = v
+	}
+	d.objects = append(d.objects, o)
+}
+
+func (d *Directory) newObject(class, dn string, created time.Time) *Object {
+	return &Object{
+		DistinguishedName: dn,
+		ObjectClass:       class,
+		ObjectGUID:        d.newGUID(),
+		attrs:             map[string]interface{}{"Created": created, "Modified": created},
+		dir:               d,
+	}
+}
+
+// hash derives a stable seed from the domain name and a sequence number
+func (d *Directory) hash(seq int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d", d.Domain, seq)
+	return int64(h.Sum64())
+}
+
+// newGUID derives the next GUID from the domain name and a counter, so the
+// same fixture always produces the same GUIDs
+func (d *Directory) newGUID() string {
+	d.guidSeq++
+	b := make([]byte, 16)
+	rand.New(rand.NewSource(d.hash(d.guidSeq))).Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// SetClock overrides the time source used for Created, Modified and PasswordLastSet
+func (d *Directory) SetClock(clock func() time.Time) {
+	d.clock = clock
+}
+
+// Clone returns an independent copy, so each session can change its own domain
+func (d *Directory) Clone() *Directory {
+	c := *d
+	c.objects = make([]*Object, len(d.objects))
+	for i, o := range d.objects {
+		cp := *o
+		cp.dir = &c
+		cp.attrs = make(map[string]interface{}, len(o.attrs))
+		for k, v := range o.attrs {
+			if list, ok := v.([]string); ok {
+				v = append([]string(nil), list...)
+			}
+			cp.attrs[k] = v
+		}
+		c.objects[i] = &cp
+	}
+	return &c
+}
+
+// DN returns the distinguished name of the domain root, e.g. DC=contoso,DC=com
+func (d *Directory) DN() string {
+	return domainDN(d.Domain)
+}
+
+// UsersContainer returns the DN of the default container for new users and groups
+func (d *Directory) UsersContainer() string {
+	return "CN=Users," + d.DN()
+}
+
+func domainDN(domain string) string {
+	parts := strings.Split(domain, ".")
+	for i, p := range parts {
+		parts[i] = "DC=" + p
+	}
+	return strings.Join(parts, ",")
+}
+
+// Objects returns every entry in creation order
+func (d *Directory) Objects() []*Object {
+	return append([]*Object(nil), d.objects...)
+}
+
+// Lookup returns the entry with the given distinguished name
+func (d *Directory) Lookup(dn string) *Object {
+	key := normalizeDN(dn)
+	for _, o := range d.objects {
+		if normalizeDN(o.DistinguishedName) == key {
+			return o
+		}
+	}
+	return nil
+}
+
+// Resolve finds an object of the given class (any class when empty) by
+// distinguished name, GUID, SID or sAMAccountName, the forms -Identity accepts
+func (d *Directory) Resolve(identity, class string) (*Object, error) {
+	id := strings.TrimSpace(identity)
+	guid := strings.ToLower(strings.Trim(id, "{}"))
+	sam := id
+	if i := strings.Index(sam, `\`); i >= 0 && strings.EqualFold(sam[:i], d.NetBIOS) {
+		sam = sam[i+1:]
+	}
+	for _, o := range d.objects {
+		if class != "" && o.ObjectClass != class {
+			continue
+		}
+		switch {
+		case normalizeDN(o.DistinguishedName) == normalizeDN(id),
+			strings.EqualFold(o.ObjectGUID, guid),
+			o.SID != "" && strings.EqualFold(o.SID, id),
+			o.SID != "" && strings.EqualFold(o.String("SamAccountName"), sam):
+			return o, nil
+		}
+	}
+	return nil, fmt.Errorf("Cannot find an object with identity: '%s' under: '%s'.", identity, d.DN())
+}
+
+// SearchScope limits a search relative to its base
+type SearchScope int
+
+// Search scopes, named as the AD cmdlets' -SearchScope parameter
+const (
+	ScopeBase SearchScope = iota
+	ScopeOneLevel
+	ScopeSubtree
+)
+
+// ParseScope converts a -SearchScope argument
+func ParseScope(s string) (SearchScope, error) {
+	switch strings.ToLower(s) {
+	case "base", "0":
+		return ScopeBase, nil
+	case "onelevel", "1":
+		return ScopeOneLevel, nil
+	case "subtree", "2":
+		return ScopeSubtree, nil
+	}
+	return 0, fmt.Errorf("Cannot convert value \"%s\" to type \"Microsoft.ActiveDirectory.Management.ADSearchScope\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again:\nBase, OneLevel, Subtree\"", s, s)
+}
+
+// Search returns the objects at or beneath base within scope, in creation order
+func (d *Directory) Search(base string, scope SearchScope) ([]*Object, error) {
+	if base == "" {
+		base = d.DN()
+	}
+	root := d.Lookup(base)
+	if root == nil {
+		return nil, fmt.Errorf("Directory object not found")
+	}
+	rootKey := normalizeDN(root.DistinguishedName)
+	var out []*Object
+	for _, o := range d.objects {
+		key := normalizeDN(o.DistinguishedName)
+		switch scope {
+		case ScopeBase:
+			if key != rootKey {
+				continue
+			}
+		case ScopeOneLevel:
+			if normalizeDN(ParentDN(o.DistinguishedName)) != rootKey || key == rootKey {
+				continue
+			}
+		default:
+			if key != rootKey && !strings.HasSuffix(key, ","+rootKey) {
+				continue
+			}
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// Add creates an object named name beneath the container parent. attrs are
+// keyed by property name; users get a fresh SID and start disabled unless
+// attrs says otherwise.
+func (d *Directory) Add(class, name, parent string, attrs map[string]interface{}) (*Object, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("The name provided is not a properly formed account name")
+	}
+	if parent == "" {
+		parent = d.UsersContainer()
+	}
+	container := d.Lookup(parent)
+	if container == nil || !container.IsContainer() {
+		return nil, fmt.Errorf("Directory object not found")
+	}
+	rdn := "CN="
+	if class == ClassOU {
+		rdn = "OU="
+	}
+	dn := rdn + escapeRDN(name) + "," + container.DistinguishedName
+	if d.Lookup(dn) != nil {
+		return nil, fmt.Errorf("An attempt was made to add an object to the directory with a name that is already in use")
+	}
+	o := d.newObject(class, dn, d.clock())
+	o.attrs["Name"] = name
+	for k, v := range attrs {
+		if err := o.Set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	switch class {
+	case ClassUser, ClassGroup:
+		sam := o.String("SamAccountName")
+		if sam == "" {
+			sam = name
+			o.attrs["SamAccountName"] = sam
+		}
+		if err := validateSam(sam, class); err != nil {
+			return nil, err
+		}
+		for _, other := range d.objects {
+			if other.SID != "" && strings.EqualFold(other.String("SamAccountName"), sam) {
+				if class == ClassGroup {
+					return nil, fmt.Errorf("The specified group already exists")
+				}
+				return nil, fmt.Errorf("The specified account already exists")
+			}
+		}
+		o.SID = fmt.Sprintf("%s-%d", d.domainSID, d.nextRID)
+		d.nextRID++
+		if class == ClassUser {
+			if _, ok := o.attrs["Enabled"]; !ok {
+				o.attrs["Enabled"] = false
+			}
+		} else {
+			if _, ok := o.attrs["GroupCategory"]; !ok {
+				o.attrs["GroupCategory"] = "Security"
+			}
+		}
+	case ClassOU:
+		if _, ok := o.attrs["ProtectedFromAccidentalDeletion"]; !ok {
+			o.attrs["ProtectedFromAccidentalDeletion"] = true
+		}
+	}
+	d.objects = append(d.objects, o)
+	return o, nil
+}
+
+func validateSam(sam, class string) error {
+	if class == ClassUser && len(sam) > 20 {
+		return fmt.Errorf("The name provided is not a properly formed account name")
+	}
+	if strings.ContainsAny(sam, `"/\[]:;|=,+*?<>@`) {
+		return fmt.Errorf("The name provided is not a properly formed account name")
+	}
+	return nil
+}
+
+// Remove deletes an object; containers that still hold objects need recursive
+func (d *Directory) Remove(o *Object, recursive bool) error {
+	if o.ObjectClass == ClassDomain || o.ObjectClass == ClassContainer {
+		return fmt.Errorf("Access is denied")
+	}
+	if b, _ := o.attrs["ProtectedFromAccidentalDeletion"].(bool); b {
+		return fmt.Errorf("Access is denied")
+	}
+	subtree, _ := d.Search(o.DistinguishedName, ScopeSubtree)
+	if len(subtree) > 1 && !recursive {
+		return fmt.Errorf("The directory service can perform the requested operation only on a leaf object.")
+	}
+	removed := map[string]bool{}
+	for _, x := range subtree {
+		removed[normalizeDN(x.DistinguishedName)] = true
+	}
+	kept := d.objects[:0]
+	for _, x := range d.objects {
+		if !removed[normalizeDN(x.DistinguishedName)] {
+			kept = append(kept, x)
+		}
+	}
+	d.objects = kept
+	for _, g := range d.objects {
+		members, _ := g.attrs["Members"].([]string)
+		var left []string
+		for _, m := range members {
+			if !removed[normalizeDN(m)] {
+				left = append(left, m)
+			}
+		}
+		if len(left) != len(members) {
+			g.attrs["Members"] = left
+		}
+	}
+	return nil
+}
+
+// Members returns the direct members of a group
+func (d *Directory) Members(group *Object) []*Object {
+	var out []*Object
+	members, _ := group.attrs["Members"].([]string)
+	for _, dn := range members {
+		if m := d.Lookup(dn); m != nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// MemberOf returns the groups an object is a direct member of
+func (d *Directory) MemberOf(o *Object) []*Object {
+	key := normalizeDN(o.DistinguishedName)
+	var out []*Object
+	for _, g := range d.objects {
+		if g.ObjectClass != ClassGroup {
+			continue
+		}
+		members, _ := g.attrs["Members"].([]string)
+		for _, m := range members {
+			if normalizeDN(m) == key {
+				out = append(out, g)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// AddMember adds member to group
+func (d *Directory) AddMember(group, member *Object) error {
+	if group.ObjectClass != ClassGroup {
+		return fmt.Errorf("Cannot find an object with identity: '%s' under: '%s'.", group.DistinguishedName, d.DN())
+	}
+	if group == member {
+		return fmt.Errorf("A group cannot have itself as a member")
+	}
+	members, _ := group.attrs["Members"].([]string)
+	for _, m := range members {
+		if normalizeDN(m) == normalizeDN(member.DistinguishedName) {
+			return fmt.Errorf("The specified account name is already a member of the group")
+		}
+	}
+	group.attrs["Members"] = append(members, member.DistinguishedName)
+	group.touch()
+	return nil
+}
+
+// RemoveMember removes member from group
+func (d *Directory) RemoveMember(group, member *Object) error {
+	members, _ := group.attrs["Members"].([]string)
+	for i, m := range members {
+		if normalizeDN(m) == normalizeDN(member.DistinguishedName) {
+			group.attrs["Members"] = append(members[:i:i], members[i+1:]...)
+			group.touch()
+			return nil
+		}
+	}
+	return fmt.Errorf("The specified account name is not a member of the group")
+}
+
+// SetPassword sets a user's password after checking it against the domain's
+// default policy: at least seven characters drawn from three of upper case,
+// lower case, digits and symbols, and not containing the account name
+func (d *Directory) SetPassword(user *Object, password string) error {
+	if !meetsPolicy(password, user.String("SamAccountName")) {
+		return fmt.Errorf("The password does not meet the length, complexity, or history requirement of the domain.")
+	}
+	user.password = password
+	user.attrs["PasswordLastSet"] = d.clock()
+	user.attrs["ChangePasswordAtLogon"] = false
+	user.touch()
+	return nil
+}
+
+// CheckPassword reports whether password is the user's current password
+func (d *Directory) CheckPassword(user *Object, password string) bool {
+	return user.password != "" && user.password == password
+}
+
+func meetsPolicy(password, sam string) bool {
+	if len(password) < 7 {
+		return false
+	}
+	if len(sam) > 2 && strings.Contains(strings.ToLower(password), strings.ToLower(sam)) {
+		return false
+	}
+	var upper, lower, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return upper+lower+digit+other >= 3
+}
+
+// IsContainer reports whether other objects can be created beneath the object
+func (o *Object) IsContainer() bool {
+	switch o.ObjectClass {
+	case ClassDomain, ClassContainer, ClassOU:
+		return true
+	}
+	return false
+}
+
+// HasPassword reports whether a password has been set on the account
+func (o *Object) HasPassword() bool {
+	return o.password != ""
+}
+
+// Get returns a property by its AD cmdlet name or LDAP display name
+func (o *Object) Get(name string) (interface{}, bool) {
+	switch key := CanonicalName(name); key {
+	case "DistinguishedName":
+		return o.DistinguishedName, true
+	case "ObjectClass":
+		return o.ObjectClass, true
+	case "ObjectGUID":
+		return o.ObjectGUID, true
+	case "SID":
+		if o.SID == "" {
+			return nil, false
+		}
+		return o.SID, true
+	case "MemberOf":
+		if o.SID == "" {
+			return nil, false
+		}
+		var dns []string
+		for _, g := range o.dir.MemberOf(o) {
+			dns = append(dns, g.DistinguishedName)
+		}
+		return dns, true
+	case "CanonicalName":
+		return o.canonicalName(), true
+	case "userAccountControl":
+		if o.ObjectClass != ClassUser {
+			return nil, false
+		}
+		uac := 512
+		if enabled, _ := o.attrs["Enabled"].(bool); !enabled {
+			uac |= 2
+		}
+		return uac, true
+	default:
+		v, ok := o.attrs[key]
+		return v, ok
+	}
+}
+
+// String returns a property as a string, empty when it is not set
+func (o *Object) String(name string) string {
+	v, _ := o.Get(name)
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// Set changes a property; a nil value clears it
+func (o *Object) Set(name string, value interface{}) error {
+	key := CanonicalName(name)
+	switch key {
+	case "DistinguishedName", "ObjectClass", "ObjectGUID", "SID", "MemberOf", "CanonicalName", "Name", "Created", "Modified":
+		return fmt.Errorf("The attribute cannot be modified because it is owned by the system")
+	case "userAccountControl":
+		n, ok := value.(int)
+		if !ok {
+			return fmt.Errorf("The parameter is incorrect")
+		}
+		o.attrs["Enabled"] = n&2 == 0
+	default:
+		if value == nil {
+			delete(o.attrs, key)
+		} else {
+			o.attrs[key] = value
+		}
+	}
+	o.touch()
+	return nil
+}
+
+// Rename changes the object's name and therefore its distinguished name
+func (o *Object) Rename(name string) {
+	rdn := o.DistinguishedName[:strings.Index(o.DistinguishedName, "=")+1]
+	old := o.DistinguishedName
+	o.DistinguishedName = rdn + escapeRDN(name) + "," + ParentDN(old)
+	o.attrs["Name"] = name
+	for _, x := range o.dir.objects {
+		if strings.HasSuffix(normalizeDN(x.DistinguishedName), ","+normalizeDN(old)) {
+			x.DistinguishedName = x.DistinguishedName[:len(x.DistinguishedName)-len(old)] + o.DistinguishedName
+		}
+		members, _ := x.attrs["Members"].([]string)
+		for i, m := range members {
+			if normalizeDN(m) == normalizeDN(old) {
+				members[i] = o.DistinguishedName
+			}
+		}
+	}
+	o.touch()
+}
+
+// PropertyNames returns the names of the properties set on the object, sorted
+func (o *Object) PropertyNames() []string {
+	names := []string{"DistinguishedName", "ObjectClass", "ObjectGUID"}
+	if o.SID != "" {
+		names = append(names, "SID")
+	}
+	for k := range o.attrs {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names
+}
+
+func (o *Object) touch() {
+	o.attrs["Modified"] = o.dir.clock()
+}
+
+// canonicalName renders the object's path the way CanonicalName does: contoso.com/Sales/Ann Lee
+func (o *Object) canonicalName() string {
+	var parts []string
+	for _, rdn := range splitDN(o.DistinguishedName) {
+		if strings.HasPrefix(strings.ToUpper(rdn), "DC=") {
+			break
+		}
+		parts = append([]string{unescapeRDN(rdn[strings.Index(rdn, "=")+1:])}, parts...)
+	}
+	return strings.Join(append([]string{o.dir.Domain}, parts...), "/")
+}
+
+// ParentDN returns the distinguished name of an object's container
+func ParentDN(dn string) string {
+	parts := splitDN(dn)
+	if len(parts) <= 1 {
+		return ""
+	}
+	return strings.Join(parts[1:], ",")
+}
+
+// splitDN splits a distinguished name into its RDNs, honouring escaped commas
+func splitDN(dn string) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(dn); i++ {
+		switch {
+		case dn[i] == '\\' && i+1 < len(dn):
+			b.WriteByte(dn[i])
+			b.WriteByte(dn[i+1])
+			i++
+		case dn[i] == ',':
+			parts = append(parts, strings.TrimSpace(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(dn[i])
+		}
+	}
+	if b.Len() > 0 {
+		parts = append(parts, strings.TrimSpace(b.String()))
+	}
+	return parts
+}
+
+func normalizeDN(dn string) string {
+	parts := splitDN(dn)
+	for i, p := range parts {
+		if eq := strings.Index(p, "="); eq >= 0 {
+			p = strings.TrimSpace(p[:eq]) + "=" + strings.TrimSpace(p[eq+1:])
+		}
+		parts[i] = strings.ToLower(p)
+	}
+	return strings.Join(parts, ",")
+}
+
+func escapeRDN(v string) string {
+	var b strings.Builder
+	for i, r := range v {
+		if strings.ContainsRune(`,+"\<>;=`, r) || (i == 0 && (r == '#' || r == ' ')) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func unescapeRDN(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,486 @@
+package onprem
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a parsed -Filter expression in the AD cmdlets' PowerShell-like
+// syntax, e.g. Department -eq 'Sales' -and Enabled -eq $true
+type Filter struct {
+	root filterNode
+}
+
+// Resolver returns the value of a variable reference in a filter; path is
+// the reference without its $, e.g. "user.Department"
+type Resolver func(path string) (interface{}, error)
+
+// Attributes is anything a filter can be matched against
+type Attributes interface {
+	Get(name string) (interface{}, bool)
+}
+
+// PropertySet returns the canonical spelling of a property a filter may
+// reference, or false when the property is not filterable
+type PropertySet func(name string) (string, bool)
+
+// FilterError is a -Filter parse failure
+type FilterError struct {
+	Query    string
+	Message  string
+	Position int    // 1-based offset into Query
+	Property string // the offending property, for invalid-property errors
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("Error parsing query: '%s' Error Message: '%s' at position: '%d'.", e.Query, e.Message, e.Position)
+}
+
+// InvalidProperties is the FilterError message for an unknown property
+const InvalidProperties = "One or more properties are invalid."
+
+type filterNode interface {
+	match(o Attributes) bool
+}
+
+type allNode struct{}
+
+type notNode struct{ operand filterNode }
+
+type logicalNode struct {
+	and         bool
+	left, right filterNode
+}
+
+type compareNode struct {
+	property string
+	op       string
+	value    interface{}
+}
+
+// ParseFilter parses a -Filter expression. Variables are resolved while
+// parsing, the way the AD module expands them before querying the server.
+func ParseFilter(text string, resolve Resolver) (*Filter, error) {
+	return ParseFilterFor(text, resolve, adProperty)
+}
+
+// ParseFilterFor parses a filter in the same syntax over another set of
+// properties, such as the OPATH filters of the Exchange cmdlets
+func ParseFilterFor(text string, resolve Resolver, props PropertySet) (*Filter, error) {
+	p := &filterParser{text: text, resolve: resolve, props: props}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, p.errorAt(0, "syntax error")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorAt(p.tokens[p.pos].offset, "syntax error")
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match reports whether an object satisfies the filter
+func (f *Filter) Match(o Attributes) bool {
+	return f.root.match(o)
+}
+
+type filterToken struct {
+	kind   byte // 'o' operator, 's' string, 'n' number, 'v' variable, 'w' word, '(' or ')'
+	text   string
+	offset int
+}
+
+type filterParser struct {
+	text    string
+	resolve Resolver
+	props   PropertySet
+	tokens  []filterToken
+	pos     int
+}
+
+func (p *filterParser) errorAt(offset int, msg string) error {
+	return &FilterError{Query: p.text, Message: msg, Position: offset + 1}
+}
+
+func (p *filterParser) tokenize() error {
+	s := p.text
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			p.tokens = append(p.tokens, filterToken{kind: c, offset: i})
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '`' && c == '"' && j+1 < len(s) {
+					j++
+					b.WriteByte(s[j])
+					continue
+				}
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						b.WriteByte(c)
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return p.errorAt(i, "syntax error")
+			}
+			p.tokens = append(p.tokens, filterToken{kind: 's', text: b.String(), offset: i})
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\r\n()'\"", rune(s[j])) {
+				j++
+			}
+			word := s[i:j]
+			kind := byte('w')
+			switch {
+			case word[0] == '-' && len(word) > 1 && isLetter(word[1]):
+				kind = 'o'
+				word = strings.ToLower(word)
+			case word[0] == '$':
+				kind = 'v'
+				word = word[1:]
+			case word[0] == '-' || word[0] >= '0' && word[0] <= '9':
+				kind = 'n'
+			}
+			p.tokens = append(p.tokens, filterToken{kind: kind, text: word, offset: i})
+			i = j
+		}
+	}
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == 'o' && t.text == "-or"; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == 'o' && t.text == "-and"; t = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, p.errorAt(len(p.text), "syntax error")
+	}
+	switch {
+	case t.kind == 'o' && t.text == "-not":
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	case t.kind == '(':
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != ')' {
+			return nil, p.errorAt(len(p.text), "syntax error")
+		}
+		p.pos++
+		return inner, nil
+	case t.kind == 'w' && t.text == "*":
+		p.pos++
+		return allNode{}, nil
+	case t.kind == 'w':
+		return p.parseComparison()
+	}
+	return nil, p.errorAt(t.offset, "syntax error")
+}
+
+var filterOperators = map[string]bool{
+	"-eq": true, "-ne": true, "-like": true, "-notlike": true,
+	"-gt": true, "-ge": true, "-lt": true, "-le": true, "-approx": true,
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	prop := p.tokens[p.pos]
+	p.pos++
+	name, ok := p.props(prop.text)
+	if !ok {
+		return nil, &FilterError{Query: p.text, Message: InvalidProperties, Position: prop.offset + 1, Property: prop.text}
+	}
+	op := p.peek()
+	if op == nil || op.kind != 'o' || !filterOperators[op.text] {
+		offset := len(p.text)
+		if op != nil {
+			offset = op.offset
+		}
+		return nil, p.errorAt(offset, "Operator Not supported: "+opText(op))
+	}
+	p.pos++
+	v := p.peek()
+	if v == nil || v.kind == '(' || v.kind == ')' || v.kind == 'o' {
+		return nil, p.errorAt(len(p.text), "syntax error")
+	}
+	p.pos++
+	var value interface{}
+	switch v.kind {
+	case 's', 'w':
+		value = v.text
+	case 'n':
+		if n, err := strconv.Atoi(v.text); err == nil {
+			value = n
+		} else if f, err := strconv.ParseFloat(v.text, 64); err == nil {
+			value = f
+		} else {
+			value = v.text
+		}
+	case 'v':
+		switch strings.ToLower(v.text) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			if p.resolve == nil {
+				return nil, p.errorAt(v.offset, "Variable: '"+v.text+"' found in expression: $"+v.text+" is not defined.")
+			}
+			resolved, err := p.resolve(v.text)
+			if err != nil {
+				return nil, err
+			}
+			value = resolved
+		}
+	}
+	return &compareNode{property: name, op: op.text, value: value}, nil
+}
+
+func opText(t *filterToken) string {
+	if t == nil {
+		return ""
+	}
+	return t.text
+}
+
+// adProperty accepts the AD module's filterable properties and LDAP names
+func adProperty(name string) (string, bool) {
+	name = CanonicalName(name)
+	for _, p := range knownProperties {
+		if p == name {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (allNode) match(Attributes) bool { return true }
+
+func (n *notNode) match(o Attributes) bool { return !n.operand.match(o) }
+
+func (n *logicalNode) match(o Attributes) bool {
+	if n.and {
+		return n.left.match(o) && n.right.match(o)
+	}
+	return n.left.match(o) || n.right.match(o)
+}
+
+func (n *compareNode) match(o Attributes) bool {
+	v, ok := o.Get(n.property)
+	if ok {
+		if list, isList := v.([]string); isList && len(list) == 0 {
+			ok = false
+		}
+	}
+	switch n.op {
+	case "-ne":
+		return !ok || !anyValue(v, func(x interface{}) bool { return compare(x, n.value) == 0 })
+	case "-notlike":
+		return !ok || !anyValue(v, func(x interface{}) bool { return like(x, n.value) })
+	}
+	if !ok {
+		return false
+	}
+	return anyValue(v, func(x interface{}) bool {
+		switch n.op {
+		case "-like":
+			return like(x, n.value)
+		case "-gt":
+			return compare(x, n.value) > 0
+		case "-ge":
+			return compare(x, n.value) >= 0
+		case "-lt":
+			c := compare(x, n.value)
+			return c < 0 && c != incomparable
+		case "-le":
+			c := compare(x, n.value)
+			return c <= 0 && c != incomparable
+		}
+		return compare(x, n.value) == 0
+	})
+}
+
+// anyValue applies test to each value of a multi-valued attribute
+func anyValue(v interface{}, test func(interface{}) bool) bool {
+	if list, ok := v.([]string); ok {
+		for _, s := range list {
+			if test(s) {
+				return true
+			}
+		}
+		return false
+	}
+	return test(v)
+}
+
+const incomparable = -2
+
+// compare orders an attribute value against a filter value, converting the
+// filter value to the attribute's type
+func compare(attr, value interface{}) int {
+	switch a := attr.(type) {
+	case bool:
+		b, ok := value.(bool)
+		if !ok {
+			s := strings.ToLower(fmt.Sprint(value))
+			b, ok = s == "true" || s == "1", s == "true" || s == "false" || s == "1" || s == "0"
+		}
+		if !ok || a != b {
+			return incomparable
+		}
+		return 0
+	case int:
+		var b float64
+		switch v := value.(type) {
+		case int:
+			b = float64(v)
+		case float64:
+			b = v
+		default:
+			f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+			if err != nil {
+				return incomparable
+			}
+			b = f
+		}
+		return sign(float64(a) - b)
+	case time.Time:
+		var b time.Time
+		switch v := value.(type) {
+		case time.Time:
+			b = v
+		default:
+			t, err := parseTime(fmt.Sprint(v))
+			if err != nil {
+				return incomparable
+			}
+			b = t
+		}
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	case string:
+		if value == nil {
+			return incomparable
+		}
+		return strings.Compare(strings.ToLower(a), strings.ToLower(fmt.Sprint(value)))
+	}
+	return incomparable
+}
+
+func sign(f float64) int {
+	switch {
+	case f < 0:
+		return -1
+	case f > 0:
+		return 1
+	}
+	return 0
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{"01/02/2006 15:04:05", "01/02/2006", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// like matches a string attribute against a pattern where * is the only
+// wildcard, as AD filters allow
+func like(attr, pattern interface{}) bool {
+	s, ok := attr.(string)
+	if !ok || pattern == nil {
+		return false
+	}
+	parts := strings.Split(strings.ToLower(fmt.Sprint(pattern)), "*")
+	s = strings.ToLower(s)
+	if len(parts) == 1 {
+		return s == parts[0]
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
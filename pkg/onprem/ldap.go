@@ -0,0 +1,249 @@
+package onprem
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LDAPFilter is a parsed RFC 4515 search filter, e.g. (&(objectClass=user)(sn=Lee))
+type LDAPFilter struct {
+	root filterNode
+}
+
+type ldapItem struct {
+	attr  string
+	op    string // "=", ">=", "<=", "~=", "present", "substring", or a matching rule OID
+	value string
+	parts []string // substring pieces split on *
+}
+
+type ldapComposite struct {
+	op       byte // '&', '|' or '!'
+	children []filterNode
+}
+
+// Matching rules for bitwise tests on flag attributes such as userAccountControl
+const (
+	ruleBitAnd = "1.2.840.113556.1.4.803"
+	ruleBitOr  = "1.2.840.113556.1.4.804"
+)
+
+// ParseLDAPFilter parses an LDAP search filter
+func ParseLDAPFilter(text string) (*LDAPFilter, error) {
+	s := strings.TrimSpace(text)
+	if !strings.HasPrefix(s, "(") {
+		s = "(" + s + ")"
+	}
+	node, rest, err := parseLDAP(s)
+	if err != nil || strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("The search filter cannot be recognized")
+	}
+	return &LDAPFilter{root: node}, nil
+}
+
+// Match reports whether an object satisfies the filter
+func (f *LDAPFilter) Match(o *Object) bool {
+	return f.root.match(o)
+}
+
+func parseLDAP(s string) (filterNode, string, error) {
+	s = strings.TrimLeft(s, " ")
+	if !strings.HasPrefix(s, "(") {
+		return nil, s, fmt.Errorf("expected (")
+	}
+	s = strings.TrimLeft(s[1:], " ")
+	if s == "" {
+		return nil, s, fmt.Errorf("unexpected end")
+	}
+	switch s[0] {
+	case '&', '|', '!':
+		node := &ldapComposite{op: s[0]}
+		s = s[1:]
+		for {
+			s = strings.TrimLeft(s, " ")
+			if strings.HasPrefix(s, ")") {
+				break
+			}
+			child, rest, err := parseLDAP(s)
+			if err != nil {
+				return nil, rest, err
+			}
+			node.children = append(node.children, child)
+			s = rest
+		}
+		if len(node.children) == 0 || node.op == '!' && len(node.children) != 1 {
+			return nil, s, fmt.Errorf("bad composite")
+		}
+		return node, s[1:], nil
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, s, fmt.Errorf("unterminated item")
+	}
+	item, err := parseLDAPItem(s[:end])
+	return item, s[end+1:], err
+}
+
+func parseLDAPItem(s string) (*ldapItem, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("missing =")
+	}
+	item := &ldapItem{attr: strings.TrimSpace(s[:eq]), op: "="}
+	raw := s[eq+1:]
+	switch c := item.attr[len(item.attr)-1]; c {
+	case '>', '<', '~':
+		item.op = string(c) + "="
+		item.attr = strings.TrimSpace(item.attr[:len(item.attr)-1])
+	case ':':
+		parts := strings.Split(item.attr[:len(item.attr)-1], ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unsupported extensible match")
+		}
+		item.attr, item.op = parts[0], parts[1]
+	}
+	switch {
+	case item.op == "=" && raw == "*":
+		item.op = "present"
+	case item.op == "=" && strings.Contains(raw, "*"):
+		item.op = "substring"
+		for _, part := range strings.Split(raw, "*") {
+			v, err := unescapeLDAP(part)
+			if err != nil {
+				return nil, err
+			}
+			item.parts = append(item.parts, v)
+		}
+	default:
+		v, err := unescapeLDAP(raw)
+		if err != nil {
+			return nil, err
+		}
+		item.value = v
+	}
+	return item, nil
+}
+
+// unescapeLDAP decodes \XX hex escapes in a filter value
+func unescapeLDAP(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("bad escape")
+		}
+		n, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("bad escape")
+		}
+		b.WriteByte(byte(n))
+		i += 2
+	}
+	return b.String(), nil
+}
+
+func (n *ldapComposite) match(a Attributes) bool {
+	o, ok := a.(*Object)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case '&':
+		for _, c := range n.children {
+			if !c.match(o) {
+				return false
+			}
+		}
+		return true
+	case '|':
+		for _, c := range n.children {
+			if c.match(o) {
+				return true
+			}
+		}
+		return false
+	}
+	return !n.children[0].match(o)
+}
+
+// ldapValues returns an attribute's values as LDAP strings
+func ldapValues(o *Object, attr string) []string {
+	switch strings.ToLower(attr) {
+	case "objectclass":
+		switch o.ObjectClass {
+		case ClassUser:
+			return []string{"top", "person", "organizationalPerson", "user"}
+		case ClassOU, ClassContainer, ClassGroup:
+			return []string{"top", o.ObjectClass}
+		}
+		return []string{"top", "domain", o.ObjectClass}
+	case "objectcategory":
+		switch o.ObjectClass {
+		case ClassUser:
+			return []string{"person", "CN=Person,CN=Schema,CN=Configuration," + o.dir.DN()}
+		case ClassGroup:
+			return []string{"group", "CN=Group,CN=Schema,CN=Configuration," + o.dir.DN()}
+		case ClassOU:
+			return []string{"organizationalUnit", "CN=Organizational-Unit,CN=Schema,CN=Configuration," + o.dir.DN()}
+		}
+		return nil
+	}
+	v, ok := o.Get(attr)
+	if !ok || v == nil {
+		return nil
+	}
+	switch v := v.(type) {
+	case []string:
+		return v
+	case bool:
+		return []string{strings.ToUpper(strconv.FormatBool(v))}
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+func (n *ldapItem) match(a Attributes) bool {
+	o, ok := a.(*Object)
+	if !ok {
+		return false
+	}
+	values := ldapValues(o, n.attr)
+	if n.op == "present" {
+		return len(values) > 0
+	}
+	for _, v := range values {
+		switch n.op {
+		case "=", "~=":
+			if strings.EqualFold(v, n.value) {
+				return true
+			}
+		case "substring":
+			if like(v, strings.Join(n.parts, "*")) {
+				return true
+			}
+		case ">=", "<=":
+			c := strings.Compare(strings.ToLower(v), strings.ToLower(n.value))
+			a, errA := strconv.Atoi(v)
+			b, errB := strconv.Atoi(n.value)
+			if errA == nil && errB == nil {
+				c = sign(float64(a - b))
+			}
+			if n.op == ">=" && c >= 0 || n.op == "<=" && c <= 0 {
+				return true
+			}
+		case ruleBitAnd, ruleBitOr:
+			a, errA := strconv.Atoi(v)
+			b, errB := strconv.Atoi(n.value)
+			if errA != nil || errB != nil {
+				continue
+			}
+			if n.op == ruleBitAnd && a&b == b || n.op == ruleBitOr && a&b != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
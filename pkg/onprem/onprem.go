@@ -1,27 +1,4 @@
+// Package onprem simulates the on-premise infrastructure the lessons
+// manage: an Active Directory domain with OUs, users and groups that the
+// simulated AD cmdlets read and change.
 package onprem
-
-import "fmt"
-
-// StartLearning is an example entry point for the on-prem module.
-// This function would kick off interactive lessons or simulations related to on-premise PowerShell tasks.
-func StartLearning() {
-	fmt.Println("Initializing On-Premise PowerShell Learning Module...")
-	// TODO: Implement specific learning scenarios for on-premise tasks.
-	// Example: Active Directory management, file server tasks, local system configuration.
-	fmt.Println("Scenario 1: Managing Active Directory Users (Placeholder)")
-	// Call other functions like LearnADUsers(), LearnFileShares() etc.
-}
-
-// LearnADUsers could be a function that simulates AD user management tasks.
-// func LearnADUsers() { 
-// 	 fmt.Println("Today, we'll learn about Get-ADUser and New-ADUser...")
-// 	 // Interactive prompts and simulated outputs would go here.
-// }
-
-// How to add more code:
-// 1. Define new exported functions (e.g., `LearnDNSConfiguration`, `ManageLocalServices`) for different on-premise scenarios.
-// 2. Each function should guide the user through a task, potentially simulating PowerShell commands and outputs, 
-//    explaining the concepts and expected outcomes.
-// 3. Consider creating helper functions within this package for common operations or simulations if needed.
-// 4. Update the `StartLearning` function or create other entry points to call your new learning functions.
-// 5. If this package grows very large, consider breaking it into sub-packages like `onprem/ad`, `onprem/networking`.
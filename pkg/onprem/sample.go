@@ -0,0 +1,103 @@
+package onprem
+
+import "time"
+
+// sampleUsers are the people in the sample domain
+var sampleUsers = []struct {
+	given, surname, sam, ou, department, title, office, manager string
+	enabled, lockedOut                                          bool
+}{
+	{"Patti", "Fernandez", "pfernandez", "Users", "Executive", "President", "Seattle", "", true, false},
+	{"Nestor", "Wilke", "nwilke", "Users", "Operations", "Director", "Seattle", "pfernandez", true, false},
+	{"Adele", "Vance", "avance", "Users", "Sales", "Sales Manager", "Seattle", "pfernandez", true, false},
+	{"Isaiah", "Langer", "ilanger", "Users", "Sales", "Sales Representative", "Tulsa", "avance", true, true},
+	{"Alex", "Wilber", "awilber", "Users", "Marketing", "Marketing Assistant", "San Diego", "mbowen", true, false},
+	{"Megan", "Bowen", "mbowen", "Users", "Marketing", "Marketing Manager", "Seattle", "pfernandez", true, false},
+	{"Lee", "Gu", "lgu", "Users", "IT", "Director", "Seattle", "nwilke", true, false},
+	{"Grady", "Archie", "garchie", "Users", "IT", "Systems Engineer", "Bellevue", "lgu", true, false},
+	{"John", "Smith", "jsmith", "Users", "IT", "Developer", "Seattle", "lgu", true, false},
+	{"Diego", "Siciliani", "dsiciliani", "Users", "HR", "HR Manager", "Birmingham", "pfernandez", true, false},
+	{"Lynne", "Robbins", "lrobbins", "Disabled Users", "Sales", "Sales Representative", "Tulsa", "avance", false, false},
+}
+
+// sampleGroups are the groups in the sample domain; members are sAMAccountNames
+var sampleGroups = []struct {
+	name, category, scope, description string
+	members                            []string
+}{
+	{"Sales Team", "Security", "Global", "Sales department staff", []string{"avance", "ilanger"}},
+	{"Marketing", "Security", "Global", "Marketing department staff", []string{"awilber", "mbowen"}},
+	{"IT Admins", "Security", "Global", "Helpdesk and systems administrators", []string{"lgu", "garchie"}},
+	{"HR", "Security", "Global", "Human resources staff", []string{"dsiciliani"}},
+	{"All Staff", "Security", "Universal", "Everyone in the company", []string{"Sales Team", "Marketing", "IT Admins", "HR", "pfernandez", "nwilke"}},
+	{"VPN Users", "Security", "DomainLocal", "Allowed to connect to the VPN", []string{"avance", "ilanger", "garchie"}},
+	{"Newsletter", "Distribution", "Universal", "Company newsletter recipients", []string{"All Staff"}},
+}
+
+// samplePassword is the password every sample account starts with
+const samplePassword = "Contoso!2024"
+
+// SampleDirectory returns the contoso.com domain the AD lessons use: OUs for
+// users, groups, service accounts and leavers, eleven staff accounts and a set
+// of department groups. The same call always produces the same GUIDs and SIDs.
+func SampleDirectory() *Directory {
+	d := NewDirectory("contoso.com")
+	for _, ou := range []string{"Users", "Groups", "Service Accounts", "Disabled Users"} {
+		o, _ := d.Add(ClassOU, ou, d.DN(), map[string]interface{}{"Description": ou + " managed by the helpdesk"})
+		o.created(fixtureTime)
+	}
+	for _, u := range sampleUsers {
+		name := u.given + " " + u.surname
+		o, _ := d.Add(ClassUser, name, "OU="+u.ou+","+d.DN(), map[string]interface{}{
+			"SamAccountName":    u.sam,
+			"GivenName":         u.given,
+			"Surname":           u.surname,
+			"DisplayName":       name,
+			"UserPrincipalName": u.sam + "@" + d.Domain,
+			"EmailAddress":      u.given + "." + u.surname + "@" + d.Domain,
+			"Department":        u.department,
+			"Title":             u.title,
+			"Office":            u.office,
+			"Company":           "Contoso",
+			"Enabled":           u.enabled,
+			"LockedOut":         u.lockedOut,
+		})
+		o.password = samplePassword
+		o.attrs["PasswordLastSet"] = fixtureTime
+		o.created(fixtureTime)
+	}
+	for _, u := range sampleUsers {
+		if u.manager != "" {
+			o, _ := d.Resolve(u.sam, ClassUser)
+			m, _ := d.Resolve(u.manager, ClassUser)
+			o.attrs["Manager"] = m.DistinguishedName
+		}
+	}
+	svc, _ := d.Add(ClassUser, "svc-backup", "OU=Service Accounts,"+d.DN(), map[string]interface{}{
+		"Description":          "Nightly backup job",
+		"Enabled":              true,
+		"PasswordNeverExpires": true,
+		"UserPrincipalName":    "svc-backup@" + d.Domain,
+	})
+	svc.password = "Backup#Svc2023"
+	svc.attrs["PasswordLastSet"] = fixtureTime
+	svc.created(fixtureTime)
+	for _, g := range sampleGroups {
+		o, _ := d.Add(ClassGroup, g.name, "OU=Groups,"+d.DN(), map[string]interface{}{
+			"GroupCategory": g.category,
+			"GroupScope":    g.scope,
+			"Description":   g.description,
+		})
+		for _, m := range g.members {
+			member, _ := d.Resolve(m, "")
+			d.AddMember(o, member)
+		}
+		o.created(fixtureTime)
+	}
+	return d
+}
+
+func (o *Object) created(t time.Time) {
+	o.attrs["Created"] = t
+	o.attrs["Modified"] = t
+}
@@ -0,0 +1,325 @@
+package psim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The analyzer checks scripts for style and safety the way PSScriptAnalyzer
+// does: each rule looks at the nodes of a script's AST and reports what it
+// finds. The built-in rules carry PSScriptAnalyzer's names; a lesson host
+// can add its own conventions alongside them.
+
+// Severity ranks a diagnostic
+type Severity int
+
+const (
+	SeverityInformation Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "Warning"
+	case SeverityError:
+		return "Error"
+	}
+	return "Information"
+}
+
+// Diagnostic is something a rule found in a script
+type Diagnostic struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	Pos      Pos
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d %s %s: %s", d.Pos.Line, d.Pos.Column, d.Severity, d.Rule, d.Message)
+}
+
+// Rule checks scripts for one convention. Check is called with every node
+// of a script and reports what it finds through the analysis.
+type Rule struct {
+	Name        string
+	Severity    Severity
+	Description string
+	Check       func(a *Analysis, n Node)
+}
+
+// Analyzer runs a set of rules over scripts
+type Analyzer struct {
+	rules []*Rule
+}
+
+// NewAnalyzer returns an analyzer with the built-in rules and any others given
+func NewAnalyzer(rules ...*Rule) *Analyzer {
+	an := &Analyzer{rules: builtinRules()}
+	an.Add(rules...)
+	return an
+}
+
+// Add adds rules to the analyzer; a rule replaces any rule of the same name
+func (an *Analyzer) Add(rules ...*Rule) {
+	for _, r := range rules {
+		an.Remove(r.Name)
+		an.rules = append(an.rules, r)
+	}
+}
+
+// Remove drops the rule with the given name
+func (an *Analyzer) Remove(name string) {
+	kept := an.rules[:0]
+	for _, r := range an.rules {
+		if !strings.EqualFold(r.Name, name) {
+			kept = append(kept, r)
+		}
+	}
+	an.rules = kept
+}
+
+// Rules returns the analyzer's rules
+func (an *Analyzer) Rules() []*Rule {
+	return append([]*Rule(nil), an.rules...)
+}
+
+// Analyze runs every rule over a script and returns the diagnostics in
+// source order. A script that doesn't parse gets its syntax error alone.
+func (an *Analyzer) Analyze(src string) []Diagnostic {
+	block, err := Parse(src)
+	if err != nil {
+		perr, ok := err.(*ParseError)
+		if !ok {
+			return nil
+		}
+		return []Diagnostic{{Rule: "ParseError", Severity: SeverityError, Message: perr.Message, Pos: perr.Pos}}
+	}
+	a := &Analysis{rs: newResolver()}
+	Inspect(block, func(n Node) bool {
+		if n == nil {
+			a.parents = a.parents[:len(a.parents)-1]
+			return true
+		}
+		for _, r := range an.rules {
+			a.rule = r
+			r.Check(a, n)
+		}
+		a.parents = append(a.parents, n)
+		return true
+	})
+	sort.SliceStable(a.found, func(i, j int) bool {
+		return a.found[i].Pos.Offset < a.found[j].Pos.Offset
+	})
+	return a.found
+}
+
+// Analysis is the state of analyzing one script, handed to each rule
+type Analysis struct {
+	rs      *Runspace
+	rule    *Rule
+	parents []Node
+	found   []Diagnostic
+}
+
+// Report records a diagnostic of the running rule at a node
+func (a *Analysis) Report(n Node, format string, args ...interface{}) {
+	a.found = append(a.found, Diagnostic{
+		Rule:     a.rule.Name,
+		Severity: a.rule.Severity,
+		Message:  fmt.Sprintf(format, args...),
+		Pos:      n.Position(),
+	})
+}
+
+// Parents returns the nodes enclosing the one being checked, innermost last
+func (a *Analysis) Parents() []Node {
+	return a.parents
+}
+
+// CommandName returns the full name of the cmdlet a command runs, following
+// aliases; ok is false for a command the simulator doesn't know, such as a
+// function the script defines
+func (a *Analysis) CommandName(cmd *CommandAst) (name string, ok bool) {
+	if c := a.cmdlet(cmd); c != nil {
+		return c.Name, true
+	}
+	return "", false
+}
+
+// Arguments returns the parameter each of a command's arguments binds to;
+// ok is false when that can't be settled without running the script
+func (a *Analysis) Arguments(cmd *CommandAst) ([]BoundArgument, bool) {
+	return bindStatic(a.cmdlet(cmd), cmd.Elements)
+}
+
+func (a *Analysis) cmdlet(cmd *CommandAst) *Cmdlet {
+	name, ok := cmd.Name.(*StringExpr)
+	if cmd.Invocation != "" || !ok {
+		return nil
+	}
+	c, _ := a.rs.resolveCommand(name.Value)
+	return c
+}
+
+// builtinRules returns the rules every analyzer starts with
+func builtinRules() []*Rule {
+	return []*Rule{
+		{
+			Name:        "PSAvoidUsingCmdletAliases",
+			Severity:    SeverityWarning,
+			Description: "Aliases save typing at the console, but scripts should spell out the command for those who read them.",
+			Check: func(a *Analysis, n Node) {
+				cmd, ok := n.(*CommandAst)
+				if !ok || cmd.Invocation != "" {
+					return
+				}
+				if name, ok := cmd.Name.(*StringExpr); ok {
+					if target, ok := builtinAliases[strings.ToLower(name.Value)]; ok {
+						full, _ := a.CommandName(cmd)
+						if full == "" {
+							full = target
+						}
+						a.Report(cmd, "'%s' is an alias of '%s'. Use the full command name in scripts.", name.Value, full)
+					}
+				}
+			},
+		},
+		{
+			Name:        "PSAvoidUsingWriteHost",
+			Severity:    SeverityWarning,
+			Description: "Write-Host only draws on the console; its text can't be piped, captured or tested. Functions that show things, named Show-, may use it.",
+			Check: func(a *Analysis, n Node) {
+				cmd, ok := n.(*CommandAst)
+				if !ok {
+					return
+				}
+				if name, _ := a.CommandName(cmd); name != "Write-Host" {
+					return
+				}
+				for _, p := range a.Parents() {
+					if f, ok := p.(*FunctionDefinition); ok && strings.HasPrefix(strings.ToLower(f.Name), "show-") {
+						return
+					}
+				}
+				a.Report(cmd, "Write-Host only writes to the console. Use Write-Output for output that should go down the pipeline.")
+			},
+		},
+		{
+			Name:        "PSAvoidUsingConvertToSecureStringWithPlainText",
+			Severity:    SeverityError,
+			Description: "A password typed into a script as plain text can be read by anyone who can read the script.",
+			Check: func(a *Analysis, n Node) {
+				cmd, ok := n.(*CommandAst)
+				if !ok {
+					return
+				}
+				if name, _ := a.CommandName(cmd); name != "ConvertTo-SecureString" {
+					return
+				}
+				args, _ := a.Arguments(cmd)
+				for _, arg := range args {
+					if arg.Parameter == "AsPlainText" {
+						a.Report(cmd, "ConvertTo-SecureString -AsPlainText puts the secret in the script as plain text. Use Read-Host -AsSecureString or Get-Credential instead.")
+					}
+				}
+			},
+		},
+		{
+			Name:        "PSUseApprovedVerbs",
+			Severity:    SeverityWarning,
+			Description: "Functions are named Verb-Noun with one of PowerShell's approved verbs, so users can guess what they do.",
+			Check: func(a *Analysis, n Node) {
+				f, ok := n.(*FunctionDefinition)
+				if !ok {
+					return
+				}
+				verb, _, found := strings.Cut(f.Name, "-")
+				if !found {
+					return
+				}
+				for _, approved := range approvedVerbs {
+					if strings.EqualFold(verb, approved) {
+						return
+					}
+				}
+				a.Report(f, "'%s' uses the unapproved verb '%s'. Use an approved verb, such as Get, Set, New or Remove.", f.Name, verb)
+			},
+		},
+		{
+			Name:        "PSAvoidUsingEmptyCatchBlock",
+			Severity:    SeverityWarning,
+			Description: "An empty catch block swallows errors without a trace.",
+			Check: func(a *Analysis, n Node) {
+				t, ok := n.(*TryStatement)
+				if !ok {
+					return
+				}
+				for _, c := range t.Catches {
+					if len(c.Body) == 0 {
+						a.Report(t, "Empty catch block. Handle the error, or at least write it with Write-Error or Write-Warning.")
+					}
+				}
+			},
+		},
+		{
+			Name:        "PSAvoidUsingPositionalParameters",
+			Severity:    SeverityInformation,
+			Description: "Naming parameters makes a script say what each argument is for.",
+			Check: func(a *Analysis, n Node) {
+				cmd, ok := n.(*CommandAst)
+				if !ok {
+					return
+				}
+				name, ok := a.CommandName(cmd)
+				if !ok {
+					return
+				}
+				args, _ := a.Arguments(cmd)
+				var first Node
+				var params []string
+				for _, arg := range args {
+					if arg.Positional {
+						if first == nil {
+							first = arg.Value
+						}
+						params = append(params, "-"+arg.Parameter)
+					}
+				}
+				switch {
+				case len(params) == 1:
+					a.Report(first, "Positional argument for %s of %s. Name the parameter in scripts.", params[0], name)
+				case len(params) > 1:
+					a.Report(first, "Positional arguments for %s of %s. Name the parameters in scripts.", strings.Join(params, ", "), name)
+				}
+			},
+		},
+	}
+}
+
+// approvedVerbs are the verbs Get-Verb lists
+var approvedVerbs = []string{
+	// Common
+	"Add", "Clear", "Close", "Copy", "Enter", "Exit", "Find", "Format", "Get", "Hide", "Join", "Lock",
+	"Move", "New", "Open", "Optimize", "Pop", "Push", "Redo", "Remove", "Rename", "Reset", "Resize",
+	"Search", "Select", "Set", "Show", "Skip", "Split", "Step", "Switch", "Undo", "Unlock", "Watch",
+	// Communications
+	"Connect", "Disconnect", "Read", "Receive", "Send", "Write",
+	// Data
+	"Backup", "Checkpoint", "Compare", "Compress", "Convert", "ConvertFrom", "ConvertTo", "Dismount",
+	"Edit", "Expand", "Export", "Group", "Import", "Initialize", "Limit", "Merge", "Mount", "Out",
+	"Publish", "Restore", "Save", "Sync", "Unpublish", "Update",
+	// Diagnostic
+	"Debug", "Measure", "Ping", "Repair", "Resolve", "Test", "Trace",
+	// Lifecycle
+	"Approve", "Assert", "Build", "Complete", "Confirm", "Deny", "Deploy", "Disable", "Enable",
+	"Install", "Invoke", "Register", "Request", "Restart", "Resume", "Start", "Stop", "Submit",
+	"Suspend", "Uninstall", "Unregister", "Wait",
+	// Security
+	"Block", "Grant", "Protect", "Revoke", "Unblock", "Unprotect",
+	// Other
+	"Use",
+}
@@ -0,0 +1,570 @@
+package psim
+
+// Node is implemented by every AST node
+type Node interface {
+	Position() Pos
+}
+
+// Statement is a node that can appear in a statement list
+type Statement interface {
+	Node
+	statementNode()
+}
+
+// Expr is a node that produces a value
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// ScriptBlockAst is the root of a parsed script or { script block }
+type ScriptBlockAst struct {
+	Pos
+	Params  *ParamBlock
+	Begin   []Statement // the begin block; nil when there is none
+	Process []Statement // the process block; nil when there is none
+	Body    []Statement // the end block, which is all of a body without named blocks
+	Named   bool        // the body is written as begin, process and end blocks
+	Text    string      // source text without the surrounding braces
+}
+
+// ParamBlock is a param(...) declaration
+type ParamBlock struct {
+	Pos
+	Attributes []*AttributeAst // [CmdletBinding()] and other attributes before param
+	Params     []*ParamAst
+}
+
+// ParamAst declares a single script block parameter
+type ParamAst struct {
+	Pos
+	Name       string
+	Type       string
+	Attributes []*AttributeAst // [Parameter()], [ValidateSet()] and the like
+	Default    Expr
+}
+
+// AttributeAst is an attribute such as [Parameter(Mandatory)] or [ValidateRange(1, 10)]
+type AttributeAst struct {
+	Pos
+	Name       string
+	Positional []Expr
+	Named      []NamedArgument
+}
+
+// NamedArgument is Name = value in an attribute; a bare Name has no Value and means $true
+type NamedArgument struct {
+	Name  string
+	Value Expr
+}
+
+// Statements
+
+// PipelineStatement is one or more pipeline elements joined by |
+type PipelineStatement struct {
+	Pos
+	Elements []PipelineElement
+}
+
+// PipelineElement is a command or, in the first position, an expression
+type PipelineElement interface {
+	Node
+	elementNode()
+}
+
+// AssignmentStatement assigns the result of a statement to a target
+type AssignmentStatement struct {
+	Pos
+	Target Expr
+	Op     string // =, +=, -=, *=, /=, %=
+	Value  Statement
+}
+
+// IfClause is a single if/elseif condition and body
+type IfClause struct {
+	Condition Statement
+	Body      []Statement
+}
+
+// IfStatement is if/elseif/else
+type IfStatement struct {
+	Pos
+	Clauses []IfClause
+	Else    []Statement
+}
+
+// WhileStatement is a while loop
+type WhileStatement struct {
+	Pos
+	Label     string
+	Condition Statement
+	Body      []Statement
+}
+
+// DoStatement is do { } while () or do { } until ()
+type DoStatement struct {
+	Pos
+	Label     string
+	Body      []Statement
+	Condition Statement
+	Until     bool
+}
+
+// ForStatement is a C-style for loop
+type ForStatement struct {
+	Pos
+	Label     string
+	Init      Statement
+	Condition Statement
+	Step      Statement
+	Body      []Statement
+}
+
+// ForEachStatement is foreach ($x in $collection) { }
+type ForEachStatement struct {
+	Pos
+	Label      string
+	Variable   string
+	Collection Statement
+	Body       []Statement
+}
+
+// SwitchClause is a single switch condition and body
+type SwitchClause struct {
+	Condition Expr // nil for default
+	Body      []Statement
+}
+
+// SwitchStatement is a switch statement
+type SwitchStatement struct {
+	Pos
+	Label     string
+	Mode      string // "", "wildcard", "regex", "exact"
+	CaseSense bool
+	Subject   Statement
+	Clauses   []SwitchClause
+	Default   []Statement
+}
+
+// BreakStatement is break [label]
+type BreakStatement struct {
+	Pos
+	Label string
+}
+
+// ContinueStatement is continue [label]
+type ContinueStatement struct {
+	Pos
+	Label string
+}
+
+// ReturnStatement is return [pipeline]
+type ReturnStatement struct {
+	Pos
+	Value Statement
+}
+
+// ExitStatement is exit [code]
+type ExitStatement struct {
+	Pos
+	Code Statement
+}
+
+// TryStatement is try { } catch [type] { } finally { }
+type TryStatement struct {
+	Pos
+	Body    []Statement
+	Catches []CatchClause
+	Finally []Statement // nil when there is no finally block
+}
+
+// CatchClause is one catch block of a try statement
+type CatchClause struct {
+	Types []string // exception types it handles; none catches every error
+	Body  []Statement
+}
+
+// TrapStatement is trap [type] { }
+type TrapStatement struct {
+	Pos
+	Type string // "" traps every error
+	Body []Statement
+}
+
+// ThrowStatement is throw [value]
+type ThrowStatement struct {
+	Pos
+	Value Statement
+}
+
+// FunctionDefinition is function Name { } or filter Name { }
+type FunctionDefinition struct {
+	Pos
+	Name   string
+	Filter bool // a filter's body is its process block
+	Body   *ScriptBlockAst
+}
+
+func (*PipelineStatement) statementNode()   {}
+func (*AssignmentStatement) statementNode() {}
+func (*IfStatement) statementNode()         {}
+func (*WhileStatement) statementNode()      {}
+func (*DoStatement) statementNode()         {}
+func (*ForStatement) statementNode()        {}
+func (*ForEachStatement) statementNode()    {}
+func (*SwitchStatement) statementNode()     {}
+func (*BreakStatement) statementNode()      {}
+func (*ContinueStatement) statementNode()   {}
+func (*ReturnStatement) statementNode()     {}
+func (*ExitStatement) statementNode()       {}
+func (*TryStatement) statementNode()        {}
+func (*TrapStatement) statementNode()       {}
+func (*ThrowStatement) statementNode()      {}
+func (*FunctionDefinition) statementNode()  {}
+
+// Commands
+
+// CommandAst invokes a cmdlet, alias, script block or script
+type CommandAst struct {
+	Pos
+	Name         Expr   // StringExpr for barewords, any expression after & or .
+	Invocation   string // "", "&" or "."
+	Elements     []CommandElement
+	Redirections []Redirection
+}
+
+// CommandElement is a parameter name, an argument, or both (-Name:value)
+type CommandElement struct {
+	Pos
+	Param    string // parameter name without the dash, "" for plain arguments
+	Arg      Expr   // nil for a bare -Switch or -Name followed by a separate argument
+	Colon    bool   // -Name:value
+	Splatted bool   // @params
+}
+
+// Redirection is an output redirection such as 2>&1 or > $null
+type Redirection struct {
+	Pos
+	Op     string
+	Target Expr // nil for 2>&1
+}
+
+// CommandExpression is an expression used as the first pipeline element
+type CommandExpression struct {
+	Pos
+	Expr         Expr
+	Redirections []Redirection
+}
+
+func (*CommandAst) elementNode()        {}
+func (*CommandExpression) elementNode() {}
+
+// Expressions
+
+// ConstantExpr is a number, $true/$false/$null or other fixed value
+type ConstantExpr struct {
+	Pos
+	Value interface{}
+	Text  string
+}
+
+// StringExpr is a verbatim string or bareword
+type StringExpr struct {
+	Pos
+	Value   string
+	Bare    bool // unquoted command argument or command name
+	Quote   byte // ', " or 0
+	Literal string
+}
+
+// ExpandableStringExpr is a double-quoted string with embedded variables
+type ExpandableStringExpr struct {
+	Pos
+	Parts []Expr // StringExpr, VariableExpr or SubExpr
+	Raw   string
+}
+
+// VariableExpr references a variable
+type VariableExpr struct {
+	Pos
+	Name string
+}
+
+// ArrayLiteralExpr is a comma-separated list
+type ArrayLiteralExpr struct {
+	Pos
+	Elements []Expr
+}
+
+// ArrayExpr is @( statements )
+type ArrayExpr struct {
+	Pos
+	Body []Statement
+}
+
+// SubExpr is $( statements )
+type SubExpr struct {
+	Pos
+	Body []Statement
+}
+
+// ParenExpr is ( pipeline )
+type ParenExpr struct {
+	Pos
+	Pipeline Statement
+}
+
+// HashEntry is a single key = value pair
+type HashEntry struct {
+	Key   Expr
+	Value Statement
+}
+
+// HashtableExpr is @{ key = value }
+type HashtableExpr struct {
+	Pos
+	Entries []HashEntry
+}
+
+// ScriptBlockExpr is a { script block } literal
+type ScriptBlockExpr struct {
+	Pos
+	Block *ScriptBlockAst
+}
+
+// BinaryExpr is a binary operator application
+type BinaryExpr struct {
+	Pos
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// UnaryExpr is a prefix or postfix operator application
+type UnaryExpr struct {
+	Pos
+	Op      string
+	Operand Expr
+	Postfix bool
+}
+
+// ConvertExpr is a [type] cast
+type ConvertExpr struct {
+	Pos
+	Type    string
+	Operand Expr
+}
+
+// TypeExpr is a bare [type] literal
+type TypeExpr struct {
+	Pos
+	Type string
+}
+
+// MemberExpr is target.member or [type]::member
+type MemberExpr struct {
+	Pos
+	Target Expr
+	Member Expr
+	Static bool
+}
+
+// InvokeMemberExpr is a method call
+type InvokeMemberExpr struct {
+	Pos
+	Target Expr
+	Member Expr
+	Args   []Expr
+	Static bool
+}
+
+// IndexExpr is target[index]
+type IndexExpr struct {
+	Pos
+	Target Expr
+	Index  Expr
+}
+
+func (*ConstantExpr) exprNode()         {}
+func (*StringExpr) exprNode()           {}
+func (*ExpandableStringExpr) exprNode() {}
+func (*VariableExpr) exprNode()         {}
+func (*ArrayLiteralExpr) exprNode()     {}
+func (*ArrayExpr) exprNode()            {}
+func (*SubExpr) exprNode()              {}
+func (*ParenExpr) exprNode()            {}
+func (*HashtableExpr) exprNode()        {}
+func (*ScriptBlockExpr) exprNode()      {}
+func (*BinaryExpr) exprNode()           {}
+func (*UnaryExpr) exprNode()            {}
+func (*ConvertExpr) exprNode()          {}
+func (*TypeExpr) exprNode()             {}
+func (*MemberExpr) exprNode()           {}
+func (*InvokeMemberExpr) exprNode()     {}
+func (*IndexExpr) exprNode()            {}
+
+// Inspect walks an AST depth-first, in the manner of go/ast: it calls f
+// with a node and, when f returns true, walks each of the node's children,
+// then calls f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	for _, child := range children(node) {
+		Inspect(child, f)
+	}
+	f(nil)
+}
+
+// children returns the nodes directly under a node, in source order
+func children(node Node) []Node {
+	var nodes []Node
+	// A nil Statement or Expr is a nil Node; pointer fields are checked before adding
+	add := func(ns ...Node) {
+		for _, n := range ns {
+			if n != nil {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	statements := func(stmts []Statement) {
+		for _, s := range stmts {
+			add(s)
+		}
+	}
+	exprs := func(es []Expr) {
+		for _, e := range es {
+			add(e)
+		}
+	}
+	attributes := func(attrs []*AttributeAst) {
+		for _, a := range attrs {
+			add(a)
+		}
+	}
+
+	switch n := node.(type) {
+	case *ScriptBlockAst:
+		if n.Params != nil {
+			add(n.Params)
+		}
+		statements(n.Begin)
+		statements(n.Process)
+		statements(n.Body)
+	case *ParamBlock:
+		attributes(n.Attributes)
+		for _, p := range n.Params {
+			add(p)
+		}
+	case *ParamAst:
+		attributes(n.Attributes)
+		add(n.Default)
+	case *AttributeAst:
+		exprs(n.Positional)
+		for _, arg := range n.Named {
+			add(arg.Value)
+		}
+	case *PipelineStatement:
+		for _, el := range n.Elements {
+			add(el)
+		}
+	case *AssignmentStatement:
+		add(n.Target)
+		add(n.Value)
+	case *IfStatement:
+		for _, c := range n.Clauses {
+			add(c.Condition)
+			statements(c.Body)
+		}
+		statements(n.Else)
+	case *WhileStatement:
+		add(n.Condition)
+		statements(n.Body)
+	case *DoStatement:
+		statements(n.Body)
+		add(n.Condition)
+	case *ForStatement:
+		add(n.Init)
+		add(n.Condition)
+		add(n.Step)
+		statements(n.Body)
+	case *ForEachStatement:
+		add(n.Collection)
+		statements(n.Body)
+	case *SwitchStatement:
+		add(n.Subject)
+		for _, c := range n.Clauses {
+			add(c.Condition)
+			statements(c.Body)
+		}
+		statements(n.Default)
+	case *ReturnStatement:
+		add(n.Value)
+	case *ExitStatement:
+		add(n.Code)
+	case *ThrowStatement:
+		add(n.Value)
+	case *TryStatement:
+		statements(n.Body)
+		for _, c := range n.Catches {
+			statements(c.Body)
+		}
+		statements(n.Finally)
+	case *TrapStatement:
+		statements(n.Body)
+	case *FunctionDefinition:
+		if n.Body != nil {
+			add(n.Body)
+		}
+	case *CommandAst:
+		add(n.Name)
+		for _, el := range n.Elements {
+			add(el.Arg)
+		}
+		for _, r := range n.Redirections {
+			add(r.Target)
+		}
+	case *CommandExpression:
+		add(n.Expr)
+		for _, r := range n.Redirections {
+			add(r.Target)
+		}
+	case *ExpandableStringExpr:
+		exprs(n.Parts)
+	case *ArrayLiteralExpr:
+		exprs(n.Elements)
+	case *ArrayExpr:
+		statements(n.Body)
+	case *SubExpr:
+		statements(n.Body)
+	case *ParenExpr:
+		add(n.Pipeline)
+	case *HashtableExpr:
+		for _, e := range n.Entries {
+			add(e.Key)
+			add(e.Value)
+		}
+	case *ScriptBlockExpr:
+		if n.Block != nil {
+			add(n.Block)
+		}
+	case *BinaryExpr:
+		add(n.Left)
+		add(n.Right)
+	case *UnaryExpr:
+		add(n.Operand)
+	case *ConvertExpr:
+		add(n.Operand)
+	case *MemberExpr:
+		add(n.Target)
+		add(n.Member)
+	case *InvokeMemberExpr:
+		add(n.Target)
+		add(n.Member)
+		exprs(n.Args)
+	case *IndexExpr:
+		add(n.Target)
+		add(n.Index)
+	}
+	return nodes
+}
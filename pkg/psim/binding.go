@@ -0,0 +1,499 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parameter binding follows PowerShell's order: named arguments, then
+// positional ones, then a check that every mandatory parameter of a
+// parameter set is bound. Each pipeline object is bound afresh before the
+// cmdlet processes it, by value or by property name.
+
+// allParameterSets is the only parameter set of a cmdlet that declares none
+const allParameterSets = "__AllParameterSets"
+
+const ambiguousParameterSet = "Parameter set cannot be resolved using the specified named parameters. One or more parameters issued cannot be used together or an insufficient number of parameters were provided."
+
+// parameterSets returns the cmdlet's parameter sets, the default first
+func (c *Cmdlet) parameterSets() []string {
+	var sets []string
+	if c.DefaultSet != "" {
+		sets = append(sets, c.DefaultSet)
+	}
+	for _, p := range c.Params {
+		for _, s := range p.Sets {
+			if !containsFold(sets, s) {
+				sets = append(sets, s)
+			}
+		}
+	}
+	if len(sets) == 0 {
+		sets = []string{allParameterSets}
+	}
+	return sets
+}
+
+// inSet reports whether a parameter belongs to a parameter set
+func (p *Parameter) inSet(set string) bool {
+	return len(p.Sets) == 0 || containsFold(p.Sets, set)
+}
+
+// takesPipeline reports whether a parameter can be bound from pipeline input
+func (p *Parameter) takesPipeline() bool {
+	return p.ValueFromPipeline || p.ValueFromPipelineByPropertyName
+}
+
+// setsWith returns the parameter sets still possible once p is bound
+func (c *Call) setsWith(p *Parameter) []string {
+	var sets []string
+	for _, s := range c.sets {
+		if p.inSet(s) {
+			sets = append(sets, s)
+		}
+	}
+	return sets
+}
+
+// bindParam binds a value to a parameter, narrowing the parameter sets the
+// call can be in to those the parameter belongs to
+func (c *Call) bindParam(p *Parameter, v interface{}) error {
+	key := strings.ToLower(p.Name)
+	if _, dup := c.Bound[key]; dup {
+		return c.Errorf("Cannot bind parameter because parameter '%s' is specified more than once. To provide multiple values to parameters that can accept multiple values, use the array syntax. For example, \"-parameter value1,value2,value3\".", p.Name)
+	}
+	sets := c.setsWith(p)
+	if len(sets) == 0 {
+		return c.Errorf("%s", ambiguousParameterSet)
+	}
+	c.sets = sets
+	c.Bound[key] = v
+	return nil
+}
+
+// traceBinding writes a line of the ParameterBinding trace while
+// Trace-Command listens to it
+func (rs *Runspace) traceBinding(depth int, format string, args ...interface{}) {
+	if rs.tracer != nil {
+		rs.tracer(strings.Repeat("    ", depth) + fmt.Sprintf(format, args...))
+	}
+}
+
+// traceArg shows an argument the way the binding trace does
+func traceArg(v interface{}) string {
+	if _, ok := v.([]interface{}); ok {
+		return "System.Object[]"
+	}
+	return toString(v)
+}
+
+// parameterTypes maps the lowercased parameter names of a cmdlet to the
+// types its help gives them
+func parameterTypes(c *Cmdlet) map[string]string {
+	types := map[string]string{}
+	if c.Function != nil {
+		for _, p := range c.Params {
+			types[strings.ToLower(p.Name)] = p.Type
+			if p.Type == "" {
+				types[strings.ToLower(p.Name)] = "Object"
+			}
+		}
+		return types
+	}
+	if t, ok := loadHelp()[strings.ToLower(c.Name)]; ok {
+		for _, p := range t.Parameters {
+			types[strings.ToLower(p.Name)] = p.Type
+		}
+	}
+	return types
+}
+
+// hasParamType reports whether a value already has a parameter's type, so
+// binding it needs no conversion. Help types are short names such as
+// String[] or ADUser; an empty one is String.
+func hasParamType(v interface{}, typ string) bool {
+	typ = strings.ToLower(strings.TrimSuffix(typ, "[]"))
+	switch typ {
+	case "object", "psobject":
+		return true
+	case "":
+		typ = "string"
+	}
+	if v == nil {
+		return true
+	}
+	for _, name := range typeHierarchy(v) {
+		name = strings.ToLower(name)
+		if name == typ || strings.HasSuffix(name, "."+typ) {
+			return true
+		}
+	}
+	return false
+}
+
+// convertsToParamType reports whether a value can be converted to a
+// parameter's type. The identity types of the simulated modules, such as
+// ADUser, accept any value and resolve it when the cmdlet runs.
+func convertsToParamType(v interface{}, typ string) bool {
+	if typ == "" {
+		typ = "String"
+	}
+	full, ok := resolveTypeName(typ)
+	if !ok {
+		return true
+	}
+	_, err := convertTo(v, full)
+	return err == nil
+}
+
+// undeclaredParam is a -Name argument a simple function doesn't declare;
+// an empty one marks the value that follows as the argument given with a colon
+type undeclaredParam string
+
+// bindArguments evaluates a command's arguments and binds them to the cmdlet's parameters
+func (rs *Runspace) bindArguments(c *Call, cmd *CommandAst) error {
+	name := c.Cmdlet.Name
+	c.sets = c.Cmdlet.parameterSets()
+	c.types = parameterTypes(c.Cmdlet)
+	bind := func(p *Parameter, v interface{}) error {
+		rs.traceBinding(1, "BIND arg [%s] to parameter [%s]", traceArg(v), p.Name)
+		if p.Mandatory && !p.Switch && !p.AllowEmpty {
+			if v == nil {
+				return c.Errorf("Cannot bind argument to parameter '%s' because it is null.", p.Name)
+			}
+			if s, ok := v.(string); ok && s == "" {
+				return c.Errorf("Cannot bind argument to parameter '%s' because it is an empty string.", p.Name)
+			}
+		}
+		if f := c.Cmdlet.Function; f != nil {
+			converted, err := f.transform(c, p, v)
+			if err != nil {
+				return err
+			}
+			v = converted
+		}
+		if err := c.bindParam(p, v); err != nil {
+			return err
+		}
+		rs.traceBinding(2, "BIND arg [%s] to param [%s] SUCCESSFUL", traceArg(v), p.Name)
+		return nil
+	}
+	lookup := func(node Node, param string) (*Parameter, error) {
+		p, matches := c.Cmdlet.matchParam(param)
+		switch {
+		case p != nil:
+			return p, nil
+		case len(matches) > 0:
+			return nil, rs.newError(node, name, fmt.Sprintf("Parameter cannot be processed because the parameter name '%s' is ambiguous. Possible matches include: -%s.", param, strings.Join(matches, " -")))
+		}
+		return nil, rs.newError(node, name, fmt.Sprintf("A parameter cannot be found that matches parameter name '%s'.", param))
+	}
+
+	rs.traceBinding(0, "BIND NAMED cmd line args [%s]", name)
+	var positional []interface{}
+	elems := cmd.Elements
+	for i := 0; i < len(elems); i++ {
+		el := elems[i]
+		if el.Splatted {
+			switch v := rs.variableValue(el.Arg.(*VariableExpr).Name).(type) {
+			case *Hashtable:
+				for _, k := range v.Keys() {
+					p, err := lookup(el, toString(k))
+					if err != nil {
+						return err
+					}
+					val, _ := v.Get(k)
+					if err := bind(p, val); err != nil {
+						return err
+					}
+				}
+			case nil:
+			default:
+				positional = append(positional, asList(v)...)
+			}
+			continue
+		}
+		if el.Param == "" {
+			v, err := rs.eval(el.Arg)
+			if err != nil {
+				return err
+			}
+			positional = append(positional, v)
+			continue
+		}
+		p, err := lookup(el, el.Param)
+		if err != nil {
+			// A simple function collects the parameters it doesn't declare in
+			// $args, in order with its other unbound arguments
+			if f := c.Cmdlet.Function; f != nil && !f.Advanced {
+				positional = append(positional, undeclaredParam("-"+el.Param))
+				if el.Colon {
+					v, err := rs.eval(el.Arg)
+					if err != nil {
+						return err
+					}
+					positional = append(positional, undeclaredParam(""), v)
+				}
+				continue
+			}
+			return err
+		}
+		var v interface{} = true
+		switch {
+		case el.Colon:
+			val, err := rs.eval(el.Arg)
+			if err != nil {
+				return err
+			}
+			v = val
+			if p.Switch {
+				v = toBool(val)
+			}
+		case p.Switch:
+		case i+1 < len(elems) && elems[i+1].Param == "" && !elems[i+1].Splatted:
+			i++
+			val, err := rs.eval(elems[i].Arg)
+			if err != nil {
+				return err
+			}
+			v = val
+		default:
+			return rs.newError(el, name, fmt.Sprintf("Missing an argument for parameter '%s'. Specify a parameter of type 'System.Object' and try again.", p.Name))
+		}
+		if err := bind(p, v); err != nil {
+			return err
+		}
+	}
+
+	rs.traceBinding(0, "BIND POSITIONAL cmd line args [%s]", name)
+	var remaining *Parameter
+	for _, p := range c.Cmdlet.Params {
+		if p.Remaining {
+			remaining = p
+		}
+	}
+	var rest []interface{}
+	for i := 0; i < len(positional); i++ {
+		v := positional[i]
+		if name, ok := v.(undeclaredParam); ok {
+			if name != "" {
+				c.args = append(c.args, string(name))
+				continue
+			}
+			// The value given to an undeclared parameter with a colon
+			i++
+			c.args = append(c.args, positional[i])
+			continue
+		}
+		target := c.positionalTarget(v)
+		if target == nil {
+			if f := c.Cmdlet.Function; remaining == nil && f != nil && !f.Advanced {
+				c.args = append(c.args, v)
+				continue
+			}
+			if remaining == nil {
+				return rs.newError(cmd, name, fmt.Sprintf("A positional parameter cannot be found that accepts argument '%s'.", toString(v)))
+			}
+			rest = append(rest, v)
+			continue
+		}
+		if err := bind(target, v); err != nil {
+			return err
+		}
+	}
+	if rest != nil {
+		key := strings.ToLower(remaining.Name)
+		if existing, ok := c.Bound[key]; ok {
+			rest = append([]interface{}{existing}, rest...)
+		}
+		c.Bound[key] = rest
+	}
+	if c.Has("ErrorAction") {
+		if _, ok := actionPreference(c.Get("ErrorAction")); !ok {
+			return c.Errorf("Cannot bind parameter 'ErrorAction'. Cannot convert value \"%s\" to type \"System.Management.Automation.ActionPreference\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again:\n%s\"", c.String("ErrorAction"), c.String("ErrorAction"), strings.Join(actionPreferences, ", "))
+		}
+	}
+	// -ErrorVariable starts empty unless a + asks to add to it
+	if v := c.String("ErrorVariable"); v != "" && !strings.HasPrefix(v, "+") {
+		if err := rs.assignVariable(v, []interface{}{}); err != nil {
+			return c.Errorf("%s", err.Error())
+		}
+	}
+
+	rs.traceBinding(0, "MANDATORY PARAMETER CHECK on cmdlet [%s]", name)
+	if missing := c.resolveSets(c.HasInput); missing != nil {
+		return c.Errorf("Cannot process command because of one or more missing mandatory parameters: %s.", strings.Join(missing, " "))
+	}
+	if !c.HasInput && len(c.sets) > 1 && !strings.EqualFold(c.ParameterSet, c.Cmdlet.parameterSets()[0]) {
+		return c.Errorf("%s", ambiguousParameterSet)
+	}
+	c.cmdlineSets = c.sets
+	return nil
+}
+
+// positionalTarget picks the parameter the next positional argument binds
+// to: the one with the lowest free position in the parameter sets still
+// possible. When parameters of different sets share that position, the
+// one whose type the argument already has wins, so a script block given to
+// Where-Object binds to -FilterScript and a name binds to -Property.
+func (c *Call) positionalTarget(v interface{}) *Parameter {
+	var candidates []*Parameter
+	for _, p := range c.Cmdlet.Params {
+		if p.Position == 0 || c.Has(p.Name) || len(c.setsWith(p)) == 0 {
+			continue
+		}
+		switch {
+		case len(candidates) == 0 || p.Position < candidates[0].Position:
+			candidates = []*Parameter{p}
+		case p.Position == candidates[0].Position:
+			candidates = append(candidates, p)
+		}
+	}
+	for _, p := range candidates {
+		if hasParamType(v, c.types[strings.ToLower(p.Name)]) {
+			return p
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return nil
+}
+
+// resolveSets keeps the parameter sets whose mandatory parameters are all
+// bound and picks the one the call runs in: the only one left, else the
+// default. While pipeline input is pending, parameters that take it may
+// still be unbound. When no set is left it returns the mandatory
+// parameters missing from the most likely set.
+func (c *Call) resolveSets(pending bool) []string {
+	var viable, missing []string
+	for _, set := range c.sets {
+		var unbound []string
+		for _, p := range c.Cmdlet.Params {
+			if p.Mandatory && p.inSet(set) && !c.Has(p.Name) && !(pending && p.takesPipeline()) {
+				unbound = append(unbound, p.Name)
+			}
+		}
+		if len(unbound) == 0 {
+			viable = append(viable, set)
+		} else if missing == nil {
+			missing = unbound
+		}
+	}
+	if len(viable) == 0 {
+		return missing
+	}
+	c.sets = viable
+	c.ParameterSet = viable[0]
+	if def := c.Cmdlet.parameterSets()[0]; containsFold(viable, def) {
+		c.ParameterSet = def
+	}
+	return nil
+}
+
+// pipelineProperty finds the property of a pipeline object named like a
+// parameter or one of its aliases. The keys of a hashtable are not
+// properties, as in PowerShell.
+func (rs *Runspace) pipelineProperty(v interface{}, p *Parameter) (interface{}, bool) {
+	for _, name := range append([]string{p.Name}, p.Aliases...) {
+		switch o := v.(type) {
+		case nil, *Hashtable:
+			return nil, false
+		case *PSObject:
+			if val, ok := o.Get(name); ok {
+				return val, true
+			}
+		default:
+			if val, err := rs.getMember(v, name); err == nil && val != nil {
+				return val, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// unbindPipeline restores the parameters bound from the previous pipeline object
+func (c *Call) unbindPipeline() {
+	for _, name := range c.piped {
+		delete(c.Bound, strings.ToLower(name))
+	}
+	c.piped = nil
+	c.sets = c.cmdlineSets
+}
+
+// bindPipeline binds a pipeline object to the parameters that take
+// pipeline input. Parameters whose type the object already has are tried
+// before those it has to be converted to, and by value before by property
+// name; only one parameter binds the object itself.
+func (c *Call) bindPipeline(v interface{}) error {
+	rs := c.Runspace
+	name := c.Cmdlet.Name
+	rs.traceBinding(0, "BIND PIPELINE object to parameters: [%s]", name)
+	rs.traceBinding(1, "PIPELINE object TYPE = [%s]", typeName(v))
+	rs.traceBinding(1, "RESTORING pipeline parameter's original values")
+	c.unbindPipeline()
+	bound, byValue := false, false
+	for _, pass := range []struct{ byName, coerce bool }{{false, false}, {true, false}, {false, true}, {true, true}} {
+		for _, p := range c.Cmdlet.Params {
+			if c.Has(p.Name) || len(c.setsWith(p)) == 0 {
+				continue
+			}
+			arg, kind := v, "ValueFromPipeline"
+			switch {
+			case pass.byName && p.ValueFromPipelineByPropertyName:
+				value, ok := rs.pipelineProperty(v, p)
+				if !ok {
+					continue
+				}
+				arg, kind = value, "ValueFromPipelineByPropertyName"
+			case pass.byName, !p.ValueFromPipeline, byValue:
+				continue
+			}
+			coercion := "NO COERCION"
+			if pass.coerce {
+				coercion = "WITH COERCION"
+			}
+			rs.traceBinding(1, "Parameter [%s] PIPELINE INPUT %s %s", p.Name, kind, coercion)
+			rs.traceBinding(1, "BIND arg [%s] to parameter [%s]", traceArg(arg), p.Name)
+			typ := c.types[strings.ToLower(p.Name)]
+			if !hasParamType(arg, typ) && !(pass.coerce && convertsToParamType(arg, typ)) {
+				rs.traceBinding(2, "BIND arg [%s] to param [%s] SKIPPED", traceArg(arg), p.Name)
+				continue
+			}
+			if pass.coerce && !hasParamType(arg, typ) {
+				rs.traceBinding(2, "COERCE arg to [%s]", typ)
+			}
+			if f := c.Cmdlet.Function; f != nil {
+				converted, err := f.transform(c, p, arg)
+				if err != nil {
+					re := err.(*RuntimeError)
+					re.TargetObject = v
+					return re
+				}
+				arg = converted
+			}
+			if err := c.bindParam(p, arg); err != nil {
+				continue
+			}
+			rs.traceBinding(2, "BIND arg [%s] to param [%s] SUCCESSFUL", traceArg(arg), p.Name)
+			c.piped = append(c.piped, p.Name)
+			bound = true
+			byValue = byValue || !pass.byName
+		}
+	}
+	if !bound {
+		return c.inputError(v, "The input object cannot be bound to any parameters for the command either because the command does not take pipeline input or the input and its properties do not match any of the parameters that take pipeline input.")
+	}
+	rs.traceBinding(0, "MANDATORY PARAMETER CHECK on cmdlet [%s]", name)
+	if missing := c.resolveSets(false); missing != nil {
+		return c.inputError(v, "The input object cannot be bound because it did not contain the information required to bind all mandatory parameters:  "+strings.Join(missing, " "))
+	}
+	return nil
+}
+
+// inputError is the error about a pipeline object the binder could not bind
+func (c *Call) inputError(v interface{}, msg string) error {
+	re := c.Errorf("%s", msg).(*RuntimeError)
+	re.TargetObject = v
+	return re
+}
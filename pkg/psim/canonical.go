@@ -0,0 +1,801 @@
+package psim
+
+import (
+	"strings"
+)
+
+// A script's canonical form spells out what the script does in one fixed
+// way: aliases expanded to the commands they stand for, parameters named
+// in full, positional arguments given by name, named arguments in the
+// order the command declares its parameters, and one layout of whitespace.
+// Comments are dropped.
+
+// Canonical rewrites a script in the form lessons teach, with full command
+// and parameter names in place of aliases, abbreviations and positional
+// arguments
+func Canonical(src string) (string, error) {
+	return canonical(src, false)
+}
+
+// Equivalent reports whether two scripts are the same code written
+// differently. Aliases, abbreviated parameter names, positional arguments,
+// parameter order, whitespace and the casing of names don't matter, nor
+// does the casing of the property names a command is given; the contents
+// of other strings do.
+func Equivalent(a, b string) bool {
+	ca, err := canonical(a, true)
+	if err != nil {
+		return false
+	}
+	cb, err := canonical(b, true)
+	return err == nil && ca == cb
+}
+
+// Identical reports whether two scripts differ only in layout and
+// comments. Unlike Equivalent, an alias or a positional argument in one
+// and not the other tells them apart.
+func Identical(a, b string) bool {
+	wa, err := written(a)
+	if err != nil {
+		return false
+	}
+	wb, err := written(b)
+	return err == nil && wa == wb
+}
+
+// written lays a script out the one fixed way, leaving its commands and
+// arguments as they are written
+func written(src string) (string, error) {
+	block, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	p := &printer{rs: newResolver(), literal: true}
+	p.scriptBody(block)
+	return p.String(), nil
+}
+
+func canonical(src string, fold bool) (string, error) {
+	block, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	p := &printer{rs: newResolver(), fold: fold}
+	p.scriptBody(block)
+	return p.String(), nil
+}
+
+// printer writes an AST in canonical form
+type printer struct {
+	strings.Builder
+	rs      *Runspace // resolves command names and their parameters
+	fold    bool      // lowercase the names PowerShell reads without regard to case
+	literal bool      // leave commands and their arguments as the script writes them
+	depth   int
+}
+
+// name writes a command, parameter, variable, member or type name
+func (p *printer) name(s string) string {
+	if p.fold {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+func (p *printer) newline() {
+	p.WriteString("\n" + strings.Repeat("    ", p.depth))
+}
+
+func (p *printer) statements(stmts []Statement, sep string) {
+	for i, s := range stmts {
+		if i > 0 {
+			if sep == "\n" {
+				p.newline()
+			} else {
+				p.WriteString(sep)
+			}
+		}
+		p.statement(s)
+	}
+}
+
+// block writes { statements }, one statement to a line
+func (p *printer) block(stmts []Statement) {
+	if len(stmts) == 0 {
+		p.WriteString("{}")
+		return
+	}
+	p.WriteString("{")
+	p.depth++
+	for _, s := range stmts {
+		p.newline()
+		p.statement(s)
+	}
+	p.depth--
+	p.newline()
+	p.WriteString("}")
+}
+
+func (p *printer) scriptBody(b *ScriptBlockAst) {
+	first := true
+	next := func() {
+		if !first {
+			p.newline()
+		}
+		first = false
+	}
+	if b.Params != nil {
+		next()
+		p.paramBlock(b.Params)
+	}
+	if !b.Named {
+		if len(b.Body) > 0 {
+			next()
+			p.statements(b.Body, "\n")
+		}
+		return
+	}
+	for _, named := range []struct {
+		keyword string
+		body    []Statement
+	}{{"begin", b.Begin}, {"process", b.Process}, {"end", b.Body}} {
+		if named.body != nil {
+			next()
+			p.WriteString(named.keyword + " ")
+			p.block(named.body)
+		}
+	}
+}
+
+// scriptBlock writes a script block literal, on one line when it holds a
+// single simple statement
+func (p *printer) scriptBlock(b *ScriptBlockAst) {
+	if b.Params == nil && !b.Named && len(b.Body) == 1 {
+		switch b.Body[0].(type) {
+		case *PipelineStatement, *AssignmentStatement:
+			p.WriteString("{ ")
+			p.statement(b.Body[0])
+			p.WriteString(" }")
+			return
+		}
+	}
+	if b.Params == nil && !b.Named && len(b.Body) == 0 {
+		p.WriteString("{}")
+		return
+	}
+	p.WriteString("{")
+	p.depth++
+	p.newline()
+	p.scriptBody(b)
+	p.depth--
+	p.newline()
+	p.WriteString("}")
+}
+
+func (p *printer) paramBlock(b *ParamBlock) {
+	for _, a := range b.Attributes {
+		p.attribute(a)
+		p.newline()
+	}
+	p.WriteString("param(")
+	if len(b.Params) == 0 {
+		p.WriteString(")")
+		return
+	}
+	p.depth++
+	for i, param := range b.Params {
+		if i > 0 {
+			p.WriteString(",")
+		}
+		p.newline()
+		for _, a := range param.Attributes {
+			p.attribute(a)
+			p.newline()
+		}
+		if param.Type != "" {
+			p.WriteString("[" + p.name(param.Type) + "]")
+		}
+		p.WriteString(variableText(p.name(param.Name)))
+		if param.Default != nil {
+			p.WriteString(" = ")
+			p.expr(param.Default)
+		}
+	}
+	p.depth--
+	p.newline()
+	p.WriteString(")")
+}
+
+func (p *printer) attribute(a *AttributeAst) {
+	p.WriteString("[" + p.name(a.Name) + "(")
+	for i, arg := range a.Positional {
+		if i > 0 {
+			p.WriteString(", ")
+		}
+		p.expr(arg)
+	}
+	for i, arg := range a.Named {
+		if i > 0 || len(a.Positional) > 0 {
+			p.WriteString(", ")
+		}
+		p.WriteString(p.name(arg.Name))
+		if arg.Value != nil {
+			p.WriteString(" = ")
+			p.expr(arg.Value)
+		}
+	}
+	p.WriteString(")]")
+}
+
+func (p *printer) label(label string) {
+	if label != "" {
+		p.WriteString(":" + p.name(label) + " ")
+	}
+}
+
+// optional writes a statement that may be left out, such as the parts of a for loop
+func (p *printer) optional(s Statement) {
+	if s != nil {
+		p.statement(s)
+	}
+}
+
+func (p *printer) statement(s Statement) {
+	switch s := s.(type) {
+	case *PipelineStatement:
+		for i, el := range s.Elements {
+			if i > 0 {
+				p.WriteString(" | ")
+			}
+			p.element(el)
+		}
+	case *AssignmentStatement:
+		p.expr(s.Target)
+		p.WriteString(" " + s.Op + " ")
+		p.statement(s.Value)
+	case *IfStatement:
+		for i, c := range s.Clauses {
+			if i > 0 {
+				p.WriteString(" elseif (")
+			} else {
+				p.WriteString("if (")
+			}
+			p.statement(c.Condition)
+			p.WriteString(") ")
+			p.block(c.Body)
+		}
+		if s.Else != nil {
+			p.WriteString(" else ")
+			p.block(s.Else)
+		}
+	case *WhileStatement:
+		p.label(s.Label)
+		p.WriteString("while (")
+		p.statement(s.Condition)
+		p.WriteString(") ")
+		p.block(s.Body)
+	case *DoStatement:
+		p.label(s.Label)
+		p.WriteString("do ")
+		p.block(s.Body)
+		if s.Until {
+			p.WriteString(" until (")
+		} else {
+			p.WriteString(" while (")
+		}
+		p.statement(s.Condition)
+		p.WriteString(")")
+	case *ForStatement:
+		p.label(s.Label)
+		p.WriteString("for (")
+		p.optional(s.Init)
+		p.WriteString("; ")
+		p.optional(s.Condition)
+		p.WriteString("; ")
+		p.optional(s.Step)
+		p.WriteString(") ")
+		p.block(s.Body)
+	case *ForEachStatement:
+		p.label(s.Label)
+		p.WriteString("foreach (" + variableText(p.name(s.Variable)) + " in ")
+		p.statement(s.Collection)
+		p.WriteString(") ")
+		p.block(s.Body)
+	case *SwitchStatement:
+		p.label(s.Label)
+		p.WriteString("switch ")
+		if s.Mode != "" {
+			p.WriteString("-" + s.Mode + " ")
+		}
+		if s.CaseSense {
+			p.WriteString("-casesensitive ")
+		}
+		p.WriteString("(")
+		p.statement(s.Subject)
+		p.WriteString(") {")
+		p.depth++
+		for _, c := range s.Clauses {
+			p.newline()
+			p.expr(c.Condition)
+			p.WriteString(" ")
+			p.block(c.Body)
+		}
+		if s.Default != nil {
+			p.newline()
+			p.WriteString("default ")
+			p.block(s.Default)
+		}
+		p.depth--
+		p.newline()
+		p.WriteString("}")
+	case *BreakStatement:
+		p.WriteString("break")
+		if s.Label != "" {
+			p.WriteString(" " + p.name(s.Label))
+		}
+	case *ContinueStatement:
+		p.WriteString("continue")
+		if s.Label != "" {
+			p.WriteString(" " + p.name(s.Label))
+		}
+	case *ReturnStatement:
+		p.keywordValue("return", s.Value)
+	case *ExitStatement:
+		p.keywordValue("exit", s.Code)
+	case *ThrowStatement:
+		p.keywordValue("throw", s.Value)
+	case *TryStatement:
+		p.WriteString("try ")
+		p.block(s.Body)
+		for _, c := range s.Catches {
+			p.WriteString(" catch ")
+			for i, t := range c.Types {
+				if i > 0 {
+					p.WriteString(", ")
+				}
+				p.WriteString("[" + p.name(t) + "] ")
+			}
+			p.block(c.Body)
+		}
+		if s.Finally != nil {
+			p.WriteString(" finally ")
+			p.block(s.Finally)
+		}
+	case *TrapStatement:
+		p.WriteString("trap ")
+		if s.Type != "" {
+			p.WriteString("[" + p.name(s.Type) + "] ")
+		}
+		p.block(s.Body)
+	case *FunctionDefinition:
+		if s.Filter {
+			p.WriteString("filter ")
+		} else {
+			p.WriteString("function ")
+		}
+		p.WriteString(p.name(s.Name) + " {")
+		p.depth++
+		p.newline()
+		p.scriptBody(s.Body)
+		p.depth--
+		p.newline()
+		p.WriteString("}")
+	}
+}
+
+func (p *printer) keywordValue(keyword string, value Statement) {
+	p.WriteString(keyword)
+	if value != nil {
+		p.WriteString(" ")
+		p.statement(value)
+	}
+}
+
+func (p *printer) element(el PipelineElement) {
+	switch el := el.(type) {
+	case *CommandAst:
+		p.command(el)
+	case *CommandExpression:
+		p.expr(el.Expr)
+		p.redirections(el.Redirections)
+	}
+}
+
+func (p *printer) redirections(rs []Redirection) {
+	for _, r := range rs {
+		p.WriteString(" " + r.Op)
+		if r.Target != nil {
+			p.WriteString(" ")
+			p.expr(r.Target)
+		}
+	}
+}
+
+// BoundArgument is an argument of a command and the parameter it binds to
+type BoundArgument struct {
+	Parameter  string // the parameter's full name
+	Value      Expr   // nil for a switch
+	Colon      bool   // a switch given a value, as in -Force:$false
+	Positional bool   // the argument is bound by position
+}
+
+func (p *printer) command(cmd *CommandAst) {
+	var cmdlet *Cmdlet
+	name, bare := cmd.Name.(*StringExpr)
+	switch {
+	case cmd.Invocation != "":
+		p.WriteString(cmd.Invocation + " ")
+		p.expr(cmd.Name)
+	case bare && p.literal:
+		p.WriteString(name.Value)
+	case bare:
+		if c, ok := p.rs.resolveCommand(name.Value); ok {
+			cmdlet = c
+			p.WriteString(p.name(c.Name))
+		} else {
+			p.WriteString(p.name(name.Value))
+		}
+	default:
+		p.expr(cmd.Name)
+	}
+	if args, ok := bindStatic(cmdlet, cmd.Elements); ok {
+		for _, a := range args {
+			p.WriteString(" -" + p.name(a.Parameter))
+			switch {
+			case a.Value == nil:
+			case a.Colon:
+				p.WriteString(":")
+				p.expr(a.Value)
+			case p.fold && propertyParameters[strings.ToLower(a.Parameter)]:
+				p.WriteString(" ")
+				p.propertyNames(a.Value)
+			default:
+				p.WriteString(" ")
+				p.expr(a.Value)
+			}
+		}
+		for _, el := range cmd.Elements {
+			if el.Splatted {
+				p.WriteString(" @" + p.name(el.Arg.(*VariableExpr).Name))
+			}
+		}
+	} else {
+		p.elementsAsWritten(cmdlet, cmd.Elements)
+	}
+	p.redirections(cmd.Redirections)
+}
+
+// propertyParameters are the parameters that take property names, which
+// PowerShell matches without regard to case
+var propertyParameters = map[string]bool{
+	"property":        true,
+	"properties":      true,
+	"expandproperty":  true,
+	"excludeproperty": true,
+}
+
+// propertyNames writes the argument of a parameter that takes property
+// names, lowercasing the names given as strings
+func (p *printer) propertyNames(e Expr) {
+	switch e := e.(type) {
+	case *StringExpr:
+		p.WriteString(quoteString(strings.ToLower(e.Value)))
+	case *ArrayLiteralExpr:
+		if len(e.Elements) == 1 {
+			p.WriteString(",")
+		}
+		for i, el := range e.Elements {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.propertyNames(el)
+		}
+	default:
+		p.expr(e)
+	}
+}
+
+// elementsAsWritten writes a command's arguments in their own order, only
+// spelling out the parameter names it can resolve
+func (p *printer) elementsAsWritten(cmdlet *Cmdlet, elems []CommandElement) {
+	for _, el := range elems {
+		p.WriteString(" ")
+		switch {
+		case el.Splatted:
+			p.WriteString("@" + p.name(el.Arg.(*VariableExpr).Name))
+		case el.Param != "":
+			param := el.Param
+			if cmdlet != nil {
+				if found := cmdlet.findParam(param); found != nil {
+					param = found.Name
+				}
+			}
+			p.WriteString("-" + p.name(param))
+			if el.Colon {
+				p.WriteString(":")
+				p.expr(el.Arg)
+			}
+		default:
+			p.expr(el.Arg)
+		}
+	}
+}
+
+// bindStatic works out the parameter each argument of a command binds to
+// without running it, the way bindArguments would, and returns the named
+// arguments in the order the command declares its parameters. It gives up
+// on what it can't settle from the source alone, such as a parameter the
+// command doesn't have or an argument that binds to nothing.
+func bindStatic(cmdlet *Cmdlet, elems []CommandElement) ([]BoundArgument, bool) {
+	if cmdlet == nil {
+		return nil, false
+	}
+	c := &Call{Cmdlet: cmdlet, Bound: map[string]interface{}{}, sets: cmdlet.parameterSets(), types: parameterTypes(cmdlet)}
+	bound := map[*Parameter]BoundArgument{}
+	bind := func(param *Parameter, arg BoundArgument) bool {
+		sets := c.setsWith(param)
+		if c.Has(param.Name) || len(sets) == 0 {
+			return false
+		}
+		c.sets = sets
+		c.Bound[strings.ToLower(param.Name)] = nil
+		bound[param] = arg
+		return true
+	}
+	var positional []Expr
+	for i := 0; i < len(elems); i++ {
+		el := elems[i]
+		if el.Splatted {
+			continue
+		}
+		if el.Param == "" {
+			positional = append(positional, el.Arg)
+			continue
+		}
+		param := cmdlet.findParam(el.Param)
+		if param == nil {
+			return nil, false
+		}
+		arg := BoundArgument{Parameter: param.Name}
+		switch {
+		case el.Colon:
+			arg.Value, arg.Colon = el.Arg, param.Switch
+		case param.Switch:
+		case i+1 < len(elems) && elems[i+1].Param == "" && !elems[i+1].Splatted:
+			i++
+			arg.Value = elems[i].Arg
+		default:
+			return nil, false
+		}
+		if !bind(param, arg) {
+			return nil, false
+		}
+	}
+	var rest []Expr
+	for _, e := range positional {
+		target := c.positionalTarget(sampleValue(e))
+		if target == nil {
+			rest = append(rest, e)
+			continue
+		}
+		if !bind(target, BoundArgument{Parameter: target.Name, Value: e, Positional: true}) {
+			return nil, false
+		}
+	}
+	if len(rest) > 0 {
+		var remaining *Parameter
+		for _, param := range cmdlet.Params {
+			if param.Remaining {
+				remaining = param
+			}
+		}
+		if remaining == nil {
+			return nil, false
+		}
+		var value Expr = &ArrayLiteralExpr{Elements: rest}
+		if len(rest) == 1 {
+			value = rest[0]
+		}
+		if !bind(remaining, BoundArgument{Parameter: remaining.Name, Value: value, Positional: true}) {
+			return nil, false
+		}
+	}
+	var args []BoundArgument
+	for _, param := range append(append([]*Parameter{}, cmdlet.Params...), commonParameters...) {
+		if arg, ok := bound[param]; ok {
+			args = append(args, arg)
+		}
+	}
+	return args, true
+}
+
+// sampleValue stands in for an argument when binding without running the
+// script; only its type matters
+func sampleValue(e Expr) interface{} {
+	switch x := e.(type) {
+	case *ScriptBlockExpr:
+		return &ScriptBlock{Ast: x.Block}
+	case *StringExpr:
+		return x.Value
+	case *ExpandableStringExpr:
+		return x.Raw
+	case *ConstantExpr:
+		return x.Value
+	case *HashtableExpr:
+		return NewHashtable()
+	case *ArrayLiteralExpr, *ArrayExpr:
+		return []interface{}{}
+	}
+	return nil
+}
+
+func (p *printer) expr(e Expr) {
+	switch e := e.(type) {
+	case *ConstantExpr:
+		p.WriteString(p.name(e.Text))
+	case *StringExpr:
+		p.str(e)
+	case *ExpandableStringExpr:
+		p.expandable(e)
+	case *VariableExpr:
+		p.WriteString(variableText(p.name(e.Name)))
+	case *ArrayLiteralExpr:
+		if len(e.Elements) == 1 {
+			p.WriteString(",")
+		}
+		for i, el := range e.Elements {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.expr(el)
+		}
+	case *ArrayExpr:
+		p.WriteString("@(")
+		p.statements(e.Body, "; ")
+		p.WriteString(")")
+	case *SubExpr:
+		p.WriteString("$(")
+		p.statements(e.Body, "; ")
+		p.WriteString(")")
+	case *ParenExpr:
+		p.WriteString("(")
+		p.statement(e.Pipeline)
+		p.WriteString(")")
+	case *HashtableExpr:
+		p.WriteString("@{")
+		for i, entry := range e.Entries {
+			if i > 0 {
+				p.WriteString("; ")
+			}
+			if key, ok := entry.Key.(*StringExpr); ok && isSimpleName(key.Value) {
+				p.WriteString(p.name(key.Value))
+			} else {
+				p.expr(entry.Key)
+			}
+			p.WriteString(" = ")
+			p.statement(entry.Value)
+		}
+		p.WriteString("}")
+	case *ScriptBlockExpr:
+		p.scriptBlock(e.Block)
+	case *BinaryExpr:
+		p.expr(e.Left)
+		if e.Op == ".." {
+			p.WriteString(e.Op)
+		} else {
+			p.WriteString(" " + e.Op + " ")
+		}
+		p.expr(e.Right)
+	case *UnaryExpr:
+		if e.Postfix {
+			p.expr(e.Operand)
+			p.WriteString(e.Op)
+			return
+		}
+		p.WriteString(e.Op)
+		if len(e.Op) > 1 && e.Op[0] == '-' && e.Op != "--" {
+			p.WriteString(" ")
+		}
+		p.expr(e.Operand)
+	case *ConvertExpr:
+		p.WriteString("[" + p.name(e.Type) + "]")
+		p.expr(e.Operand)
+	case *TypeExpr:
+		p.WriteString("[" + p.name(e.Type) + "]")
+	case *MemberExpr:
+		p.expr(e.Target)
+		p.member(e.Member, e.Static)
+	case *InvokeMemberExpr:
+		p.expr(e.Target)
+		p.member(e.Member, e.Static)
+		p.WriteString("(")
+		for i, arg := range e.Args {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.expr(arg)
+		}
+		p.WriteString(")")
+	case *IndexExpr:
+		p.expr(e.Target)
+		p.WriteString("[")
+		p.expr(e.Index)
+		p.WriteString("]")
+	}
+}
+
+func (p *printer) member(m Expr, static bool) {
+	if static {
+		p.WriteString("::")
+	} else {
+		p.WriteString(".")
+	}
+	if name, ok := m.(*StringExpr); ok && name.Bare {
+		p.WriteString(p.name(name.Value))
+		return
+	}
+	p.expr(m)
+}
+
+// str writes a string constant. A bareword argument keeps its form, as
+// lessons write it; otherwise strings are single-quoted. For comparison
+// every string is quoted, so chrome* and 'chrome*' are the same.
+func (p *printer) str(s *StringExpr) {
+	switch {
+	case p.fold:
+		p.WriteString(quoteString(s.Value))
+	case s.Bare && s.Literal != "":
+		p.WriteString(s.Literal)
+	case s.Bare:
+		p.WriteString(s.Value)
+	case strings.HasPrefix(s.Literal, "@'"):
+		p.WriteString(s.Literal)
+	default:
+		p.WriteString(quoteString(s.Value))
+	}
+}
+
+// expandable writes a double-quoted string, single-quoted when it expands nothing
+func (p *printer) expandable(s *ExpandableStringExpr) {
+	var text strings.Builder
+	for _, part := range s.Parts {
+		str, ok := part.(*StringExpr)
+		if !ok {
+			p.WriteString(s.Raw)
+			return
+		}
+		text.WriteString(str.Value)
+	}
+	if !p.fold && strings.HasPrefix(s.Raw, "@\"") {
+		p.WriteString(s.Raw)
+		return
+	}
+	p.WriteString(quoteString(text.String()))
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// variableText writes a variable reference, in braces when its name needs them
+func variableText(name string) string {
+	for _, r := range name {
+		if !(r == '_' || r == ':' || r == '?' || r == '^' || r == '$' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return "${" + name + "}"
+		}
+	}
+	return "$" + name
+}
+
+// isSimpleName reports whether a hashtable key can be written without quotes
+func isSimpleName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package psim
+
+import "testing"
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Get-Process chrome* | Select-Object Name, CPU", "gps chrome* | select Name,CPU", true},
+		{"Get-Process chrome* | select name,cpu", "Get-Process chrome* | Select-Object Name, CPU", true},
+		{"Get-Process | Sort-Object cpu -Descending", "Get-Process | Sort-Object -Property CPU -Descending", true},
+		{"Get-Process | Select-Object -ExpandProperty name", "Get-Process | Select-Object -ExpandProperty 'Name'", true},
+		// Only property names fold; other strings keep their case
+		{"Write-Output Hello", "Write-Output hello", false},
+		{"Get-Process | Select-Object @{n='CPU'; e={$_.CPU}}", "Get-Process | Select-Object @{n='cpu'; e={$_.CPU}}", false},
+		{"Get-Process chrome* | Select-Object Name, CPU", "Get-Process chrome* | Select-Object Name", false},
+	}
+	for _, tt := range tests {
+		if got := Equivalent(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equivalent(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Cmdlet is a simulated PowerShell command.
+//
+// Begin runs once before any input, Process once per pipeline input object
+// (or once with no input when the cmdlet starts the pipeline) and End once
+// after all input. A cmdlet without Process receives its input buffered in
+// Call.Inputs when End runs.
+type Cmdlet struct {
+	Name       string
+	Params     []*Parameter
+	DefaultSet string    // parameter set used when the arguments fit several; the first set named when empty
+	Function   *Function // set for commands written in script: functions, script blocks and script files
+	Begin      func(c *Call) error
+	Process    func(c *Call) error
+	End        func(c *Call) error
+}
+
+// Parameter describes a cmdlet parameter
+type Parameter struct {
+	Name       string
+	Aliases    []string
+	Position   int      // 1-based position for positional arguments, 0 for named-only
+	Switch     bool     // takes no argument
+	Remaining  bool     // collects any unbound positional arguments
+	Mandatory  bool     // must be bound in the parameter sets it belongs to
+	AllowEmpty bool     // mandatory but accepts $null and empty strings
+	Sets       []string // parameter sets the parameter belongs to; empty means every set
+	Type       string   // .NET type of a function parameter; cmdlets take theirs from the help
+
+	ValueFromPipeline               bool // binds the pipeline object itself
+	ValueFromPipelineByPropertyName bool // binds the property of the pipeline object with the parameter's name or alias
+}
+
+// commonParameters are accepted by every cmdlet
+var commonParameters = []*Parameter{
+	{Name: "ErrorAction", Aliases: []string{"ea"}},
+	{Name: "WarningAction", Aliases: []string{"wa"}},
+	{Name: "ErrorVariable", Aliases: []string{"ev"}},
+	{Name: "OutVariable", Aliases: []string{"ov"}},
+	{Name: "Verbose", Aliases: []string{"vb"}, Switch: true},
+	{Name: "Debug", Aliases: []string{"db"}, Switch: true},
+	{Name: "WhatIf", Aliases: []string{"wi"}, Switch: true},
+	{Name: "Confirm", Aliases: []string{"cf"}, Switch: true},
+}
+
+// findParam resolves a parameter by name, alias or unambiguous prefix
+func (c *Cmdlet) findParam(name string) *Parameter {
+	p, _ := c.matchParam(name)
+	return p
+}
+
+// matchParam resolves a parameter by name, alias or prefix. When the name
+// is a prefix of several parameters it returns their names instead.
+func (c *Cmdlet) matchParam(name string) (*Parameter, []string) {
+	all := append([]*Parameter{}, c.Params...)
+	// Simple functions take no common parameters; -Verbose ends up in $args
+	if c.Function == nil || c.Function.Advanced {
+		all = append(all, commonParameters...)
+	}
+	for _, p := range all {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+		for _, a := range p.Aliases {
+			if strings.EqualFold(a, name) {
+				return p, nil
+			}
+		}
+	}
+	lower := strings.ToLower(name)
+	var matches []*Parameter
+	for _, p := range all {
+		if strings.HasPrefix(strings.ToLower(p.Name), lower) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	var names []string
+	for _, p := range matches {
+		names = append(names, p.Name)
+	}
+	return nil, names
+}
+
+// Call is the state of one cmdlet invocation
+type Call struct {
+	Cmdlet   *Cmdlet
+	Runspace *Runspace
+	Bound    map[string]interface{} // bound parameters keyed by lowercased parameter name
+	Input    interface{}            // the current pipeline object during Process
+	HasInput bool                   // true when the cmdlet receives pipeline input
+	Inputs   []interface{}          // buffered input for cmdlets without Process
+	State    interface{}            // per-invocation state for the cmdlet's own use
+
+	ParameterSet string // the parameter set the bound parameters resolved to
+
+	node      Node
+	emit      emitter
+	errorSink func(*RuntimeError)
+	run       *pipelineRun
+	index     int
+	stopped   *RuntimeError // the error an ErrorAction of Stop turned terminating
+
+	sets        []string          // parameter sets the bound parameters still allow
+	cmdlineSets []string          // sets allowed by the command line alone
+	piped       []string          // parameters bound from the current pipeline object
+	args        []interface{}     // arguments a simple function collects in $args
+	types       map[string]string // parameter types from the help, keyed by lowercased name
+}
+
+// Emit writes an object to the next command in the pipeline
+func (c *Call) Emit(v interface{}) error {
+	if c.stopped != nil {
+		return c.stopped
+	}
+	return c.emit(v)
+}
+
+// EmitAll writes each element of a collection to the pipeline
+func (c *Call) EmitAll(v interface{}) error {
+	if v == nil {
+		return nil
+	}
+	for _, item := range asList(v) {
+		if err := c.Emit(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHost writes text directly to the console, bypassing the pipeline
+func (c *Call) WriteHost(h HostOutput) {
+	c.Runspace.writeStream(StreamHost, h)
+}
+
+// WriteWarning writes to the warning stream
+func (c *Call) WriteWarning(msg string) {
+	c.Runspace.writeStream(StreamWarning, msg)
+}
+
+// WriteVerbose writes to the verbose stream when -Verbose or $VerbosePreference asks for it
+func (c *Call) WriteVerbose(msg string) {
+	pref, _ := c.Runspace.GetVariable("VerbosePreference")
+	if c.Switch("Verbose") || strings.EqualFold(toString(pref), "Continue") {
+		c.Runspace.writeStream(StreamVerbose, msg)
+	}
+}
+
+// WriteError writes a non-terminating error; the cmdlet keeps running. An
+// ErrorAction of Stop makes the error terminating instead, ending the
+// cmdlet at its next Emit or when it returns.
+func (c *Call) WriteError(err error) {
+	rs := c.Runspace
+	re, ok := err.(*RuntimeError)
+	if !ok {
+		re = rs.newError(c.node, c.Cmdlet.Name, err.Error())
+	}
+	rs.failed = true
+	if name := strings.TrimPrefix(c.String("ErrorVariable"), "+"); name != "" {
+		collected := append([]interface{}{}, asList(rs.variableValue(name))...)
+		rs.assignVariable(name, append(collected, re))
+	}
+	switch c.errorAction() {
+	case "Stop":
+		if c.stopped == nil {
+			re.Terminating = true
+			c.stopped = re
+		}
+		return
+	case "Ignore":
+		return
+	case "SilentlyContinue":
+		rs.recordError(re)
+		return
+	}
+	rs.recordError(re)
+	if c.errorSink != nil {
+		c.errorSink(re)
+		return
+	}
+	rs.writeError(re)
+}
+
+// errorAction is the call's -ErrorAction, or else $ErrorActionPreference
+func (c *Call) errorAction() string {
+	if p, ok := actionPreference(c.Get("ErrorAction")); ok && c.Has("ErrorAction") {
+		return p
+	}
+	return c.Runspace.errorPreference()
+}
+
+// halt returns the error an ErrorAction of Stop raised while the cmdlet ran
+func (c *Call) halt(err error) error {
+	if err == nil && c.stopped != nil {
+		return c.stopped
+	}
+	return err
+}
+
+// Errorf returns a terminating error attributed to the cmdlet
+func (c *Call) Errorf(format string, args ...interface{}) error {
+	return c.Runspace.newError(c.node, c.Cmdlet.Name, fmt.Sprintf(format, args...))
+}
+
+// ShouldProcess reports whether the cmdlet should change the system; with
+// -WhatIf, or $WhatIfPreference set by a calling function, it describes the
+// operation instead
+func (c *Call) ShouldProcess(target, operation string) bool {
+	if c.Switch("WhatIf") || !c.Has("WhatIf") && toBool(c.Runspace.variableValue("WhatIfPreference")) {
+		c.WriteHost(HostOutput{Text: fmt.Sprintf("What if: Performing the operation \"%s\" on target \"%s\".", operation, target)})
+		return false
+	}
+	return true
+}
+
+// Stop ends the pipeline early, e.g. once Select-Object -First has enough objects
+func (c *Call) Stop() error {
+	return &stopSignal{run: c.run, index: c.index}
+}
+
+// Has reports whether a parameter was bound
+func (c *Call) Has(name string) bool {
+	_, ok := c.Bound[strings.ToLower(name)]
+	return ok
+}
+
+// Get returns a bound parameter value
+func (c *Call) Get(name string) interface{} {
+	return c.Bound[strings.ToLower(name)]
+}
+
+// String returns a bound parameter as a string
+func (c *Call) String(name string) string {
+	return toString(c.Get(name))
+}
+
+// Strings returns a bound parameter as a list of strings
+func (c *Call) Strings(name string) []string {
+	var out []string
+	for _, v := range asList(c.Get(name)) {
+		out = append(out, toString(v))
+	}
+	return out
+}
+
+// Int returns a bound parameter as an integer, or def when it is not bound
+func (c *Call) Int(name string, def int) (int, error) {
+	if !c.Has(name) {
+		return def, nil
+	}
+	n, err := toInt(c.Get(name))
+	if err != nil {
+		return 0, c.Errorf("Cannot bind parameter '%s'. %s", c.paramName(name), err.Error())
+	}
+	return n, nil
+}
+
+// Switch reports whether a switch parameter is present and true
+func (c *Call) Switch(name string) bool {
+	return c.Has(name) && toBool(c.Get(name))
+}
+
+// ScriptBlock returns a bound parameter as a script block
+func (c *Call) ScriptBlock(name string) (*ScriptBlock, error) {
+	v := c.Get(name)
+	if v == nil {
+		return nil, nil
+	}
+	sb, ok := v.(*ScriptBlock)
+	if !ok {
+		return nil, c.Errorf("Cannot bind parameter '%s'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Management.Automation.ScriptBlock\".", c.paramName(name), toString(v), typeName(v))
+	}
+	return sb, nil
+}
+
+func (c *Call) paramName(name string) string {
+	if p := c.Cmdlet.findParam(name); p != nil {
+		return p.Name
+	}
+	return name
+}
+
+// Invoke runs a script block with $_ set to the given object and returns its output
+func (c *Call) Invoke(sb *ScriptBlock, underscore interface{}) ([]interface{}, error) {
+	var items []interface{}
+	err := c.Runspace.invokeBlock(sb, invocation{underscore: underscore, hasUnder: true}, func(v interface{}) error {
+		items = append(items, v)
+		return nil
+	})
+	return items, err
+}
+
+// HostOutput is text written with Write-Host
+type HostOutput struct {
+	Text            string
+	ForegroundColor string
+	BackgroundColor string
+	NoNewline       bool
+}
+
+// resolveCommand finds the function or cmdlet for a command name, following aliases
+func (rs *Runspace) resolveCommand(name string) (*Cmdlet, bool) {
+	key := strings.ToLower(name)
+	if target, ok := rs.aliases[key]; ok {
+		key = strings.ToLower(target)
+	}
+	if f := rs.scope.function(key); f != nil {
+		return f, true
+	}
+	c, ok := rs.commands[key]
+	return c, ok
+}
+
+// visibleCommands returns the cmdlets and the functions in scope keyed by
+// lowercased name; a function hides a cmdlet of the same name
+func (rs *Runspace) visibleCommands() map[string]*Cmdlet {
+	all := map[string]*Cmdlet{}
+	for k, c := range rs.commands {
+		all[k] = c
+	}
+	var chain []*Scope
+	for sc := rs.scope; sc != nil; sc = sc.parent {
+		chain = append(chain, sc)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		for k, f := range chain[i].functions {
+			all[k] = f
+		}
+	}
+	return all
+}
@@ -0,0 +1,920 @@
+package psim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/couragetogroww/powerhell/pkg/onprem"
+)
+
+// adTypeNames are the .NET type hierarchies of the AD module's objects
+var adTypeNames = map[string][]string{
+	onprem.ClassUser: {"Microsoft.ActiveDirectory.Management.ADUser", "Microsoft.ActiveDirectory.Management.ADAccount",
+		"Microsoft.ActiveDirectory.Management.ADPrincipal", "Microsoft.ActiveDirectory.Management.ADObject", "Microsoft.ActiveDirectory.Management.ADEntity"},
+	onprem.ClassGroup: {"Microsoft.ActiveDirectory.Management.ADGroup", "Microsoft.ActiveDirectory.Management.ADPrincipal",
+		"Microsoft.ActiveDirectory.Management.ADObject", "Microsoft.ActiveDirectory.Management.ADEntity"},
+	onprem.ClassOU: {"Microsoft.ActiveDirectory.Management.ADOrganizationalUnit",
+		"Microsoft.ActiveDirectory.Management.ADObject", "Microsoft.ActiveDirectory.Management.ADEntity"},
+}
+
+// adCommonParams are accepted by every AD cmdlet and ignored: there is only one domain
+var adCommonParams = []*Parameter{{Name: "Server"}, {Name: "Credential"}, {Name: "AuthType"}}
+
+// adObject wraps a directory entry in an ADUser, ADGroup, ADOrganizationalUnit
+// or ADObject carrying the class's default properties plus those requested
+func adObject(o *onprem.Object, properties []string) *PSObject {
+	names := onprem.DefaultProperties(o.ObjectClass)
+	for _, p := range properties {
+		if p == "*" {
+			names = append(names, onprem.ExtendedProperties(o.ObjectClass)...)
+			names = append(names, o.PropertyNames()...)
+			continue
+		}
+		names = append(names, onprem.CanonicalName(p))
+	}
+	sort.SliceStable(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+
+	typeNames, ok := adTypeNames[o.ObjectClass]
+	if !ok {
+		typeNames = []string{"Microsoft.ActiveDirectory.Management.ADObject", "Microsoft.ActiveDirectory.Management.ADEntity"}
+	}
+	obj := NewObject(append([]string(nil), typeNames...)...)
+	for _, name := range names {
+		if obj.Property(name) != nil {
+			continue
+		}
+		v, _ := o.Get(name)
+		obj.Add(name, adValue(v))
+	}
+	dn := o.DistinguishedName
+	obj.ToStringFunc = func(*PSObject) string { return dn }
+	return obj
+}
+
+// adValue converts an attribute value to a PowerShell value
+func adValue(v interface{}) interface{} {
+	if list, ok := v.([]string); ok {
+		return stringsToValues(list)
+	}
+	return v
+}
+
+// adPrincipal is the slimmer object Get-ADGroupMember returns
+func adPrincipal(o *onprem.Object) *PSObject {
+	obj := NewObject("Microsoft.ActiveDirectory.Management.ADPrincipal", "Microsoft.ActiveDirectory.Management.ADObject", "Microsoft.ActiveDirectory.Management.ADEntity").
+		Add("distinguishedName", o.DistinguishedName).
+		Add("name", o.String("Name")).
+		Add("objectClass", o.ObjectClass).
+		Add("objectGUID", o.ObjectGUID).
+		Add("SamAccountName", o.String("SamAccountName")).
+		Add("SID", o.SID)
+	dn := o.DistinguishedName
+	obj.ToStringFunc = func(*PSObject) string { return dn }
+	return obj
+}
+
+// adIdentity extracts the identity from a string or an AD object
+func adIdentity(v interface{}) string {
+	if obj, ok := v.(*PSObject); ok {
+		for _, prop := range []string{"DistinguishedName", "ObjectGUID", "SamAccountName"} {
+			if id, ok := obj.Get(prop); ok && id != nil {
+				return toString(id)
+			}
+		}
+	}
+	return toString(v)
+}
+
+// resolveAD resolves an -Identity argument to a directory entry of a class
+func resolveAD(c *Call, v interface{}, class string) (*onprem.Object, error) {
+	o, err := c.Runspace.directory.Resolve(adIdentity(v), class)
+	if err != nil {
+		return nil, c.Errorf("%s", err.Error())
+	}
+	return o, nil
+}
+
+// adIdentities returns the identities a cmdlet operates on: piped objects or -Identity
+func adIdentities(c *Call) []interface{} {
+	if c.HasInput {
+		return []interface{}{c.Input}
+	}
+	return asList(c.Get("Identity"))
+}
+
+// adBool converts a [bool] parameter argument
+func adBool(c *Call, name string) (bool, error) {
+	switch v := c.Get(name).(type) {
+	case bool:
+		return v, nil
+	case int:
+		return v != 0, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "1":
+			return true, nil
+		case "false", "0":
+			return false, nil
+		}
+	}
+	return false, c.Errorf("Cannot process argument transformation on parameter '%s'. Cannot convert value \"%s\" to type \"System.Boolean\". Boolean parameters accept only Boolean values and numbers, such as $True, $False, 1 or 0.", c.paramName(name), toString(c.Get(name)))
+}
+
+// adFilterResolver resolves $variable and $variable.Property references in a -Filter
+func (rs *Runspace) adFilterResolver(path string) (interface{}, error) {
+	parts := strings.Split(path, ".")
+	v, ok := rs.GetVariable(parts[0])
+	if !ok {
+		return nil, fmt.Errorf("Variable: '%s' found in expression: $%s is not defined.", parts[0], path)
+	}
+	for _, member := range parts[1:] {
+		next, err := rs.getMember(v, member)
+		if err != nil {
+			return nil, err
+		}
+		v = next
+	}
+	switch x := v.(type) {
+	case *PSObject, []interface{}:
+		return toString(x), nil
+	}
+	return v, nil
+}
+
+// filterText returns -Filter as text; the AD and Exchange cmdlets accept
+// the filter as a string or a script block
+func filterText(c *Call) string {
+	if sb, ok := c.Get("Filter").(*ScriptBlock); ok {
+		return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(sb.String()), "{"), "}"))
+	}
+	return strings.TrimSpace(c.String("Filter"))
+}
+
+// adQuery runs the search a Get-AD* cmdlet describes with -Identity, -Filter
+// or -LDAPFilter, returning entries of the given class (any when empty)
+func adQuery(c *Call, class string) ([]*onprem.Object, error) {
+	rs := c.Runspace
+	d := rs.directory
+	if c.HasInput || c.Has("Identity") {
+		var out []*onprem.Object
+		for _, id := range adIdentities(c) {
+			o, err := resolveAD(c, id, class)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, o)
+		}
+		return out, nil
+	}
+	var match func(*onprem.Object) bool
+	switch {
+	case c.Has("Filter"):
+		f, err := onprem.ParseFilter(filterText(c), rs.adFilterResolver)
+		if err != nil {
+			return nil, c.Errorf("%s", err.Error())
+		}
+		match = func(o *onprem.Object) bool { return f.Match(o) }
+	case c.Has("LDAPFilter"):
+		f, err := onprem.ParseLDAPFilter(c.String("LDAPFilter"))
+		if err != nil {
+			return nil, c.Errorf("%s", err.Error())
+		}
+		match = f.Match
+	default:
+		return nil, c.Errorf("Cannot process command because of one or more missing mandatory parameters: Filter.")
+	}
+	scope := onprem.ScopeSubtree
+	if c.Has("SearchScope") {
+		s, err := onprem.ParseScope(c.String("SearchScope"))
+		if err != nil {
+			return nil, c.Errorf("Cannot bind parameter 'SearchScope'. %s", err.Error())
+		}
+		scope = s
+	}
+	limit, err := c.Int("ResultSetSize", -1)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := d.Search(c.String("SearchBase"), scope)
+	if err != nil {
+		return nil, c.Errorf("%s", err.Error())
+	}
+	var out []*onprem.Object
+	for _, o := range candidates {
+		if limit >= 0 && len(out) >= limit {
+			break
+		}
+		if (class == "" || o.ObjectClass == class) && match(o) {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+// getADCmdlet implements Get-ADUser, Get-ADGroup, Get-ADOrganizationalUnit and Get-ADObject
+func getADCmdlet(name, class string) *Cmdlet {
+	return &Cmdlet{
+		Name:       name,
+		DefaultSet: "Filter",
+		Params: append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "Filter", Mandatory: true, Sets: []string{"Filter"}},
+			{Name: "LDAPFilter", Mandatory: true, Sets: []string{"LdapFilter"}},
+			{Name: "Properties", Aliases: []string{"Property"}},
+			{Name: "SearchBase", Sets: []string{"Filter", "LdapFilter"}},
+			{Name: "SearchScope", Sets: []string{"Filter", "LdapFilter"}},
+			{Name: "ResultSetSize", Sets: []string{"Filter", "LdapFilter"}},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			objects, err := adQuery(c, class)
+			if err != nil {
+				return err
+			}
+			props := c.Strings("Properties")
+			for _, o := range objects {
+				if err := c.Emit(adObject(o, props)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// adUserAttributes are the New-ADUser and Set-ADUser parameters that map straight onto a property
+var adUserAttributes = []string{
+	"GivenName", "Surname", "DisplayName", "UserPrincipalName", "SamAccountName", "Description",
+	"Department", "Title", "Company", "Office", "OfficePhone", "MobilePhone", "EmailAddress",
+	"City", "State", "Country", "PostalCode", "StreetAddress", "EmployeeID",
+}
+
+// adUserFlags are the [bool] parameters of New-ADUser and Set-ADUser
+var adUserFlags = []string{"Enabled", "ChangePasswordAtLogon", "PasswordNeverExpires"}
+
+func adUserParams() []*Parameter {
+	var params []*Parameter
+	for _, name := range adUserAttributes {
+		params = append(params, &Parameter{Name: name})
+	}
+	for _, name := range adUserFlags {
+		params = append(params, &Parameter{Name: name})
+	}
+	return append(params, &Parameter{Name: "Manager"}, &Parameter{Name: "PassThru", Switch: true})
+}
+
+// adUserChanges collects the property changes the attribute parameters describe
+func adUserChanges(c *Call) (map[string]interface{}, error) {
+	changes := map[string]interface{}{}
+	for _, name := range adUserAttributes {
+		if !c.Has(name) {
+			continue
+		}
+		if v := c.Get(name); v == nil || toString(v) == "" {
+			changes[name] = nil
+		} else {
+			changes[name] = toString(v)
+		}
+	}
+	for _, name := range adUserFlags {
+		if !c.Has(name) {
+			continue
+		}
+		b, err := adBool(c, name)
+		if err != nil {
+			return nil, err
+		}
+		changes[name] = b
+	}
+	if c.Has("Manager") {
+		if c.Get("Manager") == nil {
+			changes["Manager"] = nil
+		} else {
+			m, err := resolveAD(c, c.Get("Manager"), onprem.ClassUser)
+			if err != nil {
+				return nil, err
+			}
+			changes["Manager"] = m.DistinguishedName
+		}
+	}
+	return changes, nil
+}
+
+// attributeValue converts a value from an -OtherAttributes, -Add or -Replace hashtable
+func attributeValue(v interface{}) interface{} {
+	if list, ok := v.([]interface{}); ok {
+		out := make([]string, len(list))
+		for i, item := range list {
+			out[i] = toString(item)
+		}
+		return out
+	}
+	switch v.(type) {
+	case bool, int:
+		return v
+	}
+	return toString(v)
+}
+
+// secureStringParam returns a SecureString parameter, rejecting plain strings like PowerShell does
+func secureStringParam(c *Call, name string) (*SecureString, error) {
+	v := c.Get(name)
+	ss, ok := v.(*SecureString)
+	if !ok {
+		return nil, c.Errorf("Cannot bind parameter '%s'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Security.SecureString\".", c.paramName(name), toString(v), typeName(v))
+	}
+	return ss, nil
+}
+
+func newADUserCmdlet() *Cmdlet {
+	params := append([]*Parameter{
+		{Name: "Name", Position: 1, Mandatory: true},
+		{Name: "Path"},
+		{Name: "AccountPassword"},
+		{Name: "OtherAttributes"},
+	}, adUserParams()...)
+	// Every property can come from a piped object, such as a row of a CSV file
+	for _, p := range params {
+		p.ValueFromPipelineByPropertyName = !p.Switch
+	}
+	return &Cmdlet{
+		Name:   "New-ADUser",
+		Params: append(params, adCommonParams...),
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			d := rs.directory
+			name := c.String("Name")
+			if name == "" {
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Name.")
+			}
+			changes, err := adUserChanges(c)
+			if err != nil {
+				return err
+			}
+			if other, ok := c.Get("OtherAttributes").(*Hashtable); ok {
+				for _, k := range other.Keys() {
+					v, _ := other.Get(k)
+					changes[toString(k)] = attributeValue(v)
+				}
+			}
+			var password *SecureString
+			if c.Has("AccountPassword") {
+				if password, err = secureStringParam(c, "AccountPassword"); err != nil {
+					return err
+				}
+			}
+			enable, _ := changes["Enabled"].(bool)
+			changes["Enabled"] = false
+			path := c.String("Path")
+			if path == "" {
+				path = d.UsersContainer()
+			}
+			if !c.ShouldProcess("CN="+name+","+path, "New") {
+				return nil
+			}
+			o, err := d.Add(onprem.ClassUser, name, path, changes)
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if password != nil {
+				if err := d.SetPassword(o, password.PlainText()); err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+				}
+			}
+			if enable {
+				if o.HasPassword() {
+					o.Set("Enabled", true)
+				} else if password == nil {
+					c.WriteError(c.Errorf("The password does not meet the length, complexity, or history requirement of the domain."))
+				}
+			}
+			if changes["ChangePasswordAtLogon"] == true {
+				o.Set("ChangePasswordAtLogon", true)
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(adObject(o, nil))
+			}
+			return nil
+		},
+	}
+}
+
+// applyAttributeEdits applies Set-AD*'s -Add, -Replace, -Remove and -Clear
+func applyAttributeEdits(c *Call, o *onprem.Object) error {
+	if clear := c.Strings("Clear"); len(clear) > 0 {
+		for _, name := range clear {
+			if err := o.Set(name, nil); err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+		}
+	}
+	edits := []struct {
+		param string
+		apply func(name string, current, v interface{}) interface{}
+	}{
+		{"Replace", func(_ string, _, v interface{}) interface{} { return v }},
+		{"Add", func(_ string, current, v interface{}) interface{} {
+			if current == nil {
+				return v
+			}
+			list := asStrings(current)
+			return append(list, asStrings(v)...)
+		}},
+		{"Remove", func(_ string, current, v interface{}) interface{} {
+			remove := asStrings(v)
+			var kept []string
+			for _, s := range asStrings(current) {
+				if !containsFold(remove, s) {
+					kept = append(kept, s)
+				}
+			}
+			if _, multi := current.([]string); !multi {
+				if len(kept) == 0 {
+					return nil
+				}
+				return kept[0]
+			}
+			return kept
+		}},
+	}
+	for _, edit := range edits {
+		h, ok := c.Get(edit.param).(*Hashtable)
+		if !ok {
+			continue
+		}
+		for _, k := range h.Keys() {
+			v, _ := h.Get(k)
+			current, _ := o.Get(toString(k))
+			if err := o.Set(toString(k), edit.apply(toString(k), current, attributeValue(v))); err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func asStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []string:
+		return append([]string(nil), v...)
+	}
+	return []string{toString(v)}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func setADUserCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Set-ADUser",
+		Params: append(append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "Add"},
+			{Name: "Replace"},
+			{Name: "Remove"},
+			{Name: "Clear"},
+		}, adUserParams()...), adCommonParams...),
+		Process: func(c *Call) error {
+			changes, err := adUserChanges(c)
+			if err != nil {
+				return err
+			}
+			for _, id := range adIdentities(c) {
+				o, err := resolveAD(c, id, onprem.ClassUser)
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(o.DistinguishedName, "Set") {
+					continue
+				}
+				if changes["Enabled"] == true && !o.HasPassword() {
+					c.WriteError(c.Errorf("The password does not meet the length, complexity, or history requirement of the domain."))
+					delete(changes, "Enabled")
+				}
+				for name, v := range changes {
+					if err := o.Set(name, v); err != nil {
+						return c.Errorf("%s", err.Error())
+					}
+				}
+				if err := applyAttributeEdits(c, o); err != nil {
+					return err
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(adObject(o, nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// removeADCmdlet implements Remove-ADUser, Remove-ADGroup and Remove-ADOrganizationalUnit
+func removeADCmdlet(name, class string) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "Recursive", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			for _, id := range adIdentities(c) {
+				o, err := resolveAD(c, id, class)
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(o.DistinguishedName, "Remove") {
+					continue
+				}
+				if err := d.Remove(o, c.Switch("Recursive")); err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// accountCmdlet implements Enable-ADAccount, Disable-ADAccount and Unlock-ADAccount
+func accountCmdlet(name, operation string, apply func(c *Call, o *onprem.Object) error) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "PassThru", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			for _, id := range adIdentities(c) {
+				o, err := resolveAD(c, id, onprem.ClassUser)
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(o.DistinguishedName, operation) {
+					continue
+				}
+				if err := apply(c, o); err != nil {
+					c.WriteError(err)
+					continue
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(adObject(o, nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func enableADAccountCmdlet() *Cmdlet {
+	return accountCmdlet("Enable-ADAccount", "Enable", func(c *Call, o *onprem.Object) error {
+		if !o.HasPassword() {
+			return c.Errorf("The password does not meet the length, complexity, or history requirement of the domain.")
+		}
+		return o.Set("Enabled", true)
+	})
+}
+
+func disableADAccountCmdlet() *Cmdlet {
+	return accountCmdlet("Disable-ADAccount", "Disable", func(c *Call, o *onprem.Object) error {
+		return o.Set("Enabled", false)
+	})
+}
+
+func unlockADAccountCmdlet() *Cmdlet {
+	return accountCmdlet("Unlock-ADAccount", "Unlock", func(c *Call, o *onprem.Object) error {
+		return o.Set("LockedOut", false)
+	})
+}
+
+func setADAccountPasswordCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Set-ADAccountPassword",
+		Params: append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "NewPassword"},
+			{Name: "OldPassword"},
+			{Name: "Reset", Switch: true},
+			{Name: "PassThru", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			if !c.Has("NewPassword") {
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: NewPassword.")
+			}
+			newPassword, err := secureStringParam(c, "NewPassword")
+			if err != nil {
+				return err
+			}
+			for _, id := range adIdentities(c) {
+				o, err := resolveAD(c, id, onprem.ClassUser)
+				if err != nil {
+					return err
+				}
+				if !c.Switch("Reset") {
+					if !c.Has("OldPassword") {
+						return c.Errorf("Cannot process command because of one or more missing mandatory parameters: OldPassword.")
+					}
+					old, err := secureStringParam(c, "OldPassword")
+					if err != nil {
+						return err
+					}
+					if !d.CheckPassword(o, old.PlainText()) {
+						c.WriteError(c.Errorf("The specified network password is not correct."))
+						continue
+					}
+				}
+				if !c.ShouldProcess(o.DistinguishedName, "Set-ADAccountPassword") {
+					continue
+				}
+				if err := d.SetPassword(o, newPassword.PlainText()); err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+					continue
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(adObject(o, nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newADGroupCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "New-ADGroup",
+		Params: append([]*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true, ValueFromPipelineByPropertyName: true},
+			{Name: "GroupScope", Position: 2, Mandatory: true},
+			{Name: "GroupCategory"},
+			{Name: "SamAccountName"},
+			{Name: "DisplayName"},
+			{Name: "Description"},
+			{Name: "Path"},
+			{Name: "ManagedBy"},
+			{Name: "PassThru", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			name := c.String("Name")
+			if name == "" || !c.Has("GroupScope") {
+				missing := "Name"
+				if name != "" {
+					missing = "GroupScope"
+				}
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: %s.", missing)
+			}
+			scope, err := adEnum(c, "GroupScope", "Microsoft.ActiveDirectory.Management.ADGroupScope", "DomainLocal", "Global", "Universal")
+			if err != nil {
+				return err
+			}
+			category := "Security"
+			if c.Has("GroupCategory") {
+				if category, err = adEnum(c, "GroupCategory", "Microsoft.ActiveDirectory.Management.ADGroupCategory", "Distribution", "Security"); err != nil {
+					return err
+				}
+			}
+			attrs := map[string]interface{}{"GroupScope": scope, "GroupCategory": category}
+			for _, p := range []string{"SamAccountName", "DisplayName", "Description"} {
+				if c.Has(p) {
+					attrs[p] = c.String(p)
+				}
+			}
+			if c.Has("ManagedBy") {
+				m, err := resolveAD(c, c.Get("ManagedBy"), "")
+				if err != nil {
+					return err
+				}
+				attrs["ManagedBy"] = m.DistinguishedName
+			}
+			path := c.String("Path")
+			if path == "" {
+				path = d.UsersContainer()
+			}
+			if !c.ShouldProcess("CN="+name+","+path, "New") {
+				return nil
+			}
+			o, err := d.Add(onprem.ClassGroup, name, path, attrs)
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(adObject(o, nil))
+			}
+			return nil
+		},
+	}
+}
+
+// adEnum validates an enum parameter, returning its canonical spelling
+func adEnum(c *Call, param, typ string, values ...string) (string, error) {
+	v := c.String(param)
+	for _, allowed := range values {
+		if strings.EqualFold(v, allowed) {
+			return allowed, nil
+		}
+	}
+	return "", c.Errorf("Cannot bind parameter '%s'. Cannot convert value \"%s\" to type \"%s\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again:\n%s\"", param, v, typ, v, strings.Join(values, ", "))
+}
+
+func newADOrganizationalUnitCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "New-ADOrganizationalUnit",
+		Params: append([]*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Path"},
+			{Name: "Description"},
+			{Name: "DisplayName"},
+			{Name: "ProtectedFromAccidentalDeletion"},
+			{Name: "PassThru", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			name := c.String("Name")
+			if name == "" {
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Name.")
+			}
+			attrs := map[string]interface{}{}
+			for _, p := range []string{"Description", "DisplayName"} {
+				if c.Has(p) {
+					attrs[p] = c.String(p)
+				}
+			}
+			if c.Has("ProtectedFromAccidentalDeletion") {
+				b, err := adBool(c, "ProtectedFromAccidentalDeletion")
+				if err != nil {
+					return err
+				}
+				attrs["ProtectedFromAccidentalDeletion"] = b
+			}
+			path := c.String("Path")
+			if path == "" {
+				path = d.DN()
+			}
+			if !c.ShouldProcess("OU="+name+","+path, "New") {
+				return nil
+			}
+			o, err := d.Add(onprem.ClassOU, name, path, attrs)
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(adObject(o, nil))
+			}
+			return nil
+		},
+	}
+}
+
+func getADGroupMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-ADGroupMember",
+		Params: append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "Recursive", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			for _, id := range adIdentities(c) {
+				g, err := resolveAD(c, id, onprem.ClassGroup)
+				if err != nil {
+					return err
+				}
+				members := d.Members(g)
+				if c.Switch("Recursive") {
+					members = nil
+					seen := map[*onprem.Object]bool{g: true}
+					var expand func(*onprem.Object)
+					expand = func(group *onprem.Object) {
+						for _, m := range d.Members(group) {
+							if seen[m] {
+								continue
+							}
+							seen[m] = true
+							if m.ObjectClass == onprem.ClassGroup {
+								expand(m)
+							} else {
+								members = append(members, m)
+							}
+						}
+					}
+					expand(g)
+				}
+				for _, m := range members {
+					if err := c.Emit(adPrincipal(m)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// groupMembershipCmdlet implements Add-ADGroupMember and Remove-ADGroupMember
+func groupMembershipCmdlet(name, operation string, apply func(d *onprem.Directory, group, member *onprem.Object) error) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: append([]*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "Members", Aliases: []string{"Member"}, Position: 2, Mandatory: true},
+			{Name: "PassThru", Switch: true},
+		}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			for _, id := range adIdentities(c) {
+				g, err := resolveAD(c, id, onprem.ClassGroup)
+				if err != nil {
+					return err
+				}
+				for _, m := range asList(c.Get("Members")) {
+					member, err := resolveAD(c, m, "")
+					if err != nil {
+						return err
+					}
+					if member.SID == "" {
+						return c.Errorf("Cannot find an object with identity: '%s' under: '%s'.", adIdentity(m), d.DN())
+					}
+					if !c.ShouldProcess(g.DistinguishedName, operation) {
+						continue
+					}
+					if err := apply(d, g, member); err != nil {
+						c.WriteError(c.Errorf("%s", err.Error()))
+					}
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(adObject(g, nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func getADPrincipalGroupMembershipCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Get-ADPrincipalGroupMembership",
+		Params: append([]*Parameter{{Name: "Identity", Position: 1, Mandatory: true, Sets: []string{"Identity"}, ValueFromPipeline: true}}, adCommonParams...),
+		Process: func(c *Call) error {
+			d := c.Runspace.directory
+			for _, id := range adIdentities(c) {
+				o, err := resolveAD(c, id, "")
+				if err != nil {
+					return err
+				}
+				groups := d.MemberOf(o)
+				if o.ObjectClass == onprem.ClassUser {
+					if du, err := d.Resolve("Domain Users", onprem.ClassGroup); err == nil {
+						groups = append([]*onprem.Object{du}, groups...)
+					}
+				}
+				for _, g := range groups {
+					if err := c.Emit(adObject(g, nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// adCmdlets returns the ActiveDirectory module's cmdlets
+func adCmdlets() []*Cmdlet {
+	return []*Cmdlet{
+		getADCmdlet("Get-ADUser", onprem.ClassUser),
+		getADCmdlet("Get-ADGroup", onprem.ClassGroup),
+		getADCmdlet("Get-ADOrganizationalUnit", onprem.ClassOU),
+		getADCmdlet("Get-ADObject", ""),
+		newADUserCmdlet(),
+		setADUserCmdlet(),
+		removeADCmdlet("Remove-ADUser", onprem.ClassUser),
+		removeADCmdlet("Remove-ADGroup", onprem.ClassGroup),
+		removeADCmdlet("Remove-ADOrganizationalUnit", onprem.ClassOU),
+		enableADAccountCmdlet(),
+		disableADAccountCmdlet(),
+		unlockADAccountCmdlet(),
+		setADAccountPasswordCmdlet(),
+		newADGroupCmdlet(),
+		newADOrganizationalUnitCmdlet(),
+		getADGroupMemberCmdlet(),
+		groupMembershipCmdlet("Add-ADGroupMember", "Set", func(d *onprem.Directory, g, m *onprem.Object) error { return d.AddMember(g, m) }),
+		groupMembershipCmdlet("Remove-ADGroupMember", "Set", func(d *onprem.Directory, g, m *onprem.Object) error { return d.RemoveMember(g, m) }),
+		getADPrincipalGroupMembershipCmdlet(),
+	}
+}
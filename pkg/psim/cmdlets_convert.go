@@ -0,0 +1,782 @@
+package psim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The conversion cmdlets turn objects into JSON, CSV and HTML text and
+// back. Files are read from and written to the runspace's file system.
+
+// maxJSONDepth is the largest -Depth ConvertTo-Json accepts
+const maxJSONDepth = 100
+
+func convertToJsonCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "ConvertTo-Json",
+		Params: []*Parameter{
+			{Name: "InputObject", Position: 1, Mandatory: true, AllowEmpty: true, ValueFromPipeline: true},
+			{Name: "Depth"},
+			{Name: "Compress", Switch: true},
+			{Name: "EnumsAsStrings", Switch: true},
+			{Name: "AsArray", Switch: true},
+			{Name: "EscapeHandling"},
+		},
+		End: func(c *Call) error {
+			depth, err := c.Int("Depth", 2)
+			if err != nil {
+				return err
+			}
+			if depth < 0 || depth > maxJSONDepth {
+				return c.Errorf("Cannot validate argument on parameter 'Depth'. The %d argument is greater than the maximum allowed range of %d. Supply an argument that is less than or equal to %d and then try the command again.", depth, maxJSONDepth, maxJSONDepth)
+			}
+			// Piped objects are gathered into one array; -InputObject is converted as given
+			var v interface{}
+			switch {
+			case !c.HasInput:
+				v = c.Get("InputObject")
+			case len(c.Inputs) == 1:
+				v = c.Inputs[0]
+			default:
+				v = c.Inputs
+			}
+			if _, isList := v.([]interface{}); c.Switch("AsArray") && !isList {
+				v = []interface{}{v}
+			}
+			if jsonTruncated(v, depth) {
+				c.WriteWarning(fmt.Sprintf("Resulting JSON is truncated as serialization has exceeded the set depth of %d.", depth))
+			}
+			text := encodeJSON(v, depth)
+			if !c.Switch("Compress") {
+				text = indentJSON(text)
+			}
+			return c.Emit(text)
+		},
+	}
+}
+
+// jsonTruncated reports whether encoding v at depth would cut off nested
+// objects, following the depth rules of writeJSON
+func jsonTruncated(v interface{}, depth int) bool {
+	switch x := v.(type) {
+	case *Hashtable:
+		if depth < 0 {
+			return true
+		}
+		for _, k := range x.Keys() {
+			val, _ := x.Get(k)
+			if jsonTruncated(val, depth-1) {
+				return true
+			}
+		}
+	case *PSObject:
+		if len(x.Properties()) == 0 {
+			return false
+		}
+		if depth < 0 {
+			return true
+		}
+		for _, p := range x.Properties() {
+			if jsonTruncated(p.Current(), depth-1) {
+				return true
+			}
+		}
+	case []interface{}:
+		if depth < 0 {
+			return true
+		}
+		for _, item := range x {
+			if jsonTruncated(item, depth-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// indentJSON lays out compact JSON the way ConvertTo-Json does, two spaces per level
+func indentJSON(text string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(text), "", "  "); err != nil {
+		return text
+	}
+	return buf.String()
+}
+
+func convertFromJsonCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "ConvertFrom-Json",
+		Params: []*Parameter{
+			{Name: "InputObject", Position: 1, Mandatory: true, AllowEmpty: true, ValueFromPipeline: true},
+			{Name: "AsHashtable", Switch: true},
+			{Name: "Depth"},
+			{Name: "NoEnumerate", Switch: true},
+			{Name: "DateKind"},
+		},
+		End: func(c *Call) error {
+			depth, err := c.Int("Depth", 1024)
+			if err != nil {
+				return err
+			}
+			var texts []string
+			for _, v := range bufferedInput(c) {
+				texts = append(texts, toString(v))
+			}
+			convert := func(text string) error {
+				if strings.TrimSpace(text) == "" {
+					return nil
+				}
+				v, err := decodeJSON(text)
+				if err != nil {
+					msg := err.Error()
+					if !strings.HasPrefix(msg, "Conversion from JSON failed") {
+						msg = "Conversion from JSON failed with error: " + msg
+					}
+					return c.Errorf("%s", msg)
+				}
+				if jsonDepth(v) > depth {
+					return c.Errorf("Conversion from JSON failed with error: The reader's MaxDepth of %d has been exceeded.", depth)
+				}
+				if c.Switch("AsHashtable") {
+					v = toHashtables(v)
+				}
+				if c.Switch("NoEnumerate") {
+					return c.Emit(v)
+				}
+				return c.EmitAll(v)
+			}
+			switch len(texts) {
+			case 0:
+				return nil
+			case 1:
+				return convert(texts[0])
+			}
+			// Several strings are several documents, unless the first isn't
+			// one on its own; then they are the lines of a single document
+			if _, err := decodeJSON(texts[0]); err != nil {
+				return convert(strings.Join(texts, "\n"))
+			}
+			for _, text := range texts {
+				if err := convert(text); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// jsonDepth is the nesting depth of decoded JSON: 0 for a scalar, 1 for a flat object or array
+func jsonDepth(v interface{}) int {
+	deepest := 0
+	switch x := v.(type) {
+	case *PSObject:
+		for _, p := range x.Properties() {
+			deepest = max(deepest, jsonDepth(p.Current()))
+		}
+	case []interface{}:
+		for _, item := range x {
+			deepest = max(deepest, jsonDepth(item))
+		}
+	default:
+		return 0
+	}
+	return deepest + 1
+}
+
+// csvOptions are the settings the CSV cmdlets share
+type csvOptions struct {
+	delimiter rune
+	quotes    string   // Always, AsNeeded or Never
+	quoted    []string // columns -QuoteFields always quotes
+	typeInfo  bool     // write a #TYPE line first
+	noHeader  bool
+}
+
+// csvDelimiter reads -Delimiter, which must be a single character
+func csvDelimiter(c *Call) (rune, error) {
+	if !c.Has("Delimiter") {
+		return ',', nil
+	}
+	d := []rune(c.String("Delimiter"))
+	if len(d) != 1 {
+		return 0, c.Errorf("Cannot bind parameter 'Delimiter'. Cannot convert value \"%s\" to type \"System.Char\". Error: \"String must be exactly one character long.\"", c.String("Delimiter"))
+	}
+	return d[0], nil
+}
+
+func readCsvOptions(c *Call) (*csvOptions, error) {
+	d, err := csvDelimiter(c)
+	if err != nil {
+		return nil, err
+	}
+	opts := &csvOptions{delimiter: d, quotes: "Always", quoted: c.Strings("QuoteFields")}
+	if c.Has("UseQuotes") {
+		q, err := adEnum(c, "UseQuotes", "Microsoft.PowerShell.Commands.BaseCsvWritingCommand+QuoteKind", "Never", "Always", "AsNeeded")
+		if err != nil {
+			return nil, err
+		}
+		opts.quotes = q
+	}
+	// PowerShell 7 leaves the #TYPE line out unless asked; -NoTypeInformation is kept for old scripts
+	opts.typeInfo = c.Switch("IncludeTypeInformation") && !c.Switch("NoTypeInformation")
+	opts.noHeader = c.Switch("NoHeader")
+	return opts, nil
+}
+
+// csvColumns are the columns an object becomes: its properties, or the
+// keys of a hashtable
+func csvColumns(v interface{}) []string {
+	switch x := v.(type) {
+	case *PSObject:
+		var names []string
+		for _, p := range x.Properties() {
+			names = append(names, p.Name)
+		}
+		return names
+	case *Hashtable:
+		var names []string
+		for _, k := range x.Keys() {
+			names = append(names, toString(k))
+		}
+		return names
+	}
+	return propertyNames(v)
+}
+
+// csvValue reads one column of an object; ok is false when it has no such property
+func (rs *Runspace) csvValue(v interface{}, column string) (interface{}, bool) {
+	switch x := v.(type) {
+	case *PSObject:
+		if p := x.Property(column); p != nil {
+			return p.Current(), true
+		}
+		return nil, false
+	case *Hashtable:
+		return x.Get(column)
+	}
+	val, err := rs.getMember(v, column)
+	return val, err == nil
+}
+
+// field quotes a value as the options ask, doubling any quotes inside it
+func (o *csvOptions) field(column, value string) string {
+	quote := o.quotes == "Always"
+	switch {
+	case containsFold(o.quoted, column):
+		quote = true
+	case o.quotes == "AsNeeded":
+		quote = strings.ContainsAny(value, string(o.delimiter)+"\"\r\n")
+	}
+	if !quote {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+// csvWriter turns objects into CSV lines, taking its columns from the first object
+type csvWriter struct {
+	rs      *Runspace
+	opts    *csvOptions
+	columns []string
+	started bool
+}
+
+// lines returns the CSV lines for an object, preceded by the header and
+// type lines when it is the first
+func (w *csvWriter) lines(v interface{}) []string {
+	var out []string
+	if !w.started {
+		w.started = true
+		if w.columns == nil {
+			w.columns = csvColumns(v)
+		}
+		if w.opts.typeInfo {
+			out = append(out, "#TYPE "+typeName(v))
+		}
+		if !w.opts.noHeader {
+			var header []string
+			for _, col := range w.columns {
+				header = append(header, w.opts.field(col, col))
+			}
+			out = append(out, strings.Join(header, string(w.opts.delimiter)))
+		}
+	}
+	var fields []string
+	for _, col := range w.columns {
+		val, ok := w.rs.csvValue(v, col)
+		if !ok {
+			// A column the object lacks stays empty, without quotes
+			fields = append(fields, "")
+			continue
+		}
+		fields = append(fields, w.opts.field(col, toString(val)))
+	}
+	return append(out, strings.Join(fields, string(w.opts.delimiter)))
+}
+
+// csvWritingParams are the parameters ConvertTo-Csv and Export-Csv share
+func csvWritingParams() []*Parameter {
+	return []*Parameter{
+		{Name: "InputObject", Mandatory: true, ValueFromPipeline: true},
+		{Name: "Delimiter", Sets: []string{"Delimiter"}},
+		{Name: "UseCulture", Switch: true, Sets: []string{"UseCulture"}},
+		{Name: "NoTypeInformation", Aliases: []string{"NTI"}, Switch: true},
+		{Name: "IncludeTypeInformation", Aliases: []string{"ITI"}, Switch: true},
+		{Name: "UseQuotes"},
+		{Name: "QuoteFields"},
+		{Name: "NoHeader", Switch: true},
+	}
+}
+
+func convertToCsvCmdlet() *Cmdlet {
+	params := csvWritingParams()
+	params[1].Position = 1
+	return &Cmdlet{
+		Name:       "ConvertTo-Csv",
+		DefaultSet: "Delimiter",
+		Params:     params,
+		Begin: func(c *Call) error {
+			opts, err := readCsvOptions(c)
+			if err != nil {
+				return err
+			}
+			c.State = &csvWriter{rs: c.Runspace, opts: opts}
+			return nil
+		},
+		Process: func(c *Call) error {
+			v, _ := pipelineInput(c)
+			for _, line := range c.State.(*csvWriter).lines(v) {
+				if err := c.Emit(line); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func exportCsvCmdlet() *Cmdlet {
+	params := append([]*Parameter{
+		{Name: "Path", Position: 1, Sets: []string{"Delimiter", "UseCulture"}},
+		{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}},
+		{Name: "Append", Switch: true},
+		{Name: "Force", Switch: true},
+		{Name: "NoClobber", Aliases: []string{"NoOverwrite"}, Switch: true},
+		{Name: "Encoding"},
+	}, csvWritingParams()...)
+	params[7].Position = 2 // -Delimiter
+	return &Cmdlet{
+		Name:       "Export-Csv",
+		DefaultSet: "Delimiter",
+		Params:     params,
+		End: func(c *Call) error {
+			rs := c.Runspace
+			opts, err := readCsvOptions(c)
+			if err != nil {
+				return err
+			}
+			path := c.String("Path")
+			if c.Has("LiteralPath") {
+				path = c.String("LiteralPath")
+			}
+			if path == "" {
+				return c.Errorf("Cannot perform operation because the path resolved to more than one file. This command cannot operate on multiple files.")
+			}
+			full, err := rs.resolvePath(path)
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if !rs.fs.IsDir(parentPath(full)) {
+				return c.Errorf("Could not find a part of the path '%s'.", full)
+			}
+			exists := rs.fs.Exists(full)
+			if exists && c.Switch("NoClobber") && !c.Switch("Append") {
+				return c.Errorf("The file '%s' already exists.", full)
+			}
+			w := &csvWriter{rs: rs, opts: opts}
+			var existing string
+			if c.Switch("Append") && exists {
+				// Appended rows follow the columns of the file's header
+				existing, _ = rs.fs.ReadFile(full)
+				if rows := parseCsv(existing, opts.delimiter); len(rows) > 0 {
+					header := rows[0]
+					if strings.HasPrefix(header[0], "#TYPE") && len(rows) > 1 {
+						header = rows[1]
+					}
+					w.columns, w.started = header, true
+				}
+			}
+			var lines []string
+			for _, v := range bufferedInput(c) {
+				if w.started && c.Switch("Append") && !c.Switch("Force") {
+					for _, col := range w.columns {
+						if _, ok := rs.csvValue(v, col); !ok {
+							return c.Errorf("Cannot append CSV content to the following file: %s. The appended object does not have a property that corresponds to the following column: %s. To continue with mismatched properties, add the -Force parameter, and then retry the command.", full, col)
+						}
+					}
+				}
+				lines = append(lines, w.lines(v)...)
+			}
+			text := existing
+			if len(lines) > 0 {
+				if text != "" && !strings.HasSuffix(text, "\n") {
+					text += "\n"
+				}
+				text += strings.Join(lines, "\n") + "\n"
+			}
+			if _, err := rs.fs.writeFile(full, text, rs.fs.clock()); err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			return nil
+		},
+	}
+}
+
+// parseCsv splits CSV text into rows of fields. Quoted fields may hold
+// delimiters, doubled quotes and line breaks; like PowerShell, a quote in
+// the middle of an unquoted field is kept as it is. Blank lines are skipped.
+func parseCsv(text string, delimiter rune) [][]string {
+	var rows [][]string
+	var row []string
+	var field strings.Builder
+	runes := []rune(strings.ReplaceAll(text, "\r\n", "\n"))
+	inQuotes, fieldStarted := false, false
+	endField := func() {
+		row = append(row, field.String())
+		field.Reset()
+		fieldStarted = false
+	}
+	endRow := func() {
+		if len(row) > 1 || row[0] != "" {
+			rows = append(rows, row)
+		}
+		row = nil
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case inQuotes && r == '"':
+			if i+1 < len(runes) && runes[i+1] == '"' {
+				field.WriteRune('"')
+				i++
+			} else {
+				inQuotes = false
+			}
+		case inQuotes:
+			field.WriteRune(r)
+		case r == '"' && !fieldStarted:
+			inQuotes, fieldStarted = true, true
+		case r == delimiter:
+			endField()
+		case r == '\n':
+			endField()
+			endRow()
+		default:
+			field.WriteRune(r)
+			fieldStarted = true
+		}
+	}
+	if fieldStarted || len(row) > 0 {
+		endField()
+		endRow()
+	}
+	return rows
+}
+
+// csvObjects makes objects from CSV rows, the first row being the header
+// unless a header is given. A #TYPE line names the type of the objects.
+func csvObjects(c *Call, rows [][]string, header []string) ([]interface{}, error) {
+	typeName := ""
+	if len(rows) > 0 && len(rows[0]) > 0 && strings.HasPrefix(rows[0][0], "#TYPE ") {
+		typeName = strings.TrimSpace(strings.TrimPrefix(rows[0][0], "#TYPE "))
+		rows = rows[1:]
+	}
+	if header == nil {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		header, rows = append([]string{}, rows[0]...), rows[1:]
+	}
+	missing := false
+	for i, name := range header {
+		if name == "" {
+			header[i] = fmt.Sprintf("H%d", i+1)
+			missing = true
+		}
+	}
+	if missing {
+		c.WriteWarning("One or more headers were not specified. Default names starting with \"H\" have been used in place of any missing headers.")
+	}
+	for i, name := range header {
+		for _, earlier := range header[:i] {
+			if strings.EqualFold(name, earlier) {
+				return nil, c.Errorf("The member \"%s\" is already present.", name)
+			}
+		}
+	}
+	var objects []interface{}
+	for _, row := range rows {
+		o := NewCustomObject()
+		if typeName != "" {
+			o = NewObject("CSV:"+typeName, "System.Management.Automation.PSCustomObject")
+		}
+		for i, name := range header {
+			// Columns a row runs short of are null; extra fields are ignored
+			var v interface{}
+			if i < len(row) {
+				v = row[i]
+			}
+			o.Add(name, v)
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+func importCsvCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Import-Csv",
+		DefaultSet: "Delimiter",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, ValueFromPipeline: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Delimiter", Position: 2, Sets: []string{"Delimiter"}},
+			{Name: "UseCulture", Switch: true, Mandatory: true, Sets: []string{"UseCulture"}},
+			{Name: "Header"},
+			{Name: "Encoding"},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			delimiter, err := csvDelimiter(c)
+			if err != nil {
+				return err
+			}
+			var header []string
+			if c.Has("Header") {
+				header = c.Strings("Header")
+			}
+			for _, p := range pathArguments(c, "Path") {
+				var files []string
+				full, err := rs.resolvePath(p)
+				if err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+					continue
+				}
+				if !c.Has("LiteralPath") && HasWildcard(full) {
+					nodes, _, err := rs.expandPath(c, full, false)
+					if err != nil {
+						c.WriteError(err)
+						continue
+					}
+					for _, n := range nodes {
+						files = append(files, n.path())
+					}
+				} else {
+					files = []string{full}
+				}
+				for _, file := range files {
+					if rs.fs.IsDir(file) {
+						c.WriteError(c.Errorf("Access to the path '%s' is denied.", file))
+						continue
+					}
+					text, err := rs.fs.ReadFile(file)
+					if err != nil {
+						c.WriteError(c.Errorf("Could not find file '%s'.", file))
+						continue
+					}
+					var names []string
+					if header != nil {
+						names = append(names, header...)
+					}
+					objects, err := csvObjects(c, parseCsv(text, delimiter), names)
+					if err != nil {
+						return err
+					}
+					for _, o := range objects {
+						if err := c.Emit(o); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func convertFromCsvCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "ConvertFrom-Csv",
+		DefaultSet: "Delimiter",
+		Params: []*Parameter{
+			{Name: "InputObject", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "Delimiter", Position: 2, Sets: []string{"Delimiter"}},
+			{Name: "UseCulture", Switch: true, Mandatory: true, Sets: []string{"UseCulture"}},
+			{Name: "Header"},
+		},
+		End: func(c *Call) error {
+			delimiter, err := csvDelimiter(c)
+			if err != nil {
+				return err
+			}
+			var lines []string
+			for _, v := range bufferedInput(c) {
+				lines = append(lines, toString(v))
+			}
+			var header []string
+			if c.Has("Header") {
+				header = c.Strings("Header")
+			}
+			objects, err := csvObjects(c, parseCsv(strings.Join(lines, "\n"), delimiter), header)
+			if err != nil {
+				return err
+			}
+			for _, o := range objects {
+				if err := c.Emit(o); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// htmlEncode escapes text for HTML the way .NET's WebUtility.HtmlEncode does
+var htmlEncode = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#39;").Replace
+
+func convertToHtmlCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "ConvertTo-Html",
+		DefaultSet: "Page",
+		Params: []*Parameter{
+			{Name: "InputObject", ValueFromPipeline: true},
+			{Name: "Property", Position: 1},
+			{Name: "Body", Position: 3, Sets: []string{"Page"}},
+			{Name: "Head", Position: 2, Sets: []string{"Page"}},
+			{Name: "Title", Position: 2, Sets: []string{"Page"}},
+			{Name: "As"},
+			{Name: "CssUri", Aliases: []string{"cu", "uri"}, Sets: []string{"Page"}},
+			{Name: "Fragment", Switch: true, Mandatory: true, Sets: []string{"Fragment"}},
+			{Name: "PreContent"},
+			{Name: "PostContent"},
+			{Name: "Charset", Sets: []string{"Page"}},
+			{Name: "Meta", Sets: []string{"Page"}},
+			{Name: "Transitional", Switch: true, Sets: []string{"Page"}},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			as := "Table"
+			if c.Has("As") {
+				var err error
+				if as, err = adEnum(c, "As", "System.String", "Table", "List"); err != nil {
+					return err
+				}
+			}
+			specs, err := propertySpecs(c, "Property")
+			if err != nil {
+				return err
+			}
+			objects := bufferedInput(c)
+			// Without -Property the columns are the first object's properties;
+			// wildcards expand against it too
+			var columns []propertySpec
+			if len(objects) > 0 {
+				if specs == nil {
+					specs = []propertySpec{{name: "*"}}
+				}
+				for _, spec := range specs {
+					if spec.expr == nil && spec.from == "" && HasWildcard(spec.name) {
+						for _, name := range csvColumns(objects[0]) {
+							if MatchWildcard(spec.name, name, false) {
+								columns = append(columns, propertySpec{name: name})
+							}
+						}
+						continue
+					}
+					columns = append(columns, spec)
+				}
+			}
+			var lines []string
+			emit := func(s ...string) { lines = append(lines, s...) }
+			if !c.Switch("Fragment") {
+				doctype := `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN"  "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">`
+				if c.Switch("Transitional") {
+					doctype = `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN"  "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">`
+				}
+				emit(doctype, `<html xmlns="http://www.w3.org/1999/xhtml">`, "<head>")
+				if c.Has("Head") {
+					emit(c.Strings("Head")...)
+				} else {
+					title := "HTML TABLE"
+					if c.Has("Title") {
+						title = c.String("Title")
+					}
+					emit("<title>" + title + "</title>")
+				}
+				if c.Has("CssUri") {
+					emit(`<link rel="stylesheet" type="text/css" href="` + c.String("CssUri") + `" />`)
+				}
+				emit("</head><body>")
+				emit(c.Strings("Body")...)
+			}
+			emit(c.Strings("PreContent")...)
+			emit("<table>")
+			cell := func(obj interface{}, spec propertySpec) (string, error) {
+				v, _, err := rs.propertyValue(obj, spec)
+				if err != nil {
+					return "", err
+				}
+				return htmlEncode(toString(v)), nil
+			}
+			if as == "List" {
+				for i, obj := range objects {
+					if i > 0 {
+						emit("<tr><td><hr></td></tr>")
+					}
+					for _, col := range columns {
+						value, err := cell(obj, col)
+						if err != nil {
+							return err
+						}
+						emit("<tr><td>" + htmlEncode(col.label()) + ":</td><td>" + value + "</td></tr>")
+					}
+				}
+			} else if len(objects) > 0 {
+				var header strings.Builder
+				header.WriteString("<tr>")
+				for _, col := range columns {
+					header.WriteString("<th>" + htmlEncode(col.label()) + "</th>")
+				}
+				header.WriteString("</tr>")
+				emit("<colgroup>"+strings.Repeat("<col/>", len(columns))+"</colgroup>", header.String())
+				for _, obj := range objects {
+					var row strings.Builder
+					row.WriteString("<tr>")
+					for _, col := range columns {
+						value, err := cell(obj, col)
+						if err != nil {
+							return err
+						}
+						row.WriteString("<td>" + value + "</td>")
+					}
+					row.WriteString("</tr>")
+					emit(row.String())
+				}
+			}
+			emit("</table>")
+			emit(c.Strings("PostContent")...)
+			if !c.Switch("Fragment") {
+				emit("</body></html>")
+			}
+			for _, line := range lines {
+				if err := c.Emit(line); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,634 @@
+package psim
+
+import (
+	"strings"
+	"time"
+)
+
+// builtinAliases are the default aliases of every runspace
+var builtinAliases = map[string]string{
+	"%":       "ForEach-Object",
+	"foreach": "ForEach-Object",
+	"?":       "Where-Object",
+	"where":   "Where-Object",
+	"select":  "Select-Object",
+	"sort":    "Sort-Object",
+	"group":   "Group-Object",
+	"measure": "Measure-Object",
+	"gm":      "Get-Member",
+	"echo":    "Write-Output",
+	"write":   "Write-Output",
+	"gps":     "Get-Process",
+	"ps":      "Get-Process",
+	"kill":    "Stop-Process",
+	"spps":    "Stop-Process",
+	"gsv":     "Get-Service",
+	"sasv":    "Start-Service",
+	"spsv":    "Stop-Service",
+	"gv":      "Get-Variable",
+	"sv":      "Set-Variable",
+	"set":     "Set-Variable",
+	"nv":      "New-Variable",
+	"rv":      "Remove-Variable",
+	"clv":     "Clear-Variable",
+	"sleep":   "Start-Sleep",
+	"gci":     "Get-ChildItem",
+	"ls":      "Get-ChildItem",
+	"dir":     "Get-ChildItem",
+	"gi":      "Get-Item",
+	"sl":      "Set-Location",
+	"cd":      "Set-Location",
+	"chdir":   "Set-Location",
+	"gl":      "Get-Location",
+	"pwd":     "Get-Location",
+	"pushd":   "Push-Location",
+	"popd":    "Pop-Location",
+	"ni":      "New-Item",
+	"md":      "mkdir",
+	"ri":      "Remove-Item",
+	"rm":      "Remove-Item",
+	"del":     "Remove-Item",
+	"erase":   "Remove-Item",
+	"rd":      "Remove-Item",
+	"rmdir":   "Remove-Item",
+	"copy":    "Copy-Item",
+	"cp":      "Copy-Item",
+	"cpi":     "Copy-Item",
+	"move":    "Move-Item",
+	"mv":      "Move-Item",
+	"mi":      "Move-Item",
+	"ren":     "Rename-Item",
+	"rni":     "Rename-Item",
+	"gc":      "Get-Content",
+	"cat":     "Get-Content",
+	"type":    "Get-Content",
+	"ac":      "Add-Content",
+	"rvpa":    "Resolve-Path",
+	"ipmo":    "Import-Module",
+	"gmo":     "Get-Module",
+	"rmo":     "Remove-Module",
+	"irm":     "Invoke-RestMethod",
+	"iwr":     "Invoke-WebRequest",
+	"ipcsv":   "Import-Csv",
+	"epcsv":   "Export-Csv",
+	"ft":      "Format-Table",
+	"fl":      "Format-List",
+	"fw":      "Format-Wide",
+	"oh":      "Out-Host",
+	"help":    "Get-Help",
+	"man":     "Get-Help",
+	"gcm":     "Get-Command",
+}
+
+// builtinCmdlets returns the cmdlets every runspace starts with
+func builtinCmdlets() []*Cmdlet {
+	cmdlets := []*Cmdlet{
+		writeOutputCmdlet(),
+		writeHostCmdlet(),
+		writeWarningCmdlet(),
+		writeVerboseCmdlet(),
+		writeErrorCmdlet(),
+		forEachObjectCmdlet(),
+		whereObjectCmdlet(),
+		selectObjectCmdlet(),
+		sortObjectCmdlet(),
+		groupObjectCmdlet(),
+		measureObjectCmdlet(),
+		getMemberCmdlet(),
+		addMemberCmdlet(),
+		getProcessCmdlet(),
+		stopProcessCmdlet(),
+		getServiceCmdlet(),
+		startServiceCmdlet(),
+		stopServiceCmdlet(),
+		restartServiceCmdlet(),
+		setServiceCmdlet(),
+		outNullCmdlet(),
+		formatTableCmdlet(),
+		formatListCmdlet(),
+		formatWideCmdlet(),
+		outStringCmdlet(),
+		outHostCmdlet(),
+		getDateCmdlet(),
+		getRandomCmdlet(),
+		startSleepCmdlet(),
+		getVariableCmdlet(),
+		setVariableCmdlet("Set-Variable"),
+		setVariableCmdlet("New-Variable"),
+		removeVariableCmdlet(),
+		clearVariableCmdlet(),
+		getChildItemCmdlet(),
+		getItemCmdlet(),
+		getLocationCmdlet(),
+		setLocationCmdlet(),
+		pushLocationCmdlet(),
+		popLocationCmdlet(),
+		newItemCmdlet(),
+		mkdirCmdlet(),
+		removeItemCmdlet(),
+		copyItemCmdlet(),
+		moveItemCmdlet(),
+		renameItemCmdlet(),
+		getContentCmdlet(),
+		writeContentCmdlet("Set-Content", false),
+		writeContentCmdlet("Add-Content", true),
+		outFileCmdlet(),
+		testPathCmdlet(),
+		resolvePathCmdlet(),
+		joinPathCmdlet(),
+		splitPathCmdlet(),
+		convertToSecureStringCmdlet(),
+		convertFromSecureStringCmdlet(),
+		importModuleCmdlet(),
+		exportModuleMemberCmdlet(),
+		getModuleCmdlet(),
+		removeModuleCmdlet(),
+		getHelpCmdlet(),
+		getCommandCmdlet(),
+		updateHelpCmdlet(),
+		invokeRestMethodCmdlet(),
+		invokeWebRequestCmdlet(),
+		convertToJsonCmdlet(),
+		convertFromJsonCmdlet(),
+		convertToCsvCmdlet(),
+		convertFromCsvCmdlet(),
+		importCsvCmdlet(),
+		exportCsvCmdlet(),
+		convertToHtmlCmdlet(),
+		traceCommandCmdlet(),
+	}
+	cmdlets = append(cmdlets, adCmdlets()...)
+	cmdlets = append(cmdlets, graphCmdlets()...)
+	return append(cmdlets, exchangeCmdlets()...)
+}
+
+func writeOutputCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Write-Output",
+		Params: []*Parameter{
+			{Name: "InputObject", Position: 1, Remaining: true, Mandatory: true, AllowEmpty: true, ValueFromPipeline: true},
+			{Name: "NoEnumerate", Switch: true},
+		},
+		Process: func(c *Call) error {
+			if c.HasInput {
+				return c.Emit(c.Input)
+			}
+			v := c.Get("InputObject")
+			if list, ok := v.([]interface{}); ok && len(list) == 1 {
+				v = list[0]
+			}
+			if c.Switch("NoEnumerate") {
+				return c.Emit(v)
+			}
+			if list, ok := v.([]interface{}); ok {
+				return c.EmitAll(list)
+			}
+			if !c.Has("InputObject") {
+				return nil
+			}
+			return c.Emit(v)
+		},
+	}
+}
+
+// consoleColors are the values of System.ConsoleColor
+var consoleColors = []string{
+	"Black", "DarkBlue", "DarkGreen", "DarkCyan", "DarkRed", "DarkMagenta", "DarkYellow", "Gray",
+	"DarkGray", "Blue", "Green", "Cyan", "Red", "Magenta", "Yellow", "White",
+}
+
+func writeHostCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Write-Host",
+		Params: []*Parameter{
+			{Name: "Object", Aliases: []string{"Msg", "Message"}, Position: 1, Remaining: true, ValueFromPipeline: true},
+			{Name: "NoNewline", Switch: true},
+			{Name: "Separator"},
+			{Name: "ForegroundColor"},
+			{Name: "BackgroundColor"},
+		},
+		Process: func(c *Call) error {
+			v := c.Get("Object")
+			if c.HasInput {
+				v = c.Input
+			}
+			sep := " "
+			if c.Has("Separator") {
+				sep = c.String("Separator")
+			}
+			var parts []string
+			var flatten func(v interface{})
+			flatten = func(v interface{}) {
+				if list, ok := v.([]interface{}); ok {
+					for _, item := range list {
+						flatten(item)
+					}
+					return
+				}
+				parts = append(parts, toString(v))
+			}
+			if v != nil {
+				flatten(v)
+			}
+			var colors [2]string
+			for i, param := range []string{"ForegroundColor", "BackgroundColor"} {
+				if c.Has(param) {
+					color, err := adEnum(c, param, "System.ConsoleColor", consoleColors...)
+					if err != nil {
+						return err
+					}
+					colors[i] = color
+				}
+			}
+			c.WriteHost(HostOutput{
+				Text:            strings.Join(parts, sep),
+				ForegroundColor: colors[0],
+				BackgroundColor: colors[1],
+				NoNewline:       c.Switch("NoNewline"),
+			})
+			return nil
+		},
+	}
+}
+
+func writeWarningCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Write-Warning",
+		Params: []*Parameter{{Name: "Message", Aliases: []string{"Msg"}, Position: 1, Mandatory: true, AllowEmpty: true, ValueFromPipeline: true}},
+		Process: func(c *Call) error {
+			msg := c.String("Message")
+			if c.HasInput {
+				msg = toString(c.Input)
+			}
+			c.WriteWarning(msg)
+			return nil
+		},
+	}
+}
+
+func writeVerboseCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Write-Verbose",
+		Params: []*Parameter{{Name: "Message", Aliases: []string{"Msg"}, Position: 1, Mandatory: true, AllowEmpty: true, ValueFromPipeline: true}},
+		Process: func(c *Call) error {
+			msg := c.String("Message")
+			if c.HasInput {
+				msg = toString(c.Input)
+			}
+			c.WriteVerbose(msg)
+			return nil
+		},
+	}
+}
+
+// errorCategories are the values of -Category, from System.Management.Automation.ErrorCategory
+var errorCategories = []string{
+	"NotSpecified", "OpenError", "CloseError", "DeviceError", "DeadlockDetected", "InvalidArgument",
+	"InvalidData", "InvalidOperation", "InvalidResult", "InvalidType", "MetadataError", "NotImplemented",
+	"NotInstalled", "ObjectNotFound", "OperationStopped", "OperationTimeout", "SyntaxError", "ParserError",
+	"PermissionDenied", "ResourceBusy", "ResourceExists", "ResourceUnavailable", "ReadError", "WriteError",
+	"FromStdErr", "SecurityError", "ProtocolError", "ConnectionError", "AuthenticationError",
+	"LimitsExceeded", "QuotaExceeded", "NotEnabled",
+}
+
+// writeErrorSets are the parameter sets that build a new error record
+var writeErrorSets = []string{"NoException", "WithException"}
+
+func writeErrorCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Write-Error",
+		DefaultSet: "NoException",
+		Params: []*Parameter{
+			{Name: "Message", Aliases: []string{"Msg"}, Position: 1, Sets: writeErrorSets, ValueFromPipeline: true},
+			{Name: "Exception", Mandatory: true, Sets: []string{"WithException"}},
+			{Name: "ErrorRecord", Mandatory: true, Sets: []string{"ErrorRecord"}},
+			{Name: "Category", Sets: writeErrorSets},
+			{Name: "ErrorId", Sets: writeErrorSets},
+			{Name: "TargetObject", Sets: writeErrorSets},
+		},
+		Process: func(c *Call) error {
+			if c.Has("ErrorRecord") {
+				re, ok := c.Get("ErrorRecord").(*RuntimeError)
+				if !ok {
+					return c.Errorf("Cannot bind parameter 'ErrorRecord'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Management.Automation.ErrorRecord\".", c.String("ErrorRecord"), typeName(c.Get("ErrorRecord")))
+				}
+				c.WriteError(re)
+				return nil
+			}
+			category := "NotSpecified"
+			if c.Has("Category") {
+				var err error
+				if category, err = adEnum(c, "Category", "System.Management.Automation.ErrorCategory", errorCategories...); err != nil {
+					return err
+				}
+			}
+			msg := c.String("Message")
+			if c.HasInput {
+				msg = toString(c.Input)
+			}
+			exception, _ := c.Get("Exception").(*PSObject)
+			if exception != nil && !c.Has("Message") && !c.HasInput {
+				msg = toString(propertyOf(exception, "Message"))
+			}
+			re := c.Runspace.newError(c.node, "", msg)
+			re.Category, re.TargetObject, re.activity, re.inner = category, c.Get("TargetObject"), "Write-Error", ""
+			re.Exception, re.ErrorID = "Microsoft.PowerShell.Commands.WriteErrorException", "Microsoft.PowerShell.Commands.WriteErrorException"
+			if exception != nil {
+				re.Exception, re.exception = exception.TypeName(), exception
+			}
+			if id := c.String("ErrorId"); id != "" {
+				re.ErrorID = id
+			}
+			c.WriteError(re)
+			return nil
+		},
+	}
+}
+
+func forEachObjectCmdlet() *Cmdlet {
+	type state struct {
+		process []*ScriptBlock
+		member  string
+	}
+	return &Cmdlet{
+		Name: "ForEach-Object",
+		Params: []*Parameter{
+			{Name: "Process", Position: 1, Remaining: true, Mandatory: true, AllowEmpty: true, Sets: []string{"ScriptBlockSet"}},
+			{Name: "Begin", Sets: []string{"ScriptBlockSet"}},
+			{Name: "End", Sets: []string{"ScriptBlockSet"}},
+			{Name: "MemberName", Position: 1, Mandatory: true, Sets: []string{"PropertyAndMethodSet"}},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		Begin: func(c *Call) error {
+			st := &state{member: c.String("MemberName")}
+			for _, v := range asList(c.Get("Process")) {
+				switch b := v.(type) {
+				case *ScriptBlock:
+					st.process = append(st.process, b)
+				case string:
+					st.member = b
+				default:
+					return c.Errorf("Cannot bind parameter 'Process'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Management.Automation.ScriptBlock\".", toString(v), typeName(v))
+				}
+			}
+			c.State = st
+			begin, err := c.ScriptBlock("Begin")
+			if err != nil || begin == nil {
+				return err
+			}
+			return c.Runspace.invokeBlock(begin, invocation{}, c.emit)
+		},
+		Process: func(c *Call) error {
+			st := c.State.(*state)
+			input := c.Input
+			if !c.HasInput {
+				if !c.Has("InputObject") {
+					return nil
+				}
+				input = c.Get("InputObject")
+			}
+			if st.member != "" {
+				v, err := c.Runspace.getMember(input, st.member)
+				if err != nil {
+					return err
+				}
+				return c.EmitAll(v)
+			}
+			for _, sb := range st.process {
+				if err := c.Runspace.invokeBlock(sb, invocation{underscore: input, hasUnder: true}, c.emit); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		End: func(c *Call) error {
+			end, err := c.ScriptBlock("End")
+			if err != nil || end == nil {
+				return err
+			}
+			return c.Runspace.invokeBlock(end, invocation{}, c.emit)
+		},
+	}
+}
+
+func outNullCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:    "Out-Null",
+		Params:  []*Parameter{{Name: "InputObject", ValueFromPipeline: true}},
+		Process: func(c *Call) error { return nil },
+	}
+}
+
+func getDateCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Date",
+		Params: []*Parameter{
+			{Name: "Date", Position: 1, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Format"},
+		},
+		Process: func(c *Call) error {
+			t := c.Runspace.clock()
+			if c.Has("Date") {
+				v, err := convertTo(c.Get("Date"), "System.DateTime")
+				if err != nil {
+					return c.Errorf("Cannot bind parameter 'Date'. %s", err.Error())
+				}
+				t = v.(time.Time)
+			}
+			if c.Has("Format") {
+				return c.Emit(formatDate(t, c.String("Format")))
+			}
+			return c.Emit(t)
+		},
+	}
+}
+
+func getRandomCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Random",
+		Params: []*Parameter{
+			{Name: "Maximum", Aliases: []string{"Max"}, Position: 1, Sets: []string{"RandomNumberParameterSet"}},
+			{Name: "Minimum", Aliases: []string{"Min"}, Sets: []string{"RandomNumberParameterSet"}},
+			{Name: "InputObject", Mandatory: true, AllowEmpty: true, Sets: []string{"RandomListItemParameterSet"}, ValueFromPipeline: true},
+			{Name: "Count", Sets: []string{"RandomListItemParameterSet"}},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			items := c.Inputs
+			if c.Has("InputObject") {
+				items = asList(c.Get("InputObject"))
+			}
+			if len(items) > 0 {
+				count, err := c.Int("Count", 1)
+				if err != nil {
+					return err
+				}
+				shuffled := append([]interface{}{}, items...)
+				rs.rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+				if count > len(shuffled) {
+					count = len(shuffled)
+				}
+				return c.EmitAll(shuffled[:count])
+			}
+			min, err := c.Int("Minimum", 0)
+			if err != nil {
+				return err
+			}
+			max, err := c.Int("Maximum", 2147483647)
+			if err != nil {
+				return err
+			}
+			if max <= min {
+				return c.Errorf("The Minimum value (%d) cannot be greater than or equal to the Maximum value (%d).", min, max)
+			}
+			return c.Emit(min + rs.rand.Intn(max-min))
+		},
+	}
+}
+
+func startSleepCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Start-Sleep",
+		Params: []*Parameter{
+			{Name: "Seconds", Aliases: []string{"s"}, Position: 1, Mandatory: true, Sets: []string{"Seconds"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Milliseconds", Aliases: []string{"ms"}, Mandatory: true, Sets: []string{"Milliseconds"}, ValueFromPipelineByPropertyName: true},
+		},
+		// Sleeping is simulated: scripts finish instantly
+		Process: func(c *Call) error { return nil },
+	}
+}
+
+func getVariableCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Variable",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "ValueOnly", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			patterns := c.Strings("Name")
+			if len(patterns) == 0 {
+				patterns = []string{"*"}
+			}
+			seen := map[string]bool{}
+			var vars []*Variable
+			for sc := rs.scope; sc != nil; sc = sc.parent {
+				for key, v := range sc.vars {
+					if !seen[key] {
+						seen[key] = true
+						vars = append(vars, v)
+					}
+				}
+			}
+			sortVariables(vars)
+			for _, pattern := range patterns {
+				found := false
+				for _, v := range vars {
+					if !MatchWildcard(pattern, v.Name, false) {
+						continue
+					}
+					found = true
+					var out interface{} = v.Value
+					if !c.Switch("ValueOnly") {
+						out = NewObject("System.Management.Automation.PSVariable").
+							Add("Name", v.Name).
+							Add("Value", v.Value)
+					}
+					if err := c.Emit(out); err != nil {
+						return err
+					}
+				}
+				if !found && !HasWildcard(pattern) {
+					c.WriteError(c.Errorf("Cannot find a variable with the name '%s'.", pattern))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func sortVariables(vars []*Variable) {
+	for i := 1; i < len(vars); i++ {
+		for j := i; j > 0 && strings.ToLower(vars[j].Name) < strings.ToLower(vars[j-1].Name); j-- {
+			vars[j], vars[j-1] = vars[j-1], vars[j]
+		}
+	}
+}
+
+func setVariableCmdlet(name string) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Value", Position: 2, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Scope"},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			value := c.Get("Value")
+			if c.HasInput {
+				value = c.Input
+			}
+			for _, n := range c.Strings("Name") {
+				if name == "New-Variable" && c.Runspace.scope.vars[strings.ToLower(n)] != nil {
+					c.WriteError(c.Errorf("A variable with name '%s' already exists.", n))
+					continue
+				}
+				target := n
+				if strings.EqualFold(c.String("Scope"), "Global") {
+					target = "global:" + n
+				}
+				if err := c.Runspace.assignVariable(target, value); err != nil {
+					c.WriteError(err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func removeVariableCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Remove-Variable",
+		Params: []*Parameter{{Name: "Name", Position: 1, Mandatory: true, ValueFromPipelineByPropertyName: true}},
+		Process: func(c *Call) error {
+			for _, n := range c.Strings("Name") {
+				key := strings.ToLower(n)
+				found := false
+				for sc := c.Runspace.scope; sc != nil; sc = sc.parent {
+					if v, ok := sc.vars[key]; ok {
+						if v.ReadOnly {
+							c.WriteError(c.Errorf("Cannot remove variable %s because it is constant or read-only.", n))
+						} else {
+							delete(sc.vars, key)
+						}
+						found = true
+						break
+					}
+				}
+				if !found {
+					c.WriteError(c.Errorf("Cannot find a variable with the name '%s'.", n))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func clearVariableCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Clear-Variable",
+		Params: []*Parameter{{Name: "Name", Position: 1, Mandatory: true, ValueFromPipelineByPropertyName: true}},
+		Process: func(c *Call) error {
+			for _, n := range c.Strings("Name") {
+				if v := c.Runspace.scope.lookup(n); v != nil {
+					v.Value = nil
+				} else {
+					c.WriteError(c.Errorf("Cannot find a variable with the name '%s'.", n))
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,1277 @@
+package psim
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/exchange"
+	"github.com/couragetogroww/powerhell/pkg/onprem"
+)
+
+// The ExchangeOnlineManagement cmdlets, backed by the runspace's simulated
+// organization. Like the V3 module they work on deserialized objects, so
+// results carry data but no methods.
+
+const exoModels = "Deserialized.Microsoft.Exchange."
+
+// Recipient type groups the cmdlets are restricted to
+var (
+	exoMailboxTypes = []string{exchange.UserMailbox, exchange.SharedMailbox, exchange.RoomMailbox, exchange.EquipmentMailbox}
+	exoGroupTypes   = []string{exchange.DistributionList, exchange.MailSecurity}
+	exoAllTypes     = append(append([]string(nil), exoMailboxTypes...), exoGroupTypes...)
+)
+
+// exoRecipient wraps a mailbox or group with every property in display order
+func exoRecipient(r *exchange.Recipient) *PSObject {
+	typ := "Data.Directory.Management.Mailbox"
+	if r.IsGroup() {
+		typ = "Data.Directory.Management.DistributionGroup"
+	}
+	obj := NewObject(exoModels + typ)
+	for _, name := range r.Properties() {
+		v, _ := r.Get(name)
+		obj.Add(name, adValue(v))
+	}
+	name := r.Name()
+	obj.ToStringFunc = func(*PSObject) string { return name }
+	return obj
+}
+
+// exoReducedRecipient is the slimmer object Get-Recipient and
+// Get-DistributionGroupMember return
+func exoReducedRecipient(r *exchange.Recipient) *PSObject {
+	obj := NewObject(exoModels + "Data.Directory.Management.ReducedRecipient")
+	for _, name := range []string{"Name", "RecipientType", "RecipientTypeDetails", "PrimarySmtpAddress", "Alias", "DisplayName", "Identity", "Guid"} {
+		v, _ := r.Get(name)
+		obj.Add(name, adValue(v))
+	}
+	name := r.Name()
+	obj.ToStringFunc = func(*PSObject) string { return name }
+	return obj
+}
+
+// exoIdentity extracts the identity from a string or an Exchange object
+func exoIdentity(v interface{}) string {
+	if obj, ok := v.(*PSObject); ok {
+		for _, prop := range []string{"Guid", "Identity", "Name"} {
+			if id, ok := obj.Get(prop); ok && id != nil {
+				return toString(id)
+			}
+		}
+	}
+	return toString(v)
+}
+
+// exoIdentities returns the identities a cmdlet operates on: piped objects or -Identity
+func exoIdentities(c *Call) []interface{} {
+	if c.HasInput {
+		return []interface{}{c.Input}
+	}
+	return asList(c.Get("Identity"))
+}
+
+// resolveRecipient resolves an identity to a recipient of one of the given types
+func resolveRecipient(c *Call, v interface{}, types []string) (*exchange.Recipient, error) {
+	id := exoIdentity(v)
+	r, err := c.Runspace.exchange.Resolve(id)
+	if err == nil && !containsFold(types, r.Type()) {
+		err = &exchange.NotFoundError{Identity: id}
+	}
+	if err != nil {
+		return nil, c.Errorf("%s", err.Error())
+	}
+	return r, nil
+}
+
+// exoFilter parses -Filter, reporting problems the way the service does
+func exoFilter(c *Call) (*onprem.Filter, error) {
+	text := filterText(c)
+	f, err := exchange.ParseFilter(text, c.Runspace.adFilterResolver)
+	if err == nil {
+		return f, nil
+	}
+	msg := err.Error()
+	if fe, ok := err.(*onprem.FilterError); ok {
+		msg = fmt.Sprintf("Invalid filter syntax. For a description of the filter parameter syntax see the command help.\n\"%s\" at position %d.", text, fe.Position)
+		if fe.Property != "" {
+			msg = fmt.Sprintf("'%s' is not a recognized filterable property. For a list of filterable properties see the command help.", fe.Property)
+		}
+	}
+	return nil, c.Errorf("Cannot bind parameter 'Filter' to the target. Exception setting \"Filter\": \"%s\"", msg)
+}
+
+// exoResultSize reads -ResultSize: a count or Unlimited (-1); 1000 by default
+func exoResultSize(c *Call) (int, error) {
+	if strings.EqualFold(c.String("ResultSize"), "Unlimited") {
+		return -1, nil
+	}
+	return c.Int("ResultSize", 1000)
+}
+
+// anrMatch is ambiguous name resolution: a prefix of the name, alias,
+// address or any word of the display name
+func anrMatch(r *exchange.Recipient, text string) bool {
+	text = strings.ToLower(text)
+	words := []string{r.Name(), r.PrimarySmtpAddress()}
+	for _, prop := range []string{"Alias", "DisplayName"} {
+		v, _ := r.Get(prop)
+		words = append(words, toString(v))
+		words = append(words, strings.Fields(toString(v))...)
+	}
+	for _, w := range words {
+		if strings.HasPrefix(strings.ToLower(w), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// exoMoreResults is the warning a -ResultSize cut short writes
+const exoMoreResults = "There are more results available than are currently displayed. To view them, increase the value for the ResultSize parameter."
+
+// exoQuery runs the search a Get-Mailbox style cmdlet describes with
+// -Identity, -RecipientTypeDetails, -Filter and -Anr. Results beyond
+// -ResultSize are dropped and reported through more.
+func exoQuery(c *Call, types []string) (out []*exchange.Recipient, more bool, err error) {
+	if c.HasInput || c.Has("Identity") {
+		for _, id := range exoIdentities(c) {
+			r, err := resolveRecipient(c, id, types)
+			if err != nil {
+				return nil, false, err
+			}
+			out = append(out, r)
+		}
+		return out, false, nil
+	}
+	if c.Has("RecipientTypeDetails") {
+		var narrowed []string
+		for _, t := range c.Strings("RecipientTypeDetails") {
+			if !containsFold(exoAllTypes, t) {
+				return nil, false, c.Errorf("Cannot bind parameter 'RecipientTypeDetails'. Cannot convert value \"%s\" to type \"Microsoft.Exchange.Data.Directory.Recipient.RecipientTypeDetails\".", t)
+			}
+			if containsFold(types, t) {
+				narrowed = append(narrowed, t)
+			}
+		}
+		if len(narrowed) == 0 {
+			return nil, false, nil
+		}
+		types = narrowed
+	}
+	var filter *onprem.Filter
+	if c.Has("Filter") {
+		f, err := exoFilter(c)
+		if err != nil {
+			return nil, false, err
+		}
+		filter = f
+	}
+	limit, err := exoResultSize(c)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, r := range c.Runspace.exchange.Query(types, filter) {
+		if c.Has("Anr") && !anrMatch(r, c.String("Anr")) {
+			continue
+		}
+		if limit >= 0 && len(out) == limit {
+			return out, true, nil
+		}
+		out = append(out, r)
+	}
+	return out, false, nil
+}
+
+// getRecipientsCmdlet implements Get-Mailbox, Get-DistributionGroup and Get-Recipient
+func getRecipientsCmdlet(name string, types []string, wrap func(*exchange.Recipient) *PSObject) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Sets: []string{"Identity"}, ValueFromPipeline: true},
+			{Name: "RecipientTypeDetails"},
+			{Name: "Filter", Sets: []string{"Identity", "AnrSet"}},
+			{Name: "Anr", Sets: []string{"AnrSet"}},
+			{Name: "ResultSize"},
+		},
+		Process: func(c *Call) error {
+			recipients, more, err := exoQuery(c, types)
+			if err != nil {
+				return err
+			}
+			for _, r := range recipients {
+				if err := c.Emit(wrap(r)); err != nil {
+					return err
+				}
+			}
+			if more {
+				c.WriteWarning(exoMoreResults)
+			}
+			return nil
+		},
+	}
+}
+
+// exoSettings are the string parameters Set-Mailbox and
+// Set-DistributionGroup write straight to a property
+var exoSettings = []string{"DisplayName", "Name", "Alias", "PrimarySmtpAddress", "Office", "ForwardingSmtpAddress"}
+
+// exoFlags are the [bool] parameters of Set-Mailbox and Set-DistributionGroup
+var exoFlags = []string{
+	"HiddenFromAddressListsEnabled", "DeliverToMailboxAndForward", "LitigationHoldEnabled",
+	"AuditEnabled", "RequireSenderAuthenticationEnabled",
+}
+
+// exoQuotas are Set-Mailbox's size parameters
+var exoQuotas = []string{"IssueWarningQuota", "ProhibitSendQuota", "ProhibitSendReceiveQuota", "MaxSendSize", "MaxReceiveSize"}
+
+// exoMultiValue applies a multivalued parameter: a list replaces the
+// current values, a hashtable with Add and Remove keys edits them
+func exoMultiValue(c *Call, param string, current []string, convert func(string) (string, error)) ([]string, []string, error) {
+	var added []string
+	convertAll := func(v interface{}) ([]string, error) {
+		var out []string
+		for _, item := range asList(v) {
+			s, err := convert(exoIdentity(item))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	h, ok := c.Get(param).(*Hashtable)
+	if !ok {
+		values, err := convertAll(c.Get(param))
+		return values, values, err
+	}
+	result := append([]string(nil), current...)
+	for _, k := range h.Keys() {
+		v, _ := h.Get(k)
+		values, err := convertAll(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch strings.ToLower(toString(k)) {
+		case "add":
+			for _, s := range values {
+				if !containsFold(result, s) {
+					result = append(result, s)
+					added = append(added, s)
+				}
+			}
+		case "remove":
+			var kept []string
+			for _, s := range result {
+				if !containsFold(values, s) {
+					kept = append(kept, s)
+				}
+			}
+			result = kept
+		default:
+			return nil, nil, c.Errorf("Cannot bind parameter '%s'. The hashtable key \"%s\" isn't valid. Use Add or Remove.", param, k)
+		}
+	}
+	return result, added, nil
+}
+
+// proxyAddress adds the smtp: prefix an address without a prefix gets
+func proxyAddress(s string) (string, error) {
+	if !strings.Contains(s, "@") {
+		return "", fmt.Errorf("The proxy address \"%s\" is invalid.", s)
+	}
+	if !strings.Contains(s, ":") {
+		return "smtp:" + s, nil
+	}
+	return s, nil
+}
+
+// exoChanges collects the property changes Set-Mailbox or
+// Set-DistributionGroup describe for one recipient, in the order to apply them
+func exoChanges(c *Call, r *exchange.Recipient) ([][2]interface{}, error) {
+	var changes [][2]interface{}
+	for _, name := range exoSettings {
+		if !c.Has(name) {
+			continue
+		}
+		var v interface{} = c.String(name)
+		if c.Get(name) == nil || v == "" {
+			v = nil
+		}
+		changes = append(changes, [2]interface{}{name, v})
+	}
+	for _, name := range exoFlags {
+		if !c.Has(name) {
+			continue
+		}
+		b, err := adBool(c, name)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, [2]interface{}{name, b})
+	}
+	for _, name := range exoQuotas {
+		if !c.Has(name) {
+			continue
+		}
+		size, err := exchange.ParseSize(c.String(name))
+		if err != nil {
+			return nil, c.Errorf("Cannot process argument transformation on parameter '%s'. %s", name, err.Error())
+		}
+		changes = append(changes, [2]interface{}{name, size})
+	}
+	if c.Has("Type") {
+		t, err := adEnum(c, "Type", "Microsoft.Exchange.Data.Directory.Management.ConvertibleMailboxSubType", "Regular", "Room", "Equipment", "Shared")
+		if err != nil {
+			return nil, err
+		}
+		details := t + "Mailbox"
+		if t == "Regular" {
+			details = exchange.UserMailbox
+		}
+		changes = append(changes, [2]interface{}{"RecipientTypeDetails", details})
+	}
+	for _, enum := range []string{"MemberJoinRestriction", "MemberDepartRestriction"} {
+		if c.Has(enum) {
+			values := []string{"Open", "Closed", "ApprovalRequired"}
+			if enum == "MemberDepartRestriction" {
+				values = values[:2]
+			}
+			v, err := adEnum(c, enum, "Microsoft.Exchange.Data.Directory.Recipient."+enum, values...)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, [2]interface{}{enum, v})
+		}
+	}
+	recipientName := func(id string) (string, error) {
+		m, err := resolveRecipient(c, id, exoAllTypes)
+		if err != nil {
+			return "", err
+		}
+		return m.Name(), nil
+	}
+	for _, multi := range []string{"GrantSendOnBehalfTo", "ManagedBy"} {
+		if !c.Has(multi) {
+			continue
+		}
+		current, _ := r.Get(multi)
+		values, _, err := exoMultiValue(c, multi, asStrings(current), recipientName)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, [2]interface{}{multi, append([]string{}, values...)})
+	}
+	if c.Has("EmailAddresses") {
+		current, _ := r.Get("EmailAddresses")
+		addrs, added, err := exoMultiValue(c, "EmailAddresses", asStrings(current), proxyAddress)
+		if err != nil {
+			return nil, c.Errorf("%s", err.Error())
+		}
+		for _, a := range added {
+			if !strings.HasPrefix(a, "SMTP:") {
+				continue
+			}
+			// a newly added primary address demotes the old one
+			for i, other := range addrs {
+				if other != a && strings.HasPrefix(other, "SMTP:") {
+					addrs[i] = "smtp:" + other[5:]
+				}
+			}
+		}
+		changes = append(changes, [2]interface{}{"EmailAddresses", addrs})
+	}
+	return changes, nil
+}
+
+// exoSnapshot renders a recipient's properties, to tell whether a Set changed anything
+func exoSnapshot(r *exchange.Recipient) string {
+	var sb strings.Builder
+	for _, name := range r.Properties() {
+		if name != "WhenChanged" {
+			v, _ := r.Get(name)
+			fmt.Fprintf(&sb, "%s=%v;", name, v)
+		}
+	}
+	return sb.String()
+}
+
+// setRecipientCmdlet implements Set-Mailbox and Set-DistributionGroup
+func setRecipientCmdlet(name string, types []string, params ...string) *Cmdlet {
+	ps := []*Parameter{{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true}}
+	for _, p := range params {
+		ps = append(ps, &Parameter{Name: p})
+	}
+	return &Cmdlet{
+		Name:   name,
+		Params: append(ps, &Parameter{Name: "Force", Switch: true}),
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				r, err := resolveRecipient(c, id, types)
+				if err != nil {
+					return err
+				}
+				changes, err := exoChanges(c, r)
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(r.Name(), name) {
+					continue
+				}
+				before := exoSnapshot(r)
+				for _, change := range changes {
+					if err := org.Set(r, change[0].(string), change[1]); err != nil {
+						return c.Errorf("%s", err.Error())
+					}
+				}
+				if exoSnapshot(r) == before {
+					c.WriteWarning(fmt.Sprintf("The command completed successfully but no settings of '%s' have been modified.", r.Name()))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func setMailboxCmdlet() *Cmdlet {
+	return setRecipientCmdlet("Set-Mailbox", exoMailboxTypes,
+		"DisplayName", "Name", "Alias", "PrimarySmtpAddress", "EmailAddresses", "Office", "Type",
+		"ForwardingSmtpAddress", "DeliverToMailboxAndForward", "GrantSendOnBehalfTo",
+		"HiddenFromAddressListsEnabled", "LitigationHoldEnabled", "AuditEnabled",
+		"IssueWarningQuota", "ProhibitSendQuota", "ProhibitSendReceiveQuota", "MaxSendSize", "MaxReceiveSize")
+}
+
+func setDistributionGroupCmdlet() *Cmdlet {
+	return setRecipientCmdlet("Set-DistributionGroup", exoGroupTypes,
+		"DisplayName", "Name", "Alias", "PrimarySmtpAddress", "ManagedBy", "EmailAddresses",
+		"MemberJoinRestriction", "MemberDepartRestriction", "RequireSenderAuthenticationEnabled",
+		"HiddenFromAddressListsEnabled")
+}
+
+func newMailboxCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "New-Mailbox",
+		DefaultSet: "User",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true},
+			{Name: "Alias"},
+			{Name: "DisplayName"},
+			{Name: "FirstName"},
+			{Name: "LastName"},
+			{Name: "PrimarySmtpAddress"},
+			{Name: "MicrosoftOnlineServicesID"},
+			{Name: "Password"},
+			{Name: "ResetPasswordOnNextLogon"},
+			{Name: "Shared", Switch: true, Sets: []string{"Shared"}},
+			{Name: "Room", Switch: true, Sets: []string{"Room"}},
+			{Name: "Equipment", Switch: true, Sets: []string{"Equipment"}},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			name := c.String("Name")
+			if name == "" {
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Name.")
+			}
+			kind := exchange.UserMailbox
+			for _, s := range []string{"Shared", "Room", "Equipment"} {
+				if c.Switch(s) {
+					if kind != exchange.UserMailbox {
+						return c.Errorf("Parameter set cannot be resolved using the specified named parameters.")
+					}
+					kind = s + "Mailbox"
+				}
+			}
+			upn := c.String("MicrosoftOnlineServicesID")
+			if kind == exchange.UserMailbox {
+				var missing []string
+				for _, p := range []string{"MicrosoftOnlineServicesID", "Password"} {
+					if !c.Has(p) {
+						missing = append(missing, p)
+					}
+				}
+				if len(missing) > 0 {
+					return c.Errorf("Cannot process command because of one or more missing mandatory parameters: %s.", strings.Join(missing, " "))
+				}
+				if _, err := secureStringParam(c, "Password"); err != nil {
+					return err
+				}
+				if at := strings.LastIndex(upn, "@"); at < 0 || !strings.EqualFold(upn[at+1:], org.Domain) {
+					return c.Errorf("The domain of MicrosoftOnlineServicesID \"%s\" isn't an accepted domain in your organization.", upn)
+				}
+			}
+			address := c.String("PrimarySmtpAddress")
+			if address == "" {
+				address = upn
+			}
+			if !c.ShouldProcess(name, "New-Mailbox") {
+				return nil
+			}
+			r, err := org.NewMailbox(kind, name, c.String("Alias"), address, upn)
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if c.Has("DisplayName") {
+				org.Set(r, "DisplayName", c.String("DisplayName"))
+			}
+			return c.Emit(exoRecipient(r))
+		},
+	}
+}
+
+func newDistributionGroupCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "New-DistributionGroup",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true},
+			{Name: "Alias"},
+			{Name: "DisplayName"},
+			{Name: "PrimarySmtpAddress"},
+			{Name: "Type"},
+			{Name: "ManagedBy"},
+			{Name: "Members"},
+			{Name: "Notes"},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			name := c.String("Name")
+			if name == "" {
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Name.")
+			}
+			security := false
+			if c.Has("Type") {
+				t, err := adEnum(c, "Type", "Microsoft.Exchange.Data.Directory.Recipient.GroupType", "Distribution", "Security")
+				if err != nil {
+					return err
+				}
+				security = t == "Security"
+			}
+			managedBy := []string{"admin"}
+			if c.Has("ManagedBy") {
+				managedBy = nil
+				for _, id := range asList(c.Get("ManagedBy")) {
+					m, err := resolveRecipient(c, id, exoMailboxTypes)
+					if err != nil {
+						return err
+					}
+					managedBy = append(managedBy, m.Name())
+				}
+			}
+			var members []*exchange.Recipient
+			for _, id := range asList(c.Get("Members")) {
+				m, err := resolveRecipient(c, id, exoAllTypes)
+				if err != nil {
+					return err
+				}
+				members = append(members, m)
+			}
+			if !c.ShouldProcess(name, "New-DistributionGroup") {
+				return nil
+			}
+			g, err := org.NewGroup(name, c.String("Alias"), c.String("PrimarySmtpAddress"), security, managedBy)
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if c.Has("DisplayName") {
+				org.Set(g, "DisplayName", c.String("DisplayName"))
+			}
+			for _, m := range members {
+				if err := org.AddMember(g, m); err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+				}
+			}
+			return c.Emit(exoRecipient(g))
+		},
+	}
+}
+
+// removeRecipientCmdlet implements Remove-Mailbox and Remove-DistributionGroup
+func removeRecipientCmdlet(name string, types []string) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "Permanent"},
+			{Name: "BypassSecurityGroupManagerCheck", Switch: true},
+		},
+		Process: func(c *Call) error {
+			for _, id := range exoIdentities(c) {
+				r, err := resolveRecipient(c, id, types)
+				if err != nil {
+					return err
+				}
+				if c.ShouldProcess(r.Name(), name) {
+					c.Runspace.exchange.Remove(r)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func getMailboxStatisticsCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Get-MailboxStatistics",
+		Params: []*Parameter{{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true}},
+		Process: func(c *Call) error {
+			for _, id := range exoIdentities(c) {
+				r, err := resolveRecipient(c, id, exoMailboxTypes)
+				if err != nil {
+					return err
+				}
+				// sizes are derived from the mailbox guid, so they are stable across runs
+				h := fnv.New64a()
+				h.Write([]byte(r.Guid))
+				seed := int64(h.Sum64() >> 1)
+				items := 150 + seed%12000
+				size := items * (30*1024 + seed%(90*1024))
+				deleted := items / (10 + seed%20)
+				display, _ := r.Get("DisplayName")
+				var lastLogon interface{}
+				if r.Type() == exchange.UserMailbox || r.Type() == exchange.SharedMailbox {
+					lastLogon = c.Runspace.clock().Add(-time.Duration(seed%(72*60)) * time.Minute).Truncate(time.Second)
+				}
+				obj := NewObject(exoModels + "Management.MapiTasks.Presentation.MailboxStatistics")
+				obj.Add("DisplayName", display)
+				obj.Add("ItemCount", int(items))
+				obj.Add("TotalItemSize", exchange.FormatSize(size))
+				obj.Add("DeletedItemCount", int(deleted))
+				obj.Add("TotalDeletedItemSize", exchange.FormatSize(deleted*40*1024))
+				obj.Add("LastLogonTime", lastLogon)
+				obj.Add("MailboxTypeDetail", r.Type())
+				obj.Add("MailboxGuid", r.Guid)
+				if err := c.Emit(obj); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// exoPermission wraps a mailbox permission entry
+func exoPermission(org *exchange.Organization, p *exchange.Permission) *PSObject {
+	identity := ""
+	if mbx := org.RecipientByGuid(p.Mailbox); mbx != nil {
+		identity = mbx.Name()
+	}
+	return NewObject(exoModels+"Management.RecipientTasks.MailboxAcePresentationObject").
+		Add("Identity", identity).
+		Add("User", p.User).
+		Add("AccessRights", stringsToValues(p.AccessRights)).
+		Add("IsInherited", p.IsInherited).
+		Add("Deny", p.Deny).
+		Add("InheritanceType", p.InheritanceType)
+}
+
+// exoRecipientPermission wraps a SendAs entry
+func exoRecipientPermission(org *exchange.Organization, p *exchange.Permission) *PSObject {
+	identity := ""
+	if mbx := org.RecipientByGuid(p.Mailbox); mbx != nil {
+		identity = mbx.Name()
+	}
+	return NewObject(exoModels+"Management.RecipientTasks.RecipientPermission").
+		Add("Identity", identity).
+		Add("Trustee", p.User).
+		Add("AccessControlType", "Allow").
+		Add("AccessRights", stringsToValues(p.AccessRights)).
+		Add("IsInherited", p.IsInherited).
+		Add("InheritanceType", p.InheritanceType)
+}
+
+// trusteeName resolves a -User or -Trustee argument to how the entry
+// names it; principals such as NT AUTHORITY\SELF pass through
+func trusteeName(c *Call, v interface{}) string {
+	id := exoIdentity(v)
+	if r, err := c.Runspace.exchange.Resolve(id); err == nil {
+		return r.PrincipalName()
+	}
+	return id
+}
+
+// getPermissionCmdlet implements Get-MailboxPermission and Get-RecipientPermission
+func getPermissionCmdlet(name, trusteeParam string, list func(*exchange.Organization, *exchange.Recipient) []*exchange.Permission, wrap func(*exchange.Organization, *exchange.Permission) *PSObject) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: trusteeParam},
+			{Name: "AccessRights"},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				mbx, err := resolveRecipient(c, id, exoMailboxTypes)
+				if err != nil {
+					return err
+				}
+				for _, p := range list(org, mbx) {
+					if c.Has(trusteeParam) && !strings.EqualFold(p.User, trusteeName(c, c.Get(trusteeParam))) {
+						continue
+					}
+					if c.Has("AccessRights") && !containsFold(p.AccessRights, c.String("AccessRights")) {
+						continue
+					}
+					if err := c.Emit(wrap(org, p)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// permissionTarget resolves the mailbox and trustee of an Add/Remove permission cmdlet
+func permissionTarget(c *Call, id interface{}, trusteeParam string) (mbx, user *exchange.Recipient, err error) {
+	if mbx, err = resolveRecipient(c, id, exoMailboxTypes); err != nil {
+		return nil, nil, err
+	}
+	if user, err = resolveRecipient(c, c.Get(trusteeParam), exoAllTypes); err != nil {
+		return nil, nil, err
+	}
+	return mbx, user, nil
+}
+
+func addMailboxPermissionCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Add-MailboxPermission",
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "User", Mandatory: true},
+			{Name: "AccessRights", Mandatory: true},
+			{Name: "AutoMapping"},
+			{Name: "InheritanceType"},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				mbx, user, err := permissionTarget(c, id, "User")
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(mbx.Name(), "Add-MailboxPermission") {
+					continue
+				}
+				p, existed, err := org.AddMailboxPermission(mbx, user, c.Strings("AccessRights"))
+				if err != nil {
+					return c.Errorf("%s", err.Error())
+				}
+				if existed {
+					display, _ := user.Get("DisplayName")
+					c.WriteWarning(fmt.Sprintf("An existing permission entry was found for user: %s.", toString(display)))
+					continue
+				}
+				if err := c.Emit(exoPermission(org, p)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func removeMailboxPermissionCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Remove-MailboxPermission",
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "User", Mandatory: true},
+			{Name: "AccessRights", Mandatory: true},
+			{Name: "InheritanceType"},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				mbx, user, err := permissionTarget(c, id, "User")
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(mbx.Name(), "Remove-MailboxPermission") {
+					continue
+				}
+				if err := org.RemoveMailboxPermission(mbx, user, c.Strings("AccessRights")); err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// recipientPermissionCmdlet implements Add-RecipientPermission and Remove-RecipientPermission
+func recipientPermissionCmdlet(name string, add bool) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "Trustee", Mandatory: true},
+			{Name: "AccessRights", Mandatory: true},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				mbx, user, err := permissionTarget(c, id, "Trustee")
+				if err != nil {
+					return err
+				}
+				if _, err := adEnum(c, "AccessRights", "Microsoft.Exchange.Management.RecipientTasks.RecipientAccessRight", "SendAs"); err != nil {
+					return err
+				}
+				if !c.ShouldProcess(mbx.Name(), name) {
+					continue
+				}
+				if !add {
+					if err := org.RemoveRecipientPermission(mbx, user); err != nil {
+						c.WriteError(c.Errorf("%s", err.Error()))
+					}
+					continue
+				}
+				p, err := org.AddRecipientPermission(mbx, user)
+				if err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+					continue
+				}
+				if err := c.Emit(exoRecipientPermission(org, p)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func getDistributionGroupMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-DistributionGroupMember",
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "ResultSize"},
+		},
+		Process: func(c *Call) error {
+			limit, err := exoResultSize(c)
+			if err != nil {
+				return err
+			}
+			for _, id := range exoIdentities(c) {
+				g, err := resolveRecipient(c, id, exoGroupTypes)
+				if err != nil {
+					return err
+				}
+				for i, m := range c.Runspace.exchange.Members(g) {
+					if limit >= 0 && i == limit {
+						c.WriteWarning(exoMoreResults)
+						break
+					}
+					if err := c.Emit(exoReducedRecipient(m)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// groupMemberCmdlet implements Add-DistributionGroupMember and Remove-DistributionGroupMember
+func groupMemberCmdlet(name string, apply func(org *exchange.Organization, g, m *exchange.Recipient) error) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "Member", Mandatory: true},
+			{Name: "BypassSecurityGroupManagerCheck", Switch: true},
+		},
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				g, err := resolveRecipient(c, id, exoGroupTypes)
+				if err != nil {
+					return err
+				}
+				for _, mid := range asList(c.Get("Member")) {
+					m, err := resolveRecipient(c, mid, exoAllTypes)
+					if err != nil {
+						return err
+					}
+					if !c.ShouldProcess(g.Name(), name) {
+						continue
+					}
+					if err := apply(org, g, m); err != nil {
+						c.WriteError(c.Errorf("%s", err.Error()))
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// exoRule wraps a transport rule; each predicate the rule sets becomes a property
+func exoRule(r *exchange.TransportRule) *PSObject {
+	names := func(preds []exchange.Predicate) []interface{} {
+		out := []interface{}{}
+		for _, p := range preds {
+			out = append(out, p.Name)
+		}
+		return out
+	}
+	obj := NewObject(exoModels + "MessagingPolicies.Rules.Tasks.Rule")
+	obj.Add("Name", r.Name)
+	obj.Add("State", r.State)
+	obj.Add("Mode", r.Mode)
+	obj.Add("Priority", r.Priority)
+	obj.Add("Comments", r.Comments)
+	obj.Add("Description", r.Description())
+	obj.Add("Conditions", names(r.Conditions))
+	obj.Add("Exceptions", names(r.Exceptions))
+	obj.Add("Actions", names(r.Actions))
+	for _, list := range [][]exchange.Predicate{r.Conditions, r.Exceptions, r.Actions} {
+		for _, p := range list {
+			obj.Add(p.Name, adValue(p.Value))
+		}
+	}
+	obj.Add("Identity", r.Name)
+	obj.Add("Guid", r.Guid)
+	obj.Add("WhenChanged", r.WhenChanged)
+	name := r.Name
+	obj.ToStringFunc = func(*PSObject) string { return name }
+	return obj
+}
+
+// ruleParams are the predicate parameters of New-TransportRule and Set-TransportRule
+func ruleParams() []*Parameter {
+	params := []*Parameter{
+		{Name: "Priority"},
+		{Name: "Mode"},
+		{Name: "Comments"},
+	}
+	for _, n := range exchange.ConditionNames {
+		params = append(params, &Parameter{Name: n}, &Parameter{Name: "ExceptIf" + n})
+	}
+	for _, n := range exchange.ActionNames {
+		params = append(params, &Parameter{Name: n})
+	}
+	return params
+}
+
+// ruleChanges collects the predicates bound on the command line; a
+// $false flag or an empty value clears the predicate
+func ruleChanges(c *Call) map[string]interface{} {
+	changes := map[string]interface{}{}
+	for _, p := range c.Cmdlet.Params {
+		if !exchange.IsPredicate(p.Name) || !c.Has(p.Name) {
+			continue
+		}
+		var v interface{}
+		switch {
+		case exchange.IsFlagPredicate(p.Name):
+			if toBool(c.Get(p.Name)) {
+				v = true
+			}
+		case exchange.IsListPredicate(p.Name):
+			if list := c.Strings(p.Name); len(list) > 0 {
+				v = list
+			}
+		default:
+			if s := c.String(p.Name); s != "" {
+				v = s
+			}
+		}
+		changes[p.Name] = v
+	}
+	return changes
+}
+
+// ruleMode validates -Mode
+func ruleMode(c *Call) (string, error) {
+	return adEnum(c, "Mode", "Microsoft.Exchange.MessagingPolicies.Rules.RuleMode", "Audit", "AuditAndNotify", "Enforce")
+}
+
+func newTransportRuleCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "New-TransportRule",
+		Params: append([]*Parameter{{Name: "Name", Position: 1, Mandatory: true}, {Name: "Enabled"}}, ruleParams()...),
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			name := c.String("Name")
+			if name == "" {
+				return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Name.")
+			}
+			r := &exchange.TransportRule{Name: name, Comments: c.String("Comments")}
+			if c.Has("Mode") {
+				mode, err := ruleMode(c)
+				if err != nil {
+					return err
+				}
+				r.Mode = mode
+			}
+			if c.Has("Enabled") {
+				enabled, err := adBool(c, "Enabled")
+				if err != nil {
+					return err
+				}
+				if !enabled {
+					r.State = "Disabled"
+				}
+			}
+			for p, v := range ruleChanges(c) {
+				r.Set(p, v)
+			}
+			priority, err := c.Int("Priority", -1)
+			if err != nil {
+				return err
+			}
+			if !c.ShouldProcess(name, "New-TransportRule") {
+				return nil
+			}
+			if err := org.NewTransportRule(r, priority); err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			return c.Emit(exoRule(r))
+		},
+	}
+}
+
+// resolveRule resolves an -Identity argument to a transport rule
+func resolveRule(c *Call, v interface{}) (*exchange.TransportRule, error) {
+	r, err := c.Runspace.exchange.TransportRule(exoIdentity(v))
+	if err != nil {
+		return nil, c.Errorf("%s", err.Error())
+	}
+	return r, nil
+}
+
+func getTransportRuleCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-TransportRule",
+		Params: []*Parameter{
+			{Name: "Identity", Position: 1, ValueFromPipeline: true},
+			{Name: "State"},
+		},
+		Process: func(c *Call) error {
+			rules := c.Runspace.exchange.TransportRules()
+			if c.HasInput || c.Has("Identity") {
+				rules = nil
+				for _, id := range exoIdentities(c) {
+					r, err := resolveRule(c, id)
+					if err != nil {
+						return err
+					}
+					rules = append(rules, r)
+				}
+			}
+			for _, r := range rules {
+				if c.Has("State") && !strings.EqualFold(r.State, c.String("State")) {
+					continue
+				}
+				if err := c.Emit(exoRule(r)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func setTransportRuleCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Set-TransportRule",
+		Params: append([]*Parameter{{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true}, {Name: "Name"}}, ruleParams()...),
+		Process: func(c *Call) error {
+			org := c.Runspace.exchange
+			for _, id := range exoIdentities(c) {
+				r, err := resolveRule(c, id)
+				if err != nil {
+					return err
+				}
+				if !c.ShouldProcess(r.Name, "Set-TransportRule") {
+					continue
+				}
+				if err := org.SetTransportRule(r, ruleChanges(c)); err != nil {
+					return c.Errorf("%s", err.Error())
+				}
+				if c.Has("Name") {
+					if other, err := org.TransportRule(c.String("Name")); err == nil && other != r {
+						return c.Errorf("A transport rule with the name \"%s\" already exists. Please specify a different name.", c.String("Name"))
+					}
+					r.Name = c.String("Name")
+				}
+				if c.Has("Comments") {
+					r.Comments = c.String("Comments")
+				}
+				if c.Has("Mode") {
+					mode, err := ruleMode(c)
+					if err != nil {
+						return err
+					}
+					r.Mode = mode
+				}
+				if c.Has("Priority") {
+					priority, err := c.Int("Priority", 0)
+					if err != nil {
+						return err
+					}
+					if err := org.SetPriority(r, priority); err != nil {
+						return c.Errorf("%s", err.Error())
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// ruleStateCmdlet implements Remove-, Enable- and Disable-TransportRule
+func ruleStateCmdlet(name string, apply func(org *exchange.Organization, r *exchange.TransportRule)) *Cmdlet {
+	return &Cmdlet{
+		Name:   name,
+		Params: []*Parameter{{Name: "Identity", Position: 1, Mandatory: true, ValueFromPipeline: true}},
+		Process: func(c *Call) error {
+			for _, id := range exoIdentities(c) {
+				r, err := resolveRule(c, id)
+				if err != nil {
+					return err
+				}
+				if c.ShouldProcess(r.Name, name) {
+					apply(c.Runspace.exchange, r)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// setRuleState returns an apply function for Enable- and Disable-TransportRule
+func setRuleState(state string) func(*exchange.Organization, *exchange.TransportRule) {
+	return func(org *exchange.Organization, r *exchange.TransportRule) {
+		r.State = state
+		org.Touch(r)
+	}
+}
+
+func connectExchangeOnlineCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Connect-ExchangeOnline",
+		Params: []*Parameter{
+			{Name: "UserPrincipalName", Position: 1},
+			{Name: "Organization"},
+			{Name: "AppId"},
+			{Name: "CertificateThumbprint"},
+			{Name: "Device", Switch: true},
+			{Name: "ShowBanner"},
+			{Name: "ShowProgress"},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			upn := c.String("UserPrincipalName")
+			if upn == "" {
+				upn = "admin@" + rs.exchange.Domain
+			}
+			showBanner := true
+			if c.Has("ShowBanner") {
+				show, err := adBool(c, "ShowBanner")
+				if err != nil {
+					return err
+				}
+				showBanner = show
+			}
+			if showBanner {
+				for _, line := range []string{
+					"----------------------------------------------------------------------------------------",
+					"This V3 EXO PowerShell module contains new REST API backed Exchange Online cmdlets which doesn't require WinRM for Client-Server communication. You can now run these cmdlets after turning off WinRM Basic Auth in your client machine thus making it more secure.",
+					"",
+					"Unlike the EXO* prefixed cmdlets, the cmdlets in this module support full functional parity with the RPS (V1) cmdlets.",
+					"",
+					"V3 cmdlets in the downloaded module are resilient to transient failures, handling retries and throttling errors inherently.",
+					"",
+					"For more information check https://aka.ms/exov3-module",
+					"----------------------------------------------------------------------------------------",
+					"",
+				} {
+					c.WriteHost(HostOutput{Text: line})
+				}
+			}
+			conn := NewObject("Microsoft.Exchange.Management.ExoPowershellSnapin.ConnectionInformation")
+			conn.Add("ConnectionId", rs.newGUID())
+			conn.Add("State", "Connected")
+			conn.Add("Id", 1)
+			conn.Add("Name", "ExchangeOnline_1")
+			conn.Add("UserPrincipalName", upn)
+			conn.Add("ConnectionUri", "https://outlook.office365.com")
+			conn.Add("TenantID", rs.tenant.ID)
+			conn.Add("TokenStatus", "Active")
+			conn.Add("ModuleName", `C:\Users\learner\AppData\Local\Temp\tmpEXO_exo1.rmd`)
+			conn.Add("IsEopSession", false)
+			rs.exoConnected = conn
+			return nil
+		},
+	}
+}
+
+func disconnectExchangeOnlineCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Disconnect-ExchangeOnline",
+		Params: []*Parameter{
+			{Name: "ConnectionId"},
+		},
+		Process: func(c *Call) error {
+			if c.Runspace.exoConnected == nil {
+				return nil
+			}
+			if !c.ShouldProcess("ExchangeOnline_1", "Disconnect-ExchangeOnline") {
+				return nil
+			}
+			c.Runspace.exoConnected = nil
+			c.WriteHost(HostOutput{Text: "Disconnected successfully !"})
+			return nil
+		},
+	}
+}
+
+func getConnectionInformationCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-ConnectionInformation",
+		Process: func(c *Call) error {
+			if c.Runspace.exoConnected == nil {
+				return nil
+			}
+			return c.Emit(c.Runspace.exoConnected)
+		},
+	}
+}
+
+// exchangeCmdlets are the ExchangeOnlineManagement module cmdlets
+func exchangeCmdlets() []*Cmdlet {
+	return []*Cmdlet{
+		connectExchangeOnlineCmdlet(),
+		disconnectExchangeOnlineCmdlet(),
+		getConnectionInformationCmdlet(),
+		getRecipientsCmdlet("Get-Mailbox", exoMailboxTypes, exoRecipient),
+		getRecipientsCmdlet("Get-DistributionGroup", exoGroupTypes, exoRecipient),
+		getRecipientsCmdlet("Get-Recipient", exoAllTypes, exoReducedRecipient),
+		setMailboxCmdlet(),
+		setDistributionGroupCmdlet(),
+		newMailboxCmdlet(),
+		newDistributionGroupCmdlet(),
+		removeRecipientCmdlet("Remove-Mailbox", exoMailboxTypes),
+		removeRecipientCmdlet("Remove-DistributionGroup", exoGroupTypes),
+		getMailboxStatisticsCmdlet(),
+		getPermissionCmdlet("Get-MailboxPermission", "User", (*exchange.Organization).MailboxPermissions, exoPermission),
+		addMailboxPermissionCmdlet(),
+		removeMailboxPermissionCmdlet(),
+		getPermissionCmdlet("Get-RecipientPermission", "Trustee", (*exchange.Organization).RecipientPermissions, exoRecipientPermission),
+		recipientPermissionCmdlet("Add-RecipientPermission", true),
+		recipientPermissionCmdlet("Remove-RecipientPermission", false),
+		getDistributionGroupMemberCmdlet(),
+		groupMemberCmdlet("Add-DistributionGroupMember", (*exchange.Organization).AddMember),
+		groupMemberCmdlet("Remove-DistributionGroupMember", (*exchange.Organization).RemoveMember),
+		newTransportRuleCmdlet(),
+		getTransportRuleCmdlet(),
+		setTransportRuleCmdlet(),
+		ruleStateCmdlet("Remove-TransportRule", (*exchange.Organization).RemoveTransportRule),
+		ruleStateCmdlet("Enable-TransportRule", setRuleState("Enabled")),
+		ruleStateCmdlet("Disable-TransportRule", setRuleState("Disabled")),
+	}
+}
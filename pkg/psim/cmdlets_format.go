@@ -0,0 +1,305 @@
+package psim
+
+import "strings"
+
+// The Format-* cmdlets reduce objects to format blocks that the console,
+// Out-String and Out-File lay out against the console width. As in
+// PowerShell, their output is only good for displaying.
+
+// formatItems enumerates hashtables into their entries, as the formatter sees them
+func formatItems(inputs []interface{}) []interface{} {
+	var items []interface{}
+	for _, v := range inputs {
+		if h, ok := v.(*Hashtable); ok {
+			for _, e := range dictionaryEntries(h) {
+				items = append(items, e)
+			}
+			continue
+		}
+		items = append(items, v)
+	}
+	return items
+}
+
+// formatInput lays out a Format-* cmdlet's input as shape. With -Property
+// every object goes into one block whose columns come from the first object;
+// without it objects are laid out with their type's view and values that
+// have no properties pass through unchanged.
+func formatInput(c *Call, shape string) ([]interface{}, error) {
+	specs, err := propertySpecs(c, "Property")
+	if err != nil {
+		return nil, err
+	}
+	var groupBy *propertySpec
+	if c.Has("GroupBy") {
+		groupSpecs, err := propertySpecs(c, "GroupBy")
+		if err != nil {
+			return nil, err
+		}
+		if len(groupSpecs) > 0 {
+			groupBy = &groupSpecs[0]
+		}
+	}
+	items := formatItems(bufferedInput(c))
+	var out []interface{}
+	if len(specs) > 0 {
+		if len(items) == 0 {
+			return nil, nil
+		}
+		b, err := specBlock(c, shape, specs, items)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{b}, groupEntries(c, b, groupBy, items)
+	}
+	for i := 0; i < len(items); {
+		obj, ok := items[i].(*PSObject)
+		if !ok || len(obj.Properties()) == 0 {
+			out = append(out, items[i])
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(items) && sameFormat(obj, items[j]) {
+			j++
+		}
+		objs := make([]*PSObject, 0, j-i)
+		for _, o := range items[i:j] {
+			objs = append(objs, o.(*PSObject))
+		}
+		b := shapeBlock(shape, objs)
+		if err := groupEntries(c, b, groupBy, items[i:j]); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+		i = j
+	}
+	return out, nil
+}
+
+// shapeBlock lays out objects with their type's table or list view, or with
+// all of their properties when the type has no view of that shape
+func shapeBlock(shape string, objs []*PSObject) *formatBlock {
+	view := viewFor(objs[0])
+	var group func(*PSObject) string
+	var cols []viewColumn
+	if view != nil {
+		group = view.group
+		switch shape {
+		case "table":
+			cols = view.table
+		case "list":
+			cols = view.list
+		}
+	}
+	switch {
+	case shape == "wide" && objs[0].Property("Name") != nil:
+		cols = []viewColumn{col("Name", 0, alignLeft)}
+	case shape == "wide":
+		cols = []viewColumn{calc("", 0, alignLeft, func(o *PSObject) interface{} { return o.String() })}
+	case cols == nil:
+		cols = propertyColumns(objs[0])
+	}
+	return viewBlock(shape, cols, group, objs)
+}
+
+// specBlock lays out items with the columns of a -Property argument.
+// Wildcards expand against the properties of the first item.
+func specBlock(c *Call, shape string, specs []propertySpec, items []interface{}) (*formatBlock, error) {
+	first, _ := items[0].(*PSObject)
+	var expanded []propertySpec
+	for _, spec := range specs {
+		if spec.expr == nil && spec.from == "" && HasWildcard(spec.name) {
+			for _, name := range propertyNames(items[0]) {
+				if MatchWildcard(spec.name, name, false) {
+					expanded = append(expanded, propertySpec{name: name})
+				}
+			}
+			continue
+		}
+		expanded = append(expanded, spec)
+	}
+	b := &formatBlock{shape: shape}
+	for _, spec := range expanded {
+		label := spec.label()
+		if first != nil && spec.expr == nil && spec.from == "" {
+			if p := first.Property(label); p != nil {
+				label = p.Name
+			}
+		}
+		b.columns = append(b.columns, column{label: label, width: spec.width, align: spec.align})
+	}
+	for _, item := range items {
+		e := formatEntry{cells: make([]cell, len(expanded))}
+		for i, spec := range expanded {
+			v, _, err := c.Runspace.propertyValue(item, spec)
+			if err != nil {
+				return nil, err
+			}
+			e.cells[i] = newCell(v)
+			if spec.format != "" {
+				if text, err := formatValue(v, spec.format); err == nil {
+					e.cells[i].text = text
+				}
+			}
+		}
+		b.entries = append(b.entries, e)
+	}
+	return b, nil
+}
+
+// groupEntries applies -GroupBy, which starts a new table whenever the
+// grouping value changes
+func groupEntries(c *Call, b *formatBlock, groupBy *propertySpec, items []interface{}) error {
+	if groupBy == nil {
+		return nil
+	}
+	for i, item := range items {
+		v, _, err := c.Runspace.propertyValue(item, *groupBy)
+		if err != nil {
+			return err
+		}
+		text := cellText(v)
+		if groupBy.format != "" {
+			if s, err := formatValue(v, groupBy.format); err == nil {
+				text = s
+			}
+		}
+		b.entries[i].group = "   " + groupBy.label() + ": " + text
+	}
+	return nil
+}
+
+// emitBlocks writes a Format-* cmdlet's output, applying options to every block
+func emitBlocks(c *Call, out []interface{}, options func(b *formatBlock)) error {
+	for _, v := range out {
+		if b, ok := v.(*formatBlock); ok {
+			options(b)
+		}
+		if err := c.Emit(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTableCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Format-Table",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "AutoSize", Switch: true},
+			{Name: "HideTableHeaders", Switch: true},
+			{Name: "Wrap", Switch: true},
+			{Name: "GroupBy"},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			out, err := formatInput(c, "table")
+			if err != nil {
+				return err
+			}
+			return emitBlocks(c, out, func(b *formatBlock) {
+				b.autoSize = c.Switch("AutoSize")
+				b.hideHeaders = c.Switch("HideTableHeaders")
+				b.wrap = c.Switch("Wrap")
+			})
+		},
+	}
+}
+
+func formatListCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Format-List",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "GroupBy"},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			out, err := formatInput(c, "list")
+			if err != nil {
+				return err
+			}
+			return emitBlocks(c, out, func(b *formatBlock) {})
+		},
+	}
+}
+
+func formatWideCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Format-Wide",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "AutoSize", Switch: true},
+			{Name: "Column"},
+			{Name: "GroupBy"},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			if c.Switch("AutoSize") && c.Has("Column") {
+				return c.Errorf("Parameter set cannot be resolved using the specified named parameters. One or more parameters issued cannot be used together or an insufficient number of parameters were provided.")
+			}
+			columns, err := c.Int("Column", 0)
+			if err != nil {
+				return err
+			}
+			if c.Has("Column") && columns < 1 {
+				return c.Errorf("Cannot validate argument on parameter 'Column'. The %d argument is less than the minimum allowed range of 1. Supply an argument that is greater than or equal to 1 and then try the command again.", columns)
+			}
+			if c.Has("Property") && len(asList(c.Get("Property"))) > 1 {
+				return c.Errorf("Cannot convert 'System.Object[]' to the type 'System.Object' required by parameter 'Property'. Specified method is not supported.")
+			}
+			out, err := formatInput(c, "wide")
+			if err != nil {
+				return err
+			}
+			return emitBlocks(c, out, func(b *formatBlock) {
+				b.autoSize = c.Switch("AutoSize")
+				b.wideColumns = columns
+			})
+		},
+	}
+}
+
+func outStringCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Out-String",
+		Params: []*Parameter{
+			{Name: "Width"},
+			{Name: "Stream", Switch: true},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			width, err := c.Int("Width", c.Runspace.consoleWidth())
+			if err != nil {
+				return err
+			}
+			inputs := bufferedInput(c)
+			if len(inputs) == 0 {
+				return nil
+			}
+			lines := formatLines(inputs, width)
+			if c.Switch("Stream") {
+				return c.EmitAll(stringsToValues(lines))
+			}
+			return c.Emit(strings.Join(lines, "\n") + "\n")
+		},
+	}
+}
+
+func outHostCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Out-Host",
+		Params: []*Parameter{
+			{Name: "Paging", Switch: true},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			if text := formatText(bufferedInput(c), c.Runspace.consoleWidth()); text != "" {
+				c.WriteHost(HostOutput{Text: text})
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,1200 @@
+package psim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pathInfo creates the PathInfo object Get-Location returns
+func pathInfo(path string) *PSObject {
+	obj := NewObject("System.Management.Automation.PathInfo").
+		Add("Drive", path[:1]).
+		Add("Provider", `Microsoft.PowerShell.Core\FileSystem`).
+		Add("ProviderPath", path).
+		Add("Path", path)
+	obj.ToStringFunc = func(*PSObject) string { return path }
+	return obj
+}
+
+// itemObject wraps a file system node in a FileInfo or DirectoryInfo object
+func (rs *Runspace) itemObject(n *fsNode) *PSObject {
+	full := n.path()
+	parent := ""
+	if n.parent != nil {
+		parent = n.parent.path()
+	}
+	var obj *PSObject
+	if n.dir {
+		parentName := interface{}(nil)
+		if n.parent != nil {
+			parentName = n.parent.name
+		}
+		obj = NewObject("System.IO.DirectoryInfo", "System.IO.FileSystemInfo", "System.MarshalByRefObject").
+			Add("Mode", "d----").
+			Add("LastWriteTime", n.modified).
+			Add("Name", leafName(full)).
+			Add("FullName", full).
+			Add("Parent", parentName).
+			Add("Root", full[:3]).
+			Add("BaseName", leafName(full)).
+			Add("Extension", "").
+			Add("CreationTime", n.created).
+			Add("Attributes", "Directory").
+			Add("Exists", true).
+			Add("PSIsContainer", true)
+	} else {
+		ext := ""
+		if i := strings.LastIndex(n.name, "."); i > 0 {
+			ext = n.name[i:]
+		}
+		obj = NewObject("System.IO.FileInfo", "System.IO.FileSystemInfo", "System.MarshalByRefObject").
+			Add("Mode", "-a---").
+			Add("LastWriteTime", n.modified).
+			Add("Length", len(n.content)).
+			Add("Name", n.name).
+			Add("FullName", full).
+			Add("BaseName", strings.TrimSuffix(n.name, ext)).
+			Add("Extension", ext).
+			Add("DirectoryName", parent).
+			Add("CreationTime", n.created).
+			Add("Attributes", "Archive").
+			Add("IsReadOnly", false).
+			Add("Exists", true).
+			Add("PSIsContainer", false)
+	}
+	obj.Add("PSPath", `Microsoft.PowerShell.Core\FileSystem::`+full).
+		Add("PSParentPath", `Microsoft.PowerShell.Core\FileSystem::`+parent).
+		Add("PSChildName", leafName(full))
+	obj.ToStringFunc = func(*PSObject) string { return full }
+	obj.AddMethod("Delete", func(args []interface{}) (interface{}, error) {
+		if n.parent == nil || rs.fs.lookup(full) != n {
+			return nil, fmt.Errorf("Exception calling \"Delete\" with \"0\" argument(s): \"Could not find file '%s'.\"", full)
+		}
+		if n.dir && len(n.children) > 0 {
+			return nil, fmt.Errorf("Exception calling \"Delete\" with \"0\" argument(s): \"The directory is not empty. : '%s'\"", full)
+		}
+		n.parent.removeChild(n)
+		return nil, nil
+	})
+	return obj
+}
+
+// envPath recognizes paths on the Env: drive, returning the variable name (possibly empty)
+func envPath(p string) (string, bool) {
+	if len(p) >= 4 && strings.EqualFold(p[:4], "env:") {
+		return strings.TrimLeft(p[4:], `\/`), true
+	}
+	return "", false
+}
+
+// envEntries returns the environment variables matching a pattern as Name/Value entries
+func (rs *Runspace) envEntries(pattern string) []interface{} {
+	if pattern == "" {
+		pattern = "*"
+	}
+	keys := rs.env.Keys()
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.ToLower(toString(keys[i])) < strings.ToLower(toString(keys[j]))
+	})
+	var out []interface{}
+	for _, k := range keys {
+		if MatchWildcard(pattern, toString(k), false) {
+			v, _ := rs.env.Get(k)
+			out = append(out, NewDictionaryEntry(k, v))
+		}
+	}
+	return out
+}
+
+// pathArguments returns the paths a cmdlet operates on: piped items, -LiteralPath or -Path
+func pathArguments(c *Call, name string) []string {
+	if c.HasInput {
+		if obj, ok := c.Input.(*PSObject); ok {
+			for _, prop := range []string{"FullName", "Path"} {
+				if v, ok := obj.Get(prop); ok {
+					return []string{toString(v)}
+				}
+			}
+		}
+		return []string{toString(c.Input)}
+	}
+	if c.Has("LiteralPath") {
+		return c.Strings("LiteralPath")
+	}
+	return c.Strings(name)
+}
+
+// notFound is the error PowerShell reports for a missing item
+func notFound(c *Call, path string) error {
+	return c.Errorf("Cannot find path '%s' because it does not exist.", path)
+}
+
+// expandPath resolves a path that may contain wildcards to the matching nodes
+func (rs *Runspace) expandPath(c *Call, pattern string, literal bool) ([]*fsNode, string, error) {
+	full, err := rs.resolvePath(pattern)
+	if err != nil {
+		return nil, "", c.Errorf("%s", err.Error())
+	}
+	if literal || !HasWildcard(full) {
+		n := rs.fs.lookup(full)
+		if n == nil {
+			return nil, full, notFound(c, full)
+		}
+		return []*fsNode{n}, full, nil
+	}
+	drive, parts := splitPath(full)
+	nodes := []*fsNode{rs.fs.drives[drive]}
+	if nodes[0] == nil {
+		return nil, full, c.Errorf("Cannot find drive. A drive with the name '%s' does not exist.", drive)
+	}
+	for _, part := range parts {
+		var next []*fsNode
+		for _, n := range nodes {
+			if !n.dir {
+				continue
+			}
+			if !HasWildcard(part) {
+				if child := n.child(part); child != nil {
+					next = append(next, child)
+				}
+				continue
+			}
+			for _, child := range n.children {
+				if MatchWildcard(part, child.name, false) {
+					next = append(next, child)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes, full, nil
+}
+
+// childrenInOrder returns a directory's children the way the provider lists them: directories first
+func childrenInOrder(n *fsNode) []*fsNode {
+	var dirs, files []*fsNode
+	for _, c := range n.children {
+		if c.dir {
+			dirs = append(dirs, c)
+		} else {
+			files = append(files, c)
+		}
+	}
+	return append(dirs, files...)
+}
+
+// isWithin reports whether path is inside (or equal to) dir
+func isWithin(path, dir string) bool {
+	path, dir = strings.ToLower(path), strings.ToLower(strings.TrimRight(dir, `\`))
+	return path == dir || strings.HasPrefix(path, dir+`\`)
+}
+
+func getChildItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-ChildItem",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Sets: []string{"Items"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralItems"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Filter", Position: 2},
+			{Name: "Include"},
+			{Name: "Exclude"},
+			{Name: "Recurse", Aliases: []string{"s"}, Switch: true},
+			{Name: "Depth"},
+			{Name: "File", Switch: true},
+			{Name: "Directory", Aliases: []string{"ad"}, Switch: true},
+			{Name: "Name", Switch: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			paths := pathArguments(c, "Path")
+			if len(paths) == 0 {
+				paths = []string{rs.location}
+			}
+			depth, err := c.Int("Depth", -1)
+			if err != nil {
+				return err
+			}
+			recurse := c.Switch("Recurse") || depth >= 0
+			matches := func(n *fsNode) bool {
+				if c.Switch("File") && n.dir || c.Switch("Directory") && !n.dir {
+					return false
+				}
+				if c.Has("Filter") && !MatchWildcard(c.String("Filter"), n.name, false) {
+					return false
+				}
+				if include := c.Strings("Include"); len(include) > 0 {
+					found := false
+					for _, p := range include {
+						found = found || MatchWildcard(p, n.name, false)
+					}
+					if !found {
+						return false
+					}
+				}
+				for _, p := range c.Strings("Exclude") {
+					if MatchWildcard(p, n.name, false) {
+						return false
+					}
+				}
+				return true
+			}
+			for _, p := range paths {
+				if name, ok := envPath(p); ok {
+					if err := c.EmitAll(rs.envEntries(name)); err != nil {
+						return err
+					}
+					continue
+				}
+				nodes, full, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				emit := func(n *fsNode, base string) error {
+					if c.Switch("Name") {
+						return c.Emit(strings.TrimPrefix(n.path()[len(base):], `\`))
+					}
+					return c.Emit(rs.itemObject(n))
+				}
+				var walk func(dir *fsNode, base string, level int) error
+				walk = func(dir *fsNode, base string, level int) error {
+					children := childrenInOrder(dir)
+					for _, child := range children {
+						if matches(child) {
+							if err := emit(child, base); err != nil {
+								return err
+							}
+						}
+					}
+					if !recurse || depth >= 0 && level >= depth {
+						return nil
+					}
+					for _, child := range children {
+						if child.dir {
+							if err := walk(child, base, level+1); err != nil {
+								return err
+							}
+						}
+					}
+					return nil
+				}
+				listContents := len(nodes) == 1 && nodes[0].dir && !HasWildcard(leafName(full))
+				for _, n := range nodes {
+					if listContents {
+						if err := walk(n, strings.TrimRight(n.path(), `\`), 0); err != nil {
+							return err
+						}
+						continue
+					}
+					if matches(n) {
+						if err := emit(n, strings.TrimRight(parentPath(n.path()), `\`)); err != nil {
+							return err
+						}
+					}
+					if recurse && n.dir {
+						if err := walk(n, strings.TrimRight(parentPath(n.path()), `\`), 0); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func getItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Item",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			for _, p := range pathArguments(c, "Path") {
+				if name, ok := envPath(p); ok {
+					entries := rs.envEntries(name)
+					if len(entries) == 0 && !HasWildcard(name) {
+						c.WriteError(c.Errorf("Cannot find path '%s' because it does not exist.", name))
+					}
+					if err := c.EmitAll(entries); err != nil {
+						return err
+					}
+					continue
+				}
+				nodes, _, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				for _, n := range nodes {
+					if err := c.Emit(rs.itemObject(n)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func getLocationCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Location",
+		Process: func(c *Call) error {
+			return c.Emit(pathInfo(c.Runspace.location))
+		},
+	}
+}
+
+// changeLocation resolves a Set-Location or Push-Location target and moves there
+func changeLocation(c *Call, target string, literal bool) error {
+	rs := c.Runspace
+	nodes, full, err := rs.expandPath(c, target, literal)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return notFound(c, full)
+	}
+	if len(nodes) > 1 {
+		return c.Errorf("Cannot set the location because path '%s' resolved to multiple containers. You can only the set the same location to a single container at a time.", full)
+	}
+	if !nodes[0].dir {
+		return c.Errorf("Cannot set the location because path '%s' does not refer to a container.", nodes[0].path())
+	}
+	rs.setLocation(nodes[0].path())
+	return nil
+}
+
+func setLocationCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Set-Location",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			target := "~"
+			if paths := pathArguments(c, "Path"); len(paths) > 0 {
+				target = paths[0]
+			}
+			if err := changeLocation(c, target, c.Has("LiteralPath")); err != nil {
+				return err
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(pathInfo(c.Runspace.location))
+			}
+			return nil
+		},
+	}
+}
+
+func pushLocationCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Push-Location",
+		Params: []*Parameter{{Name: "Path", Position: 1, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true}, {Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true}},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			current := rs.location
+			if paths := pathArguments(c, "Path"); len(paths) > 0 {
+				if err := changeLocation(c, paths[0], c.Has("LiteralPath")); err != nil {
+					return err
+				}
+			}
+			rs.locations = append(rs.locations, current)
+			return nil
+		},
+	}
+}
+
+func popLocationCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Pop-Location",
+		Params: []*Parameter{{Name: "PassThru", Switch: true}},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			if len(rs.locations) == 0 {
+				return nil
+			}
+			last := rs.locations[len(rs.locations)-1]
+			rs.locations = rs.locations[:len(rs.locations)-1]
+			if rs.fs.IsDir(last) {
+				rs.setLocation(last)
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(pathInfo(rs.location))
+			}
+			return nil
+		},
+	}
+}
+
+// newItem creates a file or directory at a full path
+func newItem(c *Call, full string, dir bool, value string) (*fsNode, error) {
+	fs := c.Runspace.fs
+	force := c.Switch("Force")
+	if existing := fs.lookup(full); existing != nil {
+		switch {
+		case existing.dir != dir:
+			return nil, c.Errorf("An item with the specified name %s already exists.", full)
+		case !force && dir:
+			return nil, c.Errorf("An item with the specified name %s already exists.", full)
+		case !force:
+			return nil, c.Errorf("The file '%s' already exists.", full)
+		}
+	}
+	parent := parentPath(full)
+	if !dir && !force && !fs.IsDir(parent) {
+		return nil, c.Errorf("Could not find a part of the path '%s'.", full)
+	}
+	if dir {
+		return fs.mkdirAll(full, fs.clock()), nil
+	}
+	return fs.writeFile(full, value, fs.clock())
+}
+
+func newItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "New-Item",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, ValueFromPipelineByPropertyName: true},
+			{Name: "Name", ValueFromPipelineByPropertyName: true},
+			{Name: "ItemType", Aliases: []string{"Type"}},
+			{Name: "Value", ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			dir := false
+			switch strings.ToLower(c.String("ItemType")) {
+			case "", "file":
+			case "directory":
+				dir = true
+			default:
+				return c.Errorf("The type is not a known type for the file system. Only \"file\",\"directory\",\"junction\",\"symboliclink\" or \"hardlink\" can be specified.")
+			}
+			paths := c.Strings("Path")
+			if len(paths) == 0 {
+				if !c.Has("Name") {
+					return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Path.")
+				}
+				paths = []string{rs.location}
+			}
+			for _, p := range paths {
+				if c.Has("Name") {
+					p = strings.TrimRight(p, `\/`) + `\` + c.String("Name")
+				}
+				full, err := rs.resolvePath(p)
+				if err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+					continue
+				}
+				operation := "Create File"
+				if dir {
+					operation = "Create Directory"
+				}
+				if !c.ShouldProcess("Destination: "+full, operation) {
+					continue
+				}
+				n, err := newItem(c, full, dir, c.String("Value"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				if err := c.Emit(rs.itemObject(n)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func mkdirCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "mkdir",
+		Params: []*Parameter{{Name: "Path", Position: 1, Remaining: true, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true}, {Name: "Force", Switch: true}},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			for _, p := range c.Strings("Path") {
+				full, err := rs.resolvePath(p)
+				if err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+					continue
+				}
+				if !c.ShouldProcess("Destination: "+full, "Create Directory") {
+					continue
+				}
+				n, err := newItem(c, full, true, "")
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				if err := c.Emit(rs.itemObject(n)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func removeItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Remove-Item",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Recurse", Aliases: []string{"r"}, Switch: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			for _, p := range pathArguments(c, "Path") {
+				if name, ok := envPath(p); ok {
+					for _, e := range rs.envEntries(name) {
+						key, _ := e.(*PSObject).Get("Name")
+						rs.env.Remove(key)
+					}
+					continue
+				}
+				nodes, _, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				for _, n := range nodes {
+					full := n.path()
+					switch {
+					case n.parent == nil || isWithin(rs.location, full):
+						c.WriteError(c.Errorf("Cannot remove the item at '%s' because it is in use.", full))
+						continue
+					case n.dir && len(n.children) > 0 && !c.Switch("Recurse"):
+						c.WriteError(c.Errorf("The item at %s has children and the Recurse parameter was not specified. Nothing was removed.", full))
+						continue
+					}
+					operation := "Remove File"
+					if n.dir {
+						operation = "Remove Directory"
+					}
+					if !c.ShouldProcess(full, operation) {
+						continue
+					}
+					n.parent.removeChild(n)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// copyNode copies a file or directory tree to a full destination path
+func (fs *FileSystem) copyNode(src *fsNode, dest string, recurse bool) *fsNode {
+	now := fs.clock()
+	if !src.dir {
+		n, _ := fs.writeFile(dest, src.content, now)
+		return n
+	}
+	n := fs.mkdirAll(dest, now)
+	if recurse {
+		for _, child := range src.children {
+			fs.copyNode(child, dest+`\`+child.name, true)
+		}
+	}
+	return n
+}
+
+// transferTarget works out where Copy-Item or Move-Item puts src: inside dest when it is a directory
+func transferTarget(c *Call, src *fsNode, dest string) (string, error) {
+	fs := c.Runspace.fs
+	target := dest
+	if fs.IsDir(dest) {
+		target = strings.TrimRight(dest, `\`) + `\` + src.name
+	}
+	if src.dir && isWithin(target, src.path()) {
+		return "", c.Errorf("Cannot copy item %s onto itself.", src.path())
+	}
+	if !fs.IsDir(parentPath(target)) {
+		return "", c.Errorf("Could not find a part of the path '%s'.", target)
+	}
+	return target, nil
+}
+
+func copyItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Copy-Item",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Destination", Position: 2, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Recurse", Switch: true},
+			{Name: "Force", Switch: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			dest := rs.location
+			if c.Has("Destination") {
+				d, err := rs.resolvePath(c.String("Destination"))
+				if err != nil {
+					return c.Errorf("%s", err.Error())
+				}
+				dest = d
+			}
+			for _, p := range pathArguments(c, "Path") {
+				nodes, _, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				for _, n := range nodes {
+					target, err := transferTarget(c, n, dest)
+					if err != nil {
+						c.WriteError(err)
+						continue
+					}
+					operation := "Copy File"
+					if n.dir {
+						operation = "Copy Directory"
+					}
+					if !c.ShouldProcess(fmt.Sprintf("Item: %s Destination: %s", n.path(), target), operation) {
+						continue
+					}
+					if existing := rs.fs.lookup(target); existing != nil && existing.dir != n.dir {
+						c.WriteError(c.Errorf("An item with the specified name %s already exists.", target))
+						continue
+					}
+					copied := rs.fs.copyNode(n, target, c.Switch("Recurse"))
+					if c.Switch("PassThru") {
+						if err := c.Emit(rs.itemObject(copied)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func moveItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Move-Item",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Destination", Position: 2, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Force", Switch: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			dest := rs.location
+			if c.Has("Destination") {
+				d, err := rs.resolvePath(c.String("Destination"))
+				if err != nil {
+					return c.Errorf("%s", err.Error())
+				}
+				dest = d
+			}
+			for _, p := range pathArguments(c, "Path") {
+				nodes, _, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				for _, n := range nodes {
+					if n.parent == nil || isWithin(rs.location, n.path()) {
+						c.WriteError(c.Errorf("Cannot move the item at '%s' because it is in use.", n.path()))
+						continue
+					}
+					target, err := transferTarget(c, n, dest)
+					if err != nil {
+						c.WriteError(err)
+						continue
+					}
+					if !c.ShouldProcess(fmt.Sprintf("Item: %s Destination: %s", n.path(), target), "Move Item") {
+						continue
+					}
+					if existing := rs.fs.lookup(target); existing != nil && existing != n {
+						if !c.Switch("Force") || existing.dir {
+							c.WriteError(c.Errorf("Cannot create a file when that file already exists."))
+							continue
+						}
+						existing.parent.removeChild(existing)
+					}
+					n.parent.removeChild(n)
+					n.name = leafName(target)
+					rs.fs.lookup(parentPath(target)).addChild(n)
+					if c.Switch("PassThru") {
+						if err := c.Emit(rs.itemObject(n)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func renameItemCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Rename-Item",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"ByPath"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "NewName", Position: 2, Mandatory: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"ByLiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Force", Switch: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			newName := c.String("NewName")
+			if strings.ContainsAny(newName, `\/`) {
+				return c.Errorf("Cannot rename the specified target, because it represents a path or device name.")
+			}
+			for _, p := range pathArguments(c, "Path") {
+				nodes, _, err := rs.expandPath(c, p, true)
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				n := nodes[0]
+				if n.parent == nil {
+					c.WriteError(c.Errorf("Cannot rename the item at '%s' because it is in use.", n.path()))
+					continue
+				}
+				if existing := n.parent.child(newName); existing != nil && existing != n {
+					c.WriteError(c.Errorf("Cannot rename because item at '%s' already exists.", existing.path()))
+					continue
+				}
+				if !c.ShouldProcess(fmt.Sprintf("Item: %s Destination: %s", n.path(), parentPath(n.path())+`\`+newName), "Rename Item") {
+					continue
+				}
+				wasLocation := isWithin(rs.location, n.path())
+				old := n.path()
+				parent := n.parent
+				parent.removeChild(n)
+				n.name = newName
+				parent.addChild(n)
+				if wasLocation {
+					rs.setLocation(n.path() + rs.location[len(old):])
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(rs.itemObject(n)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// splitLines splits file content into lines, ignoring a trailing newline
+func splitLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+func getContentCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Content",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "TotalCount", Aliases: []string{"First", "Head"}},
+			{Name: "Tail", Aliases: []string{"Last"}},
+			{Name: "Raw", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			total, err := c.Int("TotalCount", -1)
+			if err != nil {
+				return err
+			}
+			tail, err := c.Int("Tail", -1)
+			if err != nil {
+				return err
+			}
+			for _, p := range pathArguments(c, "Path") {
+				if name, ok := envPath(p); ok {
+					v, found := rs.env.Get(name)
+					if !found {
+						c.WriteError(c.Errorf("Cannot find path '%s' because it does not exist.", name))
+						continue
+					}
+					if err := c.Emit(v); err != nil {
+						return err
+					}
+					continue
+				}
+				nodes, _, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				for _, n := range nodes {
+					content, err := rs.fs.ReadFile(n.path())
+					if err != nil {
+						c.WriteError(c.Errorf("%s", err.Error()))
+						continue
+					}
+					if c.Switch("Raw") {
+						if err := c.Emit(content); err != nil {
+							return err
+						}
+						continue
+					}
+					lines := splitLines(content)
+					if total >= 0 && total < len(lines) {
+						lines = lines[:total]
+					}
+					if tail >= 0 && tail < len(lines) {
+						lines = lines[len(lines)-tail:]
+					}
+					for _, line := range lines {
+						if err := c.Emit(line); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// writeContentCmdlet implements Set-Content and Add-Content
+func writeContentCmdlet(name string, appendContent bool) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Value", Position: 2, Mandatory: true, AllowEmpty: true, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "NoNewline", Switch: true},
+			{Name: "Force", Switch: true},
+			{Name: "PassThru", Switch: true},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			values := asList(c.Get("Value"))
+			values = append(values, c.Inputs...)
+			var b strings.Builder
+			for _, v := range values {
+				b.WriteString(toString(v))
+				if !c.Switch("NoNewline") {
+					b.WriteString("\n")
+				}
+			}
+			paths := c.Strings("Path")
+			if c.Has("LiteralPath") {
+				paths = c.Strings("LiteralPath")
+			}
+			for _, p := range paths {
+				if envName, ok := envPath(p); ok {
+					rs.env.Set(envName, strings.TrimSuffix(b.String(), "\n"))
+					continue
+				}
+				full, err := rs.resolvePath(p)
+				if err != nil {
+					c.WriteError(c.Errorf("%s", err.Error()))
+					continue
+				}
+				targets := []string{full}
+				if HasWildcard(full) && !c.Has("LiteralPath") {
+					nodes, _, _ := rs.expandPath(c, full, false)
+					targets = targets[:0]
+					for _, n := range nodes {
+						targets = append(targets, n.path())
+					}
+				}
+				for _, target := range targets {
+					if !rs.fs.IsDir(parentPath(target)) {
+						c.WriteError(c.Errorf("Could not find a part of the path '%s'.", target))
+						continue
+					}
+					operation := "Set Content"
+					if appendContent {
+						operation = "Add Content"
+					}
+					if !c.ShouldProcess("Path: "+target, operation) {
+						continue
+					}
+					content := b.String()
+					if appendContent {
+						existing, _ := rs.fs.ReadFile(target)
+						content = existing + content
+					}
+					if _, err := rs.fs.writeFile(target, content, rs.fs.clock()); err != nil {
+						c.WriteError(c.Errorf("%s", err.Error()))
+						continue
+					}
+					if c.Switch("PassThru") {
+						if err := c.EmitAll(values); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func outFileCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Out-File",
+		Params: []*Parameter{
+			{Name: "FilePath", Aliases: []string{"Path"}, Position: 1, Mandatory: true},
+			{Name: "Append", Switch: true},
+			{Name: "NoNewline", Switch: true},
+			{Name: "Encoding", Position: 2},
+			{Name: "Force", Switch: true},
+			{Name: "Width"},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			width, err := c.Int("Width", rs.consoleWidth())
+			if err != nil {
+				return err
+			}
+			full, err := rs.resolvePath(c.String("FilePath"))
+			if err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			if !rs.fs.IsDir(parentPath(full)) {
+				return c.Errorf("Could not find a part of the path '%s'.", full)
+			}
+			text := formatText(bufferedInput(c), width)
+			if text != "" && !c.Switch("NoNewline") {
+				text += "\n"
+			}
+			if c.Switch("Append") {
+				existing, _ := rs.fs.ReadFile(full)
+				text = existing + text
+			}
+			if _, err := rs.fs.writeFile(full, text, rs.fs.clock()); err != nil {
+				return c.Errorf("%s", err.Error())
+			}
+			return nil
+		},
+	}
+}
+
+func testPathCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Test-Path",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "PathType", Aliases: []string{"Type"}},
+			{Name: "IsValid", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			pathType := strings.ToLower(c.String("PathType"))
+			for _, p := range pathArguments(c, "Path") {
+				if name, ok := envPath(p); ok {
+					if err := c.Emit(name == "" || len(rs.envEntries(name)) > 0); err != nil {
+						return err
+					}
+					continue
+				}
+				full, err := rs.resolvePath(p)
+				if c.Switch("IsValid") {
+					if err := c.Emit(err == nil); err != nil {
+						return err
+					}
+					continue
+				}
+				found := false
+				if err == nil {
+					nodes, _, _ := rs.expandPath(c, full, c.Has("LiteralPath"))
+					for _, n := range nodes {
+						switch pathType {
+						case "container":
+							found = found || n.dir
+						case "leaf":
+							found = found || !n.dir
+						default:
+							found = true
+						}
+					}
+				}
+				if err := c.Emit(found); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func resolvePathCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Resolve-Path",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, Sets: []string{"Path"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "LiteralPath", Aliases: []string{"PSPath", "LP"}, Mandatory: true, Sets: []string{"LiteralPath"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Relative", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			for _, p := range pathArguments(c, "Path") {
+				nodes, _, err := rs.expandPath(c, p, c.Has("LiteralPath"))
+				if err != nil {
+					c.WriteError(err)
+					continue
+				}
+				for _, n := range nodes {
+					var out interface{} = pathInfo(n.path())
+					if c.Switch("Relative") {
+						out = relativePath(rs.location, n.path())
+					}
+					if err := c.Emit(out); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// relativePath expresses path relative to base the way Resolve-Path -Relative does
+func relativePath(base, path string) string {
+	b := strings.Split(strings.TrimRight(base, `\`), `\`)
+	p := strings.Split(strings.TrimRight(path, `\`), `\`)
+	if !strings.EqualFold(b[0], p[0]) {
+		return path
+	}
+	i := 0
+	for i < len(b) && i < len(p) && strings.EqualFold(b[i], p[i]) {
+		i++
+	}
+	var parts []string
+	for j := i; j < len(b); j++ {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, p[i:]...)
+	if len(parts) == 0 || parts[0] != ".." {
+		parts = append([]string{"."}, parts...)
+	}
+	return strings.Join(parts, `\`)
+}
+
+func joinPathCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Join-Path",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "ChildPath", Position: 2, Mandatory: true, ValueFromPipelineByPropertyName: true},
+			{Name: "AdditionalChildPath", Position: 3, Remaining: true},
+			{Name: "Resolve", Switch: true},
+		},
+		Process: func(c *Call) error {
+			children := append([]string{c.String("ChildPath")}, c.Strings("AdditionalChildPath")...)
+			for _, p := range c.Strings("Path") {
+				joined := p
+				for _, child := range children {
+					joined = strings.TrimRight(joined, `\/`) + `\` + strings.TrimLeft(strings.ReplaceAll(child, "/", `\`), `\`)
+				}
+				if c.Switch("Resolve") {
+					full, err := c.Runspace.resolvePath(joined)
+					if err != nil || !c.Runspace.fs.Exists(full) {
+						c.WriteError(notFound(c, joined))
+						continue
+					}
+					joined = full
+				}
+				if err := c.Emit(joined); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func splitPathCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Split-Path",
+		Params: []*Parameter{
+			{Name: "Path", Position: 1, Mandatory: true, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Parent", Switch: true},
+			{Name: "Leaf", Switch: true},
+			{Name: "LeafBase", Switch: true},
+			{Name: "Extension", Switch: true},
+			{Name: "Qualifier", Switch: true},
+			{Name: "NoQualifier", Switch: true},
+			{Name: "IsAbsolute", Switch: true},
+		},
+		Process: func(c *Call) error {
+			paths := c.Strings("Path")
+			if c.HasInput {
+				paths = []string{toString(c.Input)}
+			}
+			for _, p := range paths {
+				p = strings.ReplaceAll(p, "/", `\`)
+				leaf := leafName(p)
+				ext := ""
+				if i := strings.LastIndex(leaf, "."); i > 0 {
+					ext = leaf[i:]
+				}
+				hasQualifier := len(p) >= 2 && p[1] == ':'
+				var out interface{}
+				switch {
+				case c.Switch("Leaf"):
+					out = leaf
+				case c.Switch("LeafBase"):
+					out = strings.TrimSuffix(leaf, ext)
+				case c.Switch("Extension"):
+					out = ext
+				case c.Switch("Qualifier"):
+					if !hasQualifier {
+						c.WriteError(c.Errorf("Cannot parse path because path '%s' does not have a qualifier specified.", p))
+						continue
+					}
+					out = p[:2]
+				case c.Switch("NoQualifier"):
+					if hasQualifier {
+						out = p[2:]
+					} else {
+						out = p
+					}
+				case c.Switch("IsAbsolute"):
+					out = isAbsolutePath(p) || strings.HasPrefix(p, `\\`)
+				default:
+					trimmed := strings.TrimRight(p, `\`)
+					i := strings.LastIndex(trimmed, `\`)
+					switch {
+					case i < 0:
+						out = ""
+					case i == 2 && hasQualifier:
+						out = trimmed[:3]
+					default:
+						out = trimmed[:i]
+					}
+				}
+				if err := c.Emit(out); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,598 @@
+package psim
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/couragetogroww/powerhell/pkg/graph"
+)
+
+// The Microsoft Graph PowerShell SDK cmdlets. Each one sends real HTTP
+// requests to the runspace's loopback Graph service, so paging, $filter and
+// error responses behave as they do against a tenant.
+
+// mgClientID is the app id of "Microsoft Graph Command Line Tools"
+const mgClientID = "14d82eec-204b-4c2f-b7e8-296a70dab67e"
+
+const mgModels = "Microsoft.Graph.PowerShell.Models."
+
+// mgTypes maps resource kinds to the SDK model types
+var mgTypes = map[string]string{
+	graph.KindUser:  mgModels + "MicrosoftGraphUser",
+	graph.KindGroup: mgModels + "MicrosoftGraphGroup",
+}
+
+// mgRequest sends a request on behalf of an Mg cmdlet and decodes the JSON
+// reply. path is relative to the v1.0 endpoint unless it is a full URL, as
+// @odata.nextLink values are.
+func mgRequest(c *Call, method, path string, body interface{}) (interface{}, error) {
+	if c.Runspace.mgContext == nil {
+		return nil, c.Errorf("Authentication needed. Please call Connect-MgGraph.")
+	}
+	uri := path
+	if !strings.HasPrefix(path, "https://") {
+		uri = graph.PublicURL + "/v1.0/" + strings.TrimPrefix(path, "/")
+	}
+	var data []byte
+	contentType := ""
+	if body != nil {
+		data, contentType = []byte(encodeJSON(body, 10)), "application/json"
+	}
+	resp, err := c.Runspace.sendWebRequest(method, uri, nil, data, contentType)
+	if err != nil {
+		return nil, c.Errorf("%s", err.Error())
+	}
+	var v interface{}
+	if len(bytes.TrimSpace(resp.body)) > 0 {
+		if v, err = decodeJSON(string(resp.body)); err != nil {
+			return nil, c.Errorf("%s", err.Error())
+		}
+	}
+	if resp.status >= 400 {
+		code, message := "", http.StatusText(resp.status)
+		if obj, ok := v.(*PSObject); ok {
+			if e, ok := obj.Get("error"); ok {
+				if eo, ok := e.(*PSObject); ok {
+					ec, _ := eo.Get("code")
+					em, _ := eo.Get("message")
+					code, message = toString(ec), toString(em)
+				}
+			}
+		}
+		return nil, c.Errorf("%s\n\nStatus: %d (%s)\nErrorCode: %s", message, resp.status, strings.ReplaceAll(http.StatusText(resp.status), " ", ""), code)
+	}
+	return v, nil
+}
+
+// mgList reads a collection, following @odata.nextLink until top objects
+// have been read or, with all, until the last page
+func mgList(c *Call, path string, query url.Values, top int, all bool) ([]interface{}, error) {
+	if top > 0 {
+		query.Set("$top", strconv.Itoa(min(top, graph.MaxPageSize)))
+	}
+	next := path
+	if len(query) > 0 {
+		next += "?" + strings.ReplaceAll(query.Encode(), "%24", "$")
+	}
+	var out []interface{}
+	for next != "" {
+		v, err := mgRequest(c, "GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+		page, _ := v.(*PSObject)
+		if page == nil {
+			break
+		}
+		items, _ := page.Get("value")
+		out = append(out, asList(items)...)
+		if count, ok := page.Get("@odata.count"); ok && c.Has("CountVariable") {
+			c.Runspace.SetVariable(c.String("CountVariable"), count)
+		}
+		if top > 0 && len(out) >= top {
+			return out[:top], nil
+		}
+		link, _ := page.Get("@odata.nextLink")
+		next = ""
+		if all || top > 0 {
+			next = toString(link)
+		}
+	}
+	return out, nil
+}
+
+// mgPascal turns a Graph property name into the SDK's property name
+func mgPascal(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// mgCamel turns an SDK parameter name into a Graph property name
+func mgCamel(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// mgModel converts a JSON resource into an SDK model object. Every schema
+// property is present, null unless the response carried it, and anything
+// else lands in AdditionalProperties.
+func mgModel(kind string, v interface{}) *PSObject {
+	src, _ := v.(*PSObject)
+	if src == nil {
+		src = NewCustomObject()
+	}
+	extra := NewHashtable()
+	values := map[string]interface{}{}
+	for _, p := range src.Properties() {
+		values[p.Name] = p.Current()
+	}
+	var names []string
+	known := map[string]bool{}
+	for _, name := range graph.Properties(kind) {
+		names = append(names, name)
+		known[name] = true
+	}
+	sort.Strings(names)
+	typeName := mgTypes[kind]
+	if kind == "" {
+		typeName, names = mgModels+"MicrosoftGraphDirectoryObject", []string{"id"}
+		known = map[string]bool{"id": true}
+	}
+	o := NewObject(typeName)
+	for _, name := range names {
+		o.Add(mgPascal(name), values[name])
+	}
+	for _, p := range src.Properties() {
+		if !known[p.Name] {
+			extra.Set(p.Name, p.Current())
+		}
+	}
+	if kind == "" {
+		o.Add("DeletedDateTime", nil)
+	}
+	o.Add("AdditionalProperties", extra)
+	return o
+}
+
+// mgID returns the identity parameter, or the Id of a piped object
+func mgID(c *Call, param string) string {
+	if c.Has(param) {
+		return c.String(param)
+	}
+	if c.Has("InputObject") {
+		v := c.Get("InputObject")
+		if o, ok := v.(*PSObject); ok {
+			if id, ok := o.Get("Id"); ok {
+				return toString(id)
+			}
+		}
+		return toString(v)
+	}
+	return ""
+}
+
+// mgQuery builds the OData query options shared by the Get-Mg cmdlets
+func mgQuery(c *Call) url.Values {
+	q := url.Values{}
+	if c.Has("Property") {
+		q.Set("$select", strings.Join(c.Strings("Property"), ","))
+	}
+	if c.Has("Filter") {
+		q.Set("$filter", c.String("Filter"))
+	}
+	if c.Has("Sort") {
+		q.Set("$orderby", strings.Join(c.Strings("Sort"), ","))
+	}
+	if c.Has("CountVariable") {
+		q.Set("$count", "true")
+	}
+	return q
+}
+
+// mgGetCmdlet builds Get-MgUser or Get-MgGroup: one object by id, or a
+// filtered, paged collection
+func mgGetCmdlet(name, kind, idParam, set string) *Cmdlet {
+	return &Cmdlet{
+		Name:       name,
+		DefaultSet: "List",
+		Params: []*Parameter{
+			{Name: idParam, Position: 1, Mandatory: true, Sets: []string{"Get"}},
+			{Name: "InputObject", Mandatory: true, Sets: []string{"GetViaIdentity"}, ValueFromPipeline: true},
+			{Name: "Filter", Sets: []string{"List"}},
+			{Name: "Property", Aliases: []string{"Select"}},
+			{Name: "Top", Sets: []string{"List"}},
+			{Name: "All", Switch: true, Sets: []string{"List"}},
+			{Name: "Sort", Aliases: []string{"OrderBy"}, Sets: []string{"List"}},
+			{Name: "ConsistencyLevel", Sets: []string{"List"}},
+			{Name: "CountVariable", Aliases: []string{"CV"}, Sets: []string{"List"}},
+			{Name: "PageSize", Sets: []string{"List"}},
+		},
+		Process: func(c *Call) error {
+			id := mgID(c, idParam)
+			q := mgQuery(c)
+			if id != "" {
+				path := set + "/" + url.PathEscape(id)
+				if sel := q.Get("$select"); sel != "" {
+					path += "?$select=" + url.QueryEscape(sel)
+				}
+				v, err := mgRequest(c, "GET", path, nil)
+				if err != nil {
+					return err
+				}
+				return c.Emit(mgModel(kind, v))
+			}
+			top, err := c.Int("Top", 0)
+			if err != nil {
+				return err
+			}
+			if size, err := c.Int("PageSize", 0); err != nil {
+				return err
+			} else if size > 0 && top == 0 {
+				q.Set("$top", strconv.Itoa(size))
+			}
+			items, err := mgList(c, set, q, top, c.Switch("All"))
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := c.Emit(mgModel(kind, item)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// mgLinksCmdlet builds Get-MgGroupMember or Get-MgUserMemberOf, which list
+// directoryObjects related to one user or group
+func mgLinksCmdlet(name, idParam, set, nav string) *Cmdlet {
+	return &Cmdlet{
+		Name: name,
+		Params: []*Parameter{
+			{Name: idParam, Position: 1, Mandatory: true},
+			{Name: "Top"},
+			{Name: "All", Switch: true},
+		},
+		Process: func(c *Call) error {
+			id := mgID(c, idParam)
+			top, err := c.Int("Top", 0)
+			if err != nil {
+				return err
+			}
+			items, err := mgList(c, set+"/"+url.PathEscape(id)+"/"+nav, url.Values{}, top, c.Switch("All"))
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := c.Emit(mgModel("", item)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// mgWritable are the properties New- and Update- cmdlets take as parameters,
+// in the expanded parameter sets, and the -BodyParameter of the others
+func mgWritable(kind string, expanded, body []string) []*Parameter {
+	var params []*Parameter
+	for _, name := range graph.Properties(kind) {
+		if name == "id" || name == "createdDateTime" {
+			continue
+		}
+		switch name {
+		case "accountEnabled", "mailEnabled", "securityEnabled":
+			params = append(params, &Parameter{Name: mgPascal(name), Switch: true, Sets: expanded})
+		default:
+			params = append(params, &Parameter{Name: mgPascal(name), Sets: expanded})
+		}
+	}
+	if kind == graph.KindUser {
+		params = append(params, &Parameter{Name: "PasswordProfile", Sets: expanded})
+	}
+	return append(params, &Parameter{Name: "BodyParameter", Mandatory: true, Sets: body, ValueFromPipeline: true})
+}
+
+// mgBody builds a request body from -BodyParameter and the property
+// parameters; hashtable keys are sent camelCased as the SDK does
+func mgBody(c *Call) *Hashtable {
+	body := NewHashtable()
+	if bp, ok := c.Get("BodyParameter").(*Hashtable); ok {
+		for _, k := range bp.Keys() {
+			v, _ := bp.Get(k)
+			body.Set(k, v)
+		}
+	}
+	for _, p := range c.Cmdlet.Params {
+		if p.Name == "BodyParameter" || p.Name == "InputObject" || p.Position > 0 || !c.Has(p.Name) {
+			continue
+		}
+		v := c.Get(p.Name)
+		if p.Switch {
+			v = toBool(v)
+		}
+		if h, ok := v.(*Hashtable); ok {
+			camel := NewHashtable()
+			for _, k := range h.Keys() {
+				item, _ := h.Get(k)
+				camel.Set(mgCamel(toString(k)), item)
+			}
+			v = camel
+		}
+		body.Set(mgCamel(p.Name), v)
+	}
+	return body
+}
+
+func mgNewCmdlet(name, kind, set string) *Cmdlet {
+	return &Cmdlet{
+		Name:       name,
+		DefaultSet: "CreateExpanded",
+		Params:     mgWritable(kind, []string{"CreateExpanded"}, []string{"Create"}),
+		Process: func(c *Call) error {
+			v, err := mgRequest(c, "POST", set, mgBody(c))
+			if err != nil {
+				return err
+			}
+			return c.Emit(mgModel(kind, v))
+		},
+	}
+}
+
+func mgUpdateCmdlet(name, kind, idParam, set string) *Cmdlet {
+	return &Cmdlet{
+		Name:       name,
+		DefaultSet: "UpdateExpanded",
+		Params: append([]*Parameter{
+			{Name: idParam, Position: 1, Mandatory: true, Sets: []string{"UpdateExpanded", "Update"}},
+			{Name: "InputObject", Mandatory: true, Sets: []string{"UpdateViaIdentityExpanded", "UpdateViaIdentity"}, ValueFromPipeline: true},
+		}, mgWritable(kind, []string{"UpdateExpanded", "UpdateViaIdentityExpanded"}, []string{"Update", "UpdateViaIdentity"})...),
+		Process: func(c *Call) error {
+			id := mgID(c, idParam)
+			if !c.ShouldProcess(id, name+"_Update") {
+				return nil
+			}
+			_, err := mgRequest(c, "PATCH", set+"/"+url.PathEscape(id), mgBody(c))
+			return err
+		},
+	}
+}
+
+func mgRemoveCmdlet(name, idParam, set string) *Cmdlet {
+	return &Cmdlet{
+		Name:       name,
+		DefaultSet: "Delete",
+		Params: []*Parameter{
+			{Name: idParam, Position: 1, Mandatory: true, Sets: []string{"Delete"}},
+			{Name: "InputObject", Mandatory: true, Sets: []string{"DeleteViaIdentity"}, ValueFromPipeline: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			id := mgID(c, idParam)
+			if !c.ShouldProcess(id, name+"_Delete") {
+				return nil
+			}
+			if _, err := mgRequest(c, "DELETE", set+"/"+url.PathEscape(id), nil); err != nil {
+				return err
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(true)
+			}
+			return nil
+		},
+	}
+}
+
+func newMgGroupMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "New-MgGroupMember",
+		Params: []*Parameter{{Name: "GroupId", Position: 1, Mandatory: true}, {Name: "DirectoryObjectId", Mandatory: true}},
+		Process: func(c *Call) error {
+			member := mgID(c, "DirectoryObjectId")
+			body := NewHashtable()
+			body.Set("@odata.id", graph.PublicURL+"/v1.0/directoryObjects/"+member)
+			_, err := mgRequest(c, "POST", "groups/"+url.PathEscape(c.String("GroupId"))+"/members/$ref", body)
+			return err
+		},
+	}
+}
+
+func removeMgGroupMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Remove-MgGroupMemberByRef",
+		Params: []*Parameter{{Name: "GroupId", Position: 1, Mandatory: true}, {Name: "DirectoryObjectId", Mandatory: true}},
+		Process: func(c *Call) error {
+			member := mgID(c, "DirectoryObjectId")
+			group := c.String("GroupId")
+			if !c.ShouldProcess(group, "Remove-MgGroupMemberByRef_Delete") {
+				return nil
+			}
+			_, err := mgRequest(c, "DELETE", "groups/"+url.PathEscape(group)+"/members/"+url.PathEscape(member)+"/$ref", nil)
+			return err
+		},
+	}
+}
+
+func connectMgGraphCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Connect-MgGraph",
+		Params: []*Parameter{
+			{Name: "Scopes", Position: 1, Sets: []string{"UserParameterSet"}},
+			{Name: "TenantId"},
+			{Name: "ClientId", Aliases: []string{"AppId", "ApplicationId"}, Mandatory: true, Sets: []string{"AppCertificateParameterSet"}},
+			{Name: "CertificateThumbprint", Sets: []string{"AppCertificateParameterSet"}},
+			{Name: "UseDeviceCode", Aliases: []string{"UseDeviceAuthentication", "DeviceCode"}, Switch: true, Sets: []string{"UserParameterSet"}},
+			{Name: "NoWelcome", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			t := rs.Tenant()
+			scopes := []interface{}{}
+			seen := map[string]bool{}
+			for _, s := range append(c.Strings("Scopes"), "openid", "profile", "User.Read", "email") {
+				if !seen[strings.ToLower(s)] {
+					seen[strings.ToLower(s)] = true
+					scopes = append(scopes, s)
+				}
+			}
+			auth, account := "Delegated", ""
+			clientID := mgClientID
+			if c.Has("ClientId") {
+				clientID = c.String("ClientId")
+			}
+			if c.Has("CertificateThumbprint") {
+				auth, scopes = "AppOnly", []interface{}{}
+			} else if me := t.Me(); me != nil {
+				upn, _ := me.Get("userPrincipalName")
+				account = toString(upn)
+			}
+			ctx := NewObject("Microsoft.Graph.PowerShell.Authentication.AuthContext")
+			ctx.Add("ClientId", clientID)
+			ctx.Add("TenantId", t.ID)
+			ctx.Add("Scopes", scopes)
+			ctx.Add("AuthType", auth)
+			ctx.Add("TokenCredentialType", map[bool]string{true: "ClientCertificate", false: "InteractiveBrowser"}[auth == "AppOnly"])
+			ctx.Add("Account", account)
+			ctx.Add("AppName", "Microsoft Graph Command Line Tools")
+			ctx.Add("ContextScope", "CurrentUser")
+			ctx.Add("Environment", "Global")
+			rs.mgContext = ctx
+			if !c.Switch("NoWelcome") {
+				for _, line := range []string{
+					"Welcome to Microsoft Graph!",
+					"",
+					"Connected via " + strings.ToLower(auth) + " access using " + clientID,
+					"Readme: https://aka.ms/graph/sdk/powershell",
+					"SDK Docs: https://aka.ms/graph/sdk/powershell/docs",
+					"API Docs: https://aka.ms/graph/docs",
+					"",
+					"NOTE: You can use the -NoWelcome parameter to suppress this message.",
+					"",
+				} {
+					c.WriteHost(HostOutput{Text: line})
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func disconnectMgGraphCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Disconnect-MgGraph",
+		Process: func(c *Call) error {
+			if c.Runspace.mgContext == nil {
+				return c.Errorf("No application to sign out from.")
+			}
+			ctx := c.Runspace.mgContext
+			c.Runspace.mgContext = nil
+			return c.Emit(ctx)
+		},
+	}
+}
+
+func getMgContextCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-MgContext",
+		Process: func(c *Call) error {
+			if c.Runspace.mgContext == nil {
+				return nil
+			}
+			return c.Emit(c.Runspace.mgContext)
+		},
+	}
+}
+
+// toHashtables converts decoded JSON objects into hashtables, the default
+// output of Invoke-MgGraphRequest
+func toHashtables(v interface{}) interface{} {
+	switch x := v.(type) {
+	case *PSObject:
+		h := NewHashtable()
+		for _, p := range x.Properties() {
+			h.Set(p.Name, toHashtables(p.Current()))
+		}
+		return h
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, item := range x {
+			out[i] = toHashtables(item)
+		}
+		return out
+	}
+	return v
+}
+
+func invokeMgGraphRequestCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Invoke-MgGraphRequest",
+		Params: []*Parameter{
+			{Name: "Method", Position: 1},
+			{Name: "Uri", Position: 2, Mandatory: true},
+			{Name: "Body"},
+			{Name: "OutputType"},
+			{Name: "Headers"},
+			{Name: "ContentType"},
+		},
+		Process: func(c *Call) error {
+			method := "GET"
+			if c.Has("Method") {
+				method = strings.ToUpper(c.String("Method"))
+			}
+			uri := c.String("Uri")
+			if !strings.HasPrefix(uri, "https://") && !strings.HasPrefix(uri, "http://") {
+				uri = graph.PublicURL + "/" + strings.TrimPrefix(uri, "/")
+			}
+			var body interface{}
+			if c.Has("Body") {
+				body = c.Get("Body")
+				if s, ok := body.(string); ok {
+					parsed, err := decodeJSON(s)
+					if err != nil {
+						return c.Errorf("%s", err.Error())
+					}
+					body = parsed
+				}
+			}
+			v, err := mgRequest(c, method, uri, body)
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(c.String("OutputType")) {
+			case "psobject":
+				return c.Emit(v)
+			case "json":
+				return c.Emit(encodeJSON(v, 100))
+			case "", "hashtable":
+				return c.Emit(toHashtables(v))
+			}
+			return c.Errorf("Cannot bind parameter 'OutputType'. Cannot convert value \"%s\" to type \"Microsoft.Graph.PowerShell.Authentication.Models.OutputType\".", c.String("OutputType"))
+		},
+	}
+}
+
+// graphCmdlets are the Microsoft.Graph module cmdlets
+func graphCmdlets() []*Cmdlet {
+	return []*Cmdlet{
+		connectMgGraphCmdlet(),
+		disconnectMgGraphCmdlet(),
+		getMgContextCmdlet(),
+		invokeMgGraphRequestCmdlet(),
+		mgGetCmdlet("Get-MgUser", graph.KindUser, "UserId", "users"),
+		mgNewCmdlet("New-MgUser", graph.KindUser, "users"),
+		mgUpdateCmdlet("Update-MgUser", graph.KindUser, "UserId", "users"),
+		mgRemoveCmdlet("Remove-MgUser", "UserId", "users"),
+		mgLinksCmdlet("Get-MgUserMemberOf", "UserId", "users", "memberOf"),
+		mgGetCmdlet("Get-MgGroup", graph.KindGroup, "GroupId", "groups"),
+		mgNewCmdlet("New-MgGroup", graph.KindGroup, "groups"),
+		mgUpdateCmdlet("Update-MgGroup", graph.KindGroup, "GroupId", "groups"),
+		mgRemoveCmdlet("Remove-MgGroup", "GroupId", "groups"),
+		mgLinksCmdlet("Get-MgGroupMember", "GroupId", "groups", "members"),
+		newMgGroupMemberCmdlet(),
+		removeMgGroupMemberCmdlet(),
+	}
+}
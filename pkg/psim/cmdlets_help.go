@@ -0,0 +1,291 @@
+package psim
+
+import (
+	"sort"
+	"strings"
+)
+
+// helpObject wraps a topic's rendered text in the object Get-Help writes
+func helpObject(t *HelpTopic, view, text string) *PSObject {
+	types := []string{"MamlCommandHelpInfo"}
+	if view != "" {
+		types = []string{"MamlCommandHelpInfo#" + view, "MamlCommandHelpInfo"}
+	}
+	o := NewObject(types...).
+		Add("Name", t.Name).
+		Add("Category", t.Category).
+		Add("Module", t.Module).
+		Add("Synopsis", t.Synopsis)
+	o.ToStringFunc = func(*PSObject) string { return text }
+	return o
+}
+
+// helpMatches returns the topics of the commands a Get-Help name refers
+// to. A name that isn't a command is searched for as a substring of
+// command names, as PowerShell searches its help files.
+func helpMatches(rs *Runspace, name, category string) []*HelpTopic {
+	if !HasWildcard(name) {
+		if c, ok := rs.resolveCommand(name); ok {
+			if t := helpFor(c); category == "" || strings.EqualFold(t.Category, category) {
+				return []*HelpTopic{t}
+			}
+		}
+		name = "*" + name + "*"
+	}
+	var topics []*HelpTopic
+	for _, c := range rs.visibleCommands() {
+		if !MatchWildcard(name, c.Name, false) {
+			continue
+		}
+		if t := helpFor(c); category == "" || strings.EqualFold(t.Category, category) {
+			topics = append(topics, t)
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return strings.ToLower(topics[i].Name) < strings.ToLower(topics[j].Name)
+	})
+	return topics
+}
+
+func getHelpCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Get-Help",
+		DefaultSet: "AllUsersView",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, ValueFromPipelineByPropertyName: true},
+			{Name: "Parameter", Mandatory: true, Sets: []string{"Parameters"}},
+			{Name: "Examples", Switch: true, Mandatory: true, Sets: []string{"Examples"}},
+			{Name: "Detailed", Switch: true, Mandatory: true, Sets: []string{"DetailedView"}},
+			{Name: "Full", Switch: true, Sets: []string{"AllUsersView"}},
+			{Name: "Category"},
+		},
+		End: func(c *Call) error {
+			level, view := HelpBasic, ""
+			for _, s := range []struct {
+				name  string
+				level HelpLevel
+			}{{"Examples", HelpExamples}, {"Detailed", HelpDetailed}, {"Full", HelpFull}} {
+				if c.Switch(s.name) {
+					level, view = s.level, s.name+"View"
+				}
+			}
+			category := ""
+			if c.Has("Category") {
+				var err error
+				if category, err = adEnum(c, "Category", "System.String", "Alias", "Cmdlet", "Function"); err != nil {
+					return err
+				}
+			}
+			name := c.String("Name")
+			if name == "" {
+				return c.Emit(strings.TrimPrefix(defaultHelpText, "\n"))
+			}
+			topics := helpMatches(c.Runspace, name, category)
+			if len(topics) == 0 {
+				return c.Errorf("Get-Help could not find %s in a help file in this session. To download updated help topics type: \"Update-Help\". To get help online, search for the help topic in the TechNet library at https:/go.microsoft.com/fwlink/?LinkID=107116.", name)
+			}
+			width := c.Runspace.consoleWidth()
+			if len(topics) > 1 {
+				for _, t := range topics {
+					o := NewObject("HelpInfoShort").
+						Add("Name", t.Name).
+						Add("Category", t.Category).
+						Add("Module", t.Module).
+						Add("Synopsis", t.Synopsis)
+					if err := c.Emit(o); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			t := topics[0]
+			if c.Has("Parameter") {
+				pattern := c.String("Parameter")
+				text, ok := t.ParameterText(pattern, width)
+				if !ok {
+					return c.Errorf("No parameter matches criteria %s.", pattern)
+				}
+				return c.Emit(helpObject(t, "parameter", text))
+			}
+			return c.Emit(helpObject(t, view, t.Text(level, width)))
+		},
+	}
+}
+
+// commandInfo is the object Get-Command writes for a command. An alias
+// carries the details of the command it points to.
+func commandInfo(name string, target *Cmdlet) *PSObject {
+	t := helpFor(target)
+	kind, display, definition := t.Category, t.Name, t.Name
+	if !strings.EqualFold(name, target.Name) {
+		kind = "Alias"
+		display = name + " -> " + target.Name
+	} else if target.Function != nil {
+		definition = functionDefinition(target.Function)
+	} else if len(t.Syntax) > 0 {
+		definition = "\n" + strings.Join(t.Syntax, "\n\n") + "\n"
+	}
+	params := NewHashtable()
+	for _, p := range t.Parameters {
+		params.Set(p.Name, NewObject("System.Management.Automation.ParameterMetadata").
+			Add("Name", p.Name).
+			Add("ParameterType", p.Type).
+			Add("Aliases", stringsToValues(p.Aliases)).
+			Add("SwitchParameter", p.Switch))
+	}
+	verb, noun := "", ""
+	if i := strings.Index(t.Name, "-"); i > 0 && kind != "Alias" {
+		verb, noun = t.Name[:i], t.Name[i+1:]
+	}
+	o := NewObject("System.Management.Automation."+kind+"Info", "System.Management.Automation.CommandInfo").
+		Add("CommandType", kind).
+		Add("Name", name).
+		Add("DisplayName", display).
+		Add("Definition", definition).
+		Add("Verb", verb).
+		Add("Noun", noun).
+		Add("Version", t.Version).
+		Add("Source", t.Module).
+		Add("ModuleName", t.Module).
+		Add("Parameters", params)
+	if kind == "Alias" {
+		o.Add("ResolvedCommandName", target.Name)
+	}
+	return o
+}
+
+// functionDefinition is the Definition of a function: the code of its body
+func functionDefinition(f *Function) string {
+	text := strings.TrimSpace(f.Body.Text)
+	if strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}") {
+		text = text[1 : len(text)-1]
+	}
+	return text
+}
+
+// commandOrder sorts Get-Command's output the way PowerShell lists it
+var commandOrder = map[string]int{"Alias": 0, "Function": 1, "Cmdlet": 2}
+
+func getCommandCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Get-Command",
+		DefaultSet: "CmdletSet",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Sets: []string{"AllCommandSet"}, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Verb", Sets: []string{"CmdletSet"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Noun", Sets: []string{"CmdletSet"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Module", ValueFromPipelineByPropertyName: true},
+			{Name: "CommandType", Aliases: []string{"Type"}, Sets: []string{"AllCommandSet"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Syntax", Switch: true},
+			{Name: "TotalCount"},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			kind := ""
+			if c.Has("CommandType") {
+				var err error
+				if kind, err = adEnum(c, "CommandType", "System.Management.Automation.CommandTypes", "Alias", "Function", "Cmdlet", "All"); err != nil {
+					return err
+				}
+				if kind == "All" {
+					kind = ""
+				}
+			}
+			total, err := c.Int("TotalCount", -1)
+			if err != nil {
+				return err
+			}
+			names := c.Strings("Name")
+			byVerbNoun := c.Has("Verb") || c.Has("Noun")
+			matchAny := func(patterns []string, s string) bool {
+				if len(patterns) == 0 {
+					return true
+				}
+				for _, p := range patterns {
+					if MatchWildcard(p, s, false) {
+						return true
+					}
+				}
+				return false
+			}
+			var found []*PSObject
+			consider := func(name string, target *Cmdlet) {
+				if !matchAny(names, name) {
+					return
+				}
+				o := commandInfo(name, target)
+				isAlias := toString(propertyOf(o, "CommandType")) == "Alias"
+				if kind != "" && !strings.EqualFold(toString(propertyOf(o, "CommandType")), kind) {
+					return
+				}
+				if byVerbNoun && (isAlias || !matchAny(c.Strings("Verb"), toString(propertyOf(o, "Verb"))) ||
+					!matchAny(c.Strings("Noun"), toString(propertyOf(o, "Noun")))) {
+					return
+				}
+				if c.Has("Module") && !matchAny(c.Strings("Module"), toString(propertyOf(o, "Source"))) {
+					return
+				}
+				found = append(found, o)
+			}
+			commands := rs.visibleCommands()
+			for _, cmd := range commands {
+				consider(cmd.Name, cmd)
+			}
+			for alias, target := range rs.aliases {
+				if cmd, ok := commands[strings.ToLower(target)]; ok {
+					consider(alias, cmd)
+				}
+			}
+			sort.SliceStable(found, func(i, j int) bool {
+				ki, kj := commandOrder[toString(propertyOf(found[i], "CommandType"))], commandOrder[toString(propertyOf(found[j], "CommandType"))]
+				if ki != kj {
+					return ki < kj
+				}
+				return strings.ToLower(toString(propertyOf(found[i], "Name"))) < strings.ToLower(toString(propertyOf(found[j], "Name")))
+			})
+			if total >= 0 && len(found) > total {
+				found = found[:total]
+			}
+			for _, o := range found {
+				if c.Switch("Syntax") {
+					text := toString(propertyOf(o, "Definition"))
+					if target := propertyOf(o, "ResolvedCommandName"); target != nil {
+						text = toString(target)
+					}
+					if err := c.Emit(text); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := c.Emit(o); err != nil {
+					return err
+				}
+			}
+			for _, name := range names {
+				if HasWildcard(name) {
+					continue
+				}
+				if _, ok := rs.resolveCommand(name); !ok {
+					c.WriteError(c.Errorf("The term '%s' is not recognized as a name of a cmdlet, function, script file, or executable program. Check the spelling of the name, or if a path was included, verify that the path is correct and try again.", name))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func updateHelpCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Update-Help",
+		Params: []*Parameter{
+			{Name: "Module", Position: 1, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Force", Switch: true},
+			{Name: "UICulture"},
+		},
+		End: func(c *Call) error {
+			// The help files ship with the simulator, so they are always current
+			c.WriteVerbose("Help is up to date.")
+			return nil
+		},
+	}
+}
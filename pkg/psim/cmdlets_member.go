@@ -0,0 +1,236 @@
+package psim
+
+import "strings"
+
+// memberTypes are the values of -MemberType; Properties, Methods and All
+// stand for several member types
+var memberTypes = []string{
+	"AliasProperty", "CodeProperty", "Property", "NoteProperty", "ScriptProperty",
+	"Properties", "PropertySet", "Method", "CodeMethod", "ScriptMethod", "Methods",
+	"ParameterizedProperty", "MemberSet", "Event", "Dynamic", "All",
+}
+
+// memberTypeMatches reports whether a member's type is one of the requested ones
+func memberTypeMatches(kind string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		switch {
+		case w == "All", w == kind:
+			return true
+		case w == "Properties" && strings.HasSuffix(kind, "Property"):
+			return true
+		case w == "Methods" && strings.HasSuffix(kind, "Method"):
+			return true
+		}
+	}
+	return false
+}
+
+func getMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Member",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1},
+			{Name: "MemberType", Aliases: []string{"Type"}},
+			{Name: "InputObject", ValueFromPipeline: true},
+			{Name: "Static", Switch: true},
+			{Name: "Force", Switch: true},
+		},
+		End: func(c *Call) error {
+			var kinds []string
+			for _, v := range c.Strings("MemberType") {
+				kind := ""
+				for _, allowed := range memberTypes {
+					if strings.EqualFold(v, allowed) {
+						kind = allowed
+					}
+				}
+				if kind == "" {
+					return c.Errorf("Cannot bind parameter 'MemberType'. Cannot convert value \"%s\" to type \"System.Management.Automation.PSMemberTypes\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again:\n%s\"", v, v, strings.Join(memberTypes, ", "))
+				}
+				kinds = append(kinds, kind)
+			}
+			// -InputObject describes the collection itself rather than its elements
+			inputs := c.Inputs
+			if c.Has("InputObject") {
+				inputs = []interface{}{c.Get("InputObject")}
+			}
+			names := c.Strings("Name")
+			seen := map[string]bool{}
+			found := false
+			for _, v := range inputs {
+				if v == nil {
+					continue
+				}
+				found = true
+				var typeName string
+				var members []memberInfo
+				if c.Switch("Static") {
+					t, ok := v.(*TypeInfo)
+					if !ok {
+						t = typeOf(v)
+					}
+					typeName, members = t.Name, staticMembersOf(t)
+				} else {
+					typeName, members = typeHierarchy(v)[0], membersOf(v)
+					if c.Switch("Force") {
+						members = append(members, intrinsicMembers...)
+					}
+				}
+				if seen[typeName] {
+					continue
+				}
+				seen[typeName] = true
+				sortMembers(members)
+				for _, m := range members {
+					if !memberTypeMatches(m.memberType, kinds) {
+						continue
+					}
+					if len(names) > 0 {
+						matched := false
+						for _, n := range names {
+							matched = matched || MatchWildcard(n, m.name, false)
+						}
+						if !matched {
+							continue
+						}
+					}
+					definition := m.definition
+					o := NewObject("Microsoft.PowerShell.Commands.MemberDefinition").
+						Add("TypeName", typeName).
+						Add("Name", m.name).
+						Add("MemberType", m.memberType).
+						Add("Definition", definition)
+					o.ToStringFunc = func(*PSObject) string { return definition }
+					if err := c.Emit(o); err != nil {
+						return err
+					}
+				}
+			}
+			if !found {
+				return c.Errorf("You must specify an object for the Get-Member cmdlet.")
+			}
+			return nil
+		},
+	}
+}
+
+// invokeScriptMember runs the script block of a script property or method
+// with $this set to the object
+func (rs *Runspace) invokeScriptMember(sb *ScriptBlock, this interface{}, args []interface{}) (interface{}, error) {
+	var items []interface{}
+	err := rs.invokeBlock(sb, invocation{newScope: true, this: this, hasThis: true, args: args}, func(v interface{}) error {
+		items = append(items, v)
+		return nil
+	})
+	return unwrap(items), err
+}
+
+func addMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Add-Member",
+		DefaultSet: "TypeNameSet",
+		Params: []*Parameter{
+			{Name: "MemberType", Aliases: []string{"Type"}, Position: 1, Mandatory: true, Sets: []string{"MemberSet"}},
+			{Name: "Name", Position: 2, Mandatory: true, Sets: []string{"MemberSet"}},
+			{Name: "Value", Position: 3, Sets: []string{"MemberSet"}},
+			{Name: "SecondValue", Position: 4, Sets: []string{"MemberSet"}},
+			{Name: "NotePropertyName", Mandatory: true, Sets: []string{"NotePropertySingleMemberSet"}},
+			{Name: "NotePropertyValue", Mandatory: true, AllowEmpty: true, Sets: []string{"NotePropertySingleMemberSet"}},
+			{Name: "NotePropertyMembers", Mandatory: true, Sets: []string{"NotePropertyMultiMemberSet"}},
+			{Name: "TypeName"},
+			{Name: "InputObject", Mandatory: true, ValueFromPipeline: true},
+			{Name: "PassThru", Switch: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			v, _ := pipelineInput(c)
+			if v == nil {
+				return c.Errorf("Cannot bind argument to parameter 'InputObject' because it is null.")
+			}
+			o, ok := v.(*PSObject)
+			if !ok {
+				return c.Errorf("Cannot add a member to a value of type [%s]. Add members to objects such as a [PSCustomObject] instead.", typeName(v))
+			}
+			// Each addition is a name and a function that adds the member
+			type addition struct {
+				name string
+				add  func()
+			}
+			var additions []addition
+			note := func(name string, value interface{}) addition {
+				return addition{name, func() { o.AddNote(name, value) }}
+			}
+			switch {
+			case c.Has("NotePropertyMembers"):
+				members, ok := c.Get("NotePropertyMembers").(*Hashtable)
+				if !ok {
+					return c.Errorf("Cannot bind parameter 'NotePropertyMembers'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Collections.IDictionary\".", toString(c.Get("NotePropertyMembers")), typeName(c.Get("NotePropertyMembers")))
+				}
+				for _, k := range members.Keys() {
+					value, _ := members.Get(k)
+					additions = append(additions, note(toString(k), value))
+				}
+			case c.Has("NotePropertyName"):
+				additions = append(additions, note(c.String("NotePropertyName"), c.Get("NotePropertyValue")))
+			case c.Has("MemberType"):
+				kind, err := adEnum(c, "MemberType", "System.Management.Automation.PSMemberTypes", "NoteProperty", "AliasProperty", "ScriptProperty", "ScriptMethod")
+				if err != nil {
+					return err
+				}
+				name := c.String("Name")
+				if name == "" {
+					return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Name.")
+				}
+				value := c.Get("Value")
+				sb, isScript := value.(*ScriptBlock)
+				if (kind == "ScriptProperty" || kind == "ScriptMethod") && !isScript {
+					return c.Errorf("Cannot convert the \"%s\" value of type \"%s\" to type \"System.Management.Automation.ScriptBlock\".", toString(value), typeName(value))
+				}
+				switch kind {
+				case "NoteProperty":
+					additions = append(additions, note(name, value))
+				case "AliasProperty":
+					target := toString(value)
+					if target == "" {
+						return c.Errorf("Cannot process command because of one or more missing mandatory parameters: Value.")
+					}
+					additions = append(additions, addition{name, func() { o.AddAlias(name, target) }})
+				case "ScriptProperty":
+					additions = append(additions, addition{name, func() {
+						o.AddScriptProperty(name, sb.String(), func() interface{} {
+							// A getter that fails reads as $null, as in PowerShell
+							v, _ := rs.invokeScriptMember(sb, o, nil)
+							return v
+						})
+					}})
+				case "ScriptMethod":
+					additions = append(additions, addition{name, func() {
+						o.AddScriptMethod(name, func(args []interface{}) (interface{}, error) {
+							return rs.invokeScriptMember(sb, o, args)
+						})
+					}})
+				}
+			case !c.Has("TypeName"):
+				return c.Errorf("Parameter set cannot be resolved using the specified named parameters. One or more parameters issued cannot be used together or an insufficient number of parameters were provided.")
+			}
+			for _, a := range additions {
+				if (o.Property(a.name) != nil || o.Method(a.name) != nil) && !c.Switch("Force") {
+					c.WriteError(c.Errorf("Cannot add a member with the name \"%s\" because a member with that name already exists. To overwrite the member anyway, add the Force parameter to your command.", a.name))
+					continue
+				}
+				a.add()
+			}
+			if tn := c.String("TypeName"); tn != "" && !strings.EqualFold(o.TypeName(), tn) {
+				o.TypeNames = append([]string{tn}, o.TypeNames...)
+			}
+			if c.Switch("PassThru") {
+				return c.Emit(o)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,386 @@
+package psim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinModules are the modules whose cmdlets every runspace already has
+// loaded; importing one succeeds without doing anything
+var builtinModules = []string{
+	"ActiveDirectory",
+	"ExchangeOnlineManagement",
+	"Microsoft.Graph",
+	"Microsoft.Graph.Authentication",
+	"Microsoft.Graph.Groups",
+	"Microsoft.Graph.Users",
+	"Microsoft.PowerShell.Management",
+	"Microsoft.PowerShell.Security",
+	"Microsoft.PowerShell.Utility",
+}
+
+// scriptModule is a .psm1 or .ps1 file imported with Import-Module. Its
+// code runs once, in a scope of its own that its functions keep using.
+type scriptModule struct {
+	Name    string
+	Path    string
+	scope   *Scope
+	exports *moduleExports // what Export-ModuleMember named; nil exports every function and alias
+
+	functions map[string]*Cmdlet   // exported functions keyed by lowercased name
+	variables map[string]*Variable // exported variables keyed by lowercased name
+	aliases   []string             // aliases the module defined and exports
+	target    *Scope               // scope the exports were imported into
+}
+
+// moduleExports are the wildcard patterns given to Export-ModuleMember
+type moduleExports struct {
+	functions, variables, aliases []string
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchWildcard(p, name, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// findModule resolves the name given to Import-Module to a module file: a
+// path to a .psm1 or .ps1 file or to the folder holding one, or the name
+// of a module folder in one of the $env:PSModulePath directories
+func (rs *Runspace) findModule(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	if strings.ContainsAny(name, `\/`) || strings.HasSuffix(lower, ".psm1") || strings.HasSuffix(lower, ".ps1") {
+		path, err := rs.resolvePath(name)
+		if err != nil {
+			return "", false
+		}
+		if rs.fs.IsDir(path) {
+			path += `\` + leafName(path) + ".psm1"
+		}
+		lower = strings.ToLower(path)
+		ok := rs.fs.Exists(path) && !rs.fs.IsDir(path) && (strings.HasSuffix(lower, ".psm1") || strings.HasSuffix(lower, ".ps1"))
+		return path, ok
+	}
+	for _, dir := range rs.modulePath() {
+		path := dir + `\` + name + `\` + name + ".psm1"
+		if rs.fs.Exists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// modulePath returns the directories of $env:PSModulePath
+func (rs *Runspace) modulePath() []string {
+	value, _ := rs.env.Get("PSModulePath")
+	var dirs []string
+	for _, dir := range strings.Split(toString(value), ";") {
+		if dir = strings.TrimRight(strings.TrimSpace(dir), `\`); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// moduleName is the name of the module a file holds: its name without the extension
+func moduleName(path string) string {
+	name := leafName(path)
+	if i := strings.LastIndex(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// importModule runs a module file and imports what it exports into the
+// scope Import-Module was called from: the calling module's, else the global one
+func (rs *Runspace) importModule(c *Call, path string) (*scriptModule, error) {
+	block, source, err := rs.loadScript(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &scriptModule{Name: moduleName(path), Path: path, scope: newScope(rs.global)}
+	m.scope.script, m.scope.module = true, m
+	m.scope.vars["psscriptroot"] = &Variable{Name: "PSScriptRoot", Value: parentPath(path)}
+	m.scope.vars["pscommandpath"] = &Variable{Name: "PSCommandPath", Value: path}
+	before := map[string]bool{}
+	for alias := range rs.aliases {
+		before[alias] = true
+	}
+
+	scope, saved := rs.scope, rs.source
+	rs.scope, rs.source = m.scope, source
+	err = rs.execBlocks(block, c.Emit)
+	rs.scope, rs.source = scope, saved
+	if _, ok := err.(*exitSignal); ok {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.target = rs.global
+	if sc := rs.scope.moduleScope(); sc != nil {
+		m.target = sc
+	}
+	m.functions, m.variables = map[string]*Cmdlet{}, map[string]*Variable{}
+	for key, f := range m.scope.functions {
+		if m.exports == nil || matchesAny(m.exports.functions, f.Name) {
+			m.functions[key] = f
+			m.target.functions[key] = f
+		}
+	}
+	if m.exports != nil {
+		for key, v := range m.scope.vars {
+			if matchesAny(m.exports.variables, v.Name) {
+				m.variables[key] = v
+				m.target.vars[key] = v
+			}
+		}
+	}
+	for alias := range rs.aliases {
+		if before[alias] {
+			continue
+		}
+		if m.exports != nil && !matchesAny(m.exports.aliases, alias) {
+			delete(rs.aliases, alias)
+			continue
+		}
+		m.aliases = append(m.aliases, alias)
+	}
+	sort.Strings(m.aliases)
+	rs.modules = append(rs.modules, m)
+	return m, nil
+}
+
+// removeModule takes a module's exports back out of the session
+func (rs *Runspace) removeModule(m *scriptModule) {
+	for key, f := range m.functions {
+		if m.target.functions[key] == f {
+			delete(m.target.functions, key)
+		}
+	}
+	for key, v := range m.variables {
+		if m.target.vars[key] == v {
+			delete(m.target.vars, key)
+		}
+	}
+	for _, alias := range m.aliases {
+		delete(rs.aliases, alias)
+	}
+	for i, other := range rs.modules {
+		if other == m {
+			rs.modules = append(rs.modules[:i], rs.modules[i+1:]...)
+			break
+		}
+	}
+}
+
+// info is the PSModuleInfo Import-Module -PassThru and Get-Module return
+func (m *scriptModule) info() *PSObject {
+	var functions []string
+	for _, f := range m.functions {
+		functions = append(functions, f.Name)
+	}
+	var variables []string
+	for _, v := range m.variables {
+		variables = append(variables, v.Name)
+	}
+	return moduleInfo(m.Name, m.Path, functions, variables, m.aliases)
+}
+
+func moduleInfo(name, path string, functions, variables, aliases []string) *PSObject {
+	list := func(names []string) []interface{} {
+		sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+		items := []interface{}{}
+		for _, n := range names {
+			items = append(items, n)
+		}
+		return items
+	}
+	o := NewObject("System.Management.Automation.PSModuleInfo").
+		Add("Name", name).
+		Add("Path", path).
+		Add("ModuleBase", parentPath(path)).
+		Add("ModuleType", "Script").
+		Add("Version", "0.0").
+		Add("PreRelease", nil).
+		Add("ExportedCommands", list(append(append([]string{}, functions...), aliases...))).
+		Add("ExportedFunctions", list(functions)).
+		Add("ExportedVariables", list(variables)).
+		Add("ExportedAliases", list(aliases))
+	o.ToStringFunc = func(*PSObject) string { return name }
+	return o
+}
+
+func importModuleCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Import-Module",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "Force", Switch: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			names := c.Strings("Name")
+			if c.HasInput {
+				names = []string{toString(c.Input)}
+			}
+		next:
+			for _, name := range names {
+				for _, m := range builtinModules {
+					if strings.EqualFold(m, name) {
+						continue next
+					}
+				}
+				path, ok := rs.findModule(name)
+				if !ok {
+					c.WriteError(c.Errorf("The specified module '%s' was not loaded because no valid module file was found in any module directory.", name))
+					continue
+				}
+				// A module already imported isn't run again unless -Force asks to
+				for _, m := range rs.modules {
+					if strings.EqualFold(m.Path, path) {
+						if !c.Switch("Force") {
+							if c.Switch("PassThru") {
+								if err := c.Emit(m.info()); err != nil {
+									return err
+								}
+							}
+							continue next
+						}
+						rs.removeModule(m)
+						break
+					}
+				}
+				m, err := rs.importModule(c, path)
+				if err != nil {
+					return err
+				}
+				c.WriteVerbose(fmt.Sprintf("Loading module from path '%s'.", path))
+				if c.Switch("PassThru") {
+					if err := c.Emit(m.info()); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func exportModuleMemberCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Export-ModuleMember",
+		Params: []*Parameter{
+			{Name: "Function", Position: 1, ValueFromPipeline: true, ValueFromPipelineByPropertyName: true},
+			{Name: "Cmdlet", ValueFromPipelineByPropertyName: true},
+			{Name: "Variable", ValueFromPipelineByPropertyName: true},
+			{Name: "Alias", ValueFromPipelineByPropertyName: true},
+		},
+		Process: func(c *Call) error {
+			sc := c.Runspace.scope.moduleScope()
+			if sc == nil {
+				return c.Errorf("The Export-ModuleMember cmdlet can only be called from inside a module.")
+			}
+			m := sc.module
+			if m.exports == nil {
+				m.exports = &moduleExports{}
+			}
+			m.exports.functions = append(m.exports.functions, c.Strings("Function")...)
+			m.exports.variables = append(m.exports.variables, c.Strings("Variable")...)
+			m.exports.aliases = append(m.exports.aliases, c.Strings("Alias")...)
+			return nil
+		},
+	}
+}
+
+func getModuleCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Module",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, ValueFromPipeline: true},
+			{Name: "ListAvailable", Switch: true},
+			{Name: "All", Switch: true},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			patterns := c.Strings("Name")
+			wanted := func(name string) bool {
+				return len(patterns) == 0 || matchesAny(patterns, name)
+			}
+			if !c.Switch("ListAvailable") {
+				for _, m := range rs.modules {
+					if wanted(m.Name) {
+						if err := c.Emit(m.info()); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			}
+			// Modules on disk list the functions their files define, without running them
+			for _, dir := range rs.modulePath() {
+				entries, err := rs.fs.List(dir)
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					path := dir + `\` + entry + `\` + entry + ".psm1"
+					if !wanted(entry) || !rs.fs.Exists(path) {
+						continue
+					}
+					var functions []string
+					if text, err := rs.fs.ReadFile(path); err == nil {
+						if block, err := Parse(text); err == nil {
+							for _, st := range block.Body {
+								if def, ok := st.(*FunctionDefinition); ok {
+									functions = append(functions, def.Name)
+								}
+							}
+						}
+					}
+					if err := c.Emit(moduleInfo(entry, path, functions, nil, nil)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func removeModuleCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Remove-Module",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			names := c.Strings("Name")
+			if c.HasInput {
+				names = []string{toString(c.Input)}
+				if o, ok := c.Input.(*PSObject); ok {
+					names = []string{toString(propertyOf(o, "Name"))}
+				}
+			}
+			removed := false
+			for _, m := range append([]*scriptModule{}, rs.modules...) {
+				if matchesAny(names, m.Name) {
+					rs.removeModule(m)
+					removed = true
+				}
+			}
+			if !removed {
+				c.WriteError(c.Errorf("No modules were removed. Verify that the specification of modules to remove is correct and those modules exist in the runspace."))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,851 @@
+package psim
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// propertySpec is one entry of a -Property argument: a property name (possibly
+// with wildcards), a script block, or a calculated property hashtable
+type propertySpec struct {
+	name       string
+	from       string // source property of @{Name=...; Expression='Prop'}
+	expr       *ScriptBlock
+	descending *bool     // per-key sort direction from @{Expression=...; Descending=$true}
+	format     string    // FormatString of a Format-* calculated property
+	width      int       // Width of a Format-Table column
+	align      alignment // Alignment of a Format-Table column
+}
+
+// label returns the property name a spec produces
+func (p propertySpec) label() string {
+	switch {
+	case p.name != "":
+		return p.name
+	case p.from != "":
+		return p.from
+	case p.expr != nil:
+		return p.expr.String()
+	}
+	return ""
+}
+
+// source returns the name of the property a spec reads, if it reads one
+func (p propertySpec) source() string {
+	if p.from != "" {
+		return p.from
+	}
+	return p.name
+}
+
+// calculatedKeys maps the keys allowed in a calculated property hashtable to their canonical name
+var calculatedKeys = map[string][]string{
+	"Select-Object":  {"Name", "Label", "Expression"},
+	"Sort-Object":    {"Expression", "Ascending", "Descending"},
+	"Group-Object":   {"Expression"},
+	"Measure-Object": {"Expression"},
+	"Format-Table":   {"Name", "Label", "Expression", "FormatString", "Width", "Alignment"},
+	"Format-List":    {"Name", "Label", "Expression", "FormatString"},
+	"Format-Wide":    {"Expression", "FormatString"},
+}
+
+// propertySpecs parses a cmdlet's -Property argument
+func propertySpecs(c *Call, name string) ([]propertySpec, error) {
+	var specs []propertySpec
+	for _, v := range asList(c.Get(name)) {
+		switch p := v.(type) {
+		case *ScriptBlock:
+			specs = append(specs, propertySpec{expr: p})
+		case *Hashtable:
+			spec, err := calculatedProperty(c, p)
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, spec)
+		default:
+			specs = append(specs, propertySpec{name: toString(v)})
+		}
+	}
+	return specs, nil
+}
+
+func calculatedProperty(c *Call, h *Hashtable) (propertySpec, error) {
+	var spec propertySpec
+	hasExpr := false
+	for _, k := range h.Keys() {
+		key := toString(k)
+		canonical := ""
+		for _, allowed := range calculatedKeys[c.Cmdlet.Name] {
+			if key != "" && strings.HasPrefix(strings.ToLower(allowed), strings.ToLower(key)) {
+				canonical = allowed
+				break
+			}
+		}
+		v, _ := h.Get(k)
+		switch canonical {
+		case "Name", "Label":
+			spec.name = toString(v)
+		case "Expression":
+			hasExpr = true
+			if sb, ok := v.(*ScriptBlock); ok {
+				spec.expr = sb
+			} else {
+				spec.from = toString(v)
+			}
+		case "Ascending", "Descending":
+			desc := toBool(v) == (canonical == "Descending")
+			spec.descending = &desc
+		case "FormatString":
+			spec.format = toString(v)
+		case "Width":
+			n, err := toInt(v)
+			if err != nil || n <= 0 {
+				return spec, c.Errorf("The Width key has a value that is not valid. Provide a positive integer.")
+			}
+			spec.width = n
+		case "Alignment":
+			switch strings.ToLower(toString(v)) {
+			case "left":
+				spec.align = alignLeft
+			case "center":
+				spec.align = alignCenter
+			case "right":
+				spec.align = alignRight
+			default:
+				return spec, c.Errorf("The Alignment key has a value that is not valid. Valid values are: Left, Center, Right.")
+			}
+		default:
+			return spec, c.Errorf("The %s key is not valid.", key)
+		}
+	}
+	if !hasExpr {
+		return spec, c.Errorf("The Expression key is missing.")
+	}
+	return spec, nil
+}
+
+// propertyValue evaluates a property spec against an object; ok is false when a named property does not exist
+func (rs *Runspace) propertyValue(obj interface{}, spec propertySpec) (v interface{}, ok bool, err error) {
+	if spec.expr != nil {
+		v, err = rs.evalBlockValue(spec.expr, obj)
+		return v, true, err
+	}
+	name := spec.source()
+	switch o := obj.(type) {
+	case *PSObject:
+		v, ok = o.Get(name)
+		return v, ok, nil
+	case *Hashtable:
+		v, ok = o.Get(name)
+		return v, ok, nil
+	}
+	v, err = rs.getMember(obj, name)
+	return v, v != nil, err
+}
+
+// pipelineInput returns the current input object of a cmdlet that also accepts -InputObject
+func pipelineInput(c *Call) (interface{}, bool) {
+	if c.HasInput {
+		return c.Input, true
+	}
+	if c.Has("InputObject") {
+		return c.Get("InputObject"), true
+	}
+	return nil, false
+}
+
+// bufferedInput returns the input of a cmdlet that processes everything in End
+func bufferedInput(c *Call) []interface{} {
+	if c.Has("InputObject") {
+		return asList(c.Get("InputObject"))
+	}
+	return c.Inputs
+}
+
+// whereOperators are the comparison switches of the simplified Where-Object syntax
+var whereOperators = []string{
+	"EQ", "NE", "GT", "GE", "LT", "LE", "Like", "NotLike", "Match", "NotMatch",
+	"Contains", "NotContains", "In", "NotIn", "Is", "IsNot",
+}
+
+func whereObjectCmdlet() *Cmdlet {
+	type state struct {
+		filter   *ScriptBlock
+		property string
+		op       string
+		value    interface{}
+	}
+	// Each comparison switch has a parameter set of its own, as does -Not
+	var opSets []string
+	for _, op := range whereOperators {
+		opSets = append(opSets, op+"Set")
+		if op != "Is" && op != "IsNot" {
+			opSets = append(opSets, "C"+op+"Set")
+		}
+	}
+	propertySets := append([]string{"NotSet"}, opSets...)
+	params := []*Parameter{
+		{Name: "FilterScript", Position: 1, Mandatory: true, Sets: []string{"ScriptBlockSet"}},
+		{Name: "Property", Position: 1, Mandatory: true, Sets: propertySets},
+		{Name: "Value", Position: 2, Sets: opSets},
+		{Name: "Not", Switch: true, Sets: []string{"NotSet"}},
+		{Name: "InputObject", ValueFromPipeline: true},
+	}
+	for _, set := range opSets {
+		name := strings.TrimSuffix(set, "Set")
+		params = append(params, &Parameter{Name: name, Switch: true, Sets: []string{set}})
+	}
+	return &Cmdlet{
+		Name:       "Where-Object",
+		DefaultSet: "EQSet",
+		Params:     params,
+		Begin: func(c *Call) error {
+			st := &state{}
+			if sb, ok := c.Get("FilterScript").(*ScriptBlock); ok {
+				st.filter = sb
+				c.State = st
+				return nil
+			}
+			st.property, st.value = c.String("Property"), c.Get("Value")
+			for _, p := range c.Cmdlet.Params[5:] {
+				if c.Switch(p.Name) {
+					st.op = "-" + strings.ToLower(p.Name)
+				}
+			}
+			c.State = st
+			return nil
+		},
+		Process: func(c *Call) error {
+			st := c.State.(*state)
+			input, ok := pipelineInput(c)
+			if !ok {
+				return nil
+			}
+			var match bool
+			if st.filter != nil {
+				out, err := c.Invoke(st.filter, input)
+				if err != nil {
+					return err
+				}
+				match = toBool(unwrap(out))
+			} else {
+				v, err := c.Runspace.getMember(input, st.property)
+				if err != nil {
+					return err
+				}
+				if st.op == "" {
+					match = toBool(v) != c.Switch("Not")
+				} else {
+					res, err := c.Runspace.compare(st.op, v, st.value)
+					if err != nil {
+						return c.Errorf("%s", err.Error())
+					}
+					match = toBool(res)
+				}
+			}
+			if match {
+				return c.Emit(input)
+			}
+			return nil
+		},
+	}
+}
+
+func selectObjectCmdlet() *Cmdlet {
+	type state struct {
+		specs               []propertySpec
+		first, last, skip   int
+		index               map[int]bool
+		maxIndex            int
+		buffered            bool
+		seen, emitted       int
+		buffer, uniqueItems []interface{}
+	}
+	return &Cmdlet{
+		Name: "Select-Object",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "ExcludeProperty"},
+			{Name: "ExpandProperty"},
+			{Name: "First"},
+			{Name: "Last"},
+			{Name: "Skip"},
+			{Name: "Index"},
+			{Name: "Unique", Switch: true},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		Begin: func(c *Call) error {
+			st := &state{maxIndex: -1}
+			var err error
+			if st.specs, err = propertySpecs(c, "Property"); err != nil {
+				return err
+			}
+			if st.first, err = c.Int("First", -1); err != nil {
+				return err
+			}
+			if st.last, err = c.Int("Last", -1); err != nil {
+				return err
+			}
+			if st.skip, err = c.Int("Skip", 0); err != nil {
+				return err
+			}
+			if c.Has("Index") {
+				st.index = map[int]bool{}
+				for _, v := range asList(c.Get("Index")) {
+					i, err := toInt(v)
+					if err != nil {
+						return c.Errorf("Cannot bind parameter 'Index'. %s", err.Error())
+					}
+					st.index[i] = true
+					if i > st.maxIndex {
+						st.maxIndex = i
+					}
+				}
+			}
+			st.buffered = st.last >= 0 || c.Switch("Unique")
+			c.State = st
+			return nil
+		},
+		Process: func(c *Call) error {
+			st := c.State.(*state)
+			input, ok := pipelineInput(c)
+			if !ok {
+				return nil
+			}
+			pos := st.seen
+			st.seen++
+			if st.index != nil {
+				if !st.index[pos] {
+					return nil
+				}
+				if err := selectEmit(c, st.specs, input, nil); err != nil {
+					return err
+				}
+				if pos >= st.maxIndex {
+					return c.Stop()
+				}
+				return nil
+			}
+			if st.buffered {
+				st.buffer = append(st.buffer, input)
+				return nil
+			}
+			if pos < st.skip {
+				return nil
+			}
+			if st.first >= 0 && st.emitted >= st.first {
+				return c.Stop()
+			}
+			st.emitted++
+			if err := selectEmit(c, st.specs, input, nil); err != nil {
+				return err
+			}
+			if st.first >= 0 && st.emitted >= st.first {
+				return c.Stop()
+			}
+			return nil
+		},
+		End: func(c *Call) error {
+			st := c.State.(*state)
+			if !st.buffered {
+				return nil
+			}
+			items := st.buffer
+			if st.skip < len(items) {
+				items = items[st.skip:]
+			} else {
+				items = nil
+			}
+			if st.first >= 0 && st.first < len(items) {
+				items = items[:st.first]
+			}
+			if st.last >= 0 && st.last < len(items) {
+				items = items[len(items)-st.last:]
+			}
+			var seen *[]interface{}
+			if c.Switch("Unique") {
+				seen = &st.uniqueItems
+			}
+			for _, item := range items {
+				if err := selectEmit(c, st.specs, item, seen); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// selectEmit projects one input object and writes it to the pipeline; with
+// seen set, objects equal to one already written are dropped
+func selectEmit(c *Call, specs []propertySpec, input interface{}, seen *[]interface{}) error {
+	var out []interface{}
+	if c.Has("ExpandProperty") {
+		name := c.String("ExpandProperty")
+		v, ok, err := c.Runspace.propertyValue(input, propertySpec{name: name})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			c.WriteError(c.Errorf("Property \"%s\" cannot be found.", name))
+			return nil
+		}
+		for _, item := range asList(v) {
+			if obj, isObj := item.(*PSObject); isObj && len(specs) > 0 {
+				extra, err := selectProperties(c, input, specs)
+				if err != nil {
+					return err
+				}
+				obj = obj.Copy()
+				for _, p := range extra.Properties() {
+					obj.Add(p.Name, p.Value)
+				}
+				item = obj
+			}
+			out = append(out, item)
+		}
+	} else if len(specs) > 0 {
+		obj, err := selectProperties(c, input, specs)
+		if err != nil {
+			return err
+		}
+		out = append(out, obj)
+	} else {
+		out = append(out, input)
+	}
+	for _, item := range out {
+		if seen != nil {
+			if containsEqual(*seen, item) {
+				continue
+			}
+			*seen = append(*seen, item)
+		}
+		if err := c.Emit(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectProperties builds the Selected.<type> object Select-Object -Property produces
+func selectProperties(c *Call, input interface{}, specs []propertySpec) (*PSObject, error) {
+	out := NewObject("Selected."+typeName(input), "System.Management.Automation.PSCustomObject")
+	exclude := c.Strings("ExcludeProperty")
+	excluded := func(name string) bool {
+		for _, pattern := range exclude {
+			if MatchWildcard(pattern, name, false) {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(name string, v interface{}) {
+		if out.Property(name) != nil {
+			c.WriteError(c.Errorf("The property cannot be processed because the property \"%s\" already exists.", name))
+			return
+		}
+		out.Add(name, v)
+	}
+	for _, spec := range specs {
+		if spec.expr == nil && spec.from == "" && HasWildcard(spec.name) {
+			for _, name := range propertyNames(input) {
+				if MatchWildcard(spec.name, name, false) && !excluded(name) {
+					v, err := c.Runspace.getMember(input, name)
+					if err != nil {
+						return nil, err
+					}
+					add(name, v)
+				}
+			}
+			continue
+		}
+		v, _, err := c.Runspace.propertyValue(input, spec)
+		if err != nil {
+			return nil, err
+		}
+		name := spec.label()
+		if obj, ok := input.(*PSObject); ok && spec.expr == nil && spec.from == "" {
+			if p := obj.Property(name); p != nil {
+				name = p.Name
+			}
+		}
+		add(name, v)
+	}
+	return out, nil
+}
+
+// containsEqual reports whether list holds an object equal to v, comparing property values for objects
+func containsEqual(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if objectsEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func objectsEqual(a, b interface{}) bool {
+	oa, okA := a.(*PSObject)
+	ob, okB := b.(*PSObject)
+	if !okA || !okB {
+		return !okA && !okB && valuesEqual(a, b, true)
+	}
+	pa, pb := oa.Properties(), ob.Properties()
+	if len(pa) != len(pb) {
+		return false
+	}
+	for i := range pa {
+		if !strings.EqualFold(pa[i].Name, pb[i].Name) || !valuesEqual(pa[i].Current(), pb[i].Current(), true) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareKeys orders two sort keys, falling back to string comparison for values that are not comparable
+func compareKeys(a, b interface{}, cs bool) int {
+	if n, err := compareValues(a, b, cs); err == nil {
+		return n
+	}
+	return compareStrings(toString(a), toString(b), cs)
+}
+
+func sortObjectCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Sort-Object",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "Descending", Switch: true},
+			{Name: "Unique", Switch: true},
+			{Name: "CaseSensitive", Switch: true},
+			{Name: "Top"},
+			{Name: "Bottom"},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			specs, err := propertySpecs(c, "Property")
+			if err != nil {
+				return err
+			}
+			items := bufferedInput(c)
+			cs := c.Switch("CaseSensitive")
+			keys := make([][]interface{}, len(items))
+			for i, item := range items {
+				if len(specs) == 0 {
+					keys[i] = []interface{}{item}
+					continue
+				}
+				keys[i] = make([]interface{}, len(specs))
+				for k, spec := range specs {
+					if keys[i][k], _, err = c.Runspace.propertyValue(item, spec); err != nil {
+						return err
+					}
+				}
+			}
+			descending := func(k int) bool {
+				if k < len(specs) && specs[k].descending != nil {
+					return *specs[k].descending
+				}
+				return c.Switch("Descending")
+			}
+			compare := func(i, j int) int {
+				for k := range keys[i] {
+					n := compareKeys(keys[i][k], keys[j][k], cs)
+					if descending(k) {
+						n = -n
+					}
+					if n != 0 {
+						return n
+					}
+				}
+				return 0
+			}
+			order := make([]int, len(items))
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(a, b int) bool { return compare(order[a], order[b]) < 0 })
+			var sorted []interface{}
+			for n, i := range order {
+				if c.Switch("Unique") && n > 0 && compare(order[n-1], i) == 0 {
+					continue
+				}
+				sorted = append(sorted, items[i])
+			}
+			top, err := c.Int("Top", -1)
+			if err != nil {
+				return err
+			}
+			bottom, err := c.Int("Bottom", -1)
+			if err != nil {
+				return err
+			}
+			if top >= 0 && top < len(sorted) {
+				sorted = sorted[:top]
+			}
+			if bottom >= 0 && bottom < len(sorted) {
+				sorted = sorted[len(sorted)-bottom:]
+			}
+			return c.EmitAll(sorted)
+		},
+	}
+}
+
+func groupObjectCmdlet() *Cmdlet {
+	type group struct {
+		name   string
+		values []interface{}
+		items  []interface{}
+	}
+	return &Cmdlet{
+		Name: "Group-Object",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "NoElement", Switch: true},
+			{Name: "AsHashTable", Switch: true},
+			{Name: "AsString", Switch: true},
+			{Name: "CaseSensitive", Switch: true},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			specs, err := propertySpecs(c, "Property")
+			if err != nil {
+				return err
+			}
+			var groups []*group
+			byKey := map[string]*group{}
+			for _, item := range bufferedInput(c) {
+				values := []interface{}{item}
+				if len(specs) > 0 {
+					values = make([]interface{}, len(specs))
+					for k, spec := range specs {
+						if values[k], _, err = c.Runspace.propertyValue(item, spec); err != nil {
+							return err
+						}
+					}
+				}
+				names := make([]string, len(values))
+				for k, v := range values {
+					names[k] = toString(v)
+				}
+				name := strings.Join(names, ", ")
+				key := name
+				if !c.Switch("CaseSensitive") {
+					key = strings.ToLower(key)
+				}
+				g := byKey[key]
+				if g == nil {
+					g = &group{name: name, values: values}
+					byKey[key] = g
+					groups = append(groups, g)
+				}
+				g.items = append(g.items, item)
+			}
+			if c.Switch("AsHashTable") {
+				h := NewHashtable()
+				for _, g := range groups {
+					var key interface{} = g.name
+					if len(g.values) == 1 && !c.Switch("AsString") {
+						key = g.values[0]
+					}
+					h.Set(key, g.items)
+				}
+				return c.Emit(h)
+			}
+			for _, g := range groups {
+				info := NewObject("Microsoft.PowerShell.Commands.GroupInfo").
+					Add("Count", len(g.items)).
+					Add("Name", g.name)
+				if !c.Switch("NoElement") {
+					info.Add("Group", g.items)
+				}
+				info.Add("Values", g.values)
+				if err := c.Emit(info); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func measureObjectCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Measure-Object",
+		Params: []*Parameter{
+			{Name: "Property", Position: 1},
+			{Name: "Sum", Switch: true},
+			{Name: "Average", Switch: true},
+			{Name: "Maximum", Switch: true},
+			{Name: "Minimum", Switch: true},
+			{Name: "StandardDeviation", Switch: true},
+			{Name: "AllStats", Switch: true},
+			{Name: "Line", Switch: true},
+			{Name: "Word", Switch: true},
+			{Name: "Character", Switch: true},
+			{Name: "IgnoreWhiteSpace", Switch: true},
+			{Name: "InputObject", ValueFromPipeline: true},
+		},
+		End: func(c *Call) error {
+			specs, err := propertySpecs(c, "Property")
+			if err != nil {
+				return err
+			}
+			if len(specs) == 0 {
+				specs = []propertySpec{{}}
+			}
+			text := c.Switch("Line") || c.Switch("Word") || c.Switch("Character")
+			for _, spec := range specs {
+				var info *PSObject
+				if text {
+					info, err = measureText(c, spec)
+				} else {
+					info, err = measureNumbers(c, spec)
+				}
+				if err != nil {
+					return err
+				}
+				if info == nil {
+					continue
+				}
+				if err := c.Emit(info); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// measureValues collects the values a Measure-Object spec applies to; ok is false when no input had the property
+func measureValues(c *Call, spec propertySpec) (values []interface{}, ok bool, err error) {
+	items := bufferedInput(c)
+	if spec.label() == "" {
+		return items, true, nil
+	}
+	for _, item := range items {
+		v, found, err := c.Runspace.propertyValue(item, spec)
+		if err != nil {
+			return nil, false, err
+		}
+		if found {
+			values = append(values, v)
+			ok = true
+		}
+	}
+	if !ok && len(items) > 0 {
+		c.WriteError(c.Errorf("The property \"%s\" cannot be found in the input for any objects.", spec.label()))
+	}
+	return values, ok || len(items) == 0, nil
+}
+
+func measureNumbers(c *Call, spec propertySpec) (*PSObject, error) {
+	values, ok, err := measureValues(c, spec)
+	if err != nil || !ok {
+		return nil, err
+	}
+	all := c.Switch("AllStats")
+	wantSum, wantAvg, wantStd := all || c.Switch("Sum"), all || c.Switch("Average"), all || c.Switch("StandardDeviation")
+	wantMax, wantMin := all || c.Switch("Maximum"), all || c.Switch("Minimum")
+
+	count := 0
+	var sum, sumSq float64
+	var max, min interface{}
+	for _, v := range values {
+		count++
+		if wantSum || wantAvg || wantStd {
+			f, err := toFloat(v)
+			if err != nil {
+				c.WriteError(c.Errorf("Input object \"%s\" is not numeric.", toString(v)))
+				continue
+			}
+			sum += f
+			sumSq += f * f
+		}
+		if wantMax || wantMin {
+			if isNumber(v) {
+				v, _ = toFloat(v)
+			} else if s, ok := v.(string); ok {
+				if f, err := toFloat(s); err == nil {
+					v = f
+				}
+			}
+			if max == nil || compareKeys(v, max, false) > 0 {
+				max = v
+			}
+			if min == nil || compareKeys(v, min, false) < 0 {
+				min = v
+			}
+		}
+	}
+	info := NewObject("Microsoft.PowerShell.Commands.GenericMeasureInfo").Add("Count", count)
+	opt := func(want bool, v interface{}) interface{} {
+		if want && count > 0 {
+			return v
+		}
+		return nil
+	}
+	var avg, std float64
+	if count > 0 {
+		avg = sum / float64(count)
+	}
+	if count > 1 {
+		std = math.Sqrt((sumSq - float64(count)*avg*avg) / float64(count-1))
+	}
+	info.Add("Average", opt(wantAvg, avg)).
+		Add("Sum", opt(wantSum, sum)).
+		Add("Maximum", opt(wantMax, max)).
+		Add("Minimum", opt(wantMin, min)).
+		Add("StandardDeviation", opt(wantStd, std))
+	if label := spec.label(); label != "" {
+		info.Add("Property", label)
+	} else {
+		info.Add("Property", nil)
+	}
+	return info, nil
+}
+
+func measureText(c *Call, spec propertySpec) (*PSObject, error) {
+	values, ok, err := measureValues(c, spec)
+	if err != nil || !ok {
+		return nil, err
+	}
+	lines, words, chars := 0, 0, 0
+	for _, v := range values {
+		s := toString(v)
+		for _, line := range strings.Split(s, "\n") {
+			if strings.TrimSpace(line) != "" {
+				lines++
+			}
+		}
+		words += len(strings.Fields(s))
+		if c.Switch("IgnoreWhiteSpace") {
+			for _, r := range s {
+				if !unicode.IsSpace(r) {
+					chars++
+				}
+			}
+		} else {
+			chars += utf8.RuneCountInString(s)
+		}
+	}
+	opt := func(name string, n int) interface{} {
+		if c.Switch(name) {
+			return n
+		}
+		return nil
+	}
+	info := NewObject("Microsoft.PowerShell.Commands.TextMeasureInfo").
+		Add("Lines", opt("Line", lines)).
+		Add("Words", opt("Word", words)).
+		Add("Characters", opt("Character", chars))
+	if label := spec.label(); label != "" {
+		info.Add("Property", label)
+	} else {
+		info.Add("Property", nil)
+	}
+	return info, nil
+}
@@ -0,0 +1,181 @@
+package psim
+
+import (
+	"fmt"
+	"time"
+)
+
+// processObject wraps a process table entry in a System.Diagnostics.Process object
+func (rs *Runspace) processObject(p *Process) *PSObject {
+	cpu := p.CPU
+	obj := NewObject("System.Diagnostics.Process", "System.ComponentModel.Component", "System.MarshalByRefObject").
+		AddAlias("Name", "ProcessName").
+		Add("Id", p.Id).
+		AddAlias("Handles", "HandleCount").
+		AddScriptProperty("CPU", "$this.TotalProcessorTime.TotalSeconds", func() interface{} { return cpu }).
+		AddAlias("WS", "WorkingSet64").
+		AddAlias("PM", "PagedMemorySize64").
+		AddAlias("NPM", "NonpagedSystemMemorySize64").
+		AddAlias("SI", "SessionId").
+		Add("Path", emptyToNull(p.Path)).
+		Add("Company", emptyToNull(p.Company)).
+		Add("Description", emptyToNull(p.Description)).
+		Add("StartTime", p.StartTime).
+		Add("ProcessName", p.Name).
+		Add("HandleCount", p.Handles).
+		Add("TotalProcessorTime", time.Duration(cpu*float64(time.Second))).
+		Add("WorkingSet64", p.WorkingSet).
+		Add("PagedMemorySize64", p.PrivateMemory).
+		Add("PrivateMemorySize64", p.PrivateMemory).
+		Add("NonpagedSystemMemorySize64", p.NonpagedMemory).
+		Add("SessionId", p.SessionId).
+		Add("Responding", true)
+	obj.ToStringFunc = func(*PSObject) string {
+		return fmt.Sprintf("System.Diagnostics.Process (%s)", p.Name)
+	}
+	id := p.Id
+	obj.AddMethod("Kill", func(args []interface{}) (interface{}, error) {
+		if !rs.processes.Stop(id) {
+			return nil, fmt.Errorf("Exception calling \"Kill\" with \"0\" argument(s): \"No process is associated with this object.\"")
+		}
+		return nil, nil
+	})
+	obj.AddMethod("Refresh", func(args []interface{}) (interface{}, error) { return nil, nil })
+	return obj
+}
+
+func emptyToNull(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func getProcessCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Get-Process",
+		Params: []*Parameter{
+			{Name: "Name", Aliases: []string{"ProcessName"}, Position: 1, Sets: []string{"Name"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Id", Aliases: []string{"PID"}, Mandatory: true, Sets: []string{"Id"}, ValueFromPipelineByPropertyName: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			if c.Has("Id") {
+				for _, v := range asList(c.Get("Id")) {
+					id, err := toInt(v)
+					if err != nil {
+						return c.Errorf("Cannot bind parameter 'Id'. %s", err.Error())
+					}
+					p := rs.processes.Get(id)
+					if p == nil {
+						c.WriteError(c.Errorf("Cannot find a process with the process identifier %d.", id))
+						continue
+					}
+					if err := c.Emit(rs.processObject(p)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			patterns := c.Strings("Name")
+			if len(patterns) == 0 {
+				patterns = []string{"*"}
+			}
+			for _, pattern := range patterns {
+				found := false
+				for _, p := range rs.processes.List() {
+					if !MatchWildcard(pattern, p.Name, false) {
+						continue
+					}
+					found = true
+					if err := c.Emit(rs.processObject(p)); err != nil {
+						return err
+					}
+				}
+				if !found && !HasWildcard(pattern) {
+					c.WriteError(c.Errorf("Cannot find a process with the name \"%s\". Verify the process name and call the cmdlet again.", pattern))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func stopProcessCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Stop-Process",
+		DefaultSet: "Id",
+		Params: []*Parameter{
+			{Name: "Id", Aliases: []string{"PID"}, Position: 1, Mandatory: true, Sets: []string{"Id"}, ValueFromPipelineByPropertyName: true},
+			{Name: "Name", Aliases: []string{"ProcessName"}, Mandatory: true, Sets: []string{"Name"}, ValueFromPipelineByPropertyName: true},
+			{Name: "InputObject", Mandatory: true, Sets: []string{"InputObject"}, ValueFromPipeline: true},
+			{Name: "Force", Switch: true},
+			{Name: "PassThru", Switch: true},
+		},
+		Process: func(c *Call) error {
+			rs := c.Runspace
+			var targets []*Process
+			switch {
+			case c.Has("InputObject"):
+				for _, item := range asList(c.Get("InputObject")) {
+					v, err := rs.getMember(item, "Id")
+					if err != nil {
+						return err
+					}
+					id, err := toInt(v)
+					if v == nil || err != nil {
+						return c.Errorf("The input object cannot be bound to any parameters for the command either because the command does not take pipeline input or the input and its properties do not match any of the parameters that take pipeline input.")
+					}
+					if p := rs.processes.Get(id); p != nil {
+						targets = append(targets, p)
+					} else {
+						c.WriteError(c.Errorf("Cannot find a process with the process identifier %d.", id))
+					}
+				}
+			case c.Has("Name"):
+				for _, pattern := range c.Strings("Name") {
+					found := false
+					for _, p := range rs.processes.List() {
+						if MatchWildcard(pattern, p.Name, false) {
+							targets = append(targets, p)
+							found = true
+						}
+					}
+					if !found && !HasWildcard(pattern) {
+						c.WriteError(c.Errorf("Cannot find a process with the name \"%s\". Verify the process name and call the cmdlet again.", pattern))
+					}
+				}
+			case c.Has("Id"):
+				for _, v := range asList(c.Get("Id")) {
+					id, err := toInt(v)
+					if err != nil {
+						return c.Errorf("Cannot bind parameter 'Id'. %s", err.Error())
+					}
+					if p := rs.processes.Get(id); p != nil {
+						targets = append(targets, p)
+					} else {
+						c.WriteError(c.Errorf("Cannot find a process with the process identifier %d.", id))
+					}
+				}
+			}
+			for _, p := range targets {
+				target := fmt.Sprintf("%s (%d)", p.Name, p.Id)
+				if !c.ShouldProcess(target, "Stop-Process") {
+					continue
+				}
+				if p.Id == 0 || p.Id == 4 {
+					c.WriteError(c.Errorf("Cannot stop process \"%s\" because of the following error: Access is denied", target))
+					continue
+				}
+				obj := rs.processObject(p)
+				rs.processes.Stop(p.Id)
+				if c.Switch("PassThru") {
+					if err := c.Emit(obj); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
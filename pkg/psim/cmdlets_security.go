@@ -0,0 +1,82 @@
+package psim
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// SecureString is the simulated System.Security.SecureString. Its text is
+// only readable from Go, so printing one shows the type name as it does in
+// PowerShell.
+type SecureString struct {
+	text string
+}
+
+// NewSecureString wraps plain text in a SecureString
+func NewSecureString(text string) *SecureString {
+	return &SecureString{text: text}
+}
+
+// PlainText returns the protected text
+func (s *SecureString) PlainText() string {
+	return s.text
+}
+
+func (s *SecureString) String() string {
+	return "System.Security.SecureString"
+}
+
+// dpapiHeader prefixes the "encrypted standard strings" ConvertFrom-SecureString produces
+const dpapiHeader = "01000000d08c9ddf0115d1118c7a00c04fc297eb01000000"
+
+func convertToSecureStringCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "ConvertTo-SecureString",
+		DefaultSet: "Secure",
+		Params: []*Parameter{
+			{Name: "String", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "AsPlainText", Switch: true, Mandatory: true, Sets: []string{"PlainText"}},
+			{Name: "Force", Switch: true, Sets: []string{"PlainText"}},
+			{Name: "Key", Sets: []string{"Secure"}},
+		},
+		Process: func(c *Call) error {
+			text := c.String("String")
+			if c.HasInput {
+				text = toString(c.Input)
+			}
+			if c.Switch("AsPlainText") {
+				return c.Emit(NewSecureString(text))
+			}
+			raw, err := hex.DecodeString(strings.TrimPrefix(text, dpapiHeader))
+			if err != nil || !strings.HasPrefix(text, dpapiHeader) {
+				return c.Errorf("Input string was not in a correct format.")
+			}
+			return c.Emit(NewSecureString(string(raw)))
+		},
+	}
+}
+
+func convertFromSecureStringCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "ConvertFrom-SecureString",
+		Params: []*Parameter{
+			{Name: "SecureString", Position: 1, Mandatory: true, ValueFromPipeline: true},
+			{Name: "AsPlainText", Switch: true, Mandatory: true, Sets: []string{"AsPlainText"}},
+			{Name: "Key", Sets: []string{"Secure"}},
+		},
+		Process: func(c *Call) error {
+			input := c.Get("SecureString")
+			if c.HasInput {
+				input = c.Input
+			}
+			ss, ok := input.(*SecureString)
+			if !ok {
+				return c.Errorf("Cannot bind parameter 'SecureString'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Security.SecureString\".", toString(input), typeName(input))
+			}
+			if c.Switch("AsPlainText") {
+				return c.Emit(ss.text)
+			}
+			return c.Emit(dpapiHeader + hex.EncodeToString([]byte(ss.text)))
+		},
+	}
+}
@@ -0,0 +1,282 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// serviceObject wraps a service table entry in a System.ServiceProcess.ServiceController object
+func (rs *Runspace) serviceObject(s *Service) *PSObject {
+	obj := NewObject("System.ServiceProcess.ServiceController", "System.ComponentModel.Component", "System.MarshalByRefObject").
+		AddAlias("Name", "ServiceName").
+		Add("Status", s.Status).
+		Add("StartType", s.StartType).
+		Add("DisplayName", s.DisplayName).
+		Add("ServiceName", s.Name).
+		Add("CanStop", s.Status == "Running").
+		Add("MachineName", ".")
+	obj.ToStringFunc = func(*PSObject) string {
+		return "System.ServiceProcess.ServiceController"
+	}
+	name := s.Name
+	obj.AddMethod("Start", func(args []interface{}) (interface{}, error) {
+		svc := rs.services.Get(name)
+		if svc == nil || svc.StartType == "Disabled" {
+			return nil, fmt.Errorf("Exception calling \"Start\" with \"0\" argument(s): \"Cannot start service %s on computer '.'.\"", name)
+		}
+		svc.Status = "Running"
+		return nil, nil
+	})
+	obj.AddMethod("Stop", func(args []interface{}) (interface{}, error) {
+		if svc := rs.services.Get(name); svc != nil {
+			svc.Status = "Stopped"
+		}
+		return nil, nil
+	})
+	obj.AddMethod("Refresh", func(args []interface{}) (interface{}, error) {
+		if svc := rs.services.Get(name); svc != nil {
+			obj.Add("Status", svc.Status)
+			obj.Add("StartType", svc.StartType)
+			obj.Add("CanStop", svc.Status == "Running")
+		}
+		return nil, nil
+	})
+	return obj
+}
+
+// serviceParams are the ways Start-, Stop-, Restart- and Set-Service take the services they change
+func serviceParams(extra ...*Parameter) []*Parameter {
+	return append([]*Parameter{
+		{Name: "Name", Aliases: []string{"ServiceName"}, Position: 1, Mandatory: true, Sets: []string{"Default"}, ValueFromPipelineByPropertyName: true},
+		{Name: "DisplayName", Mandatory: true, Sets: []string{"DisplayName"}},
+		{Name: "InputObject", Mandatory: true, Sets: []string{"InputObject"}, ValueFromPipeline: true},
+		{Name: "PassThru", Switch: true},
+	}, extra...)
+}
+
+// findServices resolves the -Name, -DisplayName or -InputObject of a call to table entries
+func findServices(c *Call) ([]*Service, error) {
+	rs := c.Runspace
+	var found []*Service
+	switch {
+	case c.Has("InputObject"):
+		for _, item := range asList(c.Get("InputObject")) {
+			v, err := rs.getMember(item, "ServiceName")
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, c.Errorf("The input object cannot be bound to any parameters for the command either because the command does not take pipeline input or the input and its properties do not match any of the parameters that take pipeline input.")
+			}
+			if s := rs.services.Get(toString(v)); s != nil {
+				found = append(found, s)
+			} else {
+				c.WriteError(c.Errorf("Cannot find any service with service name '%s'.", toString(v)))
+			}
+		}
+	case c.Has("DisplayName"):
+		for _, pattern := range c.Strings("DisplayName") {
+			matched := false
+			for _, s := range rs.services.List() {
+				if MatchWildcard(pattern, s.DisplayName, false) {
+					found = append(found, s)
+					matched = true
+				}
+			}
+			if !matched && !HasWildcard(pattern) {
+				c.WriteError(c.Errorf("Cannot find any service with display name '%s'.", pattern))
+			}
+		}
+	default:
+		for _, pattern := range c.Strings("Name") {
+			matched := false
+			for _, s := range rs.services.List() {
+				if MatchWildcard(pattern, s.Name, false) {
+					found = append(found, s)
+					matched = true
+				}
+			}
+			if !matched && !HasWildcard(pattern) {
+				c.WriteError(c.Errorf("Cannot find any service with service name '%s'.", pattern))
+			}
+		}
+	}
+	return found, nil
+}
+
+func getServiceCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Get-Service",
+		DefaultSet: "Default",
+		Params: []*Parameter{
+			{Name: "Name", Aliases: []string{"ServiceName"}, Position: 1, Sets: []string{"Default"}, ValueFromPipelineByPropertyName: true},
+			{Name: "DisplayName", Mandatory: true, Sets: []string{"DisplayName"}},
+		},
+		Process: func(c *Call) error {
+			if !c.Has("Name") && !c.Has("DisplayName") {
+				for _, s := range c.Runspace.services.List() {
+					if err := c.Emit(c.Runspace.serviceObject(s)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			found, err := findServices(c)
+			if err != nil {
+				return err
+			}
+			for _, s := range found {
+				if err := c.Emit(c.Runspace.serviceObject(s)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// serviceTarget is how ShouldProcess and errors name a service
+func serviceTarget(s *Service) string {
+	return fmt.Sprintf("%s (%s)", s.DisplayName, s.Name)
+}
+
+// changeServiceCmdlet builds Start-, Stop- and Restart-Service, which run
+// change on every service they are given
+func changeServiceCmdlet(name string, change func(c *Call, s *Service) error, extra ...*Parameter) *Cmdlet {
+	return &Cmdlet{
+		Name:       name,
+		DefaultSet: "Default",
+		Params:     serviceParams(extra...),
+		Process: func(c *Call) error {
+			found, err := findServices(c)
+			if err != nil {
+				return err
+			}
+			for _, s := range found {
+				if !c.ShouldProcess(serviceTarget(s), name) {
+					continue
+				}
+				if err := change(c, s); err != nil {
+					c.WriteError(err)
+					continue
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(c.Runspace.serviceObject(s)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func startService(c *Call, s *Service) error {
+	if s.StartType == "Disabled" {
+		return c.Errorf("Service '%s' cannot be started due to the following error: Cannot start service %s on computer '.'.", serviceTarget(s), s.Name)
+	}
+	s.Status = "Running"
+	return nil
+}
+
+func startServiceCmdlet() *Cmdlet {
+	return changeServiceCmdlet("Start-Service", startService)
+}
+
+func stopServiceCmdlet() *Cmdlet {
+	return changeServiceCmdlet("Stop-Service", func(c *Call, s *Service) error {
+		s.Status = "Stopped"
+		return nil
+	}, &Parameter{Name: "Force", Switch: true}, &Parameter{Name: "NoWait", Switch: true})
+}
+
+func restartServiceCmdlet() *Cmdlet {
+	return changeServiceCmdlet("Restart-Service", startService, &Parameter{Name: "Force", Switch: true})
+}
+
+// serviceStartupTypes are the values Set-Service -StartupType accepts
+var serviceStartupTypes = []string{"Automatic", "AutomaticDelayedStart", "Disabled", "Manual"}
+
+func setServiceCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:       "Set-Service",
+		DefaultSet: "Default",
+		Params: []*Parameter{
+			{Name: "Name", Aliases: []string{"ServiceName", "SN"}, Position: 1, Mandatory: true, Sets: []string{"Default"}, ValueFromPipelineByPropertyName: true},
+			{Name: "InputObject", Mandatory: true, Sets: []string{"InputObject"}, ValueFromPipeline: true},
+			{Name: "DisplayName", Aliases: []string{"DN"}},
+			{Name: "StartupType", Aliases: []string{"StartMode", "SM", "ST", "StartType"}},
+			{Name: "Status"},
+			{Name: "PassThru", Switch: true},
+			{Name: "Force", Switch: true},
+		},
+		Process: func(c *Call) error {
+			startType := ""
+			if c.Has("StartupType") {
+				for _, t := range serviceStartupTypes {
+					if strings.EqualFold(t, c.String("StartupType")) {
+						startType = t
+					}
+				}
+				if startType == "" {
+					return c.Errorf("Cannot bind parameter 'StartupType'. Cannot convert value \"%s\" to type \"Microsoft.PowerShell.Commands.ServiceStartupType\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again: %s\"", c.String("StartupType"), c.String("StartupType"), strings.Join(serviceStartupTypes, ", "))
+				}
+				if startType == "AutomaticDelayedStart" {
+					startType = "Automatic"
+				}
+			}
+			status := ""
+			if c.Has("Status") {
+				for _, s := range []string{"Running", "Stopped"} {
+					if strings.EqualFold(s, c.String("Status")) {
+						status = s
+					}
+				}
+				if status == "" {
+					return c.Errorf("Cannot bind parameter 'Status'. Cannot convert value \"%s\" to type \"System.ServiceProcess.ServiceControllerStatus\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again: Running, Stopped\"", c.String("Status"), c.String("Status"))
+				}
+			}
+			rs := c.Runspace
+			var found []*Service
+			if c.Has("InputObject") {
+				var err error
+				if found, err = findServices(c); err != nil {
+					return err
+				}
+			} else {
+				name := c.String("Name")
+				s := rs.services.Get(name)
+				if s == nil {
+					return c.Errorf("Service '%s' was not found on computer '.'.", name)
+				}
+				found = []*Service{s}
+			}
+			for _, s := range found {
+				if !c.ShouldProcess(serviceTarget(s), "Set-Service") {
+					continue
+				}
+				if startType != "" {
+					s.StartType = startType
+				}
+				if c.Has("DisplayName") {
+					s.DisplayName = c.String("DisplayName")
+				}
+				switch status {
+				case "Running":
+					if err := startService(c, s); err != nil {
+						c.WriteError(err)
+						continue
+					}
+				case "Stopped":
+					s.Status = "Stopped"
+				}
+				if c.Switch("PassThru") {
+					if err := c.Emit(rs.serviceObject(s)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
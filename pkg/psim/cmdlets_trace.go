@@ -0,0 +1,62 @@
+package psim
+
+import "strings"
+
+// traceCommandCmdlet runs a script block while tracing what happens inside
+// it. Parameter binding is the only trace source the simulation knows, so
+// other sources produce no output.
+func traceCommandCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name: "Trace-Command",
+		Params: []*Parameter{
+			{Name: "Name", Position: 1, Mandatory: true},
+			{Name: "Expression", Position: 2, Mandatory: true},
+			{Name: "Option"},
+			{Name: "FilePath", Aliases: []string{"PSPath"}},
+			{Name: "ListenerOption"},
+			{Name: "PSHost", Switch: true},
+			{Name: "Force", Switch: true},
+		},
+		End: func(c *Call) error {
+			rs := c.Runspace
+			sb, err := c.ScriptBlock("Expression")
+			if err != nil {
+				return err
+			}
+			traced := false
+			for _, name := range c.Strings("Name") {
+				traced = traced || MatchWildcard(name, "ParameterBinding", false)
+			}
+			var lines []string
+			previous := rs.tracer
+			if traced && (c.Switch("PSHost") || c.Has("FilePath")) {
+				rs.tracer = func(line string) {
+					line = "ParameterBinding Information: 0 : " + line
+					if c.Switch("PSHost") {
+						rs.writeStream(StreamDebug, line)
+					}
+					lines = append(lines, line)
+				}
+			}
+			err = rs.invokeBlock(sb, invocation{}, c.emit)
+			rs.tracer = previous
+			if c.Has("FilePath") {
+				full, ferr := rs.resolvePath(c.String("FilePath"))
+				if ferr != nil {
+					return c.Errorf("%s", ferr.Error())
+				}
+				if !rs.fs.IsDir(parentPath(full)) {
+					return c.Errorf("Could not find a part of the path '%s'.", full)
+				}
+				content := strings.Join(lines, "\n")
+				if len(lines) > 0 {
+					content += "\n"
+				}
+				if _, ferr := rs.fs.writeFile(full, content, rs.fs.clock()); ferr != nil {
+					return c.Errorf("%s", ferr.Error())
+				}
+			}
+			return err
+		},
+	}
+}
@@ -0,0 +1,267 @@
+package psim
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/graph"
+)
+
+// webClient sends requests to the runspace's loopback services; it never
+// goes through a proxy because nothing it talks to is on the network
+var webClient = &http.Client{
+	Transport: &http.Transport{Proxy: nil},
+	Timeout:   10 * time.Second,
+}
+
+// webMethods are the values -Method accepts
+var webMethods = []string{"Default", "Get", "Head", "Post", "Put", "Delete", "Trace", "Options", "Merge", "Patch"}
+
+// webResponse is a completed HTTP exchange
+type webResponse struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+// statusText is the status line a failed request reports, e.g. "404 (Not Found)"
+func (r *webResponse) statusText() string {
+	return fmt.Sprintf("%d (%s)", r.status, http.StatusText(r.status))
+}
+
+// graphURL starts the runspace's Graph service on first use and returns its base URL
+func (rs *Runspace) graphURL() (string, error) {
+	if rs.graphServer == nil {
+		srv := graph.NewServer(rs.tenant)
+		if err := srv.Start(); err != nil {
+			return "", err
+		}
+		rs.graphServer = srv
+	}
+	return rs.graphServer.URL(), nil
+}
+
+// routeURL maps a public URL onto the loopback service that answers it.
+// Only the simulated services are reachable; any other host fails the way
+// an offline machine would.
+func (rs *Runspace) routeURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("Invalid URI: The format of the URI could not be determined.")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("The '%s' scheme is not supported.", u.Scheme)
+	}
+	if !strings.EqualFold(u.Hostname(), "graph.microsoft.com") {
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+		}
+		return nil, fmt.Errorf("No such host is known. (%s:%s)", u.Hostname(), port)
+	}
+	base, err := rs.graphURL()
+	if err != nil {
+		return nil, err
+	}
+	local, _ := url.Parse(base)
+	routed := *u
+	routed.Scheme, routed.Host = local.Scheme, local.Host
+	routed.RawQuery = escapeQuery(u.RawQuery)
+	return &routed, nil
+}
+
+// escapeQuery percent-encodes the characters System.Uri escapes in a query
+// string, such as the spaces in a $filter, and leaves the rest as typed
+func escapeQuery(q string) string {
+	var sb strings.Builder
+	for i := 0; i < len(q); i++ {
+		b := q[i]
+		if b <= ' ' || b >= 0x7f || strings.IndexByte("\"<>\\^`{|}", b) >= 0 {
+			fmt.Fprintf(&sb, "%%%02X", b)
+			continue
+		}
+		sb.WriteByte(b)
+	}
+	return sb.String()
+}
+
+// sendWebRequest performs one HTTP request against a routed URL
+func (rs *Runspace) sendWebRequest(method, uri string, headers *Hashtable, body []byte, contentType string) (*webResponse, error) {
+	u, err := rs.routeURL(uri)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if headers != nil {
+		for _, k := range headers.Keys() {
+			v, _ := headers.Get(k)
+			req.Header.Set(toString(k), toString(v))
+		}
+	}
+	resp, err := webClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("No connection could be made because the target machine actively refused it. (%s)", u.Host)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &webResponse{status: resp.StatusCode, headers: resp.Header, body: data}, nil
+}
+
+// webRequest binds the parameters Invoke-RestMethod and Invoke-WebRequest
+// share and sends the request. A hashtable body is sent as query parameters
+// for GET and as a form for other methods, as PowerShell does.
+func webRequest(c *Call) (*webResponse, error) {
+	method := "Get"
+	if c.Has("Method") {
+		method = ""
+		for _, m := range webMethods {
+			if strings.EqualFold(m, c.String("Method")) {
+				method = m
+			}
+		}
+		if method == "" {
+			return nil, c.Errorf("Cannot bind parameter 'Method'. Cannot convert value \"%s\" to type \"Microsoft.PowerShell.Commands.WebRequestMethod\". Error: \"Unable to match the identifier name %s to a valid enumerator name. Specify one of the following enumerator names and try again:\n%s\"", c.String("Method"), c.String("Method"), strings.Join(webMethods, ", "))
+		}
+		if method == "Default" {
+			method = "Get"
+		}
+	}
+	uri := c.String("Uri")
+	if uri == "" {
+		return nil, c.Errorf("Cannot validate argument on parameter 'Uri'. The argument is null or empty. Provide an argument that is not null or empty, and then try the command again.")
+	}
+	var headers *Hashtable
+	if c.Has("Headers") {
+		h, ok := c.Get("Headers").(*Hashtable)
+		if !ok {
+			return nil, c.Errorf("Cannot bind parameter 'Headers'. Cannot convert the \"%s\" value of type \"%s\" to type \"System.Collections.IDictionary\".", c.String("Headers"), typeName(c.Get("Headers")))
+		}
+		headers = h
+	}
+	contentType := c.String("ContentType")
+	var body []byte
+	switch b := c.Get("Body").(type) {
+	case nil:
+	case *Hashtable:
+		form := url.Values{}
+		for _, k := range b.Keys() {
+			v, _ := b.Get(k)
+			form.Add(toString(k), toString(v))
+		}
+		if method == "Get" {
+			sep := "?"
+			if strings.Contains(uri, "?") {
+				sep = "&"
+			}
+			uri += sep + form.Encode()
+		} else {
+			body = []byte(form.Encode())
+			if contentType == "" {
+				contentType = "application/x-www-form-urlencoded"
+			}
+		}
+	default:
+		body = []byte(toString(b))
+	}
+	resp, err := c.Runspace.sendWebRequest(method, uri, headers, body, contentType)
+	if err != nil {
+		return nil, c.Errorf("%s", err.Error())
+	}
+	if resp.status >= 400 {
+		if len(resp.body) == 0 {
+			return nil, c.Errorf("Response status code does not indicate success: %s.", resp.statusText())
+		}
+		return nil, c.Errorf("%s", strings.TrimSpace(string(resp.body)))
+	}
+	return resp, nil
+}
+
+// webParams are the parameters Invoke-RestMethod and Invoke-WebRequest share
+func webParams() []*Parameter {
+	return []*Parameter{
+		{Name: "Uri", Aliases: []string{"Url"}, Position: 1, Mandatory: true},
+		{Name: "Method"},
+		{Name: "Headers"},
+		{Name: "Body"},
+		{Name: "ContentType"},
+		{Name: "UseBasicParsing", Switch: true},
+		{Name: "TimeoutSec"},
+	}
+}
+
+func invokeRestMethodCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Invoke-RestMethod",
+		Params: webParams(),
+		Process: func(c *Call) error {
+			resp, err := webRequest(c)
+			if err != nil {
+				return err
+			}
+			text := string(resp.body)
+			if !strings.Contains(resp.headers.Get("Content-Type"), "json") {
+				return c.Emit(text)
+			}
+			if strings.TrimSpace(text) == "" {
+				return nil
+			}
+			v, err := decodeJSON(text)
+			if err != nil {
+				return c.Emit(text)
+			}
+			return c.EmitAll(v)
+		},
+	}
+}
+
+func invokeWebRequestCmdlet() *Cmdlet {
+	return &Cmdlet{
+		Name:   "Invoke-WebRequest",
+		Params: webParams(),
+		Process: func(c *Call) error {
+			resp, err := webRequest(c)
+			if err != nil {
+				return err
+			}
+			headers := NewHashtable()
+			var raw strings.Builder
+			fmt.Fprintf(&raw, "HTTP/1.1 %d %s\r\n", resp.status, http.StatusText(resp.status))
+			for _, k := range []string{"Content-Type", "Date", "Content-Length"} {
+				if v := resp.headers.Get(k); v != "" {
+					headers.Set(k, v)
+					fmt.Fprintf(&raw, "%s: %s\r\n", k, v)
+				}
+			}
+			raw.WriteString("\r\n")
+			raw.Write(resp.body)
+			content := string(resp.body)
+			o := NewObject("Microsoft.PowerShell.Commands.BasicHtmlWebResponseObject", "Microsoft.PowerShell.Commands.WebResponseObject")
+			o.Add("StatusCode", resp.status)
+			o.Add("StatusDescription", http.StatusText(resp.status))
+			o.Add("Content", content)
+			o.Add("RawContent", raw.String())
+			o.Add("Headers", headers)
+			o.Add("RawContentLength", len(resp.body))
+			o.ToStringFunc = func(*PSObject) string { return content }
+			return c.Emit(o)
+		},
+	}
+}
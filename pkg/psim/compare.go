@@ -0,0 +1,194 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// compareDepth is how deep CompareOutput looks into nested property values
+const compareDepth = 4
+
+// Difference is one place where two outputs disagree
+type Difference struct {
+	Path string // where the values differ, such as [0].Name
+	Want string // the expected value, as PowerShell would show it
+	Got  string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", d.Path, d.Want, d.Got)
+}
+
+// CompareOutput compares the objects a script wrote with the objects it
+// should have written. Objects match when their properties hold the same
+// values; custom objects match whichever way they were built, so a
+// [PSCustomObject] can stand in for the output of Select-Object. Strings
+// are compared case-sensitively and numbers by value.
+func CompareOutput(want, got []interface{}) []Difference {
+	var diffs []Difference
+	if len(want) != len(got) {
+		diffs = append(diffs, Difference{Path: "Count", Want: fmt.Sprint(len(want)), Got: fmt.Sprint(len(got))})
+	}
+	for i := 0; i < len(want) && i < len(got); i++ {
+		diffs = compareValue(diffs, fmt.Sprintf("[%d]", i), want[i], got[i], compareDepth)
+	}
+	return diffs
+}
+
+// ValuesMatch reports whether got matches want by the rules of CompareOutput
+func ValuesMatch(want, got interface{}) bool {
+	return len(compareValue(nil, "", want, got, compareDepth)) == 0
+}
+
+func compareValue(diffs []Difference, path string, want, got interface{}, depth int) []Difference {
+	differ := func() []Difference {
+		return append(diffs, Difference{Path: path, Want: Literal(want), Got: Literal(got)})
+	}
+	wantProps, wantIsObject := comparableProperties(want)
+	gotProps, gotIsObject := comparableProperties(got)
+	switch {
+	case wantIsObject || gotIsObject:
+		if !wantIsObject || !gotIsObject {
+			return differ()
+		}
+		if wt, gt := comparedTypeName(want), comparedTypeName(got); wt != gt {
+			return append(diffs, Difference{Path: path + ".GetType()", Want: wt, Got: gt})
+		}
+		if depth == 0 {
+			if toString(want) != toString(got) {
+				return differ()
+			}
+			return diffs
+		}
+		for _, p := range wantProps {
+			value, ok := findProperty(gotProps, p.name)
+			if !ok {
+				diffs = append(diffs, Difference{Path: path + "." + p.name, Want: Literal(p.value), Got: "no such property"})
+				continue
+			}
+			diffs = compareValue(diffs, path+"."+p.name, p.value, value, depth-1)
+		}
+		for _, p := range gotProps {
+			if _, ok := findProperty(wantProps, p.name); !ok {
+				diffs = append(diffs, Difference{Path: path + "." + p.name, Want: "no such property", Got: Literal(p.value)})
+			}
+		}
+		return diffs
+	}
+	if w, ok := want.([]interface{}); ok {
+		g, ok := got.([]interface{})
+		if !ok {
+			return differ()
+		}
+		if len(w) != len(g) {
+			diffs = append(diffs, Difference{Path: path + ".Count", Want: fmt.Sprint(len(w)), Got: fmt.Sprint(len(g))})
+		}
+		for i := 0; i < len(w) && i < len(g); i++ {
+			diffs = compareValue(diffs, fmt.Sprintf("%s[%d]", path, i), w[i], g[i], depth)
+		}
+		return diffs
+	}
+	if !scalarsEqual(want, got) {
+		return differ()
+	}
+	return diffs
+}
+
+// scalarsEqual compares two values that have no properties to look into
+func scalarsEqual(want, got interface{}) bool {
+	switch w := want.(type) {
+	case nil:
+		return got == nil
+	case int, float64:
+		if !isNumber(got) {
+			return false
+		}
+		wf, _ := toFloat(w)
+		gf, _ := toFloat(got)
+		return wf == gf
+	case time.Time:
+		g, ok := got.(time.Time)
+		return ok && w.Equal(g)
+	}
+	return typeName(want) == typeName(got) && toString(want) == toString(got)
+}
+
+type namedValue struct {
+	name  string
+	value interface{}
+}
+
+// comparableProperties lists the properties CompareOutput compares; ok is
+// false for values it compares as a whole
+func comparableProperties(v interface{}) (props []namedValue, ok bool) {
+	switch x := v.(type) {
+	case *Hashtable:
+		for _, k := range x.Keys() {
+			value, _ := x.Get(k)
+			props = append(props, namedValue{toString(k), value})
+		}
+		return props, true
+	case *PSObject:
+		if len(x.Properties()) == 0 {
+			return nil, false
+		}
+		for _, p := range x.Properties() {
+			props = append(props, namedValue{p.Name, p.Current()})
+		}
+		return props, true
+	}
+	return nil, false
+}
+
+func findProperty(props []namedValue, name string) (interface{}, bool) {
+	for _, p := range props {
+		if strings.EqualFold(p.name, name) {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+// comparedTypeName is the type two objects must share. Custom objects all
+// count as one type, however they were made.
+func comparedTypeName(v interface{}) string {
+	if o, ok := v.(*PSObject); ok {
+		if o.IsA("System.Management.Automation.PSCustomObject") {
+			return "System.Management.Automation.PSCustomObject"
+		}
+		return o.TypeName()
+	}
+	return typeName(v)
+}
+
+// displayValue shows a value in a difference the way it would be written
+// in PowerShell
+func Literal(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "$null"
+	case string:
+		return "'" + strings.ReplaceAll(x, "'", "''") + "'"
+	case bool:
+		return "$" + toString(x)
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, item := range x {
+			parts[i] = Literal(item)
+		}
+		return "@(" + strings.Join(parts, ", ") + ")"
+	case *PSObject:
+		if x.ToStringFunc != nil {
+			return toString(x)
+		}
+	}
+	if props, ok := comparableProperties(v); ok {
+		parts := make([]string, len(props))
+		for i, p := range props {
+			parts[i] = p.name + "=" + toString(p.value)
+		}
+		return "@{" + strings.Join(parts, "; ") + "}"
+	}
+	return toString(v)
+}
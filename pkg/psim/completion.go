@@ -0,0 +1,147 @@
+package psim
+
+import (
+	"sort"
+	"strings"
+)
+
+// Complete returns what the word ending at offset of a line being typed can
+// be completed to, the way Tab completes it in a console: the names of
+// commands at the start of a statement, the parameters of the command
+// being typed after a dash, variables after a dollar sign and otherwise
+// paths. start is the offset of the word the matches replace.
+func (rs *Runspace) Complete(line string, offset int) (start int, matches []string) {
+	if offset > len(line) {
+		offset = len(line)
+	}
+	start = offset
+	for start > 0 && !isSpace(line[start-1]) && !strings.ContainsRune("|;(){}=,\n", rune(line[start-1])) {
+		start--
+	}
+	word := line[start:offset]
+
+	switch {
+	case strings.HasPrefix(word, "$"):
+		matches = rs.completeVariables(word[1:])
+	case strings.HasPrefix(word, "-") && start > 0:
+		matches = rs.completeParameters(CommandAt(line, start), word[1:])
+	case commandPosition(line[:start]) && !strings.ContainsAny(word, `\/:`) && !strings.HasPrefix(word, "."):
+		matches = rs.completeCommands(word)
+	default:
+		matches = rs.completePaths(word)
+	}
+	return start, matches
+}
+
+// commandPosition reports whether a word after the given text starts a
+// statement, where a command name goes
+func commandPosition(before string) bool {
+	before = strings.TrimRight(before, " \t")
+	before = strings.TrimSuffix(before, "&")
+	before = strings.TrimRight(before, " \t")
+	return before == "" || strings.ContainsRune("|;({\n", rune(before[len(before)-1]))
+}
+
+// completeVariables returns the variables in scope whose names start with prefix
+func (rs *Runspace) completeVariables(prefix string) []string {
+	seen := map[string]bool{}
+	var matches []string
+	for sc := rs.scope; sc != nil; sc = sc.parent {
+		for key, v := range sc.vars {
+			if !seen[key] && hasPrefixFold(v.Name, prefix) {
+				seen[key] = true
+				matches = append(matches, "$"+v.Name)
+			}
+		}
+	}
+	sortFold(matches)
+	return matches
+}
+
+// completeParameters returns a command's parameters whose names start with
+// prefix, in the order the command declares them
+func (rs *Runspace) completeParameters(command, prefix string) []string {
+	c, ok := rs.resolveCommand(command)
+	if !ok {
+		return nil
+	}
+	var matches []string
+	for _, p := range c.Params {
+		if hasPrefixFold(p.Name, prefix) {
+			matches = append(matches, "-"+p.Name)
+		}
+	}
+	return matches
+}
+
+// completeCommands returns the commands, functions and aliases whose names
+// start with prefix
+func (rs *Runspace) completeCommands(prefix string) []string {
+	var matches []string
+	for _, c := range rs.visibleCommands() {
+		if hasPrefixFold(c.Name, prefix) {
+			matches = append(matches, c.Name)
+		}
+	}
+	sortFold(matches)
+	// Aliases come after the commands, as they do in PowerShell
+	var aliases []string
+	for alias := range rs.aliases {
+		if hasPrefixFold(alias, prefix) && prefix != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	sortFold(aliases)
+	return append(matches, aliases...)
+}
+
+// completePaths returns the files and directories whose paths start with
+// the word typed, keeping the part of the path already typed as it is
+func (rs *Runspace) completePaths(word string) []string {
+	quote := ""
+	if strings.HasPrefix(word, "'") || strings.HasPrefix(word, `"`) {
+		quote, word = word[:1], word[1:]
+	}
+	dir, name := "", word
+	if i := strings.LastIndexAny(word, `\/`); i >= 0 {
+		dir, name = word[:i+1], word[i+1:]
+	}
+	full, err := rs.resolvePath(dir)
+	if err != nil {
+		return nil
+	}
+	children, err := rs.fs.List(full)
+	if err != nil {
+		return nil
+	}
+	var matches []string
+	for _, child := range children {
+		base := child[strings.LastIndex(child, `\`)+1:]
+		if !hasPrefixFold(base, name) {
+			continue
+		}
+		path := dir + base
+		if dir == "" {
+			path = `.\` + base
+		}
+		if q := quote; q != "" || strings.ContainsAny(path, " '") {
+			if q == "" {
+				q = "'"
+			}
+			path = q + path + q
+		}
+		matches = append(matches, path)
+	}
+	sortFold(matches)
+	return matches
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func sortFold(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+}
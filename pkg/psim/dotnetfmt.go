@@ -0,0 +1,404 @@
+package psim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatOperator implements -f using .NET composite formatting: "{0,-10:N2}"
+func formatOperator(format string, args []interface{}) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch c {
+		case '{':
+			if i+1 < len(format) && format[i+1] == '{' {
+				b.WriteByte('{')
+				i++
+				continue
+			}
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("Error formatting a string: Input string was not in a correct format..")
+			}
+			item := format[i+1 : i+end]
+			i += end
+			spec := ""
+			if j := strings.IndexByte(item, ':'); j >= 0 {
+				item, spec = item[:j], item[j+1:]
+			}
+			align := 0
+			if j := strings.IndexByte(item, ','); j >= 0 {
+				n, err := strconv.Atoi(strings.TrimSpace(item[j+1:]))
+				if err != nil {
+					return "", fmt.Errorf("Error formatting a string: Input string was not in a correct format..")
+				}
+				item, align = item[:j], n
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return "", fmt.Errorf("Error formatting a string: Input string was not in a correct format..")
+			}
+			if index < 0 || index >= len(args) {
+				return "", fmt.Errorf("Error formatting a string: Index (zero based) must be greater than or equal to zero and less than the size of the argument list..")
+			}
+			s, err := formatValue(args[index], spec)
+			if err != nil {
+				return "", err
+			}
+			if pad := abs(align) - len([]rune(s)); pad > 0 {
+				if align > 0 {
+					s = strings.Repeat(" ", pad) + s
+				} else {
+					s += strings.Repeat(" ", pad)
+				}
+			}
+			b.WriteString(s)
+		case '}':
+			if i+1 < len(format) && format[i+1] == '}' {
+				i++
+			}
+			b.WriteByte('}')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// formatValue formats a single value with a .NET format string such as N2, X4 or yyyy-MM-dd
+func formatValue(v interface{}, spec string) (string, error) {
+	if spec == "" {
+		return toString(v), nil
+	}
+	switch x := v.(type) {
+	case int, float64:
+		return formatNumber(x, spec)
+	case time.Time:
+		return formatDate(x, spec), nil
+	}
+	return toString(v), nil
+}
+
+func formatNumber(v interface{}, spec string) (string, error) {
+	f, _ := toFloat(v)
+	_, isInt := v.(int)
+	letter := spec[0]
+	precision := -1
+	if len(spec) > 1 {
+		n, err := strconv.Atoi(spec[1:])
+		if err != nil {
+			return formatCustomNumber(f, spec), nil
+		}
+		precision = n
+	}
+	prec := func(def int) int {
+		if precision < 0 {
+			return def
+		}
+		return precision
+	}
+	switch letter {
+	case 'N', 'n':
+		return groupThousands(strconv.FormatFloat(roundAway(f, prec(2)), 'f', prec(2), 64)), nil
+	case 'F', 'f':
+		return strconv.FormatFloat(roundAway(f, prec(2)), 'f', prec(2), 64), nil
+	case 'C', 'c':
+		s := groupThousands(strconv.FormatFloat(math.Abs(roundAway(f, prec(2))), 'f', prec(2), 64))
+		if f < 0 {
+			return "-$" + s, nil
+		}
+		return "$" + s, nil
+	case 'P', 'p':
+		return groupThousands(strconv.FormatFloat(roundAway(f*100, prec(2)), 'f', prec(2), 64)) + "%", nil
+	case 'D', 'd':
+		if !isInt {
+			return "", fmt.Errorf("Error formatting a string: Format specifier was invalid..")
+		}
+		n := v.(int)
+		s := strconv.Itoa(abs(n))
+		for len(s) < precision {
+			s = "0" + s
+		}
+		if n < 0 {
+			s = "-" + s
+		}
+		return s, nil
+	case 'X', 'x':
+		if !isInt {
+			return "", fmt.Errorf("Error formatting a string: Format specifier was invalid..")
+		}
+		s := strconv.FormatUint(uint64(uint32(v.(int))), 16)
+		if v.(int) > math.MaxUint32 || v.(int) < math.MinInt32 {
+			s = strconv.FormatUint(uint64(v.(int)), 16)
+		}
+		for len(s) < precision {
+			s = "0" + s
+		}
+		if letter == 'X' {
+			s = strings.ToUpper(s)
+		}
+		return s, nil
+	case 'E', 'e':
+		s := strconv.FormatFloat(f, 'e', prec(6), 64)
+		mant, exp, _ := strings.Cut(s, "e")
+		sign := exp[0]
+		digits := exp[1:]
+		for len(digits) < 3 {
+			digits = "0" + digits
+		}
+		return mant + string(letter) + string(sign) + digits, nil
+	case 'G', 'g', 'R', 'r':
+		if precision > 0 && !isInt {
+			return strconv.FormatFloat(f, 'g', precision, 64), nil
+		}
+		return toString(v), nil
+	}
+	return formatCustomNumber(f, spec), nil
+}
+
+// roundAway rounds half away from zero, as .NET numeric format strings do
+func roundAway(f float64, digits int) float64 {
+	scale := math.Pow(10, float64(digits))
+	return math.Round(f*scale) / scale
+}
+
+func groupThousands(s string) string {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	out := b.String()
+	if hasFrac {
+		out += "." + frac
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// formatCustomNumber handles custom numeric formats such as 0.00, #,##0 and 0%
+func formatCustomNumber(f float64, spec string) string {
+	if i := strings.IndexByte(spec, ';'); i >= 0 {
+		spec = spec[:i]
+	}
+	first := strings.IndexAny(spec, "0#")
+	last := strings.LastIndexAny(spec, "0#")
+	if first < 0 {
+		return spec
+	}
+	prefix, pattern, suffix := spec[:first], spec[first:last+1], spec[last+1:]
+	if strings.Contains(prefix+suffix, "%") {
+		f *= 100
+	}
+	intPat, fracPat, _ := strings.Cut(pattern, ".")
+	grouping := strings.Contains(intPat, ",")
+	minInt := strings.Count(intPat, "0")
+	minFrac := strings.Count(fracPat, "0")
+	maxFrac := minFrac + strings.Count(fracPat, "#")
+
+	s := strconv.FormatFloat(math.Abs(roundAway(f, maxFrac)), 'f', maxFrac, 64)
+	intDigits, fracDigits, _ := strings.Cut(s, ".")
+	for len(fracDigits) > minFrac && strings.HasSuffix(fracDigits, "0") {
+		fracDigits = fracDigits[:len(fracDigits)-1]
+	}
+	intDigits = strings.TrimLeft(intDigits, "0")
+	for len(intDigits) < minInt {
+		intDigits = "0" + intDigits
+	}
+	if grouping {
+		intDigits = groupThousands(intDigits)
+	}
+	out := intDigits
+	if fracDigits != "" {
+		out += "." + fracDigits
+	}
+	if f < 0 && strings.Trim(out, "0.,") != "" {
+		out = "-" + out
+	}
+	return unquoteFormatLiteral(prefix) + out + unquoteFormatLiteral(suffix)
+}
+
+func unquoteFormatLiteral(s string) string {
+	return strings.NewReplacer("'", "", `"`, "", `\`, "").Replace(s)
+}
+
+var standardDateFormats = map[string]string{
+	"d": "M/d/yyyy",
+	"D": "dddd, MMMM d, yyyy",
+	"t": "h:mm tt",
+	"T": "h:mm:ss tt",
+	"f": "dddd, MMMM d, yyyy h:mm tt",
+	"F": "dddd, MMMM d, yyyy h:mm:ss tt",
+	"g": "M/d/yyyy h:mm tt",
+	"G": "M/d/yyyy h:mm:ss tt",
+	"s": "yyyy-MM-ddTHH:mm:ss",
+	"u": "yyyy-MM-dd HH:mm:ssZ",
+	"o": "yyyy-MM-ddTHH:mm:ss.fffffffK",
+	"O": "yyyy-MM-ddTHH:mm:ss.fffffffK",
+	"M": "MMMM d",
+	"m": "MMMM d",
+	"y": "MMMM yyyy",
+	"Y": "MMMM yyyy",
+	"r": "ddd, dd MMM yyyy HH:mm:ss 'GMT'",
+	"R": "ddd, dd MMM yyyy HH:mm:ss 'GMT'",
+}
+
+// formatDate formats a time with a .NET standard or custom date format string
+func formatDate(t time.Time, spec string) string {
+	if std, ok := standardDateFormats[spec]; ok {
+		spec = std
+	}
+	var b strings.Builder
+	for i := 0; i < len(spec); {
+		c := spec[i]
+		n := 1
+		for i+n < len(spec) && spec[i+n] == c {
+			n++
+		}
+		switch c {
+		case 'y':
+			switch {
+			case n <= 2:
+				fmt.Fprintf(&b, "%0*d", n, t.Year()%100)
+			default:
+				fmt.Fprintf(&b, "%0*d", n, t.Year())
+			}
+		case 'M':
+			switch n {
+			case 1:
+				fmt.Fprintf(&b, "%d", t.Month())
+			case 2:
+				fmt.Fprintf(&b, "%02d", t.Month())
+			case 3:
+				b.WriteString(t.Month().String()[:3])
+			default:
+				b.WriteString(t.Month().String())
+			}
+		case 'd':
+			switch n {
+			case 1:
+				fmt.Fprintf(&b, "%d", t.Day())
+			case 2:
+				fmt.Fprintf(&b, "%02d", t.Day())
+			case 3:
+				b.WriteString(t.Weekday().String()[:3])
+			default:
+				b.WriteString(t.Weekday().String())
+			}
+		case 'H':
+			fmt.Fprintf(&b, "%0*d", min(n, 2), t.Hour())
+		case 'h':
+			h := t.Hour() % 12
+			if h == 0 {
+				h = 12
+			}
+			fmt.Fprintf(&b, "%0*d", min(n, 2), h)
+		case 'm':
+			fmt.Fprintf(&b, "%0*d", min(n, 2), t.Minute())
+		case 's':
+			fmt.Fprintf(&b, "%0*d", min(n, 2), t.Second())
+		case 'f', 'F':
+			digits := fmt.Sprintf("%09d", t.Nanosecond())
+			if n > 7 {
+				n = 7
+			}
+			part := digits[:n]
+			if c == 'F' {
+				part = strings.TrimRight(part, "0")
+			}
+			b.WriteString(part)
+		case 't':
+			ampm := "AM"
+			if t.Hour() >= 12 {
+				ampm = "PM"
+			}
+			if n == 1 {
+				ampm = ampm[:1]
+			}
+			b.WriteString(ampm)
+		case 'z':
+			_, offset := t.Zone()
+			sign := '+'
+			if offset < 0 {
+				sign, offset = '-', -offset
+			}
+			switch n {
+			case 1:
+				fmt.Fprintf(&b, "%c%d", sign, offset/3600)
+			case 2:
+				fmt.Fprintf(&b, "%c%02d", sign, offset/3600)
+			default:
+				fmt.Fprintf(&b, "%c%02d:%02d", sign, offset/3600, offset%3600/60)
+			}
+		case 'K':
+			b.WriteString(t.Format("-07:00"))
+		case '\'', '"':
+			end := strings.IndexByte(spec[i+1:], c)
+			if end < 0 {
+				b.WriteString(spec[i+1:])
+				return b.String()
+			}
+			b.WriteString(spec[i+1 : i+1+end])
+			i += end + 2
+			continue
+		case '\\':
+			if i+1 < len(spec) {
+				b.WriteByte(spec[i+1])
+			}
+			i += 2
+			continue
+		default:
+			b.WriteString(spec[i : i+n])
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// goDateLayout converts a .NET custom date format into a Go time layout for parsing
+func goDateLayout(spec string) string {
+	if std, ok := standardDateFormats[spec]; ok {
+		spec = std
+	}
+	replacer := []struct{ from, to string }{
+		{"yyyy", "2006"}, {"yy", "06"}, {"MMMM", "January"}, {"MMM", "Jan"},
+		{"MM", "01"}, {"M", "1"}, {"dddd", "Monday"}, {"ddd", "Mon"}, {"dd", "02"},
+		{"d", "2"}, {"HH", "15"}, {"H", "15"}, {"hh", "03"}, {"h", "3"}, {"mm", "04"},
+		{"m", "4"}, {"ss", "05"}, {"s", "5"}, {"tt", "PM"}, {"fff", "000"}, {"zzz", "-07:00"},
+	}
+	var b strings.Builder
+	for i := 0; i < len(spec); {
+		matched := false
+		for _, r := range replacer {
+			if strings.HasPrefix(spec[i:], r.from) {
+				b.WriteString(r.to)
+				i += len(r.from)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(spec[i])
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,485 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuntimeError is an error raised while a script runs. It is also the
+// script's ErrorRecord: $Error, $_ in a catch block and 2>&1 all see it.
+type RuntimeError struct {
+	Message string
+	Command string // command that raised the error, if any
+	Pos     Pos
+	Line    string // source line containing the error
+	Length  int    // length of the offending text, for the ~~~ underline
+	Script  string // script or module file the line is in; empty for typed input
+
+	// The ErrorRecord details. newError fills in the ones left empty from
+	// the message.
+	Category     string // ErrorCategory, e.g. ObjectNotFound
+	ErrorID      string // FullyQualifiedErrorId
+	Exception    string // full name of the .NET exception type
+	TargetObject interface{}
+
+	// Terminating marks a script-terminating error, from throw or an
+	// ErrorAction of Stop, that unwinds to the nearest try or trap
+	Terminating bool
+
+	activity  string    // cmdlet named in CategoryInfo
+	inner     string    // exception type the Exception wraps, e.g. System.DivideByZeroException
+	exception *PSObject // the Exception property, created on first use
+	record    *PSObject // the ErrorRecord properties, created on first use
+	recorded  bool      // already added to $Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+// Format renders the error the way the PowerShell console does
+func (e *RuntimeError) Format() string {
+	var b strings.Builder
+	if e.Command != "" {
+		b.WriteString(e.Command + " : ")
+	}
+	b.WriteString(e.Message)
+	if e.Pos.Line > 0 {
+		b.WriteString("\n" + e.positionMessage())
+	}
+	if e.Category != "" {
+		fmt.Fprintf(&b, "\n    + CategoryInfo          : %s", e.categoryText())
+		fmt.Fprintf(&b, "\n    + FullyQualifiedErrorId : %s", e.ErrorID)
+	}
+	return b.String()
+}
+
+// positionMessage shows where the error happened, with the offending text underlined
+func (e *RuntimeError) positionMessage() string {
+	if e.Pos.Line == 0 {
+		return ""
+	}
+	n := e.Length
+	if n < 1 {
+		n = 1
+	}
+	where := "line"
+	if e.Script != "" {
+		where = e.Script
+	}
+	return fmt.Sprintf("At %s:%d char:%d\n+ %s\n+ %s%s", where, e.Pos.Line, e.Pos.Column, e.Line,
+		strings.Repeat(" ", e.Pos.Column-1), strings.Repeat("~", n))
+}
+
+// categoryText is the CategoryInfo line, e.g.
+// ObjectNotFound: (C:\nope:String) [Get-Item], ItemNotFoundException
+func (e *RuntimeError) categoryText() string {
+	name, kind := "", ""
+	if e.TargetObject != nil {
+		name, kind = toString(e.TargetObject), shortTypeName(typeName(e.TargetObject))
+	}
+	return fmt.Sprintf("%s: (%s:%s) [%s], %s", e.Category, name, kind, e.activity, shortTypeName(e.Exception))
+}
+
+func parseErrorToRuntime(perr *ParseError) *RuntimeError {
+	return &RuntimeError{
+		Message: perr.Message,
+		Pos:     perr.Pos,
+		Line:    perr.Line,
+		Length:  1,
+	}
+}
+
+// errorAt attaches a source position to an error raised while evaluating node
+func (rs *Runspace) errorAt(node Node, err error) *RuntimeError {
+	if re, ok := err.(*RuntimeError); ok {
+		return re
+	}
+	return rs.newError(node, "", err.Error())
+}
+
+func (rs *Runspace) newError(node Node, command, message string) *RuntimeError {
+	e := &RuntimeError{Message: message, Command: command}
+	if node != nil && rs.source != nil {
+		e.Pos = node.Position()
+		e.Line = strings.TrimRight(rs.source.lineText(e.Pos.Line), "\r")
+		e.Length = extentLength(e.Line, e.Pos.Column-1)
+		e.Script = rs.source.path
+	}
+	rs.classifyError(e)
+	return e
+}
+
+// Exception types of the errors the simulator raises
+const (
+	runtimeException = "System.Management.Automation.RuntimeException"
+	bindingException = "System.Management.Automation.ParameterBindingException"
+	itemNotFound     = "System.Management.Automation.ItemNotFoundException"
+)
+
+// errorKinds classify errors by their message, giving the category, error
+// id and exception PowerShell reports for them. target marks messages whose
+// first quoted name is the object the error is about.
+var errorKinds = []struct {
+	text      string
+	category  string
+	id        string
+	exception string
+	inner     string
+	target    bool
+}{
+	{"Cannot find path '", "ObjectNotFound", "PathNotFound", itemNotFound, "", true},
+	{"Cannot find drive.", "ObjectNotFound", "DriveNotFound", "System.Management.Automation.DriveNotFoundException", "", true},
+	{"Cannot find a process with the name", "ObjectNotFound", "NoProcessFoundForGivenName", "Microsoft.PowerShell.Commands.ProcessCommandException", "", true},
+	{"Cannot find a process with the process identifier", "ObjectNotFound", "NoProcessFoundForGivenId", "Microsoft.PowerShell.Commands.ProcessCommandException", "", false},
+	{"Cannot find a variable with the name", "ObjectNotFound", "VariableNotFound", itemNotFound, "", true},
+	{"Cannot find an object with identity:", "ObjectNotFound", "ActiveDirectoryCmdlet:Microsoft.ActiveDirectory.Management.ADIdentityNotFoundException", "Microsoft.ActiveDirectory.Management.ADIdentityNotFoundException", "", true},
+	{"is not recognized as a name of a cmdlet", "ObjectNotFound", "CommandNotFoundException", "System.Management.Automation.CommandNotFoundException", "", true},
+	{"is specified more than once", "InvalidArgument", "ParameterAlreadyBound", bindingException, "", false},
+	{"A parameter cannot be found that matches parameter name", "InvalidArgument", "NamedParameterNotFound", bindingException, "", false},
+	{"is ambiguous. Possible matches include", "InvalidArgument", "AmbiguousParameter", bindingException, "", false},
+	{"The input object cannot be bound to any parameters", "InvalidArgument", "InputObjectNotBound", bindingException, "", false},
+	{"information required to bind all mandatory parameters", "InvalidArgument", "InputObjectMissingMandatory", bindingException, "", false},
+	{"A positional parameter cannot be found", "InvalidArgument", "PositionalParameterNotFound", bindingException, "", false},
+	{"Missing an argument for parameter", "InvalidArgument", "MissingArgument", bindingException, "", false},
+	{"missing mandatory parameters", "InvalidArgument", "MissingMandatoryParameter", bindingException, "", false},
+	{"Parameter set cannot be resolved", "InvalidArgument", "AmbiguousParameterSet", bindingException, "", false},
+	{"because it is an empty string.", "InvalidData", "ParameterArgumentValidationErrorEmptyStringNotAllowed", "System.Management.Automation.ParameterBindingValidationException", "", false},
+	{"Cannot bind argument to parameter", "InvalidData", "ParameterArgumentValidationErrorNullNotAllowed", "System.Management.Automation.ParameterBindingValidationException", "", false},
+	{"Cannot validate argument on parameter", "InvalidData", "ParameterArgumentValidationError", "System.Management.Automation.ParameterBindingValidationException", "", false},
+	{"Cannot process argument transformation on parameter", "InvalidData", "ParameterArgumentTransformationError", "System.Management.Automation.ParameterBindingArgumentTransformationException", "", false},
+	{"can only be called from inside a module", "PermissionDenied", "Modules_CanOnlyExecuteExportModuleMemberInsideAModule", "System.InvalidOperationException", "", false},
+	{"was not loaded because no valid module file was found", "ResourceUnavailable", "Modules_ModuleNotFound", "System.IO.FileNotFoundException", "", true},
+	{"No modules were removed.", "ResourceUnavailable", "Modules_NoModulesRemoved", "System.InvalidOperationException", "", false},
+	{"Could not find file '", "OpenError", "FileOpenFailure", "System.IO.FileNotFoundException", "", true},
+	{"Conversion from JSON failed with error:", "ParserError", "System.ArgumentException", "System.ArgumentException", "", false},
+	{"is already present.", "NotSpecified", "AlreadyPresentPSMemberInfoInternalCollectionAdd", "System.Management.Automation.ExtendedTypeSystemException", "", false},
+	{"Cannot append CSV content to the following file", "InvalidData", "CannotAppendCsvWithMismatchedPropertyNames", "System.InvalidOperationException", "", false},
+	{"Cannot bind parameter", "InvalidArgument", "CannotConvertArgumentNoMessage", bindingException, "", false},
+	{"You cannot call a method on a null-valued expression.", "InvalidOperation", "InvokeMethodOnNull", runtimeException, "", false},
+	{"Cannot index into a null array.", "InvalidOperation", "NullArray", runtimeException, "", false},
+	{"Method invocation failed because", "InvalidOperation", "MethodNotFound", runtimeException, "", false},
+	{"Cannot find an overload for", "NotSpecified", "MethodCountCouldNotFindBest", runtimeException, "", false},
+	{"cannot be found on this object", "InvalidOperation", "PropertyNotFound", runtimeException, "", false},
+	{"Unable to find type [", "InvalidOperation", "TypeNotFound", runtimeException, "", false},
+	{"Cannot convert", "InvalidArgument", "RuntimeException", runtimeException, "System.Management.Automation.PSInvalidCastException", false},
+	{"Attempted to divide by zero.", "NotSpecified", "RuntimeException", runtimeException, "System.DivideByZeroException", false},
+	{"Index was outside the bounds of the array.", "OperationStopped", "System.IndexOutOfRangeException", "System.IndexOutOfRangeException", "", false},
+	{"Cannot overwrite variable", "WriteError", "VariableNotWritable", "System.Management.Automation.SessionStateUnauthorizedAccessException", "", false},
+	{"call depth overflow", "InvalidOperation", "CallDepthOverflow", "System.Management.Automation.ScriptCallDepthException", "", false},
+}
+
+// classifyError fills in the ErrorRecord details of an error from its message
+func (rs *Runspace) classifyError(e *RuntimeError) {
+	category, id, exception, inner, target := "NotSpecified", "RuntimeException", runtimeException, "", false
+	for _, k := range errorKinds {
+		if strings.Contains(e.Message, k.text) {
+			category, id, exception, inner, target = k.category, k.id, k.exception, k.inner, k.target
+			break
+		}
+	}
+	if e.Category == "" {
+		e.Category = category
+	}
+	if e.Exception == "" {
+		e.Exception, e.inner = exception, inner
+	}
+	if e.TargetObject == nil && target {
+		e.TargetObject = quotedName(e.Message)
+	}
+	cmd, isCommand := rs.resolveCommand(e.Command)
+	if isCommand {
+		e.activity = cmd.Name
+	}
+	if e.ErrorID == "" {
+		e.ErrorID = id
+		if isCommand {
+			e.ErrorID += "," + commandTypeName(cmd)
+		}
+	}
+}
+
+// quotedName returns the first name quoted in a message, or nil
+func quotedName(message string) interface{} {
+	start := strings.IndexAny(message, "'\"")
+	if start < 0 {
+		return nil
+	}
+	end := strings.IndexByte(message[start+1:], message[start])
+	if end < 0 {
+		return nil
+	}
+	return message[start+1 : start+1+end]
+}
+
+// commandTypeName is the .NET class that implements a cmdlet, which
+// qualifies the ids of the errors it raises
+func commandTypeName(c *Cmdlet) string {
+	// Errors from functions and scripts are identified by the command's own name
+	if c.Function != nil {
+		return c.Name
+	}
+	name := strings.ReplaceAll(c.Name, "-", "")
+	module := ""
+	if t, ok := loadHelp()[strings.ToLower(c.Name)]; ok {
+		module = t.Module
+	}
+	switch {
+	case module == "ActiveDirectory":
+		return "Microsoft.ActiveDirectory.Management.Commands." + name
+	case strings.HasPrefix(module, "Microsoft.Graph."):
+		return "Microsoft.Graph.PowerShell.Cmdlets." + name
+	case module == "ExchangeOnlineManagement":
+		return "Microsoft.Exchange.Management.RecipientTasks." + name
+	}
+	return "Microsoft.PowerShell.Commands." + name + "Command"
+}
+
+// thrownError is the error a throw statement raises for a value
+func (rs *Runspace) thrownError(node Node, v interface{}) *RuntimeError {
+	if re, ok := v.(*RuntimeError); ok {
+		re.Terminating = true
+		return re
+	}
+	if o, ok := v.(*PSObject); ok && o.IsA("System.Exception") {
+		message := toString(propertyOf(o, "Message"))
+		e := rs.newError(node, "", message)
+		e.Category, e.ErrorID, e.Exception, e.TargetObject = "OperationStopped", message, o.TypeName(), nil
+		e.exception, e.activity, e.inner, e.Terminating = o, "", "", true
+		return e
+	}
+	message := "ScriptHalted"
+	if v != nil {
+		message = toString(v)
+	}
+	e := rs.newError(node, "", message)
+	e.Category, e.ErrorID, e.Exception, e.TargetObject = "OperationStopped", message, runtimeException, v
+	e.activity, e.inner, e.Terminating = "", "", true
+	return e
+}
+
+// isA reports whether a catch or trap for the exception type handles the error
+func (e *RuntimeError) isA(exceptionType string) bool {
+	if e.exceptionObject().IsA(exceptionType) {
+		return true
+	}
+	inner, ok := propertyOf(e.exceptionObject(), "InnerException").(*PSObject)
+	return ok && inner.IsA(exceptionType)
+}
+
+// newException creates an exception object of a type derived from System.Exception
+func newException(typ, message string, inner interface{}) *PSObject {
+	o := NewObject(typeChain(typ)...).
+		Add("Message", message).
+		Add("Data", NewHashtable()).
+		Add("InnerException", inner).
+		Add("TargetSite", nil).
+		Add("StackTrace", nil).
+		Add("HelpLink", nil).
+		Add("Source", nil).
+		Add("HResult", -2146233087)
+	o.ToStringFunc = func(*PSObject) string { return typ + ": " + message }
+	return o
+}
+
+// exceptionObject is the error's Exception property
+func (e *RuntimeError) exceptionObject() *PSObject {
+	if e.exception == nil {
+		var inner interface{}
+		if e.inner != "" {
+			inner = newException(e.inner, e.Message, nil)
+		}
+		typ := e.Exception
+		if typ == "" {
+			typ = runtimeException
+		}
+		e.exception = newException(typ, e.Message, inner)
+	}
+	return e.exception
+}
+
+// object holds the properties of the ErrorRecord
+func (e *RuntimeError) object() *PSObject {
+	if e.record != nil {
+		return e.record
+	}
+	name, kind := "", ""
+	if e.TargetObject != nil {
+		name, kind = toString(e.TargetObject), shortTypeName(typeName(e.TargetObject))
+	}
+	category := NewObject("System.Management.Automation.ErrorCategoryInfo").
+		Add("Category", e.Category).
+		Add("Activity", e.activity).
+		Add("Reason", shortTypeName(e.Exception)).
+		Add("TargetName", name).
+		Add("TargetType", kind)
+	category.ToStringFunc = func(*PSObject) string { return e.categoryText() }
+	var command interface{}
+	if e.activity != "" {
+		command = e.activity
+	}
+	invocation := NewObject("System.Management.Automation.InvocationInfo").
+		Add("MyCommand", command).
+		Add("ScriptName", e.Script).
+		Add("ScriptLineNumber", e.Pos.Line).
+		Add("OffsetInLine", e.Pos.Column).
+		Add("Line", e.Line).
+		Add("PositionMessage", e.positionMessage()).
+		Add("InvocationName", e.Command)
+	file := e.Script
+	if file == "" {
+		file = "<No file>"
+	}
+	stack := "at <ScriptBlock>, " + file
+	if e.Pos.Line > 0 {
+		stack += fmt.Sprintf(": line %d", e.Pos.Line)
+	}
+	e.record = NewObject("System.Management.Automation.ErrorRecord").
+		Add("Exception", e.exceptionObject()).
+		Add("TargetObject", e.TargetObject).
+		Add("CategoryInfo", category).
+		Add("FullyQualifiedErrorId", e.ErrorID).
+		Add("ErrorDetails", nil).
+		Add("InvocationInfo", invocation).
+		Add("ScriptStackTrace", stack).
+		Add("PipelineIterationInfo", []interface{}{})
+	return e.record
+}
+
+// actionPreferences are the values of -ErrorAction and $ErrorActionPreference
+var actionPreferences = []string{"SilentlyContinue", "Stop", "Continue", "Inquire", "Ignore", "Suspend", "Break"}
+
+// actionPreference names the ActionPreference a value stands for
+func actionPreference(v interface{}) (string, bool) {
+	if n, ok := v.(int); ok {
+		if n >= 0 && n < len(actionPreferences) {
+			return actionPreferences[n], true
+		}
+		return "", false
+	}
+	for _, p := range actionPreferences {
+		if strings.EqualFold(toString(v), p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// errorPreference is $ErrorActionPreference, Continue when it isn't valid
+func (rs *Runspace) errorPreference() string {
+	if p, ok := actionPreference(rs.variableValue("ErrorActionPreference")); ok {
+		return p
+	}
+	return "Continue"
+}
+
+// maximumErrorCount bounds $Error like $MaximumErrorCount
+const maximumErrorCount = 256
+
+// recordError adds an error to the front of $Error
+func (rs *Runspace) recordError(e *RuntimeError) {
+	if e.recorded {
+		return
+	}
+	e.recorded = true
+	rs.errors = append([]interface{}{e}, rs.errors...)
+	if len(rs.errors) > maximumErrorCount {
+		rs.errors = rs.errors[:maximumErrorCount]
+	}
+	rs.global.vars["error"].Value = rs.errors
+}
+
+// isErrorList reports whether a collection is $Error itself
+func (rs *Runspace) isErrorList(list []interface{}) bool {
+	return len(list) > 0 && len(rs.errors) > 0 && &list[0] == &rs.errors[0]
+}
+
+// clearErrors implements $Error.Clear()
+func (rs *Runspace) clearErrors() {
+	rs.errors = []interface{}{}
+	rs.global.vars["error"].Value = rs.errors
+}
+
+// reportError writes an error to the error stream and records it in $Error
+func (rs *Runspace) reportError(e *RuntimeError) {
+	rs.recordError(e)
+	rs.writeError(e)
+}
+
+// statementError handles an error that ended a statement. Script-terminating
+// errors, and any error inside a try or a block with a trap, unwind further.
+// Others are reported as $ErrorActionPreference says and the script carries
+// on with the next statement, as PowerShell does.
+func (rs *Runspace) statementError(e *RuntimeError) error {
+	if e.Terminating || rs.handlers > 0 {
+		return e
+	}
+	switch rs.errorPreference() {
+	case "Stop":
+		e.Terminating = true
+		return e
+	case "SilentlyContinue", "Ignore":
+		rs.recordError(e)
+	default:
+		rs.reportError(e)
+	}
+	return nil
+}
+
+// extentLength guesses the length of the token starting at col for underlining
+func extentLength(line string, col int) int {
+	if col < 0 || col >= len(line) {
+		return 1
+	}
+	end := col
+	for end < len(line) && !isArgTerminator(line[end]) {
+		end++
+	}
+	if end == col {
+		return 1
+	}
+	return end - col
+}
+
+// isControlFlow reports whether err is a break/continue/return/exit signal rather than a failure
+func isControlFlow(err error) bool {
+	switch err.(type) {
+	case *breakSignal, *continueSignal, *returnSignal, *exitSignal, *stopSignal, *abortError:
+		return true
+	}
+	return false
+}
+
+// breakSignal unwinds to the enclosing loop or switch
+type breakSignal struct{ label string }
+
+func (s *breakSignal) Error() string { return "break" }
+
+// continueSignal skips to the next iteration of the enclosing loop
+type continueSignal struct{ label string }
+
+func (s *continueSignal) Error() string { return "continue" }
+
+// returnSignal leaves the current script block
+type returnSignal struct{}
+
+func (s *returnSignal) Error() string { return "return" }
+
+// exitSignal ends the script
+type exitSignal struct{ code int }
+
+func (s *exitSignal) Error() string { return "exit" }
+
+// stopSignal stops upstream pipeline commands once a downstream command has all the input it needs
+type stopSignal struct {
+	run   *pipelineRun
+	index int // position of the command that stopped the pipeline
+}
+
+func (s *stopSignal) Error() string { return "pipeline stopped" }
+
+// abortError stops a script that has run too long, wherever it is; try,
+// catch and trap do not handle it
+type abortError struct{ message string }
+
+func (e *abortError) Error() string { return e.message }
@@ -0,0 +1,1066 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// emitter receives the objects a statement writes to the success stream
+type emitter func(v interface{}) error
+
+// maxDepth bounds script block recursion
+const maxDepth = 100
+
+// maxSteps and maxRunTime bound the statements, loop iterations and
+// pipeline objects one Run may process and how long it may take, so that a
+// loop that never ends stops the script rather than hanging the console
+const (
+	maxSteps   = 1000000
+	maxRunTime = 10 * time.Second
+)
+
+// step counts one unit of work against the script's budget. Once the budget
+// is spent every step fails, so the script unwinds even through code that
+// turns the error into a non-terminating one.
+func (rs *Runspace) step() error {
+	rs.steps++
+	switch {
+	case rs.steps > maxSteps:
+		return &abortError{message: fmt.Sprintf("The script was stopped after running %d steps. Check for a loop that never ends.", maxSteps)}
+	case rs.steps%1024 == 0 && time.Since(rs.started) > maxRunTime:
+		rs.steps = maxSteps
+		return &abortError{message: fmt.Sprintf("The script was stopped after running for %v. Check for a loop that never ends.", maxRunTime)}
+	}
+	return nil
+}
+
+// execStatements runs a statement list. Errors that only terminate a single
+// statement are written to the error stream and execution continues with the
+// next statement, as PowerShell does. Trap statements anywhere in the list
+// handle the errors of all its statements.
+func (rs *Runspace) execStatements(stmts []Statement, out emitter) error {
+	var traps []*TrapStatement
+	for _, s := range stmts {
+		if t, ok := s.(*TrapStatement); ok {
+			traps = append(traps, t)
+		}
+	}
+	if len(traps) > 0 {
+		rs.handlers++
+		defer func() { rs.handlers-- }()
+	}
+	for _, s := range stmts {
+		if _, ok := s.(*TrapStatement); ok {
+			continue
+		}
+		rs.failed = false
+		err := rs.execStatement(s, out)
+		rs.global.vars["?"].Value = err == nil && !rs.failed
+		re, ok := err.(*RuntimeError)
+		if !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if len(traps) > 0 {
+			err = rs.trap(traps, re, out)
+		} else {
+			err = rs.statementError(re)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *Runspace) execStatement(s Statement, out emitter) error {
+	if err := rs.step(); err != nil {
+		return err
+	}
+	err := rs.execStatementRaw(s, out)
+	if err != nil && !isControlFlow(err) {
+		return rs.errorAt(s, err)
+	}
+	return err
+}
+
+func (rs *Runspace) execStatementRaw(s Statement, out emitter) error {
+	switch s := s.(type) {
+	case *PipelineStatement:
+		return rs.execPipeline(s, out)
+	case *AssignmentStatement:
+		_, err := rs.execAssignment(s)
+		return err
+	case *IfStatement:
+		for _, clause := range s.Clauses {
+			cond, err := rs.evalStatementValue(clause.Condition)
+			if err != nil {
+				return err
+			}
+			if toBool(cond) {
+				return rs.execStatements(clause.Body, out)
+			}
+		}
+		if s.Else != nil {
+			return rs.execStatements(s.Else, out)
+		}
+		return nil
+	case *WhileStatement:
+		for {
+			if err := rs.step(); err != nil {
+				return err
+			}
+			cond, err := rs.evalStatementValue(s.Condition)
+			if err != nil {
+				return err
+			}
+			if !toBool(cond) {
+				return nil
+			}
+			if done, err := loopBody(rs.execStatements(s.Body, out), s.Label); done {
+				return err
+			}
+		}
+	case *DoStatement:
+		for {
+			if err := rs.step(); err != nil {
+				return err
+			}
+			if done, err := loopBody(rs.execStatements(s.Body, out), s.Label); done {
+				return err
+			}
+			cond, err := rs.evalStatementValue(s.Condition)
+			if err != nil {
+				return err
+			}
+			if toBool(cond) == s.Until {
+				return nil
+			}
+		}
+	case *ForStatement:
+		if s.Init != nil {
+			if err := rs.execStatement(s.Init, discard); err != nil {
+				return err
+			}
+		}
+		for {
+			if err := rs.step(); err != nil {
+				return err
+			}
+			if s.Condition != nil {
+				cond, err := rs.evalStatementValue(s.Condition)
+				if err != nil {
+					return err
+				}
+				if !toBool(cond) {
+					return nil
+				}
+			}
+			if done, err := loopBody(rs.execStatements(s.Body, out), s.Label); done {
+				return err
+			}
+			if s.Step != nil {
+				if err := rs.execStatement(s.Step, discard); err != nil {
+					return err
+				}
+			}
+		}
+	case *ForEachStatement:
+		coll, err := rs.evalStatementValue(s.Collection)
+		if err != nil {
+			return err
+		}
+		for _, item := range asList(coll) {
+			if err := rs.step(); err != nil {
+				return err
+			}
+			if err := rs.assignVariable(s.Variable, item); err != nil {
+				return err
+			}
+			if done, err := loopBody(rs.execStatements(s.Body, out), s.Label); done {
+				return err
+			}
+		}
+		return nil
+	case *SwitchStatement:
+		return rs.execSwitch(s, out)
+	case *BreakStatement:
+		return &breakSignal{label: s.Label}
+	case *ContinueStatement:
+		return &continueSignal{label: s.Label}
+	case *FunctionDefinition:
+		return rs.defineFunction(s)
+	case *ReturnStatement:
+		if s.Value != nil {
+			if err := rs.execStatement(s.Value, out); err != nil {
+				return err
+			}
+		}
+		return &returnSignal{}
+	case *TryStatement:
+		return rs.execTry(s, out)
+	case *TrapStatement:
+		// Traps take effect through the statement list that holds them
+		return nil
+	case *ThrowStatement:
+		if s.Value == nil {
+			// A bare throw in a catch block rethrows the error it caught
+			if rs.caught != nil {
+				return rs.thrownError(s, rs.caught)
+			}
+			return rs.thrownError(s, nil)
+		}
+		v, err := rs.evalStatementValue(s.Value)
+		if err != nil {
+			return err
+		}
+		return rs.thrownError(s, v)
+	case *ExitStatement:
+		code := 0
+		if s.Code != nil {
+			v, err := rs.evalStatementValue(s.Code)
+			if err != nil {
+				return err
+			}
+			if code, err = toInt(v); err != nil {
+				return err
+			}
+		}
+		return &exitSignal{code: code}
+	}
+	return fmt.Errorf("unsupported statement %T", s)
+}
+
+func discard(interface{}) error { return nil }
+
+// execTry runs a try statement. Terminating errors in the body go to the
+// first catch block that handles their exception type; the finally block
+// runs however the body ends.
+func (rs *Runspace) execTry(s *TryStatement, out emitter) error {
+	rs.handlers++
+	err := rs.execStatements(s.Body, out)
+	rs.handlers--
+	if re, ok := err.(*RuntimeError); ok {
+		err = rs.catch(s, re, out)
+	}
+	if s.Finally != nil {
+		if ferr := rs.execStatements(s.Finally, out); ferr != nil {
+			return ferr
+		}
+	}
+	return err
+}
+
+// catch runs the catch block that handles an error, returning the error
+// when none does
+func (rs *Runspace) catch(s *TryStatement, re *RuntimeError, out emitter) error {
+	for _, c := range s.Catches {
+		matched := len(c.Types) == 0
+		for _, t := range c.Types {
+			full, ok := resolveTypeName(t)
+			if !ok {
+				return rs.newError(s, "", fmt.Sprintf("Unable to find type [%s].", t))
+			}
+			matched = matched || re.isA(full)
+		}
+		if !matched {
+			continue
+		}
+		rs.recordError(re)
+		savedUnder, savedCaught := rs.scope.vars["_"], rs.caught
+		defer func() {
+			if savedUnder == nil {
+				delete(rs.scope.vars, "_")
+			} else {
+				rs.scope.vars["_"] = savedUnder
+			}
+			rs.caught = savedCaught
+		}()
+		rs.setDollarUnder(re)
+		rs.caught = re
+		return rs.execStatements(c.Body, out)
+	}
+	return re
+}
+
+// trap runs the trap that handles an error. continue in the trap resumes
+// with the next statement and break ends the block with the error;
+// otherwise the error is reported and the script carries on.
+func (rs *Runspace) trap(traps []*TrapStatement, re *RuntimeError, out emitter) error {
+	var handler *TrapStatement
+	for _, t := range traps {
+		if t.Type == "" {
+			if handler == nil {
+				handler = t
+			}
+			continue
+		}
+		full, ok := resolveTypeName(t.Type)
+		if !ok {
+			return rs.newError(t, "", fmt.Sprintf("Unable to find type [%s].", t.Type))
+		}
+		if re.isA(full) {
+			handler = t
+			break
+		}
+	}
+	if handler == nil {
+		// The error is handled as though the block had no trap
+		rs.handlers--
+		defer func() { rs.handlers++ }()
+		return rs.statementError(re)
+	}
+	rs.recordError(re)
+	err := rs.withScope(func() error {
+		rs.setDollarUnder(re)
+		return rs.execStatements(handler.Body, out)
+	})
+	switch err.(type) {
+	case nil:
+		rs.writeError(re)
+		return nil
+	case *continueSignal:
+		return nil
+	case *breakSignal:
+		re.Terminating = true
+		return re
+	}
+	return err
+}
+
+// loopBody interprets the result of one loop iteration; done reports whether the loop should end
+func loopBody(err error, label string) (done bool, result error) {
+	switch sig := err.(type) {
+	case nil:
+		return false, nil
+	case *breakSignal:
+		if sig.label == "" || strings.EqualFold(sig.label, label) {
+			return true, nil
+		}
+	case *continueSignal:
+		if sig.label == "" || strings.EqualFold(sig.label, label) {
+			return false, nil
+		}
+	}
+	return true, err
+}
+
+func (rs *Runspace) execSwitch(s *SwitchStatement, out emitter) error {
+	subject, err := rs.evalStatementValue(s.Subject)
+	if err != nil {
+		return err
+	}
+	items := asList(subject)
+	if subject == nil {
+		items = []interface{}{nil}
+	}
+	saved := rs.scope.vars["_"]
+	defer func() {
+		if saved == nil {
+			delete(rs.scope.vars, "_")
+		} else {
+			rs.scope.vars["_"] = saved
+		}
+	}()
+	for _, item := range items {
+		rs.setDollarUnder(item)
+		matched := false
+		for _, clause := range s.Clauses {
+			ok, err := rs.switchMatches(s, clause.Condition, item)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			err = rs.execStatements(clause.Body, out)
+			if done, res := loopBody(err, s.Label); done {
+				return res
+			} else if _, isContinue := err.(*continueSignal); isContinue {
+				break
+			}
+		}
+		if !matched && s.Default != nil {
+			err := rs.execStatements(s.Default, out)
+			if done, res := loopBody(err, s.Label); done {
+				return res
+			}
+		}
+	}
+	return nil
+}
+
+func (rs *Runspace) switchMatches(s *SwitchStatement, cond Expr, item interface{}) (bool, error) {
+	if sb, ok := cond.(*ScriptBlockExpr); ok {
+		v, err := rs.evalBlockValue(&ScriptBlock{Ast: sb.Block, source: rs.source}, item)
+		if err != nil {
+			return false, err
+		}
+		return toBool(v), nil
+	}
+	value, err := rs.eval(cond)
+	if err != nil {
+		return false, err
+	}
+	switch s.Mode {
+	case "regex":
+		op := "-match"
+		if s.CaseSense {
+			op = "-cmatch"
+		}
+		res, err := rs.compare(op, toString(item), value)
+		if err != nil {
+			return false, err
+		}
+		return toBool(res), nil
+	case "wildcard":
+		return MatchWildcard(toString(value), toString(item), s.CaseSense), nil
+	}
+	return valuesEqual(item, value, s.CaseSense), nil
+}
+
+// evalStatementValue runs a statement and returns its output as a single value.
+// A lone expression keeps its value as-is instead of being enumerated.
+func (rs *Runspace) evalStatementValue(s Statement) (interface{}, error) {
+	switch st := s.(type) {
+	case *PipelineStatement:
+		if len(st.Elements) == 1 {
+			if ce, ok := st.Elements[0].(*CommandExpression); ok && len(ce.Redirections) == 0 {
+				v, err := rs.eval(ce.Expr)
+				if err != nil {
+					return nil, rs.errorAt(ce.Expr, err)
+				}
+				return v, nil
+			}
+		}
+	case *AssignmentStatement:
+		v, err := rs.execAssignment(st)
+		if err != nil {
+			return nil, rs.errorAt(st, err)
+		}
+		return v, nil
+	}
+	items, err := rs.collectStatement(s)
+	return unwrap(items), err
+}
+
+func (rs *Runspace) collectStatement(s Statement) ([]interface{}, error) {
+	var items []interface{}
+	err := rs.execStatement(s, func(v interface{}) error {
+		items = append(items, v)
+		return nil
+	})
+	return items, err
+}
+
+func (rs *Runspace) collectStatements(stmts []Statement) ([]interface{}, error) {
+	var items []interface{}
+	err := rs.execStatements(stmts, func(v interface{}) error {
+		items = append(items, v)
+		return nil
+	})
+	return items, err
+}
+
+// Expressions
+
+func (rs *Runspace) eval(e Expr) (interface{}, error) {
+	switch e := e.(type) {
+	case *ConstantExpr:
+		return e.Value, nil
+	case *StringExpr:
+		return e.Value, nil
+	case *ExpandableStringExpr:
+		return rs.expandString(e.Parts)
+	case *VariableExpr:
+		return rs.variableValue(e.Name), nil
+	case *ArrayLiteralExpr:
+		out := make([]interface{}, len(e.Elements))
+		for i, el := range e.Elements {
+			v, err := rs.eval(el)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	case *ArrayExpr:
+		items, err := rs.collectStatements(e.Body)
+		if items == nil {
+			items = []interface{}{}
+		}
+		return items, err
+	case *SubExpr:
+		items, err := rs.collectStatements(e.Body)
+		return unwrap(items), err
+	case *ParenExpr:
+		return rs.evalStatementValue(e.Pipeline)
+	case *HashtableExpr:
+		return rs.evalHashtable(e)
+	case *ScriptBlockExpr:
+		return &ScriptBlock{Ast: e.Block, source: rs.source}, nil
+	case *BinaryExpr:
+		return rs.evalBinary(e)
+	case *UnaryExpr:
+		return rs.evalUnary(e)
+	case *ConvertExpr:
+		return rs.evalConvert(e)
+	case *TypeExpr:
+		return resolveType(e.Type)
+	case *MemberExpr:
+		name, err := rs.memberName(e.Member)
+		if err != nil {
+			return nil, err
+		}
+		if e.Static {
+			t, err := rs.staticTarget(e.Target)
+			if err != nil {
+				return nil, err
+			}
+			return rs.staticMember(t, name)
+		}
+		target, err := rs.eval(e.Target)
+		if err != nil {
+			return nil, err
+		}
+		return rs.getMember(target, name)
+	case *InvokeMemberExpr:
+		name, err := rs.memberName(e.Member)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]interface{}, len(e.Args))
+		for i, a := range e.Args {
+			if args[i], err = rs.eval(a); err != nil {
+				return nil, err
+			}
+		}
+		if e.Static {
+			t, err := rs.staticTarget(e.Target)
+			if err != nil {
+				return nil, err
+			}
+			return rs.invokeStatic(t, name, args)
+		}
+		target, err := rs.eval(e.Target)
+		if err != nil {
+			return nil, err
+		}
+		return rs.invokeMethod(target, name, args)
+	case *IndexExpr:
+		target, err := rs.eval(e.Target)
+		if err != nil {
+			return nil, err
+		}
+		index, err := rs.eval(e.Index)
+		if err != nil {
+			return nil, err
+		}
+		return indexValue(target, index)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", e)
+}
+
+func (rs *Runspace) memberName(e Expr) (string, error) {
+	if s, ok := e.(*StringExpr); ok {
+		return s.Value, nil
+	}
+	v, err := rs.eval(e)
+	if err != nil {
+		return "", err
+	}
+	return toString(v), nil
+}
+
+func (rs *Runspace) staticTarget(e Expr) (*TypeInfo, error) {
+	v, err := rs.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := v.(*TypeInfo)
+	if !ok {
+		return nil, fmt.Errorf("Unable to find type [%s].", toString(v))
+	}
+	return t, nil
+}
+
+// expandString evaluates the parts of an expandable string
+func (rs *Runspace) expandString(parts []Expr) (string, error) {
+	var b strings.Builder
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *StringExpr:
+			b.WriteString(p.Value)
+		default:
+			v, err := rs.eval(p)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(rs.expandValue(v))
+		}
+	}
+	return b.String(), nil
+}
+
+// expandValue converts a value for embedding in a string, joining arrays with $OFS
+func (rs *Runspace) expandValue(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		sep := " "
+		if ofs, ok := rs.GetVariable("OFS"); ok && ofs != nil {
+			sep = toString(ofs)
+		}
+		return joinValues(list, sep)
+	}
+	return toString(v)
+}
+
+func (rs *Runspace) evalHashtable(e *HashtableExpr) (*Hashtable, error) {
+	h := NewHashtable()
+	for _, entry := range e.Entries {
+		k, err := rs.eval(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		if h.Has(k) {
+			return nil, rs.newError(entry.Key, "", fmt.Sprintf("Duplicate keys '%s' are not allowed in hash literals.", toString(k)))
+		}
+		v, err := rs.evalStatementValue(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		h.Set(k, v)
+	}
+	return h, nil
+}
+
+func (rs *Runspace) evalBinary(e *BinaryExpr) (interface{}, error) {
+	left, err := rs.eval(e.Left)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "-and":
+		if !toBool(left) {
+			return false, nil
+		}
+		right, err := rs.eval(e.Right)
+		return toBool(right), err
+	case "-or":
+		if toBool(left) {
+			return true, nil
+		}
+		right, err := rs.eval(e.Right)
+		return toBool(right), err
+	}
+	right, err := rs.eval(e.Right)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	switch e.Op {
+	case "-xor":
+		return toBool(left) != toBool(right), nil
+	case "+", "-", "*", "/", "%":
+		v, err = arithmetic(e.Op, left, right)
+	case "-band", "-bor", "-bxor":
+		v, err = bitwise(e.Op, left, right)
+	case "..":
+		v, err = rangeOp(left, right)
+	case "-f":
+		v, err = formatOperator(toString(left), asList(right))
+	default:
+		v, err = rs.compare(e.Op, left, right)
+	}
+	if err != nil {
+		re := rs.newError(e.Right, "", err.Error())
+		_, re.Terminating = err.(sizeError)
+		return nil, re
+	}
+	return v, nil
+}
+
+func (rs *Runspace) evalUnary(e *UnaryExpr) (interface{}, error) {
+	if e.Op == "++" || e.Op == "--" {
+		old, err := rs.eval(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		op := "+"
+		if e.Op == "--" {
+			op = "-"
+		}
+		updated, err := arithmetic(op, old, 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := rs.assignTo(e.Operand, updated); err != nil {
+			return nil, err
+		}
+		if e.Postfix {
+			if old == nil {
+				return 0, nil
+			}
+			return old, nil
+		}
+		return updated, nil
+	}
+	v, err := rs.eval(e.Operand)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "!", "-not":
+		return !toBool(v), nil
+	case "-bnot":
+		n, err := toInt(v)
+		return ^n, err
+	case "-":
+		n, err := toNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic("-", 0, n)
+	case "+":
+		return toNumber(v)
+	case "-split":
+		return splitWhitespace(v), nil
+	case "-join":
+		return joinValues(v, ""), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.Op)
+}
+
+func (rs *Runspace) evalConvert(e *ConvertExpr) (interface{}, error) {
+	t, err := resolveType(e.Type)
+	if err != nil {
+		return nil, rs.newError(e, "", err.Error())
+	}
+	if h, ok := e.Operand.(*HashtableExpr); ok {
+		switch t.Name {
+		case "System.Collections.Specialized.OrderedDictionary", "System.Management.Automation.PSCustomObject":
+			table, err := rs.evalHashtable(h)
+			if err != nil {
+				return nil, err
+			}
+			return convertTo(table, t.Name)
+		}
+	}
+	if t.Name == "System.Collections.Specialized.OrderedDictionary" {
+		return nil, rs.newError(e, "", "The ordered attribute can be specified only on a hash literal node.")
+	}
+	v, err := rs.eval(e.Operand)
+	if err != nil {
+		return nil, err
+	}
+	out, err := convertTo(v, t.Name)
+	if err != nil {
+		return nil, rs.newError(e, "", err.Error())
+	}
+	return out, nil
+}
+
+// Variables
+
+// variableValue looks up a variable, handling scope and drive qualifiers
+func (rs *Runspace) variableValue(name string) interface{} {
+	scope, bare := splitScope(name)
+	switch scope {
+	case "env":
+		v, _ := rs.env.Get(bare)
+		return v
+	case "global":
+		if v := rs.global.lookup(bare); v != nil {
+			return v.Value
+		}
+		return nil
+	case "script":
+		if v := rs.scope.scriptScope().lookup(bare); v != nil {
+			return v.Value
+		}
+		return nil
+	case "local", "private":
+		if v, ok := rs.scope.vars[strings.ToLower(bare)]; ok {
+			return v.Value
+		}
+		return nil
+	}
+	if strings.EqualFold(bare, "PSItem") {
+		bare = "_"
+	}
+	v, _ := rs.GetVariable(bare)
+	return v
+}
+
+func splitScope(name string) (scope, bare string) {
+	if i := strings.IndexByte(name, ':'); i > 0 {
+		return strings.ToLower(name[:i]), name[i+1:]
+	}
+	return "", name
+}
+
+// assignVariable implements $name = value
+func (rs *Runspace) assignVariable(name string, value interface{}) error {
+	scope, bare := splitScope(name)
+	if strings.EqualFold(bare, "null") {
+		return nil
+	}
+	target := rs.scope
+	switch scope {
+	case "env":
+		if value == nil || toString(value) == "" {
+			rs.env.Remove(bare)
+		} else {
+			rs.env.Set(bare, toString(value))
+		}
+		return nil
+	case "global":
+		target = rs.global
+	case "script":
+		target = rs.scope.scriptScope()
+	}
+	if strings.EqualFold(bare, "PSItem") {
+		bare = "_"
+	}
+	key := strings.ToLower(bare)
+	v := target.vars[key]
+	if v == nil {
+		if existing := target.lookup(bare); existing != nil && existing.ReadOnly {
+			v = existing
+		}
+	}
+	if v != nil && v.ReadOnly {
+		return fmt.Errorf("Cannot overwrite variable %s because it is read-only or constant.", bare)
+	}
+	if v != nil && v.Type != "" {
+		converted, err := convertTo(value, v.Type)
+		if err != nil {
+			return err
+		}
+		value = converted
+	}
+	if v == nil {
+		target.vars[key] = &Variable{Name: bare, Value: value}
+		return nil
+	}
+	v.Value = value
+	return nil
+}
+
+func (rs *Runspace) setDollarUnder(v interface{}) {
+	rs.scope.vars["_"] = &Variable{Name: "_", Value: v}
+}
+
+// Assignment
+
+// execAssignment runs an assignment statement and returns the assigned value
+func (rs *Runspace) execAssignment(s *AssignmentStatement) (interface{}, error) {
+	value, err := rs.evalStatementValue(s.Value)
+	if err != nil {
+		return nil, err
+	}
+	if s.Op != "=" {
+		current, err := rs.eval(s.Target)
+		if err != nil {
+			return nil, err
+		}
+		value, err = arithmetic(s.Op[:1], current, value)
+		if err != nil {
+			re := rs.newError(s.Value, "", err.Error())
+			_, re.Terminating = err.(sizeError)
+			return nil, re
+		}
+	}
+	if err := rs.assignTo(s.Target, value); err != nil {
+		return nil, rs.errorAt(s, err)
+	}
+	return value, nil
+}
+
+func (rs *Runspace) assignTo(target Expr, value interface{}) error {
+	switch t := target.(type) {
+	case *VariableExpr:
+		return rs.assignVariable(t.Name, value)
+	case *ConvertExpr:
+		v, ok := t.Operand.(*VariableExpr)
+		if !ok {
+			return rs.assignTo(t.Operand, value)
+		}
+		typ, err := resolveType(t.Type)
+		if err != nil {
+			return err
+		}
+		converted, err := convertTo(value, typ.Name)
+		if err != nil {
+			return err
+		}
+		if err := rs.assignVariable(v.Name, converted); err != nil {
+			return err
+		}
+		_, bare := splitScope(v.Name)
+		if variable := rs.scope.lookup(bare); variable != nil {
+			variable.Type = typ.Name
+		}
+		return nil
+	case *MemberExpr:
+		obj, err := rs.eval(t.Target)
+		if err != nil {
+			return err
+		}
+		name, err := rs.memberName(t.Member)
+		if err != nil {
+			return err
+		}
+		return setMember(obj, name, value)
+	case *IndexExpr:
+		obj, err := rs.eval(t.Target)
+		if err != nil {
+			return err
+		}
+		index, err := rs.eval(t.Index)
+		if err != nil {
+			return err
+		}
+		return setIndex(obj, index, value)
+	case *ArrayLiteralExpr:
+		values := asList(value)
+		for i, el := range t.Elements {
+			var v interface{}
+			switch {
+			case i == len(t.Elements)-1 && len(values) > i+1:
+				v = append([]interface{}{}, values[i:]...)
+			case i < len(values):
+				v = values[i]
+			}
+			if err := rs.assignTo(el, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("The assignment expression is not valid.")
+}
+
+// Script blocks
+
+// invocation describes how a script block is called
+type invocation struct {
+	newScope   bool
+	underscore interface{}
+	hasUnder   bool
+	args       []interface{}
+	input      []interface{}
+	this       interface{} // $this of a script property or method
+	hasThis    bool
+}
+
+// invokeBlock runs a script block, sending its output to out
+func (rs *Runspace) invokeBlock(sb *ScriptBlock, inv invocation, out emitter) error {
+	if rs.depth >= maxDepth {
+		return fmt.Errorf("The script failed due to call depth overflow.")
+	}
+	rs.depth++
+	defer func() { rs.depth-- }()
+
+	run := func() error {
+		if inv.hasUnder {
+			rs.setDollarUnder(inv.underscore)
+		}
+		if inv.hasThis {
+			rs.scope.vars["this"] = &Variable{Name: "this", Value: inv.this}
+		}
+		args := inv.args
+		if sb.Ast.Params != nil {
+			for i, p := range sb.Ast.Params.Params {
+				var v interface{}
+				switch {
+				case i < len(args):
+					v = args[i]
+				case p.Default != nil:
+					d, err := rs.eval(p.Default)
+					if err != nil {
+						return err
+					}
+					v = d
+				}
+				if p.Type != "" {
+					t, err := resolveType(p.Type)
+					if err != nil {
+						return err
+					}
+					if v, err = convertTo(v, t.Name); err != nil {
+						return err
+					}
+				}
+				rs.scope.vars[strings.ToLower(p.Name)] = &Variable{Name: p.Name, Value: v}
+			}
+			if len(args) > len(sb.Ast.Params.Params) {
+				args = args[len(sb.Ast.Params.Params):]
+			} else {
+				args = nil
+			}
+		}
+		if args == nil {
+			args = []interface{}{}
+		}
+		rs.scope.vars["args"] = &Variable{Name: "args", Value: args}
+		input := inv.input
+		if input == nil {
+			input = []interface{}{}
+		}
+		rs.scope.vars["input"] = &Variable{Name: "input", Value: input}
+		return rs.execBlocks(sb.Ast, out)
+	}
+	if sb.source != nil {
+		source := rs.source
+		rs.source = sb.source
+		defer func() { rs.source = source }()
+	}
+
+	if inv.newScope {
+		return rs.withScope(run)
+	}
+	// Dot-sourced blocks share the caller's scope; restore the automatic variables they shadow
+	saved := map[string]*Variable{}
+	for _, name := range []string{"_", "args", "input", "this"} {
+		saved[name] = rs.scope.vars[name]
+	}
+	defer func() {
+		for name, v := range saved {
+			if v == nil {
+				delete(rs.scope.vars, name)
+			} else {
+				rs.scope.vars[name] = v
+			}
+		}
+	}()
+	return run()
+}
+
+// execBlocks runs the begin, process and end blocks of a script block in
+// turn; return ends only the block it is in
+func (rs *Runspace) execBlocks(block *ScriptBlockAst, out emitter) error {
+	for _, stmts := range [][]Statement{block.Begin, block.Process, block.Body} {
+		err := rs.execStatements(stmts, out)
+		if _, ok := err.(*returnSignal); ok {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalBlockValue runs a filter-style script block against $_ and returns its output
+func (rs *Runspace) evalBlockValue(sb *ScriptBlock, underscore interface{}) (interface{}, error) {
+	var items []interface{}
+	err := rs.invokeBlock(sb, invocation{underscore: underscore, hasUnder: true}, func(v interface{}) error {
+		items = append(items, v)
+		return nil
+	})
+	return unwrap(items), err
+}
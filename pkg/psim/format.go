@@ -0,0 +1,540 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultConsoleWidth is the buffer width output is formatted for when the host doesn't set one
+const DefaultConsoleWidth = 120
+
+// formatEnumerationLimit is how many elements of a collection a table or list cell shows,
+// like $FormatEnumerationLimit
+const formatEnumerationLimit = 4
+
+// Segment is a run of console text written to one stream
+type Segment struct {
+	Stream Stream
+	Text   string
+	// ForegroundColor and BackgroundColor are the console colors Write-Host asked for
+	ForegroundColor string
+	BackgroundColor string
+	// NoNewline marks host text that the next segment continues on the same line
+	NoNewline bool
+}
+
+// Segments renders the result's records as console text in the order they
+// were written. Consecutive success-stream objects are formatted together
+// so that they share one table.
+func (r *Result) Segments() []Segment {
+	width := r.Width
+	if width <= 0 {
+		width = DefaultConsoleWidth
+	}
+	var segs []Segment
+	var pending []interface{}
+	add := func(seg Segment) {
+		// -NoNewline only joins host text to more host text
+		if n := len(segs); n > 0 && segs[n-1].NoNewline && seg.Stream != StreamHost {
+			segs[n-1].NoNewline = false
+		}
+		segs = append(segs, seg)
+	}
+	flush := func() {
+		if len(pending) > 0 {
+			if text := formatText(pending, width); text != "" {
+				add(Segment{Stream: StreamOutput, Text: text})
+			}
+			pending = nil
+		}
+	}
+	for _, rec := range r.Records {
+		if re, ok := rec.Value.(*RuntimeError); ok && rec.Stream == StreamOutput {
+			// Error records in the success stream, from 2>&1 or a catch
+			// block's $_, are shown the way errors are
+			flush()
+			add(Segment{Stream: StreamError, Text: re.Format()})
+			continue
+		}
+		if rec.Stream == StreamOutput {
+			pending = append(pending, rec.Value)
+			continue
+		}
+		flush()
+		switch rec.Stream {
+		case StreamHost:
+			if h, ok := rec.Value.(HostOutput); ok {
+				add(Segment{
+					Stream:          StreamHost,
+					Text:            h.Text,
+					ForegroundColor: h.ForegroundColor,
+					BackgroundColor: h.BackgroundColor,
+					NoNewline:       h.NoNewline,
+				})
+			} else {
+				add(Segment{Stream: StreamHost, Text: toString(rec.Value)})
+			}
+		case StreamError:
+			if re, ok := rec.Value.(*RuntimeError); ok {
+				add(Segment{Stream: StreamError, Text: re.Format()})
+			} else {
+				add(Segment{Stream: StreamError, Text: toString(rec.Value)})
+			}
+		case StreamWarning:
+			add(Segment{Stream: StreamWarning, Text: "WARNING: " + toString(rec.Value)})
+		case StreamVerbose:
+			add(Segment{Stream: StreamVerbose, Text: "VERBOSE: " + toString(rec.Value)})
+		case StreamDebug:
+			add(Segment{Stream: StreamDebug, Text: "DEBUG: " + toString(rec.Value)})
+		}
+	}
+	flush()
+	return segs
+}
+
+// FormatObjects renders success-stream objects the way the console's default formatter would
+func FormatObjects(values []interface{}) string {
+	return formatText(values, DefaultConsoleWidth)
+}
+
+// formatText renders objects for a console of the given width, without trailing blank lines
+func formatText(values []interface{}, width int) string {
+	return strings.TrimRight(strings.Join(formatLines(values, width), "\n"), "\n ")
+}
+
+// formatLines renders objects line by line, keeping the blank lines that
+// surround tables and lists as Out-String does
+func formatLines(values []interface{}, width int) []string {
+	var lines []string
+	for i := 0; i < len(values); i++ {
+		switch v := values[i].(type) {
+		case *formatBlock:
+			lines = append(lines, v.render(width)...)
+		case *PSObject:
+			if len(v.Properties()) == 0 {
+				lines = append(lines, v.String())
+				continue
+			}
+			if view := viewFor(v); view != nil && view.custom != nil {
+				lines = append(lines, view.custom(v)...)
+				continue
+			}
+			// Objects sharing a shape are formatted together in one table or list
+			j := i + 1
+			for j < len(values) && sameFormat(v, values[j]) {
+				j++
+			}
+			group := make([]*PSObject, 0, j-i)
+			for _, o := range values[i:j] {
+				group = append(group, o.(*PSObject))
+			}
+			lines = append(lines, defaultBlock(group).render(width)...)
+			i = j - 1
+		case *TypeInfo:
+			// Types are shown as a table of their RuntimeType details
+			j := i + 1
+			for j < len(values) {
+				if _, ok := values[j].(*TypeInfo); !ok {
+					break
+				}
+				j++
+			}
+			types := make([]*PSObject, 0, j-i)
+			for _, t := range values[i:j] {
+				types = append(types, typeObject(t.(*TypeInfo)))
+			}
+			lines = append(lines, defaultBlock(types).render(width)...)
+			i = j - 1
+		case *Hashtable:
+			if v.Len() > 0 {
+				lines = append(lines, defaultBlock(dictionaryEntries(v)).render(width)...)
+			}
+		case time.Time:
+			lines = append(lines, v.Format("Monday, January 2, 2006 3:04:05 PM"))
+		case *RuntimeError:
+			lines = append(lines, strings.Split(v.Format(), "\n")...)
+		default:
+			lines = append(lines, toString(v))
+		}
+	}
+	return lines
+}
+
+// sameFormat reports whether v joins first's table: it shares first's view,
+// as files and folders do, or has no view and the same properties
+func sameFormat(first *PSObject, v interface{}) bool {
+	o, ok := v.(*PSObject)
+	if !ok {
+		return false
+	}
+	if view := viewFor(first); view != nil {
+		return viewFor(o) == view
+	}
+	return viewFor(o) == nil && sameShape(first, o)
+}
+
+func sameShape(first *PSObject, v interface{}) bool {
+	o, ok := v.(*PSObject)
+	if !ok || o.TypeName() != first.TypeName() {
+		return false
+	}
+	a, b := first.Properties(), o.Properties()
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// dictionaryEntries enumerates a hashtable the way the formatter sees it
+func dictionaryEntries(h *Hashtable) []*PSObject {
+	entries := make([]*PSObject, 0, h.Len())
+	for _, k := range h.Keys() {
+		v, _ := h.Get(k)
+		entries = append(entries, NewDictionaryEntry(k, v))
+	}
+	return entries
+}
+
+// cellText converts a property value for display in a table or list
+func cellText(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		n := len(v)
+		if n > formatEnumerationLimit {
+			n = formatEnumerationLimit
+		}
+		parts := make([]string, n)
+		for i, e := range v[:n] {
+			parts[i] = cellText(e)
+		}
+		if len(v) > n {
+			return "{" + strings.Join(parts, ", ") + "…}"
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case float64:
+		return formatFloat(v)
+	case time.Time:
+		return v.Format("1/2/2006 3:04:05 PM")
+	}
+	return toString(v)
+}
+
+// alignment is how a column places text that is narrower than the column
+type alignment int
+
+const (
+	alignAuto alignment = iota // numbers to the right, everything else to the left
+	alignLeft
+	alignRight
+	alignCenter
+)
+
+// column is one column of a table, one line of a list entry, or the single
+// property of a wide view
+type column struct {
+	label string
+	width int // fixed width; 0 sizes the column to its content
+	align alignment
+}
+
+// cell is one formatted value
+type cell struct {
+	text    string
+	numeric bool
+	null    bool
+}
+
+func newCell(v interface{}) cell {
+	return cell{text: cellText(v), numeric: isNumber(v), null: v == nil}
+}
+
+// formatEntry is one object reduced to the cells of a view
+type formatEntry struct {
+	group string // group header; a change of header starts a new table
+	cells []cell
+}
+
+// formatBlock is what Format-Table, Format-List and Format-Wide write to the
+// pipeline: objects already reduced to text, laid out against the console
+// width only when they are displayed
+type formatBlock struct {
+	shape       string // "table", "list" or "wide"
+	columns     []column
+	entries     []formatEntry
+	autoSize    bool
+	hideHeaders bool
+	wrap        bool
+	wideColumns int // columns of a wide view; 0 picks 2, or as many as fit with autoSize
+}
+
+// String is what a format object turns into when it ends up somewhere that expects text
+func (b *formatBlock) String() string {
+	return "Microsoft.PowerShell.Commands.Internal.Format.FormatStartData"
+}
+
+// render lays out the block for a console of the given width
+func (b *formatBlock) render(width int) []string {
+	var lines []string
+	for start := 0; start < len(b.entries); {
+		end := start + 1
+		for end < len(b.entries) && b.entries[end].group == b.entries[start].group {
+			end++
+		}
+		if g := b.entries[start].group; g != "" {
+			if len(lines) == 0 || lines[len(lines)-1] != "" {
+				lines = append(lines, "")
+			}
+			lines = append(lines, g)
+		}
+		switch b.shape {
+		case "list":
+			lines = append(lines, b.renderList(b.entries[start:end], width)...)
+		case "wide":
+			lines = append(lines, b.renderWide(b.entries[start:end], width)...)
+		default:
+			lines = append(lines, b.renderTable(b.entries[start:end], width)...)
+		}
+		start = end
+	}
+	return lines
+}
+
+func textWidth(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// fit truncates text to width, marking the cut with an ellipsis
+func fit(s string, width int) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = strings.TrimRight(s[:i], " ") + "…"
+	}
+	if textWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+// wrapText breaks text into lines no wider than width, at spaces where it can
+func wrapText(s string, width int) []string {
+	if width <= 0 {
+		return []string{s}
+	}
+	var out []string
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		r := []rune(line)
+		for len(r) > width {
+			cut := width
+			for i := width; i > 0; i-- {
+				if r[i] == ' ' {
+					cut = i
+					break
+				}
+			}
+			out = append(out, strings.TrimRight(string(r[:cut]), " "))
+			r = []rune(strings.TrimLeft(string(r[cut:]), " "))
+		}
+		out = append(out, string(r))
+	}
+	return out
+}
+
+func pad(s string, width int, align alignment) string {
+	n := width - textWidth(s)
+	switch {
+	case n <= 0:
+		return s
+	case align == alignRight:
+		return strings.Repeat(" ", n) + s
+	case align == alignCenter:
+		return strings.Repeat(" ", n/2) + s + strings.Repeat(" ", n-n/2)
+	}
+	return s + strings.Repeat(" ", n)
+}
+
+func (b *formatBlock) renderTable(entries []formatEntry, width int) []string {
+	n := len(b.columns)
+	widths := make([]int, n)
+	aligns := make([]alignment, n)
+	for c, col := range b.columns {
+		numeric, seen := true, false
+		widths[c] = col.width
+		if col.width == 0 || b.autoSize {
+			widths[c] = textWidth(col.label)
+		}
+		for _, e := range entries {
+			cl := e.cells[c]
+			if !cl.null {
+				seen = true
+				numeric = numeric && cl.numeric
+			}
+			if col.width == 0 || b.autoSize {
+				w := textWidth(cl.text)
+				if i := strings.IndexAny(cl.text, "\r\n"); i >= 0 && !b.wrap {
+					w = textWidth(cl.text[:i]) + 1
+				}
+				if w > widths[c] {
+					widths[c] = w
+				}
+			}
+		}
+		aligns[c] = col.align
+		if col.align == alignAuto {
+			aligns[c] = alignLeft
+			if seen && numeric {
+				aligns[c] = alignRight
+			}
+		}
+	}
+	// Without -AutoSize the widest columns that size to their content give
+	// up width first. Columns that still don't fit are dropped from the
+	// right, and the last one that stays takes whatever width is left.
+	if !b.autoSize {
+		total := n - 1
+		for _, w := range widths {
+			total += w
+		}
+		for total > width {
+			widest := -1
+			for c, col := range b.columns {
+				if col.width == 0 && widths[c] > textWidth(col.label) && (widest < 0 || widths[c] > widths[widest]) {
+					widest = c
+				}
+			}
+			if widest < 0 {
+				break
+			}
+			widths[widest]--
+			total--
+		}
+	}
+	visible := n
+	for visible > 0 {
+		used := visible - 1
+		for _, w := range widths[:visible-1] {
+			used += w
+		}
+		last := visible - 1
+		if rem := width - used; rem >= widths[last] || rem >= textWidth(b.columns[last].label) && rem > 0 {
+			if rem < widths[last] {
+				widths[last] = rem
+			}
+			break
+		}
+		visible--
+	}
+	if visible == 0 {
+		visible = 1
+		widths[0] = width
+	}
+	row := func(cells []string) []string {
+		cols := make([][]string, visible)
+		height := 1
+		for c := 0; c < visible; c++ {
+			if b.wrap {
+				cols[c] = wrapText(cells[c], widths[c])
+			} else {
+				cols[c] = []string{fit(cells[c], widths[c])}
+			}
+			if len(cols[c]) > height {
+				height = len(cols[c])
+			}
+		}
+		out := make([]string, height)
+		for i := range out {
+			parts := make([]string, visible)
+			for c := range parts {
+				text := ""
+				if i < len(cols[c]) {
+					text = cols[c][i]
+				}
+				parts[c] = pad(text, widths[c], aligns[c])
+			}
+			out[i] = strings.TrimRight(strings.Join(parts, " "), " ")
+		}
+		return out
+	}
+	lines := []string{""}
+	if !b.hideHeaders {
+		labels := make([]string, n)
+		dashes := make([]string, n)
+		for c, col := range b.columns {
+			labels[c] = col.label
+			dashes[c] = strings.Repeat("-", textWidth(fit(col.label, widths[c])))
+		}
+		lines = append(lines, row(labels)...)
+		lines = append(lines, row(dashes)...)
+	}
+	for _, e := range entries {
+		texts := make([]string, n)
+		for c, cl := range e.cells {
+			texts[c] = cl.text
+		}
+		lines = append(lines, row(texts)...)
+	}
+	if b.autoSize && visible < n {
+		lines = append(lines, fmt.Sprintf("WARNING: %d columns do not fit into the display and were removed.", n-visible))
+	}
+	return append(lines, "")
+}
+
+func (b *formatBlock) renderList(entries []formatEntry, width int) []string {
+	labelWidth := 0
+	for _, col := range b.columns {
+		if w := textWidth(col.label); w > labelWidth {
+			labelWidth = w
+		}
+	}
+	indent := strings.Repeat(" ", labelWidth+3)
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, "")
+		for c, col := range b.columns {
+			value := wrapText(e.cells[c].text, width-labelWidth-3)
+			lines = append(lines, strings.TrimRight(pad(col.label, labelWidth, alignLeft)+" : "+value[0], " "))
+			for _, more := range value[1:] {
+				lines = append(lines, strings.TrimRight(indent+more, " "))
+			}
+		}
+	}
+	return append(lines, "")
+}
+
+func (b *formatBlock) renderWide(entries []formatEntry, width int) []string {
+	cols := b.wideColumns
+	if cols <= 0 {
+		cols = 2
+		if b.autoSize {
+			longest := 1
+			for _, e := range entries {
+				if w := textWidth(e.cells[0].text); w > longest {
+					longest = w
+				}
+			}
+			cols = width / (longest + 1)
+		}
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	slot := width / cols
+	lines := []string{""}
+	for i := 0; i < len(entries); i += cols {
+		var parts []string
+		for j := i; j < i+cols && j < len(entries); j++ {
+			parts = append(parts, pad(fit(entries[j].cells[0].text, slot-1), slot-1, alignLeft))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(parts, " "), " "))
+	}
+	return append(lines, "")
+}
@@ -0,0 +1,268 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// viewColumn is a column of a built-in view and how it reads an object
+type viewColumn struct {
+	column
+	property string                        // property shown when value is nil
+	value    func(o *PSObject) interface{} // computed value
+}
+
+// formatView is the built-in layout of a type, like the views PowerShell
+// ships in its format.ps1xml files. A type with only a list view is always
+// shown as a list.
+type formatView struct {
+	table  []viewColumn
+	list   []viewColumn
+	group  func(o *PSObject) string   // header of the group an object is shown under
+	custom func(o *PSObject) []string // free-form layout used instead of a table or list
+}
+
+func col(property string, width int, align alignment) viewColumn {
+	return viewColumn{column: column{label: property, width: width, align: align}, property: property}
+}
+
+func calc(label string, width int, align alignment, value func(o *PSObject) interface{}) viewColumn {
+	return viewColumn{column: column{label: label, width: width, align: align}, value: value}
+}
+
+// propertyOf reads a property, or nil when the object doesn't have it
+func propertyOf(o *PSObject, name string) interface{} {
+	v, _ := o.Get(name)
+	return v
+}
+
+// megabytes shows a byte count the way the process view does
+func megabytes(v interface{}) interface{} {
+	f, err := toFloat(v)
+	if err != nil || v == nil {
+		return nil
+	}
+	s, _ := formatValue(f/(1<<20), "N2")
+	return s
+}
+
+var processView = &formatView{
+	table: []viewColumn{
+		calc("NPM(K)", 7, alignRight, func(o *PSObject) interface{} {
+			n, _ := toInt(propertyOf(o, "NPM"))
+			return n / 1024
+		}),
+		calc("PM(M)", 8, alignRight, func(o *PSObject) interface{} { return megabytes(propertyOf(o, "PM")) }),
+		calc("WS(M)", 10, alignRight, func(o *PSObject) interface{} { return megabytes(propertyOf(o, "WS")) }),
+		calc("CPU(s)", 10, alignRight, func(o *PSObject) interface{} {
+			cpu := propertyOf(o, "CPU")
+			if cpu == nil {
+				return nil
+			}
+			s, _ := formatValue(cpu, "N2")
+			return s
+		}),
+		col("Id", 7, alignRight),
+		col("SI", 3, alignRight),
+		col("ProcessName", 0, alignLeft),
+	},
+	list: []viewColumn{
+		col("Id", 0, alignLeft),
+		col("Handles", 0, alignLeft),
+		col("CPU", 0, alignLeft),
+		col("SI", 0, alignLeft),
+		col("Name", 0, alignLeft),
+	},
+}
+
+var serviceView = &formatView{
+	table: []viewColumn{
+		col("Status", 8, alignLeft),
+		col("Name", 18, alignLeft),
+		col("DisplayName", 0, alignLeft),
+	},
+}
+
+// directoryHeader groups file system items by the folder they are in
+func directoryHeader(o *PSObject) string {
+	parent := toString(propertyOf(o, "PSParentPath"))
+	if i := strings.Index(parent, "::"); i >= 0 {
+		parent = parent[i+2:]
+	}
+	return "    Directory: " + parent
+}
+
+var fileSystemView = &formatView{
+	table: []viewColumn{
+		col("Mode", 7, alignLeft),
+		calc("LastWriteTime", 26, alignRight, func(o *PSObject) interface{} {
+			t, ok := propertyOf(o, "LastWriteTime").(time.Time)
+			if !ok {
+				return nil
+			}
+			return fmt.Sprintf("%10s %8s", t.Format("1/2/2006"), t.Format("3:04 PM"))
+		}),
+		calc("Length", 14, alignRight, func(o *PSObject) interface{} { return propertyOf(o, "Length") }),
+		col("Name", 0, alignLeft),
+	},
+	list: []viewColumn{
+		col("Name", 0, alignLeft),
+		col("Length", 0, alignLeft),
+		col("CreationTime", 0, alignLeft),
+		col("LastWriteTime", 0, alignLeft),
+		col("Mode", 0, alignLeft),
+	},
+	group: directoryHeader,
+}
+
+// nameValueView is the two-column layout of hashtable entries and variables
+var nameValueView = &formatView{
+	table: []viewColumn{col("Name", 30, alignLeft), col("Value", 0, alignLeft)},
+}
+
+// contentColumns is a table view whose columns size to their content
+func contentColumns(properties ...string) *formatView {
+	v := &formatView{}
+	for _, p := range properties {
+		v.table = append(v.table, col(p, 0, alignAuto))
+	}
+	return v
+}
+
+// formatViews are the built-in views keyed by type name
+var formatViews = map[string]*formatView{
+	"System.Diagnostics.Process":              processView,
+	"System.ServiceProcess.ServiceController": serviceView,
+	"System.IO.FileSystemInfo":                fileSystemView,
+	"System.Management.Automation.PathInfo":   contentColumns("Path"),
+	"System.Collections.DictionaryEntry":      nameValueView,
+	"System.Management.Automation.PSVariable": nameValueView,
+	"MamlCommandHelpInfo":                     {custom: func(o *PSObject) []string { return strings.Split(o.String(), "\n") }},
+	"HelpInfoShort": {
+		table: []viewColumn{col("Name", 33, alignLeft), col("Category", 9, alignLeft), col("Module", 25, alignLeft), col("Synopsis", 0, alignLeft)},
+	},
+	"System.Management.Automation.CommandInfo": {
+		table: []viewColumn{
+			col("CommandType", 15, alignLeft),
+			calc("Name", 50, alignLeft, func(o *PSObject) interface{} { return propertyOf(o, "DisplayName") }),
+			col("Version", 10, alignLeft),
+			col("Source", 0, alignLeft),
+		},
+	},
+	"System.Management.Automation.PSModuleInfo": {
+		table: []viewColumn{
+			col("ModuleType", 10, alignLeft),
+			col("Version", 10, alignLeft),
+			col("PreRelease", 10, alignLeft),
+			col("Name", 35, alignLeft),
+			col("ExportedCommands", 0, alignLeft),
+		},
+	},
+	"System.RuntimeType": {
+		table: []viewColumn{col("IsPublic", 8, alignLeft), col("IsSerial", 8, alignLeft), col("Name", 40, alignLeft), col("BaseType", 0, alignLeft)},
+	},
+	"Microsoft.PowerShell.Commands.MemberDefinition": {
+		table: []viewColumn{col("Name", 0, alignLeft), col("MemberType", 0, alignLeft), col("Definition", 0, alignLeft)},
+		group: func(o *PSObject) string { return "   TypeName: " + toString(propertyOf(o, "TypeName")) },
+	},
+	"Microsoft.PowerShell.Commands.GroupInfo": {
+		table: []viewColumn{col("Count", 5, alignRight), col("Name", 25, alignLeft), col("Group", 0, alignLeft)},
+	},
+
+	exoModels + "Data.Directory.Management.Mailbox": {
+		table: []viewColumn{
+			col("Name", 20, alignLeft),
+			col("Alias", 15, alignLeft),
+			col("Database", 20, alignLeft),
+			col("ProhibitSendQuota", 19, alignLeft),
+			col("ExternalDirectoryObjectId", 0, alignLeft),
+		},
+	},
+	exoModels + "Data.Directory.Management.DistributionGroup":            contentColumns("Name", "DisplayName", "GroupType", "PrimarySmtpAddress"),
+	exoModels + "Data.Directory.Management.ReducedRecipient":             contentColumns("Name", "RecipientType"),
+	exoModels + "Management.RecipientTasks.MailboxAcePresentationObject": contentColumns("Identity", "User", "AccessRights", "IsInherited", "Deny"),
+	exoModels + "Management.RecipientTasks.RecipientPermission": {
+		table: append(contentColumns("Identity", "Trustee", "AccessControlType", "AccessRights").table,
+			calc("Inherited", 0, alignAuto, func(o *PSObject) interface{} { return propertyOf(o, "IsInherited") })),
+	},
+	exoModels + "MessagingPolicies.Rules.Tasks.Rule": contentColumns("Name", "State", "Mode", "Priority", "Comments"),
+	exoModels + "Management.MapiTasks.Presentation.MailboxStatistics": {
+		table: []viewColumn{
+			col("DisplayName", 0, alignLeft),
+			col("ItemCount", 0, alignRight),
+			calc("StorageLimitStatus", 0, alignLeft, func(o *PSObject) interface{} { return nil }),
+			col("LastLogonTime", 0, alignLeft),
+		},
+	},
+
+	mgModels + "MicrosoftGraphUser":  contentColumns("DisplayName", "Id", "Mail", "UserPrincipalName"),
+	mgModels + "MicrosoftGraphGroup": contentColumns("DisplayName", "Id", "MailNickname", "Description", "GroupTypes"),
+}
+
+// viewFor returns the built-in view of an object's type, searching its base types too
+func viewFor(o *PSObject) *formatView {
+	for _, t := range o.TypeNames {
+		if v, ok := formatViews[t]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// propertyColumns shows every property of an object
+func propertyColumns(o *PSObject) []viewColumn {
+	cols := make([]viewColumn, 0, len(o.Properties()))
+	for _, p := range o.Properties() {
+		cols = append(cols, col(p.Name, 0, alignAuto))
+	}
+	return cols
+}
+
+// defaultBlock lays out objects of one type the way Out-Default does: with
+// the type's view, else as a table when there are at most four properties
+// and as a list when there are more
+func defaultBlock(objs []*PSObject) *formatBlock {
+	view := viewFor(objs[0])
+	switch {
+	case view != nil && view.table != nil:
+		return viewBlock("table", view.table, view.group, objs)
+	case view != nil:
+		return viewBlock("list", view.list, view.group, objs)
+	}
+	cols := propertyColumns(objs[0])
+	if len(cols) <= 4 {
+		return viewBlock("table", cols, nil, objs)
+	}
+	return viewBlock("list", cols, nil, objs)
+}
+
+// viewBlock reduces objects to the cells of a view. Plain property columns
+// are left out when the first object doesn't have the property.
+func viewBlock(shape string, cols []viewColumn, group func(*PSObject) string, objs []*PSObject) *formatBlock {
+	var kept []viewColumn
+	for _, c := range cols {
+		if c.value != nil || objs[0].Property(c.property) != nil {
+			kept = append(kept, c)
+		}
+	}
+	b := &formatBlock{shape: shape}
+	for _, c := range kept {
+		b.columns = append(b.columns, c.column)
+	}
+	for _, o := range objs {
+		e := formatEntry{cells: make([]cell, len(kept))}
+		if group != nil {
+			e.group = group(o)
+		}
+		for i, c := range kept {
+			if c.value != nil {
+				e.cells[i] = newCell(c.value(o))
+			} else {
+				e.cells[i] = newCell(propertyOf(o, c.property))
+			}
+		}
+		b.entries = append(b.entries, e)
+	}
+	return b
+}
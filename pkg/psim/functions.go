@@ -0,0 +1,720 @@
+package psim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Function is a command written in PowerShell: a function or filter, a
+// script block invoked with & or ., or a script file. It runs as a Cmdlet
+// whose parameters come from its param block, so arguments and pipeline
+// input bind to it the way they bind to a cmdlet, and its begin, process
+// and end blocks run in a scope of its own.
+type Function struct {
+	Name     string
+	Advanced bool   // [CmdletBinding()] or a [Parameter()] attribute makes an advanced function
+	Module   string // module the function belongs to, if any
+	Body     *ScriptBlockAst
+
+	filter     bool   // the body is a process block
+	dotted     bool   // runs in the caller's scope, like a dot-sourced script block
+	path       string // the script file, for scripts; their scope is a script scope
+	defaultSet string
+	scope      *Scope // scope the function's own scopes descend from; nil for the caller's
+	source     *lexer // the source the body was parsed from
+	params     []*functionParam
+}
+
+// functionParam is a parameter of a function with its type and validation attributes
+type functionParam struct {
+	param    *Parameter
+	ast      *ParamAst
+	typ      string // resolved .NET type; empty when untyped or unknown
+	validate []validator
+}
+
+// validator checks an argument, returning why it is invalid or ""
+type validator func(rs *Runspace, v interface{}) string
+
+// functionRun is the state of one call of a function
+type functionRun struct {
+	scope *Scope
+	saved map[string]*Variable // automatic variables a dot-sourced call shadows
+}
+
+// functionAutomatics are the variables each call of a function sets
+var functionAutomatics = []string{"_", "args", "input", "this", "psboundparameters", "pscmdlet"}
+
+// defineFunction runs a function statement, adding the function to the
+// current scope or to the scope its name is qualified with
+func (rs *Runspace) defineFunction(def *FunctionDefinition) error {
+	target := rs.scope
+	name := def.Name
+	switch scope, bare := splitScope(def.Name); scope {
+	case "global":
+		target, name = rs.global, bare
+	case "script":
+		target, name = rs.scope.scriptScope(), bare
+	case "local":
+		name = bare
+	}
+	f, err := rs.newFunction(name, def.Body)
+	if err != nil {
+		return err
+	}
+	f.filter = def.Filter
+	if sc := rs.scope.moduleScope(); sc != nil {
+		f.scope, f.Module = sc, sc.module.Name
+	}
+	target.functions[strings.ToLower(name)] = f.command()
+	return nil
+}
+
+// scriptBlockCommand makes a script block invoked with & or . into a
+// command, so its param block binds named and positional arguments
+func (rs *Runspace) scriptBlockCommand(sb *ScriptBlock, dotted bool) (*Cmdlet, error) {
+	f, err := rs.newFunction("", sb.Ast)
+	if err != nil {
+		return nil, err
+	}
+	if sb.source != nil {
+		f.source = sb.source
+	}
+	f.dotted = dotted
+	return f.command(), nil
+}
+
+// scriptCommand loads a .ps1 file run by path as a command
+func (rs *Runspace) scriptCommand(path string, dotted bool) (*Cmdlet, error) {
+	block, source, err := rs.loadScript(path)
+	if err != nil {
+		return nil, err
+	}
+	saved := rs.source
+	rs.source = source
+	f, err := rs.newFunction(leafName(path), block)
+	rs.source = saved
+	if err != nil {
+		return nil, err
+	}
+	f.path, f.dotted = path, dotted
+	return f.command(), nil
+}
+
+// loadScript reads and parses a script or module file
+func (rs *Runspace) loadScript(path string) (*ScriptBlockAst, *lexer, error) {
+	text, err := rs.fs.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := Parse(text)
+	if err != nil {
+		re := parseErrorToRuntime(err.(*ParseError))
+		re.Script = path
+		return nil, nil, re
+	}
+	source := newLexer(text)
+	source.path = path
+	return block, source, nil
+}
+
+// newFunction builds a function from its body, reading the attributes of
+// its param block
+func (rs *Runspace) newFunction(name string, body *ScriptBlockAst) (*Function, error) {
+	f := &Function{Name: name, Body: body, source: rs.source}
+	if body.Params == nil {
+		return f, nil
+	}
+	positional := true
+	for _, attr := range body.Params.Attributes {
+		_, named, err := rs.attributeArgs(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(attr.Name) {
+		case "cmdletbinding":
+			f.Advanced = true
+			for _, arg := range attr.Named {
+				v := named[strings.ToLower(arg.Name)]
+				switch strings.ToLower(arg.Name) {
+				case "defaultparametersetname":
+					f.defaultSet = toString(v)
+				case "positionalbinding":
+					positional = toBool(v)
+				case "supportsshouldprocess", "confirmimpact", "supportspaging", "helpuri":
+				default:
+					return nil, rs.newError(attr, "", fmt.Sprintf("Property '%s' cannot be found for type 'System.Management.Automation.CmdletBindingAttribute'.", arg.Name))
+				}
+			}
+		case "outputtype", "alias":
+		default:
+			return nil, rs.unknownAttribute(attr)
+		}
+	}
+	explicit := false
+	for _, pa := range body.Params.Params {
+		fp, err := rs.functionParam(f, pa)
+		if err != nil {
+			return nil, err
+		}
+		explicit = explicit || fp.param.Position > 0
+		f.params = append(f.params, fp)
+	}
+	// Without any Position arguments, parameters take positions in the order
+	// they are declared; switches are never positional
+	if positional && !explicit {
+		n := 1
+		for _, fp := range f.params {
+			if !fp.param.Switch {
+				fp.param.Position = n
+				n++
+			}
+		}
+	}
+	return f, nil
+}
+
+func (rs *Runspace) unknownAttribute(attr *AttributeAst) error {
+	return rs.newError(attr, "", fmt.Sprintf("Cannot find the type for custom attribute '%s'. Make sure that the assembly that contains this type is loaded.", attr.Name))
+}
+
+// attributeArgs evaluates an attribute's arguments. Named arguments are
+// keyed by lowercased name; a bare name means $true.
+func (rs *Runspace) attributeArgs(attr *AttributeAst) ([]interface{}, map[string]interface{}, error) {
+	var positional []interface{}
+	for _, e := range attr.Positional {
+		v, err := rs.eval(e)
+		if err != nil {
+			return nil, nil, rs.errorAt(e, err)
+		}
+		positional = append(positional, v)
+	}
+	named := map[string]interface{}{}
+	for _, arg := range attr.Named {
+		var v interface{} = true
+		if arg.Value != nil {
+			val, err := rs.eval(arg.Value)
+			if err != nil {
+				return nil, nil, rs.errorAt(arg.Value, err)
+			}
+			v = val
+		}
+		named[strings.ToLower(arg.Name)] = v
+	}
+	return positional, named, nil
+}
+
+// functionParam builds a parameter from its declaration. Type names the
+// simulation doesn't know are kept but not converted to, like the identity
+// types of the simulated modules.
+func (rs *Runspace) functionParam(f *Function, pa *ParamAst) (*functionParam, error) {
+	p := &Parameter{Name: pa.Name, Type: pa.Type}
+	fp := &functionParam{param: p, ast: pa}
+	if pa.Type != "" {
+		if full, ok := resolveTypeName(pa.Type); ok {
+			fp.typ, p.Type = full, full
+		}
+		p.Switch = strings.EqualFold(fp.typ, "System.Management.Automation.SwitchParameter")
+	}
+	for _, attr := range pa.Attributes {
+		args, named, err := rs.attributeArgs(attr)
+		if err != nil {
+			return nil, err
+		}
+		overload := func(want int) error {
+			if len(args) == want {
+				return nil
+			}
+			return rs.newError(attr, "", fmt.Sprintf("Cannot find an overload for \"%sAttribute\" and the argument count: \"%d\".", attr.Name, len(args)))
+		}
+		message := ""
+		if v, ok := named["errormessage"]; ok {
+			message = toString(v)
+		}
+		switch strings.ToLower(attr.Name) {
+		case "parameter":
+			f.Advanced = true
+			for _, arg := range attr.Named {
+				v := named[strings.ToLower(arg.Name)]
+				switch strings.ToLower(arg.Name) {
+				case "mandatory":
+					p.Mandatory = toBool(v)
+				case "position":
+					n, err := toInt(v)
+					if err != nil {
+						return nil, rs.errorAt(arg.Value, err)
+					}
+					p.Position = n + 1
+				case "valuefrompipeline":
+					p.ValueFromPipeline = toBool(v)
+				case "valuefrompipelinebypropertyname":
+					p.ValueFromPipelineByPropertyName = toBool(v)
+				case "valuefromremainingarguments":
+					p.Remaining = toBool(v)
+				case "parametersetname":
+					if set := toString(v); set != allParameterSets {
+						p.Sets = append(p.Sets, set)
+					}
+				case "helpmessage", "helpmessagebasename", "helpmessageresourceid", "dontshow":
+				default:
+					return nil, rs.newError(attr, "", fmt.Sprintf("Property '%s' cannot be found for type 'System.Management.Automation.ParameterAttribute'.", arg.Name))
+				}
+			}
+		case "alias":
+			for _, a := range args {
+				for _, s := range asList(a) {
+					p.Aliases = append(p.Aliases, toString(s))
+				}
+			}
+		case "allownull", "allowemptystring", "allowemptycollection":
+			p.AllowEmpty = true
+		case "validateset":
+			var set []string
+			for _, a := range args {
+				for _, s := range asList(a) {
+					set = append(set, toString(s))
+				}
+			}
+			ignoreCase := true
+			if v, ok := named["ignorecase"]; ok {
+				ignoreCase = toBool(v)
+			}
+			fp.validate = append(fp.validate, validateSet(set, ignoreCase, message))
+		case "validaterange":
+			if err := overload(2); err != nil {
+				return nil, err
+			}
+			fp.validate = append(fp.validate, validateRange(args[0], args[1]))
+		case "validatelength":
+			if err := overload(2); err != nil {
+				return nil, err
+			}
+			fp.validate = append(fp.validate, validateLength(args[0], args[1]))
+		case "validatecount":
+			if err := overload(2); err != nil {
+				return nil, err
+			}
+			fp.validate = append(fp.validate, validateCount(args[0], args[1]))
+		case "validatepattern":
+			if err := overload(1); err != nil {
+				return nil, err
+			}
+			fp.validate = append(fp.validate, validatePattern(toString(args[0]), message))
+		case "validatescript":
+			if err := overload(1); err != nil {
+				return nil, err
+			}
+			sb, ok := args[0].(*ScriptBlock)
+			if !ok {
+				return nil, rs.newError(attr, "", fmt.Sprintf("Cannot convert the \"%s\" value of type \"%s\" to type \"System.Management.Automation.ScriptBlock\".", toString(args[0]), typeName(args[0])))
+			}
+			fp.validate = append(fp.validate, validateScript(sb, message))
+		case "validatenotnull":
+			fp.validate = append(fp.validate, validateNotNull(false))
+		case "validatenotnullorempty":
+			fp.validate = append(fp.validate, validateNotNull(true))
+		case "supportswildcards", "psdefaultvalue", "argumentcompleter":
+		default:
+			return nil, rs.unknownAttribute(attr)
+		}
+	}
+	return fp, nil
+}
+
+// Validation attributes. Apart from ValidateCount and the null checks they
+// apply to each element of a collection argument.
+
+func eachElement(v interface{}, check func(interface{}) string) string {
+	for _, item := range asList(v) {
+		if msg := check(item); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// customMessage formats a validation attribute's ErrorMessage, where {0} is the argument
+func customMessage(message string, v interface{}) string {
+	return strings.ReplaceAll(message, "{0}", toString(v))
+}
+
+func validateSet(set []string, ignoreCase bool, message string) validator {
+	return func(rs *Runspace, v interface{}) string {
+		return eachElement(v, func(item interface{}) string {
+			s := toString(item)
+			for _, allowed := range set {
+				if s == allowed || ignoreCase && strings.EqualFold(s, allowed) {
+					return ""
+				}
+			}
+			if message != "" {
+				return customMessage(message, item)
+			}
+			return fmt.Sprintf("The argument \"%s\" does not belong to the set \"%s\" specified by the ValidateSet attribute. Supply an argument that is in the set and then try the command again.", s, strings.Join(set, ","))
+		})
+	}
+}
+
+func validateRange(min, max interface{}) validator {
+	return func(rs *Runspace, v interface{}) string {
+		return eachElement(v, func(item interface{}) string {
+			if c, err := compareValues(item, min, false); err == nil && c < 0 {
+				return fmt.Sprintf("The %s argument is less than the minimum allowed range of %s. Supply an argument that is greater than or equal to %s and then try the command again.", toString(item), toString(min), toString(min))
+			}
+			if c, err := compareValues(item, max, false); err == nil && c > 0 {
+				return fmt.Sprintf("The %s argument is greater than the maximum allowed range of %s. Supply an argument that is less than or equal to %s and then try the command again.", toString(item), toString(max), toString(max))
+			}
+			return ""
+		})
+	}
+}
+
+func validateLength(min, max interface{}) validator {
+	return func(rs *Runspace, v interface{}) string {
+		lo, _ := toInt(min)
+		hi, _ := toInt(max)
+		return eachElement(v, func(item interface{}) string {
+			n := len([]rune(toString(item)))
+			if n < lo {
+				return fmt.Sprintf("The character length (%d) of the argument is too short. Specify an argument with a length that is greater than or equal to \"%d\", and then try the command again.", n, lo)
+			}
+			if n > hi {
+				return fmt.Sprintf("The character length (%d) of the argument is too long. Shorten the character length of the argument so it is fewer than or equal to \"%d\" characters, and then try the command again.", n, hi)
+			}
+			return ""
+		})
+	}
+}
+
+func validateCount(min, max interface{}) validator {
+	return func(rs *Runspace, v interface{}) string {
+		lo, _ := toInt(min)
+		hi, _ := toInt(max)
+		n := len(asList(v))
+		if v == nil {
+			n = 0
+		}
+		if n < lo || n > hi {
+			return fmt.Sprintf("The parameter requires at least %d value(s) and no more than %d value(s) - %d value(s) were provided.", lo, hi, n)
+		}
+		return ""
+	}
+}
+
+func validatePattern(pattern, message string) validator {
+	return func(rs *Runspace, v interface{}) string {
+		re, err := compileRegex(pattern, false)
+		if err != nil {
+			return err.Error()
+		}
+		return eachElement(v, func(item interface{}) string {
+			if re.MatchString(toString(item)) {
+				return ""
+			}
+			if message != "" {
+				return customMessage(message, item)
+			}
+			return fmt.Sprintf("The argument \"%s\" does not match the \"%s\" pattern. Supply an argument that matches \"%s\" and try the command again.", toString(item), pattern, pattern)
+		})
+	}
+}
+
+func validateScript(sb *ScriptBlock, message string) validator {
+	return func(rs *Runspace, v interface{}) string {
+		return eachElement(v, func(item interface{}) string {
+			result, err := rs.evalBlockValue(sb, item)
+			if err == nil && toBool(result) {
+				return ""
+			}
+			if message != "" {
+				return customMessage(message, item)
+			}
+			return fmt.Sprintf("The \"%s\" validation script for the argument with value \"%s\" did not return a result of True. Determine why the validation script failed, and then try the command again.", strings.TrimSpace(sb.Ast.Text), toString(item))
+		})
+	}
+}
+
+func validateNotNull(orEmpty bool) validator {
+	return func(rs *Runspace, v interface{}) string {
+		empty := v == nil
+		if list, ok := v.([]interface{}); ok {
+			empty = orEmpty && len(list) == 0
+			for _, item := range list {
+				empty = empty || item == nil || orEmpty && toString(item) == ""
+			}
+		} else if s, ok := v.(string); ok && orEmpty {
+			empty = s == ""
+		}
+		switch {
+		case !empty:
+			return ""
+		case orEmpty:
+			return "The argument is null or empty. Provide an argument that is not null or empty, and then try the command again."
+		}
+		return "The argument is null. Provide a valid value for the argument, and then run the command again."
+	}
+}
+
+// transform converts an argument to its parameter's type and checks it
+// against the parameter's validation attributes before it binds
+func (f *Function) transform(c *Call, p *Parameter, v interface{}) (interface{}, error) {
+	var fp *functionParam
+	for _, candidate := range f.params {
+		if candidate.param == p {
+			fp = candidate
+		}
+	}
+	if fp == nil {
+		return v, nil
+	}
+	if fp.typ != "" && !p.Switch {
+		converted, err := convertTo(v, fp.typ)
+		if err != nil {
+			return nil, c.Errorf("Cannot process argument transformation on parameter '%s'. %s", p.Name, err.Error())
+		}
+		v = converted
+	}
+	for _, check := range fp.validate {
+		if msg := check(c.Runspace, v); msg != "" {
+			return nil, c.Errorf("Cannot validate argument on parameter '%s'. %s", p.Name, msg)
+		}
+	}
+	return v, nil
+}
+
+// command wraps the function in the Cmdlet that binds and runs it
+func (f *Function) command() *Cmdlet {
+	c := &Cmdlet{Name: f.Name, DefaultSet: f.defaultSet, Function: f, Begin: f.begin, End: f.end}
+	for _, fp := range f.params {
+		c.Params = append(c.Params, fp.param)
+	}
+	if f.Body.Process != nil || f.filter {
+		c.Process = f.process
+	}
+	return c
+}
+
+// bindsPipeline reports whether pipeline input binds to the function's
+// parameters. A simple function instead reads its input from $input or,
+// in a process block, $_.
+func (f *Function) bindsPipeline() bool {
+	return f.Advanced
+}
+
+// enter runs fn in the scope of the function call, reporting errors
+// against the function's own source
+func (f *Function) enter(c *Call, fn func() error) error {
+	rs := c.Runspace
+	if rs.depth >= maxDepth {
+		return fmt.Errorf("The script failed due to call depth overflow.")
+	}
+	run := c.State.(*functionRun)
+	scope, source := rs.scope, rs.source
+	rs.scope, rs.depth = run.scope, rs.depth+1
+	if f.source != nil {
+		rs.source = f.source
+	}
+	defer func() { rs.scope, rs.source, rs.depth = scope, source, rs.depth-1 }()
+	return fn()
+}
+
+// runBlock runs one of the function's blocks; return ends only that block
+func (f *Function) runBlock(c *Call, stmts []Statement) error {
+	err := c.Runspace.execStatements(stmts, c.Emit)
+	if _, ok := err.(*returnSignal); ok {
+		return nil
+	}
+	return err
+}
+
+func (f *Function) begin(c *Call) error {
+	rs := c.Runspace
+	run := &functionRun{scope: rs.scope}
+	if f.dotted {
+		run.saved = map[string]*Variable{}
+		for _, name := range functionAutomatics {
+			run.saved[name] = rs.scope.vars[name]
+		}
+	} else {
+		parent := rs.scope
+		if f.scope != nil {
+			parent = f.scope
+		}
+		run.scope = newScope(parent)
+		run.scope.script = f.path != ""
+	}
+	c.State = run
+	return f.enter(c, func() error {
+		if err := f.setVariables(c); err != nil {
+			return err
+		}
+		return f.runBlock(c, f.Body.Begin)
+	})
+}
+
+func (f *Function) process(c *Call) error {
+	return f.enter(c, func() error {
+		rs := c.Runspace
+		for _, fp := range f.params {
+			if fp.param.takesPipeline() && c.Has(fp.param.Name) {
+				rs.scope.vars[strings.ToLower(fp.ast.Name)] = &Variable{Name: fp.ast.Name, Value: c.Get(fp.param.Name), Type: fp.typ}
+			}
+		}
+		rs.scope.vars["psboundparameters"] = &Variable{Name: "PSBoundParameters", Value: f.boundParameters(c)}
+		rs.scope.vars["input"] = &Variable{Name: "input", Value: []interface{}{c.Input}}
+		rs.setDollarUnder(c.Input)
+		body := f.Body.Process
+		if f.filter && !f.Body.Named {
+			body = f.Body.Body
+		}
+		return f.runBlock(c, body)
+	})
+}
+
+func (f *Function) end(c *Call) error {
+	rs := c.Runspace
+	run := c.State.(*functionRun)
+	err := f.enter(c, func() error {
+		if f.filter && !f.Body.Named {
+			return nil
+		}
+		input := c.Inputs
+		if input == nil {
+			input = []interface{}{}
+		}
+		rs.scope.vars["input"] = &Variable{Name: "input", Value: input}
+		return f.runBlock(c, f.Body.Body)
+	})
+	for name, v := range run.saved {
+		if v == nil {
+			delete(run.scope.vars, name)
+		} else {
+			run.scope.vars[name] = v
+		}
+	}
+	return err
+}
+
+// setVariables creates the parameter variables of a call, with the bound
+// arguments or the parameters' defaults, and its automatic variables
+func (f *Function) setVariables(c *Call) error {
+	rs := c.Runspace
+	vars := rs.scope.vars
+	for _, fp := range f.params {
+		v, bound := c.Bound[strings.ToLower(fp.param.Name)]
+		switch {
+		case bound:
+		case fp.ast.Default != nil:
+			d, err := rs.eval(fp.ast.Default)
+			if err != nil {
+				return rs.errorAt(fp.ast.Default, err)
+			}
+			v = d
+			if fp.typ != "" {
+				if v, err = convertTo(d, fp.typ); err != nil {
+					return rs.errorAt(fp.ast.Default, err)
+				}
+			}
+		case fp.typ != "":
+			// An unbound typed parameter holds its type's empty value, such as 0 or ""
+			v, _ = convertTo(nil, fp.typ)
+		}
+		vars[strings.ToLower(fp.ast.Name)] = &Variable{Name: fp.ast.Name, Value: v, Type: fp.typ}
+	}
+	args := c.args
+	if args == nil {
+		args = []interface{}{}
+	}
+	vars["args"] = &Variable{Name: "args", Value: args}
+	vars["psboundparameters"] = &Variable{Name: "PSBoundParameters", Value: f.boundParameters(c)}
+	if f.path != "" {
+		vars["psscriptroot"] = &Variable{Name: "PSScriptRoot", Value: parentPath(f.path)}
+		vars["pscommandpath"] = &Variable{Name: "PSCommandPath", Value: f.path}
+	}
+	if !f.Advanced {
+		return nil
+	}
+	vars["pscmdlet"] = &Variable{Name: "PSCmdlet", Value: f.cmdletObject(c)}
+	// The common parameters of an advanced function set the preferences the
+	// commands it runs follow
+	if c.Has("ErrorAction") {
+		vars["erroractionpreference"] = &Variable{Name: "ErrorActionPreference", Value: c.String("ErrorAction")}
+	}
+	if c.Switch("Verbose") {
+		vars["verbosepreference"] = &Variable{Name: "VerbosePreference", Value: "Continue"}
+	}
+	if c.Switch("WhatIf") {
+		vars["whatifpreference"] = &Variable{Name: "WhatIfPreference", Value: true}
+	}
+	return nil
+}
+
+// boundParameters is $PSBoundParameters: the parameters the call bound
+func (f *Function) boundParameters(c *Call) *Hashtable {
+	h := NewHashtable()
+	for _, p := range append(append([]*Parameter{}, c.Cmdlet.Params...), commonParameters...) {
+		if c.Has(p.Name) {
+			h.Set(p.Name, c.Get(p.Name))
+		}
+	}
+	return h
+}
+
+// cmdletObject is $PSCmdlet, which gives an advanced function the
+// cmdlet's ShouldProcess and Write methods
+func (f *Function) cmdletObject(c *Call) *PSObject {
+	o := NewObject("System.Management.Automation.PSScriptCmdlet", "System.Management.Automation.PSCmdlet", "System.Management.Automation.Cmdlet").
+		Add("ParameterSetName", c.ParameterSet)
+	needs := func(name string, args []interface{}, n int) error {
+		if len(args) < n {
+			return fmt.Errorf("Cannot find an overload for \"%s\" and the argument count: \"%d\".", name, len(args))
+		}
+		return nil
+	}
+	o.AddMethod("ShouldProcess", func(args []interface{}) (interface{}, error) {
+		if err := needs("ShouldProcess", args, 1); err != nil {
+			return nil, err
+		}
+		operation := f.Name
+		if len(args) > 1 {
+			operation = toString(args[1])
+		}
+		return c.ShouldProcess(toString(args[0]), operation), nil
+	})
+	o.AddMethod("WriteVerbose", func(args []interface{}) (interface{}, error) {
+		if err := needs("WriteVerbose", args, 1); err != nil {
+			return nil, err
+		}
+		c.WriteVerbose(toString(args[0]))
+		return nil, nil
+	})
+	o.AddMethod("WriteWarning", func(args []interface{}) (interface{}, error) {
+		if err := needs("WriteWarning", args, 1); err != nil {
+			return nil, err
+		}
+		c.WriteWarning(toString(args[0]))
+		return nil, nil
+	})
+	return o
+}
+
+// functionNames lists the names of the functions defined in a scope, sorted
+func (s *Scope) functionNames() []string {
+	var names []string
+	for _, f := range s.functions {
+		names = append(names, f.Name)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names
+}
+
+// moduleScope returns the scope of the module the current code belongs to, if any
+func (s *Scope) moduleScope() *Scope {
+	for sc := s; sc != nil; sc = sc.parent {
+		if sc.module != nil {
+			return sc
+		}
+	}
+	return nil
+}
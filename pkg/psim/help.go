@@ -0,0 +1,521 @@
+package psim
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// helpFiles hold the help of the built-in commands, one file per module
+//
+//go:embed help/*.json
+var helpFiles embed.FS
+
+// helpFile is the layout of a help file
+type helpFile struct {
+	Module   string       `json:"module"`
+	Version  string       `json:"version"`
+	Commands []*HelpTopic `json:"commands"`
+}
+
+// HelpTopic is the help of one command. The syntax and the position,
+// aliases, parameter sets and pipeline input of each parameter come from
+// the command itself, so they always match what the simulator accepts.
+type HelpTopic struct {
+	Name        string          `json:"name"`
+	Category    string          `json:"category"` // Cmdlet unless the help file says otherwise
+	Synopsis    string          `json:"synopsis"`
+	Description string          `json:"description"`
+	Parameters  []HelpParameter `json:"parameters"`
+	Inputs      []string        `json:"inputs"`
+	Outputs     []string        `json:"outputs"`
+	Notes       string          `json:"notes"`
+	Examples    []HelpExample   `json:"examples"`
+	Related     []string        `json:"related"`
+
+	Module  string   `json:"-"`
+	Version string   `json:"-"`
+	Syntax  []string `json:"-"` // one line per parameter set
+	Partial bool     `json:"-"` // no help file describes the command
+}
+
+// HelpParameter describes one parameter of a command
+type HelpParameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // String when empty
+	Description string `json:"description"`
+	Wildcards   bool   `json:"wildcards"`
+	Default     string `json:"default"`
+
+	Position string   `json:"-"` // 0-based position, or Named
+	Aliases  []string `json:"-"`
+	Switch   bool     `json:"-"`
+	Required bool     `json:"-"`
+	Sets     []string `json:"-"` // parameter sets the parameter is in; empty means every set
+	Pipeline string   `json:"-"` // e.g. "True (ByValue)"; False when empty
+}
+
+// HelpExample is one example of a help topic
+type HelpExample struct {
+	Title   string `json:"title"`
+	Code    string `json:"code"`
+	Remarks string `json:"remarks"`
+}
+
+// HelpLevel selects how much of a topic Get-Help shows
+type HelpLevel int
+
+const (
+	HelpBasic HelpLevel = iota
+	HelpDetailed
+	HelpFull
+	HelpExamples
+)
+
+var (
+	helpOnce  sync.Once
+	helpIndex map[string]*HelpTopic // keyed by lowercased command name
+)
+
+// loadHelp reads the embedded help files
+func loadHelp() map[string]*HelpTopic {
+	helpOnce.Do(func() {
+		helpIndex = map[string]*HelpTopic{}
+		entries, err := helpFiles.ReadDir("help")
+		if err != nil {
+			panic(err)
+		}
+		for _, e := range entries {
+			data, err := helpFiles.ReadFile("help/" + e.Name())
+			if err != nil {
+				panic(err)
+			}
+			var f helpFile
+			if err := json.Unmarshal(data, &f); err != nil {
+				panic(fmt.Sprintf("help/%s: %v", e.Name(), err))
+			}
+			for _, t := range f.Commands {
+				t.Module, t.Version = f.Module, f.Version
+				if t.Category == "" {
+					t.Category = "Cmdlet"
+				}
+				helpIndex[strings.ToLower(t.Name)] = t
+			}
+		}
+	})
+	return helpIndex
+}
+
+// helpFor builds the help topic of a cmdlet from its help file entry and its parameters
+func helpFor(c *Cmdlet) *HelpTopic {
+	t := &HelpTopic{Name: c.Name, Category: "Cmdlet", Partial: true}
+	if c.Function != nil {
+		t.Category, t.Module = "Function", c.Function.Module
+	} else if src, ok := loadHelp()[strings.ToLower(c.Name)]; ok {
+		copied := *src
+		t = &copied
+	}
+	described := map[string]HelpParameter{}
+	for _, p := range t.Parameters {
+		described[strings.ToLower(p.Name)] = p
+	}
+	t.Parameters = nil
+	for _, p := range c.Params {
+		hp, ok := described[strings.ToLower(p.Name)]
+		if !ok {
+			hp = HelpParameter{Name: p.Name}
+		}
+		hp.Name = p.Name
+		hp.Aliases = p.Aliases
+		hp.Switch = p.Switch
+		hp.Required = p.Mandatory
+		hp.Sets = p.Sets
+		hp.Pipeline = pipelineText(p)
+		hp.Position = "Named"
+		if p.Position > 0 {
+			hp.Position = strconv.Itoa(p.Position - 1)
+		}
+		switch {
+		case p.Switch:
+			hp.Type = "SwitchParameter"
+		case c.Function != nil && p.Type != "":
+			hp.Type = shortTypeName(p.Type)
+		case c.Function != nil:
+			hp.Type = "Object"
+		case hp.Type == "":
+			hp.Type = "String"
+		}
+		t.Parameters = append(t.Parameters, hp)
+	}
+	t.Syntax = syntaxLines(c, t.Parameters)
+	return t
+}
+
+// pipelineText describes the pipeline input a parameter accepts as Get-Help -Full shows it
+func pipelineText(p *Parameter) string {
+	var kinds []string
+	if p.ValueFromPipelineByPropertyName {
+		kinds = append(kinds, "ByPropertyName")
+	}
+	if p.ValueFromPipeline {
+		kinds = append(kinds, "ByValue")
+	}
+	if len(kinds) == 0 {
+		return ""
+	}
+	return "True (" + strings.Join(kinds, ", ") + ")"
+}
+
+// syntaxLines writes one usage line per parameter set, positional
+// parameters first
+func syntaxLines(c *Cmdlet, params []HelpParameter) []string {
+	ordered := make([]int, len(params))
+	for i := range ordered {
+		ordered[i] = i
+	}
+	sort.SliceStable(ordered, func(a, b int) bool {
+		pa, pb := c.Params[ordered[a]].Position, c.Params[ordered[b]].Position
+		return pa > 0 && (pb == 0 || pa < pb)
+	})
+	var lines []string
+	for _, set := range c.parameterSets() {
+		parts := []string{c.Name}
+		for _, i := range ordered {
+			p := params[i]
+			if len(p.Sets) > 0 && !containsFold(p.Sets, set) {
+				continue
+			}
+			name := "-" + p.Name
+			if p.Position != "Named" {
+				name = "[" + name + "]"
+			}
+			text := name
+			if !p.Switch {
+				text += " <" + p.Type + ">"
+			}
+			if !p.Required {
+				text = "[" + text + "]"
+			}
+			parts = append(parts, text)
+		}
+		lines = append(lines, strings.Join(append(parts, "[<CommonParameters>]"), " "))
+	}
+	return lines
+}
+
+// CommandHelp returns the help of a built-in command, looked up by name or alias
+func CommandHelp(name string) (*HelpTopic, bool) {
+	key := strings.ToLower(name)
+	if target, ok := builtinAliases[key]; ok {
+		key = strings.ToLower(target)
+	}
+	c, ok := builtinCommands()[key]
+	if !ok {
+		return nil, false
+	}
+	return helpFor(c), true
+}
+
+// CommandAt returns the name of the command whose statement contains the
+// given offset of a script, or the last command before it when the cursor
+// sits in an empty statement such as the end of "Get-Process | ". It works
+// on text that doesn't parse yet, as code being typed often doesn't.
+func CommandAt(src string, offset int) string {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	// Extend to the end of the word under the cursor
+	end := offset
+	for end < len(src) && !isSpace(src[end]) && !strings.ContainsRune("|;(){}\r\n", rune(src[end])) {
+		end++
+	}
+	last, current := "", ""
+	start := 0
+	var quote byte
+	comment := false
+	take := func(i int) {
+		current = statementCommand(src[start:i])
+		if current != "" {
+			last = current
+		}
+	}
+	for i := 0; i < end; i++ {
+		ch := src[i]
+		switch {
+		case comment:
+			if ch == '\n' {
+				comment = false
+				start = i + 1
+			}
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '#':
+			take(i)
+			comment = true
+		case strings.ContainsRune("|;(){}\n", rune(ch)):
+			take(i)
+			start = i + 1
+		}
+	}
+	if !comment {
+		take(end)
+	}
+	if current == "" {
+		return last
+	}
+	return current
+}
+
+// statementCommand returns the command name a statement starts with, if it starts with one
+func statementCommand(stmt string) string {
+	fields := strings.Fields(stmt)
+	// "$x = Get-Process" runs Get-Process
+	if len(fields) > 2 && strings.HasPrefix(fields[0], "$") && strings.HasSuffix(fields[1], "=") {
+		fields = fields[2:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	word := fields[0]
+	if word == "&" || word == "." {
+		return ""
+	}
+	first := word[0]
+	if !isLetter(first) || keywords[strings.ToLower(word)] {
+		return ""
+	}
+	return word
+}
+
+// Text renders the topic the way Get-Help does at the given level, wrapping
+// prose to width
+func (t *HelpTopic) Text(level HelpLevel, width int) string {
+	var b strings.Builder
+	para := func(indent int, text string) {
+		pad := strings.Repeat(" ", indent)
+		for _, p := range strings.Split(text, "\n") {
+			for _, line := range wrapText(p, width-indent) {
+				b.WriteString(strings.TrimRight(pad+line, " ") + "\n")
+			}
+		}
+	}
+	section := func(title string) {
+		b.WriteString(title + "\n")
+	}
+	b.WriteString("\n")
+	section("NAME")
+	para(4, t.Name)
+	b.WriteString("\n")
+	section("SYNOPSIS")
+	synopsis := t.Synopsis
+	if t.Partial {
+		synopsis = t.Name + " [<CommonParameters>]"
+	}
+	para(4, synopsis)
+	b.WriteString("\n")
+	if level == HelpExamples {
+		t.writeExamples(&b, para)
+		return b.String()
+	}
+	b.WriteString("\n")
+	section("SYNTAX")
+	for i, line := range t.Syntax {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for j, wrapped := range wrapText(line, width-8) {
+			if j == 0 {
+				b.WriteString("    " + wrapped + "\n")
+			} else {
+				b.WriteString("        " + wrapped + "\n")
+			}
+		}
+	}
+	b.WriteString("\n\n")
+	if t.Description != "" {
+		section("DESCRIPTION")
+		para(4, t.Description)
+		b.WriteString("\n\n")
+	}
+	if level == HelpDetailed || level == HelpFull {
+		section("PARAMETERS")
+		for _, p := range t.Parameters {
+			t.writeParameter(&b, p, 4, level == HelpFull, width)
+		}
+		section("    <CommonParameters>")
+		para(8, "This cmdlet supports the common parameters: Verbose, Debug, ErrorAction, ErrorVariable, WarningAction, WarningVariable, OutBuffer, PipelineVariable, and OutVariable. For more information, see about_CommonParameters (https:/go.microsoft.com/fwlink/?LinkID=113216).")
+		b.WriteString("\n")
+	}
+	if level == HelpFull {
+		for _, s := range []struct {
+			title string
+			items []string
+		}{{"INPUTS", t.Inputs}, {"OUTPUTS", t.Outputs}} {
+			if len(s.items) == 0 {
+				continue
+			}
+			section(s.title)
+			for _, item := range s.items {
+				para(4, item)
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+		if t.Notes != "" {
+			section("NOTES")
+			para(8, t.Notes)
+			b.WriteString("\n")
+		}
+	}
+	if level == HelpDetailed || level == HelpFull {
+		t.writeExamples(&b, para)
+	}
+	if len(t.Related) > 0 {
+		section("RELATED LINKS")
+		for _, r := range t.Related {
+			para(4, r)
+		}
+		b.WriteString("\n")
+	}
+	if level == HelpBasic {
+		section("REMARKS")
+		if t.Partial {
+			para(4, "Get-Help cannot find the Help files for this cmdlet on this computer. It is displaying only partial help.")
+		} else {
+			para(4, fmt.Sprintf("To see the examples, type: \"Get-Help %s -Examples\"", t.Name))
+			para(4, fmt.Sprintf("For more information, type: \"Get-Help %s -Detailed\"", t.Name))
+			para(4, fmt.Sprintf("For technical information, type: \"Get-Help %s -Full\"", t.Name))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (t *HelpTopic) writeExamples(b *strings.Builder, para func(int, string)) {
+	if len(t.Examples) > 0 {
+		b.WriteString("    -------------------------- EXAMPLES --------------------------\n\n")
+	}
+	for i, ex := range t.Examples {
+		title := fmt.Sprintf("Example %d", i+1)
+		if ex.Title != "" {
+			title += ": " + ex.Title
+		}
+		b.WriteString("    ---------- " + title + " ----------\n\n")
+		para(4, ex.Code)
+		b.WriteString("\n")
+		if ex.Remarks != "" {
+			para(4, ex.Remarks)
+			b.WriteString("\n")
+		}
+	}
+}
+
+// ParameterText renders the help of the parameters whose names match a
+// pattern, as Get-Help -Parameter does
+func (t *HelpTopic) ParameterText(pattern string, width int) (string, bool) {
+	var b strings.Builder
+	found := false
+	for _, p := range t.Parameters {
+		if MatchWildcard(pattern, p.Name, false) {
+			if !found {
+				b.WriteString("\n")
+			}
+			found = true
+			t.writeParameter(&b, p, 0, true, width)
+		}
+	}
+	return b.String(), found
+}
+
+func (t *HelpTopic) writeParameter(b *strings.Builder, p HelpParameter, indent int, full bool, width int) {
+	pad := strings.Repeat(" ", indent)
+	head := pad + "-" + p.Name
+	if !p.Switch {
+		head += " <" + p.Type + ">"
+	}
+	b.WriteString(head + "\n")
+	inner := strings.Repeat(" ", indent+4)
+	if p.Description != "" {
+		for _, para := range strings.Split(p.Description, "\n") {
+			for _, line := range wrapText(para, width-indent-4) {
+				b.WriteString(strings.TrimRight(inner+line, " ") + "\n")
+			}
+		}
+		b.WriteString("\n")
+	}
+	if full {
+		def := p.Default
+		if def == "" {
+			def = "None"
+			if p.Switch {
+				def = "False"
+			}
+		}
+		pipeline := p.Pipeline
+		if pipeline == "" {
+			pipeline = "False"
+		}
+		rows := [][2]string{
+			{"Required?", strconv.FormatBool(p.Required)},
+			{"Position?", p.Position},
+			{"Default value", def},
+			{"Accept pipeline input?", pipeline},
+		}
+		if len(p.Aliases) > 0 {
+			rows = append(rows, [2]string{"Aliases", strings.Join(p.Aliases, ", ")})
+		}
+		rows = append(rows, [2]string{"Accept wildcard characters?", strconv.FormatBool(p.Wildcards)})
+		for _, r := range rows {
+			b.WriteString(inner + pad2(r[0], 28) + " " + r[1] + "\n")
+		}
+		b.WriteString("\n")
+	}
+}
+
+func pad2(s string, width int) string {
+	return pad(s, width, alignLeft)
+}
+
+// defaultHelpText is what Get-Help shows without a topic
+const defaultHelpText = `
+TOPIC
+    PowerShell Help System
+
+SHORT DESCRIPTION
+    Displays help about PowerShell cmdlets and concepts.
+
+LONG DESCRIPTION
+    PowerShell Help describes PowerShell cmdlets, functions, scripts, and
+    modules, and explains concepts, including the elements of the PowerShell
+    language.
+
+    To get help for a cmdlet, type:
+
+        Get-Help <cmdlet-name>
+
+    For example:
+
+        Get-Help Get-Process
+
+    To see only the examples, the details of one parameter or everything:
+
+        Get-Help Get-Process -Examples
+        Get-Help Get-Process -Parameter Name
+        Get-Help Get-Process -Full
+
+    To list the commands whose names match a pattern, use wildcards:
+
+        Get-Help *-Item
+
+    Get-Command finds commands by verb, noun or module:
+
+        Get-Command -Verb Get -Noun *Mailbox*
+`
@@ -0,0 +1,171 @@
+package psim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// isoDate matches the ISO 8601 timestamps PowerShell 7 turns into DateTime
+// values when it reads JSON
+var isoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+
+// decodeJSON parses JSON text into PowerShell values: objects become
+// PSCustomObjects with their members in document order, arrays become
+// []interface{}, integers int and other numbers float64
+func decodeJSON(text string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Additional text encountered after finished reading JSON content.")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("Conversion from JSON failed with error: %v", err)
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := NewCustomObject()
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, fmt.Errorf("Conversion from JSON failed with error: %v", err)
+				}
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj.Add(key.(string), v)
+			}
+			dec.Token()
+			return obj, nil
+		case '[':
+			list := []interface{}{}
+			for dec.More() {
+				v, err := decodeJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			dec.Token()
+			return list, nil
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int(n), nil
+		}
+		f, _ := t.Float64()
+		return f, nil
+	case string:
+		if isoDate.MatchString(t) {
+			if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return ts, nil
+			}
+			if ts, err := time.ParseInLocation("2006-01-02T15:04:05", t, time.Local); err == nil {
+				return ts, nil
+			}
+		}
+		return t, nil
+	}
+	return tok, nil
+}
+
+// encodeJSON serializes a value as compact JSON. Hashtables and objects
+// become JSON objects and nesting stops at depth, where values fall back to
+// their string form as ConvertTo-Json does.
+func encodeJSON(v interface{}, depth int) string {
+	var buf bytes.Buffer
+	writeJSON(&buf, v, depth)
+	return buf.String()
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}, depth int) {
+	writeString := func(s string) {
+		// ConvertTo-Json leaves <, > and & alone
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.Encode(s)
+		buf.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	}
+	switch x := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(fmt.Sprint(x))
+	case int, int64, float64:
+		b, _ := json.Marshal(x)
+		buf.Write(b)
+	case string:
+		writeString(x)
+	case time.Time:
+		writeString(x.Format("2006-01-02T15:04:05.0000000Z07:00"))
+	case *Hashtable:
+		if depth < 0 {
+			writeString(toString(x))
+			return
+		}
+		keys := x.Keys()
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			val, _ := x.Get(k)
+			writeString(toString(k))
+			buf.WriteByte(':')
+			writeJSON(buf, val, depth-1)
+		}
+		buf.WriteByte('}')
+	case *PSObject:
+		if depth < 0 || len(x.Properties()) == 0 {
+			writeString(toString(x))
+			return
+		}
+		buf.WriteByte('{')
+		for i, p := range x.Properties() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(p.Name)
+			buf.WriteByte(':')
+			writeJSON(buf, p.Current(), depth-1)
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		if depth < 0 {
+			writeString(toString(x))
+			return
+		}
+		buf.WriteByte('[')
+		for i, item := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSON(buf, item, depth-1)
+		}
+		buf.WriteByte(']')
+	default:
+		if list, ok := v.([]string); ok {
+			writeJSON(buf, stringsToValues(list), depth)
+			return
+		}
+		writeString(toString(v))
+	}
+}
@@ -0,0 +1,926 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// getMember implements target.Name, including member enumeration over arrays
+func (rs *Runspace) getMember(target interface{}, name string) (interface{}, error) {
+	if target != nil && strings.EqualFold(name, "PSObject") {
+		return rs.psObjectOf(target), nil
+	}
+	switch t := target.(type) {
+	case nil:
+		switch strings.ToLower(name) {
+		case "count", "length":
+			return 0, nil
+		}
+		return nil, nil
+	case *Hashtable:
+		if v, ok := t.Get(name); ok {
+			return v, nil
+		}
+		switch strings.ToLower(name) {
+		case "count":
+			return t.Len(), nil
+		case "keys":
+			return t.Keys(), nil
+		case "values":
+			return hashValues(t), nil
+		case "isfixedsize", "isreadonly", "issynchronized":
+			return false, nil
+		case "syncroot":
+			return t, nil
+		}
+		return nil, nil
+	case *PSObject:
+		if v, ok := t.Get(name); ok {
+			return v, nil
+		}
+		if strings.EqualFold(name, "PSTypeNames") {
+			return stringsToValues(t.TypeNames), nil
+		}
+	case []interface{}:
+		switch strings.ToLower(name) {
+		case "count", "length":
+			return len(t), nil
+		case "longlength":
+			return len(t), nil
+		case "rank":
+			return 1, nil
+		case "isfixedsize":
+			return true, nil
+		case "isreadonly", "issynchronized":
+			return false, nil
+		case "syncroot":
+			return t, nil
+		}
+		var out []interface{}
+		for _, item := range t {
+			v, err := rs.getMember(item, name)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue
+			}
+			if list, ok := v.([]interface{}); ok {
+				out = append(out, list...)
+			} else {
+				out = append(out, v)
+			}
+		}
+		return unwrap(out), nil
+	case string:
+		if strings.EqualFold(name, "Length") {
+			return len([]rune(t)), nil
+		}
+	case time.Time:
+		if v, ok := dateProperty(t, name); ok {
+			return v, nil
+		}
+	case time.Duration:
+		if v, ok := timeSpanProperty(t, name); ok {
+			return v, nil
+		}
+	case *TypeInfo:
+		if v, ok := typeMember(t, name); ok {
+			return v, nil
+		}
+	case *ScriptBlock:
+		switch strings.ToLower(name) {
+		case "ast":
+			return t.Ast.Text, nil
+		case "isfilter":
+			return false, nil
+		}
+	case *SecureString:
+		if strings.EqualFold(name, "Length") {
+			return len([]rune(t.text)), nil
+		}
+	case *RuntimeError:
+		if v, ok := t.object().Get(name); ok {
+			return v, nil
+		}
+	}
+	// Every scalar has an implicit Count and Length of 1
+	switch strings.ToLower(name) {
+	case "count", "length":
+		return 1, nil
+	case "pstypenames":
+		return stringsToValues(typeHierarchy(target)), nil
+	}
+	return nil, nil
+}
+
+func hashValues(h *Hashtable) []interface{} {
+	out := make([]interface{}, 0, h.Len())
+	for _, k := range h.Keys() {
+		v, _ := h.Get(k)
+		out = append(out, v)
+	}
+	return out
+}
+
+func stringsToValues(s []string) []interface{} {
+	out := make([]interface{}, len(s))
+	for i, v := range s {
+		out[i] = v
+	}
+	return out
+}
+
+func setMember(target interface{}, name string, value interface{}) error {
+	switch t := target.(type) {
+	case *Hashtable:
+		t.Set(name, value)
+		return nil
+	case *PSObject:
+		p := t.Property(name)
+		if p == nil {
+			return fmt.Errorf("The property '%s' cannot be found on this object. Verify that the property exists and can be set.", name)
+		}
+		if p.alias != "" {
+			return setMember(t, p.alias, value)
+		}
+		if p.Get != nil {
+			return fmt.Errorf("'%s' is a ReadOnly property.", p.Name)
+		}
+		p.Value = value
+		return nil
+	}
+	return fmt.Errorf("The property '%s' cannot be found on this object. Verify that the property exists and can be set.", name)
+}
+
+func indexValue(target, index interface{}) (interface{}, error) {
+	if target == nil {
+		return nil, fmt.Errorf("Cannot index into a null array.")
+	}
+	if h, ok := target.(*Hashtable); ok {
+		if keys, ok := index.([]interface{}); ok {
+			var out []interface{}
+			for _, k := range keys {
+				v, _ := h.Get(k)
+				out = append(out, v)
+			}
+			return out, nil
+		}
+		v, _ := h.Get(index)
+		return v, nil
+	}
+	if indexes, ok := index.([]interface{}); ok {
+		var out []interface{}
+		for _, i := range indexes {
+			v, err := indexValue(target, i)
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				out = append(out, v)
+			}
+		}
+		return out, nil
+	}
+	i, err := toInt(index)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case []interface{}:
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return nil, nil
+		}
+		return t[i], nil
+	case string:
+		r := []rune(t)
+		if i < 0 {
+			i += len(r)
+		}
+		if i < 0 || i >= len(r) {
+			return nil, nil
+		}
+		return r[i], nil
+	case *PSObject:
+		if o, ok := t.Get(toString(index)); ok {
+			return o, nil
+		}
+	}
+	// Scalars behave like one-element arrays
+	if i == 0 || i == -1 {
+		return target, nil
+	}
+	return nil, nil
+}
+
+func setIndex(target, index, value interface{}) error {
+	switch t := target.(type) {
+	case []interface{}:
+		i, err := toInt(index)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return fmt.Errorf("Index was outside the bounds of the array.")
+		}
+		t[i] = value
+		return nil
+	case *Hashtable:
+		t.Set(index, value)
+		return nil
+	case nil:
+		return fmt.Errorf("Cannot index into a null array.")
+	}
+	return fmt.Errorf("Unable to index into an object of type %s.", typeName(target))
+}
+
+// invokeMethod implements target.Name(args)
+func (rs *Runspace) invokeMethod(target interface{}, name string, args []interface{}) (interface{}, error) {
+	lname := strings.ToLower(name)
+	if target == nil {
+		return nil, fmt.Errorf("You cannot call a method on a null-valued expression.")
+	}
+	switch lname {
+	case "gettype":
+		if len(args) == 0 {
+			return typeOf(target), nil
+		}
+	case "gethashcode":
+		if len(args) == 0 {
+			return hashCode(target), nil
+		}
+	case "gettypecode":
+		if code, ok := typeCode(target); ok && len(args) == 0 {
+			return code, nil
+		}
+	case "equals":
+		if len(args) == 1 {
+			return valuesEqual(target, args[0], true), nil
+		}
+	}
+	var (
+		v       interface{}
+		handled bool
+		err     error
+	)
+	switch t := target.(type) {
+	case string:
+		v, handled, err = stringMethod(t, lname, args)
+	case []interface{}:
+		v, handled, err = rs.arrayMethod(t, lname, args)
+	case *Hashtable:
+		v, handled, err = hashtableMethod(t, lname, args)
+	case time.Time:
+		v, handled, err = dateMethod(t, lname, args)
+	case time.Duration:
+		v, handled, err = timeSpanMethod(t, lname, args)
+	case int, float64:
+		if lname == "tostring" {
+			if len(args) == 0 {
+				return toString(t), nil
+			}
+			s, err := formatValue(t, toString(args[0]))
+			return s, err
+		}
+		if lname == "compareto" && len(args) == 1 {
+			return compareValues(t, args[0], false)
+		}
+	case bool, rune:
+		if lname == "compareto" && len(args) == 1 {
+			return compareValues(t, args[0], false)
+		}
+	case *TypeInfo:
+		if lname == "getelementtype" && len(args) == 0 {
+			if !strings.HasSuffix(t.Name, "[]") {
+				return nil, nil
+			}
+			return &TypeInfo{Name: strings.TrimSuffix(t.Name, "[]")}, nil
+		}
+	case *ScriptBlock:
+		switch lname {
+		case "getnewclosure":
+			return t, nil
+		case "invoke", "invokereturnasis":
+			var items []interface{}
+			err := rs.invokeBlock(t, invocation{newScope: true, args: args}, func(v interface{}) error {
+				items = append(items, v)
+				return nil
+			})
+			if lname == "invoke" {
+				if items == nil {
+					items = []interface{}{}
+				}
+				return items, err
+			}
+			return unwrap(items), err
+		}
+	case *PSObject:
+		if m := t.Method(name); m != nil {
+			return m.Call(args)
+		}
+	}
+	if err != nil || handled {
+		return v, err
+	}
+	if lname == "tostring" && len(args) == 0 {
+		return toString(target), nil
+	}
+	return nil, fmt.Errorf("Method invocation failed because [%s] does not contain a method named '%s'.", typeName(target), name)
+}
+
+func argCountError(name string, n int) error {
+	return fmt.Errorf("Cannot find an overload for \"%s\" and the argument count: \"%d\".", name, n)
+}
+
+func stringMethod(s, name string, args []interface{}) (interface{}, bool, error) {
+	argString := func(i int) string { return toString(args[i]) }
+	argInt := func(i int) (int, error) { return toInt(args[i]) }
+	runes := []rune(s)
+	switch name {
+	case "toupper", "toupperinvariant":
+		return strings.ToUpper(s), true, nil
+	case "tolower", "tolowerinvariant":
+		return strings.ToLower(s), true, nil
+	case "trim", "trimstart", "trimend":
+		cut := " \t\r\n"
+		if len(args) > 0 {
+			cut = ""
+			for _, a := range args {
+				cut += toString(a)
+			}
+		}
+		switch name {
+		case "trimstart":
+			return strings.TrimLeft(s, cut), true, nil
+		case "trimend":
+			return strings.TrimRight(s, cut), true, nil
+		}
+		return strings.Trim(s, cut), true, nil
+	case "contains":
+		if len(args) != 1 {
+			return nil, true, argCountError("Contains", len(args))
+		}
+		return strings.Contains(s, argString(0)), true, nil
+	case "startswith", "endswith":
+		if len(args) == 0 {
+			return nil, true, argCountError(name, 0)
+		}
+		a, b := s, argString(0)
+		if len(args) > 1 && strings.Contains(strings.ToLower(toString(args[1])), "ignorecase") {
+			a, b = strings.ToLower(a), strings.ToLower(b)
+		}
+		if name == "startswith" {
+			return strings.HasPrefix(a, b), true, nil
+		}
+		return strings.HasSuffix(a, b), true, nil
+	case "indexof", "lastindexof":
+		if len(args) == 0 {
+			return nil, true, argCountError(name, 0)
+		}
+		var i int
+		if name == "indexof" {
+			i = strings.Index(s, argString(0))
+		} else {
+			i = strings.LastIndex(s, argString(0))
+		}
+		if i < 0 {
+			return -1, true, nil
+		}
+		return len([]rune(s[:i])), true, nil
+	case "replace":
+		if len(args) != 2 {
+			return nil, true, argCountError("Replace", len(args))
+		}
+		return strings.ReplaceAll(s, argString(0), argString(1)), true, nil
+	case "split":
+		if len(args) == 0 {
+			return stringsToValues(strings.Fields(s)), true, nil
+		}
+		seps, removeEmpty := "", false
+		for _, a := range args {
+			if _, isNum := a.(int); isNum {
+				continue
+			}
+			if strings.EqualFold(toString(a), "RemoveEmptyEntries") {
+				removeEmpty = true
+				continue
+			}
+			seps += toString(a)
+		}
+		var out []interface{}
+		for _, part := range splitAny(s, seps) {
+			if part != "" || !removeEmpty {
+				out = append(out, part)
+			}
+		}
+		return out, true, nil
+	case "substring":
+		if len(args) == 0 {
+			return nil, true, argCountError("Substring", 0)
+		}
+		start, err := argInt(0)
+		if err != nil {
+			return nil, true, err
+		}
+		if start < 0 || start > len(runes) {
+			return nil, true, fmt.Errorf("Exception calling \"Substring\" with \"%d\" argument(s): \"startIndex cannot be larger than length of string.\"", len(args))
+		}
+		if len(args) == 1 {
+			return string(runes[start:]), true, nil
+		}
+		length, err := argInt(1)
+		if err != nil {
+			return nil, true, err
+		}
+		if length < 0 || start+length > len(runes) {
+			return nil, true, fmt.Errorf("Exception calling \"Substring\" with \"2\" argument(s): \"Index and length must refer to a location within the string.\"")
+		}
+		return string(runes[start : start+length]), true, nil
+	case "padleft", "padright":
+		if len(args) == 0 {
+			return nil, true, argCountError(name, 0)
+		}
+		width, err := argInt(0)
+		if err != nil {
+			return nil, true, err
+		}
+		pad := " "
+		if len(args) > 1 {
+			pad = argString(1)
+		}
+		if n := width - len(runes); n > 0 {
+			fill := strings.Repeat(pad, n)
+			if name == "padleft" {
+				return fill + s, true, nil
+			}
+			return s + fill, true, nil
+		}
+		return s, true, nil
+	case "insert":
+		if len(args) != 2 {
+			return nil, true, argCountError("Insert", len(args))
+		}
+		i, err := argInt(0)
+		if err != nil || i < 0 || i > len(runes) {
+			return nil, true, fmt.Errorf("Exception calling \"Insert\" with \"2\" argument(s): \"Specified argument was out of the range of valid values.\"")
+		}
+		return string(runes[:i]) + argString(1) + string(runes[i:]), true, nil
+	case "remove":
+		if len(args) == 0 {
+			return nil, true, argCountError("Remove", 0)
+		}
+		start, err := argInt(0)
+		if err != nil || start < 0 || start > len(runes) {
+			return nil, true, fmt.Errorf("Exception calling \"Remove\" with \"%d\" argument(s): \"startIndex must be less than length of string.\"", len(args))
+		}
+		end := len(runes)
+		if len(args) > 1 {
+			n, err := argInt(1)
+			if err != nil || start+n > len(runes) {
+				return nil, true, fmt.Errorf("Exception calling \"Remove\" with \"2\" argument(s): \"Index and count must refer to a location within the string.\"")
+			}
+			end = start + n
+		}
+		return string(runes[:start]) + string(runes[end:]), true, nil
+	case "clone":
+		return s, true, nil
+	case "tochararray":
+		out := make([]interface{}, len(runes))
+		for i, r := range runes {
+			out[i] = r
+		}
+		return out, true, nil
+	case "compareto":
+		if len(args) != 1 {
+			return nil, true, argCountError("CompareTo", len(args))
+		}
+		return compareStrings(s, argString(0), true), true, nil
+	case "tostring":
+		return s, true, nil
+	case "normalize":
+		return s, true, nil
+	case "isnormalized":
+		return true, true, nil
+	case "getenumerator":
+		return stringsToValues(strings.Split(s, "")), true, nil
+	}
+	return nil, false, nil
+}
+
+// splitAny splits s at every rune in seps, keeping empty entries like String.Split
+func splitAny(s, seps string) []string {
+	if seps == "" {
+		return strings.Fields(s)
+	}
+	var parts []string
+	start := 0
+	for i, r := range s {
+		if strings.ContainsRune(seps, r) {
+			parts = append(parts, s[start:i])
+			start = i + len(string(r))
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func (rs *Runspace) arrayMethod(list []interface{}, name string, args []interface{}) (interface{}, bool, error) {
+	switch name {
+	case "clear":
+		if len(args) != 0 {
+			return nil, true, argCountError("Clear", len(args))
+		}
+		if rs.isErrorList(list) {
+			rs.clearErrors()
+			return nil, true, nil
+		}
+		for i := range list {
+			list[i] = nil
+		}
+		return nil, true, nil
+	case "contains":
+		if len(args) != 1 {
+			return nil, true, argCountError("Contains", len(args))
+		}
+		for _, item := range list {
+			if valuesEqual(item, args[0], true) {
+				return true, true, nil
+			}
+		}
+		return false, true, nil
+	case "indexof":
+		if len(args) != 1 {
+			return nil, true, argCountError("IndexOf", len(args))
+		}
+		for i, item := range list {
+			if valuesEqual(item, args[0], true) {
+				return i, true, nil
+			}
+		}
+		return -1, true, nil
+	case "clone":
+		return append([]interface{}{}, list...), true, nil
+	case "get", "getvalue":
+		if len(args) != 1 {
+			return nil, true, argCountError(name, len(args))
+		}
+		i, err := toInt(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		if i < 0 || i >= len(list) {
+			return nil, true, fmt.Errorf("Exception calling \"GetValue\" with \"1\" argument(s): \"Index was outside the bounds of the array.\"")
+		}
+		return list[i], true, nil
+	case "set", "setvalue":
+		if len(args) != 2 {
+			return nil, true, argCountError(name, len(args))
+		}
+		// Set takes the index first, SetValue the value
+		index, value := args[0], args[1]
+		if name == "setvalue" {
+			index, value = args[1], args[0]
+		}
+		return nil, true, setIndex(list, index, value)
+	case "getlength", "getlowerbound", "getupperbound":
+		if len(args) != 1 {
+			return nil, true, argCountError(name, len(args))
+		}
+		if d, err := toInt(args[0]); err != nil || d != 0 {
+			return nil, true, fmt.Errorf("Exception calling \"%s\" with \"1\" argument(s): \"Index was outside the bounds of the array.\"", name)
+		}
+		switch name {
+		case "getlength":
+			return len(list), true, nil
+		case "getlowerbound":
+			return 0, true, nil
+		}
+		return len(list) - 1, true, nil
+	case "getenumerator":
+		return list, true, nil
+	case "foreach", "where":
+		if len(args) == 0 {
+			return nil, true, argCountError(name, 0)
+		}
+		out := []interface{}{}
+		sb, ok := args[0].(*ScriptBlock)
+		if !ok && name == "foreach" {
+			// .ForEach('Name') reads a property from each element
+			for _, item := range list {
+				v, err := rs.getMember(item, toString(args[0]))
+				if err != nil {
+					return nil, true, err
+				}
+				out = append(out, v)
+			}
+			return out, true, nil
+		}
+		if !ok {
+			return nil, true, fmt.Errorf("Cannot convert the \"%s\" value of type \"%s\" to type \"System.Management.Automation.ScriptBlock\".", toString(args[0]), typeName(args[0]))
+		}
+		for _, item := range list {
+			if name == "where" {
+				v, err := rs.evalBlockValue(sb, item)
+				if err != nil {
+					return nil, true, err
+				}
+				if toBool(v) {
+					out = append(out, item)
+				}
+				continue
+			}
+			err := rs.invokeBlock(sb, invocation{underscore: item, hasUnder: true}, func(v interface{}) error {
+				out = append(out, v)
+				return nil
+			})
+			if err != nil {
+				return nil, true, err
+			}
+		}
+		return out, true, nil
+	case "tostring":
+		return "System.Object[]", true, nil
+	}
+	// Method calls enumerate over the elements too: $names.ToUpper()
+	var out []interface{}
+	for _, item := range list {
+		v, err := rs.invokeMethod(item, name, args)
+		if err != nil {
+			return nil, true, err
+		}
+		if v != nil {
+			out = append(out, v)
+		}
+	}
+	return unwrap(out), true, nil
+}
+
+func hashtableMethod(h *Hashtable, name string, args []interface{}) (interface{}, bool, error) {
+	switch name {
+	case "containskey", "contains":
+		if len(args) != 1 {
+			return nil, true, argCountError("ContainsKey", len(args))
+		}
+		return h.Has(args[0]), true, nil
+	case "containsvalue":
+		if len(args) != 1 {
+			return nil, true, argCountError("ContainsValue", len(args))
+		}
+		for _, v := range hashValues(h) {
+			if valuesEqual(v, args[0], false) {
+				return true, true, nil
+			}
+		}
+		return false, true, nil
+	case "add":
+		if len(args) != 2 {
+			return nil, true, argCountError("Add", len(args))
+		}
+		if h.Has(args[0]) {
+			return nil, true, fmt.Errorf("Exception calling \"Add\" with \"2\" argument(s): \"Item has already been added. Key in dictionary: '%s'  Key being added: '%s'\"", toString(args[0]), toString(args[0]))
+		}
+		h.Set(args[0], args[1])
+		return nil, true, nil
+	case "remove":
+		if len(args) != 1 {
+			return nil, true, argCountError("Remove", len(args))
+		}
+		h.Remove(args[0])
+		return nil, true, nil
+	case "clear":
+		for _, k := range h.Keys() {
+			h.Remove(k)
+		}
+		return nil, true, nil
+	case "clone":
+		return h.Copy(), true, nil
+	case "getenumerator":
+		var out []interface{}
+		for _, k := range h.Keys() {
+			v, _ := h.Get(k)
+			out = append(out, NewDictionaryEntry(k, v))
+		}
+		return out, true, nil
+	}
+	return nil, false, nil
+}
+
+// NewDictionaryEntry creates a key/value pair object like those returned by GetEnumerator()
+func NewDictionaryEntry(key, value interface{}) *PSObject {
+	o := NewObject("System.Collections.DictionaryEntry")
+	o.Add("Name", key)
+	o.Add("Key", key)
+	o.Add("Value", value)
+	return o
+}
+
+func dateProperty(t time.Time, name string) (interface{}, bool) {
+	switch strings.ToLower(name) {
+	case "year":
+		return t.Year(), true
+	case "month":
+		return int(t.Month()), true
+	case "day":
+		return t.Day(), true
+	case "hour":
+		return t.Hour(), true
+	case "minute":
+		return t.Minute(), true
+	case "second":
+		return t.Second(), true
+	case "millisecond":
+		return t.Nanosecond() / 1e6, true
+	case "dayofweek":
+		return t.Weekday().String(), true
+	case "dayofyear":
+		return t.YearDay(), true
+	case "date":
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), true
+	case "timeofday":
+		y, m, d := t.Date()
+		return t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location())), true
+	case "ticks":
+		return int(t.Sub(time.Date(1, 1, 1, 0, 0, 0, 0, t.Location())) / 100), true
+	case "kind":
+		return "Local", true
+	case "displayhint":
+		return "DateTime", true
+	case "datetime":
+		return t.Format("Monday, January 2, 2006 3:04:05 PM"), true
+	}
+	return nil, false
+}
+
+func dateMethod(t time.Time, name string, args []interface{}) (interface{}, bool, error) {
+	add := func(unit time.Duration) (interface{}, bool, error) {
+		if len(args) != 1 {
+			return nil, true, argCountError(name, len(args))
+		}
+		f, err := toFloat(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		return t.Add(time.Duration(f * float64(unit))), true, nil
+	}
+	switch name {
+	case "adddays":
+		return add(24 * time.Hour)
+	case "addhours":
+		return add(time.Hour)
+	case "addminutes":
+		return add(time.Minute)
+	case "addseconds":
+		return add(time.Second)
+	case "addmilliseconds":
+		return add(time.Millisecond)
+	case "addticks":
+		return add(100 * time.Nanosecond)
+	case "isdaylightsavingtime":
+		return t.IsDST(), true, nil
+	case "addmonths", "addyears":
+		if len(args) != 1 {
+			return nil, true, argCountError(name, len(args))
+		}
+		n, err := toInt(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		if name == "addmonths" {
+			return t.AddDate(0, n, 0), true, nil
+		}
+		return t.AddDate(n, 0, 0), true, nil
+	case "add":
+		if len(args) == 1 {
+			if d, ok := args[0].(time.Duration); ok {
+				return t.Add(d), true, nil
+			}
+		}
+		return nil, true, argCountError("Add", len(args))
+	case "subtract":
+		if len(args) == 1 {
+			switch a := args[0].(type) {
+			case time.Duration:
+				return t.Add(-a), true, nil
+			case time.Time:
+				return t.Sub(a), true, nil
+			}
+		}
+		return nil, true, argCountError("Subtract", len(args))
+	case "tostring":
+		if len(args) == 0 {
+			return toString(t), true, nil
+		}
+		s, err := formatValue(t, toString(args[0]))
+		return s, true, err
+	case "toshortdatestring":
+		return t.Format("1/2/2006"), true, nil
+	case "tolongdatestring":
+		return t.Format("Monday, January 2, 2006"), true, nil
+	case "toshorttimestring":
+		return t.Format("3:04 PM"), true, nil
+	case "tolongtimestring":
+		return t.Format("3:04:05 PM"), true, nil
+	case "touniversaltime":
+		return t.UTC(), true, nil
+	case "tolocaltime":
+		return t.Local(), true, nil
+	case "compareto":
+		if len(args) != 1 {
+			return nil, true, argCountError("CompareTo", len(args))
+		}
+		c, err := compareValues(t, args[0], false)
+		return c, true, err
+	}
+	return nil, false, nil
+}
+
+func timeSpanProperty(d time.Duration, name string) (interface{}, bool) {
+	switch strings.ToLower(name) {
+	case "days":
+		return int(d / (24 * time.Hour)), true
+	case "hours":
+		return int(d/time.Hour) % 24, true
+	case "minutes":
+		return int(d/time.Minute) % 60, true
+	case "seconds":
+		return int(d/time.Second) % 60, true
+	case "milliseconds":
+		return int(d/time.Millisecond) % 1000, true
+	case "totaldays":
+		return d.Hours() / 24, true
+	case "totalhours":
+		return d.Hours(), true
+	case "totalminutes":
+		return d.Minutes(), true
+	case "totalseconds":
+		return d.Seconds(), true
+	case "totalmilliseconds":
+		return float64(d) / float64(time.Millisecond), true
+	case "ticks":
+		return int(d / 100), true
+	}
+	return nil, false
+}
+
+func timeSpanMethod(d time.Duration, name string, args []interface{}) (interface{}, bool, error) {
+	switch name {
+	case "tostring":
+		return formatTimeSpan(d), true, nil
+	case "add", "subtract":
+		if len(args) == 1 {
+			if o, ok := args[0].(time.Duration); ok {
+				if name == "add" {
+					return d + o, true, nil
+				}
+				return d - o, true, nil
+			}
+		}
+		return nil, true, argCountError(name, len(args))
+	case "negate":
+		return -d, true, nil
+	case "duration":
+		if d < 0 {
+			return -d, true, nil
+		}
+		return d, true, nil
+	case "compareto":
+		if len(args) != 1 {
+			return nil, true, argCountError("CompareTo", len(args))
+		}
+		c, err := compareValues(d, args[0], false)
+		return c, true, err
+	}
+	return nil, false, nil
+}
+
+func charMethod(r rune, name string) (interface{}, bool) {
+	switch name {
+	case "isdigit":
+		return unicode.IsDigit(r), true
+	case "isletter":
+		return unicode.IsLetter(r), true
+	case "isletterordigit":
+		return unicode.IsLetter(r) || unicode.IsDigit(r), true
+	case "isupper":
+		return unicode.IsUpper(r), true
+	case "islower":
+		return unicode.IsLower(r), true
+	case "iswhitespace":
+		return unicode.IsSpace(r), true
+	case "ispunctuation":
+		return unicode.IsPunct(r), true
+	case "toupper":
+		return unicode.ToUpper(r), true
+	case "tolower":
+		return unicode.ToLower(r), true
+	}
+	return nil, false
+}
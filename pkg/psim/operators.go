@@ -0,0 +1,777 @@
+package psim
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// splitOp separates a comparison operator into its base name and case sensitivity: -ceq -> eq, true
+func splitOp(op string) (string, bool) {
+	name := strings.TrimPrefix(op, "-")
+	if len(name) > 2 && !dashOperators[name] {
+		switch name[0] {
+		case 'c':
+			return name[1:], true
+		case 'i':
+			return name[1:], false
+		}
+	}
+	return name, false
+}
+
+// compare applies a comparison, containment, matching or string operator
+func (rs *Runspace) compare(op string, left, right interface{}) (interface{}, error) {
+	name, cs := splitOp(op)
+	switch name {
+	case "contains", "notcontains":
+		found := false
+		for _, item := range asList(left) {
+			if valuesEqual(item, right, cs) {
+				found = true
+				break
+			}
+		}
+		return found == (name == "contains"), nil
+	case "in", "notin":
+		found := false
+		for _, item := range asList(right) {
+			if valuesEqual(item, left, cs) {
+				found = true
+				break
+			}
+		}
+		return found == (name == "in"), nil
+	case "replace":
+		return replaceOp(left, right, cs)
+	case "split":
+		return splitOpValue(left, right, cs)
+	case "join":
+		return joinValues(left, toString(right)), nil
+	case "is", "isnot":
+		t, ok := right.(*TypeInfo)
+		if !ok {
+			resolved, err := resolveType(toString(right))
+			if err != nil {
+				return nil, err
+			}
+			t = resolved
+		}
+		return isInstance(left, t.Name) == (name == "is"), nil
+	case "as":
+		t, ok := right.(*TypeInfo)
+		if !ok {
+			resolved, err := resolveType(toString(right))
+			if err != nil {
+				return nil, err
+			}
+			t = resolved
+		}
+		v, err := convertTo(left, t.Name)
+		if err != nil {
+			return nil, nil
+		}
+		return v, nil
+	case "shl", "shr":
+		l, err := toInt(left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := toInt(right)
+		if err != nil {
+			return nil, err
+		}
+		if name == "shl" {
+			return l << uint(r&63), nil
+		}
+		return l >> uint(r&63), nil
+	}
+
+	// Against an array, comparison operators filter the elements
+	if list, ok := left.([]interface{}); ok {
+		var matched []interface{}
+		for _, item := range list {
+			ok, err := rs.compareScalar(name, item, right, cs, false)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, item)
+			}
+		}
+		if matched == nil {
+			matched = []interface{}{}
+		}
+		return matched, nil
+	}
+	return rs.compareScalar(name, left, right, cs, true)
+}
+
+func (rs *Runspace) compareScalar(name string, left, right interface{}, cs, setMatches bool) (bool, error) {
+	switch name {
+	case "eq":
+		return valuesEqual(left, right, cs), nil
+	case "ne":
+		return !valuesEqual(left, right, cs), nil
+	case "gt", "ge", "lt", "le":
+		c, err := compareValues(left, right, cs)
+		if err != nil {
+			return false, err
+		}
+		switch name {
+		case "gt":
+			return c > 0, nil
+		case "ge":
+			return c >= 0, nil
+		case "lt":
+			return c < 0, nil
+		}
+		return c <= 0, nil
+	case "like", "notlike":
+		return MatchWildcard(toString(right), toString(left), cs) == (name == "like"), nil
+	case "match", "notmatch":
+		re, err := compileRegex(toString(right), cs)
+		if err != nil {
+			return false, err
+		}
+		m := re.FindStringSubmatch(toString(left))
+		if m != nil && setMatches && name == "match" {
+			rs.SetVariable("Matches", matchesTable(re, m))
+		}
+		return (m != nil) == (name == "match"), nil
+	}
+	return false, fmt.Errorf("The operator '-%s' is not supported.", name)
+}
+
+// valuesEqual implements -eq: the right operand is converted to the type of the left
+func valuesEqual(left, right interface{}, cs bool) bool {
+	switch l := left.(type) {
+	case nil:
+		return right == nil
+	case string:
+		if right == nil {
+			return false
+		}
+		r := toString(right)
+		if cs {
+			return l == r
+		}
+		return strings.EqualFold(l, r)
+	case bool:
+		if right == nil {
+			return false
+		}
+		return l == toBool(right)
+	case int, float64:
+		if right == nil {
+			return false
+		}
+		rn, err := toNumber(right)
+		if err != nil {
+			return false
+		}
+		lf, _ := toFloat(l)
+		rf, _ := toFloat(rn)
+		return lf == rf
+	case rune:
+		switch r := right.(type) {
+		case rune:
+			if cs {
+				return l == r
+			}
+			return strings.EqualFold(string(l), string(r))
+		case string:
+			if cs {
+				return string(l) == r
+			}
+			return strings.EqualFold(string(l), r)
+		case int:
+			return int(l) == r
+		}
+		return false
+	case time.Time:
+		if r, err := convertTo(right, "System.DateTime"); err == nil {
+			return l.Equal(r.(time.Time))
+		}
+		return false
+	case time.Duration:
+		r, ok := right.(time.Duration)
+		return ok && l == r
+	case *PSObject:
+		if r, ok := right.(*PSObject); ok {
+			return l == r
+		}
+		if s := l.String(); s != l.TypeName() {
+			return valuesEqual(s, right, cs)
+		}
+		return false
+	case *TypeInfo:
+		if r, ok := right.(*TypeInfo); ok {
+			return l.Name == r.Name
+		}
+		return strings.EqualFold(l.Name, toString(right))
+	}
+	return left == right
+}
+
+// compareValues orders two values, converting the right operand to the type of the left
+func compareValues(left, right interface{}, cs bool) (int, error) {
+	if left == nil {
+		if right == nil {
+			return 0, nil
+		}
+		return -1, nil
+	}
+	if right == nil {
+		return 1, nil
+	}
+	switch l := left.(type) {
+	case string:
+		return compareStrings(l, toString(right), cs), nil
+	case int, float64, bool:
+		rn, err := toNumber(right)
+		if err != nil {
+			return 0, fmt.Errorf("Could not compare \"%s\" to \"%s\". Error: \"%s\"", toString(left), toString(right), err.Error())
+		}
+		lf, _ := toFloat(l)
+		rf, _ := toFloat(rn)
+		switch {
+		case lf < rf:
+			return -1, nil
+		case lf > rf:
+			return 1, nil
+		}
+		return 0, nil
+	case rune:
+		return compareStrings(string(l), toString(right), cs), nil
+	case time.Time:
+		r, err := convertTo(right, "System.DateTime")
+		if err != nil {
+			return 0, fmt.Errorf("Could not compare \"%s\" to \"%s\". Error: \"%s\"", toString(left), toString(right), err.Error())
+		}
+		return l.Compare(r.(time.Time)), nil
+	case time.Duration:
+		r, ok := right.(time.Duration)
+		if !ok {
+			break
+		}
+		switch {
+		case l < r:
+			return -1, nil
+		case l > r:
+			return 1, nil
+		}
+		return 0, nil
+	case *PSObject:
+		if s := l.String(); s != l.TypeName() {
+			return compareValues(s, right, cs)
+		}
+	}
+	return 0, fmt.Errorf("Cannot compare \"%s\" because it is not IComparable.", toString(left))
+}
+
+func compareStrings(a, b string, cs bool) int {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb || !cs {
+		return strings.Compare(la, lb)
+	}
+	// Same letters: culture-aware comparison puts lowercase first
+	return -strings.Compare(a, b)
+}
+
+// MatchWildcard reports whether s matches a PowerShell wildcard pattern (* ? [abc])
+func MatchWildcard(pattern, s string, caseSensitive bool) bool {
+	re, err := wildcardRegex(pattern, caseSensitive)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}
+
+var regexCache sync.Map
+
+func cachedRegex(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(expr, re)
+	return re, nil
+}
+
+func wildcardRegex(pattern string, cs bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if !cs {
+		b.WriteString("(?is)")
+	} else {
+		b.WriteString("(?s)")
+	}
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '`':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return cachedRegex(b.String())
+}
+
+// HasWildcard reports whether a string contains wildcard characters
+func HasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+var namedGroup = regexp.MustCompile(`\(\?<([A-Za-z_][A-Za-z0-9_]*)>`)
+
+// compileRegex translates .NET regular expression syntax to Go's and compiles it
+func compileRegex(pattern string, cs bool) (*regexp.Regexp, error) {
+	expr := namedGroup.ReplaceAllString(pattern, "(?P<$1>")
+	if !cs {
+		expr = "(?i)" + expr
+	}
+	re, err := cachedRegex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("The regular expression pattern %s is not valid.", pattern)
+	}
+	return re, nil
+}
+
+func matchesTable(re *regexp.Regexp, m []string) *Hashtable {
+	h := NewHashtable()
+	names := re.SubexpNames()
+	for i := len(m) - 1; i >= 0; i-- {
+		if i > 0 && m[i] == "" {
+			continue
+		}
+		if names[i] != "" {
+			h.Set(names[i], m[i])
+		} else {
+			h.Set(i, m[i])
+		}
+	}
+	return h
+}
+
+// dotnetReplacement converts a .NET replacement string ($1, ${name}, $&, $$) to Go's syntax
+func dotnetReplacement(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		n := s[i+1]
+		switch {
+		case n == '$':
+			b.WriteString("$$")
+			i++
+		case n == '&':
+			b.WriteString("${0}")
+			i++
+		case isDigit(n):
+			j := i + 1
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			b.WriteString("${" + s[i+1:j] + "}")
+			i = j - 1
+		case n == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				b.WriteString("$$")
+				continue
+			}
+			b.WriteString(s[i : i+end+1])
+			i += end
+		default:
+			b.WriteString("$$")
+		}
+	}
+	return b.String()
+}
+
+func replaceOp(left, right interface{}, cs bool) (interface{}, error) {
+	args := asList(right)
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("The -replace operator allows only two elements to follow it, not %d.", len(args))
+	}
+	re, err := compileRegex(toString(args[0]), cs)
+	if err != nil {
+		return nil, err
+	}
+	repl := ""
+	if len(args) == 2 {
+		repl = dotnetReplacement(toString(args[1]))
+	}
+	if list, ok := left.([]interface{}); ok {
+		out := make([]interface{}, len(list))
+		for i, item := range list {
+			out[i] = re.ReplaceAllString(toString(item), repl)
+		}
+		return out, nil
+	}
+	return re.ReplaceAllString(toString(left), repl), nil
+}
+
+func splitOpValue(left, right interface{}, cs bool) (interface{}, error) {
+	args := asList(right)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("The -split operator requires a delimiter.")
+	}
+	limit := -1
+	if len(args) > 1 {
+		n, err := toInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			limit = n
+		}
+	}
+	var out []interface{}
+	re, err := compileRegex(toString(args[0]), cs)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range asList(left) {
+		for _, part := range re.Split(toString(item), limit) {
+			out = append(out, part)
+		}
+	}
+	if out == nil {
+		out = []interface{}{}
+	}
+	return out, nil
+}
+
+// splitWhitespace implements unary -split
+func splitWhitespace(v interface{}) interface{} {
+	var out []interface{}
+	for _, item := range asList(v) {
+		for _, f := range strings.Fields(toString(item)) {
+			out = append(out, f)
+		}
+	}
+	if out == nil {
+		out = []interface{}{}
+	}
+	return out
+}
+
+func joinValues(v interface{}, sep string) string {
+	list := asList(v)
+	parts := make([]string, len(list))
+	for i, item := range list {
+		parts[i] = toString(item)
+	}
+	return strings.Join(parts, sep)
+}
+
+// Arithmetic
+
+func numericPair(left, right interface{}, op string) (interface{}, interface{}, error) {
+	l, err := toNumber(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := toNumber(right)
+	if err != nil {
+		if _, isStr := right.(string); isStr {
+			return nil, nil, &ConversionError{Value: right, Type: "System.Int32", Reason: "Input string was not in a correct format."}
+		}
+		return nil, nil, fmt.Errorf("Method invocation failed because [%s] does not contain a method named 'op_%s'.", typeName(right), opMethodName(op))
+	}
+	return l, r, nil
+}
+
+func opMethodName(op string) string {
+	switch op {
+	case "+":
+		return "Addition"
+	case "-":
+		return "Subtraction"
+	case "*":
+		return "Multiply"
+	case "/":
+		return "Division"
+	}
+	return "Modulus"
+}
+
+// arithmetic applies + - * / % with PowerShell's type rules
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	switch l := left.(type) {
+	case nil:
+		if op == "+" {
+			if list, ok := right.([]interface{}); ok {
+				return append([]interface{}{}, list...), nil
+			}
+			return right, nil
+		}
+		if op == "-" {
+			r, err := toNumber(right)
+			if err != nil {
+				return nil, err
+			}
+			return arithmetic("-", 0, r)
+		}
+		return nil, nil
+	case string:
+		switch op {
+		case "+":
+			r := toString(right)
+			if len(l)+len(r) > maxString {
+				return nil, sizeError(fmt.Sprintf("The string is too long: more than %d characters.", maxString))
+			}
+			return l + r, nil
+		case "*":
+			n, err := toInt(right)
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 {
+				n = 0
+			}
+			if n > 0 && len(l) > maxString/n {
+				return nil, sizeError(fmt.Sprintf("The string is too long: more than %d characters.", maxString))
+			}
+			return strings.Repeat(l, n), nil
+		}
+	case []interface{}:
+		switch op {
+		case "+":
+			r, ok := right.([]interface{})
+			if len(l)+len(r) >= maxRange {
+				return nil, sizeError(fmt.Sprintf("The array is too large: more than %d items.", maxRange))
+			}
+			out := append([]interface{}{}, l...)
+			if ok {
+				return append(out, r...), nil
+			}
+			return append(out, right), nil
+		case "*":
+			n, err := toInt(right)
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 && len(l) >= maxRange/n {
+				return nil, sizeError(fmt.Sprintf("The array is too large: more than %d items.", maxRange))
+			}
+			var out []interface{}
+			for i := 0; i < n; i++ {
+				out = append(out, l...)
+			}
+			if out == nil {
+				out = []interface{}{}
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("Method invocation failed because [System.Object[]] does not contain a method named 'op_%s'.", opMethodName(op))
+	case *Hashtable:
+		if op == "+" {
+			r, ok := right.(*Hashtable)
+			if !ok {
+				return nil, fmt.Errorf("A hash table can only be added to another hash table.")
+			}
+			out := l.Copy()
+			for _, k := range r.Keys() {
+				if out.Has(k) {
+					return nil, fmt.Errorf("Item has already been added. Key in dictionary: '%s'  Key being added: '%s'", toString(k), toString(k))
+				}
+				v, _ := r.Get(k)
+				out.Set(k, v)
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("Method invocation failed because [System.Collections.Hashtable] does not contain a method named 'op_%s'.", opMethodName(op))
+	case time.Time:
+		switch r := right.(type) {
+		case time.Duration:
+			if op == "+" {
+				return l.Add(r), nil
+			}
+			if op == "-" {
+				return l.Add(-r), nil
+			}
+		case time.Time:
+			if op == "-" {
+				return l.Sub(r), nil
+			}
+		}
+		return nil, fmt.Errorf("Method invocation failed because [System.DateTime] does not contain a method named 'op_%s'.", opMethodName(op))
+	case time.Duration:
+		if r, ok := right.(time.Duration); ok {
+			if op == "+" {
+				return l + r, nil
+			}
+			if op == "-" {
+				return l - r, nil
+			}
+		}
+	case *PSObject, *ScriptBlock, *TypeInfo:
+		return nil, fmt.Errorf("Method invocation failed because [%s] does not contain a method named 'op_%s'.", typeName(left), opMethodName(op))
+	}
+
+	l, r, err := numericPair(left, right, op)
+	if err != nil {
+		return nil, err
+	}
+	li, lInt := l.(int)
+	ri, rInt := r.(int)
+	// A result too large for a long is a double, as PowerShell widens it
+	// rather than letting it wrap around
+	if lInt && rInt {
+		switch op {
+		case "+":
+			if sum := li + ri; (li >= 0) != (ri >= 0) || (sum >= 0) == (li >= 0) {
+				return sum, nil
+			}
+		case "-":
+			if diff := li - ri; (li >= 0) == (ri >= 0) || (diff >= 0) == (li >= 0) {
+				return diff, nil
+			}
+		case "*":
+			if product := li * ri; li == 0 || (product/li == ri && !(li == -1 && ri == math.MinInt)) {
+				return product, nil
+			}
+		case "/":
+			if ri == 0 {
+				return nil, fmt.Errorf("Attempted to divide by zero.")
+			}
+			if li%ri == 0 && !(li == math.MinInt && ri == -1) {
+				return li / ri, nil
+			}
+			return float64(li) / float64(ri), nil
+		case "%":
+			if ri == 0 {
+				return nil, fmt.Errorf("Attempted to divide by zero.")
+			}
+			return li % ri, nil
+		}
+	}
+	lf, _ := toFloat(l)
+	rf, _ := toFloat(r)
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("Attempted to divide by zero.")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("Attempted to divide by zero.")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	return nil, fmt.Errorf("The operator '%s' is not supported.", op)
+}
+
+func bitwise(op string, left, right interface{}) (interface{}, error) {
+	l, err := toInt(left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toInt(right)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "-band":
+		return l & r, nil
+	case "-bor":
+		return l | r, nil
+	}
+	return l ^ r, nil
+}
+
+// maxRange bounds the size of a .. range so a typo cannot exhaust memory;
+// arrays built with + and * are held to it too
+const maxRange = 1000000
+
+// maxString bounds the length of strings built with + and *
+const maxString = 10000000
+
+// sizeError reports a value too large to build. It ends the script, as a
+// loop that keeps growing the value would otherwise fail on every pass.
+type sizeError string
+
+func (e sizeError) Error() string { return string(e) }
+
+func rangeOp(left, right interface{}) (interface{}, error) {
+	if ls, ok := left.(string); ok && len([]rune(ls)) == 1 {
+		if rstr, ok := right.(string); ok && len([]rune(rstr)) == 1 {
+			from, to := []rune(ls)[0], []rune(rstr)[0]
+			var out []interface{}
+			step := rune(1)
+			if to < from {
+				step = -1
+			}
+			for c := from; ; c += step {
+				out = append(out, c)
+				if c == to {
+					break
+				}
+			}
+			return out, nil
+		}
+	}
+	from, err := toInt(left)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toInt(right)
+	if err != nil {
+		return nil, err
+	}
+	n := to - from
+	if n < 0 {
+		n = -n
+	}
+	if n >= maxRange {
+		return nil, sizeError(fmt.Sprintf("The range is too large: %d..%d.", from, to))
+	}
+	out := make([]interface{}, 0, n+1)
+	step := 1
+	if to < from {
+		step = -1
+	}
+	for i := from; ; i += step {
+		out = append(out, i)
+		if i == to {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,1331 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a syntax error in a script
+type ParseError struct {
+	Pos        Pos
+	Message    string
+	Line       string // source line containing the error
+	Incomplete bool   // the input ended before the statement was complete
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("At line:%d char:%d\n%s", e.Pos.Line, e.Pos.Column, e.Message)
+}
+
+// Parse parses a script into its AST
+func Parse(src string) (block *ScriptBlockAst, err error) {
+	p := &parser{lx: newLexer(src)}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*ParseError)
+			if !ok {
+				panic(r)
+			}
+			block, err = nil, perr
+		}
+	}()
+	block = p.parseScriptBody("")
+	if t := p.peek(modeCommand); t.Kind != TokenEOF {
+		p.unexpected(t)
+	}
+	block.Text = src
+	return block, nil
+}
+
+type parser struct {
+	lx      *lexer
+	off     int
+	noComma bool // parsing method arguments, where commas separate arguments
+}
+
+func (p *parser) peek(mode lexMode) Token {
+	return p.lx.scan(p.off, mode)
+}
+
+func (p *parser) next(mode lexMode) Token {
+	t := p.lx.scan(p.off, mode)
+	p.off = t.End
+	return t
+}
+
+// adjacent reports whether the next token starts immediately at the current offset
+func (p *parser) adjacent() bool {
+	return p.off < len(p.lx.src) && !isSpace(p.lx.src[p.off]) && p.lx.src[p.off] != '\n'
+}
+
+func (p *parser) fail(t Token, format string, args ...interface{}) {
+	panic(&ParseError{
+		Pos:        t.Pos,
+		Message:    fmt.Sprintf(format, args...),
+		Line:       p.lx.lineText(t.Pos.Line),
+		Incomplete: t.Kind == TokenEOF || t.open,
+	})
+}
+
+func (p *parser) unexpected(t Token) {
+	if t.Kind == TokenEOF {
+		p.fail(t, "Unexpected end of input.")
+	}
+	p.fail(t, "Unexpected token '%s' in expression or statement.", strings.TrimSpace(t.Text))
+}
+
+func (p *parser) expect(mode lexMode, text, message string) Token {
+	t := p.peek(mode)
+	if !t.Is(text) {
+		p.fail(t, "%s", message)
+	}
+	return p.next(mode)
+}
+
+func (p *parser) skipNewlines() {
+	for p.peek(modeExpression).Kind == TokenNewline {
+		p.next(modeExpression)
+	}
+}
+
+func (p *parser) skipTerminators() {
+	for {
+		t := p.peek(modeExpression)
+		if t.Kind != TokenNewline && !t.Is(";") {
+			return
+		}
+		p.next(modeExpression)
+	}
+}
+
+// parseScriptBody parses an optional param block followed by statements or
+// by begin, process and end blocks
+func (p *parser) parseScriptBody(closer string) *ScriptBlockAst {
+	p.skipTerminators()
+	block := &ScriptBlockAst{Pos: p.lx.pos(p.off)}
+	attrs := p.parseBlockAttributes()
+	if t := p.peek(modeCommand); t.Kind == TokenKeyword && t.Value == "param" {
+		block.Params = p.parseParamBlock()
+		block.Params.Attributes = attrs
+		p.skipTerminators()
+	}
+	if isNamedBlock(p.peek(modeCommand)) {
+		p.parseNamedBlocks(block, closer)
+		return block
+	}
+	block.Body = p.parseStatementList(closer)
+	return block
+}
+
+func isNamedBlock(t Token) bool {
+	return t.Kind == TokenKeyword && (t.Value == "begin" || t.Value == "process" || t.Value == "end")
+}
+
+// parseNamedBlocks parses the begin, process and end blocks of a script body
+func (p *parser) parseNamedBlocks(block *ScriptBlockAst, closer string) {
+	block.Named = true
+	seen := map[string]bool{}
+	for {
+		p.skipTerminators()
+		t := p.peek(modeCommand)
+		if t.Kind == TokenEOF || closer != "" && t.Is(closer) {
+			return
+		}
+		if !isNamedBlock(t) {
+			p.unexpected(t)
+		}
+		if seen[t.Value] {
+			p.fail(t, "Script command clause '%s' has already been defined.", t.Value)
+		}
+		seen[t.Value] = true
+		p.next(modeCommand)
+		body := p.parseBlock(t.Value)
+		if body == nil {
+			body = []Statement{}
+		}
+		switch t.Value {
+		case "begin":
+			block.Begin = body
+		case "process":
+			block.Process = body
+		default:
+			block.Body = body
+		}
+	}
+}
+
+// parseStatementList parses statements until the closing token or end of input
+func (p *parser) parseStatementList(closer string) []Statement {
+	var stmts []Statement
+	for {
+		p.skipTerminators()
+		t := p.peek(modeCommand)
+		if t.Kind == TokenEOF || closer != "" && t.Is(closer) {
+			return stmts
+		}
+		stmts = append(stmts, p.parseStatement())
+		t = p.peek(modeExpression)
+		if t.Kind != TokenEOF && t.Kind != TokenNewline && !t.Is(";") && !(closer != "" && t.Is(closer)) {
+			p.unexpected(t)
+		}
+	}
+}
+
+func (p *parser) parseStatement() Statement {
+	t := p.peek(modeCommand)
+	label := ""
+	if t.Kind == TokenGeneric && len(t.Text) > 1 && t.Text[0] == ':' {
+		p.next(modeCommand)
+		label = t.Text[1:]
+		p.skipNewlines()
+		t = p.peek(modeCommand)
+		if t.Kind != TokenKeyword || !isLoopKeyword(t.Value) {
+			p.fail(t, "Missing loop statement after label ':%s'.", label)
+		}
+	}
+	if t.Kind == TokenKeyword {
+		switch t.Value {
+		case "if":
+			return p.parseIf()
+		case "while":
+			return p.parseWhile(label)
+		case "do":
+			return p.parseDo(label)
+		case "for":
+			return p.parseFor(label)
+		case "foreach":
+			return p.parseForEach(label)
+		case "switch":
+			return p.parseSwitch(label)
+		case "break", "continue":
+			p.next(modeCommand)
+			target := ""
+			if n := p.peek(modeCommand); n.Kind == TokenGeneric {
+				p.next(modeCommand)
+				target = n.Value
+			}
+			if t.Value == "break" {
+				return &BreakStatement{Pos: t.Pos, Label: target}
+			}
+			return &ContinueStatement{Pos: t.Pos, Label: target}
+		case "return":
+			p.next(modeCommand)
+			return &ReturnStatement{Pos: t.Pos, Value: p.parseOptionalStatement()}
+		case "exit":
+			p.next(modeCommand)
+			return &ExitStatement{Pos: t.Pos, Code: p.parseOptionalStatement()}
+		case "throw":
+			p.next(modeCommand)
+			return &ThrowStatement{Pos: t.Pos, Value: p.parseOptionalStatement()}
+		case "try":
+			return p.parseTry()
+		case "trap":
+			return p.parseTrap()
+		case "function", "filter":
+			return p.parseFunction()
+		default:
+			p.fail(t, "Unexpected keyword '%s'.", t.Text)
+		}
+	}
+	return p.parsePipeline()
+}
+
+func isLoopKeyword(k string) bool {
+	return k == "while" || k == "do" || k == "for" || k == "foreach" || k == "switch"
+}
+
+// parseOptionalStatement parses the value of return/exit if one is present on the same line
+func (p *parser) parseOptionalStatement() Statement {
+	t := p.peek(modeCommand)
+	if t.Kind == TokenEOF || t.Kind == TokenNewline || t.Is(";") || t.Is("}") || t.Is(")") {
+		return nil
+	}
+	return p.parseStatement()
+}
+
+// startsCommand reports whether the statement at the current position is a command invocation
+func (p *parser) startsCommand() bool {
+	t := p.peek(modeCommand)
+	switch t.Kind {
+	case TokenGeneric:
+		// 1..5 and 2*3 lex as one word in command mode but start an expression
+		if end, _, ok := scanNumber(t.Text, 0); ok && end < len(t.Text) && strings.IndexByte(".*/%+-,", t.Text[end]) >= 0 {
+			return false
+		}
+		switch t.Text[0] {
+		case '!', '+', '-', '[', ',', '.', '=':
+			return t.Text[0] == '.' && len(t.Text) > 1 && t.Text[1] != '.'
+		}
+		return true
+	case TokenPunct:
+		return t.Is("&") || t.Is(".")
+	}
+	return false
+}
+
+// parsePipeline parses a pipeline or an assignment statement
+func (p *parser) parsePipeline() Statement {
+	start := p.peek(modeCommand)
+	stmt := &PipelineStatement{Pos: start.Pos}
+	if p.startsCommand() {
+		stmt.Elements = append(stmt.Elements, p.parseCommand())
+	} else {
+		expr := p.parseExpression()
+		if op := p.peek(modeExpression); op.Kind == TokenOperator && isAssignmentOp(op.Text) {
+			p.next(modeExpression)
+			if !isAssignable(expr) {
+				p.fail(start, "The assignment expression is not valid. The input to an assignment operator must be an object that is able to accept assignments, such as a variable or a property.")
+			}
+			p.skipNewlines()
+			if n := p.peek(modeCommand); n.Kind == TokenEOF || n.Kind == TokenNewline || n.Is(";") || n.Is(")") || n.Is("}") {
+				p.fail(n, "You must provide a value expression following the '%s' operator.", op.Text)
+			}
+			return &AssignmentStatement{Pos: start.Pos, Target: expr, Op: op.Text, Value: p.parseStatement()}
+		}
+		element := &CommandExpression{Pos: start.Pos, Expr: expr}
+		for {
+			r := p.peek(modeExpression)
+			if r.Kind != TokenRedirection {
+				break
+			}
+			element.Redirections = append(element.Redirections, p.parseRedirection())
+		}
+		stmt.Elements = append(stmt.Elements, element)
+	}
+	for p.peek(modeExpression).Is("|") {
+		bar := p.next(modeExpression)
+		p.skipNewlines()
+		t := p.peek(modeCommand)
+		if t.Kind == TokenEOF || t.Kind == TokenNewline || t.Is(";") || t.Is(")") || t.Is("}") || t.Is("|") {
+			if t.Kind == TokenEOF {
+				p.fail(t, "An empty pipe element is not allowed.")
+			}
+			p.fail(bar, "An empty pipe element is not allowed.")
+		}
+		// foreach after a pipe is the ForEach-Object alias, not the loop keyword
+		if !p.startsCommand() && !(t.Kind == TokenKeyword && t.Value == "foreach") {
+			p.fail(t, "Expressions are only allowed as the first element of a pipeline.")
+		}
+		stmt.Elements = append(stmt.Elements, p.parseCommand())
+	}
+	return stmt
+}
+
+func isAssignmentOp(op string) bool {
+	switch op {
+	case "=", "+=", "-=", "*=", "/=", "%=":
+		return true
+	}
+	return false
+}
+
+func isAssignable(e Expr) bool {
+	switch e := e.(type) {
+	case *VariableExpr, *MemberExpr, *IndexExpr:
+		return true
+	case *ConvertExpr:
+		return isAssignable(e.Operand)
+	case *ArrayLiteralExpr:
+		for _, el := range e.Elements {
+			if !isAssignable(el) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// parseCommand parses a command name followed by its parameters and arguments
+func (p *parser) parseCommand() *CommandAst {
+	t := p.peek(modeCommand)
+	cmd := &CommandAst{Pos: t.Pos}
+	if t.Is("&") || t.Is(".") {
+		p.next(modeCommand)
+		cmd.Invocation = t.Text
+		cmd.Name = p.parseCommandPrimary()
+	} else {
+		p.next(modeCommand)
+		cmd.Name = p.bareword(t)
+	}
+	endOfParams := false
+	for {
+		t = p.peek(modeCommand)
+		switch {
+		case t.Kind == TokenEOF || t.Kind == TokenNewline || t.Is(";") || t.Is("|") || t.Is(")") || t.Is("}") || t.Is("&&") || t.Is("||"):
+			return cmd
+		case t.Kind == TokenParameter && !endOfParams:
+			p.next(modeCommand)
+			if t.Value == "-" {
+				endOfParams = true
+				continue
+			}
+			el := CommandElement{Pos: t.Pos, Param: t.Value}
+			if strings.HasSuffix(t.Text, ":") {
+				el.Colon = true
+				el.Arg = p.parseCommandArgument()
+			}
+			cmd.Elements = append(cmd.Elements, el)
+		case t.Kind == TokenParameter:
+			p.next(modeCommand)
+			cmd.Elements = append(cmd.Elements, CommandElement{Pos: t.Pos, Arg: &StringExpr{Pos: t.Pos, Value: t.Text, Bare: true}})
+		case t.Kind == TokenRedirection:
+			cmd.Redirections = append(cmd.Redirections, p.parseRedirection())
+		case t.Kind == TokenSplat:
+			p.next(modeCommand)
+			cmd.Elements = append(cmd.Elements, CommandElement{Pos: t.Pos, Arg: &VariableExpr{Pos: t.Pos, Name: t.Value}, Splatted: true})
+		default:
+			cmd.Elements = append(cmd.Elements, CommandElement{Pos: t.Pos, Arg: p.parseCommandArgument()})
+		}
+	}
+}
+
+func (p *parser) parseRedirection() Redirection {
+	t := p.next(modeCommand)
+	r := Redirection{Pos: t.Pos, Op: t.Text}
+	if !strings.HasSuffix(t.Text, "&1") {
+		if n := p.peek(modeCommand); n.Kind == TokenEOF || n.Kind == TokenNewline || n.Is(";") || n.Is("|") {
+			p.fail(n, "Missing file specification after redirection operator.")
+		}
+		r.Target = p.parseCommandPrimary()
+	}
+	return r
+}
+
+// parseCommandArgument parses a single argument, which may be a comma-separated list
+func (p *parser) parseCommandArgument() Expr {
+	first := p.parseCommandPrimary()
+	if !p.peek(modeCommand).Is(",") {
+		return first
+	}
+	list := &ArrayLiteralExpr{Pos: first.Position(), Elements: []Expr{first}}
+	for p.peek(modeCommand).Is(",") {
+		comma := p.next(modeCommand)
+		p.skipNewlines()
+		if n := p.peek(modeCommand); n.Kind == TokenEOF || n.Kind == TokenNewline || n.Is(";") || n.Is("|") || n.Is(")") || n.Is("}") {
+			p.fail(comma, "Missing argument in parameter list.")
+		}
+		list.Elements = append(list.Elements, p.parseCommandPrimary())
+	}
+	return list
+}
+
+// parseCommandPrimary parses one argument in command mode
+func (p *parser) parseCommandPrimary() Expr {
+	t := p.peek(modeCommand)
+	switch t.Kind {
+	case TokenGeneric, TokenKeyword:
+		p.next(modeCommand)
+		return p.bareword(t)
+	case TokenNumber:
+		p.next(modeCommand)
+		return p.number(t)
+	case TokenParameter:
+		p.next(modeCommand)
+		return &StringExpr{Pos: t.Pos, Value: t.Text, Bare: true}
+	}
+	saved := p.noComma
+	p.noComma = false
+	defer func() { p.noComma = saved }()
+	return p.parsePostfix(p.parsePrimary(modeCommand))
+}
+
+// bareword converts a generic token into a string, expanding any variables it contains
+func (p *parser) bareword(t Token) Expr {
+	if strings.Contains(t.Text, "$") {
+		return &ExpandableStringExpr{Pos: t.Pos, Parts: p.expandableParts(t.Text, t.Pos), Raw: t.Text}
+	}
+	return &StringExpr{Pos: t.Pos, Value: t.Value, Bare: true, Literal: t.Text}
+}
+
+func (p *parser) number(t Token) Expr {
+	text := t.Text
+	neg := strings.HasPrefix(text, "-")
+	if neg {
+		text = text[1:]
+	}
+	_, v, ok := scanNumber(text, 0)
+	if !ok {
+		p.fail(t, "Bad numeric constant: %s.", t.Text)
+	}
+	if neg {
+		switch n := v.(type) {
+		case int:
+			v = -n
+		case float64:
+			v = -n
+		}
+	}
+	return &ConstantExpr{Pos: t.Pos, Value: v, Text: t.Text}
+}
+
+// Expression grammar, lowest precedence first
+
+func (p *parser) parseExpression() Expr {
+	return p.parseBinary(0)
+}
+
+var precedence = [][]string{
+	{"-and", "-or", "-xor"},
+	{"-band", "-bor", "-bxor"},
+	nil, // comparison operators, see isComparisonOp
+	{"+", "-"},
+	{"*", "/", "%"},
+	{"-f"},
+	{".."},
+}
+
+func isComparisonOp(op string) bool {
+	switch strings.TrimLeft(op, "-") {
+	case "shl", "shr", "is", "isnot", "as", "join":
+		return true
+	}
+	if !strings.HasPrefix(op, "-") {
+		return false
+	}
+	name := op[1:]
+	if len(name) > 2 && (name[0] == 'c' || name[0] == 'i') && isDashOperator(name) && !dashOperators[name] {
+		name = name[1:]
+	}
+	switch name {
+	case "eq", "ne", "gt", "ge", "lt", "le", "like", "notlike", "match", "notmatch",
+		"contains", "notcontains", "in", "notin", "replace", "split":
+		return true
+	}
+	return false
+}
+
+func (p *parser) binaryOpAt(level int) (Token, bool) {
+	t := p.peek(modeExpression)
+	if t.Kind != TokenOperator {
+		return t, false
+	}
+	op := t.Value
+	if level == 2 {
+		return t, isComparisonOp(op)
+	}
+	for _, candidate := range precedence[level] {
+		if op == candidate {
+			return t, true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) parseBinary(level int) Expr {
+	if level == len(precedence) {
+		return p.parseArrayLiteral()
+	}
+	left := p.parseBinary(level + 1)
+	for {
+		op, ok := p.binaryOpAt(level)
+		if !ok {
+			return left
+		}
+		p.next(modeExpression)
+		p.skipNewlines()
+		if n := p.peek(modeExpression); n.Kind == TokenEOF || n.Kind == TokenNewline || n.Is(")") || n.Is("}") || n.Is(";") || n.Is("|") {
+			p.fail(n, "You must provide a value expression following the '%s' operator.", op.Text)
+		}
+		right := p.parseBinary(level + 1)
+		left = &BinaryExpr{Pos: left.Position(), Op: op.Value, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseArrayLiteral() Expr {
+	first := p.parseUnary()
+	if p.noComma || !p.peek(modeExpression).Is(",") {
+		return first
+	}
+	list := &ArrayLiteralExpr{Pos: first.Position(), Elements: []Expr{first}}
+	for p.peek(modeExpression).Is(",") {
+		comma := p.next(modeExpression)
+		p.skipNewlines()
+		if n := p.peek(modeExpression); n.Kind == TokenEOF || n.Is(")") || n.Is("}") || n.Is(";") || n.Is("|") {
+			p.fail(comma, "Missing expression after ','.")
+		}
+		list.Elements = append(list.Elements, p.parseUnary())
+	}
+	return list
+}
+
+func (p *parser) parseUnary() Expr {
+	t := p.peek(modeExpression)
+	if t.Kind == TokenOperator {
+		switch t.Value {
+		case "!", "-not", "-bnot", "-", "+", "++", "--", "-split", "-join":
+			p.next(modeExpression)
+			if n := p.peek(modeExpression); n.Kind == TokenEOF || n.Kind == TokenNewline {
+				p.fail(n, "You must provide a value expression following the '%s' operator.", t.Text)
+			}
+			operand := p.parseUnary()
+			if t.Value == "-" {
+				if c, ok := operand.(*ConstantExpr); ok {
+					switch n := c.Value.(type) {
+					case int:
+						return &ConstantExpr{Pos: t.Pos, Value: -n, Text: "-" + c.Text}
+					case float64:
+						return &ConstantExpr{Pos: t.Pos, Value: -n, Text: "-" + c.Text}
+					}
+				}
+			}
+			return &UnaryExpr{Pos: t.Pos, Op: t.Value, Operand: operand}
+		}
+	}
+	if t.Is(",") {
+		p.next(modeExpression)
+		operand := p.parseUnary()
+		return &ArrayLiteralExpr{Pos: t.Pos, Elements: []Expr{operand}}
+	}
+	if t.Is("[") {
+		name, end, ok := p.lx.scanTypeName(t.End)
+		if !ok {
+			p.fail(t, "Missing type name after '['.")
+		}
+		p.off = end
+		if p.startsUnary() {
+			return &ConvertExpr{Pos: t.Pos, Type: name, Operand: p.parseUnary()}
+		}
+		return p.parsePostfix(&TypeExpr{Pos: t.Pos, Type: name})
+	}
+	expr := p.parsePostfix(p.parsePrimary(modeExpression))
+	if p.adjacent() {
+		if n := p.peek(modeExpression); n.Is("++") || n.Is("--") {
+			p.next(modeExpression)
+			return &UnaryExpr{Pos: expr.Position(), Op: n.Value, Operand: expr, Postfix: true}
+		}
+	}
+	return expr
+}
+
+// startsUnary reports whether the next token can begin the operand of a cast
+func (p *parser) startsUnary() bool {
+	t := p.peek(modeExpression)
+	switch t.Kind {
+	case TokenVariable, TokenNumber, TokenString, TokenExpandable:
+		return true
+	case TokenPunct:
+		return t.Is("(") || t.Is("$(") || t.Is("@(") || t.Is("@{") || t.Is("{") || t.Is("[")
+	case TokenOperator:
+		switch t.Value {
+		case "!", "-not", "-bnot", "-", "++", "--", "-split", "-join":
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parsePrimary(mode lexMode) Expr {
+	t := p.peek(mode)
+	switch t.Kind {
+	case TokenVariable:
+		p.next(mode)
+		return &VariableExpr{Pos: t.Pos, Name: t.Value}
+	case TokenNumber:
+		p.next(mode)
+		return p.number(t)
+	case TokenString:
+		p.next(mode)
+		if t.open {
+			p.fail(t, "The string is missing the terminator: '.")
+		}
+		return &StringExpr{Pos: t.Pos, Value: t.Value, Quote: '\'', Literal: t.Text}
+	case TokenExpandable:
+		p.next(mode)
+		if t.open {
+			p.fail(t, "The string is missing the terminator: \".")
+		}
+		return &ExpandableStringExpr{Pos: t.Pos, Parts: p.expandableParts(t.Value, t.Pos), Raw: t.Text}
+	case TokenPunct:
+		switch t.Text {
+		case "(":
+			p.next(mode)
+			saved := p.noComma
+			p.noComma = false
+			p.skipNewlines()
+			if n := p.peek(modeCommand); n.Is(")") {
+				p.fail(n, "An expression was expected after '('.")
+			}
+			stmt := p.parsePipelineOrControl()
+			p.skipNewlines()
+			p.expect(modeExpression, ")", "Missing closing ')' in expression.")
+			p.noComma = saved
+			return &ParenExpr{Pos: t.Pos, Pipeline: stmt}
+		case "$(", "@(":
+			p.next(mode)
+			saved := p.noComma
+			p.noComma = false
+			body := p.parseStatementList(")")
+			p.expect(modeExpression, ")", "Missing closing ')' in subexpression.")
+			p.noComma = saved
+			if t.Text == "@(" {
+				return &ArrayExpr{Pos: t.Pos, Body: body}
+			}
+			return &SubExpr{Pos: t.Pos, Body: body}
+		case "@{":
+			return p.parseHashtable()
+		case "{":
+			return p.parseScriptBlockLiteral()
+		}
+	}
+	if t.Kind == TokenEOF {
+		p.fail(t, "Unexpected end of input; an expression was expected.")
+	}
+	p.unexpected(t)
+	return nil
+}
+
+// parsePipelineOrControl parses the contents of ( ), which may be a control statement
+func (p *parser) parsePipelineOrControl() Statement {
+	if t := p.peek(modeCommand); t.Kind == TokenKeyword {
+		return p.parseStatement()
+	}
+	return p.parsePipeline()
+}
+
+func (p *parser) parsePostfix(expr Expr) Expr {
+	for p.adjacent() {
+		t := p.peek(modeExpression)
+		switch {
+		case t.Is(".") || t.Is("::"):
+			p.next(modeExpression)
+			member := p.parseMemberName()
+			if p.adjacent() && p.lx.at(p.off) == '(' {
+				args := p.parseMethodArgs()
+				expr = &InvokeMemberExpr{Pos: expr.Position(), Target: expr, Member: member, Args: args, Static: t.Text == "::"}
+			} else {
+				expr = &MemberExpr{Pos: expr.Position(), Target: expr, Member: member, Static: t.Text == "::"}
+			}
+		case t.Is("["):
+			p.next(modeExpression)
+			saved := p.noComma
+			p.noComma = false
+			p.skipNewlines()
+			index := p.parseExpression()
+			p.skipNewlines()
+			p.expect(modeExpression, "]", "Array index expression is missing or not valid.")
+			p.noComma = saved
+			expr = &IndexExpr{Pos: expr.Position(), Target: expr, Index: index}
+		default:
+			return expr
+		}
+	}
+	return expr
+}
+
+func (p *parser) parseMemberName() Expr {
+	t := p.peek(modeExpression)
+	switch t.Kind {
+	case TokenIdentifier, TokenKeyword:
+		p.next(modeExpression)
+		return &StringExpr{Pos: t.Pos, Value: t.Text, Bare: true}
+	case TokenVariable, TokenString, TokenExpandable:
+		return p.parsePrimary(modeExpression)
+	}
+	if t.Is("(") {
+		return p.parsePrimary(modeExpression)
+	}
+	p.fail(t, "Missing property name after reference operator.")
+	return nil
+}
+
+func (p *parser) parseMethodArgs() []Expr {
+	p.next(modeExpression) // (
+	saved := p.noComma
+	p.noComma = true
+	defer func() { p.noComma = saved }()
+	var args []Expr
+	p.skipNewlines()
+	if p.peek(modeExpression).Is(")") {
+		p.next(modeExpression)
+		return args
+	}
+	for {
+		p.skipNewlines()
+		args = append(args, p.parseExpression())
+		p.skipNewlines()
+		t := p.peek(modeExpression)
+		if t.Is(")") {
+			p.next(modeExpression)
+			return args
+		}
+		if !t.Is(",") {
+			p.fail(t, "Missing ')' in method call.")
+		}
+		p.next(modeExpression)
+	}
+}
+
+func (p *parser) parseHashtable() Expr {
+	open := p.next(modeExpression)
+	saved := p.noComma
+	p.noComma = false
+	defer func() { p.noComma = saved }()
+	h := &HashtableExpr{Pos: open.Pos}
+	for {
+		p.skipTerminators()
+		t := p.peek(modeExpression)
+		if t.Is("}") {
+			p.next(modeExpression)
+			return h
+		}
+		if t.Kind == TokenEOF {
+			p.fail(t, "Missing closing '}' in hash literal.")
+		}
+		var key Expr
+		if t.Kind == TokenIdentifier || t.Kind == TokenKeyword {
+			p.next(modeExpression)
+			key = &StringExpr{Pos: t.Pos, Value: t.Text, Bare: true}
+		} else {
+			key = p.parseUnary()
+		}
+		eq := p.peek(modeExpression)
+		if !eq.Is("=") {
+			p.fail(eq, "Missing '=' operator after key in hash literal.")
+		}
+		p.next(modeExpression)
+		p.skipNewlines()
+		if n := p.peek(modeCommand); n.Is("}") || n.Is(";") || n.Kind == TokenEOF {
+			p.fail(n, "Missing statement after '=' in hash literal.")
+		}
+		value := p.parseStatement()
+		h.Entries = append(h.Entries, HashEntry{Key: key, Value: value})
+		if n := p.peek(modeExpression); n.Kind != TokenNewline && !n.Is(";") && !n.Is("}") {
+			p.fail(n, "Missing '=' operator after key in hash literal.")
+		}
+	}
+}
+
+func (p *parser) parseScriptBlockLiteral() Expr {
+	open := p.next(modeExpression)
+	saved := p.noComma
+	p.noComma = false
+	defer func() { p.noComma = saved }()
+	block := p.parseScriptBody("}")
+	closeTok := p.peek(modeExpression)
+	if !closeTok.Is("}") {
+		p.fail(closeTok, "Missing closing '}' in statement block or type definition.")
+	}
+	p.next(modeExpression)
+	block.Pos = open.Pos
+	block.Text = p.lx.src[open.End:closeTok.Pos.Offset]
+	return &ScriptBlockExpr{Pos: open.Pos, Block: block}
+}
+
+func (p *parser) parseParamBlock() *ParamBlock {
+	kw := p.next(modeCommand)
+	block := &ParamBlock{Pos: kw.Pos}
+	p.skipNewlines()
+	p.expect(modeExpression, "(", "Missing '(' after 'param'.")
+	block.Params = p.parseParameterList()
+	return block
+}
+
+// parseParameterList parses parameter declarations up to and including the closing ')'
+func (p *parser) parseParameterList() []*ParamAst {
+	saved := p.noComma
+	p.noComma = true
+	defer func() { p.noComma = saved }()
+	var params []*ParamAst
+	for {
+		p.skipNewlines()
+		t := p.peek(modeExpression)
+		if t.Is(")") {
+			p.next(modeExpression)
+			return params
+		}
+		param := &ParamAst{Pos: t.Pos}
+		for p.peek(modeExpression).Is("[") {
+			open := p.next(modeExpression)
+			if attr, typ := p.parseAttributeOrType(open); attr != nil {
+				param.Attributes = append(param.Attributes, attr)
+			} else {
+				param.Type = typ
+			}
+			p.skipNewlines()
+		}
+		v := p.peek(modeExpression)
+		if v.Kind != TokenVariable {
+			p.fail(v, "Missing ')' in function parameter list.")
+		}
+		p.next(modeExpression)
+		param.Name = v.Value
+		if p.peek(modeExpression).Is("=") {
+			p.next(modeExpression)
+			p.skipNewlines()
+			param.Default = p.parseExpression()
+		}
+		params = append(params, param)
+		p.skipNewlines()
+		if n := p.peek(modeExpression); n.Is(",") {
+			p.next(modeExpression)
+		} else if !n.Is(")") {
+			p.fail(n, "Missing ')' in function parameter list.")
+		}
+	}
+}
+
+// parseAttributeOrType parses what follows '[' in a parameter declaration:
+// an attribute such as [Parameter(Mandatory)], which always has an
+// argument list, or a type constraint such as [string[]]
+func (p *parser) parseAttributeOrType(open Token) (*AttributeAst, string) {
+	src := p.lx.src
+	start := open.End
+	for start < len(src) && isSpace(src[start]) {
+		start++
+	}
+	end := start
+	for end < len(src) && (isIdentChar(src[end]) || src[end] == '.') {
+		end++
+	}
+	paren := end
+	for paren < len(src) && isSpace(src[paren]) {
+		paren++
+	}
+	if end == start || paren >= len(src) || src[paren] != '(' {
+		name, after, ok := p.lx.scanTypeName(open.End)
+		if !ok {
+			p.fail(open, "Missing type name after '['.")
+		}
+		p.off = after
+		return nil, name
+	}
+	attr := &AttributeAst{Pos: open.Pos, Name: src[start:end]}
+	p.off = paren + 1
+	saved := p.noComma
+	p.noComma = true
+	defer func() { p.noComma = saved }()
+	for {
+		p.skipNewlines()
+		t := p.peek(modeExpression)
+		if t.Is(")") {
+			p.next(modeExpression)
+			break
+		}
+		if t.Kind == TokenIdentifier {
+			p.next(modeExpression)
+			arg := NamedArgument{Name: t.Text}
+			p.skipNewlines()
+			if p.peek(modeExpression).Is("=") {
+				p.next(modeExpression)
+				p.skipNewlines()
+				arg.Value = p.parseExpression()
+			}
+			attr.Named = append(attr.Named, arg)
+		} else {
+			attr.Positional = append(attr.Positional, p.parseExpression())
+		}
+		p.skipNewlines()
+		t = p.peek(modeExpression)
+		if t.Is(",") {
+			p.next(modeExpression)
+			continue
+		}
+		if !t.Is(")") {
+			p.fail(t, "Missing closing ')' in expression.")
+		}
+	}
+	p.expect(modeExpression, "]", "Missing ] at end of attribute or type literal.")
+	return attr, ""
+}
+
+// parseBlockAttributes parses the attributes of a param block, such as
+// [CmdletBinding()]. Brackets that aren't attributes followed by param are
+// left to be parsed as statements.
+func (p *parser) parseBlockAttributes() (attrs []*AttributeAst) {
+	if !p.peek(modeExpression).Is("[") {
+		return nil
+	}
+	saved := p.off
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*ParseError); !ok {
+				panic(r)
+			}
+			p.off, attrs = saved, nil
+		}
+	}()
+	for p.peek(modeExpression).Is("[") {
+		attr, _ := p.parseAttributeOrType(p.next(modeExpression))
+		if attr == nil {
+			p.off = saved
+			return nil
+		}
+		attrs = append(attrs, attr)
+		p.skipNewlines()
+	}
+	if t := p.peek(modeCommand); t.Kind != TokenKeyword || t.Value != "param" {
+		p.off = saved
+		return nil
+	}
+	return attrs
+}
+
+// expandableParts splits the contents of an expandable string into literal and variable parts
+func (p *parser) expandableParts(s string, pos Pos) []Expr {
+	var parts []Expr
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, &StringExpr{Pos: pos, Value: lit.String()})
+			lit.Reset()
+		}
+	}
+	sub := newLexer(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '`' && i+1 < len(s):
+			i++
+			lit.WriteString(escapeChar(s[i]))
+		case c == '$' && i+1 < len(s) && s[i+1] == '(':
+			end := sub.skipSubexpression(i + 1)
+			inner := s[i+2 : end-1]
+			if end > len(s) || s[end-1] != ')' {
+				p.fail(Token{Pos: pos}, "Missing closing ')' in subexpression.")
+			}
+			block, err := Parse(inner)
+			if err != nil {
+				perr := err.(*ParseError)
+				perr.Pos = pos
+				panic(perr)
+			}
+			flush()
+			parts = append(parts, &SubExpr{Pos: pos, Body: block.Body})
+			i = end - 1
+		case c == '$' && i+1 < len(s) && (isIdentChar(s[i+1]) || s[i+1] == '{' || s[i+1] == '?' || s[i+1] == '_'):
+			t := sub.scanDollar(i, modeExpression)
+			flush()
+			parts = append(parts, &VariableExpr{Pos: pos, Name: t.Value})
+			i = t.End - 1
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	flush()
+	return parts
+}
+
+func escapeChar(c byte) string {
+	switch c {
+	case '0':
+		return "\x00"
+	case 'a':
+		return "\a"
+	case 'b':
+		return "\b"
+	case 'e':
+		return "\x1b"
+	case 'f':
+		return "\f"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'v':
+		return "\v"
+	}
+	return string(c)
+}
+
+// Control flow statements
+
+func (p *parser) parseCondition(keyword Token) Statement {
+	p.skipNewlines()
+	p.expect(modeExpression, "(", fmt.Sprintf("Missing '(' after '%s' in %s statement.", keyword.Text, keyword.Value))
+	p.skipNewlines()
+	if n := p.peek(modeCommand); n.Is(")") {
+		p.fail(n, "Missing condition in %s statement after '%s ('.", keyword.Value, keyword.Text)
+	}
+	cond := p.parsePipelineOrControl()
+	p.skipNewlines()
+	p.expect(modeExpression, ")", fmt.Sprintf("Missing closing ')' after expression in '%s' statement.", keyword.Value))
+	return cond
+}
+
+func (p *parser) parseBlock(after string) []Statement {
+	p.skipNewlines()
+	t := p.peek(modeExpression)
+	if !t.Is("{") {
+		p.fail(t, "Missing statement block after %s.", after)
+	}
+	p.next(modeExpression)
+	body := p.parseStatementList("}")
+	closeTok := p.peek(modeExpression)
+	if !closeTok.Is("}") {
+		p.fail(closeTok, "Missing closing '}' in statement block or type definition.")
+	}
+	p.next(modeExpression)
+	return body
+}
+
+func (p *parser) parseIf() Statement {
+	kw := p.next(modeCommand)
+	stmt := &IfStatement{Pos: kw.Pos}
+	cond := p.parseCondition(kw)
+	stmt.Clauses = append(stmt.Clauses, IfClause{Condition: cond, Body: p.parseBlock("if ( condition )")})
+	for {
+		saved := p.off
+		p.skipNewlines()
+		t := p.peek(modeCommand)
+		if t.Kind == TokenKeyword && t.Value == "elseif" {
+			p.next(modeCommand)
+			cond := p.parseCondition(t)
+			stmt.Clauses = append(stmt.Clauses, IfClause{Condition: cond, Body: p.parseBlock("elseif ( condition )")})
+			continue
+		}
+		if t.Kind == TokenKeyword && t.Value == "else" {
+			p.next(modeCommand)
+			stmt.Else = p.parseBlock("else")
+			if stmt.Else == nil {
+				stmt.Else = []Statement{}
+			}
+			return stmt
+		}
+		p.off = saved
+		return stmt
+	}
+}
+
+func (p *parser) parseTry() Statement {
+	kw := p.next(modeCommand)
+	stmt := &TryStatement{Pos: kw.Pos, Body: p.parseBlock("try")}
+	for {
+		saved := p.off
+		p.skipNewlines()
+		t := p.peek(modeCommand)
+		if t.Kind == TokenKeyword && t.Value == "catch" {
+			p.next(modeCommand)
+			clause := CatchClause{Types: p.parseCatchTypes()}
+			clause.Body = p.parseBlock("catch")
+			stmt.Catches = append(stmt.Catches, clause)
+			continue
+		}
+		if t.Kind == TokenKeyword && t.Value == "finally" {
+			p.next(modeCommand)
+			stmt.Finally = p.parseBlock("finally")
+			if stmt.Finally == nil {
+				stmt.Finally = []Statement{}
+			}
+			return stmt
+		}
+		p.off = saved
+		if len(stmt.Catches) == 0 {
+			p.fail(t, "The Try statement is missing its Catch or Finally block.")
+		}
+		return stmt
+	}
+}
+
+// parseCatchTypes parses the comma-separated [type] list of a catch block
+func (p *parser) parseCatchTypes() []string {
+	var types []string
+	for {
+		t := p.peek(modeExpression)
+		if !t.Is("[") {
+			if len(types) > 0 {
+				p.fail(t, "Missing type name after ','.")
+			}
+			return nil
+		}
+		name, end, ok := p.lx.scanTypeName(t.End)
+		if !ok {
+			p.fail(t, "Missing type name after '['.")
+		}
+		p.off = end
+		types = append(types, name)
+		if !p.peek(modeExpression).Is(",") {
+			return types
+		}
+		p.next(modeExpression)
+		p.skipNewlines()
+	}
+}
+
+// parseFunction parses function Name { } and the short form function Name($a, $b) { }
+func (p *parser) parseFunction() Statement {
+	kw := p.next(modeCommand)
+	name := p.peek(modeCommand)
+	if name.Kind != TokenGeneric {
+		p.fail(name, "Missing name after %s keyword.", kw.Value)
+	}
+	p.next(modeCommand)
+	def := &FunctionDefinition{Pos: kw.Pos, Name: name.Value, Filter: kw.Value == "filter"}
+	p.skipNewlines()
+	var params *ParamBlock
+	if t := p.peek(modeExpression); t.Is("(") {
+		p.next(modeExpression)
+		params = &ParamBlock{Pos: t.Pos, Params: p.parseParameterList()}
+		p.skipNewlines()
+	}
+	t := p.peek(modeExpression)
+	if !t.Is("{") {
+		p.fail(t, "Missing function body in function declaration.")
+	}
+	def.Body = p.parseScriptBlockLiteral().(*ScriptBlockExpr).Block
+	if params != nil {
+		if def.Body.Params != nil {
+			p.fail(t, "A param statement cannot be used if arguments were specified in the function declaration.")
+		}
+		def.Body.Params = params
+	}
+	return def
+}
+
+func (p *parser) parseTrap() Statement {
+	kw := p.next(modeCommand)
+	stmt := &TrapStatement{Pos: kw.Pos}
+	if t := p.peek(modeExpression); t.Is("[") {
+		name, end, ok := p.lx.scanTypeName(t.End)
+		if !ok {
+			p.fail(t, "Missing type name after '['.")
+		}
+		p.off = end
+		stmt.Type = name
+	}
+	stmt.Body = p.parseBlock("trap")
+	if stmt.Body == nil {
+		stmt.Body = []Statement{}
+	}
+	return stmt
+}
+
+func (p *parser) parseWhile(label string) Statement {
+	kw := p.next(modeCommand)
+	cond := p.parseCondition(kw)
+	return &WhileStatement{Pos: kw.Pos, Label: label, Condition: cond, Body: p.parseBlock("while ( condition )")}
+}
+
+func (p *parser) parseDo(label string) Statement {
+	kw := p.next(modeCommand)
+	body := p.parseBlock("do")
+	p.skipNewlines()
+	t := p.peek(modeCommand)
+	if t.Kind != TokenKeyword || t.Value != "while" && t.Value != "until" {
+		p.fail(t, "Missing while or until keyword in do loop.")
+	}
+	p.next(modeCommand)
+	cond := p.parseCondition(t)
+	return &DoStatement{Pos: kw.Pos, Label: label, Body: body, Condition: cond, Until: t.Value == "until"}
+}
+
+func (p *parser) parseFor(label string) Statement {
+	kw := p.next(modeCommand)
+	stmt := &ForStatement{Pos: kw.Pos, Label: label}
+	p.skipNewlines()
+	p.expect(modeExpression, "(", "Missing opening '(' after keyword 'for'.")
+	part := func(closer string) Statement {
+		p.skipNewlines()
+		t := p.peek(modeCommand)
+		if t.Is(";") || t.Is(closer) {
+			if t.Is(";") {
+				p.next(modeCommand)
+			}
+			return nil
+		}
+		s := p.parsePipeline()
+		p.skipNewlines()
+		if n := p.peek(modeExpression); n.Is(";") {
+			p.next(modeExpression)
+		}
+		return s
+	}
+	stmt.Init = part(")")
+	stmt.Condition = part(")")
+	stmt.Step = part(")")
+	p.skipNewlines()
+	p.expect(modeExpression, ")", "Missing closing ')' after expression in 'for' statement.")
+	stmt.Body = p.parseBlock("for ( )")
+	return stmt
+}
+
+func (p *parser) parseForEach(label string) Statement {
+	kw := p.next(modeCommand)
+	stmt := &ForEachStatement{Pos: kw.Pos, Label: label}
+	p.skipNewlines()
+	p.expect(modeExpression, "(", "Missing opening '(' after keyword 'foreach'.")
+	p.skipNewlines()
+	v := p.peek(modeExpression)
+	if v.Kind != TokenVariable {
+		p.fail(v, "Missing variable name after foreach.")
+	}
+	p.next(modeExpression)
+	stmt.Variable = v.Value
+	p.skipNewlines()
+	in := p.peek(modeCommand)
+	if in.Kind != TokenKeyword || in.Value != "in" {
+		p.fail(in, "Missing 'in' after variable in foreach loop.")
+	}
+	p.next(modeCommand)
+	p.skipNewlines()
+	stmt.Collection = p.parsePipelineOrControl()
+	p.skipNewlines()
+	p.expect(modeExpression, ")", "Missing closing ')' after expression in 'foreach' statement.")
+	stmt.Body = p.parseBlock("foreach ( )")
+	return stmt
+}
+
+func (p *parser) parseSwitch(label string) Statement {
+	kw := p.next(modeCommand)
+	stmt := &SwitchStatement{Pos: kw.Pos, Label: label}
+	for {
+		t := p.peek(modeCommand)
+		if t.Kind != TokenParameter {
+			break
+		}
+		p.next(modeCommand)
+		switch strings.ToLower(t.Value) {
+		case "regex":
+			stmt.Mode = "regex"
+		case "wildcard":
+			stmt.Mode = "wildcard"
+		case "exact":
+			stmt.Mode = "exact"
+		case "casesensitive":
+			stmt.CaseSense = true
+		default:
+			p.fail(t, "Invalid switch statement option '-%s'.", t.Value)
+		}
+	}
+	stmt.Subject = p.parseCondition(kw)
+	p.skipNewlines()
+	p.expect(modeExpression, "{", "Missing opening '{' in switch statement.")
+	for {
+		p.skipTerminators()
+		t := p.peek(modeCommand)
+		if t.Is("}") {
+			p.next(modeCommand)
+			return stmt
+		}
+		if t.Kind == TokenEOF {
+			p.fail(t, "Missing closing '}' in switch statement.")
+		}
+		var cond Expr
+		isDefault := false
+		switch t.Kind {
+		case TokenGeneric, TokenKeyword:
+			p.next(modeCommand)
+			if strings.EqualFold(t.Text, "default") {
+				isDefault = true
+			} else {
+				cond = p.bareword(t)
+			}
+		case TokenNumber:
+			p.next(modeCommand)
+			cond = p.number(t)
+		default:
+			cond = p.parsePostfix(p.parsePrimary(modeCommand))
+		}
+		body := p.parseBlock("switch condition")
+		if isDefault {
+			stmt.Default = body
+			if stmt.Default == nil {
+				stmt.Default = []Statement{}
+			}
+		} else {
+			stmt.Clauses = append(stmt.Clauses, SwitchClause{Condition: cond, Body: body})
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package psim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pipelineRun identifies one execution of a pipeline so that a stop request
+// from Select-Object -First only unwinds the pipeline it belongs to
+type pipelineRun struct{}
+
+// stage is one running element of a pipeline
+type stage interface {
+	begin() error
+	process(v interface{}) error
+	end() error
+}
+
+// execPipeline runs a pipeline statement, streaming objects from stage to stage
+func (rs *Runspace) execPipeline(p *PipelineStatement, out emitter) error {
+	run := &pipelineRun{}
+	stages := make([]stage, len(p.Elements))
+	// Stages are set up left to right, as PowerShell binds their arguments,
+	// each sending its output on to the next
+	for i, el := range p.Elements {
+		next := out
+		if i < len(p.Elements)-1 {
+			following := i + 1
+			next = func(v interface{}) error {
+				if err := rs.step(); err != nil {
+					return err
+				}
+				return stages[following].process(v)
+			}
+		}
+		st, err := rs.newStage(el, i, next, run)
+		if err != nil {
+			return err
+		}
+		stages[i] = st
+	}
+	stopped := func(err error) (int, bool) {
+		if sig, ok := err.(*stopSignal); ok && sig.run == run {
+			return sig.index, true
+		}
+		return 0, false
+	}
+	for _, st := range stages {
+		if err := st.begin(); err != nil {
+			return err
+		}
+	}
+	endFrom := 0
+	if err := stages[0].process(nil); err != nil {
+		index, ok := stopped(err)
+		if !ok {
+			return err
+		}
+		endFrom = index
+	}
+	for i := endFrom; i < len(stages); i++ {
+		if err := stages[i].end(); err != nil {
+			index, ok := stopped(err)
+			if !ok {
+				return err
+			}
+			if index > i {
+				i = index - 1
+			}
+		}
+	}
+	return nil
+}
+
+func (rs *Runspace) newStage(el PipelineElement, index int, out emitter, run *pipelineRun) (stage, error) {
+	switch el := el.(type) {
+	case *CommandExpression:
+		return rs.newExpressionStage(el, out)
+	case *CommandAst:
+		return rs.newCommandStage(el, index, out, run)
+	}
+	return nil, fmt.Errorf("unsupported pipeline element %T", el)
+}
+
+// redirect applies the redirections of one pipeline element to its output
+// and errors. Output sent to a file is buffered and written by flush when the
+// element ends.
+func (rs *Runspace) redirect(redirections []Redirection, out emitter) (emitter, func(*RuntimeError), func() error, error) {
+	var sink func(*RuntimeError)
+	flush := func() error { return nil }
+	for _, r := range redirections {
+		if r.Target == nil {
+			// 2>&1 and *>&1 merge errors into the success stream
+			target := out
+			sink = func(e *RuntimeError) { target(e) }
+			continue
+		}
+		output, errors, appendFile := redirectStreams(r.Op)
+		if v, ok := r.Target.(*VariableExpr); ok && strings.EqualFold(v.Name, "null") {
+			if errors {
+				sink = func(*RuntimeError) {}
+			}
+			if output {
+				out = discard
+			}
+			continue
+		}
+		target, err := rs.eval(r.Target)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		path, err := rs.resolvePath(toString(target))
+		if err != nil {
+			return nil, nil, nil, rs.newError(r, "", err.Error())
+		}
+		if !rs.fs.IsDir(parentPath(path)) {
+			return nil, nil, nil, rs.newError(r, "", fmt.Sprintf("Could not find a part of the path '%s'.", path))
+		}
+		if rs.fs.IsDir(path) {
+			return nil, nil, nil, rs.newError(r, "", fmt.Sprintf("Access to the path '%s' is denied.", path))
+		}
+		captured := &Result{Width: rs.width}
+		if output {
+			out = func(v interface{}) error {
+				captured.Records = append(captured.Records, Record{Stream: StreamOutput, Value: v})
+				return nil
+			}
+		}
+		if errors {
+			sink = func(e *RuntimeError) {
+				captured.Records = append(captured.Records, Record{Stream: StreamError, Value: e})
+			}
+		}
+		node := r
+		flush = func() error {
+			var lines []string
+			for _, seg := range captured.Segments() {
+				lines = append(lines, seg.Text)
+			}
+			text := strings.Join(lines, "\n")
+			if text != "" {
+				text += "\n"
+			}
+			if appendFile {
+				existing, _ := rs.fs.ReadFile(path)
+				text = existing + text
+			}
+			if err := rs.fs.WriteFile(path, text); err != nil {
+				return rs.newError(node, "", err.Error())
+			}
+			return nil
+		}
+	}
+	return out, sink, flush, nil
+}
+
+// redirectStreams reports which streams a redirection operator captures and whether it appends
+func redirectStreams(op string) (output, errors, appendFile bool) {
+	appendFile = strings.HasSuffix(op, ">>")
+	switch op[0] {
+	case '2':
+		return false, true, appendFile
+	case '*':
+		return true, true, appendFile
+	}
+	return true, false, appendFile
+}
+
+// expressionStage evaluates an expression at the start of a pipeline and enumerates its value
+type expressionStage struct {
+	rs    *Runspace
+	expr  *CommandExpression
+	out   emitter
+	flush func() error
+}
+
+func (rs *Runspace) newExpressionStage(el *CommandExpression, out emitter) (stage, error) {
+	out, _, flush, err := rs.redirect(el.Redirections, out)
+	if err != nil {
+		return nil, err
+	}
+	return &expressionStage{rs: rs, expr: el, out: out, flush: flush}, nil
+}
+
+func (s *expressionStage) begin() error { return nil }
+func (s *expressionStage) end() error   { return s.flush() }
+
+func (s *expressionStage) process(interface{}) error {
+	v, err := s.rs.eval(s.expr.Expr)
+	if err != nil {
+		return s.rs.errorAt(s.expr.Expr, err)
+	}
+	// ++ and -- used as statements produce no output, and neither do void
+	// methods such as $hash.Add() or a [void] cast
+	switch e := s.expr.Expr.(type) {
+	case *UnaryExpr:
+		if e.Op == "++" || e.Op == "--" {
+			return nil
+		}
+	case *InvokeMemberExpr:
+		if v == nil {
+			return nil
+		}
+	case *ConvertExpr:
+		if strings.EqualFold(e.Type, "void") || strings.EqualFold(e.Type, "System.Void") {
+			return nil
+		}
+	}
+	if list, ok := v.([]interface{}); ok {
+		for _, item := range list {
+			if err := s.out(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s.out(v)
+}
+
+// cmdletStage runs a cmdlet
+type cmdletStage struct {
+	call     *Call
+	upstream bool
+	flush    func() error
+}
+
+func (rs *Runspace) newCommandStage(cmd *CommandAst, index int, out emitter, run *pipelineRun) (stage, error) {
+	out, sink, flush, err := rs.redirect(cmd.Redirections, out)
+	if err != nil {
+		return nil, err
+	}
+	nameValue, err := rs.eval(cmd.Name)
+	if err != nil {
+		return nil, err
+	}
+	var cmdlet *Cmdlet
+	if sb, ok := nameValue.(*ScriptBlock); ok {
+		if cmd.Invocation == "" {
+			return nil, rs.newError(cmd, "", "Expressions are only allowed as the first element of a pipeline.")
+		}
+		if cmdlet, err = rs.scriptBlockCommand(sb, cmd.Invocation == "."); err != nil {
+			return nil, err
+		}
+	} else {
+		name := toString(nameValue)
+		if cmdlet, err = rs.findCommand(name, cmd.Invocation == "."); err != nil {
+			return nil, err
+		}
+		if cmdlet == nil {
+			return nil, rs.newError(cmd, name, fmt.Sprintf("The term '%s' is not recognized as a name of a cmdlet, function, script file, or executable program. Check the spelling of the name, or if a path was included, verify that the path is correct and try again.", name))
+		}
+	}
+	call := &Call{
+		Cmdlet:    cmdlet,
+		Runspace:  rs,
+		Bound:     map[string]interface{}{},
+		HasInput:  index > 0,
+		node:      cmd,
+		emit:      out,
+		errorSink: sink,
+		run:       run,
+		index:     index,
+	}
+	if err := rs.bindArguments(call, cmd); err != nil {
+		return nil, err
+	}
+	return &cmdletStage{call: call, upstream: index > 0, flush: flush}, nil
+}
+
+func (s *cmdletStage) begin() error {
+	s.call.Runspace.traceBinding(0, "CALLING BeginProcessing")
+	if s.call.Cmdlet.Begin != nil {
+		return s.call.halt(s.call.Cmdlet.Begin(s.call))
+	}
+	return nil
+}
+
+// process runs the cmdlet for one pipeline object, or once when the cmdlet
+// starts the pipeline. An object that can't be bound to the cmdlet's
+// parameters is reported and skipped.
+func (s *cmdletStage) process(v interface{}) error {
+	c := s.call
+	if s.upstream && (c.Cmdlet.Function == nil || c.Cmdlet.Function.bindsPipeline()) {
+		if err := c.bindPipeline(v); err != nil {
+			c.WriteError(err)
+			return c.halt(nil)
+		}
+	}
+	if c.Cmdlet.Process == nil {
+		if s.upstream {
+			c.Inputs = append(c.Inputs, v)
+			c.unbindPipeline()
+		}
+		return nil
+	}
+	c.Input = v
+	c.Runspace.traceBinding(0, "CALLING ProcessRecord")
+	return c.halt(c.Cmdlet.Process(c))
+}
+
+func (s *cmdletStage) end() error {
+	s.call.Runspace.traceBinding(0, "CALLING EndProcessing")
+	if s.call.Cmdlet.End != nil {
+		if err := s.call.halt(s.call.Cmdlet.End(s.call)); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+// findCommand resolves a command name, loading a script file named by its
+// path; it returns nil when nothing has the name
+func (rs *Runspace) findCommand(name string, dotted bool) (*Cmdlet, error) {
+	if cmdlet, ok := rs.resolveCommand(name); ok {
+		return cmdlet, nil
+	}
+	if !strings.ContainsAny(name, `\/`) || !strings.HasSuffix(strings.ToLower(name), ".ps1") {
+		return nil, nil
+	}
+	path, err := rs.resolvePath(name)
+	if err != nil || !rs.fs.Exists(path) || rs.fs.IsDir(path) {
+		return nil, nil
+	}
+	return rs.scriptCommand(path, dotted)
+}
@@ -0,0 +1,219 @@
+package psim
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Process is one entry in a simulated process table
+type Process struct {
+	Name           string
+	Id             int
+	CPU            float64 // total processor time in seconds
+	WorkingSet     int     // bytes
+	PrivateMemory  int     // bytes
+	NonpagedMemory int     // bytes of nonpaged pool
+	Handles        int
+	SessionId      int
+	Path           string
+	Company        string
+	Description    string
+	StartTime      time.Time
+}
+
+// ProcessTable is the set of processes Get-Process sees in a runspace
+type ProcessTable struct {
+	procs  []*Process
+	nextID int
+}
+
+// processEpoch is the simulated boot time; start times are offsets from it so output is reproducible
+var processEpoch = time.Date(2024, time.March, 4, 8, 15, 0, 0, time.Local)
+
+// NewProcessTable creates a table holding the given processes. Missing
+// fields are filled with realistic values derived from each process name,
+// so the same declaration always produces the same table.
+func NewProcessTable(procs ...Process) *ProcessTable {
+	t := &ProcessTable{nextID: 1000}
+	for _, p := range procs {
+		if p.Id >= t.nextID {
+			t.nextID = p.Id + 4
+		}
+	}
+	for _, p := range procs {
+		t.Add(p)
+	}
+	return t
+}
+
+// Add inserts a process, assigning an Id when it has none, and returns the stored entry
+func (t *ProcessTable) Add(p Process) *Process {
+	h := fnv.New64a()
+	h.Write([]byte(strings.ToLower(p.Name)))
+	rng := rand.New(rand.NewSource(int64(h.Sum64()) + int64(p.Id)))
+	if p.Id == 0 && !strings.EqualFold(p.Name, "Idle") {
+		p.Id = t.nextID
+		t.nextID += 4 + rng.Intn(8)*4
+	}
+	if p.WorkingSet == 0 {
+		p.WorkingSet = (4 + rng.Intn(200)) << 20
+	}
+	if p.PrivateMemory == 0 {
+		p.PrivateMemory = p.WorkingSet / 2
+	}
+	if p.Handles == 0 {
+		p.Handles = 100 + rng.Intn(1400)
+	}
+	if p.NonpagedMemory == 0 {
+		// Kernel objects behind each handle live in the nonpaged pool
+		p.NonpagedMemory = p.Handles * 56
+	}
+	if p.Path == "" {
+		p.Path = samplePath(p.Name)
+	}
+	for _, s := range sampleProcessNames {
+		if strings.EqualFold(s.name, p.Name) {
+			if p.Company == "" {
+				p.Company = s.company
+			}
+			if p.Description == "" {
+				p.Description = s.description
+			}
+		}
+	}
+	if p.StartTime.IsZero() {
+		p.StartTime = processEpoch.Add(time.Duration(rng.Intn(4*3600)) * time.Second)
+	}
+	stored := p
+	t.procs = append(t.procs, &stored)
+	return &stored
+}
+
+// List returns the processes sorted by name, then Id, the order Get-Process uses
+func (t *ProcessTable) List() []*Process {
+	out := append([]*Process(nil), t.procs...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := strings.ToLower(out[i].Name), strings.ToLower(out[j].Name)
+		if a != b {
+			return a < b
+		}
+		return out[i].Id < out[j].Id
+	})
+	return out
+}
+
+// Get returns the process with the given Id
+func (t *ProcessTable) Get(id int) *Process {
+	for _, p := range t.procs {
+		if p.Id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// Stop removes a process from the table, reporting whether it was running
+func (t *ProcessTable) Stop(id int) bool {
+	for i, p := range t.procs {
+		if p.Id == id {
+			t.procs = append(t.procs[:i], t.procs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns an independent copy of the table
+func (t *ProcessTable) Clone() *ProcessTable {
+	c := &ProcessTable{nextID: t.nextID}
+	for _, p := range t.procs {
+		cp := *p
+		c.procs = append(c.procs, &cp)
+	}
+	return c
+}
+
+// sampleProcessNames is the workstation process mix SampleProcesses draws from
+var sampleProcessNames = []struct {
+	name, company, description string
+	instances, session         int
+	cpu                        float64 // typical CPU seconds
+}{
+	{"System", "", "", 1, 0, 400},
+	{"Idle", "", "", 1, 0, 0},
+	{"smss", "Microsoft Corporation", "Windows Session Manager", 1, 0, 0.2},
+	{"csrss", "Microsoft Corporation", "Client Server Runtime Process", 2, 0, 6},
+	{"wininit", "Microsoft Corporation", "Windows Start-Up Application", 1, 0, 0.3},
+	{"services", "Microsoft Corporation", "Services and Controller app", 1, 0, 12},
+	{"lsass", "Microsoft Corporation", "Local Security Authority Process", 1, 0, 20},
+	{"svchost", "Microsoft Corporation", "Host Process for Windows Services", 6, 0, 30},
+	{"winlogon", "Microsoft Corporation", "Windows Logon Application", 1, 1, 0.5},
+	{"dwm", "Microsoft Corporation", "Desktop Window Manager", 1, 1, 95},
+	{"explorer", "Microsoft Corporation", "Windows Explorer", 1, 1, 80},
+	{"spoolsv", "Microsoft Corporation", "Spooler SubSystem App", 1, 0, 1.5},
+	{"MsMpEng", "Microsoft Corporation", "Antimalware Service Executable", 1, 0, 150},
+	{"chrome", "Google LLC", "Google Chrome", 4, 1, 60},
+	{"Code", "Microsoft Corporation", "Visual Studio Code", 2, 1, 40},
+	{"OUTLOOK", "Microsoft Corporation", "Microsoft Outlook", 1, 1, 55},
+	{"Teams", "Microsoft Corporation", "Microsoft Teams", 2, 1, 70},
+	{"notepad", "Microsoft Corporation", "Notepad", 1, 1, 0.4},
+	{"pwsh", "Microsoft Corporation", "PowerShell 7", 1, 1, 5},
+}
+
+// SampleProcesses returns a realistic workstation process list. The same
+// seed always produces the same processes, Ids and resource figures.
+func SampleProcesses(seed int64) []Process {
+	rng := rand.New(rand.NewSource(seed))
+	var out []Process
+	id := 4
+	for _, s := range sampleProcessNames {
+		for i := 0; i < s.instances; i++ {
+			p := Process{Name: s.name, Company: s.company, Description: s.description}
+			switch s.name {
+			case "Idle":
+				p.Id = 0
+			case "System":
+				p.Id = 4
+			default:
+				id += 4 * (1 + rng.Intn(300))
+				p.Id = id
+			}
+			p.CPU = math.Round(s.cpu*(0.25+rng.Float64()*1.5)*100) / 100
+			p.WorkingSet = (2 + rng.Intn(250)) << 20
+			if s.name == "Idle" {
+				p.CPU, p.WorkingSet = 0, 8192
+			}
+			p.PrivateMemory = p.WorkingSet * (40 + rng.Intn(50)) / 100
+			p.Handles = 80 + rng.Intn(2000)
+			p.SessionId = s.session
+			p.Path = samplePath(s.name)
+			p.StartTime = processEpoch.Add(time.Duration(rng.Intn(6*3600)) * time.Second)
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func samplePath(name string) string {
+	switch name {
+	case "System", "Idle":
+		return ""
+	case "chrome":
+		return `C:\Program Files\Google\Chrome\Application\chrome.exe`
+	case "Code":
+		return `C:\Users\learner\AppData\Local\Programs\Microsoft VS Code\Code.exe`
+	case "OUTLOOK":
+		return `C:\Program Files\Microsoft Office\root\Office16\OUTLOOK.EXE`
+	case "Teams":
+		return `C:\Users\learner\AppData\Local\Microsoft\Teams\current\Teams.exe`
+	case "pwsh":
+		return `C:\Program Files\PowerShell\7\pwsh.exe`
+	case "explorer":
+		return `C:\Windows\explorer.exe`
+	}
+	return `C:\Windows\System32\` + name + ".exe"
+}
@@ -0,0 +1,478 @@
+// Package psim is an embedded simulator for a subset of the PowerShell language.
+//
+// Scripts are tokenized and parsed into an AST and evaluated by a tree-walking
+// interpreter. Objects stream through pipelines of simulated cmdlets, so
+// lessons and exercises can run offline with no Windows machine or
+// PowerShell installation.
+package psim
+
+import (
+	"maps"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couragetogroww/powerhell/pkg/exchange"
+	"github.com/couragetogroww/powerhell/pkg/graph"
+	"github.com/couragetogroww/powerhell/pkg/onprem"
+)
+
+// Stream identifies the PowerShell output stream a record was written to
+type Stream int
+
+const (
+	StreamOutput Stream = iota
+	StreamError
+	StreamWarning
+	StreamVerbose
+	StreamHost
+	StreamDebug
+)
+
+// Record is a single item written to one of the output streams
+type Record struct {
+	Stream Stream
+	Value  interface{}
+}
+
+// Result holds everything a script wrote while it ran
+type Result struct {
+	Output   []interface{} // success stream objects
+	Records  []Record      // all streams in the order they were written
+	ExitCode int
+	Width    int // console width the output is formatted for
+}
+
+// Errors returns the error records written by the script
+func (r *Result) Errors() []error {
+	var errs []error
+	for _, rec := range r.Records {
+		if rec.Stream == StreamError {
+			if err, ok := rec.Value.(error); ok {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// HasErrors reports whether anything was written to the error stream
+func (r *Result) HasErrors() bool {
+	return len(r.Errors()) > 0
+}
+
+// Variable is a named value in a scope
+type Variable struct {
+	Name     string
+	Value    interface{}
+	Type     string // type constraint from [type]$name = ...
+	ReadOnly bool
+}
+
+// Scope is one level of PowerShell's dynamic variable scoping
+type Scope struct {
+	vars      map[string]*Variable
+	functions map[string]*Cmdlet // functions defined in the scope, keyed by lowercased name
+	parent    *Scope
+	script    bool          // the scope of a script file or module, which $script: refers to
+	module    *scriptModule // the module whose scope this is, if any
+}
+
+func newScope(parent *Scope) *Scope {
+	return &Scope{vars: map[string]*Variable{}, functions: map[string]*Cmdlet{}, parent: parent}
+}
+
+// function finds a function in the scope or its parents
+func (s *Scope) function(name string) *Cmdlet {
+	key := strings.ToLower(name)
+	for sc := s; sc != nil; sc = sc.parent {
+		if f, ok := sc.functions[key]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// scriptScope returns the nearest script or module scope, else the global one
+func (s *Scope) scriptScope() *Scope {
+	sc := s
+	for !sc.script && sc.parent != nil {
+		sc = sc.parent
+	}
+	return sc
+}
+
+func (s *Scope) lookup(name string) *Variable {
+	key := strings.ToLower(name)
+	for sc := s; sc != nil; sc = sc.parent {
+		if v, ok := sc.vars[key]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// Runspace holds the state of one simulated PowerShell session
+type Runspace struct {
+	global   *Scope
+	scope    *Scope
+	commands map[string]*Cmdlet
+	aliases  map[string]string
+	env      *Hashtable
+	records  []Record
+	output   []interface{}
+	source   *lexer
+	rand     *rand.Rand
+	clock    func() time.Time
+	depth    int
+	steps    int       // work done by the running script, see step
+	started  time.Time // when the running script started, by the wall clock
+	width    int       // console buffer width; 0 uses DefaultConsoleWidth
+
+	processes *ProcessTable
+	services  *ServiceTable
+	fs        *FileSystem
+	location  string   // current directory, a full path
+	locations []string // Push-Location stack
+	directory *onprem.Directory
+
+	tenant      *graph.Tenant
+	graphServer *graph.Server // started on the first Graph request
+	mgContext   *PSObject     // the Connect-MgGraph session, nil when disconnected
+
+	exchange     *exchange.Organization
+	exoConnected *PSObject // the Connect-ExchangeOnline connection, nil when disconnected
+
+	errors   []interface{}   // $Error, newest first
+	handlers int             // enclosing try statements and blocks with traps
+	failed   bool            // the current statement wrote an error, for $?
+	tracer   func(string)    // receives the ParameterBinding trace while Trace-Command runs
+	caught   *RuntimeError   // the error the innermost running catch block handles
+	modules  []*scriptModule // script modules imported with Import-Module
+}
+
+// NewRunspace creates a runspace with the built-in cmdlets and automatic variables
+func NewRunspace() *Runspace {
+	rs := &Runspace{
+		commands: maps.Clone(builtinCommands()),
+		aliases:  maps.Clone(builtinAliases),
+		env:      NewHashtable(),
+		rand:     rand.New(rand.NewSource(1)),
+		clock:    time.Now,
+
+		processes: NewProcessTable(SampleProcesses(DefaultProcessSeed)...),
+		services:  NewServiceTable(SampleServices()...),
+		fs:        NewFileSystem(),
+		location:  `C:\`,
+		directory: onprem.SampleDirectory(),
+		tenant:    graph.SampleTenant(),
+		exchange:  exchange.SampleOrganization(),
+	}
+	rs.global = newScope(nil)
+	rs.scope = rs.global
+	for k, v := range map[string]string{
+		"COMPUTERNAME": "PH-WS01",
+		"USERNAME":     "learner",
+		"USERDOMAIN":   "CONTOSO",
+		"USERPROFILE":  `C:\Users\learner`,
+		"TEMP":         `C:\Users\learner\AppData\Local\Temp`,
+		"OS":           "Windows_NT",
+		"PATH":         `C:\Windows\system32;C:\Windows;C:\Program Files\PowerShell\7`,
+		"PSModulePath": `C:\Users\learner\Documents\PowerShell\Modules;C:\Program Files\PowerShell\Modules;C:\Program Files\PowerShell\7\Modules`,
+	} {
+		rs.env.Set(k, v)
+	}
+	rs.defineConstant("true", true)
+	rs.defineConstant("false", false)
+	rs.defineConstant("null", nil)
+	rs.errors = []interface{}{}
+	rs.global.vars["error"] = &Variable{Name: "Error", Value: rs.errors, ReadOnly: true}
+	rs.global.vars["?"] = &Variable{Name: "?", Value: true, ReadOnly: true}
+	rs.SetVariable("OFS", " ")
+	rs.SetVariable("ErrorActionPreference", "Continue")
+	rs.SetVariable("HOME", `C:\Users\learner`)
+	rs.SetVariable("PSVersionTable", psVersionTable())
+	rs.SetVariable("PWD", pathInfo(rs.location))
+	return rs
+}
+
+func psVersionTable() *Hashtable {
+	h := NewHashtable()
+	h.Set("PSVersion", "7.4.1")
+	h.Set("PSEdition", "Core")
+	h.Set("OS", "Microsoft Windows 10.0.22631")
+	h.Set("Platform", "Win32NT")
+	return h
+}
+
+func (rs *Runspace) defineConstant(name string, value interface{}) {
+	rs.global.vars[name] = &Variable{Name: name, Value: value, ReadOnly: true}
+}
+
+var (
+	builtinOnce  sync.Once
+	builtinTable map[string]*Cmdlet
+)
+
+// builtinCommands returns the built-in cmdlets keyed by lowercased name.
+// A cmdlet doesn't change once built, so the table is built once and every
+// runspace starts from a copy of it.
+func builtinCommands() map[string]*Cmdlet {
+	builtinOnce.Do(func() {
+		builtinTable = map[string]*Cmdlet{}
+		for _, c := range builtinCmdlets() {
+			builtinTable[strings.ToLower(c.Name)] = c
+		}
+	})
+	return builtinTable
+}
+
+// newResolver returns a runspace that only looks up the built-in commands,
+// for reading scripts without running them. It shares the built-in tables,
+// so nothing may run in it.
+func newResolver() *Runspace {
+	global := newScope(nil)
+	return &Runspace{global: global, scope: global, commands: builtinCommands(), aliases: builtinAliases}
+}
+
+// Register adds or replaces a cmdlet
+func (rs *Runspace) Register(c *Cmdlet) {
+	rs.commands[strings.ToLower(c.Name)] = c
+}
+
+// DefaultProcessSeed seeds the process table of a new runspace
+const DefaultProcessSeed = 20240304
+
+// SetProcesses replaces the simulated process table
+func (rs *Runspace) SetProcesses(t *ProcessTable) {
+	rs.processes = t
+}
+
+// Processes returns the simulated process table
+func (rs *Runspace) Processes() *ProcessTable {
+	return rs.processes
+}
+
+// SetServices replaces the simulated service table
+func (rs *Runspace) SetServices(t *ServiceTable) {
+	rs.services = t
+}
+
+// Services returns the simulated service table
+func (rs *Runspace) Services() *ServiceTable {
+	return rs.services
+}
+
+// SetFileSystem replaces the simulated file system
+func (rs *Runspace) SetFileSystem(fs *FileSystem) {
+	rs.fs = fs
+	fs.clock = rs.clock
+	if !fs.IsDir(rs.location) {
+		rs.setLocation(`C:\`)
+	}
+}
+
+// FileSystem returns the simulated file system
+func (rs *Runspace) FileSystem() *FileSystem {
+	return rs.fs
+}
+
+// SetDirectory replaces the simulated Active Directory domain
+func (rs *Runspace) SetDirectory(d *onprem.Directory) {
+	rs.directory = d
+	d.SetClock(rs.clock)
+}
+
+// Directory returns the simulated Active Directory domain
+func (rs *Runspace) Directory() *onprem.Directory {
+	return rs.directory
+}
+
+// SetTenant replaces the Entra ID tenant the Graph service serves. Call it
+// before the first Graph request; the service keeps the tenant it started with.
+func (rs *Runspace) SetTenant(t *graph.Tenant) {
+	t.SetClock(rs.clock)
+	rs.tenant = t
+}
+
+// Tenant returns the Entra ID tenant behind the Graph service
+func (rs *Runspace) Tenant() *graph.Tenant {
+	return rs.tenant
+}
+
+// SetExchange replaces the simulated Exchange Online organization
+func (rs *Runspace) SetExchange(org *exchange.Organization) {
+	org.SetClock(rs.clock)
+	rs.exchange = org
+}
+
+// Exchange returns the simulated Exchange Online organization
+func (rs *Runspace) Exchange() *exchange.Organization {
+	return rs.exchange
+}
+
+// Close releases the loopback services the runspace started
+func (rs *Runspace) Close() error {
+	if rs.graphServer == nil {
+		return nil
+	}
+	err := rs.graphServer.Close()
+	rs.graphServer = nil
+	return err
+}
+
+// Location returns the current directory
+func (rs *Runspace) Location() string {
+	return rs.location
+}
+
+// Prompt returns the console prompt for the current location
+func (rs *Runspace) Prompt() string {
+	return "PS " + rs.location + "> "
+}
+
+func (rs *Runspace) setLocation(path string) {
+	rs.location = path
+	rs.global.vars["pwd"] = &Variable{Name: "PWD", Value: pathInfo(path)}
+}
+
+// resolvePath turns a path relative to the current location into a full path
+func (rs *Runspace) resolvePath(p string) (string, error) {
+	home := toString(rs.variableValue("HOME"))
+	return normalizePath(p, rs.location, home)
+}
+
+// SetSeed makes Get-Random and other randomized cmdlets deterministic
+func (rs *Runspace) SetSeed(seed int64) {
+	rs.rand = rand.New(rand.NewSource(seed))
+}
+
+// SetClock overrides the time source used by Get-Date and friends
+func (rs *Runspace) SetClock(clock func() time.Time) {
+	rs.clock = clock
+	rs.fs.clock = clock
+	rs.directory.SetClock(clock)
+	rs.tenant.SetClock(clock)
+	rs.exchange.SetClock(clock)
+}
+
+// SetConsoleWidth sets the buffer width output is formatted for
+func (rs *Runspace) SetConsoleWidth(width int) {
+	rs.width = width
+}
+
+// consoleWidth is the width Out-String and Out-File format for by default
+func (rs *Runspace) consoleWidth() int {
+	if rs.width > 0 {
+		return rs.width
+	}
+	return DefaultConsoleWidth
+}
+
+// GetVariable returns a variable's value from the current scope chain
+func (rs *Runspace) GetVariable(name string) (interface{}, bool) {
+	v := rs.scope.lookup(name)
+	if v == nil {
+		return nil, false
+	}
+	return v.Value, true
+}
+
+// SetVariable assigns a variable in the current scope
+func (rs *Runspace) SetVariable(name string, value interface{}) {
+	key := strings.ToLower(name)
+	if v, ok := rs.scope.vars[key]; ok {
+		v.Value = value
+		return
+	}
+	rs.scope.vars[key] = &Variable{Name: name, Value: value}
+}
+
+// Run parses and executes a script, returning everything it wrote
+func (rs *Runspace) Run(script string) *Result {
+	rs.records = nil
+	rs.output = nil
+	rs.handlers = 0
+	rs.caught = nil
+	rs.steps, rs.started = 0, time.Now()
+	result := &Result{Width: rs.width}
+	block, err := Parse(script)
+	if err != nil {
+		perr := err.(*ParseError)
+		rs.records = append(rs.records, Record{Stream: StreamError, Value: parseErrorToRuntime(perr)})
+		result.Records = rs.records
+		return result
+	}
+	rs.source = newLexer(script)
+	out := func(v interface{}) error {
+		rs.output = append(rs.output, v)
+		rs.records = append(rs.records, Record{Stream: StreamOutput, Value: v})
+		return nil
+	}
+	err = rs.execBlocks(block, out)
+	switch sig := err.(type) {
+	case nil:
+	case *exitSignal:
+		result.ExitCode = sig.code
+	case *breakSignal, *continueSignal, *returnSignal:
+	case *abortError:
+		re := &RuntimeError{Message: sig.message, Category: "OperationStopped", ErrorID: "ScriptStopped", Exception: "System.Management.Automation.PipelineStoppedException", Terminating: true}
+		rs.classifyError(re)
+		rs.reportError(re)
+	case *RuntimeError:
+		rs.reportError(sig)
+	default:
+		rs.reportError(&RuntimeError{Message: err.Error()})
+	}
+	result.Output = rs.output
+	result.Records = rs.records
+	return result
+}
+
+// Inspect runs a script against the session's state, its file system,
+// directory, processes, services and global variables, with only the
+// built-in commands. Functions, aliases and modules the session defined are
+// hidden while it runs, so a script can read the state without going
+// through commands the session replaced.
+func (rs *Runspace) Inspect(script string) *Result {
+	global := newScope(nil)
+	for k, v := range rs.global.vars {
+		cp := *v
+		global.vars[k] = &cp
+	}
+	saved := struct {
+		global, scope *Scope
+		commands      map[string]*Cmdlet
+		aliases       map[string]string
+		modules       []*scriptModule
+		errors        []interface{}
+	}{rs.global, rs.scope, rs.commands, rs.aliases, rs.modules, rs.errors}
+	defer func() {
+		rs.global, rs.scope, rs.commands, rs.aliases, rs.modules = saved.global, saved.scope, saved.commands, saved.aliases, saved.modules
+		rs.errors = saved.errors
+	}()
+	rs.global, rs.scope, rs.modules = global, global, nil
+	rs.commands, rs.aliases = maps.Clone(builtinCommands()), maps.Clone(builtinAliases)
+	return rs.Run(script)
+}
+
+func (rs *Runspace) writeHost(text string) {
+	rs.records = append(rs.records, Record{Stream: StreamHost, Value: text})
+}
+
+func (rs *Runspace) writeStream(stream Stream, value interface{}) {
+	rs.records = append(rs.records, Record{Stream: stream, Value: value})
+}
+
+func (rs *Runspace) writeError(err *RuntimeError) {
+	rs.records = append(rs.records, Record{Stream: StreamError, Value: err})
+}
+
+// withScope runs fn in a new child scope
+func (rs *Runspace) withScope(fn func() error) error {
+	saved := rs.scope
+	rs.scope = newScope(saved)
+	defer func() { rs.scope = saved }()
+	return fn()
+}
@@ -0,0 +1,93 @@
+package psim
+
+import (
+	"sort"
+	"strings"
+)
+
+// Service is one entry in the simulated service control manager
+type Service struct {
+	Name        string
+	DisplayName string
+	Status      string // Running or Stopped
+	StartType   string // Automatic, Manual or Disabled
+}
+
+// ServiceTable is the set of services Get-Service sees in a runspace
+type ServiceTable struct {
+	services []*Service
+}
+
+// NewServiceTable creates a table holding the given services. A service
+// without a display name uses its name, one without a status is stopped and
+// one without a start type starts manually.
+func NewServiceTable(services ...Service) *ServiceTable {
+	t := &ServiceTable{}
+	for _, s := range services {
+		if s.DisplayName == "" {
+			s.DisplayName = s.Name
+		}
+		if s.Status == "" {
+			s.Status = "Stopped"
+		}
+		if s.StartType == "" {
+			s.StartType = "Manual"
+		}
+		stored := s
+		t.services = append(t.services, &stored)
+	}
+	return t
+}
+
+// List returns the services sorted by name, the order Get-Service uses
+func (t *ServiceTable) List() []*Service {
+	out := append([]*Service(nil), t.services...)
+	sort.SliceStable(out, func(i, j int) bool {
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	return out
+}
+
+// Get returns the service with the given name, ignoring case
+func (t *ServiceTable) Get(name string) *Service {
+	for _, s := range t.services {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Clone returns an independent copy of the table
+func (t *ServiceTable) Clone() *ServiceTable {
+	c := &ServiceTable{}
+	for _, s := range t.services {
+		cp := *s
+		c.services = append(c.services, &cp)
+	}
+	return c
+}
+
+// SampleServices returns the services of a typical workstation
+func SampleServices() []Service {
+	return []Service{
+		{Name: "AudioSrv", DisplayName: "Windows Audio", Status: "Running", StartType: "Automatic"},
+		{Name: "BITS", DisplayName: "Background Intelligent Transfer Service", Status: "Running", StartType: "Manual"},
+		{Name: "Dhcp", DisplayName: "DHCP Client", Status: "Running", StartType: "Automatic"},
+		{Name: "Dnscache", DisplayName: "DNS Client", Status: "Running", StartType: "Automatic"},
+		{Name: "EventLog", DisplayName: "Windows Event Log", Status: "Running", StartType: "Automatic"},
+		{Name: "Fax", DisplayName: "Fax", Status: "Stopped", StartType: "Manual"},
+		{Name: "LanmanServer", DisplayName: "Server", Status: "Running", StartType: "Automatic"},
+		{Name: "LanmanWorkstation", DisplayName: "Workstation", Status: "Running", StartType: "Automatic"},
+		{Name: "RemoteRegistry", DisplayName: "Remote Registry", Status: "Stopped", StartType: "Disabled"},
+		{Name: "Schedule", DisplayName: "Task Scheduler", Status: "Running", StartType: "Automatic"},
+		{Name: "Spooler", DisplayName: "Print Spooler", Status: "Running", StartType: "Automatic"},
+		{Name: "sshd", DisplayName: "OpenSSH SSH Server", Status: "Stopped", StartType: "Manual"},
+		{Name: "TermService", DisplayName: "Remote Desktop Services", Status: "Stopped", StartType: "Manual"},
+		{Name: "W32Time", DisplayName: "Windows Time", Status: "Running", StartType: "Manual"},
+		{Name: "WinDefend", DisplayName: "Microsoft Defender Antivirus Service", Status: "Running", StartType: "Automatic"},
+		{Name: "WinRM", DisplayName: "Windows Remote Management (WS-Management)", Status: "Stopped", StartType: "Manual"},
+		{Name: "WSearch", DisplayName: "Windows Search", Status: "Running", StartType: "Automatic"},
+		{Name: "wuauserv", DisplayName: "Windows Update", Status: "Stopped", StartType: "Manual"},
+	}
+}
@@ -0,0 +1,618 @@
+package psim
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// staticMember implements [type]::Name
+func (rs *Runspace) staticMember(t *TypeInfo, name string) (interface{}, error) {
+	lname := strings.ToLower(name)
+	switch t.Name {
+	case "System.Math":
+		switch lname {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+	case "System.Int32":
+		switch lname {
+		case "maxvalue":
+			return math.MaxInt32, nil
+		case "minvalue":
+			return math.MinInt32, nil
+		}
+	case "System.Int64":
+		switch lname {
+		case "maxvalue":
+			return math.MaxInt64, nil
+		case "minvalue":
+			return math.MinInt64, nil
+		}
+	case "System.Double":
+		switch lname {
+		case "maxvalue":
+			return math.MaxFloat64, nil
+		case "minvalue":
+			return -math.MaxFloat64, nil
+		case "nan":
+			return math.NaN(), nil
+		case "positiveinfinity":
+			return math.Inf(1), nil
+		case "negativeinfinity":
+			return math.Inf(-1), nil
+		}
+	case "System.String":
+		if lname == "empty" {
+			return "", nil
+		}
+	case "System.DateTime":
+		switch lname {
+		case "now":
+			return rs.clock(), nil
+		case "today":
+			y, m, d := rs.clock().Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, time.Local), nil
+		case "utcnow":
+			return rs.clock().UTC(), nil
+		case "minvalue":
+			return time.Date(1, 1, 1, 0, 0, 0, 0, time.Local), nil
+		case "maxvalue":
+			return time.Date(9999, 12, 31, 23, 59, 59, 999999900, time.Local), nil
+		}
+	case "System.TimeSpan":
+		if lname == "zero" {
+			return time.Duration(0), nil
+		}
+	case "System.Guid":
+		if lname == "empty" {
+			return "00000000-0000-0000-0000-000000000000", nil
+		}
+	case "System.Environment":
+		switch lname {
+		case "newline":
+			return "\r\n", nil
+		case "machinename":
+			v, _ := rs.env.Get("COMPUTERNAME")
+			return v, nil
+		case "username":
+			v, _ := rs.env.Get("USERNAME")
+			return v, nil
+		case "userdomainname":
+			v, _ := rs.env.Get("USERDOMAIN")
+			return v, nil
+		case "processorcount":
+			return 8, nil
+		case "is64bitoperatingsystem", "is64bitprocess":
+			return true, nil
+		case "osversion":
+			return "Microsoft Windows NT 10.0.22631.0", nil
+		}
+	}
+	return nil, fmt.Errorf("The static member '%s' was not found on type [%s].", name, t.Name)
+}
+
+// invokeStatic implements [type]::Method(args)
+func (rs *Runspace) invokeStatic(t *TypeInfo, name string, args []interface{}) (interface{}, error) {
+	lname := strings.ToLower(name)
+	var (
+		v       interface{}
+		handled bool
+		err     error
+	)
+	switch t.Name {
+	case "System.Math":
+		v, handled, err = mathMethod(lname, args)
+	case "System.String":
+		v, handled, err = rs.stringStatic(lname, args)
+	case "System.Char":
+		if len(args) == 1 {
+			r, cerr := convertTo(args[0], "System.Char")
+			if cerr != nil {
+				return nil, cerr
+			}
+			v, handled = charMethod(r.(rune), lname)
+		}
+	case "System.DateTime":
+		v, handled, err = dateStatic(lname, args)
+	case "System.TimeSpan":
+		v, handled, err = timeSpanStatic(lname, args)
+	case "System.Guid":
+		switch lname {
+		case "newguid":
+			return rs.newGUID(), nil
+		case "parse":
+			if len(args) == 1 {
+				return strings.ToLower(toString(args[0])), nil
+			}
+		}
+	case "System.Environment":
+		switch lname {
+		case "getenvironmentvariable":
+			if len(args) >= 1 {
+				v, _ := rs.env.Get(toString(args[0]))
+				return v, nil
+			}
+		case "setenvironmentvariable":
+			if len(args) >= 2 {
+				rs.env.Set(toString(args[0]), toString(args[1]))
+				return nil, nil
+			}
+		}
+	case "System.IO.Path":
+		v, handled, err = pathStatic(lname, args)
+	case "System.Convert":
+		v, handled, err = convertStatic(lname, args)
+	case "System.Text.RegularExpressions.Regex":
+		v, handled, err = regexStatic(lname, args)
+	case "System.Int32", "System.Int64", "System.Double":
+		if lname == "parse" && len(args) >= 1 {
+			return convertTo(strings.TrimSpace(toString(args[0])), t.Name)
+		}
+	case "System.Management.Automation.ScriptBlock":
+		if lname == "create" && len(args) == 1 {
+			block, perr := Parse(toString(args[0]))
+			if perr != nil {
+				return nil, perr
+			}
+			return &ScriptBlock{Ast: block, source: newLexer(toString(args[0]))}, nil
+		}
+	default:
+		if lname == "new" && isExceptionType(t.Name) && len(args) <= 2 {
+			message := "Exception of type '" + t.Name + "' was thrown."
+			var inner interface{}
+			if len(args) > 0 {
+				message = toString(args[0])
+			}
+			if len(args) > 1 {
+				inner = args[1]
+			}
+			return newException(t.Name, message, inner), nil
+		}
+	}
+	if handled || err != nil {
+		return v, err
+	}
+	return nil, fmt.Errorf("Method invocation failed because [%s] does not contain a method named '%s'.", t.Name, name)
+}
+
+// newGUID returns a random-looking GUID from the runspace's seeded generator
+func (rs *Runspace) newGUID() string {
+	b := make([]byte, 16)
+	rs.rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func mathMethod(name string, args []interface{}) (interface{}, bool, error) {
+	floats := make([]float64, len(args))
+	allInt := true
+	for i, a := range args {
+		f, err := toFloat(a)
+		if err != nil {
+			return nil, true, err
+		}
+		floats[i] = f
+		if _, ok := a.(int); !ok {
+			allInt = false
+		}
+	}
+	one := func(fn func(float64) float64) (interface{}, bool, error) {
+		if len(args) != 1 {
+			return nil, true, argCountError(name, len(args))
+		}
+		return fn(floats[0]), true, nil
+	}
+	switch name {
+	case "round":
+		if len(args) == 0 || len(args) > 2 {
+			return nil, true, argCountError("Round", len(args))
+		}
+		digits := 0
+		if len(args) == 2 {
+			digits = int(floats[1])
+		}
+		scale := math.Pow(10, float64(digits))
+		r := math.RoundToEven(floats[0]*scale) / scale
+		if allInt {
+			return int(r), true, nil
+		}
+		return r, true, nil
+	case "floor":
+		return one(math.Floor)
+	case "ceiling":
+		return one(math.Ceil)
+	case "truncate":
+		return one(math.Trunc)
+	case "sqrt":
+		return one(math.Sqrt)
+	case "exp":
+		return one(math.Exp)
+	case "log10":
+		return one(math.Log10)
+	case "log":
+		if len(args) == 2 {
+			return math.Log(floats[0]) / math.Log(floats[1]), true, nil
+		}
+		return one(math.Log)
+	case "abs":
+		if len(args) == 1 && allInt {
+			n := args[0].(int)
+			if n < 0 {
+				n = -n
+			}
+			return n, true, nil
+		}
+		return one(math.Abs)
+	case "sign":
+		if len(args) != 1 {
+			return nil, true, argCountError("Sign", len(args))
+		}
+		switch {
+		case floats[0] > 0:
+			return 1, true, nil
+		case floats[0] < 0:
+			return -1, true, nil
+		}
+		return 0, true, nil
+	case "pow":
+		if len(args) != 2 {
+			return nil, true, argCountError("Pow", len(args))
+		}
+		return math.Pow(floats[0], floats[1]), true, nil
+	case "max", "min":
+		if len(args) != 2 {
+			return nil, true, argCountError(name, len(args))
+		}
+		pick := 0
+		if (name == "max") == (floats[1] > floats[0]) {
+			pick = 1
+		}
+		return args[pick], true, nil
+	}
+	return nil, false, nil
+}
+
+func (rs *Runspace) stringStatic(name string, args []interface{}) (interface{}, bool, error) {
+	switch name {
+	case "isnullorempty":
+		if len(args) != 1 {
+			return nil, true, argCountError("IsNullOrEmpty", len(args))
+		}
+		return toString(args[0]) == "", true, nil
+	case "isnullorwhitespace":
+		if len(args) != 1 {
+			return nil, true, argCountError("IsNullOrWhiteSpace", len(args))
+		}
+		return strings.TrimSpace(toString(args[0])) == "", true, nil
+	case "join":
+		if len(args) < 2 {
+			return nil, true, argCountError("Join", len(args))
+		}
+		items := args[1:]
+		if len(args) == 2 {
+			items = asList(args[1])
+		}
+		return joinValues(items, toString(args[0])), true, nil
+	case "concat":
+		var b strings.Builder
+		for _, a := range args {
+			b.WriteString(rs.expandValue(a))
+		}
+		return b.String(), true, nil
+	case "format":
+		if len(args) == 0 {
+			return nil, true, argCountError("Format", 0)
+		}
+		rest := args[1:]
+		if len(rest) == 1 {
+			rest = asList(rest[0])
+		}
+		s, err := formatOperator(toString(args[0]), rest)
+		return s, true, err
+	case "compare":
+		if len(args) < 2 {
+			return nil, true, argCountError("Compare", len(args))
+		}
+		ignoreCase := len(args) > 2 && toBool(args[2])
+		return compareStrings(toString(args[0]), toString(args[1]), !ignoreCase), true, nil
+	case "new":
+		if len(args) == 2 {
+			n, err := toInt(args[1])
+			if err != nil {
+				return nil, true, err
+			}
+			return strings.Repeat(toString(args[0]), n), true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func dateStatic(name string, args []interface{}) (interface{}, bool, error) {
+	switch name {
+	case "parse":
+		if len(args) == 0 {
+			return nil, true, argCountError("Parse", 0)
+		}
+		v, err := convertTo(toString(args[0]), "System.DateTime")
+		return v, true, err
+	case "parseexact":
+		if len(args) < 2 {
+			return nil, true, argCountError("ParseExact", len(args))
+		}
+		t, err := time.ParseInLocation(goDateLayout(toString(args[1])), toString(args[0]), time.Local)
+		if err != nil {
+			return nil, true, fmt.Errorf("Exception calling \"ParseExact\" with \"%d\" argument(s): \"String '%s' was not recognized as a valid DateTime.\"", len(args), toString(args[0]))
+		}
+		return t, true, nil
+	case "daysinmonth":
+		if len(args) != 2 {
+			return nil, true, argCountError("DaysInMonth", len(args))
+		}
+		y, err := toInt(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		m, err := toInt(args[1])
+		if err != nil {
+			return nil, true, err
+		}
+		return time.Date(y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC).Day(), true, nil
+	case "isleapyear":
+		if len(args) != 1 {
+			return nil, true, argCountError("IsLeapYear", len(args))
+		}
+		y, err := toInt(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		return y%4 == 0 && (y%100 != 0 || y%400 == 0), true, nil
+	}
+	return nil, false, nil
+}
+
+func timeSpanStatic(name string, args []interface{}) (interface{}, bool, error) {
+	units := map[string]time.Duration{
+		"fromdays":         24 * time.Hour,
+		"fromhours":        time.Hour,
+		"fromminutes":      time.Minute,
+		"fromseconds":      time.Second,
+		"frommilliseconds": time.Millisecond,
+	}
+	if unit, ok := units[name]; ok {
+		if len(args) != 1 {
+			return nil, true, argCountError(name, len(args))
+		}
+		f, err := toFloat(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		return time.Duration(f * float64(unit)), true, nil
+	}
+	if name == "parse" && len(args) == 1 {
+		v, err := convertTo(toString(args[0]), "System.TimeSpan")
+		return v, true, err
+	}
+	return nil, false, nil
+}
+
+func pathStatic(name string, args []interface{}) (interface{}, bool, error) {
+	if len(args) == 0 {
+		if name == "gettemppath" {
+			return `C:\Users\learner\AppData\Local\Temp\`, true, nil
+		}
+		return nil, false, nil
+	}
+	p := strings.ReplaceAll(toString(args[0]), `\`, "/")
+	win := func(s string) string { return strings.ReplaceAll(s, "/", `\`) }
+	switch name {
+	case "getextension":
+		return path.Ext(p), true, nil
+	case "getfilename":
+		if strings.HasSuffix(p, "/") {
+			return "", true, nil
+		}
+		return path.Base(p), true, nil
+	case "getfilenamewithoutextension":
+		base := path.Base(p)
+		return strings.TrimSuffix(base, path.Ext(base)), true, nil
+	case "getdirectoryname":
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return "", true, nil
+		}
+		dir := p[:i]
+		if strings.HasSuffix(dir, ":") {
+			dir += "/"
+		}
+		return win(dir), true, nil
+	case "combine", "join":
+		parts := make([]string, 0, len(args))
+		for _, a := range args {
+			s := strings.ReplaceAll(toString(a), "/", `\`)
+			if name == "combine" && (strings.HasPrefix(s, `\`) || len(s) > 1 && s[1] == ':') {
+				parts = parts[:0]
+			}
+			parts = append(parts, s)
+		}
+		out := ""
+		for i, s := range parts {
+			if i > 0 && !strings.HasSuffix(out, `\`) && !strings.HasPrefix(s, `\`) {
+				out += `\`
+			}
+			out += s
+		}
+		return out, true, nil
+	case "ispathrooted":
+		s := toString(args[0])
+		return strings.HasPrefix(s, `\`) || len(s) > 1 && s[1] == ':', true, nil
+	}
+	return nil, false, nil
+}
+
+func convertStatic(name string, args []interface{}) (interface{}, bool, error) {
+	if len(args) == 0 {
+		return nil, false, nil
+	}
+	switch name {
+	case "tobase64string":
+		b, err := toBytes(args[0])
+		if err != nil {
+			return nil, true, err
+		}
+		return base64.StdEncoding.EncodeToString(b), true, nil
+	case "frombase64string":
+		b, err := base64.StdEncoding.DecodeString(toString(args[0]))
+		if err != nil {
+			return nil, true, fmt.Errorf("Exception calling \"FromBase64String\" with \"1\" argument(s): \"The input is not a valid Base-64 string.\"")
+		}
+		out := make([]interface{}, len(b))
+		for i, c := range b {
+			out[i] = int(c)
+		}
+		return out, true, nil
+	case "toint32", "toint64":
+		if len(args) == 2 {
+			base, err := toInt(args[1])
+			if err != nil {
+				return nil, true, err
+			}
+			n, err := strconv.ParseInt(toString(args[0]), base, 64)
+			if err != nil {
+				return nil, true, fmt.Errorf("Exception calling \"%s\" with \"2\" argument(s): \"Could not find any recognizable digits.\"", name)
+			}
+			return int(n), true, nil
+		}
+		v, err := convertTo(args[0], "System.Int32")
+		return v, true, err
+	case "todouble":
+		v, err := convertTo(args[0], "System.Double")
+		return v, true, err
+	case "toboolean":
+		if s, ok := args[0].(string); ok {
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true":
+				return true, true, nil
+			case "false":
+				return false, true, nil
+			}
+			return nil, true, fmt.Errorf("Exception calling \"ToBoolean\" with \"1\" argument(s): \"String '%s' was not recognized as a valid Boolean.\"", s)
+		}
+		return toBool(args[0]), true, nil
+	case "tostring":
+		if len(args) == 2 {
+			n, err := toInt(args[0])
+			if err != nil {
+				return nil, true, err
+			}
+			base, err := toInt(args[1])
+			if err != nil {
+				return nil, true, err
+			}
+			return strconv.FormatInt(int64(n), base), true, nil
+		}
+		return toString(args[0]), true, nil
+	}
+	return nil, false, nil
+}
+
+// toBytes converts a string or array of numbers into bytes
+func toBytes(v interface{}) ([]byte, error) {
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	var b []byte
+	for _, item := range asList(v) {
+		n, err := toInt(item)
+		if err != nil || n < 0 || n > 255 {
+			return nil, &ConversionError{Value: item, Type: "System.Byte"}
+		}
+		b = append(b, byte(n))
+	}
+	return b, nil
+}
+
+func regexStatic(name string, args []interface{}) (interface{}, bool, error) {
+	if name == "escape" && len(args) == 1 {
+		return regexp.QuoteMeta(toString(args[0])), true, nil
+	}
+	if len(args) < 2 {
+		return nil, false, nil
+	}
+	input := toString(args[0])
+	re, err := compileRegex(toString(args[1]), true)
+	if err != nil {
+		return nil, true, err
+	}
+	switch name {
+	case "ismatch":
+		return re.MatchString(input), true, nil
+	case "match":
+		loc := re.FindStringSubmatchIndex(input)
+		return regexMatch(re, input, loc), true, nil
+	case "matches":
+		out := []interface{}{}
+		for _, loc := range re.FindAllStringSubmatchIndex(input, -1) {
+			out = append(out, regexMatch(re, input, loc))
+		}
+		return out, true, nil
+	case "replace":
+		if len(args) != 3 {
+			return nil, true, argCountError("Replace", len(args))
+		}
+		return re.ReplaceAllString(input, dotnetReplacement(toString(args[2]))), true, nil
+	case "split":
+		return stringsToValues(re.Split(input, -1)), true, nil
+	}
+	return nil, false, nil
+}
+
+// regexMatch builds a System.Text.RegularExpressions.Match object
+func regexMatch(re *regexp.Regexp, input string, loc []int) *PSObject {
+	m := NewObject("System.Text.RegularExpressions.Match", "System.Text.RegularExpressions.Group")
+	if loc == nil {
+		m.Add("Groups", []interface{}{})
+		m.Add("Success", false)
+		m.Add("Index", 0)
+		m.Add("Length", 0)
+		m.Add("Value", "")
+		return m
+	}
+	groups := []interface{}{}
+	names := re.SubexpNames()
+	for i := 0; i*2 < len(loc); i++ {
+		g := NewObject("System.Text.RegularExpressions.Group")
+		name := strconv.Itoa(i)
+		if names[i] != "" {
+			name = names[i]
+		}
+		g.Add("Name", name)
+		if loc[i*2] < 0 {
+			g.Add("Success", false)
+			g.Add("Value", "")
+		} else {
+			g.Add("Success", true)
+			g.Add("Index", utf8.RuneCountInString(input[:loc[i*2]]))
+			g.Add("Value", input[loc[i*2]:loc[i*2+1]])
+		}
+		groups = append(groups, g)
+	}
+	value := input[loc[0]:loc[1]]
+	m.Add("Groups", groups)
+	m.Add("Success", true)
+	m.Add("Name", "0")
+	m.Add("Index", utf8.RuneCountInString(input[:loc[0]]))
+	m.Add("Length", utf8.RuneCountInString(value))
+	m.Add("Value", value)
+	m.ToStringFunc = func(*PSObject) string { return value }
+	return m
+}
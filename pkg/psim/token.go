@@ -0,0 +1,663 @@
+package psim
+
+import (
+	"sort"
+	"strings"
+)
+
+// Pos identifies a location in script source
+type Pos struct {
+	Offset int
+	Line   int // 1-based
+	Column int // 1-based
+}
+
+// Position returns the position itself so that AST nodes can embed Pos
+func (p Pos) Position() Pos {
+	return p
+}
+
+// TokenKind classifies a lexical token
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	TokenNewline
+	TokenComment
+	TokenVariable    // $name, ${name}, $env:PATH
+	TokenSplat       // @name
+	TokenNumber      // 42, 1.5, 0xFF, 10MB
+	TokenString      // 'verbatim' and @'here-strings'@
+	TokenExpandable  // "expandable $strings" and @"here-strings"@
+	TokenGeneric     // barewords in command mode (command names and arguments)
+	TokenIdentifier  // member names and hashtable keys in expression mode
+	TokenKeyword     // if, foreach, while, ...
+	TokenParameter   // -Name in command mode
+	TokenOperator    // -eq, +, =, .., ...
+	TokenPunct       // ( ) { } [ ] @( @{ $( , ; | & . ::
+	TokenType        // [type] literals
+	TokenRedirection // > >> 2>&1
+)
+
+// Token is a single lexical element of a script
+type Token struct {
+	Kind  TokenKind
+	Text  string // raw source text
+	Value string // decoded value: variable name, string contents, lowercased operator
+	Pos   Pos
+	End   int // offset just past the token
+
+	open bool // unterminated string
+}
+
+// Is reports whether the token is the given punctuation or operator
+func (t Token) Is(text string) bool {
+	return (t.Kind == TokenPunct || t.Kind == TokenOperator) && t.Text == text
+}
+
+type lexMode int
+
+const (
+	modeExpression lexMode = iota
+	modeCommand
+)
+
+var keywords = map[string]bool{
+	"if": true, "elseif": true, "else": true, "foreach": true, "for": true,
+	"while": true, "do": true, "until": true, "switch": true, "break": true,
+	"continue": true, "return": true, "exit": true, "param": true,
+	"function": true, "filter": true, "begin": true, "process": true,
+	"end": true, "try": true, "catch": true, "finally": true, "trap": true,
+	"throw": true, "in": true,
+}
+
+// dashOperators are the operators spelled with a leading dash
+var dashOperators = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "ge": true, "lt": true, "le": true,
+	"like": true, "notlike": true, "match": true, "notmatch": true,
+	"contains": true, "notcontains": true, "in": true, "notin": true,
+	"replace": true, "split": true, "join": true, "is": true, "isnot": true,
+	"as": true, "and": true, "or": true, "xor": true, "not": true,
+	"band": true, "bor": true, "bxor": true, "bnot": true, "shl": true,
+	"shr": true, "f": true,
+}
+
+func isDashOperator(name string) bool {
+	name = strings.ToLower(name)
+	if dashOperators[name] {
+		return true
+	}
+	if len(name) > 1 && (name[0] == 'c' || name[0] == 'i') {
+		base := name[1:]
+		switch base {
+		case "eq", "ne", "gt", "ge", "lt", "le", "like", "notlike", "match",
+			"notmatch", "contains", "notcontains", "in", "notin", "replace", "split":
+			return true
+		}
+	}
+	return false
+}
+
+// lexer produces tokens on demand; the parser chooses the mode for each token
+type lexer struct {
+	src        string
+	lineStarts []int
+	comments   map[int]Token
+	path       string // file the source was read from; empty for typed input
+}
+
+func newLexer(src string) *lexer {
+	lx := &lexer{src: src, lineStarts: []int{0}, comments: map[int]Token{}}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lx.lineStarts = append(lx.lineStarts, i+1)
+		}
+	}
+	return lx
+}
+
+// pos converts a byte offset into a line/column position
+func (lx *lexer) pos(off int) Pos {
+	line := sort.Search(len(lx.lineStarts), func(i int) bool { return lx.lineStarts[i] > off }) - 1
+	if line < 0 {
+		line = 0
+	}
+	return Pos{Offset: off, Line: line + 1, Column: off - lx.lineStarts[line] + 1}
+}
+
+// lineText returns the source line containing the position
+func (lx *lexer) lineText(line int) string {
+	if line < 1 || line > len(lx.lineStarts) {
+		return ""
+	}
+	start := lx.lineStarts[line-1]
+	end := len(lx.src)
+	if line < len(lx.lineStarts) {
+		end = lx.lineStarts[line] - 1
+	}
+	return strings.TrimRight(lx.src[start:end], "\r")
+}
+
+func (lx *lexer) at(off int) byte {
+	if off < len(lx.src) && off >= 0 {
+		return lx.src[off]
+	}
+	return 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return isLetter(c) || isDigit(c)
+}
+
+// skipSpace skips blanks, comments and line continuations (but not newlines)
+func (lx *lexer) skipSpace(off int) int {
+	for off < len(lx.src) {
+		c := lx.src[off]
+		switch {
+		case isSpace(c):
+			off++
+		case c == '`' && (lx.at(off+1) == '\n' || lx.at(off+1) == '\r' && lx.at(off+2) == '\n'):
+			off++
+			if lx.at(off) == '\r' {
+				off++
+			}
+			off++
+		case c == '#':
+			start := off
+			for off < len(lx.src) && lx.src[off] != '\n' {
+				off++
+			}
+			lx.recordComment(start, off)
+		case c == '<' && lx.at(off+1) == '#':
+			start := off
+			end := strings.Index(lx.src[off+2:], "#>")
+			if end < 0 {
+				off = len(lx.src)
+			} else {
+				off = off + 2 + end + 2
+			}
+			lx.recordComment(start, off)
+		default:
+			return off
+		}
+	}
+	return off
+}
+
+func (lx *lexer) recordComment(start, end int) {
+	if _, ok := lx.comments[start]; ok {
+		return
+	}
+	text := lx.src[start:end]
+	lx.comments[start] = Token{Kind: TokenComment, Text: text, Value: text, Pos: lx.pos(start), End: end}
+}
+
+func (lx *lexer) token(kind TokenKind, start, end int, value string) Token {
+	return Token{Kind: kind, Text: lx.src[start:end], Value: value, Pos: lx.pos(start), End: end}
+}
+
+// scan returns the next token at or after off in the given mode
+func (lx *lexer) scan(off int, mode lexMode) Token {
+	off = lx.skipSpace(off)
+	if off >= len(lx.src) {
+		return Token{Kind: TokenEOF, Pos: lx.pos(len(lx.src)), End: len(lx.src)}
+	}
+	c := lx.src[off]
+	switch {
+	case c == '\n':
+		return lx.token(TokenNewline, off, off+1, "\n")
+	case c == ';':
+		return lx.token(TokenPunct, off, off+1, ";")
+	case c == '$':
+		return lx.scanDollar(off, mode)
+	case c == '@':
+		switch n := lx.at(off + 1); {
+		case n == '(' || n == '{':
+			return lx.token(TokenPunct, off, off+2, lx.src[off:off+2])
+		case n == '"' || n == '\'':
+			if t, ok := lx.scanHereString(off); ok {
+				return t
+			}
+		case isIdentChar(n) && mode == modeCommand:
+			end := off + 1
+			for end < len(lx.src) && isIdentChar(lx.src[end]) {
+				end++
+			}
+			return lx.token(TokenSplat, off, end, lx.src[off+1:end])
+		}
+	case c == '\'' || c == '"':
+		return lx.scanString(off)
+	case c == '(' || c == ')' || c == '{' || c == '}' || c == '[' || c == ']' || c == ',':
+		return lx.token(TokenPunct, off, off+1, string(c))
+	case c == '|':
+		if lx.at(off+1) == '|' {
+			return lx.token(TokenOperator, off, off+2, "||")
+		}
+		return lx.token(TokenPunct, off, off+1, "|")
+	case c == '&':
+		if lx.at(off+1) == '&' {
+			return lx.token(TokenOperator, off, off+2, "&&")
+		}
+		return lx.token(TokenPunct, off, off+1, "&")
+	}
+	if mode == modeCommand {
+		return lx.scanCommandToken(off)
+	}
+	return lx.scanExpressionToken(off)
+}
+
+func (lx *lexer) scanExpressionToken(off int) Token {
+	c := lx.src[off]
+	if isDigit(c) || c == '.' && isDigit(lx.at(off+1)) {
+		if end, _, ok := scanNumber(lx.src, off); ok {
+			return lx.token(TokenNumber, off, end, lx.src[off:end])
+		}
+	}
+	if isLetter(c) {
+		end := off
+		for end < len(lx.src) && isIdentChar(lx.src[end]) {
+			end++
+		}
+		word := lx.src[off:end]
+		if keywords[strings.ToLower(word)] {
+			return lx.token(TokenKeyword, off, end, strings.ToLower(word))
+		}
+		return lx.token(TokenIdentifier, off, end, word)
+	}
+	if c == '-' {
+		n := lx.at(off + 1)
+		if isLetter(n) {
+			end := off + 1
+			for end < len(lx.src) && isIdentChar(lx.src[end]) {
+				end++
+			}
+			if isDashOperator(lx.src[off+1 : end]) {
+				return lx.token(TokenOperator, off, end, "-"+strings.ToLower(lx.src[off+1:end]))
+			}
+		}
+	}
+	if t, ok := lx.scanRedirection(off); ok {
+		return t
+	}
+	for _, op := range []string{"::", "..", "++", "--", "+=", "-=", "*=", "/=", "%=", "-", "+", "*", "/", "%", "=", "!", ".", ":"} {
+		if strings.HasPrefix(lx.src[off:], op) {
+			return lx.token(TokenOperator, off, off+len(op), op)
+		}
+	}
+	return lx.token(TokenGeneric, off, off+1, string(c))
+}
+
+func (lx *lexer) scanRedirection(off int) (Token, bool) {
+	rest := lx.src[off:]
+	for _, r := range []string{"2>&1", "*>&1", "2>>", "*>>", "2>", "*>", ">>", ">"} {
+		if strings.HasPrefix(rest, r) {
+			return lx.token(TokenRedirection, off, off+len(r), r), true
+		}
+	}
+	return Token{}, false
+}
+
+// isArgTerminator reports whether c ends a bareword in command mode
+func isArgTerminator(c byte) bool {
+	switch c {
+	case 0, ' ', '\t', '\r', '\n', ';', '|', '(', ')', '{', '}', ',', '&', '>':
+		return true
+	}
+	return false
+}
+
+func (lx *lexer) scanCommandToken(off int) Token {
+	c := lx.src[off]
+	if c == '-' {
+		n := lx.at(off + 1)
+		if isLetter(n) || n == '?' {
+			end := off + 1
+			for end < len(lx.src) && !isArgTerminator(lx.src[end]) && lx.src[end] != ':' && lx.src[end] != '.' {
+				end++
+			}
+			if lx.at(end) == ':' {
+				return lx.token(TokenParameter, off, end+1, lx.src[off+1:end])
+			}
+			return lx.token(TokenParameter, off, end, lx.src[off+1:end])
+		}
+		if n == '-' && isArgTerminator(lx.at(off+2)) {
+			return lx.token(TokenParameter, off, off+2, "-")
+		}
+	}
+	// 2>&1 and 2> are redirections, not the number 2
+	if t, ok := lx.scanRedirection(off); ok {
+		return t
+	}
+	if isDigit(c) || c == '.' && isDigit(lx.at(off+1)) || c == '-' && (isDigit(lx.at(off+1)) || lx.at(off+1) == '.') {
+		start := off
+		if c == '-' {
+			start++
+		}
+		if end, _, ok := scanNumber(lx.src, start); ok && isArgTerminator(lx.at(end)) {
+			return lx.token(TokenNumber, off, end, lx.src[off:end])
+		}
+	}
+	if c == '.' && (isSpace(lx.at(off+1)) || lx.at(off+1) == '{' || lx.at(off+1) == '$' || lx.at(off+1) == '\'' || lx.at(off+1) == '"') {
+		return lx.token(TokenPunct, off, off+1, ".")
+	}
+	end := off
+	for end < len(lx.src) && !isArgTerminator(lx.src[end]) {
+		if lx.src[end] == '`' && end+1 < len(lx.src) {
+			end += 2
+			continue
+		}
+		if (lx.src[end] == '\'' || lx.src[end] == '"') && end > off {
+			break
+		}
+		end++
+	}
+	if end == off {
+		end = off + 1
+	}
+	word := lx.src[off:end]
+	if keywords[strings.ToLower(word)] {
+		return lx.token(TokenKeyword, off, end, strings.ToLower(word))
+	}
+	return lx.token(TokenGeneric, off, end, unescapeBareword(word))
+}
+
+func unescapeBareword(s string) string {
+	if !strings.Contains(s, "`") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '`' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func (lx *lexer) scanDollar(off int, mode lexMode) Token {
+	n := lx.at(off + 1)
+	switch {
+	case n == '(':
+		return lx.token(TokenPunct, off, off+2, "$(")
+	case n == '{':
+		end := strings.IndexByte(lx.src[off+2:], '}')
+		if end < 0 {
+			return lx.token(TokenVariable, off, len(lx.src), lx.src[off+2:])
+		}
+		return lx.token(TokenVariable, off, off+2+end+1, lx.src[off+2:off+2+end])
+	case n == '_' && !isIdentChar(lx.at(off+2)):
+		return lx.token(TokenVariable, off, off+2, "_")
+	case n == '?' || n == '$' || n == '^':
+		return lx.token(TokenVariable, off, off+2, string(n))
+	case isIdentChar(n):
+		end := off + 1
+		for end < len(lx.src) {
+			ch := lx.src[end]
+			if isIdentChar(ch) {
+				end++
+				continue
+			}
+			// Scope and drive qualifiers: $env:PATH, $script:count
+			if ch == ':' && isIdentChar(lx.at(end+1)) && lx.at(end+1) != ':' {
+				end++
+				continue
+			}
+			break
+		}
+		return lx.token(TokenVariable, off, end, lx.src[off+1:end])
+	}
+	return lx.token(TokenGeneric, off, off+1, "$")
+}
+
+// scanString lexes single- and double-quoted strings
+func (lx *lexer) scanString(off int) Token {
+	quote := lx.src[off]
+	i := off + 1
+	var b strings.Builder
+	for i < len(lx.src) {
+		c := lx.src[i]
+		if quote == '\'' {
+			if c == '\'' {
+				if lx.at(i+1) == '\'' {
+					b.WriteByte('\'')
+					i += 2
+					continue
+				}
+				return lx.token(TokenString, off, i+1, b.String())
+			}
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		switch {
+		case c == '`' && i+1 < len(lx.src):
+			b.WriteString(lx.src[i : i+2])
+			i += 2
+		case c == '$' && lx.at(i+1) == '(':
+			end := lx.skipSubexpression(i + 1)
+			b.WriteString(lx.src[i:end])
+			i = end
+		case c == '"':
+			if lx.at(i+1) == '"' {
+				b.WriteString("`\"")
+				i += 2
+				continue
+			}
+			return lx.token(TokenExpandable, off, i+1, b.String())
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	kind := TokenString
+	if quote == '"' {
+		kind = TokenExpandable
+	}
+	// Unterminated string: the parser reports the error
+	t := lx.token(kind, off, len(lx.src), b.String())
+	t.open = true
+	return t
+}
+
+// skipSubexpression returns the offset just past the parenthesis matching the one at off
+func (lx *lexer) skipSubexpression(off int) int {
+	depth := 0
+	for i := off; i < len(lx.src); {
+		switch c := lx.src[i]; c {
+		case '(':
+			depth++
+			i++
+		case ')':
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		case '\'', '"':
+			i = lx.scanString(i).End
+		case '`':
+			i += 2
+		default:
+			i++
+		}
+	}
+	return len(lx.src)
+}
+
+// scanHereString lexes @' '@ and @" "@ here-strings
+func (lx *lexer) scanHereString(off int) (Token, bool) {
+	quote := lx.src[off+1]
+	i := off + 2
+	for i < len(lx.src) && isSpace(lx.src[i]) && lx.src[i] != '\r' {
+		i++
+	}
+	if lx.at(i) == '\r' {
+		i++
+	}
+	if lx.at(i) != '\n' {
+		return Token{}, false
+	}
+	start := i + 1
+	terminator := "\n" + string(quote) + "@"
+	end := strings.Index(lx.src[i:], terminator)
+	kind := TokenString
+	if quote == '"' {
+		kind = TokenExpandable
+	}
+	if end < 0 {
+		t := lx.token(kind, off, len(lx.src), lx.src[start:])
+		t.open = true
+		return t, true
+	}
+	end += i
+	body := ""
+	if end > start {
+		body = strings.TrimSuffix(lx.src[start:end], "\r")
+	}
+	if quote == '"' {
+		body = strings.ReplaceAll(body, "\"", "`\"")
+	}
+	return lx.token(kind, off, end+len(terminator), body), true
+}
+
+// scanTypeName reads the contents of a [type] literal starting just after '['
+func (lx *lexer) scanTypeName(off int) (name string, end int, ok bool) {
+	depth := 1
+	i := off
+	for i < len(lx.src) {
+		switch lx.src[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(lx.src[off:i]), i + 1, true
+			}
+		case '\n', '(', ')', '$', '\'', '"', '{', '}':
+			return "", off, false
+		}
+		i++
+	}
+	return "", off, false
+}
+
+// scanNumber lexes a numeric literal; ok is false if the text is not a number
+func scanNumber(src string, off int) (end int, value interface{}, ok bool) {
+	i := off
+	at := func(j int) byte {
+		if j < len(src) {
+			return src[j]
+		}
+		return 0
+	}
+	if at(i) == '0' && (at(i+1) == 'x' || at(i+1) == 'X') {
+		j := i + 2
+		for isHexDigit(at(j)) {
+			j++
+		}
+		if j == i+2 {
+			return off, nil, false
+		}
+		var n int64
+		for _, ch := range src[i+2 : j] {
+			n = n*16 + int64(hexValue(byte(ch)))
+		}
+		j, mult := numberSuffix(src, j)
+		if isIdentChar(at(j)) {
+			return off, nil, false
+		}
+		return j, int(n) * mult, true
+	}
+	isFloat := false
+	for isDigit(at(i)) {
+		i++
+	}
+	if at(i) == '.' && isDigit(at(i+1)) {
+		isFloat = true
+		i++
+		for isDigit(at(i)) {
+			i++
+		}
+	}
+	if i == off {
+		return off, nil, false
+	}
+	if (at(i) == 'e' || at(i) == 'E') && (isDigit(at(i+1)) || (at(i+1) == '+' || at(i+1) == '-') && isDigit(at(i+2))) {
+		isFloat = true
+		i += 2
+		for isDigit(at(i)) {
+			i++
+		}
+	}
+	text := src[off:i]
+	j := i
+	if at(j) == 'd' || at(j) == 'D' {
+		isFloat = true
+		j++
+	} else if at(j) == 'l' || at(j) == 'L' {
+		j++
+	}
+	j, mult := numberSuffix(src, j)
+	if isIdentChar(at(j)) {
+		return off, nil, false
+	}
+	if !isFloat {
+		if n, err := parseInt(text); err == nil {
+			return j, n * mult, true
+		}
+	}
+	f, err := parseFloat(text)
+	if err != nil {
+		return off, nil, false
+	}
+	if mult != 1 {
+		f *= float64(mult)
+	}
+	return j, f, true
+}
+
+func numberSuffix(src string, j int) (int, int) {
+	if j+1 < len(src) {
+		switch strings.ToLower(src[j : j+2]) {
+		case "kb":
+			return j + 2, 1 << 10
+		case "mb":
+			return j + 2, 1 << 20
+		case "gb":
+			return j + 2, 1 << 30
+		case "tb":
+			return j + 2, 1 << 40
+		case "pb":
+			return j + 2, 1 << 50
+		}
+	}
+	return j, 1
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func hexValue(c byte) int {
+	switch {
+	case isDigit(c):
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	default:
+		return int(c-'A') + 10
+	}
+}
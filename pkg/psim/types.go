@@ -0,0 +1,370 @@
+package psim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// typeAccelerators maps short type names to full .NET names
+var typeAccelerators = map[string]string{
+	"int":            "System.Int32",
+	"int32":          "System.Int32",
+	"long":           "System.Int64",
+	"int64":          "System.Int64",
+	"byte":           "System.Byte",
+	"int16":          "System.Int16",
+	"double":         "System.Double",
+	"float":          "System.Single",
+	"single":         "System.Single",
+	"decimal":        "System.Decimal",
+	"string":         "System.String",
+	"char":           "System.Char",
+	"bool":           "System.Boolean",
+	"boolean":        "System.Boolean",
+	"switch":         "System.Management.Automation.SwitchParameter",
+	"datetime":       "System.DateTime",
+	"timespan":       "System.TimeSpan",
+	"array":          "System.Array",
+	"object":         "System.Object",
+	"psobject":       "System.Management.Automation.PSObject",
+	"pscustomobject": "System.Management.Automation.PSCustomObject",
+	"hashtable":      "System.Collections.Hashtable",
+	"ordered":        "System.Collections.Specialized.OrderedDictionary",
+	"scriptblock":    "System.Management.Automation.ScriptBlock",
+	"regex":          "System.Text.RegularExpressions.Regex",
+	"type":           "System.Type",
+	"void":           "System.Void",
+	"math":           "System.Math",
+	"convert":        "System.Convert",
+	"environment":    "System.Environment",
+	"guid":           "System.Guid",
+	"version":        "System.Version",
+	"io.path":        "System.IO.Path",
+	"valuetype":      "System.ValueType",
+	"enum":           "System.Enum",
+}
+
+// knownTypes maps lowercased full type names the simulator understands to their canonical spelling
+var knownTypes = map[string]string{}
+
+func init() {
+	for _, full := range typeAccelerators {
+		knownTypes[strings.ToLower(full)] = full
+	}
+	for _, full := range []string{
+		"System.Object[]", "System.RuntimeType", "System.Collections.ArrayList",
+		"System.Exception", "System.Management.Automation.ErrorRecord",
+	} {
+		knownTypes[strings.ToLower(full)] = full
+	}
+}
+
+// RegisterType makes a simulated type name resolvable in [type] literals
+func RegisterType(fullName string, accelerators ...string) {
+	knownTypes[strings.ToLower(fullName)] = fullName
+	for _, a := range accelerators {
+		typeAccelerators[strings.ToLower(a)] = fullName
+	}
+}
+
+// resolveType resolves a type literal such as int, string[] or System.IO.Path
+func resolveType(name string) (*TypeInfo, error) {
+	if full, ok := resolveTypeName(name); ok {
+		return &TypeInfo{Name: full}, nil
+	}
+	return nil, fmt.Errorf("Unable to find type [%s].", name)
+}
+
+func resolveTypeName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if strings.HasSuffix(name, "[]") {
+		elem, ok := resolveTypeName(strings.TrimSuffix(name, "[]"))
+		return elem + "[]", ok
+	}
+	lower := strings.ToLower(name)
+	if full, ok := typeAccelerators[lower]; ok {
+		return full, true
+	}
+	if full, ok := knownTypes[lower]; ok {
+		return full, true
+	}
+	if full, ok := knownTypes["system."+lower]; ok {
+		return full, true
+	}
+	return "", false
+}
+
+// isInstance implements -is
+func isInstance(v interface{}, full string) bool {
+	if v == nil {
+		return false
+	}
+	t := typeName(v)
+	if strings.EqualFold(t, full) {
+		return true
+	}
+	switch strings.ToLower(full) {
+	case "system.object":
+		return true
+	case "system.array":
+		_, ok := v.([]interface{})
+		return ok
+	case "system.valuetype":
+		switch v.(type) {
+		case int, float64, bool, rune, time.Time, time.Duration:
+			return true
+		}
+	case "system.int64":
+		_, ok := v.(int)
+		return ok && t == "System.Int64"
+	case "system.management.automation.psobject":
+		return true
+	case "system.collections.hashtable":
+		_, ok := v.(*Hashtable)
+		return ok
+	case "system.type":
+		_, ok := v.(*TypeInfo)
+		return ok
+	}
+	if o, ok := v.(*PSObject); ok {
+		return o.IsA(full)
+	}
+	return false
+}
+
+// convertTo implements [type] casts
+func convertTo(v interface{}, full string) (interface{}, error) {
+	lower := strings.ToLower(full)
+	if strings.HasSuffix(lower, "[]") {
+		elemType := full[:len(full)-2]
+		items := asList(v)
+		// A string becomes its characters, as [char[]]"abc" is 'a', 'b', 'c'
+		if s, ok := v.(string); ok && strings.EqualFold(elemType, "System.Char") {
+			items = nil
+			for _, c := range s {
+				items = append(items, c)
+			}
+		}
+		var out []interface{}
+		for _, item := range items {
+			if strings.EqualFold(elemType, "System.Object") {
+				out = append(out, item)
+				continue
+			}
+			c, err := convertTo(item, elemType)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, c)
+		}
+		if out == nil {
+			out = []interface{}{}
+		}
+		return out, nil
+	}
+	switch lower {
+	case "system.object", "system.management.automation.psobject":
+		return v, nil
+	case "system.void":
+		return nil, nil
+	case "system.int32", "system.int64", "system.int16", "system.byte":
+		if s, ok := v.(string); ok && strings.TrimSpace(s) == "" {
+			return 0, nil
+		}
+		if list, ok := v.([]interface{}); ok && len(list) != 1 {
+			return nil, &ConversionError{Value: v, Type: full}
+		}
+		n, err := toInt(v)
+		if err != nil {
+			return nil, &ConversionError{Value: v, Type: full, Reason: "Input string was not in a correct format."}
+		}
+		limits := map[string][2]int{
+			"system.int32": {math.MinInt32, math.MaxInt32},
+			"system.int16": {math.MinInt16, math.MaxInt16},
+			"system.byte":  {0, math.MaxUint8},
+		}
+		if lim, ok := limits[lower]; ok && (n < lim[0] || n > lim[1]) {
+			return nil, &ConversionError{Value: v, Type: full, Reason: fmt.Sprintf("Value was either too large or too small for %s.", shortTypeName(full))}
+		}
+		return n, nil
+	case "system.double", "system.single", "system.decimal":
+		if list, ok := v.([]interface{}); ok && len(list) != 1 {
+			return nil, &ConversionError{Value: v, Type: full}
+		}
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, &ConversionError{Value: v, Type: full, Reason: "Input string was not in a correct format."}
+		}
+		return f, nil
+	case "system.string":
+		if list, ok := v.([]interface{}); ok {
+			return joinValues(list, " "), nil
+		}
+		return toString(v), nil
+	case "system.char":
+		switch c := v.(type) {
+		case rune:
+			return c, nil
+		case int:
+			return rune(c), nil
+		case string:
+			r := []rune(c)
+			if len(r) == 1 {
+				return r[0], nil
+			}
+			return nil, &ConversionError{Value: v, Type: full, Reason: "String must be exactly one character long."}
+		}
+		return nil, &ConversionError{Value: v, Type: full}
+	case "system.boolean", "system.management.automation.switchparameter":
+		return toBool(v), nil
+	case "system.array":
+		return append([]interface{}{}, asList(v)...), nil
+	case "system.collections.hashtable":
+		if h, ok := v.(*Hashtable); ok {
+			return h, nil
+		}
+		return nil, &ConversionError{Value: v, Type: full}
+	case "system.collections.specialized.ordereddictionary":
+		if h, ok := v.(*Hashtable); ok {
+			c := h.Copy()
+			c.Ordered = true
+			return c, nil
+		}
+		return nil, &ConversionError{Value: v, Type: full}
+	case "system.management.automation.pscustomobject":
+		if h, ok := v.(*Hashtable); ok {
+			o := NewCustomObject()
+			for _, k := range h.Keys() {
+				val, _ := h.Get(k)
+				o.Add(toString(k), val)
+			}
+			return o, nil
+		}
+		return v, nil
+	case "system.datetime":
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			if parsed, ok := parseDateTime(t); ok {
+				return parsed, nil
+			}
+		}
+		return nil, &ConversionError{Value: v, Type: full, Reason: "String was not recognized as a valid DateTime."}
+	case "system.timespan":
+		switch t := v.(type) {
+		case time.Duration:
+			return t, nil
+		case int:
+			return time.Duration(t) * 100, nil
+		case string:
+			if d, ok := parseTimeSpan(t); ok {
+				return d, nil
+			}
+		}
+		return nil, &ConversionError{Value: v, Type: full}
+	case "system.management.automation.scriptblock":
+		if sb, ok := v.(*ScriptBlock); ok {
+			return sb, nil
+		}
+		return nil, &ConversionError{Value: v, Type: full}
+	case "system.text.regularexpressions.regex":
+		return toString(v), nil
+	case "system.type":
+		if t, ok := v.(*TypeInfo); ok {
+			return t, nil
+		}
+		return resolveType(toString(v))
+	case "system.collections.arraylist":
+		return append([]interface{}{}, asList(v)...), nil
+	}
+	if o, ok := v.(*PSObject); ok && o.IsA(full) {
+		return o, nil
+	}
+	return nil, &ConversionError{Value: v, Type: full}
+}
+
+var dateLayouts = []string{
+	"2006-01-02T15:04:05.9999999Z07:00",
+	"2006-01-02T15:04:05.9999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006 15:04:05",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 3:04 PM",
+	"1/2/2006 15:04",
+	"1/2/2006",
+	"January 2, 2006",
+	"January 2 2006",
+	"2 January 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2006/01/02",
+}
+
+func parseDateTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseTimeSpan parses [d.]hh:mm[:ss[.fffffff]]
+func parseTimeSpan(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	days := 0
+	if i := strings.Index(s, "."); i >= 0 && i < strings.Index(s+":", ":") {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, false
+		}
+		days, s = n, s[i+1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) == 1 {
+		n, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, false
+		}
+		d := time.Duration(n) * 24 * time.Hour
+		if neg {
+			d = -d
+		}
+		return d, true
+	}
+	if len(parts) > 3 {
+		return 0, false
+	}
+	var d time.Duration
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	for i, p := range parts {
+		if i == 2 {
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return 0, false
+			}
+			d += time.Duration(f * float64(time.Second))
+			continue
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, false
+		}
+		d += time.Duration(n) * units[i]
+	}
+	d += time.Duration(days) * 24 * time.Hour
+	if neg {
+		d = -d
+	}
+	return d, true
+}
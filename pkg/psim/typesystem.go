@@ -0,0 +1,810 @@
+package psim
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memberInfo is one member of a type as Get-Member describes it
+type memberInfo struct {
+	name       string
+	memberType string // Property, NoteProperty, AliasProperty, ScriptProperty, Method, ...
+	definition string
+}
+
+// prop describes a property from its definition, e.g. "int Length {get;}"
+func prop(definition string) memberInfo {
+	name := definition[:strings.Index(definition, " {")]
+	return memberInfo{name: name[strings.LastIndex(name, " ")+1:], memberType: "Property", definition: definition}
+}
+
+// method describes a method from its overloads, e.g. "string ToUpper()"
+func method(definition string) memberInfo {
+	name := definition[:strings.Index(definition, "(")]
+	return memberInfo{name: name[strings.LastIndex(name, " ")+1:], memberType: "Method", definition: definition}
+}
+
+// typeData is what the simulator knows about a .NET type: its base type and
+// the members it implements. Types whose values are PSObjects get their
+// properties from the object itself, so only their methods are listed.
+type typeData struct {
+	base    string
+	members []memberInfo
+	statics []memberInfo
+}
+
+// objectMembers are the methods every value inherits from System.Object
+var objectMembers = []memberInfo{
+	method("bool Equals(System.Object obj)"),
+	method("int GetHashCode()"),
+	method("type GetType()"),
+	method("string ToString()"),
+}
+
+// valueMembers are the methods the numeric and boolean types share
+func valueMembers(short string) []memberInfo {
+	return []memberInfo{
+		method("int CompareTo(System.Object value), int CompareTo(" + short + " value)"),
+		method("bool Equals(System.Object obj), bool Equals(" + short + " obj)"),
+		method("System.TypeCode GetTypeCode()"),
+		method("string ToString(), string ToString(string format)"),
+	}
+}
+
+var dictionaryMembers = []memberInfo{
+	prop("int Count {get;}"),
+	prop("bool IsFixedSize {get;}"),
+	prop("bool IsReadOnly {get;}"),
+	prop("bool IsSynchronized {get;}"),
+	prop("System.Collections.ICollection Keys {get;}"),
+	prop("System.Object SyncRoot {get;}"),
+	prop("System.Collections.ICollection Values {get;}"),
+	method("void Add(System.Object key, System.Object value)"),
+	method("void Clear()"),
+	method("System.Object Clone()"),
+	method("bool Contains(System.Object key)"),
+	method("bool ContainsKey(System.Object key)"),
+	method("bool ContainsValue(System.Object value)"),
+	method("System.Collections.IDictionaryEnumerator GetEnumerator()"),
+	method("void Remove(System.Object key)"),
+}
+
+// builtinTypes are the types the simulator models, keyed by full name
+var builtinTypes = map[string]*typeData{
+	"System.Object":    {},
+	"System.ValueType": {base: "System.Object"},
+	"System.Array":     {base: "System.Object"},
+	"System.String": {
+		base: "System.Object",
+		members: []memberInfo{
+			prop("int Length {get;}"),
+			method("System.Object Clone(), System.Object ICloneable.Clone()"),
+			method("int CompareTo(System.Object value), int CompareTo(string strB)"),
+			method("bool Contains(string value), bool Contains(char value)"),
+			method("bool EndsWith(string value), bool EndsWith(string value, System.StringComparison comparisonType)"),
+			method("bool Equals(System.Object obj), bool Equals(string value)"),
+			method("System.CharEnumerator GetEnumerator()"),
+			method("System.TypeCode GetTypeCode()"),
+			method("int IndexOf(string value), int IndexOf(char value)"),
+			method("string Insert(int startIndex, string value)"),
+			method("bool IsNormalized()"),
+			method("int LastIndexOf(string value), int LastIndexOf(char value)"),
+			method("string Normalize()"),
+			method("string PadLeft(int totalWidth), string PadLeft(int totalWidth, char paddingChar)"),
+			method("string PadRight(int totalWidth), string PadRight(int totalWidth, char paddingChar)"),
+			method("string Remove(int startIndex, int count), string Remove(int startIndex)"),
+			method("string Replace(string oldValue, string newValue), string Replace(char oldChar, char newChar)"),
+			method("string[] Split(Params char[] separator), string[] Split(char[] separator, System.StringSplitOptions options), string[] Split(string separator, System.StringSplitOptions options)"),
+			method("bool StartsWith(string value), bool StartsWith(string value, System.StringComparison comparisonType)"),
+			method("string Substring(int startIndex), string Substring(int startIndex, int length)"),
+			method("char[] ToCharArray()"),
+			method("string ToLower()"),
+			method("string ToLowerInvariant()"),
+			method("string ToString(), string ToString(System.IFormatProvider provider)"),
+			method("string ToUpper()"),
+			method("string ToUpperInvariant()"),
+			method("string Trim(), string Trim(Params char[] trimChars)"),
+			method("string TrimEnd(), string TrimEnd(Params char[] trimChars)"),
+			method("string TrimStart(), string TrimStart(Params char[] trimChars)"),
+		},
+		statics: []memberInfo{
+			prop("static string Empty {get;}"),
+			method("static int Compare(string strA, string strB), static int Compare(string strA, string strB, bool ignoreCase)"),
+			method("static string Concat(Params System.Object[] args)"),
+			method("static string Format(string format, Params System.Object[] args)"),
+			method("static bool IsNullOrEmpty(string value)"),
+			method("static bool IsNullOrWhiteSpace(string value)"),
+			method("static string Join(string separator, Params string[] value)"),
+		},
+	},
+	"System.Int32": {
+		base:    "System.ValueType",
+		members: valueMembers("int"),
+		statics: []memberInfo{
+			prop("static int MaxValue {get;}"),
+			prop("static int MinValue {get;}"),
+			method("static int Parse(string s)"),
+		},
+	},
+	"System.Int64": {
+		base:    "System.ValueType",
+		members: valueMembers("long"),
+		statics: []memberInfo{
+			prop("static long MaxValue {get;}"),
+			prop("static long MinValue {get;}"),
+			method("static long Parse(string s)"),
+		},
+	},
+	"System.Double": {
+		base:    "System.ValueType",
+		members: valueMembers("double"),
+		statics: []memberInfo{
+			prop("static double MaxValue {get;}"),
+			prop("static double MinValue {get;}"),
+			prop("static double NaN {get;}"),
+			prop("static double NegativeInfinity {get;}"),
+			prop("static double PositiveInfinity {get;}"),
+			method("static double Parse(string s)"),
+		},
+	},
+	"System.Boolean": {
+		base: "System.ValueType",
+		members: []memberInfo{
+			method("int CompareTo(System.Object obj), int CompareTo(bool value)"),
+			method("bool Equals(System.Object obj), bool Equals(bool obj)"),
+			method("System.TypeCode GetTypeCode()"),
+		},
+	},
+	"System.Char": {
+		base: "System.ValueType",
+		members: []memberInfo{
+			method("int CompareTo(System.Object value), int CompareTo(char value)"),
+			method("bool Equals(System.Object obj), bool Equals(char obj)"),
+			method("System.TypeCode GetTypeCode()"),
+		},
+		statics: []memberInfo{
+			method("static bool IsDigit(char c)"),
+			method("static bool IsLetter(char c)"),
+			method("static bool IsLetterOrDigit(char c)"),
+			method("static bool IsLower(char c)"),
+			method("static bool IsPunctuation(char c)"),
+			method("static bool IsUpper(char c)"),
+			method("static bool IsWhiteSpace(char c)"),
+			method("static char ToLower(char c)"),
+			method("static char ToUpper(char c)"),
+		},
+	},
+	"System.DateTime": {
+		base: "System.ValueType",
+		members: []memberInfo{
+			{name: "DisplayHint", memberType: "NoteProperty", definition: "DisplayHintType DisplayHint=DateTime"},
+			prop("datetime Date {get;}"),
+			prop("int Day {get;}"),
+			prop("System.DayOfWeek DayOfWeek {get;}"),
+			prop("int DayOfYear {get;}"),
+			prop("int Hour {get;}"),
+			prop("System.DateTimeKind Kind {get;}"),
+			prop("int Millisecond {get;}"),
+			prop("int Minute {get;}"),
+			prop("int Month {get;}"),
+			prop("int Second {get;}"),
+			prop("long Ticks {get;}"),
+			prop("timespan TimeOfDay {get;}"),
+			prop("int Year {get;}"),
+			{name: "DateTime", memberType: "ScriptProperty", definition: `System.Object DateTime {get=$this.ToLongDateString() + " " + $this.ToLongTimeString();}`},
+			method("datetime Add(timespan value)"),
+			method("datetime AddDays(double value)"),
+			method("datetime AddHours(double value)"),
+			method("datetime AddMilliseconds(double value)"),
+			method("datetime AddMinutes(double value)"),
+			method("datetime AddMonths(int months)"),
+			method("datetime AddSeconds(double value)"),
+			method("datetime AddTicks(long value)"),
+			method("datetime AddYears(int value)"),
+			method("int CompareTo(System.Object value), int CompareTo(datetime value)"),
+			method("bool Equals(System.Object value), bool Equals(datetime value)"),
+			method("System.TypeCode GetTypeCode()"),
+			method("bool IsDaylightSavingTime()"),
+			method("timespan Subtract(datetime value), datetime Subtract(timespan value)"),
+			method("datetime ToLocalTime()"),
+			method("string ToLongDateString()"),
+			method("string ToLongTimeString()"),
+			method("string ToShortDateString()"),
+			method("string ToShortTimeString()"),
+			method("string ToString(), string ToString(string format)"),
+			method("datetime ToUniversalTime()"),
+		},
+		statics: []memberInfo{
+			prop("static datetime MaxValue {get;}"),
+			prop("static datetime MinValue {get;}"),
+			prop("static datetime Now {get;}"),
+			prop("static datetime Today {get;}"),
+			prop("static datetime UtcNow {get;}"),
+			method("static int DaysInMonth(int year, int month)"),
+			method("static bool IsLeapYear(int year)"),
+			method("static datetime Parse(string s)"),
+			method("static datetime ParseExact(string s, string format, System.IFormatProvider provider)"),
+		},
+	},
+	"System.TimeSpan": {
+		base: "System.ValueType",
+		members: []memberInfo{
+			prop("int Days {get;}"),
+			prop("int Hours {get;}"),
+			prop("int Milliseconds {get;}"),
+			prop("int Minutes {get;}"),
+			prop("int Seconds {get;}"),
+			prop("long Ticks {get;}"),
+			prop("double TotalDays {get;}"),
+			prop("double TotalHours {get;}"),
+			prop("double TotalMilliseconds {get;}"),
+			prop("double TotalMinutes {get;}"),
+			prop("double TotalSeconds {get;}"),
+			method("timespan Add(timespan ts)"),
+			method("int CompareTo(System.Object value), int CompareTo(timespan value)"),
+			method("timespan Duration()"),
+			method("timespan Negate()"),
+			method("timespan Subtract(timespan ts)"),
+			method("string ToString(), string ToString(string format)"),
+		},
+		statics: []memberInfo{
+			prop("static timespan Zero {get;}"),
+			method("static timespan FromDays(double value)"),
+			method("static timespan FromHours(double value)"),
+			method("static timespan FromMilliseconds(double value)"),
+			method("static timespan FromMinutes(double value)"),
+			method("static timespan FromSeconds(double value)"),
+			method("static timespan Parse(string s)"),
+		},
+	},
+	"System.Object[]": {
+		base: "System.Array",
+		members: []memberInfo{
+			{name: "Count", memberType: "AliasProperty", definition: "Count = Length"},
+			prop("bool IsFixedSize {get;}"),
+			prop("bool IsReadOnly {get;}"),
+			prop("bool IsSynchronized {get;}"),
+			prop("int Length {get;}"),
+			prop("long LongLength {get;}"),
+			prop("int Rank {get;}"),
+			prop("System.Object SyncRoot {get;}"),
+			method("System.Object Clone(), System.Object ICloneable.Clone()"),
+			method("bool IList.Contains(System.Object value)"),
+			method("System.Object Get(int )"),
+			method("System.Collections.IEnumerator GetEnumerator()"),
+			method("int GetLength(int dimension)"),
+			method("int GetLowerBound(int dimension)"),
+			method("int GetUpperBound(int dimension)"),
+			method("System.Object GetValue(int index)"),
+			method("int IList.IndexOf(System.Object value)"),
+			method("void Set(int , System.Object )"),
+			method("void SetValue(System.Object value, int index)"),
+		},
+	},
+	"System.Collections.Hashtable":                     {base: "System.Object", members: dictionaryMembers},
+	"System.Collections.Specialized.OrderedDictionary": {base: "System.Object", members: dictionaryMembers},
+	"System.Management.Automation.ScriptBlock": {
+		base: "System.Object",
+		members: []memberInfo{
+			prop("System.Management.Automation.Language.Ast Ast {get;}"),
+			prop("string File {get;}"),
+			prop("bool IsFilter {get;set;}"),
+			method("scriptblock GetNewClosure()"),
+			method("System.Collections.ObjectModel.Collection[psobject] Invoke(Params System.Object[] args)"),
+			method("System.Object InvokeReturnAsIs(Params System.Object[] args)"),
+		},
+		statics: []memberInfo{
+			method("static scriptblock Create(string script)"),
+		},
+	},
+	"System.RuntimeType":           {base: "System.Reflection.TypeInfo"},
+	"System.Reflection.TypeInfo":   {base: "System.Type"},
+	"System.Reflection.MemberInfo": {base: "System.Object"},
+	"System.Type": {
+		base: "System.Reflection.MemberInfo",
+		members: []memberInfo{
+			prop("type BaseType {get;}"),
+			prop("string FullName {get;}"),
+			prop("bool IsArray {get;}"),
+			prop("bool IsClass {get;}"),
+			prop("bool IsPublic {get;}"),
+			prop("bool IsSerializable {get;}"),
+			prop("bool IsValueType {get;}"),
+			prop("string Name {get;}"),
+			prop("string Namespace {get;}"),
+			method("type GetElementType()"),
+		},
+	},
+	"System.Security.SecureString": {
+		base:    "System.Object",
+		members: []memberInfo{prop("int Length {get;}")},
+	},
+	"System.Math": {
+		base: "System.Object",
+		statics: []memberInfo{
+			prop("static double E {get;}"),
+			prop("static double PI {get;}"),
+			method("static double Abs(double value), static int Abs(int value)"),
+			method("static double Ceiling(double a)"),
+			method("static double Exp(double d)"),
+			method("static double Floor(double d)"),
+			method("static double Log(double d), static double Log(double a, double newBase)"),
+			method("static double Log10(double d)"),
+			method("static double Max(double val1, double val2), static int Max(int val1, int val2)"),
+			method("static double Min(double val1, double val2), static int Min(int val1, int val2)"),
+			method("static double Pow(double x, double y)"),
+			method("static double Round(double a), static double Round(double value, int digits)"),
+			method("static int Sign(double value)"),
+			method("static double Sqrt(double d)"),
+			method("static double Truncate(double d)"),
+		},
+	},
+	"System.Environment": {
+		base: "System.Object",
+		statics: []memberInfo{
+			prop("static bool Is64BitOperatingSystem {get;}"),
+			prop("static bool Is64BitProcess {get;}"),
+			prop("static string MachineName {get;}"),
+			prop("static string NewLine {get;}"),
+			prop("static System.OperatingSystem OSVersion {get;}"),
+			prop("static int ProcessorCount {get;}"),
+			prop("static string UserDomainName {get;}"),
+			prop("static string UserName {get;}"),
+			method("static string GetEnvironmentVariable(string variable)"),
+			method("static void SetEnvironmentVariable(string variable, string value)"),
+		},
+	},
+	"System.Guid": {
+		base: "System.ValueType",
+		statics: []memberInfo{
+			prop("static guid Empty {get;}"),
+			method("static guid NewGuid()"),
+			method("static guid Parse(string input)"),
+		},
+	},
+	"System.IO.Path": {
+		base: "System.Object",
+		statics: []memberInfo{
+			method("static string Combine(Params string[] paths)"),
+			method("static string GetDirectoryName(string path)"),
+			method("static string GetExtension(string path)"),
+			method("static string GetFileName(string path)"),
+			method("static string GetFileNameWithoutExtension(string path)"),
+			method("static string GetTempPath()"),
+			method("static bool IsPathRooted(string path)"),
+			method("static string Join(Params string[] paths)"),
+		},
+	},
+	"System.Convert": {
+		base: "System.Object",
+		statics: []memberInfo{
+			method("static byte[] FromBase64String(string s)"),
+			method("static string ToBase64String(byte[] inArray)"),
+			method("static bool ToBoolean(System.Object value)"),
+			method("static double ToDouble(System.Object value)"),
+			method("static int ToInt32(System.Object value), static int ToInt32(string value, int fromBase)"),
+			method("static long ToInt64(System.Object value), static long ToInt64(string value, int fromBase)"),
+			method("static string ToString(System.Object value), static string ToString(long value, int toBase)"),
+		},
+	},
+	"System.Text.RegularExpressions.Regex": {
+		base: "System.Object",
+		statics: []memberInfo{
+			method("static string Escape(string str)"),
+			method("static bool IsMatch(string input, string pattern)"),
+			method("static System.Text.RegularExpressions.Match Match(string input, string pattern)"),
+			method("static System.Text.RegularExpressions.MatchCollection Matches(string input, string pattern)"),
+			method("static string Replace(string input, string pattern, string replacement)"),
+			method("static string[] Split(string input, string pattern)"),
+		},
+	},
+	"System.Diagnostics.Process": {
+		base: "System.ComponentModel.Component",
+		members: []memberInfo{
+			method("void Kill(), void Kill(bool entireProcessTree)"),
+			method("void Refresh()"),
+		},
+	},
+	"System.ServiceProcess.ServiceController": {
+		base: "System.ComponentModel.Component",
+		members: []memberInfo{
+			method("void Start(), void Start(string[] args)"),
+			method("void Stop(), void Stop(bool stopDependentServices)"),
+			method("void Refresh()"),
+		},
+	},
+	"System.IO.FileInfo": {
+		base:    "System.IO.FileSystemInfo",
+		members: []memberInfo{method("void Delete()")},
+	},
+	"System.IO.DirectoryInfo": {
+		base:    "System.IO.FileSystemInfo",
+		members: []memberInfo{method("void Delete()")},
+	},
+	"System.Management.Automation.ErrorRecord": {
+		base: "System.Object",
+		members: []memberInfo{
+			prop("System.Management.Automation.ErrorCategoryInfo CategoryInfo {get;}"),
+			prop("System.Management.Automation.ErrorDetails ErrorDetails {get;set;}"),
+			prop("System.Exception Exception {get;}"),
+			prop("string FullyQualifiedErrorId {get;}"),
+			prop("System.Management.Automation.InvocationInfo InvocationInfo {get;}"),
+			prop("System.Collections.ObjectModel.ReadOnlyCollection[int] PipelineIterationInfo {get;}"),
+			prop("string ScriptStackTrace {get;}"),
+			prop("System.Object TargetObject {get;}"),
+			method("void GetObjectData(System.Runtime.Serialization.SerializationInfo info, System.Runtime.Serialization.StreamingContext context)"),
+		},
+	},
+	"System.Exception": {
+		base: "System.Object",
+		members: []memberInfo{
+			method("System.Exception GetBaseException()"),
+			method("void GetObjectData(System.Runtime.Serialization.SerializationInfo info, System.Runtime.Serialization.StreamingContext context)"),
+		},
+	},
+	"System.SystemException":                                               {base: "System.Exception"},
+	"System.ArgumentException":                                             {base: "System.SystemException"},
+	"System.ArgumentNullException":                                         {base: "System.ArgumentException"},
+	"System.ArgumentOutOfRangeException":                                   {base: "System.ArgumentException"},
+	"System.ArithmeticException":                                           {base: "System.SystemException"},
+	"System.DivideByZeroException":                                         {base: "System.ArithmeticException"},
+	"System.FormatException":                                               {base: "System.SystemException"},
+	"System.IndexOutOfRangeException":                                      {base: "System.SystemException"},
+	"System.InvalidCastException":                                          {base: "System.SystemException"},
+	"System.InvalidOperationException":                                     {base: "System.SystemException"},
+	"System.NotImplementedException":                                       {base: "System.SystemException"},
+	"System.NotSupportedException":                                         {base: "System.SystemException"},
+	"System.TimeoutException":                                              {base: "System.SystemException"},
+	"System.UnauthorizedAccessException":                                   {base: "System.SystemException"},
+	"System.IO.IOException":                                                {base: "System.SystemException"},
+	"System.IO.DirectoryNotFoundException":                                 {base: "System.IO.IOException"},
+	"System.IO.FileNotFoundException":                                      {base: "System.IO.IOException"},
+	"System.Management.Automation.RuntimeException":                        {base: "System.SystemException"},
+	"System.Management.Automation.ActionPreferenceStopException":           {base: "System.Management.Automation.RuntimeException"},
+	"System.Management.Automation.CommandNotFoundException":                {base: "System.Management.Automation.RuntimeException"},
+	"System.Management.Automation.ParameterBindingException":               {base: "System.Management.Automation.RuntimeException"},
+	"System.Management.Automation.ParameterBindingValidationException":     {base: "System.Management.Automation.ParameterBindingException"},
+	"System.Management.Automation.PSInvalidCastException":                  {base: "System.InvalidCastException"},
+	"System.Management.Automation.ScriptCallDepthException":                {base: "System.SystemException"},
+	"System.Management.Automation.SessionStateException":                   {base: "System.Management.Automation.RuntimeException"},
+	"System.Management.Automation.DriveNotFoundException":                  {base: "System.Management.Automation.SessionStateException"},
+	"System.Management.Automation.ItemNotFoundException":                   {base: "System.Management.Automation.SessionStateException"},
+	"System.Management.Automation.SessionStateUnauthorizedAccessException": {base: "System.Management.Automation.SessionStateException"},
+	"Microsoft.PowerShell.Commands.ProcessCommandException":                {base: "System.SystemException"},
+	"Microsoft.PowerShell.Commands.WriteErrorException":                    {base: "System.SystemException"},
+	"Microsoft.ActiveDirectory.Management.ADException":                     {base: "System.InvalidOperationException"},
+	"Microsoft.ActiveDirectory.Management.ADIdentityResolutionException":   {base: "Microsoft.ActiveDirectory.Management.ADException"},
+	"Microsoft.ActiveDirectory.Management.ADIdentityNotFoundException":     {base: "Microsoft.ActiveDirectory.Management.ADIdentityResolutionException"},
+}
+
+func init() {
+	// Exception types can be named in catch blocks, traps and [type]::new()
+	for name := range builtinTypes {
+		if isExceptionType(name) {
+			RegisterType(name)
+		}
+	}
+}
+
+// isExceptionType reports whether a type derives from System.Exception
+func isExceptionType(name string) bool {
+	for _, t := range typeChain(name) {
+		if t == "System.Exception" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeHierarchy returns the type names of a value, most-derived first
+func typeHierarchy(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case *PSObject:
+		return v.TypeNames
+	}
+	return typeChain(typeName(v))
+}
+
+// typeChain follows a type's base types up to System.Object
+func typeChain(name string) []string {
+	chain := []string{name}
+	for name != "System.Object" {
+		switch td := builtinTypes[name]; {
+		case td != nil && td.base != "":
+			name = td.base
+		case strings.HasSuffix(name, "[]"):
+			name = "System.Array"
+		default:
+			name = "System.Object"
+		}
+		chain = append(chain, name)
+	}
+	return chain
+}
+
+// typeOf implements .GetType()
+func typeOf(v interface{}) *TypeInfo {
+	names := typeHierarchy(v)
+	return &TypeInfo{Name: names[0], bases: names[1:]}
+}
+
+// hierarchy returns the type and its base types, most-derived first
+func (t *TypeInfo) hierarchy() []string {
+	if t.bases != nil {
+		return append([]string{t.Name}, t.bases...)
+	}
+	return typeChain(t.Name)
+}
+
+// BaseType returns the type this type derives from, or nil for System.Object
+func (t *TypeInfo) BaseType() *TypeInfo {
+	names := t.hierarchy()
+	if len(names) < 2 {
+		return nil
+	}
+	return &TypeInfo{Name: names[1], bases: names[2:]}
+}
+
+// IsValueType reports whether the type is a struct, like int or datetime
+func (t *TypeInfo) IsValueType() bool {
+	return containsFold(t.hierarchy(), "System.ValueType") && t.Name != "System.ValueType"
+}
+
+// typeMember implements the properties of a [type] value
+func typeMember(t *TypeInfo, name string) (interface{}, bool) {
+	switch strings.ToLower(name) {
+	case "name":
+		return shortTypeName(t.Name), true
+	case "fullname":
+		return t.Name, true
+	case "namespace":
+		if i := strings.LastIndex(t.Name, "."); i >= 0 {
+			return t.Name[:i], true
+		}
+		return nil, true
+	case "basetype":
+		if b := t.BaseType(); b != nil {
+			return b, true
+		}
+		return nil, true
+	case "isvaluetype":
+		return t.IsValueType(), true
+	case "isclass":
+		return !t.IsValueType(), true
+	case "isarray":
+		return strings.HasSuffix(t.Name, "[]"), true
+	case "ispublic", "isserializable":
+		return true, true
+	}
+	return nil, false
+}
+
+// typeObject is how the formatter shows a [type] value
+func typeObject(t *TypeInfo) *PSObject {
+	base := interface{}(nil)
+	if b := t.BaseType(); b != nil {
+		base = b.Name
+	}
+	return NewObject("System.RuntimeType").
+		Add("IsPublic", true).
+		Add("IsSerial", true).
+		Add("Name", shortTypeName(t.Name)).
+		Add("BaseType", base)
+}
+
+// typeDisplayNames are the short names Get-Member uses for common types
+var typeDisplayNames = map[string]string{
+	"System.String":                "string",
+	"System.Int32":                 "int",
+	"System.Int64":                 "long",
+	"System.Double":                "double",
+	"System.Boolean":               "bool",
+	"System.Char":                  "char",
+	"System.DateTime":              "datetime",
+	"System.TimeSpan":              "timespan",
+	"System.Collections.Hashtable": "hashtable",
+	"System.Management.Automation.ScriptBlock": "scriptblock",
+	"System.RuntimeType":                       "type",
+}
+
+// displayTypeName names the type of a member's value
+func displayTypeName(v interface{}) string {
+	if v == nil {
+		return "System.Object"
+	}
+	t := typeName(v)
+	if short, ok := typeDisplayNames[t]; ok {
+		return short
+	}
+	return t
+}
+
+// propertyMember describes a property of an object
+func propertyMember(o *PSObject, p *Property) memberInfo {
+	kind := p.MemberType
+	if kind == "" {
+		kind = "Property"
+		if o.IsA("System.Management.Automation.PSCustomObject") {
+			kind = "NoteProperty"
+		}
+	}
+	m := memberInfo{name: p.Name, memberType: kind, definition: p.Definition}
+	if m.definition != "" {
+		return m
+	}
+	v := p.Current()
+	switch {
+	case kind == "NoteProperty" && v == nil:
+		m.definition = "object " + p.Name + "=null"
+	case kind == "NoteProperty":
+		m.definition = displayTypeName(v) + " " + p.Name + "=" + toString(v)
+	case p.Get != nil:
+		m.definition = displayTypeName(v) + " " + p.Name + " {get;}"
+	default:
+		m.definition = displayTypeName(v) + " " + p.Name + " {get;set;}"
+	}
+	return m
+}
+
+// methodMember describes a method of an object, taking the signature of a
+// built-in method from its type
+func methodMember(o *PSObject, m *Method) memberInfo {
+	if m.MemberType != "" {
+		return memberInfo{name: m.Name, memberType: m.MemberType, definition: m.Definition}
+	}
+	for _, t := range o.TypeNames {
+		if td := builtinTypes[t]; td != nil {
+			for _, tm := range td.members {
+				if strings.EqualFold(tm.name, m.Name) {
+					return tm
+				}
+			}
+		}
+	}
+	return memberInfo{name: m.Name, memberType: "Method", definition: "System.Object " + m.Name + "()"}
+}
+
+// membersOf lists the instance members of a value, the object's own members
+// first and then those of its types, most-derived type first
+func membersOf(v interface{}) []memberInfo {
+	var members []memberInfo
+	seen := map[string]bool{}
+	add := func(m memberInfo) {
+		if key := strings.ToLower(m.name); !seen[key] {
+			seen[key] = true
+			members = append(members, m)
+		}
+	}
+	if o, ok := v.(*PSObject); ok {
+		for _, p := range o.Properties() {
+			add(propertyMember(o, p))
+		}
+		for _, m := range o.Methods() {
+			add(methodMember(o, m))
+		}
+	}
+	for _, t := range typeHierarchy(v) {
+		if td := builtinTypes[t]; td != nil {
+			for _, m := range td.members {
+				if _, isObject := v.(*PSObject); isObject && m.memberType != "Method" {
+					continue
+				}
+				add(m)
+			}
+		}
+	}
+	for _, m := range objectMembers {
+		add(m)
+	}
+	return members
+}
+
+// propertyNames returns the names of a value's properties, which wildcards
+// in -Property arguments expand against
+func propertyNames(v interface{}) []string {
+	var names []string
+	for _, m := range membersOf(v) {
+		if strings.HasSuffix(m.memberType, "Property") {
+			names = append(names, m.name)
+		}
+	}
+	return names
+}
+
+// staticMembersOf lists the static members of a type
+func staticMembersOf(t *TypeInfo) []memberInfo {
+	var members []memberInfo
+	if td := builtinTypes[t.Name]; td != nil {
+		members = append(members, td.statics...)
+	}
+	return append(members,
+		method("static bool Equals(System.Object objA, System.Object objB)"),
+		method("static bool ReferenceEquals(System.Object objA, System.Object objB)"))
+}
+
+// intrinsicMembers are the members PowerShell adds to every object, which
+// Get-Member only lists with -Force
+var intrinsicMembers = []memberInfo{
+	{name: "pstypenames", memberType: "CodeProperty", definition: "System.Collections.ObjectModel.Collection`1[[System.String]] pstypenames{get=PSTypeNames;}"},
+	{name: "psadapted", memberType: "MemberSet", definition: "psadapted {}"},
+	{name: "psbase", memberType: "MemberSet", definition: "psbase {}"},
+	{name: "psextended", memberType: "MemberSet", definition: "psextended {}"},
+	{name: "psobject", memberType: "MemberSet", definition: "psobject {BaseObject, Members, Properties, Methods, ImmediateBaseObject, TypeNames}"},
+}
+
+// sortMembers orders members the way Get-Member lists them: by member type,
+// then by name
+func sortMembers(members []memberInfo) {
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].memberType != members[j].memberType {
+			return members[i].memberType < members[j].memberType
+		}
+		return strings.ToLower(members[i].name) < strings.ToLower(members[j].name)
+	})
+}
+
+// psObjectOf implements the intrinsic .PSObject member: a view of a value's
+// members as objects
+func (rs *Runspace) psObjectOf(v interface{}) *PSObject {
+	var props, methods, all []interface{}
+	for _, m := range membersOf(v) {
+		var info *PSObject
+		if strings.HasSuffix(m.memberType, "Property") {
+			value, _ := rs.getMember(v, m.name)
+			info = NewObject("System.Management.Automation.PS"+m.memberType, "System.Management.Automation.PSPropertyInfo", "System.Management.Automation.PSMemberInfo").
+				Add("MemberType", m.memberType).
+				Add("Value", value).
+				Add("IsSettable", m.memberType == "NoteProperty" || strings.Contains(m.definition, "set;")).
+				Add("IsGettable", true).
+				Add("TypeNameOfValue", typeNameOfValue(value)).
+				Add("Name", m.name).
+				Add("IsInstance", true)
+			props = append(props, info)
+		} else {
+			info = NewObject("System.Management.Automation.PSMethod", "System.Management.Automation.PSMethodInfo", "System.Management.Automation.PSMemberInfo").
+				Add("MemberType", m.memberType).
+				Add("OverloadDefinitions", stringsToValues(strings.Split(m.definition, ", "))).
+				Add("TypeNameOfValue", "System.Management.Automation.PSMethod").
+				Add("Value", m.definition).
+				Add("Name", m.name).
+				Add("IsInstance", true)
+			info.ToStringFunc = func(*PSObject) string { return m.definition }
+			methods = append(methods, info)
+		}
+		all = append(all, info)
+	}
+	return NewObject("System.Management.Automation.PSObject").
+		Add("BaseObject", v).
+		Add("ImmediateBaseObject", v).
+		Add("Members", all).
+		Add("Properties", props).
+		Add("Methods", methods).
+		Add("TypeNames", stringsToValues(typeHierarchy(v)))
+}
+
+func typeNameOfValue(v interface{}) string {
+	if v == nil {
+		return "System.Object"
+	}
+	return typeName(v)
+}
+
+// hashCode implements GetHashCode() from a value's string form
+func hashCode(v interface{}) int {
+	h := fnv.New32a()
+	h.Write([]byte(typeName(v) + ":" + toString(v)))
+	return int(int32(h.Sum32()))
+}
+
+// typeCode implements GetTypeCode() for the primitive types
+func typeCode(v interface{}) (string, bool) {
+	switch v.(type) {
+	case string, int, float64, bool, rune, time.Time:
+		return shortTypeName(typeName(v)), true
+	}
+	return "", false
+}
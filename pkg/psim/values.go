@@ -0,0 +1,636 @@
+package psim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PSObject is a simulated object: an ordered bag of named properties plus a type name hierarchy
+type PSObject struct {
+	TypeNames []string // most-derived type first
+	props     []*Property
+	index     map[string]int
+	methods   []*Method
+
+	// ToStringFunc overrides the default string conversion, like a .NET ToString() override
+	ToStringFunc func(o *PSObject) string
+}
+
+// Property is a named value on a PSObject
+type Property struct {
+	Name  string
+	Value interface{}
+	Get   func() interface{} // computed property; Value is ignored when set
+
+	// MemberType is NoteProperty, AliasProperty or ScriptProperty for
+	// members added on top of the type. Empty means the object's own
+	// property: a Property of a .NET type or a NoteProperty of a
+	// [PSCustomObject].
+	MemberType string
+	Definition string // how Get-Member describes an alias or script property
+	alias      string // property an AliasProperty reads
+}
+
+// MethodFunc implements a method on a simulated object
+type MethodFunc func(args []interface{}) (interface{}, error)
+
+// Method is a callable member of a PSObject
+type Method struct {
+	Name       string
+	Call       MethodFunc
+	MemberType string // ScriptMethod for methods added with Add-Member, else empty
+	Definition string // how Get-Member describes a script method
+}
+
+// Current returns the property's value, evaluating computed properties
+func (p *Property) Current() interface{} {
+	if p.Get != nil {
+		return p.Get()
+	}
+	return p.Value
+}
+
+// NewObject creates an empty object with the given type names
+func NewObject(typeNames ...string) *PSObject {
+	if len(typeNames) == 0 || typeNames[len(typeNames)-1] != "System.Object" {
+		typeNames = append(typeNames, "System.Object")
+	}
+	return &PSObject{TypeNames: typeNames, index: map[string]int{}}
+}
+
+// NewCustomObject creates an empty [PSCustomObject]
+func NewCustomObject() *PSObject {
+	return NewObject("System.Management.Automation.PSCustomObject")
+}
+
+// Add sets a property, appending it if it does not exist yet
+func (o *PSObject) Add(name string, value interface{}) *PSObject {
+	key := strings.ToLower(name)
+	if i, ok := o.index[key]; ok {
+		p := o.props[i]
+		if p.Get != nil {
+			// A value replaces a computed member
+			p.MemberType, p.Definition, p.alias = "", "", ""
+		}
+		p.Value = value
+		p.Get = nil
+		return o
+	}
+	o.index[key] = len(o.props)
+	o.props = append(o.props, &Property{Name: name, Value: value})
+	return o
+}
+
+// AddComputed adds a property whose value is computed on every read
+func (o *PSObject) AddComputed(name string, get func() interface{}) *PSObject {
+	o.Add(name, nil)
+	o.props[o.index[strings.ToLower(name)]].Get = get
+	return o
+}
+
+// AddAlias adds an AliasProperty that reads another property
+func (o *PSObject) AddAlias(name, target string) *PSObject {
+	o.AddComputed(name, aliasGetter(o, target))
+	p := o.Property(name)
+	p.MemberType, p.Definition, p.alias = "AliasProperty", name+" = "+target, target
+	return o
+}
+
+func aliasGetter(o *PSObject, target string) func() interface{} {
+	return func() interface{} {
+		v, _ := o.Get(target)
+		return v
+	}
+}
+
+// AddScriptProperty adds a ScriptProperty; script is the getter's source
+// shown by Get-Member and get computes its value
+func (o *PSObject) AddScriptProperty(name, script string, get func() interface{}) *PSObject {
+	o.AddComputed(name, get)
+	p := o.Property(name)
+	p.MemberType, p.Definition = "ScriptProperty", "System.Object "+name+" {get="+script+";}"
+	return o
+}
+
+// AddNote adds a NoteProperty, a value attached to the object rather than
+// defined by its type
+func (o *PSObject) AddNote(name string, value interface{}) *PSObject {
+	o.Add(name, value)
+	p := o.Property(name)
+	p.MemberType, p.Definition, p.alias = "NoteProperty", "", ""
+	return o
+}
+
+// AddMethod adds or replaces a method
+func (o *PSObject) AddMethod(name string, fn MethodFunc) *PSObject {
+	if m := o.Method(name); m != nil {
+		m.Call, m.MemberType, m.Definition = fn, "", ""
+		return o
+	}
+	o.methods = append(o.methods, &Method{Name: name, Call: fn})
+	return o
+}
+
+// AddScriptMethod adds or replaces a ScriptMethod
+func (o *PSObject) AddScriptMethod(name string, fn MethodFunc) *PSObject {
+	o.AddMethod(name, fn)
+	m := o.Method(name)
+	m.MemberType, m.Definition = "ScriptMethod", "System.Object "+name+"();"
+	return o
+}
+
+// Method returns the named method (case-insensitive)
+func (o *PSObject) Method(name string) *Method {
+	for _, m := range o.methods {
+		if strings.EqualFold(m.Name, name) {
+			return m
+		}
+	}
+	return nil
+}
+
+// Methods returns the methods in definition order
+func (o *PSObject) Methods() []*Method {
+	return o.methods
+}
+
+// Property returns the named property (case-insensitive)
+func (o *PSObject) Property(name string) *Property {
+	if i, ok := o.index[strings.ToLower(name)]; ok {
+		return o.props[i]
+	}
+	return nil
+}
+
+// Get returns a property value
+func (o *PSObject) Get(name string) (interface{}, bool) {
+	if p := o.Property(name); p != nil {
+		return p.Current(), true
+	}
+	return nil, false
+}
+
+// Properties returns the properties in definition order
+func (o *PSObject) Properties() []*Property {
+	return o.props
+}
+
+// TypeName returns the most-derived type name
+func (o *PSObject) TypeName() string {
+	return o.TypeNames[0]
+}
+
+// IsA reports whether the object's type hierarchy includes the given type
+func (o *PSObject) IsA(typeName string) bool {
+	for _, t := range o.TypeNames {
+		if strings.EqualFold(t, typeName) || strings.EqualFold(shortTypeName(t), typeName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy returns a shallow copy of the object
+func (o *PSObject) Copy() *PSObject {
+	c := &PSObject{
+		TypeNames:    append([]string(nil), o.TypeNames...),
+		index:        make(map[string]int, len(o.index)),
+		methods:      make([]*Method, len(o.methods)),
+		ToStringFunc: o.ToStringFunc,
+	}
+	for i, m := range o.methods {
+		cm := *m
+		c.methods[i] = &cm
+	}
+	for _, p := range o.props {
+		cp := *p
+		if p.alias != "" {
+			// Aliases read the copy, not the object they were copied from
+			cp.Get = aliasGetter(c, p.alias)
+		}
+		c.index[strings.ToLower(p.Name)] = len(c.props)
+		c.props = append(c.props, &cp)
+	}
+	return c
+}
+
+func (o *PSObject) String() string {
+	if o.ToStringFunc != nil {
+		return o.ToStringFunc(o)
+	}
+	if o.IsA("System.Management.Automation.PSCustomObject") {
+		parts := make([]string, len(o.props))
+		for i, p := range o.props {
+			parts[i] = p.Name + "=" + toString(p.Current())
+		}
+		return "@{" + strings.Join(parts, "; ") + "}"
+	}
+	return o.TypeName()
+}
+
+// Hashtable is an insertion-ordered, case-insensitive dictionary
+type Hashtable struct {
+	keys    []interface{}
+	values  map[string]interface{}
+	Ordered bool // created with [ordered]
+}
+
+// NewHashtable creates an empty hashtable
+func NewHashtable() *Hashtable {
+	return &Hashtable{values: map[string]interface{}{}}
+}
+
+func hashKey(k interface{}) string {
+	switch v := k.(type) {
+	case string:
+		return "s:" + strings.ToLower(v)
+	case int:
+		return "n:" + strconv.Itoa(v)
+	case float64:
+		if v == math.Trunc(v) {
+			return "n:" + strconv.FormatFloat(v, 'f', 0, 64)
+		}
+	}
+	return fmt.Sprintf("%T:%v", k, k)
+}
+
+// Set adds or replaces an entry
+func (h *Hashtable) Set(key, value interface{}) {
+	k := hashKey(key)
+	if _, ok := h.values[k]; !ok {
+		h.keys = append(h.keys, key)
+	}
+	h.values[k] = value
+}
+
+// Get returns the value for a key
+func (h *Hashtable) Get(key interface{}) (interface{}, bool) {
+	v, ok := h.values[hashKey(key)]
+	return v, ok
+}
+
+// Has reports whether the key exists
+func (h *Hashtable) Has(key interface{}) bool {
+	_, ok := h.values[hashKey(key)]
+	return ok
+}
+
+// Remove deletes an entry
+func (h *Hashtable) Remove(key interface{}) {
+	k := hashKey(key)
+	if _, ok := h.values[k]; !ok {
+		return
+	}
+	delete(h.values, k)
+	for i, existing := range h.keys {
+		if hashKey(existing) == k {
+			h.keys = append(h.keys[:i], h.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the keys in insertion order
+func (h *Hashtable) Keys() []interface{} {
+	return append([]interface{}(nil), h.keys...)
+}
+
+// Len returns the number of entries
+func (h *Hashtable) Len() int {
+	return len(h.keys)
+}
+
+// Copy returns a shallow copy
+func (h *Hashtable) Copy() *Hashtable {
+	c := NewHashtable()
+	c.Ordered = h.Ordered
+	for _, k := range h.keys {
+		v, _ := h.Get(k)
+		c.Set(k, v)
+	}
+	return c
+}
+
+// ScriptBlock is a compiled { script block } value
+type ScriptBlock struct {
+	Ast    *ScriptBlockAst
+	source *lexer // the source the block was parsed from, for error positions
+}
+
+func (s *ScriptBlock) String() string {
+	return s.Ast.Text
+}
+
+// TypeInfo is the value of a [type] literal
+type TypeInfo struct {
+	Name string // full .NET name, e.g. System.Int32
+
+	bases []string // base types of a simulated object's type; nil looks them up in builtinTypes
+}
+
+func (t *TypeInfo) String() string {
+	return t.Name
+}
+
+// typeName returns the .NET type name of a runtime value
+func typeName(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "System.Boolean"
+	case int:
+		if v > math.MaxInt32 || v < math.MinInt32 {
+			return "System.Int64"
+		}
+		return "System.Int32"
+	case float64:
+		return "System.Double"
+	case string:
+		return "System.String"
+	case rune:
+		return "System.Char"
+	case []interface{}:
+		return "System.Object[]"
+	case *Hashtable:
+		if v.Ordered {
+			return "System.Collections.Specialized.OrderedDictionary"
+		}
+		return "System.Collections.Hashtable"
+	case *PSObject:
+		return v.TypeName()
+	case *ScriptBlock:
+		return "System.Management.Automation.ScriptBlock"
+	case *TypeInfo:
+		return "System.RuntimeType"
+	case time.Time:
+		return "System.DateTime"
+	case time.Duration:
+		return "System.TimeSpan"
+	case *SecureString:
+		return "System.Security.SecureString"
+	case *RuntimeError:
+		return "System.Management.Automation.ErrorRecord"
+	case *formatBlock:
+		return v.String()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func shortTypeName(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// Conversions
+
+func parseInt(s string) (int, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return int(n), err
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+// toBool implements PowerShell truthiness
+func toBool(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case rune:
+		return v != 0
+	case []interface{}:
+		switch len(v) {
+		case 0:
+			return false
+		case 1:
+			return toBool(v[0])
+		}
+		return true
+	}
+	return true
+}
+
+// toString implements PowerShell string conversion
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return formatFloat(v)
+	case rune:
+		return string(v)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = toString(e)
+		}
+		return strings.Join(parts, " ")
+	case *Hashtable:
+		return typeName(v)
+	case time.Time:
+		return v.Format("01/02/2006 15:04:05")
+	case time.Duration:
+		return formatTimeSpan(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(f, 'G', 15, 64)
+	if i := strings.Index(s, "E"); i >= 0 {
+		// .NET pads exponents to two digits: 1E+20, 1E-05
+		mant, exp := s[:i], s[i+1:]
+		sign := exp[0]
+		digits := strings.TrimLeft(exp[1:], "0")
+		for len(digits) < 2 {
+			digits = "0" + digits
+		}
+		return mant + "E" + string(sign) + digits
+	}
+	return s
+}
+
+func formatTimeSpan(d time.Duration) string {
+	neg := d < 0
+	if neg {
+		d = -d
+	}
+	days := int(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	h := int(d / time.Hour)
+	d -= time.Duration(h) * time.Hour
+	m := int(d / time.Minute)
+	d -= time.Duration(m) * time.Minute
+	s := int(d / time.Second)
+	d -= time.Duration(s) * time.Second
+	out := fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	if days > 0 {
+		out = fmt.Sprintf("%d.%s", days, out)
+	}
+	if d > 0 {
+		out += fmt.Sprintf(".%07d", int(d/100))
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// ConversionError is returned when a value cannot be converted to a type
+type ConversionError struct {
+	Value  interface{}
+	Type   string
+	Reason string
+}
+
+func (e *ConversionError) Error() string {
+	msg := fmt.Sprintf("Cannot convert value \"%s\" to type \"%s\".", toString(e.Value), e.Type)
+	if _, ok := e.Value.([]interface{}); ok {
+		msg = fmt.Sprintf("Cannot convert the \"%s\" value of type \"%s\" to type \"%s\".", toString(e.Value), typeName(e.Value), e.Type)
+	}
+	if e.Reason != "" {
+		msg += " Error: \"" + e.Reason + "\""
+	}
+	return msg
+}
+
+// toNumber converts a value to int or float64
+func toNumber(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case int, float64:
+		return n, nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	case rune:
+		return int(n), nil
+	case string:
+		s := strings.TrimSpace(n)
+		if s == "" {
+			return 0, nil
+		}
+		neg := false
+		if s[0] == '-' || s[0] == '+' {
+			neg = s[0] == '-'
+			s = s[1:]
+		}
+		if end, val, ok := scanNumber(s, 0); ok && end == len(s) {
+			if neg {
+				switch x := val.(type) {
+				case int:
+					return -x, nil
+				case float64:
+					return -x, nil
+				}
+			}
+			return val, nil
+		}
+		return nil, &ConversionError{Value: v, Type: "System.Int32", Reason: "Input string was not in a correct format."}
+	case []interface{}:
+		if len(n) == 1 {
+			return toNumber(n[0])
+		}
+	case *PSObject:
+		if s := n.String(); s != n.TypeName() {
+			return toNumber(s)
+		}
+	}
+	return nil, &ConversionError{Value: v, Type: "System.Int32"}
+}
+
+func toInt(v interface{}) (int, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	if f, ok := n.(float64); ok {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, &ConversionError{Value: v, Type: "System.Int32"}
+		}
+		return int(math.RoundToEven(f)), nil
+	}
+	return n.(int), nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		if ce, ok := err.(*ConversionError); ok {
+			ce.Type = "System.Double"
+		}
+		return 0, err
+	}
+	if i, ok := n.(int); ok {
+		return float64(i), nil
+	}
+	return n.(float64), nil
+}
+
+// isNumber reports whether the value is numeric
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, float64:
+		return true
+	}
+	return false
+}
+
+// asList returns the elements of an array, or the value itself as a single element
+func asList(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+	return []interface{}{v}
+}
+
+// unwrap turns collected pipeline output into a PowerShell value: $null, a scalar or an array
+func unwrap(items []interface{}) interface{} {
+	switch len(items) {
+	case 0:
+		return nil
+	case 1:
+		return items[0]
+	}
+	return items
+}
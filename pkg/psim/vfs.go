@@ -0,0 +1,352 @@
+package psim
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileSystem is an in-memory, Windows-style file system with drive letters
+// and case-insensitive backslash paths
+type FileSystem struct {
+	drives map[string]*fsNode // keyed by upper-case drive name, e.g. "C"
+	clock  func() time.Time
+}
+
+type fsNode struct {
+	name     string
+	dir      bool
+	content  string
+	children []*fsNode // kept sorted by lower-case name
+	parent   *fsNode
+	created  time.Time
+	modified time.Time
+}
+
+// fixtureTime is the timestamp of seeded files, so listings are reproducible
+var fixtureTime = time.Date(2024, time.March, 1, 9, 30, 0, 0, time.Local)
+
+// defaultLayout is the directory skeleton of a new file system
+var defaultLayout = []string{
+	`C:\Program Files\PowerShell\7`,
+	`C:\Program Files\Common Files`,
+	`C:\Temp`,
+	`C:\Users\learner\Desktop`,
+	`C:\Users\learner\Documents`,
+	`C:\Users\learner\Downloads`,
+	`C:\Users\Public\Documents`,
+	`C:\Windows\System32\drivers\etc`,
+	`C:\Windows\Temp`,
+}
+
+// NewFileSystem creates a file system holding a typical Windows directory layout
+func NewFileSystem() *FileSystem {
+	fs := &FileSystem{drives: map[string]*fsNode{}, clock: time.Now}
+	for _, dir := range defaultLayout {
+		fs.mkdirAll(dir, fixtureTime)
+	}
+	fs.writeFile(`C:\Windows\System32\drivers\etc\hosts`, "# Copyright (c) 1993-2009 Microsoft Corp.\n#\n# This is a sample HOSTS file used by Microsoft TCP/IP for Windows.\n\n127.0.0.1       localhost\n::1             localhost\n", fixtureTime)
+	return fs
+}
+
+// Seed adds fixture files to the file system. Keys are full paths and values
+// their content; a key ending in a backslash creates an empty directory.
+func (fs *FileSystem) Seed(files map[string]string) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		full, err := normalizePath(p, `C:\`, `C:\`)
+		if err != nil {
+			return err
+		}
+		dir := strings.HasSuffix(p, `\`) || strings.HasSuffix(p, "/")
+		parent := full
+		if !dir {
+			parent = parentPath(full)
+		}
+		if file := fs.fileOnPath(parent); file != "" {
+			return fmt.Errorf("Cannot create '%s' because '%s' is a file.", p, file)
+		}
+		if dir {
+			fs.mkdirAll(full, fixtureTime)
+			continue
+		}
+		if _, err := fs.writeFile(full, files[p], fixtureTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clone returns an independent copy, so each session can change its own files
+func (fs *FileSystem) Clone() *FileSystem {
+	c := &FileSystem{drives: map[string]*fsNode{}, clock: fs.clock}
+	for name, root := range fs.drives {
+		c.drives[name] = root.clone(nil)
+	}
+	return c
+}
+
+func (n *fsNode) clone(parent *fsNode) *fsNode {
+	c := *n
+	c.parent = parent
+	c.children = make([]*fsNode, len(n.children))
+	for i, child := range n.children {
+		c.children[i] = child.clone(&c)
+	}
+	return &c
+}
+
+// Exists reports whether a file or directory exists at a full path
+func (fs *FileSystem) Exists(path string) bool {
+	return fs.lookup(path) != nil
+}
+
+// IsDir reports whether a full path is an existing directory
+func (fs *FileSystem) IsDir(path string) bool {
+	n := fs.lookup(path)
+	return n != nil && n.dir
+}
+
+// ReadFile returns the content of a file
+func (fs *FileSystem) ReadFile(path string) (string, error) {
+	n := fs.lookup(path)
+	if n == nil {
+		return "", fmt.Errorf("Cannot find path '%s' because it does not exist.", path)
+	}
+	if n.dir {
+		return "", fmt.Errorf("Unable to get content because it is a directory: '%s'. Please use 'Get-ChildItem' instead.", path)
+	}
+	return n.content, nil
+}
+
+// WriteFile creates or replaces a file, creating missing parent directories
+func (fs *FileSystem) WriteFile(path, content string) error {
+	full, err := normalizePath(path, `C:\`, `C:\`)
+	if err != nil {
+		return err
+	}
+	_, err = fs.writeFile(full, content, fs.clock())
+	return err
+}
+
+// Mkdir creates a directory and any missing parents
+func (fs *FileSystem) Mkdir(path string) error {
+	full, err := normalizePath(path, `C:\`, `C:\`)
+	if err != nil {
+		return err
+	}
+	if n := fs.lookup(full); n != nil && !n.dir {
+		return fmt.Errorf("An item with the specified name %s already exists.", full)
+	}
+	fs.mkdirAll(full, fs.clock())
+	return nil
+}
+
+// List returns the full paths of a directory's children
+func (fs *FileSystem) List(path string) ([]string, error) {
+	n := fs.lookup(path)
+	if n == nil || !n.dir {
+		return nil, fmt.Errorf("Cannot find path '%s' because it does not exist.", path)
+	}
+	out := make([]string, len(n.children))
+	for i, child := range n.children {
+		out[i] = child.path()
+	}
+	return out, nil
+}
+
+// splitPath separates a normalized full path into its drive and components
+func splitPath(path string) (drive string, parts []string) {
+	drive = strings.ToUpper(path[:1])
+	for _, p := range strings.Split(path[2:], `\`) {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return drive, parts
+}
+
+func (fs *FileSystem) lookup(path string) *fsNode {
+	if !isAbsolutePath(path) {
+		return nil
+	}
+	drive, parts := splitPath(path)
+	n := fs.drives[drive]
+	for _, p := range parts {
+		if n == nil || !n.dir {
+			return nil
+		}
+		n = n.child(p)
+	}
+	return n
+}
+
+func (n *fsNode) child(name string) *fsNode {
+	lower := strings.ToLower(name)
+	for _, c := range n.children {
+		if strings.ToLower(c.name) == lower {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *fsNode) addChild(c *fsNode) {
+	c.parent = n
+	lower := strings.ToLower(c.name)
+	i := sort.Search(len(n.children), func(i int) bool { return strings.ToLower(n.children[i].name) >= lower })
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = c
+}
+
+func (n *fsNode) removeChild(c *fsNode) {
+	for i, x := range n.children {
+		if x == c {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// path returns the node's full path
+func (n *fsNode) path() string {
+	if n.parent == nil {
+		return n.name + `\`
+	}
+	var parts []string
+	for x := n; x.parent != nil; x = x.parent {
+		parts = append([]string{x.name}, parts...)
+	}
+	root := n
+	for root.parent != nil {
+		root = root.parent
+	}
+	return root.name + `\` + strings.Join(parts, `\`)
+}
+
+func (fs *FileSystem) root(drive string) *fsNode {
+	n := fs.drives[drive]
+	if n == nil {
+		n = &fsNode{name: drive + ":", dir: true, created: fixtureTime, modified: fixtureTime}
+		fs.drives[drive] = n
+	}
+	return n
+}
+
+// fileOnPath returns the first file among the directories of a path, or ""
+// when they are all directories or don't exist yet
+func (fs *FileSystem) fileOnPath(path string) string {
+	drive, parts := splitPath(path)
+	n := fs.drives[drive]
+	for i, p := range parts {
+		if n == nil {
+			return ""
+		}
+		if n = n.child(p); n != nil && !n.dir {
+			return drive + `:\` + strings.Join(parts[:i+1], `\`)
+		}
+	}
+	return ""
+}
+
+func (fs *FileSystem) mkdirAll(path string, t time.Time) *fsNode {
+	drive, parts := splitPath(path)
+	n := fs.root(drive)
+	for _, p := range parts {
+		c := n.child(p)
+		if c == nil {
+			c = &fsNode{name: p, dir: true, created: t, modified: t}
+			n.addChild(c)
+		}
+		n = c
+	}
+	return n
+}
+
+func (fs *FileSystem) writeFile(path, content string, t time.Time) (*fsNode, error) {
+	dir, name := parentPath(path), leafName(path)
+	if n := fs.lookup(path); n != nil {
+		if n.dir {
+			return nil, fmt.Errorf("Access to the path '%s' is denied.", path)
+		}
+		n.content, n.modified = content, t
+		return n, nil
+	}
+	parent := fs.mkdirAll(dir, t)
+	n := &fsNode{name: name, content: content, created: t, modified: t}
+	parent.addChild(n)
+	return n, nil
+}
+
+// isAbsolutePath reports whether p starts with a drive letter and root, e.g. C:\
+func isAbsolutePath(p string) bool {
+	return len(p) >= 3 && isLetter(p[0]) && p[1] == ':' && p[2] == '\\'
+}
+
+// normalizePath resolves p against the current location and home directory
+// into a full path, collapsing . and .. and normalizing separators
+func normalizePath(p, cwd, home string) (string, error) {
+	p = strings.ReplaceAll(p, "/", `\`)
+	// Provider-qualified paths, such as an item's PSPath, name the file system
+	for _, prefix := range []string{`Microsoft.PowerShell.Core\FileSystem::`, `FileSystem::`} {
+		if len(p) >= len(prefix) && strings.EqualFold(p[:len(prefix)], prefix) {
+			p = p[len(prefix):]
+			break
+		}
+	}
+	switch {
+	case p == "~" || strings.HasPrefix(p, `~\`):
+		p = home + p[1:]
+	case len(p) >= 2 && isLetter(p[0]) && p[1] == ':':
+		p = p[:2] + `\` + strings.TrimLeft(p[2:], `\`)
+	case strings.HasPrefix(p, `\`):
+		p = cwd[:2] + p
+	default:
+		p = strings.TrimRight(cwd, `\`) + `\` + p
+	}
+	drive, parts := splitPath(p)
+	var out []string
+	for _, part := range parts {
+		switch part {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			if strings.ContainsAny(part, `<>:"|`) {
+				return "", fmt.Errorf("The given path's format is not supported.")
+			}
+			out = append(out, strings.TrimRight(part, " "))
+		}
+	}
+	return drive + `:\` + strings.Join(out, `\`), nil
+}
+
+// parentPath returns the directory part of a full path; the root is its own parent
+func parentPath(path string) string {
+	trimmed := strings.TrimRight(path, `\`)
+	i := strings.LastIndex(trimmed, `\`)
+	if i < 0 {
+		return trimmed + `\`
+	}
+	if i == 2 {
+		return trimmed[:3]
+	}
+	return trimmed[:i]
+}
+
+// leafName returns the last component of a path
+func leafName(path string) string {
+	trimmed := strings.TrimRight(path, `\`)
+	if i := strings.LastIndex(trimmed, `\`); i >= 0 {
+		return trimmed[i+1:]
+	}
+	return trimmed
+}
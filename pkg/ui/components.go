@@ -126,15 +126,25 @@ func HelpBar(bindings [][2]string) string {
 	)
 }
 
-// CodeBlock renders a code block with optional syntax highlighting
-func CodeBlock(code string, language string) string {
-	// For now, simple rendering. Can be enhanced with actual syntax highlighting
+// CodeBlock renders a code block with optional syntax highlighting, fitting
+// it in width columns; lines too long for the block wrap onto the next row
+func CodeBlock(code string, language string, width int) string {
 	header := lipgloss.NewStyle().
 		Foreground(TextSecondary).
 		Render(fmt.Sprintf("// %s", language))
-	
+
+	// Wrapping keeps the space it breaks at, which MaxWidth drops again
+	inner := max(width-CodeBlockStyle.GetHorizontalFrameSize(), 10)
+	fit := lipgloss.NewStyle().MaxWidth(inner)
+	lines := strings.Split(Highlight(code, language), "\n")
+	for i, line := range lines {
+		if lipgloss.Width(line) > inner {
+			lines[i] = fit.Render(lipgloss.NewStyle().Width(inner).Render(line))
+		}
+	}
+
 	return CodeBlockStyle.Render(
-		lipgloss.JoinVertical(lipgloss.Left, header, "", code),
+		lipgloss.JoinVertical(lipgloss.Left, header, "", strings.Join(lines, "\n")),
 	)
 }
 
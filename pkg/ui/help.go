@@ -61,6 +61,8 @@ func renderDashboardHelp() string {
 		{"j/k/h/l", "Vim-style navigation"},
 		{"Enter", "Select module"},
 		{"Tab", "Switch to categories view"},
+		{"c", "Open the interactive console"},
+		{"m", "Open the menu: Learn, Studio and Settings"},
 		{"q", "Quit to main menu"},
 		{"Ctrl+C", "Exit application"},
 		{"h", "Toggle this help menu"},
@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// SyntaxClass is what a piece of highlighted code is
+type SyntaxClass int
+
+const (
+	SyntaxText SyntaxClass = iota
+	SyntaxComment
+	SyntaxKeyword
+	SyntaxCommand // cmdlets, functions and C# methods
+	SyntaxParameter
+	SyntaxVariable
+	SyntaxString
+	SyntaxNumber
+	SyntaxOperator
+	SyntaxType
+	SyntaxMember // properties, methods after a dot and hashtable keys
+)
+
+// SyntaxToken is a run of code of one class
+type SyntaxToken struct {
+	Class SyntaxClass
+	Text  string
+}
+
+// SyntaxTheme holds the style of each class of code
+type SyntaxTheme map[SyntaxClass]lipgloss.Style
+
+// NewSyntaxTheme builds a theme from the palette, so code follows the
+// colors of the rest of the interface
+func NewSyntaxTheme() SyntaxTheme {
+	return SyntaxTheme{
+		SyntaxText:      lipgloss.NewStyle().Foreground(TextPrimary),
+		SyntaxComment:   lipgloss.NewStyle().Foreground(TextSecondary).Italic(true),
+		SyntaxKeyword:   lipgloss.NewStyle().Foreground(Accent).Bold(true),
+		SyntaxCommand:   lipgloss.NewStyle().Foreground(Primary).Bold(true),
+		SyntaxParameter: lipgloss.NewStyle().Foreground(TextSecondary),
+		SyntaxVariable:  lipgloss.NewStyle().Foreground(Secondary),
+		SyntaxString:    lipgloss.NewStyle().Foreground(Success),
+		SyntaxNumber:    lipgloss.NewStyle().Foreground(Info),
+		SyntaxOperator:  lipgloss.NewStyle().Foreground(TextSecondary),
+		SyntaxType:      lipgloss.NewStyle().Foreground(Info).Italic(true),
+		SyntaxMember:    lipgloss.NewStyle().Foreground(TextPrimary),
+	}
+}
+
+// CodeTheme is the theme code blocks, the editor and the console use
+var CodeTheme = NewSyntaxTheme()
+
+// Highlight colors code in the given language; languages without a lexer
+// are returned in the plain text color
+func Highlight(code, language string) string {
+	return strings.Join(HighlightLines(code, language), "\n")
+}
+
+// HighlightLines colors code and splits it into lines, each styled on its
+// own so a line can be laid out without colors bleeding into the next
+func HighlightLines(code, language string) []string {
+	lines := []string{""}
+	for _, t := range Lex(code, language) {
+		style := CodeTheme[t.Class]
+		for i, part := range strings.Split(t.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, "")
+			}
+			if part != "" {
+				lines[len(lines)-1] += style.Render(part)
+			}
+		}
+	}
+	return lines
+}
+
+// Lex splits code in the given language into tokens; languages without a
+// lexer come back as a single run of text
+func Lex(code, language string) []SyntaxToken {
+	switch strings.ToLower(language) {
+	case "powershell", "pwsh", "ps1", "ps":
+		return LexPowerShell(code)
+	case "c#", "csharp", "cs":
+		return LexCSharp(code)
+	}
+	return []SyntaxToken{{SyntaxText, code}}
+}
+
+// tokenWriter collects tokens, merging neighbours of the same class
+type tokenWriter struct {
+	tokens []SyntaxToken
+}
+
+func (w *tokenWriter) emit(class SyntaxClass, text string) {
+	if text == "" {
+		return
+	}
+	if n := len(w.tokens); n > 0 && w.tokens[n-1].Class == class {
+		w.tokens[n-1].Text += text
+		return
+	}
+	w.tokens = append(w.tokens, SyntaxToken{class, text})
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isWordChar(c byte) bool {
+	return isWordStart(c) || c >= '0' && c <= '9'
+}
+
+func isDigitByte(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// wordEnd returns the end of the identifier starting at i
+func wordEnd(src string, i int) int {
+	for i < len(src) && isWordChar(src[i]) {
+		i++
+	}
+	return i
+}
+
+// numberEnd returns the end of a number starting at i: decimal or hex
+// digits, a fraction, an exponent and a type or multiplier suffix
+func numberEnd(src string, i int) int {
+	if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+		i += 2
+	}
+	for i < len(src) && (isWordChar(src[i]) || src[i] == '.' && i+1 < len(src) && isDigitByte(src[i+1])) {
+		i++
+	}
+	return i
+}
+
+// skipSpaces returns the offset of the first byte at or after i that
+// isn't a space or tab
+func skipSpaces(src string, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	return i
+}
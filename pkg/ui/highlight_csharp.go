@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The C# lexer serves the SDK track, where cmdlets are written as C#
+// classes. Without a symbol table it tells types from members by how a
+// name is used: after new, in a base list or before a variable name it is
+// a type, before ( it is a method call.
+
+var csKeywords = map[string]bool{
+	"abstract": true, "as": true, "base": true, "bool": true, "break": true,
+	"byte": true, "case": true, "catch": true, "char": true, "checked": true,
+	"class": true, "const": true, "continue": true, "decimal": true, "default": true,
+	"delegate": true, "do": true, "double": true, "else": true, "enum": true,
+	"event": true, "explicit": true, "extern": true, "false": true, "finally": true,
+	"fixed": true, "float": true, "for": true, "foreach": true, "get": true,
+	"goto": true, "if": true, "implicit": true, "in": true, "init": true,
+	"int": true, "interface": true, "internal": true, "is": true, "lock": true,
+	"long": true, "namespace": true, "new": true, "null": true, "object": true,
+	"operator": true, "out": true, "override": true, "params": true, "private": true,
+	"protected": true, "public": true, "readonly": true, "record": true, "ref": true,
+	"return": true, "sbyte": true, "sealed": true, "set": true, "short": true,
+	"sizeof": true, "static": true, "string": true, "struct": true, "switch": true,
+	"this": true, "throw": true, "true": true, "try": true, "typeof": true,
+	"uint": true, "ulong": true, "unchecked": true, "unsafe": true, "ushort": true,
+	"using": true, "var": true, "virtual": true, "void": true, "volatile": true,
+	"while": true, "async": true, "await": true, "yield": true, "nameof": true,
+}
+
+// csTypeIntroducers are the keywords a type name follows
+var csTypeIntroducers = map[string]bool{
+	"new": true, "class": true, "struct": true, "interface": true, "enum": true,
+	"record": true, "typeof": true, "is": true, "as": true, "nameof": true,
+}
+
+// LexCSharp splits C# code into tokens for highlighting
+func LexCSharp(src string) []SyntaxToken {
+	var w tokenWriter
+	prev := "" // the last word or symbol, to tell types from members
+	for i := 0; i < len(src); {
+		c := src[i]
+		start := i
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			w.emit(SyntaxComment, src[start:i])
+			continue
+
+		case strings.HasPrefix(src[i:], "/*"):
+			if end := strings.Index(src[i+2:], "*/"); end >= 0 {
+				i += 2 + end + 2
+			} else {
+				i = len(src)
+			}
+			w.emit(SyntaxComment, src[start:i])
+			continue
+
+		case c == '#' && strings.TrimSpace(src[strings.LastIndexByte(src[:i], '\n')+1:i]) == "":
+			// a preprocessor directive such as #region
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			w.emit(SyntaxKeyword, src[start:i])
+			continue
+
+		case c == '"' || c == '@' && lookAt(src, i+1) == '"' || c == '$' && (lookAt(src, i+1) == '"' || lookAt(src, i+1) == '@'):
+			i = csString(&w, src, i)
+			prev = "string"
+			continue
+
+		case c == '\'':
+			i++
+			for i < len(src) && src[i] != '\'' && src[i] != '\n' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i = min(i+1, len(src))
+			w.emit(SyntaxString, src[start:i])
+
+		case isDigitByte(c) || c == '.' && isDigitByte(lookAt(src, i+1)):
+			i = numberEnd(src, i)
+			w.emit(SyntaxNumber, src[start:i])
+
+		case isWordStart(c) || c == '@' && isWordStart(lookAt(src, i+1)):
+			i = wordEnd(src, i+1)
+			word := src[start:i]
+			w.emit(csWordClass(src, word, i, prev), word)
+			prev = word
+			continue
+
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			for i < len(src) && strings.IndexByte(" \t\r\n", src[i]) >= 0 {
+				i++
+			}
+			w.emit(SyntaxText, src[start:i])
+			continue
+
+		case strings.IndexByte("(){}[];,", c) >= 0:
+			i++
+			w.emit(SyntaxText, src[start:i])
+
+		default:
+			i++
+			w.emit(SyntaxOperator, src[start:i])
+		}
+		prev = src[start:i]
+	}
+	return w.tokens
+}
+
+func lookAt(src string, i int) byte {
+	if i < len(src) {
+		return src[i]
+	}
+	return 0
+}
+
+// csWordClass decides what the word ending at end is
+func csWordClass(src, word string, end int, prev string) SyntaxClass {
+	if csKeywords[word] {
+		return SyntaxKeyword
+	}
+	after := skipSpaces(src, end)
+	next := lookAt(src, after)
+	switch {
+	case prev == ".":
+		if next == '(' {
+			return SyntaxCommand
+		}
+		return SyntaxMember
+	case csTypeIntroducers[prev] || prev == ":" || prev == "<" || prev == "[":
+		return SyntaxType
+	case next == '(':
+		return SyntaxCommand
+	case isWordStart(next) || next == '<' || strings.HasPrefix(src[after:], "[]") || next == '?' && lookAt(src, after+1) == ' ':
+		// a type before the name it declares
+		return SyntaxType
+	case next == '.' && unicode.IsUpper(rune(word[0])):
+		// a static member's type, as in Console.WriteLine
+		return SyntaxType
+	}
+	return SyntaxText
+}
+
+// csString colors the string literal at i: regular, @verbatim or
+// $interpolated, whose {expressions} are colored as code
+func csString(w *tokenWriter, src string, i int) int {
+	start := i
+	interpolated, verbatim := false, false
+	for src[i] != '"' {
+		interpolated = interpolated || src[i] == '$'
+		verbatim = verbatim || src[i] == '@'
+		i++
+	}
+	i++
+	w.emit(SyntaxString, src[start:i])
+	for run := i; i < len(src); {
+		switch c := src[i]; {
+		case c == '\\' && !verbatim:
+			i += 2
+		case c == '"' && verbatim && lookAt(src, i+1) == '"':
+			i += 2
+		case c == '"' || c == '\n' && !verbatim:
+			if c == '"' {
+				i++
+			}
+			w.emit(SyntaxString, src[run:i])
+			return i
+		case c == '{' && interpolated && lookAt(src, i+1) == '{':
+			i += 2
+		case c == '{' && interpolated:
+			w.emit(SyntaxString, src[run:i])
+			depth, end := 0, i
+			for ; end < len(src); end++ {
+				if src[end] == '{' {
+					depth++
+				} else if src[end] == '}' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			w.emit(SyntaxOperator, "{")
+			for _, t := range LexCSharp(src[i+1 : min(end, len(src))]) {
+				w.emit(t.Class, t.Text)
+			}
+			if end < len(src) {
+				w.emit(SyntaxOperator, "}")
+				end++
+			}
+			i, run = end, end
+		default:
+			i++
+		}
+		if i >= len(src) {
+			w.emit(SyntaxString, src[run:])
+		}
+	}
+	return len(src)
+}
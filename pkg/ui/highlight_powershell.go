@@ -0,0 +1,540 @@
+package ui
+
+import "strings"
+
+// The PowerShell lexer tracks just enough of the parser's state to color
+// code the way the console does: a word at the start of a statement is a
+// command, the words after it are arguments, and everything else is an
+// expression. It never fails, so half-typed code in the editor colors too.
+
+var psKeywords = map[string]bool{
+	"begin": true, "break": true, "catch": true, "class": true, "continue": true,
+	"data": true, "do": true, "dynamicparam": true, "else": true, "elseif": true,
+	"end": true, "enum": true, "exit": true, "filter": true, "finally": true,
+	"for": true, "foreach": true, "function": true, "if": true, "in": true,
+	"param": true, "process": true, "return": true, "switch": true, "throw": true,
+	"trap": true, "try": true, "until": true, "using": true, "while": true,
+}
+
+var psOperators = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "ge": true, "lt": true, "le": true,
+	"like": true, "notlike": true, "match": true, "notmatch": true,
+	"contains": true, "notcontains": true, "in": true, "notin": true,
+	"replace": true, "split": true, "join": true, "is": true, "isnot": true,
+	"as": true, "and": true, "or": true, "xor": true, "not": true,
+	"band": true, "bor": true, "bxor": true, "bnot": true, "shl": true,
+	"shr": true, "f": true,
+}
+
+// isPSOperator reports whether name, without its dash, is an operator,
+// including the case-sensitive and case-insensitive forms such as -ceq
+func isPSOperator(name string) bool {
+	name = strings.ToLower(name)
+	if psOperators[name] {
+		return true
+	}
+	if len(name) > 2 && (name[0] == 'c' || name[0] == 'i') {
+		return psOperators[name[1:]] && name[1:] != "f" && name[1:] != "is" && name[1:] != "as"
+	}
+	return false
+}
+
+// psVariableScopes may prefix a variable name, as in $env:PATH
+var psVariableScopes = map[string]bool{
+	"env": true, "global": true, "local": true, "private": true, "script": true,
+	"using": true, "variable": true, "function": true, "alias": true,
+}
+
+type psMode int
+
+const (
+	psStatement  psMode = iota // the next word is a command or keyword
+	psArguments                // words are a command's arguments
+	psExpression               // words are keywords or members
+)
+
+// psFrame is an open bracket and the mode to return to when it closes
+type psFrame struct {
+	mode      psMode
+	attribute bool // the parentheses of an attribute such as [Parameter(...)]
+}
+
+type psLexer struct {
+	src       string
+	w         tokenWriter
+	mode      psMode
+	frames    []psFrame
+	member    bool // a . or :: here accesses a member
+	afterType bool // a ( here opens an attribute's arguments
+	funcName  bool // the next word names a function
+}
+
+// LexPowerShell splits PowerShell code into tokens for highlighting
+func LexPowerShell(src string) []SyntaxToken {
+	lx := &psLexer{src: src}
+	lx.run()
+	return lx.w.tokens
+}
+
+func (lx *psLexer) inAttribute() bool {
+	return len(lx.frames) > 0 && lx.frames[len(lx.frames)-1].attribute
+}
+
+// open pushes a bracket, remembering the mode to resume after it
+func (lx *psLexer) open(attribute bool, inner psMode) {
+	resume := lx.mode
+	if resume == psStatement {
+		resume = psExpression
+	}
+	lx.frames = append(lx.frames, psFrame{mode: resume, attribute: attribute})
+	lx.mode = inner
+}
+
+func (lx *psLexer) close() {
+	if n := len(lx.frames); n > 0 {
+		lx.mode = lx.frames[n-1].mode
+		lx.frames = lx.frames[:n-1]
+		return
+	}
+	lx.mode = psExpression
+}
+
+func (lx *psLexer) at(i int) byte {
+	if i < len(lx.src) {
+		return lx.src[i]
+	}
+	return 0
+}
+
+func (lx *psLexer) run() {
+	src := lx.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		next := lx.at(i + 1)
+		member, afterType := false, false
+		start := i
+
+		switch {
+		case c == '\n':
+			lx.w.emit(SyntaxText, "\n")
+			if !lx.inAttribute() {
+				lx.mode = psStatement
+			}
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i = skipSpaces(src, i)
+			for i < len(src) && src[i] == '\r' {
+				i++
+			}
+			lx.w.emit(SyntaxText, src[start:i])
+			afterType = lx.afterType
+
+		case c == '`':
+			// an escape, or a line continuation that keeps the statement going
+			i = min(i+2, len(src))
+			if next == '\r' && lx.at(i) == '\n' {
+				i++
+			}
+			lx.w.emit(SyntaxOperator, src[start:i])
+
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			lx.w.emit(SyntaxComment, src[start:i])
+
+		case c == '<' && next == '#':
+			if end := strings.Index(src[i+2:], "#>"); end >= 0 {
+				i += 2 + end + 2
+			} else {
+				i = len(src)
+			}
+			lx.w.emit(SyntaxComment, src[start:i])
+
+		case c == '@' && (next == '"' || next == '\'') && lx.hereStringStart(i+2):
+			i = lx.hereString(i)
+			lx.enterExpression()
+
+		case c == '@' && (next == '(' || next == '{'):
+			lx.w.emit(SyntaxOperator, src[i:i+2])
+			lx.open(false, psStatement)
+			i += 2
+
+		case c == '@' && isWordStart(next):
+			i = wordEnd(src, i+1)
+			lx.w.emit(SyntaxVariable, src[start:i])
+
+		case c == '"':
+			i = lx.expandableString(i)
+			lx.enterExpression()
+
+		case c == '\'':
+			i = verbatimEnd(src, i+1, '\'')
+			lx.w.emit(SyntaxString, src[start:i])
+			lx.enterExpression()
+
+		case c == '$' && next == '(':
+			lx.w.emit(SyntaxOperator, "$(")
+			lx.open(false, psStatement)
+			i += 2
+
+		case c == '$' && (isWordStart(next) || next == '{' || next == '?' || next == '$' || next == '^'):
+			i = lx.variableEnd(i)
+			lx.w.emit(SyntaxVariable, src[start:i])
+			lx.enterExpression()
+			member = true
+
+		case c == '(':
+			lx.w.emit(SyntaxText, "(")
+			if lx.afterType {
+				lx.open(true, psExpression)
+			} else {
+				lx.open(false, psStatement)
+			}
+			i++
+
+		case c == '{':
+			lx.w.emit(SyntaxText, "{")
+			lx.open(false, psStatement)
+			i++
+
+		case c == ')' || c == '}':
+			lx.w.emit(SyntaxText, string(c))
+			lx.close()
+			member = c == ')'
+			i++
+
+		case c == '[' && !lx.member && isWordStart(next):
+			// a type literal or an attribute
+			end := i + 1
+			for end < len(src) && (isWordChar(src[end]) || src[end] == '.' || src[end] == '`') {
+				end++
+			}
+			lx.w.emit(SyntaxText, "[")
+			lx.w.emit(SyntaxType, src[i+1:end])
+			lx.enterExpression()
+			afterType = true
+			i = end
+
+		case c == ']':
+			lx.w.emit(SyntaxText, "]")
+			member, afterType = true, true
+			i++
+
+		case lx.member && (c == '.' && isWordStart(next) || c == ':' && next == ':' && isWordStart(lx.at(i+2))):
+			dot := 1
+			if c == ':' {
+				dot = 2
+			}
+			end := wordEnd(src, i+dot)
+			lx.w.emit(SyntaxOperator, src[i:i+dot])
+			lx.w.emit(SyntaxMember, src[i+dot:end])
+			member = true
+			i = end
+
+		case c == '-' && isWordStart(next):
+			i = lx.dashWord(i)
+
+		case lx.mode == psArguments && !isPSTerminator(c):
+			i = barewordEnd(src, i)
+			class := SyntaxText
+			if numberEnd(src, start) == i && isDigitByte(c) {
+				class = SyntaxNumber
+			}
+			lx.w.emit(class, src[start:i])
+
+		case isDigitByte(c) || c == '.' && isDigitByte(next) && !lx.member:
+			i = numberEnd(src, i)
+			lx.w.emit(SyntaxNumber, src[start:i])
+			lx.enterExpression()
+
+		case lx.mode == psStatement && (c == '&' || c == '.') && (next == ' ' || next == '\t'):
+			// the call and dot-source operators leave the command to come
+			lx.w.emit(SyntaxOperator, string(c))
+			i++
+
+		case lx.mode == psStatement && !isPSTerminator(c) && !strings.ContainsRune("=+-*/!<>[]", rune(c)):
+			i = lx.statementWord(i)
+
+		case isWordStart(c):
+			i = wordEnd(src, i)
+			word := src[start:i]
+			switch {
+			case psKeywords[strings.ToLower(word)]:
+				lx.w.emit(SyntaxKeyword, word)
+				lx.mode = psStatement
+			case lx.inAttribute():
+				lx.w.emit(SyntaxMember, word)
+			default:
+				lx.w.emit(SyntaxText, word)
+			}
+
+		default:
+			i = lx.operator(i)
+		}
+
+		lx.member, lx.afterType = member, afterType
+	}
+}
+
+// enterExpression notes that a value started a statement
+func (lx *psLexer) enterExpression() {
+	if lx.mode == psStatement {
+		lx.mode = psExpression
+	}
+}
+
+// statementWord colors the word that starts a statement: a keyword, a
+// hashtable key or, most often, a command
+func (lx *psLexer) statementWord(i int) int {
+	src := lx.src
+	start := i
+	if end := wordEnd(src, i); isWordStart(src[i]) && lx.at(end) != '-' {
+		// ForEach-Object is a command, foreach a keyword
+		word := strings.ToLower(src[i:end])
+		if psKeywords[word] {
+			lx.w.emit(SyntaxKeyword, src[i:end])
+			lx.funcName = word == "function" || word == "filter"
+			return end
+		}
+		if eq := skipSpaces(src, end); lx.at(eq) == '=' && lx.at(eq+1) != '=' {
+			// a hashtable key: @{ Name = ... }
+			lx.w.emit(SyntaxMember, src[i:end])
+			lx.mode = psExpression
+			return end
+		}
+	}
+	end := barewordEnd(src, i)
+	lx.w.emit(SyntaxCommand, src[start:end])
+	if lx.funcName {
+		lx.funcName = false
+		lx.mode = psExpression
+	} else {
+		lx.mode = psArguments
+	}
+	return end
+}
+
+// dashWord colors -Name: a parameter among a command's arguments, and
+// otherwise an operator such as -eq
+func (lx *psLexer) dashWord(i int) int {
+	src := lx.src
+	end := i + 1
+	end = wordEnd(src, end)
+	switch {
+	case lx.mode == psArguments:
+		if lx.at(end) == ':' {
+			end++
+		}
+		lx.w.emit(SyntaxParameter, src[i:end])
+	case isPSOperator(src[i+1 : end]):
+		lx.w.emit(SyntaxOperator, src[i:end])
+		lx.mode = psExpression
+	default:
+		lx.w.emit(SyntaxParameter, src[i:end])
+	}
+	return end
+}
+
+// operator colors punctuation and the symbolic operators
+func (lx *psLexer) operator(i int) int {
+	c := lx.src[i]
+	switch c {
+	case '|', ';':
+		lx.mode = psStatement
+	case '=':
+		if !lx.inAttribute() && lx.at(i+1) != '=' {
+			lx.mode = psStatement
+		}
+	case '&':
+		if lx.at(i+1) == '&' {
+			lx.mode = psStatement
+		}
+	}
+	class := SyntaxOperator
+	if c == ',' || c == ';' || c == '[' || c == ']' {
+		class = SyntaxText
+	}
+	lx.w.emit(class, string(c))
+	return i + 1
+}
+
+// variableEnd returns the end of the variable starting at the $ at i
+func (lx *psLexer) variableEnd(i int) int {
+	src := lx.src
+	switch next := lx.at(i + 1); {
+	case next == '{':
+		if end := strings.IndexByte(src[i:], '}'); end >= 0 {
+			return i + end + 1
+		}
+		return len(src)
+	case next == '?' || next == '$' || next == '^':
+		return i + 2
+	}
+	end := wordEnd(src, i+1)
+	if lx.at(end) == ':' && isWordStart(lx.at(end+1)) && psVariableScopes[strings.ToLower(src[i+1:end])] {
+		end = wordEnd(src, end+1)
+	}
+	return end
+}
+
+// isPSTerminator reports whether c ends a bareword
+func isPSTerminator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', ';', '|', '(', ')', '{', '}', ',', '&', '>', '"', '\'':
+		return true
+	}
+	return false
+}
+
+func barewordEnd(src string, i int) int {
+	for i < len(src) && !isPSTerminator(src[i]) {
+		if src[i] == '`' && i+1 < len(src) {
+			i++
+		}
+		i++
+	}
+	return i
+}
+
+// verbatimEnd returns the end of a single-quoted string whose text starts
+// at i; a doubled quote stands for one quote
+func verbatimEnd(src string, i int, quote byte) int {
+	for i < len(src) {
+		if src[i] == quote {
+			if i+1 < len(src) && src[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(src)
+}
+
+// subexpressionEnd returns the offset just past the ) closing the ( at i,
+// skipping brackets and strings inside
+func subexpressionEnd(src string, i int) int {
+	depth := 0
+	for i < len(src) {
+		switch src[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '\'':
+			i = verbatimEnd(src, i+1, '\'')
+			continue
+		case '"':
+			i = expandableEnd(src, i+1)
+			continue
+		case '`':
+			i++
+		}
+		i++
+	}
+	return len(src)
+}
+
+// expandableEnd returns the end of a double-quoted string whose text
+// starts at i
+func expandableEnd(src string, i int) int {
+	for i < len(src) {
+		switch src[i] {
+		case '`':
+			i += 2
+			continue
+		case '"':
+			if i+1 < len(src) && src[i+1] == '"' {
+				i += 2
+				continue
+			}
+			return i + 1
+		case '$':
+			if i+1 < len(src) && src[i+1] == '(' {
+				i = subexpressionEnd(src, i+1)
+				continue
+			}
+		}
+		i++
+	}
+	return len(src)
+}
+
+// expandableString colors the double-quoted string at i and the variables
+// and subexpressions it expands
+func (lx *psLexer) expandableString(i int) int {
+	end := expandableEnd(lx.src, i+1)
+	body := lx.src[i+1 : end]
+	closing := ""
+	if strings.HasSuffix(body, `"`) && end-i > 1 {
+		body, closing = body[:len(body)-1], `"`
+	}
+	lx.w.emit(SyntaxString, `"`)
+	lx.expand(body)
+	lx.w.emit(SyntaxString, closing)
+	return end
+}
+
+// hereStringStart reports whether only blanks follow the @" or @' opening
+// a here-string up to the end of its line
+func (lx *psLexer) hereStringStart(i int) bool {
+	i = skipSpaces(lx.src, i)
+	return i >= len(lx.src) || lx.src[i] == '\n' || lx.src[i] == '\r'
+}
+
+// hereString colors the here-string opening at i; it ends at a line that
+// starts with the quote and @
+func (lx *psLexer) hereString(i int) int {
+	quote := lx.src[i+1]
+	terminator := "\n" + string(quote) + "@"
+	end, closeAt := len(lx.src), len(lx.src)
+	if n := strings.Index(lx.src[i+2:], terminator); n >= 0 {
+		closeAt = i + 2 + n + 1
+		end = closeAt + 2
+	}
+	lx.w.emit(SyntaxString, lx.src[i:i+2])
+	if quote == '"' {
+		lx.expand(lx.src[i+2 : closeAt])
+	} else {
+		lx.w.emit(SyntaxString, lx.src[i+2:closeAt])
+	}
+	lx.w.emit(SyntaxString, lx.src[closeAt:end])
+	return end
+}
+
+// expand colors the text of an expandable string, picking out $variables
+// and $(subexpressions), which are colored as code
+func (lx *psLexer) expand(body string) {
+	inner := &psLexer{src: body}
+	for i := 0; i < len(body); {
+		start := i
+		switch c, next := body[i], inner.at(i+1); {
+		case c == '`':
+			i = min(i+2, len(body))
+			lx.w.emit(SyntaxString, body[start:i])
+		case c == '$' && next == '(':
+			i = subexpressionEnd(body, i+1)
+			code, closing := body[start+2:i], ""
+			lx.w.emit(SyntaxVariable, "$(")
+			if strings.HasSuffix(code, ")") {
+				code, closing = code[:len(code)-1], ")"
+			}
+			for _, t := range LexPowerShell(code) {
+				lx.w.emit(t.Class, t.Text)
+			}
+			lx.w.emit(SyntaxVariable, closing)
+		case c == '$' && (isWordStart(next) || next == '{' || next == '?' || next == '$' || next == '^'):
+			i = inner.variableEnd(i)
+			lx.w.emit(SyntaxVariable, body[start:i])
+		default:
+			i++
+			lx.w.emit(SyntaxString, body[start:i])
+		}
+	}
+}
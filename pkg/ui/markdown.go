@@ -0,0 +1,563 @@
+package ui
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+)
+
+// Markdown styles
+var MarkdownTextStyle = lipgloss.NewStyle().
+	Foreground(TextPrimary)
+
+var MarkdownCodeStyle = lipgloss.NewStyle().
+	Foreground(Secondary).
+	Background(lipgloss.Color("#3a3a3a"))
+
+var MarkdownLinkStyle = lipgloss.NewStyle().
+	Foreground(Info).
+	Underline(true)
+
+var MarkdownQuoteStyle = lipgloss.NewStyle().
+	Border(lipgloss.ThickBorder(), false, false, false, true).
+	BorderForeground(Border).
+	PaddingLeft(1)
+
+var markdownHeadingStyles = []lipgloss.Style{
+	lipgloss.NewStyle().Foreground(Primary).Bold(true).Underline(true),
+	lipgloss.NewStyle().Foreground(Primary).Bold(true),
+	lipgloss.NewStyle().Foreground(Secondary).Bold(true),
+	lipgloss.NewStyle().Foreground(TextPrimary).Bold(true),
+}
+
+// callout is a kind of highlighted block quote, written as "> [!NOTE]" on
+// its first line or "> **Note:** text"
+type callout struct {
+	title string
+	icon  string
+	color lipgloss.Color
+}
+
+var callouts = map[string]callout{
+	"note":      {"Note", "ℹ", Info},
+	"info":      {"Note", "ℹ", Info},
+	"tip":       {"Tip", "✓", Success},
+	"important": {"Important", "!", Secondary},
+	"warning":   {"Warning", "⚠", Primary},
+	"caution":   {"Caution", "✗", Error},
+	"danger":    {"Caution", "✗", Error},
+}
+
+var (
+	headingPattern     = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern        = regexp.MustCompile(`^ {0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	listItemPattern    = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])(\s+|$)`)
+	tableDelimPattern  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	calloutTagPattern  = regexp.MustCompile(`^\[!(\w+)\]\s*$`)
+	calloutLeadPattern = regexp.MustCompile(`^\*\*(\w+):?\*\*:?\s*`)
+)
+
+// Markdown renders a Markdown document for the terminal, wrapping its text
+// to width. It handles headings, emphasis, links, inline code, lists,
+// tables, block quotes and callouts; fenced code blocks go through CodeBlock.
+func Markdown(src string, width int) string {
+	if width < 10 {
+		width = 10
+	}
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	return strings.Join(markdownBlocks(lines, width), "\n\n")
+}
+
+// markdownBlocks renders each block of a document
+func markdownBlocks(lines []string, width int) []string {
+	var blocks []string
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case isFence(line):
+			fence, lang := fenceOf(line)
+			var code []string
+			for i++; i < len(lines) && !closesFence(lines[i], fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++
+			blocks = append(blocks, CodeBlock(strings.Join(code, "\n"), languageName(lang), width))
+
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			blocks = append(blocks, markdownHeading(len(m[1]), m[2], width))
+			i++
+
+		case rulePattern.MatchString(line):
+			blocks = append(blocks, lipgloss.NewStyle().Foreground(Border).Render(strings.Repeat("─", width)))
+			i++
+
+		case strings.HasPrefix(strings.TrimSpace(line), ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			blocks = append(blocks, markdownQuote(quoted, width))
+
+		case isTableStart(lines, i):
+			// The header and delimiter rows are checked by isTableStart; the
+			// body runs on while lines hold cells
+			rows := []string{lines[i], lines[i+1]}
+			for i += 2; i < len(lines) && isTableRow(lines[i]); i++ {
+				rows = append(rows, lines[i])
+			}
+			blocks = append(blocks, markdownTable(rows, width))
+
+		case listItemPattern.MatchString(line):
+			items, end := collectList(lines, i)
+			blocks = append(blocks, markdownList(items, width, 0))
+			i = end
+
+		default:
+			var para []string
+			for ; i < len(lines) && !startsBlock(lines, i); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, wrap(markdownInline(strings.Join(para, " "), MarkdownTextStyle), width))
+		}
+	}
+	return blocks
+}
+
+// startsBlock reports whether line i ends a paragraph by starting another block
+func startsBlock(lines []string, i int) bool {
+	line := lines[i]
+	return strings.TrimSpace(line) == "" ||
+		isFence(line) ||
+		headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) ||
+		strings.HasPrefix(strings.TrimSpace(line), ">") ||
+		isTableStart(lines, i) ||
+		listItemPattern.MatchString(line)
+}
+
+func isFence(line string) bool {
+	fence, _ := fenceOf(line)
+	return fence != ""
+}
+
+// fenceOf returns the fence a line opens a code block with and its language
+func fenceOf(line string) (fence, lang string) {
+	trimmed := strings.TrimSpace(line)
+	for _, c := range []string{"`", "~"} {
+		if n := len(trimmed) - len(strings.TrimLeft(trimmed, c)); n >= 3 {
+			return trimmed[:n], strings.TrimSpace(trimmed[n:])
+		}
+	}
+	return "", ""
+}
+
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// languageName is how a code block's header names its language
+func languageName(lang string) string {
+	switch strings.ToLower(lang) {
+	case "powershell", "pwsh", "ps1", "ps":
+		return "PowerShell"
+	case "csharp", "cs", "c#":
+		return "C#"
+	case "sh", "bash", "shell":
+		return "Bash"
+	case "json", "xml", "csv", "yaml", "html", "sql":
+		return strings.ToUpper(lang)
+	case "":
+		return "Text"
+	}
+	return strings.ToUpper(lang[:1]) + lang[1:]
+}
+
+func markdownHeading(level int, text string, width int) string {
+	style := markdownHeadingStyles[min(level, len(markdownHeadingStyles))-1]
+	return wrap(markdownInline(text, style), width)
+}
+
+// isTableStart reports whether line i is a table's header row: a row of
+// cells followed by a delimiter row with as many cells, with or without
+// leading and trailing pipes. Both rows need a pipe somewhere, so a line
+// underlined with dashes stays a paragraph and a rule.
+func isTableStart(lines []string, i int) bool {
+	return isTableRow(lines[i]) &&
+		i+1 < len(lines) && tableDelimPattern.MatchString(lines[i+1]) &&
+		strings.Contains(lines[i+1], "-") && strings.Contains(lines[i+1], "|") &&
+		len(tableRow(lines[i])) == len(tableRow(lines[i+1]))
+}
+
+// isTableRow reports whether a line is a row of a table: a header row, or a
+// line following a table's delimiter row
+func isTableRow(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && strings.Contains(trimmed, "|")
+}
+
+// markdownQuote renders a block quote, or a callout box when it opens with
+// a callout tag
+func markdownQuote(lines []string, width int) string {
+	kind := ""
+	if len(lines) > 0 {
+		first := strings.TrimSpace(lines[0])
+		if m := calloutTagPattern.FindStringSubmatch(first); m != nil {
+			if _, ok := callouts[strings.ToLower(m[1])]; ok {
+				kind = strings.ToLower(m[1])
+				lines = lines[1:]
+			}
+		} else if m := calloutLeadPattern.FindStringSubmatch(first); m != nil {
+			if _, ok := callouts[strings.ToLower(m[1])]; ok {
+				kind = strings.ToLower(m[1])
+				lines = append([]string{first[len(m[0]):]}, lines[1:]...)
+			}
+		}
+	}
+
+	if kind == "" {
+		body := strings.Join(markdownBlocks(lines, width-2), "\n\n")
+		return MarkdownQuoteStyle.Render(body)
+	}
+
+	c := callouts[kind]
+	title := lipgloss.NewStyle().Foreground(c.color).Bold(true).Render(c.icon + " " + c.title)
+	parts := append([]string{title}, markdownBlocks(lines, width-4)...)
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(c.color).
+		Padding(0, 1).
+		Render(strings.Join(parts, "\n"))
+}
+
+// markdownTable renders the lines of a table, header row first
+func markdownTable(lines []string, width int) string {
+	if len(lines) < 2 {
+		return wrap(markdownInline(strings.Join(lines, " "), MarkdownTextStyle), width)
+	}
+	header := tableRow(lines[0])
+	var aligns []lipgloss.Position
+	for _, cell := range tableRow(lines[1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, lipgloss.Center)
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, lipgloss.Right)
+		default:
+			aligns = append(aligns, lipgloss.Left)
+		}
+	}
+
+	var rows [][]string
+	for _, line := range lines[2:] {
+		row := tableRow(line)
+		for len(row) < len(header) {
+			row = append(row, "")
+		}
+		for i := range row {
+			row[i] = markdownInline(row[i], MarkdownTextStyle)
+		}
+		rows = append(rows, row[:len(header)])
+	}
+	for i := range header {
+		header[i] = markdownInline(header[i], lipgloss.NewStyle().Foreground(Primary).Bold(true))
+	}
+
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(Border)).
+		Headers(header...).
+		Rows(rows...).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if col < len(aligns) {
+				style = style.Align(aligns[col])
+			}
+			return style
+		})
+	if out := t.Render(); lipgloss.Width(out) <= width {
+		return out
+	}
+	return t.Width(width).Render()
+}
+
+// tableRow splits a table line into its cells; \| writes a pipe inside a cell
+func tableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// listItem is an item of a list with its lines, the marker removed and
+// the item's indentation taken off the lines that continue it
+type listItem struct {
+	marker  string
+	ordered bool
+	number  int
+	lines   []string
+}
+
+// collectList gathers the items of the list starting at line i and
+// returns them with the index of the first line after the list
+func collectList(lines []string, i int) ([]listItem, int) {
+	var items []listItem
+	base := len(listItemPattern.FindStringSubmatch(lines[i])[1])
+	for i < len(lines) {
+		line := lines[i]
+		m := listItemPattern.FindStringSubmatch(line)
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		switch {
+		case m != nil && len(m[1]) == base:
+			item := listItem{marker: m[2]}
+			if n, err := strconv.Atoi(strings.TrimRight(m[2], ".)")); err == nil {
+				item.ordered, item.number = true, n
+			}
+			if len(items) > 0 && item.ordered != items[0].ordered {
+				// a bulleted list and a numbered one are separate lists
+				return items, i
+			}
+			item.lines = []string{line[len(m[0]):]}
+			items = append(items, item)
+		case strings.TrimSpace(line) == "":
+			// A blank line ends the list unless the next line carries on with it
+			next := i + 1
+			if next >= len(lines) || strings.TrimSpace(lines[next]) == "" {
+				return items, i
+			}
+			nextIndent := len(lines[next]) - len(strings.TrimLeft(lines[next], " \t"))
+			if nextIndent <= base && !listItemPattern.MatchString(lines[next]) {
+				return items, i
+			}
+			last := &items[len(items)-1]
+			last.lines = append(last.lines, "")
+		case indent > base:
+			last := &items[len(items)-1]
+			last.lines = append(last.lines, dedent(line, base+len(last.marker)+1))
+		case m == nil && !startsBlock(lines, i):
+			// a lazy continuation of the item's paragraph
+			last := &items[len(items)-1]
+			last.lines = append(last.lines, strings.TrimSpace(line))
+		default:
+			return items, i
+		}
+		i++
+	}
+	return items, i
+}
+
+// dedent removes up to n columns of leading spaces
+func dedent(line string, n int) string {
+	for n > 0 && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		line = line[1:]
+		n--
+	}
+	return line
+}
+
+// bullets mark the items of unordered lists, one for each level of nesting
+var bullets = []string{"•", "◦", "▪"}
+
+// markdownList renders a list nested depth levels deep, hanging each
+// item's text beside its marker
+func markdownList(items []listItem, width, depth int) string {
+	markers := make([]string, len(items))
+	markerWidth := 0
+	for i, item := range items {
+		if item.ordered {
+			markers[i] = fmt.Sprintf("%d.", items[0].number+i)
+		} else {
+			markers[i] = bullets[depth%len(bullets)]
+		}
+		markerWidth = max(markerWidth, lipgloss.Width(markers[i]))
+	}
+
+	markerStyle := lipgloss.NewStyle().Foreground(Primary).Bold(true)
+	var out []string
+	for i, item := range items {
+		marker := markerStyle.Width(markerWidth + 1).Render(markers[i])
+		body := renderListBody(item.lines, width-markerWidth-1, depth)
+		out = append(out, lipgloss.JoinHorizontal(lipgloss.Top, marker, body))
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderListBody renders the blocks inside a list item, keeping nested
+// lists tight against the item's text
+func renderListBody(lines []string, width, depth int) string {
+	var parts []string
+	for i := 0; i < len(lines); {
+		if listItemPattern.MatchString(lines[i]) && i > 0 {
+			items, end := collectList(lines, i)
+			parts = append(parts, markdownList(items, width, depth+1))
+			i = end
+			continue
+		}
+		start := i
+		for i < len(lines) && !(i > start && listItemPattern.MatchString(lines[i])) {
+			i++
+		}
+		if blocks := markdownBlocks(lines[start:i], width); len(blocks) > 0 {
+			parts = append(parts, strings.Join(blocks, "\n\n"))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// wrap fits rendered text to width, breaking between words
+func wrap(text string, width int) string {
+	if lipgloss.Width(text) <= width {
+		return text
+	}
+	return lipgloss.NewStyle().Width(width).Render(text)
+}
+
+// markdownInline renders the inline markup of a line of text: **strong**,
+// *emphasis*, `code`, [links](url) and backslash escapes
+func markdownInline(text string, style lipgloss.Style) string {
+	var out, run strings.Builder
+	flush := func() {
+		if run.Len() > 0 {
+			out.WriteString(style.Render(run.String()))
+			run.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && unicode.IsPunct(rune(text[i+1])):
+			run.WriteByte(text[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			ticks := text[i : i+n]
+			if end := strings.Index(text[i+n:], ticks); end >= 0 {
+				flush()
+				code := text[i+n : i+n+end]
+				if trimmed := strings.TrimSpace(code); trimmed != "" {
+					code = trimmed
+				}
+				out.WriteString(MarkdownCodeStyle.Render(code))
+				i += n + end + n
+				continue
+			}
+			run.WriteString(ticks)
+			i += n
+			continue
+
+		case c == '*' || c == '_':
+			delim := string(c)
+			if strings.HasPrefix(text[i:], delim+delim) {
+				delim += delim
+			}
+			if end := closingDelimiter(text, i, delim); end > 0 {
+				flush()
+				inner := style.Italic(true)
+				if len(delim) == 2 {
+					inner = style.Bold(true)
+				}
+				out.WriteString(markdownInline(text[i+len(delim):end], inner))
+				i = end + len(delim)
+				continue
+			}
+			run.WriteString(delim)
+			i += len(delim)
+			continue
+
+		case c == '[':
+			if label, url, n, ok := markdownLink(text[i:]); ok {
+				flush()
+				out.WriteString(markdownInline(label, MarkdownLinkStyle))
+				if url != "" && url != label {
+					out.WriteString(lipgloss.NewStyle().Foreground(TextSecondary).Render(" (" + url + ")"))
+				}
+				i += n
+				continue
+			}
+		}
+		run.WriteByte(c)
+		i++
+	}
+	flush()
+	return out.String()
+}
+
+// closingDelimiter finds where emphasis opened with delim at i closes, or
+// returns -1 when it doesn't. As in CommonMark, the opening delimiter must
+// be followed by text and the closing one preceded by it, and underscores
+// don't open or close emphasis inside a word.
+func closingDelimiter(text string, i int, delim string) int {
+	start := i + len(delim)
+	if start >= len(text) || text[start] == ' ' {
+		return -1
+	}
+	if delim[0] == '_' && i > 0 && isWordByte(text[i-1]) {
+		return -1
+	}
+	for j := start + 1; j+len(delim) <= len(text); j++ {
+		if text[j] == '`' {
+			// skip code spans, whose content isn't markup
+			n := len(text[j:]) - len(strings.TrimLeft(text[j:], "`"))
+			if end := strings.Index(text[j+n:], text[j:j+n]); end >= 0 {
+				j += n + end + n - 1
+			}
+			continue
+		}
+		if !strings.HasPrefix(text[j:], delim) || text[j-1] == ' ' {
+			continue
+		}
+		after := j + len(delim)
+		if after < len(text) && text[after] == delim[0] {
+			continue
+		}
+		if delim[0] == '_' && after < len(text) && isWordByte(text[after]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// markdownLink parses a [label](url) link at the start of text and returns
+// its length
+func markdownLink(text string) (label, url string, n int, ok bool) {
+	mid := strings.IndexByte(text, ']')
+	if mid < 0 || !strings.HasPrefix(text[mid:], "](") {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(text[mid:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	return text[1:mid], text[mid+2 : mid+end], mid + end + 1, true
+}
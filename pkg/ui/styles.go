@@ -19,6 +19,27 @@ var (
 	Border        = lipgloss.Color("#4b5563") // Border color
 )
 
+// ConsoleColors maps the System.ConsoleColor names Write-Host accepts to
+// the colors of the Windows Terminal "Campbell" scheme
+var ConsoleColors = map[string]lipgloss.Color{
+	"Black":       lipgloss.Color("#0c0c0c"),
+	"DarkBlue":    lipgloss.Color("#0037da"),
+	"DarkGreen":   lipgloss.Color("#13a10e"),
+	"DarkCyan":    lipgloss.Color("#3a96dd"),
+	"DarkRed":     lipgloss.Color("#c50f1f"),
+	"DarkMagenta": lipgloss.Color("#881798"),
+	"DarkYellow":  lipgloss.Color("#c19c00"),
+	"Gray":        lipgloss.Color("#cccccc"),
+	"DarkGray":    lipgloss.Color("#767676"),
+	"Blue":        lipgloss.Color("#3b78ff"),
+	"Green":       lipgloss.Color("#16c60c"),
+	"Cyan":        lipgloss.Color("#61d6d6"),
+	"Red":         lipgloss.Color("#e74856"),
+	"Magenta":     lipgloss.Color("#b4009e"),
+	"Yellow":      lipgloss.Color("#f9f1a5"),
+	"White":       lipgloss.Color("#f2f2f2"),
+}
+
 // Title styles
 var TitleStyle = lipgloss.NewStyle().
 	Bold(true).
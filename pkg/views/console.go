@@ -0,0 +1,468 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/couragetogroww/powerhell/pkg/psim"
+	"github.com/couragetogroww/powerhell/pkg/ui"
+)
+
+// ConsoleHistorySize is how many commands the console remembers, and so
+// how many are kept with an account
+const ConsoleHistorySize = 500
+
+// maxScrollback is how many lines of output the console keeps
+const maxScrollback = 2000
+
+// continuationPrompt is the prompt of the lines that continue a statement
+const continuationPrompt = ">> "
+
+// ConsoleExitMsg is sent when the learner types exit in the console
+type ConsoleExitMsg struct{}
+
+// ConsoleOutputMsg is sent when a command run in the console has finished
+type ConsoleOutputMsg struct {
+	output   string // what the command wrote, ready to show
+	prompt   string // the prompt for the location the command left
+	location string
+}
+
+// ConsoleView is the Studio's interactive console: a simulated PowerShell
+// session whose variables and location last until the learner resets it
+type ConsoleView struct {
+	width    int
+	height   int
+	rs       *psim.Runspace
+	running  bool   // whether a command is running; the session is left alone until it ends
+	prompt   string // the session's prompt and location, kept so rendering needn't touch the session
+	location string
+
+	input   textinput.Model
+	pending []string // the lines typed so far of a statement that continues
+	lines   []string // the scrollback
+	scroll  int      // how many lines the view is scrolled back
+
+	history       []string // commands run, oldest first
+	historyLoaded bool
+	recalled      int    // the history entry shown; len(history) when none is
+	typed         string // what was typed before going through the history
+
+	searching bool // whether Ctrl+R is searching the history
+	query     string
+	found     int  // the history entry the search found, -1 for none
+	failing   bool // whether the query matches nothing older
+
+	completions  []string // what Tab cycles through, nil when not completing
+	completion   int      // the completion shown
+	completeHead string   // the input before the word being completed
+	completeTail string   // the input after it
+
+	// LoadHistory returns the commands run in earlier sessions, oldest first
+	LoadHistory func() []string
+	// OnCommand is called with every command run, to add it to the history
+	OnCommand func(command string) error
+}
+
+// NewConsoleView creates a console with a fresh session
+func NewConsoleView(width, height int) *ConsoleView {
+	c := &ConsoleView{width: width, height: height}
+	c.input = textinput.New()
+	c.input.Prompt = ""
+	c.input.TextStyle = lipgloss.NewStyle().Foreground(ui.TextPrimary)
+	c.input.Cursor.SetMode(cursor.CursorStatic)
+	c.input.Focus()
+	c.Reset()
+	return c
+}
+
+// SetSize changes the size the view is laid out for
+func (c *ConsoleView) SetSize(width, height int) {
+	c.width, c.height = width, height
+}
+
+// Reset starts a new session, forgetting variables, functions and the
+// location; the history stays
+func (c *ConsoleView) Reset() {
+	if c.rs != nil {
+		c.rs.Close()
+	}
+	c.rs = psim.NewRunspace()
+	c.prompt, c.location = c.rs.Prompt(), c.rs.Location()
+	c.lines, c.scroll = nil, 0
+	c.setText("")
+	version, _ := c.rs.GetVariable("PSVersionTable")
+	if table, ok := version.(*psim.Hashtable); ok {
+		version, _ = table.Get("PSVersion")
+	}
+	c.print(lipgloss.NewStyle().Foreground(ui.TextSecondary).Render(
+		fmt.Sprintf("PowerShell %v (simulated)\nType exit to go back, cls to clear the screen; F5 starts a new session.\n", version)))
+}
+
+// loadHistory reads the history of earlier sessions the first time it is needed
+func (c *ConsoleView) loadHistory() {
+	if c.historyLoaded {
+		return
+	}
+	c.historyLoaded = true
+	if c.LoadHistory != nil {
+		c.history = append(c.LoadHistory(), c.history...)
+	}
+	c.recalled = len(c.history)
+}
+
+// Update handles a key press; the command it returns runs what was typed
+// or reports exit
+func (c *ConsoleView) Update(msg tea.KeyMsg) tea.Cmd {
+	c.loadHistory()
+	if c.running && msg.String() != "pgup" && msg.String() != "pgdown" {
+		return nil
+	}
+	if c.searching {
+		return c.updateSearch(msg)
+	}
+	key := msg.String()
+	if key != "tab" && key != "shift+tab" {
+		c.completions = nil
+	}
+	switch key {
+	case "enter":
+		return c.submit()
+	case "up":
+		c.recall(-1)
+	case "down":
+		c.recall(1)
+	case "ctrl+r":
+		c.searching, c.query, c.found, c.failing = true, "", -1, false
+		c.typed = c.text()
+	case "tab":
+		c.complete(1)
+	case "shift+tab":
+		c.complete(-1)
+	case "pgup":
+		c.scroll += c.rows() - 1
+	case "pgdown":
+		c.scroll = max(c.scroll-c.rows()+1, 0)
+	case "esc":
+		c.setText("")
+	case "f5":
+		c.Reset()
+	default:
+		var cmd tea.Cmd
+		c.input, cmd = c.input.Update(msg)
+		return cmd
+	}
+	return nil
+}
+
+// text returns the whole statement being typed
+func (c *ConsoleView) text() string {
+	return strings.Join(append(append([]string{}, c.pending...), c.input.Value()), "\n")
+}
+
+// setText replaces the statement being typed, its last line going in the
+// input and the ones before it continuing above
+func (c *ConsoleView) setText(text string) {
+	lines := strings.Split(text, "\n")
+	c.pending = lines[:len(lines)-1]
+	c.input.SetValue(lines[len(lines)-1])
+	c.input.CursorEnd()
+}
+
+// submit runs the statement typed, or continues it on the next line when
+// it isn't complete; an empty line runs it as it is. The statement runs in
+// the command returned, and its output comes back in a ConsoleOutputMsg.
+func (c *ConsoleView) submit() tea.Cmd {
+	line := c.input.Value()
+	script := c.text()
+	c.scroll = 0
+	if line != "" && incomplete(script) {
+		c.pending = append(c.pending, line)
+		c.input.SetValue("")
+		return nil
+	}
+	c.print(c.renderStatement(script))
+	c.setText("")
+	c.recalled = len(c.history)
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+	c.addHistory(script)
+
+	switch strings.ToLower(strings.TrimSpace(script)) {
+	case "exit":
+		return func() tea.Msg { return ConsoleExitMsg{} }
+	case "cls", "clear", "clear-host":
+		c.lines = nil
+		return nil
+	}
+	c.rs.SetConsoleWidth(c.textWidth())
+	c.running = true
+	rs := c.rs
+	return func() tea.Msg {
+		result := rs.Run(script)
+		return ConsoleOutputMsg{output: renderResult(result), prompt: rs.Prompt(), location: rs.Location()}
+	}
+}
+
+// OnOutput shows what a command wrote and takes the input again
+func (c *ConsoleView) OnOutput(msg ConsoleOutputMsg) {
+	c.running = false
+	c.prompt, c.location = msg.prompt, msg.location
+	if out := strings.TrimSuffix(msg.output, "\n"); out != "" {
+		c.print(out)
+	}
+}
+
+// incomplete reports whether a statement stops short, as after an opening
+// brace or a pipe, so that the console asks for more
+func incomplete(script string) bool {
+	_, err := psim.Parse(script)
+	perr, ok := err.(*psim.ParseError)
+	return ok && perr.Incomplete
+}
+
+// addHistory remembers a command, unless it repeats the one before
+func (c *ConsoleView) addHistory(command string) {
+	if n := len(c.history); n > 0 && c.history[n-1] == command {
+		return
+	}
+	c.history = append(c.history, command)
+	if len(c.history) > ConsoleHistorySize {
+		c.history = c.history[len(c.history)-ConsoleHistorySize:]
+	}
+	c.recalled = len(c.history)
+	if c.OnCommand != nil {
+		if err := c.OnCommand(command); err != nil {
+			c.print(ui.ErrorIndicatorStyle.Render("History could not be saved: " + err.Error()))
+		}
+	}
+}
+
+// recall shows an older or newer command from the history, going back to
+// what was typed after the newest
+func (c *ConsoleView) recall(dir int) {
+	to := c.recalled + dir
+	if to < 0 || to > len(c.history) {
+		return
+	}
+	if c.recalled == len(c.history) {
+		c.typed = c.text()
+	}
+	c.recalled = to
+	if to == len(c.history) {
+		c.setText(c.typed)
+	} else {
+		c.setText(c.history[to])
+	}
+}
+
+// updateSearch handles keys while Ctrl+R searches the history: typing
+// narrows the search, Ctrl+R again finds an older match, Enter runs the
+// match, Esc keeps it to edit and Ctrl+G goes back to what was typed
+func (c *ConsoleView) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+r":
+		if c.found > 0 {
+			c.search(c.found - 1)
+		}
+	case "backspace":
+		if q := []rune(c.query); len(q) > 0 {
+			c.query = string(q[:len(q)-1])
+			c.search(len(c.history) - 1)
+		}
+	case "enter":
+		c.searching = false
+		return c.submit()
+	case "ctrl+g":
+		c.searching = false
+		c.setText(c.typed)
+	case "esc", "left", "right", "home", "end":
+		c.searching = false
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			c.query += string(msg.Runes)
+			from := c.found
+			if from < 0 {
+				from = len(c.history) - 1
+			}
+			c.search(from)
+		}
+	}
+	return nil
+}
+
+// search finds the newest history entry at or before from that contains
+// the query
+func (c *ConsoleView) search(from int) {
+	c.failing = false
+	if c.query == "" {
+		c.found = -1
+		c.setText(c.typed)
+		return
+	}
+	query := strings.ToLower(c.query)
+	for i := min(from, len(c.history)-1); i >= 0; i-- {
+		if strings.Contains(strings.ToLower(c.history[i]), query) {
+			c.found = i
+			c.recalled = i
+			c.setText(c.history[i])
+			return
+		}
+	}
+	c.failing = true
+}
+
+// complete replaces the word before the cursor with the next or previous
+// of the completions the session offers for it
+func (c *ConsoleView) complete(dir int) {
+	if c.completions == nil {
+		line := []rune(c.input.Value())
+		pos := c.input.Position()
+		offset := len(string(line[:pos]))
+		start, matches := c.rs.Complete(string(line), offset)
+		if len(matches) == 0 {
+			return
+		}
+		c.completions, c.completion = matches, -1
+		c.completeHead = string(line)[:start]
+		c.completeTail = string(line)[offset:]
+	}
+	n := len(c.completions)
+	switch {
+	case c.completion < 0 && dir > 0:
+		c.completion = 0
+	case c.completion < 0:
+		c.completion = n - 1
+	default:
+		c.completion = (c.completion + dir + n) % n
+	}
+	text := c.completeHead + c.completions[c.completion]
+	c.input.SetValue(text + c.completeTail)
+	c.input.SetCursor(len([]rune(text)))
+}
+
+// print adds text to the scrollback, wrapped to the console's width
+func (c *ConsoleView) print(text string) {
+	wrapped := lipgloss.NewStyle().Width(c.textWidth()).Render(text)
+	c.lines = append(c.lines, strings.Split(wrapped, "\n")...)
+	if len(c.lines) > maxScrollback {
+		c.lines = c.lines[len(c.lines)-maxScrollback:]
+	}
+}
+
+// renderStatement echoes a statement after its prompt, highlighted
+func (c *ConsoleView) renderStatement(script string) string {
+	promptStyle := lipgloss.NewStyle().Foreground(ui.Primary)
+	lines := ui.HighlightLines(script, "PowerShell")
+	for i := range lines {
+		prompt := continuationPrompt
+		if i == 0 {
+			prompt = c.prompt
+		}
+		lines[i] = promptStyle.Render(prompt) + lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderInput shows the statement being typed with the cursor, and under
+// it the history search or the completions being cycled through
+func (c *ConsoleView) renderInput() []string {
+	promptStyle := lipgloss.NewStyle().Foreground(ui.Primary)
+	hint := lipgloss.NewStyle().Foreground(ui.TextSecondary)
+	if c.running {
+		return []string{hint.Render(ui.LoadingSpinner(0) + " Running...")}
+	}
+	var rows []string
+	if len(c.pending) > 0 {
+		rows = strings.Split(c.renderStatement(strings.Join(c.pending, "\n")), "\n")
+	}
+	prompt := c.prompt
+	if len(c.pending) > 0 {
+		prompt = continuationPrompt
+	}
+	c.input.Width = max(c.textWidth()-lipgloss.Width(prompt)-1, 1)
+	rows = append(rows, promptStyle.Render(prompt)+c.input.View())
+
+	switch {
+	case c.searching:
+		label := "bck-i-search: "
+		if c.failing {
+			label = "failing " + label
+		}
+		rows = append(rows, hint.Render(label)+c.query+hint.Render("_"))
+	case len(c.completions) > 1:
+		var names []string
+		for i, name := range c.completions {
+			if i == c.completion {
+				name = lipgloss.NewStyle().Foreground(ui.Primary).Bold(true).Render(name)
+			} else {
+				name = hint.Render(name)
+			}
+			names = append(names, name)
+		}
+		rows = append(rows, lipgloss.NewStyle().MaxWidth(c.textWidth()).Render(strings.Join(names, "  ")))
+	}
+	return rows
+}
+
+// textWidth is the width of the console's text inside the border and padding
+func (c *ConsoleView) textWidth() int {
+	return max(c.width-4, 20)
+}
+
+// rows is how many lines of the console fit on the screen
+func (c *ConsoleView) rows() int {
+	return max(c.height-lipgloss.Height(c.renderHeader())-lipgloss.Height(c.renderHelpBar())-2, 3)
+}
+
+func (c *ConsoleView) renderHeader() string {
+	return ui.Header("🔥 PowerHell Studio", "Interactive Console · "+c.location)
+}
+
+func (c *ConsoleView) renderHelpBar() string {
+	return lipgloss.NewStyle().
+		Width(c.width).
+		Align(lipgloss.Center).
+		Background(ui.Surface).
+		Padding(0, 2).
+		Render(ui.HelpBar([][2]string{
+			{"Enter", "Run"},
+			{"↑↓", "History"},
+			{"Ctrl+R", "Search"},
+			{"Tab", "Complete"},
+			{"PgUp/PgDn", "Scroll"},
+			{"F5", "Reset"},
+			{"exit", "Back"},
+		}))
+}
+
+// Render returns the console view
+func (c *ConsoleView) Render() string {
+	c.loadHistory()
+	rows := c.rows()
+	all := append(append([]string{}, c.lines...), c.renderInput()...)
+	c.scroll = min(c.scroll, max(len(all)-rows, 0))
+	end := len(all) - c.scroll
+	visible := all[max(end-rows, 0):end]
+
+	console := lipgloss.NewStyle().
+		Width(c.width-2).
+		Height(rows).
+		Background(lipgloss.Color("#0d0d0d")).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ui.Border).
+		Padding(0, 1).
+		Render(strings.Join(visible, "\n"))
+
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		c.renderHeader(),
+		console,
+		c.renderHelpBar(),
+	)
+}
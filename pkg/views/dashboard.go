@@ -113,6 +113,8 @@ func (d *DashboardView) Render() string {
 		{"↑↓←→", "Navigate"},
 		{"Enter", "Select Module"},
 		{"Tab", "Categories"},
+		{"c", "Console"},
+		{"m", "Menu"},
 		{"?", "Help"},
 		{"q", "Quit"},
 	})
@@ -0,0 +1,703 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/couragetogroww/powerhell/pkg/ui"
+)
+
+// editorIndent is one level of indentation, inserted by Tab
+const editorIndent = "    "
+
+// editorGutter is the width of the line numbers
+const editorGutter = 4
+
+// maxUndo is how many edits can be undone
+const maxUndo = 200
+
+// editorPairs maps each bracket to its partner
+var editorPairs = map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+
+// CodeEditor is a multi-line code editor with a cursor, selection,
+// automatic indentation, bracket matching, scrolling and undo
+type CodeEditor struct {
+	Width    int    // columns, line numbers included; 0 for no limit
+	Height   int    // rows, annotations included; 0 for no limit
+	Language string // the language to highlight
+	Focused  bool   // whether the cursor and the matching bracket show
+
+	// Annotate returns rows to show under a line, counted from 1, such as
+	// the analyzer's findings on it
+	Annotate func(line int) []string
+
+	lines  [][]rune
+	cursor editorPos
+	anchor *editorPos // the other end of the selection, nil when nothing is selected
+	goal   int        // the column moving up and down aims for
+	top    int        // the first line shown
+	left   int        // the first column shown
+
+	undo, redo []editorState
+	lastEdit   string // the kind of the last edit, so undo takes back typing a word at a time
+	changed    bool
+	clipboard  string
+}
+
+// editorPos is a place in the text, both counted from 0 in characters
+type editorPos struct {
+	line, col int
+}
+
+func (p editorPos) before(q editorPos) bool {
+	return p.line < q.line || p.line == q.line && p.col < q.col
+}
+
+// editorState is what an undo goes back to
+type editorState struct {
+	text   string
+	cursor editorPos
+}
+
+// NewCodeEditor creates an editor holding text, with the cursor at its start
+func NewCodeEditor(text, language string) *CodeEditor {
+	e := &CodeEditor{Language: language}
+	e.SetValue(text)
+	return e
+}
+
+// Value returns the text in the editor
+func (e *CodeEditor) Value() string {
+	lines := make([]string, len(e.lines))
+	for i, line := range e.lines {
+		lines[i] = string(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetValue replaces the text, moving the cursor to the start and
+// forgetting the undo history
+func (e *CodeEditor) SetValue(text string) {
+	e.setText(text)
+	e.cursor, e.anchor, e.goal, e.top, e.left = editorPos{}, nil, 0, 0, 0
+	e.undo, e.redo, e.lastEdit = nil, nil, ""
+}
+
+// ReplaceAll replaces the text as one edit, which can be undone
+func (e *CodeEditor) ReplaceAll(text string) {
+	e.record("replace")
+	e.replace(editorPos{}, e.end(), text)
+	e.cursor, e.goal = editorPos{}, 0
+}
+
+func (e *CodeEditor) setText(text string) {
+	e.lines = nil
+	for _, line := range strings.Split(normalizeText(text), "\n") {
+		e.lines = append(e.lines, []rune(line))
+	}
+}
+
+// normalizeText turns line endings into \n and tabs into spaces, so every
+// character takes one column
+func normalizeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.ReplaceAll(text, "\t", editorIndent)
+}
+
+// Cursor returns the line and column of the cursor, counted from 1
+func (e *CodeEditor) Cursor() (line, col int) {
+	return e.cursor.line + 1, e.cursor.col + 1
+}
+
+// Offset returns the byte offset of the cursor in Value
+func (e *CodeEditor) Offset() int {
+	n := 0
+	for _, line := range e.lines[:e.cursor.line] {
+		n += len(string(line)) + 1
+	}
+	return n + len(string(e.lines[e.cursor.line][:e.cursor.col]))
+}
+
+// Update applies a key press and reports whether it changed the text
+func (e *CodeEditor) Update(msg tea.KeyMsg) bool {
+	e.changed = false
+	if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+		switch {
+		case msg.Alt:
+		case msg.Paste:
+			e.record("paste")
+			e.insert(string(msg.Runes))
+		default:
+			e.typeText(string(msg.Runes))
+		}
+		return e.changed
+	}
+
+	switch key := msg.String(); key {
+	case "left", "shift+left":
+		p, _ := e.step(e.cursor, -1)
+		if start, _, ok := e.selection(); ok && key == "left" {
+			p = start
+		}
+		e.move(p, key != "left")
+	case "right", "shift+right":
+		p, _ := e.step(e.cursor, 1)
+		if _, end, ok := e.selection(); ok && key == "right" {
+			p = end
+		}
+		e.move(p, key != "right")
+	case "up", "shift+up":
+		e.moveLines(-1, key != "up")
+	case "down", "shift+down":
+		e.moveLines(1, key != "down")
+	case "pgup":
+		e.moveLines(-max(e.Height-1, 1), false)
+	case "pgdown":
+		e.moveLines(max(e.Height-1, 1), false)
+	case "home", "shift+home":
+		e.move(editorPos{e.cursor.line, e.homeCol()}, key != "home")
+	case "end", "shift+end":
+		e.move(editorPos{e.cursor.line, len(e.lines[e.cursor.line])}, key != "end")
+	case "ctrl+left", "ctrl+shift+left":
+		e.move(e.wordStep(e.cursor, -1), key != "ctrl+left")
+	case "ctrl+right", "ctrl+shift+right":
+		e.move(e.wordStep(e.cursor, 1), key != "ctrl+right")
+	case "ctrl+home", "ctrl+shift+home":
+		e.move(editorPos{}, key != "ctrl+home")
+	case "ctrl+end", "ctrl+shift+end":
+		e.move(e.end(), key != "ctrl+end")
+	case "ctrl+a":
+		e.move(editorPos{}, false)
+		e.move(e.end(), true)
+
+	case "enter":
+		e.newline()
+	case "backspace", "ctrl+h":
+		e.backspace()
+	case "delete":
+		e.deleteForward()
+	case "tab":
+		if start, end, ok := e.selection(); ok && start.line != end.line {
+			e.indentLines(true)
+		} else {
+			e.typeText(strings.Repeat(" ", len(editorIndent)-e.cursor.col%len(editorIndent)))
+		}
+	case "shift+tab":
+		e.indentLines(false)
+
+	case "ctrl+z":
+		e.restore(&e.undo, &e.redo)
+	case "ctrl+y":
+		e.restore(&e.redo, &e.undo)
+	case "ctrl+x":
+		e.cut()
+	case "ctrl+v":
+		if e.clipboard != "" {
+			e.record("paste")
+			e.insert(e.clipboard)
+		}
+	}
+	return e.changed
+}
+
+// move puts the cursor at p, extending the selection or dropping it
+func (e *CodeEditor) move(p editorPos, selecting bool) {
+	if selecting && e.anchor == nil {
+		anchor := e.cursor
+		e.anchor = &anchor
+	} else if !selecting {
+		e.anchor = nil
+	}
+	e.cursor, e.goal, e.lastEdit = p, p.col, ""
+}
+
+// moveLines moves the cursor up or down, keeping to the column it started
+// in where the lines are long enough
+func (e *CodeEditor) moveLines(n int, selecting bool) {
+	line := min(max(e.cursor.line+n, 0), len(e.lines)-1)
+	goal := e.goal
+	e.move(editorPos{line, min(goal, len(e.lines[line]))}, selecting)
+	e.goal = goal
+}
+
+// homeCol is where Home goes: the first character of the line after its
+// indentation, or the very start when the cursor is already there
+func (e *CodeEditor) homeCol() int {
+	indent := len(leadingSpaces(e.lines[e.cursor.line]))
+	if e.cursor.col == indent {
+		return 0
+	}
+	return indent
+}
+
+func (e *CodeEditor) end() editorPos {
+	last := len(e.lines) - 1
+	return editorPos{last, len(e.lines[last])}
+}
+
+// at returns the character at p, or 0 at the end of a line
+func (e *CodeEditor) at(p editorPos) rune {
+	if line := e.lines[p.line]; p.col < len(line) {
+		return line[p.col]
+	}
+	return 0
+}
+
+// step moves p one character forward or back, across line ends; it
+// reports false at the start and end of the text
+func (e *CodeEditor) step(p editorPos, dir int) (editorPos, bool) {
+	switch {
+	case dir < 0 && p.col > 0:
+		return editorPos{p.line, p.col - 1}, true
+	case dir < 0 && p.line > 0:
+		return editorPos{p.line - 1, len(e.lines[p.line-1])}, true
+	case dir > 0 && p.col < len(e.lines[p.line]):
+		return editorPos{p.line, p.col + 1}, true
+	case dir > 0 && p.line < len(e.lines)-1:
+		return editorPos{p.line + 1, 0}, true
+	}
+	return p, false
+}
+
+// wordStep moves p past the spaces next to it and then past a word, or a
+// run of symbols, in the given direction
+func (e *CodeEditor) wordStep(p editorPos, dir int) editorPos {
+	// crossed returns the character stepping from q passes over
+	crossed := func(q editorPos) (rune, editorPos, bool) {
+		next, ok := e.step(q, dir)
+		if dir < 0 {
+			return e.at(next), next, ok
+		}
+		return e.at(q), next, ok
+	}
+	r, next, ok := crossed(p)
+	for ok && (r == 0 || unicode.IsSpace(r)) {
+		p = next
+		r, next, ok = crossed(p)
+	}
+	word := isEditorWordRune(r)
+	for ok && r != 0 && !unicode.IsSpace(r) && isEditorWordRune(r) == word {
+		p = next
+		r, next, ok = crossed(p)
+	}
+	return p
+}
+
+// isEditorWordRune reports whether r is part of a word; a dash is, so that
+// Get-Process is one word
+func isEditorWordRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// selection returns the selected range in text order
+func (e *CodeEditor) selection() (start, end editorPos, ok bool) {
+	if e.anchor == nil || *e.anchor == e.cursor {
+		return e.cursor, e.cursor, false
+	}
+	start, end = *e.anchor, e.cursor
+	if end.before(start) {
+		start, end = end, start
+	}
+	return start, end, true
+}
+
+// text returns the text between two positions
+func (e *CodeEditor) text(start, end editorPos) string {
+	if start.line == end.line {
+		return string(e.lines[start.line][start.col:end.col])
+	}
+	parts := []string{string(e.lines[start.line][start.col:])}
+	for _, line := range e.lines[start.line+1 : end.line] {
+		parts = append(parts, string(line))
+	}
+	parts = append(parts, string(e.lines[end.line][:end.col]))
+	return strings.Join(parts, "\n")
+}
+
+// replace swaps the text between two positions for text and puts the
+// cursor after it
+func (e *CodeEditor) replace(start, end editorPos, text string) {
+	head := string(e.lines[start.line][:start.col])
+	tail := string(e.lines[end.line][end.col:])
+	parts := strings.Split(normalizeText(text), "\n")
+	last := len(parts) - 1
+	col := len([]rune(parts[last]))
+	parts[0] = head + parts[0]
+	parts[last] += tail
+
+	lines := make([][]rune, 0, len(e.lines)+last)
+	lines = append(lines, e.lines[:start.line]...)
+	for _, part := range parts {
+		lines = append(lines, []rune(part))
+	}
+	lines = append(lines, e.lines[end.line+1:]...)
+	e.lines = lines
+
+	if last == 0 {
+		col += start.col
+	}
+	e.cursor, e.anchor, e.goal = editorPos{start.line + last, col}, nil, col
+}
+
+// insert puts text at the cursor in place of the selection
+func (e *CodeEditor) insert(text string) {
+	start, end, _ := e.selection()
+	e.replace(start, end, text)
+}
+
+// record saves the text before an edit for undo; typing or deleting
+// characters one after another is saved once
+func (e *CodeEditor) record(kind string) {
+	e.changed = true
+	if kind == e.lastEdit && (kind == "type" || kind == "delete") {
+		return
+	}
+	e.undo = append(e.undo, editorState{e.Value(), e.cursor})
+	if len(e.undo) > maxUndo {
+		e.undo = e.undo[1:]
+	}
+	e.redo = nil
+	e.lastEdit = kind
+}
+
+// restore goes back to the last state saved in from, saving the current
+// one in to so it can be gone forward to again
+func (e *CodeEditor) restore(from, to *[]editorState) {
+	if len(*from) == 0 {
+		return
+	}
+	state := (*from)[len(*from)-1]
+	*from = (*from)[:len(*from)-1]
+	*to = append(*to, editorState{e.Value(), e.cursor})
+	e.setText(state.text)
+	line := min(state.cursor.line, len(e.lines)-1)
+	e.cursor = editorPos{line, min(state.cursor.col, len(e.lines[line]))}
+	e.anchor, e.goal, e.lastEdit, e.changed = nil, e.cursor.col, "", true
+}
+
+// typeText inserts typed characters; a closing bracket typed on an empty
+// line lines up with the line that opened its block
+func (e *CodeEditor) typeText(text string) {
+	e.record("type")
+	e.insert(text)
+	if strings.TrimSpace(text) == "" {
+		// a space ends a word, which undo takes back on its own
+		e.lastEdit = ""
+	}
+
+	closer, _ := e.step(e.cursor, -1)
+	line := e.lines[closer.line]
+	if len(text) != 1 || !strings.Contains(")]}", text) || strings.TrimSpace(string(line[:closer.col])) != "" {
+		return
+	}
+	if open, ok := e.matchBracket(e.classes(), closer); ok {
+		indent := leadingSpaces(e.lines[open.line])
+		e.lines[closer.line] = append([]rune(indent), line[closer.col:]...)
+		e.cursor.col = len([]rune(indent)) + 1
+		e.goal = e.cursor.col
+	}
+}
+
+// newline breaks the line at the cursor, keeping its indentation and
+// indenting one level more after an opening bracket; between a pair of
+// brackets the closing one moves to a line of its own
+func (e *CodeEditor) newline() {
+	e.record("newline")
+	e.insert("")
+	line := e.lines[e.cursor.line]
+	// spaces after the cursor would only push the rest of the line along
+	spaces := len(leadingSpaces(line[e.cursor.col:]))
+	e.replace(e.cursor, editorPos{e.cursor.line, e.cursor.col + spaces}, "")
+	line = e.lines[e.cursor.line]
+
+	indent := leadingSpaces(line[:e.cursor.col])
+	before := strings.TrimRight(string(line[:e.cursor.col]), " ")
+	if before == "" || !strings.ContainsRune("([{", rune(before[len(before)-1])) {
+		e.insert("\n" + indent)
+		return
+	}
+	inner := indent + editorIndent
+	if e.at(e.cursor) == editorPairs[rune(before[len(before)-1])] {
+		e.insert("\n" + inner + "\n" + indent)
+		e.cursor = editorPos{e.cursor.line - 1, len(inner)}
+		e.goal = e.cursor.col
+		return
+	}
+	e.insert("\n" + inner)
+}
+
+// backspace deletes the selection or the character before the cursor; in
+// a line's indentation it deletes back to the previous level
+func (e *CodeEditor) backspace() {
+	if _, _, ok := e.selection(); ok {
+		e.record("cut")
+		e.insert("")
+		return
+	}
+	start, ok := e.step(e.cursor, -1)
+	if !ok {
+		return
+	}
+	col := e.cursor.col
+	if col > 0 && strings.TrimSpace(string(e.lines[e.cursor.line][:col])) == "" {
+		start.col = (col - 1) / len(editorIndent) * len(editorIndent)
+	}
+	e.record("delete")
+	e.replace(start, e.cursor, "")
+}
+
+// deleteForward deletes the selection or the character under the cursor
+func (e *CodeEditor) deleteForward() {
+	if _, _, ok := e.selection(); ok {
+		e.record("cut")
+		e.insert("")
+		return
+	}
+	if end, ok := e.step(e.cursor, 1); ok {
+		e.record("delete")
+		e.replace(e.cursor, end, "")
+	}
+}
+
+// cut moves the selection to the clipboard, or the whole line when
+// nothing is selected
+func (e *CodeEditor) cut() {
+	start, end, ok := e.selection()
+	if !ok {
+		start, end = editorPos{e.cursor.line, 0}, editorPos{e.cursor.line, len(e.lines[e.cursor.line])}
+		if next, ok := e.step(end, 1); ok {
+			end = next
+		} else if prev, ok := e.step(start, -1); ok {
+			start = prev
+		}
+		e.clipboard = string(e.lines[e.cursor.line]) + "\n"
+	} else {
+		e.clipboard = e.text(start, end)
+	}
+	e.record("cut")
+	e.replace(start, end, "")
+}
+
+// indentLines indents or outdents by one level each line the selection
+// touches, or the cursor's line
+func (e *CodeEditor) indentLines(indent bool) {
+	first, last := e.cursor.line, e.cursor.line
+	if start, end, ok := e.selection(); ok {
+		first, last = start.line, end.line
+		if end.col == 0 && last > first {
+			last--
+		}
+	}
+	e.record("indent")
+	for i := first; i <= last; i++ {
+		shift := len(editorIndent)
+		if indent {
+			e.lines[i] = append([]rune(editorIndent), e.lines[i]...)
+		} else {
+			shift = -min(len(leadingSpaces(e.lines[i])), len(editorIndent))
+			e.lines[i] = e.lines[i][-shift:]
+		}
+		for _, p := range []*editorPos{&e.cursor, e.anchor} {
+			if p != nil && p.line == i {
+				p.col = max(p.col+shift, 0)
+			}
+		}
+	}
+	e.goal = e.cursor.col
+}
+
+// leadingSpaces returns the indentation of a line
+func leadingSpaces(line []rune) string {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return string(line[:n])
+}
+
+// classes returns the syntax class of every character, line by line
+func (e *CodeEditor) classes() [][]ui.SyntaxClass {
+	classes := make([][]ui.SyntaxClass, 1, len(e.lines))
+	for _, t := range ui.Lex(e.Value(), e.Language) {
+		for _, r := range t.Text {
+			if r == '\n' {
+				classes = append(classes, nil)
+				continue
+			}
+			classes[len(classes)-1] = append(classes[len(classes)-1], t.Class)
+		}
+	}
+	return classes
+}
+
+func classAt(classes [][]ui.SyntaxClass, p editorPos) ui.SyntaxClass {
+	if p.line < len(classes) && p.col < len(classes[p.line]) {
+		return classes[p.line][p.col]
+	}
+	return ui.SyntaxText
+}
+
+// isCode reports whether the character at p is code rather than part of a
+// string or a comment, where brackets don't pair up
+func isCode(classes [][]ui.SyntaxClass, p editorPos) bool {
+	class := classAt(classes, p)
+	return class != ui.SyntaxString && class != ui.SyntaxComment
+}
+
+// matchBracket finds the partner of the bracket at p
+func (e *CodeEditor) matchBracket(classes [][]ui.SyntaxClass, p editorPos) (editorPos, bool) {
+	bracket := e.at(p)
+	partner, ok := editorPairs[bracket]
+	if !ok || !isCode(classes, p) {
+		return p, false
+	}
+	dir := 1
+	if strings.ContainsRune(")]}", bracket) {
+		dir = -1
+	}
+	depth := 0
+	for q, ok := p, true; ok; q, ok = e.step(q, dir) {
+		if r := e.at(q); (r != bracket && r != partner) || !isCode(classes, q) {
+			continue
+		} else if r == bracket {
+			depth++
+		} else if depth--; depth == 0 {
+			return q, true
+		}
+	}
+	return p, false
+}
+
+// bracketPair returns the bracket at or just before the cursor and its
+// partner
+func (e *CodeEditor) bracketPair(classes [][]ui.SyntaxClass) ([2]editorPos, bool) {
+	candidates := []editorPos{e.cursor}
+	if p, ok := e.step(e.cursor, -1); ok && p.line == e.cursor.line {
+		candidates = append(candidates, p)
+	}
+	for _, p := range candidates {
+		if match, ok := e.matchBracket(classes, p); ok {
+			return [2]editorPos{p, match}, true
+		}
+	}
+	return [2]editorPos{}, false
+}
+
+// scroll moves the view so that the cursor is in it
+func (e *CodeEditor) scroll() {
+	if e.cursor.line < e.top {
+		e.top = e.cursor.line
+	}
+	for e.Height > 0 && e.top < e.cursor.line && e.rows(e.top, e.cursor.line) > e.Height {
+		e.top++
+	}
+	if width := e.Width - editorGutter; width > 0 {
+		e.left = min(e.left, e.cursor.col)
+		e.left = max(e.left, e.cursor.col-width+1)
+	}
+}
+
+// rows counts the rows from the first line to the last take up with the
+// annotations between them
+func (e *CodeEditor) rows(first, last int) int {
+	n := last - first + 1
+	if e.Annotate != nil {
+		for i := first; i < last; i++ {
+			n += len(e.Annotate(i + 1))
+		}
+	}
+	return n
+}
+
+// View renders the lines in view, numbered and highlighted, with the
+// annotations under them
+func (e *CodeEditor) View() string {
+	e.scroll()
+	classes := e.classes()
+	var brackets []editorPos
+	if pair, ok := e.bracketPair(classes); ok && e.Focused {
+		brackets = pair[:]
+	}
+
+	number := lipgloss.NewStyle().
+		Foreground(ui.TextSecondary).
+		Width(editorGutter).
+		Align(lipgloss.Right)
+	var rows []string
+	for i := e.top; i < len(e.lines) && (e.Height <= 0 || len(rows) < e.Height); i++ {
+		style := number
+		if e.Focused && i == e.cursor.line {
+			style = style.Foreground(ui.Primary)
+		}
+		rows = append(rows, style.Render(fmt.Sprintf("%d ", i+1))+e.renderLine(i, classes, brackets))
+		if e.Annotate != nil {
+			rows = append(rows, e.Annotate(i+1)...)
+		}
+	}
+	if e.Height > 0 && len(rows) > e.Height {
+		rows = rows[:e.Height]
+	}
+	return strings.Join(rows, "\n")
+}
+
+// renderLine highlights the visible part of a line, marking the cursor,
+// the selection and the brackets that pair up
+func (e *CodeEditor) renderLine(i int, classes [][]ui.SyntaxClass, brackets []editorPos) string {
+	start, end, selected := e.selection()
+	styleAt := func(p editorPos) lipgloss.Style {
+		style := ui.CodeTheme[classAt(classes, p)]
+		if selected && !p.before(start) && p.before(end) {
+			style = style.Background(ui.Border)
+		}
+		for _, b := range brackets {
+			if b == p {
+				style = style.Bold(true).Underline(true)
+			}
+		}
+		if e.Focused && p == e.cursor {
+			style = style.Reverse(true)
+		}
+		return style
+	}
+
+	line := e.lines[i]
+	last := len(line)
+	if width := e.Width - editorGutter; width > 0 {
+		last = min(last, e.left+width)
+	}
+	var b strings.Builder
+	var run []rune
+	var runStyle lipgloss.Style
+	for col := e.left; col < last; col++ {
+		style := styleAt(editorPos{i, col})
+		if len(run) > 0 && !sameStyle(style, runStyle) {
+			b.WriteString(runStyle.Render(string(run)))
+			run = run[:0]
+		}
+		run, runStyle = append(run, line[col]), style
+	}
+	if len(run) > 0 {
+		b.WriteString(runStyle.Render(string(run)))
+	}
+	// The cursor, or a selection running on to the next line, shows past
+	// the last character
+	if eol := (editorPos{i, len(line)}); last == len(line) && e.left <= len(line) &&
+		(e.Focused && e.cursor == eol || selected && !eol.before(start) && eol.before(end)) {
+		b.WriteString(styleAt(eol).Render(" "))
+	}
+	return b.String()
+}
+
+// sameStyle reports whether two styles render text the same way
+func sameStyle(a, b lipgloss.Style) bool {
+	return a.GetForeground() == b.GetForeground() &&
+		a.GetBackground() == b.GetBackground() &&
+		a.GetBold() == b.GetBold() &&
+		a.GetItalic() == b.GetItalic() &&
+		a.GetUnderline() == b.GetUnderline() &&
+		a.GetReverse() == b.GetReverse()
+}
@@ -3,9 +3,12 @@ package views
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/couragetogroww/powerhell/pkg/modules"
+	"github.com/couragetogroww/powerhell/pkg/psim"
 	"github.com/couragetogroww/powerhell/pkg/ui"
 )
 
@@ -17,28 +20,111 @@ type LessonView struct {
 	width         int
 	height        int
 	showHints     bool
-	currentHint   int
-	userCode      string
+	currentHint   int // how many of the exercise's hints are revealed
+	showSolution  bool
+	attempts      *modules.Attempts // the learner's record on the current exercise, loaded when first needed
+	editor        *CodeEditor
+	editing       bool // whether keys go to the editor
+	draftLoaded   bool // whether the editor holds the learner's draft of the current lesson
+	draftSeq      int  // counts changes, so a draft timer knows whether typing went on
+	draftDirty    bool // whether the editor changed since the draft was saved
+	draftErr      error
 	outputBuffer  string
 	isRunning     bool
+	runSeq        int // counts runs and lesson changes, so a finished run knows whether it still applies
 	activeTab     int // 0: lesson, 1: code editor, 2: output
+	showCmdHelp   bool
+	analyzed      bool              // whether findings hold the analysis of analyzedCode
+	analyzedCode  string            // the code the findings are for
+	findings      []psim.Diagnostic // the analyzer's findings, kept until the code changes
+
+	// Analyzer checks the code in the editor for style and safety; its
+	// findings show under the lines they refer to
+	Analyzer *psim.Analyzer
+
+	// OnPass is called when the learner's code passes the lesson's exercise
+	OnPass func(moduleID, lessonID string) error
+	// LoadAttempts returns the learner's earlier record on a lesson's exercise
+	LoadAttempts func(moduleID, lessonID string) modules.Attempts
+	// OnAttempt is called whenever the record changes: on a submission, a
+	// hint revealed or the solution viewed
+	OnAttempt func(moduleID, lessonID string, attempts modules.Attempts) error
+	// LoadDraft returns the code the learner last wrote for a lesson, if any
+	LoadDraft func(moduleID, lessonID string) (string, bool)
+	// OnDraft is called to save the code in the editor, once typing pauses
+	// and before leaving the lesson
+	OnDraft func(moduleID, lessonID, code string) error
+}
+
+// draftDelay is how long typing has to pause before the draft is saved
+const draftDelay = 2 * time.Second
+
+// DraftTimerMsg is sent when typing in the editor may have paused
+type DraftTimerMsg struct {
+	seq int
+}
+
+// RunDoneMsg is sent when code the learner ran or submitted has finished
+type RunDoneMsg struct {
+	seq    int
+	output string               // what a run wrote, ready to show
+	grade  *modules.GradeResult // the grade of a submission
 }
 
 // NewLessonView creates a new lesson view
 func NewLessonView(module *modules.Module, width, height int) *LessonView {
-	return &LessonView{
+	l := &LessonView{
 		module:        module,
 		currentLesson: 0,
 		lesson:        &module.Lessons[0],
 		width:         width,
 		height:        height,
 		activeTab:     0,
+		Analyzer:      psim.NewAnalyzer(),
 	}
+	l.editor = NewCodeEditor("", "PowerShell")
+	return l
 }
 
-// Update handles input for the lesson view
-func (l *LessonView) Update(key string) {
-	switch key {
+// SetSize changes the size the view is laid out for
+func (l *LessonView) SetSize(width, height int) {
+	l.width, l.height = width, height
+}
+
+// Editing reports whether the learner is typing in the code editor, when
+// every key but Esc goes to the editor
+func (l *LessonView) Editing() bool {
+	return l.editing
+}
+
+// Update handles input for the lesson view; the command it returns starts
+// the timer that saves the draft once typing pauses, or runs the code
+func (l *LessonView) Update(msg tea.KeyMsg) tea.Cmd {
+	if l.editing {
+		switch msg.String() {
+		case "esc":
+			l.editing = false
+		case "f1":
+			l.showCmdHelp = !l.showCmdHelp
+		default:
+			if l.codeEditor().Update(msg) {
+				return l.draftChanged()
+			}
+		}
+		return nil
+	}
+
+	switch msg.String() {
+	case "enter":
+		if l.activeTab == 1 {
+			l.editing = true
+		}
+	case "R":
+		if l.activeTab == 1 {
+			// Undo in the editor brings the learner's code back
+			l.codeEditor().ReplaceAll(l.starterCode())
+			return l.draftChanged()
+		}
 	case "tab":
 		l.activeTab = (l.activeTab + 1) % 3
 	case "shift+tab":
@@ -47,29 +133,349 @@ func (l *LessonView) Update(key string) {
 			l.activeTab = 2
 		}
 	case "?":
-		l.showHints = !l.showHints
+		l.revealHint()
+	case "v":
+		if l.record().SolutionUnlocked() {
+			l.showSolution = !l.showSolution
+			if l.showSolution && l.record().ShowSolution() {
+				l.saveAttempts()
+			}
+			l.activeTab = 0
+		}
+	case "f1":
+		if l.activeTab == 1 {
+			l.showCmdHelp = !l.showCmdHelp
+		}
 	case "n":
 		if l.currentLesson < len(l.module.Lessons)-1 {
-			l.currentLesson++
-			l.lesson = &l.module.Lessons[l.currentLesson]
-			l.showHints = false
-			l.currentHint = 0
+			l.openLesson(l.currentLesson + 1)
 		}
 	case "p":
 		if l.currentLesson > 0 {
-			l.currentLesson--
-			l.lesson = &l.module.Lessons[l.currentLesson]
-			l.showHints = false
-			l.currentHint = 0
+			l.openLesson(l.currentLesson - 1)
 		}
 	case "r":
-		// Run code (simulated)
-		l.isRunning = true
-		l.outputBuffer = "PS C:\\> " + l.userCode + "\n\n" + 
-			"# Output will appear here when connected to PowerShell runtime\n" +
-			"# This is a simulation for now"
+		if !l.isRunning {
+			l.activeTab = 2
+			return l.runCode()
+		}
+	case "s":
+		if !l.isRunning {
+			l.activeTab = 2
+			return l.submitCode()
+		}
+	}
+	return nil
+}
+
+// draftChanged notes an edit and starts the timer that saves the draft
+func (l *LessonView) draftChanged() tea.Cmd {
+	l.draftSeq++
+	l.draftDirty = true
+	seq := l.draftSeq
+	return tea.Tick(draftDelay, func(time.Time) tea.Msg {
+		return DraftTimerMsg{seq: seq}
+	})
+}
+
+// OnDraftTimer saves the draft when nothing was typed since the timer started
+func (l *LessonView) OnDraftTimer(msg DraftTimerMsg) {
+	if msg.seq == l.draftSeq {
+		l.SaveDraft()
+	}
+}
+
+// SaveDraft saves the code in the editor if it changed since it was last saved
+func (l *LessonView) SaveDraft() error {
+	if !l.draftDirty || l.OnDraft == nil {
+		return nil
+	}
+	l.draftErr = l.OnDraft(l.module.ID, l.lesson.ID, l.editor.Value())
+	l.draftDirty = l.draftErr != nil
+	return l.draftErr
+}
+
+// codeEditor returns the editor, holding the learner's draft of the
+// current lesson or else its starter code
+func (l *LessonView) codeEditor() *CodeEditor {
+	if !l.draftLoaded {
+		l.draftLoaded = true
+		code := l.starterCode()
+		if l.LoadDraft != nil {
+			if draft, ok := l.LoadDraft(l.module.ID, l.lesson.ID); ok {
+				code = draft
+			}
+		}
+		l.editor.SetValue(code)
+	}
+	return l.editor
+}
+
+// openLesson moves to another lesson of the module, saving the draft of
+// the one being left
+func (l *LessonView) openLesson(i int) {
+	l.SaveDraft()
+	l.currentLesson = i
+	l.lesson = &l.module.Lessons[i]
+	l.showHints = false
+	l.currentHint = 0
+	l.showSolution = false
+	l.attempts = nil
+	l.editing = false
+	l.draftLoaded = false
+	l.draftErr = nil
+	// A run still going belongs to the lesson being left
+	l.runSeq++
+	if l.isRunning {
 		l.isRunning = false
+		l.outputBuffer = ""
+	}
+}
+
+// starterCode is what the editor holds when a lesson opens
+func (l *LessonView) starterCode() string {
+	if code := l.lesson.GetExercise(l.module.ID).StarterCode; code != "" {
+		return code
+	}
+	return "# Type your PowerShell code here\n" +
+		"$greeting = \"Hello, PowerHell!\"\n" +
+		"Write-Host $greeting"
+}
+
+// record returns the learner's record on the current exercise, loading it
+// the first time; the hints they revealed before stay revealed
+func (l *LessonView) record() *modules.Attempts {
+	if l.attempts == nil {
+		l.attempts = &modules.Attempts{}
+		if l.LoadAttempts != nil {
+			*l.attempts = l.LoadAttempts(l.module.ID, l.lesson.ID)
+		}
+		l.currentHint = min(l.attempts.HintsUsed, len(l.lesson.GetExercise(l.module.ID).Hints))
+	}
+	return l.attempts
+}
+
+func (l *LessonView) saveAttempts() error {
+	if l.OnAttempt == nil {
+		return nil
+	}
+	return l.OnAttempt(l.module.ID, l.lesson.ID, *l.record())
+}
+
+// revealHint shows the hints, revealing the next one each time until all
+// are shown; after that it hides and shows them again
+func (l *LessonView) revealHint() {
+	hints := l.lesson.GetExercise(l.module.ID).Hints
+	attempts := l.record()
+	if l.currentHint >= len(hints) {
+		l.showHints = !l.showHints
+		return
+	}
+	l.showHints = true
+	l.currentHint++
+	if attempts.UseHint(l.currentHint) {
+		l.saveAttempts()
+	}
+	l.activeTab = 0
+}
+
+// code returns what the learner has written
+func (l *LessonView) code() string {
+	return l.codeEditor().Value()
+}
+
+// startRun notes that code started running, returning the number its
+// RunDoneMsg carries
+func (l *LessonView) startRun() int {
+	l.runSeq++
+	l.isRunning = true
+	l.outputBuffer = lipgloss.NewStyle().Foreground(ui.TextSecondary).Render(ui.LoadingSpinner(0) + " Running...")
+	return l.runSeq
+}
+
+// OnRunDone shows the output or the grade of code that finished running,
+// unless the learner has moved to another lesson since
+func (l *LessonView) OnRunDone(msg RunDoneMsg) {
+	if msg.seq != l.runSeq {
+		return
+	}
+	l.isRunning = false
+	if msg.grade != nil {
+		l.showGrade(*msg.grade)
+		return
+	}
+	l.outputBuffer = msg.output
+}
+
+// submitCode grades the learner's code against the exercise. Grading runs
+// the code, so it happens in the command returned rather than in Update.
+func (l *LessonView) submitCode() tea.Cmd {
+	exercise := l.lesson.GetExercise(l.module.ID)
+	code := l.code()
+	seq := l.startRun()
+	return func() tea.Msg {
+		grade := exercise.Grade(code)
+		return RunDoneMsg{seq: seq, grade: &grade}
+	}
+}
+
+// showGrade shows each test case's result, recording the lesson as
+// completed when all of them pass
+func (l *LessonView) showGrade(grade modules.GradeResult) {
+	if grade.Ungradable {
+		// Nothing was graded, so the submission isn't an attempt either
+		l.outputBuffer = lipgloss.NewStyle().Foreground(ui.TextSecondary).Render(grade.Summary() + ". Press r to run it and check the output yourself.")
+		return
+	}
+	attempts := l.record()
+	attempts.Record(grade.Passed())
+	saveErr := l.saveAttempts()
+
+	label := lipgloss.NewStyle().Foreground(ui.TextSecondary)
+	text := lipgloss.NewStyle().Foreground(ui.TextPrimary)
+	var out []string
+	for i, c := range grade.Cases {
+		name := fmt.Sprintf("Test %d", i+1)
+		if c.Input != "" {
+			name += ": " + c.Input
+		}
+		if c.Equivalent {
+			name += " (matches the solution)"
+		}
+		if c.Passed {
+			out = append(out, ui.SuccessIndicatorStyle.Render("✓ "+name))
+			continue
+		}
+		out = append(out, ui.ErrorIndicatorStyle.Render("✗ "+name))
+		if c.Err != nil {
+			out = append(out, text.Render("  The exercise couldn't be set up: "+c.Err.Error()))
+		}
+		for _, check := range c.Checks {
+			if !check.Passed {
+				out = append(out, ui.ErrorIndicatorStyle.Render("  ✗ "+check.Description), text.Render("    "+check.Message))
+			}
+		}
+		if len(c.Diff) == 0 {
+			continue
+		}
+		out = append(out, label.Render("  Expected:"), text.Render(indent(c.Expected, "    ")))
+		out = append(out, label.Render("  Got:"), text.Render(indent(c.Actual, "    ")))
+		out = append(out, label.Render("  Differences:"))
+		for _, d := range c.Diff {
+			style := text
+			switch {
+			case strings.HasPrefix(d, "- "):
+				style = lipgloss.NewStyle().Foreground(ui.Success)
+			case strings.HasPrefix(d, "+ "):
+				style = lipgloss.NewStyle().Foreground(ui.Error)
+			}
+			out = append(out, style.Render("    "+d))
+		}
+	}
+
+	if grade.Preferred != "" {
+		out = append(out, "", label.Render("The lesson's solution writes it as:"), indent(ui.Highlight(grade.Preferred, "PowerShell"), "    "))
+	}
+
+	out = append(out, "")
+	if grade.Passed() {
+		l.lesson.IsCompleted = true
+		summary := ui.SuccessIndicatorStyle.Render(grade.Summary() + " - lesson complete!")
+		if l.OnPass != nil {
+			if err := l.OnPass(l.module.ID, l.lesson.ID); err != nil {
+				summary += "\n" + ui.ErrorIndicatorStyle.Render("Progress could not be saved: "+err.Error())
+			}
+		}
+		out = append(out, summary, text.Render(fmt.Sprintf("Score: %d", attempts.Score())))
+	} else {
+		out = append(out, ui.ErrorIndicatorStyle.Render(grade.Summary()))
+		if attempts.SolutionUnlocked() {
+			out = append(out, text.Render("The solution is unlocked: press v to view it."))
+		} else {
+			out = append(out, text.Render(fmt.Sprintf("The solution unlocks after %d more failed attempts.", attempts.AttemptsUntilSolution())))
+		}
+	}
+	if saveErr != nil {
+		out = append(out, ui.ErrorIndicatorStyle.Render("Attempt could not be saved: "+saveErr.Error()))
+	}
+	l.outputBuffer = strings.Join(out, "\n")
+}
+
+// indent prefixes every line of text, showing (no output) for empty text
+func indent(text, prefix string) string {
+	if text == "" {
+		text = "(no output)"
 	}
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// runCode executes the learner's code in a fresh simulated PowerShell
+// session, in the command returned so that a slow script doesn't hold up
+// the view
+func (l *LessonView) runCode() tea.Cmd {
+	exercise := l.lesson.GetExercise(l.module.ID)
+	code := l.code()
+	// Tables are laid out for the inside of the output pane's border and padding
+	width := l.outputWidth()
+	seq := l.startRun()
+	return func() tea.Msg {
+		rs, err := exercise.NewRunspace()
+		if err != nil {
+			return RunDoneMsg{seq: seq, output: ui.ErrorIndicatorStyle.Render("The exercise couldn't be set up: " + err.Error())}
+		}
+		defer rs.Close()
+		rs.SetConsoleWidth(width)
+		prompt := rs.Prompt()
+		result := rs.Run(code)
+
+		promptStyle := lipgloss.NewStyle().Foreground(ui.Primary)
+		var out strings.Builder
+		out.WriteString(promptStyle.Render(prompt) + strings.Join(ui.HighlightLines(code, "PowerShell"), "\n>> ") + "\n")
+		out.WriteString(renderResult(result))
+		// The closing prompt shows where Set-Location left the session
+		out.WriteString(promptStyle.Render(rs.Prompt()))
+		return RunDoneMsg{seq: seq, output: out.String()}
+	}
+}
+
+// renderResult colors what a run wrote the way a console shows its streams
+func renderResult(result *psim.Result) string {
+	var out strings.Builder
+	for _, seg := range result.Segments() {
+		style := lipgloss.NewStyle().Foreground(ui.TextPrimary)
+		switch seg.Stream {
+		case psim.StreamError:
+			style = lipgloss.NewStyle().Foreground(ui.Error)
+		case psim.StreamWarning, psim.StreamVerbose, psim.StreamDebug:
+			style = lipgloss.NewStyle().Foreground(ui.Secondary)
+		case psim.StreamHost:
+			if color, ok := ui.ConsoleColors[seg.ForegroundColor]; ok {
+				style = style.Foreground(color)
+			}
+			if color, ok := ui.ConsoleColors[seg.BackgroundColor]; ok {
+				style = style.Background(color)
+			}
+		}
+		// Styling line by line keeps colors from bleeding into the padding
+		textLines := strings.Split(seg.Text, "\n")
+		for i, line := range textLines {
+			textLines[i] = style.Render(line)
+		}
+		out.WriteString(strings.Join(textLines, "\n"))
+		if !seg.NoNewline {
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
+
+// outputWidth is the console width of the output pane: the width
+// renderOutput gives it less one column of padding on each side
+func (l *LessonView) outputWidth() int {
+	if w := l.width - 6; w > 40 {
+		return w
+	}
+	return 40
 }
 
 // Render returns the lesson view
@@ -90,18 +496,38 @@ func (l *LessonView) Render() string {
 		content = l.renderLessonContent()
 	case 1:
 		content = l.renderCodeEditor()
+		if l.showCmdHelp {
+			content = lipgloss.JoinHorizontal(lipgloss.Top, content, l.renderCmdHelp())
+		}
 	case 2:
 		content = l.renderOutput()
 	}
 
 	// Help bar
-	helpBar := ui.HelpBar([][2]string{
+	keys := [][2]string{
 		{"Tab", "Switch Tabs"},
 		{"n/p", "Next/Prev Lesson"},
-		{"?", "Show Hints"},
+		{"?", "Next Hint"},
+		{"v", "Solution"},
 		{"r", "Run Code"},
+		{"s", "Submit"},
+		{"F1", "Cmdlet Help"},
 		{"q", "Back to Dashboard"},
-	})
+	}
+	if l.activeTab == 1 {
+		keys = append([][2]string{{"Enter", "Edit Code"}, {"R", "Reset Code"}}, keys...)
+	}
+	if l.editing {
+		keys = [][2]string{
+			{"Esc", "Stop Editing"},
+			{"Shift+Arrows", "Select"},
+			{"Tab", "Indent"},
+			{"Ctrl+Z/Y", "Undo/Redo"},
+			{"Ctrl+X/V", "Cut/Paste"},
+			{"F1", "Cmdlet Help"},
+		}
+	}
+	helpBar := ui.HelpBar(keys)
 
 	// Combine all elements
 	mainContent := lipgloss.JoinVertical(
@@ -141,6 +567,12 @@ func (l *LessonView) renderHeader() string {
 		len(l.module.Lessons), 
 		l.lesson.Title,
 	)
+	if l.lesson.Duration > 0 {
+		subtitle += fmt.Sprintf(" · %d min", int(l.lesson.Duration.Minutes()))
+	}
+	if l.lesson.Difficulty != "" {
+		subtitle += " · " + l.lesson.Difficulty
+	}
 	
 	return ui.Header(title, subtitle)
 }
@@ -164,7 +596,7 @@ func (l *LessonView) renderLessonContent() string {
 	// Code example
 	codeExample := ""
 	if l.lesson.CodeExample != "" {
-		codeExample = ui.CodeBlock(l.lesson.CodeExample, "PowerShell")
+		codeExample = ui.CodeBlock(l.lesson.CodeExample, "PowerShell", l.contentWidth())
 	}
 
 	// Exercise section
@@ -172,9 +604,13 @@ func (l *LessonView) renderLessonContent() string {
 
 	// Hints section (if enabled)
 	hints := ""
-	if l.showHints && l.lesson.Exercise.Hints != nil {
+	if l.showHints {
 		hints = l.renderHints()
 	}
+	solution := ""
+	if l.showSolution {
+		solution = l.renderSolution()
+	}
 
 	sections := []string{description, content}
 	if codeExample != "" {
@@ -186,6 +622,9 @@ func (l *LessonView) renderLessonContent() string {
 	if hints != "" {
 		sections = append(sections, hints)
 	}
+	if solution != "" {
+		sections = append(sections, solution)
+	}
 
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
@@ -197,9 +636,15 @@ func (l *LessonView) renderLessonText() string {
 	// Get dynamic content from the lesson
 	lessonText := l.lesson.GetContent(l.module.ID)
 
-	return lipgloss.NewStyle().
-		Foreground(ui.TextPrimary).
-		Render(lessonText)
+	return ui.Markdown(lessonText, l.contentWidth())
+}
+
+// contentWidth is the width inside the view's padding
+func (l *LessonView) contentWidth() int {
+	if w := l.width - 4; w > 40 {
+		return w
+	}
+	return 40
 }
 
 func (l *LessonView) renderExercise() string {
@@ -208,14 +653,21 @@ func (l *LessonView) renderExercise() string {
 		return ""
 	}
 
+	lines := []string{ui.InfoIndicatorStyle.Render("📝 Exercise"), "", exercise.Instructions}
+	if a := l.record(); a.Submitted > 0 || a.HintsUsed > 0 {
+		status := fmt.Sprintf("Attempts: %d · Hints used: %d of %d", a.Submitted, a.HintsUsed, len(exercise.Hints))
+		if a.Passed {
+			status += fmt.Sprintf(" · Score: %d", a.Score())
+		}
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(ui.TextSecondary).Render(status))
+	}
+
 	exerciseBox := ui.CardStyle.Copy().
 		BorderForeground(ui.Info).
 		Render(
 			lipgloss.JoinVertical(
 				lipgloss.Left,
-				ui.InfoIndicatorStyle.Render("📝 Exercise"),
-				"",
-				exercise.Instructions,
+				lines...,
 			),
 		)
 
@@ -228,57 +680,71 @@ func (l *LessonView) renderHints() string {
 		return ""
 	}
 
-	hint := exercise.Hints[l.currentHint%len(exercise.Hints)]
-	
+	lines := []string{ui.KeybindStyle.Render(fmt.Sprintf("💡 Hints (%d of %d)", l.currentHint, len(exercise.Hints)))}
+	for i, hint := range exercise.Hints[:l.currentHint] {
+		lines = append(lines, "", fmt.Sprintf("%d. %s", i+1, hint))
+	}
+	if l.currentHint < len(exercise.Hints) {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(ui.TextSecondary).Render("Press ? for the next hint; each one costs points."))
+	}
+
 	hintBox := ui.CardStyle.Copy().
 		BorderForeground(ui.Secondary).
 		Render(
 			lipgloss.JoinVertical(
 				lipgloss.Left,
-				ui.KeybindStyle.Render("💡 Hint"),
-				"",
-				hint,
+				lines...,
 			),
 		)
 
 	return hintBox
 }
 
+func (l *LessonView) renderSolution() string {
+	exercise := l.lesson.GetExercise(l.module.ID)
+	if exercise.Solution == "" {
+		return ""
+	}
+
+	return ui.CardStyle.Copy().
+		BorderForeground(ui.Accent).
+		Render(
+			lipgloss.JoinVertical(
+				lipgloss.Left,
+				lipgloss.NewStyle().Foreground(ui.Accent).Bold(true).Render("🔑 Solution"),
+				"",
+				ui.CodeBlock(exercise.Solution, "PowerShell", l.contentWidth()-ui.CardStyle.GetHorizontalFrameSize()),
+			),
+		)
+}
+
 func (l *LessonView) renderCodeEditor() string {
+	width := l.width - 4
+	if l.showCmdHelp {
+		width -= cmdHelpWidth + 2
+	}
 	editorStyle := lipgloss.NewStyle().
-		Width(l.width - 4).
+		Width(width).
 		Height(l.height - 15).
 		Background(lipgloss.Color("#0d0d0d")).
 		Border(lipgloss.RoundedBorder()).
 		BorderForeground(ui.Primary).
 		Padding(1)
 
-	// Initialize with starter code from exercise
-	if l.userCode == "" {
-		exercise := l.lesson.GetExercise(l.module.ID)
-		if exercise.StarterCode != "" {
-			l.userCode = exercise.StarterCode
-		} else {
-			l.userCode = "# Type your PowerShell code here\n" +
-				"$greeting = \"Hello, PowerHell!\"\n" +
-				"Write-Host $greeting"
-		}
-	}
-
-	// Line numbers
-	lines := strings.Split(l.userCode, "\n")
-	var numberedLines []string
-	for i, line := range lines {
-		lineNum := lipgloss.NewStyle().
-			Foreground(ui.TextSecondary).
-			Width(4).
-			Align(lipgloss.Right).
-			Render(fmt.Sprintf("%d ", i+1))
-		
-		numberedLines = append(numberedLines, lineNum + line)
+	// Analyzer findings, keyed by line
+	diagnostics := l.diagnostics()
+	byLine := map[int][]string{}
+	for _, d := range diagnostics {
+		byLine[d.Pos.Line] = append(byLine[d.Pos.Line], renderDiagnostic(d))
 	}
 
-	content := strings.Join(numberedLines, "\n")
+	// The editor fills the inside of the border and padding
+	editor := l.codeEditor()
+	editor.Width = width - 2
+	editor.Height = l.height - 17
+	editor.Focused = l.editing
+	editor.Annotate = func(line int) []string { return byLine[line] }
+	content := editor.View()
 
 	// Status bar
 	status := ""
@@ -289,10 +755,10 @@ func (l *LessonView) renderCodeEditor() string {
 	}
 
 	statusBar := lipgloss.NewStyle().
-		Width(l.width - 4).
+		Width(width).
 		Background(ui.Surface).
 		Padding(0, 1).
-		Render(status + " | Press 'r' to run")
+		Render(status + diagnosticSummary(diagnostics) + l.editorStatus())
 
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
@@ -301,6 +767,115 @@ func (l *LessonView) renderCodeEditor() string {
 	)
 }
 
+// editorStatus shows where the cursor is and how to start or stop editing
+func (l *LessonView) editorStatus() string {
+	line, col := l.codeEditor().Cursor()
+	status := fmt.Sprintf(" | Ln %d, Col %d", line, col)
+	if l.draftErr != nil {
+		status += " | " + ui.ErrorIndicatorStyle.Render("Draft not saved: "+l.draftErr.Error())
+	}
+	if l.editing {
+		return status + " | Press Esc to stop editing"
+	}
+	return status + " | Press Enter to edit, 'r' to run, 's' to submit, 'R' to reset"
+}
+
+// renderDiagnostic shows an analyzer finding under the line it refers to,
+// pointing at its column
+func renderDiagnostic(d psim.Diagnostic) string {
+	icon, color := "ℹ", ui.Info
+	switch d.Severity {
+	case psim.SeverityWarning:
+		icon, color = "⚠", ui.Secondary
+	case psim.SeverityError:
+		icon, color = "✗", ui.Error
+	}
+	return lipgloss.NewStyle().
+		Foreground(color).
+		Render(fmt.Sprintf("%s%s %s (%s)", strings.Repeat(" ", 4+min(d.Pos.Column-1, 40)), icon, d.Message, d.Rule))
+}
+
+// diagnostics returns the analyzer's findings on the code in the editor.
+// The view renders on every keystroke and cursor blink, so the code is
+// analyzed again only when it has changed.
+func (l *LessonView) diagnostics() []psim.Diagnostic {
+	if l.Analyzer == nil {
+		return nil
+	}
+	if code := l.code(); !l.analyzed || code != l.analyzedCode {
+		l.findings = l.Analyzer.Analyze(code)
+		l.analyzed, l.analyzedCode = true, code
+	}
+	return l.findings
+}
+
+// diagnosticSummary counts the analyzer findings for the status bar
+func diagnosticSummary(diagnostics []psim.Diagnostic) string {
+	counts := map[psim.Severity]int{}
+	for _, d := range diagnostics {
+		counts[d.Severity]++
+	}
+	var parts []string
+	for _, sev := range []psim.Severity{psim.SeverityError, psim.SeverityWarning, psim.SeverityInformation} {
+		if n := counts[sev]; n > 0 {
+			name := strings.ToLower(sev.String())
+			if n > 1 && sev != psim.SeverityInformation {
+				name += "s"
+			}
+			parts = append(parts, fmt.Sprintf("%d %s", n, name))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " | " + strings.Join(parts, ", ")
+}
+
+// cmdHelpWidth is the width of the cmdlet help side panel
+const cmdHelpWidth = 44
+
+// renderCmdHelp shows the help of the cmdlet under the editor's cursor, or
+// of the last command before it
+func (l *LessonView) renderCmdHelp() string {
+	panelStyle := lipgloss.NewStyle().
+		Width(cmdHelpWidth).
+		Height(l.height - 15).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ui.Accent).
+		Padding(0, 1)
+
+	editor := l.codeEditor()
+	name := psim.CommandAt(editor.Value(), editor.Offset())
+	topic, ok := psim.CommandHelp(name)
+	if !ok {
+		hint := "Type a cmdlet name in the editor to see its help here."
+		if name != "" {
+			hint = fmt.Sprintf("No help found for '%s'.", name)
+		}
+		return panelStyle.Render(lipgloss.NewStyle().Foreground(ui.TextSecondary).Render(hint))
+	}
+
+	heading := lipgloss.NewStyle().Bold(true).Foreground(ui.Primary)
+	text := lipgloss.NewStyle().Width(cmdHelpWidth - 2)
+	sections := []string{
+		heading.Render(topic.Name),
+		text.Render(topic.Synopsis),
+		"",
+		heading.Render("Syntax"),
+		text.Render(strings.Join(topic.Syntax, "\n\n")),
+	}
+	if len(topic.Examples) > 0 {
+		ex := topic.Examples[0]
+		sections = append(sections,
+			"",
+			heading.Render("Example"),
+			text.Foreground(ui.Success).Render(ex.Code),
+			text.Foreground(ui.TextSecondary).Render(ex.Remarks),
+		)
+	}
+	return panelStyle.Render(lipgloss.JoinVertical(lipgloss.Left, sections...))
+}
+
 func (l *LessonView) renderOutput() string {
 	outputStyle := lipgloss.NewStyle().
 		Width(l.width - 4).
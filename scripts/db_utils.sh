@@ -78,11 +78,22 @@ show_stats() {
     echo -e "${GREEN}Learning Progress:${NC}"
     sqlite3 "$DB_PATH" -header -column "SELECT module_id, lesson_id, completed_at FROM account_progress WHERE account_id = $ACCOUNT_ID ORDER BY completed_at DESC;"
     
+    # Show attempts and hints
+    echo -e "\n${GREEN}Exercise Attempts:${NC}"
+    sqlite3 "$DB_PATH" -header -column "SELECT module_id, lesson_id, attempts, failed_attempts, hints_used, solution_viewed, passed, score FROM account_attempts WHERE account_id = $ACCOUNT_ID ORDER BY updated_at DESC;"
+    
     # Show sessions
     echo -e "\n${GREEN}Recent Sessions:${NC}"
     sqlite3 "$DB_PATH" -header -column "SELECT session_start, session_end, duration_seconds FROM account_sessions WHERE account_id = $ACCOUNT_ID ORDER BY session_start DESC LIMIT 10;"
 }
 
+# Show who is leaning on hints
+show_hints() {
+    check_db
+    echo -e "${BLUE}Hint Usage by Account${NC}\n"
+    sqlite3 "$DB_PATH" -header -column "SELECT a.account_number, a.name, COUNT(t.id) AS lessons, SUM(t.attempts) AS attempts, SUM(t.hints_used) AS hints_used, SUM(t.solution_viewed) AS solutions_viewed, SUM(t.score) AS score FROM accounts a JOIN account_attempts t ON t.account_id = a.id WHERE a.is_active = 1 GROUP BY a.id ORDER BY SUM(t.hints_used) DESC, SUM(t.solution_viewed) DESC, a.name;"
+}
+
 # Backup database
 backup_db() {
     check_db
@@ -113,6 +124,9 @@ case "$1" in
     stats)
         show_stats "$2"
         ;;
+    hints)
+        show_hints
+        ;;
     backup)
         backup_db
         ;;
@@ -122,13 +136,14 @@ case "$1" in
     *)
         echo "PowerHell Database Utilities"
         echo ""
-        echo "Usage: $0 {info|list|search|stats|backup|export}"
+        echo "Usage: $0 {info|list|search|stats|hints|backup|export}"
         echo ""
         echo "Commands:"
         echo "  info              Show database information"
         echo "  list              List all accounts"
         echo "  search <term>     Search for an account"
         echo "  stats <account>   Show account statistics"
+        echo "  hints             Show which accounts lean on hints"
         echo "  backup            Backup the database"
         echo "  export            Export accounts to CSV"
         echo ""